@@ -9,14 +9,19 @@ import (
 	"time"
 
 	"github.com/Spok95/telegram-school-bot/internal/app"
+	"github.com/Spok95/telegram-school-bot/internal/backup"
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
+	"github.com/Spok95/telegram-school-bot/internal/bot/handlers"
 	"github.com/Spok95/telegram-school-bot/internal/bot/handlers/migrations"
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmstore"
+	"github.com/Spok95/telegram-school-bot/internal/broadcast"
 	"github.com/Spok95/telegram-school-bot/internal/config"
-	"github.com/Spok95/telegram-school-bot/internal/ctxutil"
 	"github.com/Spok95/telegram-school-bot/internal/db"
 	"github.com/Spok95/telegram-school-bot/internal/jobs"
 	"github.com/Spok95/telegram-school-bot/internal/logging"
-	"github.com/Spok95/telegram-school-bot/internal/metrics"
+	"github.com/Spok95/telegram-school-bot/internal/notify"
 	"github.com/Spok95/telegram-school-bot/internal/observability"
+	"github.com/Spok95/telegram-school-bot/internal/outbox"
 	"github.com/getsentry/sentry-go"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/joho/godotenv"
@@ -92,6 +97,16 @@ func main() {
 		lg.Sugar.Fatalw("❌ Ошибка миграций", "err", err)
 	}
 
+	// Состояния диалогов (FSM) живут в БД — рестарт не обрывает сценарии пользователей
+	if err := fsmstore.Init(ctx, fsmstore.NewPostgresStore(database)); err != nil {
+		lg.Sugar.Warnw("fsm state load", "err", err)
+	}
+
+	// Inline-кнопки подписываются ключом из конфига: подделать или переиспользовать чужую нельзя
+	callback.Init(cfg.CallbackSecret, cfg.CallbackTTL)
+	// Тихие часы пользователей считаются по времени школы
+	notify.Init(cfg.Location)
+
 	err = db.SetActivePeriod(ctx, database)
 	if err != nil {
 		log.Println("❌ Ошибка установки активного периода:", err)
@@ -99,20 +114,96 @@ func main() {
 
 	// === Фоновые задачи ===
 	jr := jobs.New(ctx)
+	jr.SkipWhile(handlers.RestoreInProgress)
 
 	// Раз в час проверяем «1 сентября после 07:00».
 	// Дедуп по lastNotifiedStartYear гарантирует один пуш в год.
 	jr.Every(time.Hour, "schoolyear_notifier", func(ctx context.Context) error {
-		return app.RunSchoolYearNotifier(ctx, bot, database)
+		return app.RunSchoolYearNotifier(ctx, database)
+	})
+	jr.Every(time.Hour, "fsm_purge", fsmstore.PurgeExpired)
+	// Перевод в следующий класс в дату, выбранную админом в «🎓 Перевод классов»
+	jr.Every(time.Hour, "class_promotion", func(ctx context.Context) error {
+		return app.RunScheduledPromotion(ctx, bot, database, cfg.Location)
+	})
+	// Уведомления о баллах: очередь разбирается часто, но каждому получателю —
+	// не больше одного сообщения за окно, поэтому массовое начисление приходит одним письмом
+	jr.Every(30*time.Second, "score_notifications", func(ctx context.Context) error {
+		return app.RunScoreNotifications(ctx, database, cfg.ScoreNotifyWindow)
+	})
+	jr.Every(24*time.Hour, "score_notifications_purge", func(ctx context.Context) error {
+		return db.PurgeScoreNotices(ctx, database, 30*24*time.Hour)
+	})
+	// Запланированные рассылки «📨 Рассылки» ставятся в очередь в назначенную минуту
+	jr.Every(time.Minute, "broadcasts", func(ctx context.Context) error {
+		return broadcast.RunScheduled(ctx, database)
+	})
+	// Слоты консультаций по шаблонам учителей — на CONSULT_TEMPLATE_DAYS дней вперёд, без каникул
+	app.SetConsultTemplateHorizon(cfg.ConsultTemplateDays)
+	app.SetCalendarBaseURL(cfg.CalendarBaseURL)
+	jr.Every(time.Hour, "consult_templates", func(ctx context.Context) error {
+		return app.RunConsultTemplates(ctx, database, cfg.ConsultTemplateDays)
+	})
+	// Лист ожидания: освободившиеся и новые слоты сначала предлагаются очереди, истёкшие
+	// предложения переходят к следующему
+	app.SetWaitlistOfferTTL(cfg.WaitlistOfferTTL)
+	jr.Every(time.Minute, "consult_waitlist", func(ctx context.Context) error {
+		return app.RunWaitlistOffers(ctx, bot, database)
+	})
+	// Каталог бэкапов: шифрование, очистка по политике хранения и пробное восстановление новых копий
+	backupKeys, err := backup.ParseKeyring(cfg.BackupEncryptionKeys, cfg.BackupEncryptionKeyID)
+	if err != nil {
+		lg.Sugar.Fatalw("backup encryption keys", "err", err)
+	}
+	handlers.SetBackupCatalog(backup.NewCatalog(cfg.BackupDir, backupKeys), backup.Retention{
+		Daily: cfg.BackupKeepDaily, Weekly: cfg.BackupKeepWeekly, Monthly: cfg.BackupKeepMonthly,
+	})
+	jr.Every(time.Hour, "backup_catalog", func(ctx context.Context) error {
+		return handlers.RunBackupMaintenance(ctx, database)
+	})
+	jr.Every(24*time.Hour, "outbox_purge", func(ctx context.Context) error {
+		return db.PurgeOutbox(ctx, database, 30*24*time.Hour)
 	})
 
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
-	updates := bot.GetUpdatesChan(u)
+	// Очередь исходящих сообщений: уведомления уходят с повторами и в пределах лимитов Telegram,
+	// отложенные на тихие часы — после их окончания
+	go outbox.NewSender(bot, database, outbox.Config{
+		RatePerSec:  cfg.OutboxRatePerSec,
+		ChatGap:     cfg.OutboxChatGap,
+		MaxAttempts: cfg.OutboxMaxAttempts,
+	}).Run(ctx)
 
 	// === HTTP: /healthz, /metrics ===
-	app.StartHTTP(ctx, cfg.HTTPAddr, database)
+	httpSrv := app.StartHTTP(ctx, cfg.HTTPAddr, database)
 	lg.Sugar.Infow("http started", "addr", cfg.HTTPAddr)
+	if cfg.RosterImportToken != "" {
+		httpSrv.Handle(app.RosterImportPath, app.NewRosterImportHandler(database, cfg.RosterImportToken))
+	}
+	if cfg.DBExportToken != "" {
+		httpSrv.Handle(app.DBExportPath, app.NewDBExportHandler(database, cfg.DBExportToken, backupKeys))
+	}
+
+	// === UPDATES: polling или webhook ===
+	var updates <-chan tgbotapi.Update
+	switch cfg.UpdateMode {
+	case config.UpdateModeWebhook:
+		// без буфера: Telegram получает 200 только когда апдейт принят в очередь пула
+		ch := make(chan tgbotapi.Update)
+		httpSrv.Handle(cfg.WebhookPath, app.NewWebhookHandler(ctx, cfg.WebhookSecret, ch))
+		if err := app.SetWebhook(bot, cfg.WebhookURL, cfg.WebhookSecret); err != nil {
+			lg.Sugar.Fatalw("set webhook", "err", err)
+		}
+		updates = ch
+		lg.Sugar.Infow("webhook mode", "url", cfg.WebhookURL, "path", cfg.WebhookPath)
+	default:
+		if err := app.DeleteWebhook(bot); err != nil {
+			lg.Sugar.Warnw("delete webhook", "err", err)
+		}
+		u := tgbotapi.NewUpdate(0)
+		u.Timeout = 60
+		updates = bot.GetUpdatesChan(u)
+		lg.Sugar.Infow("polling mode")
+	}
 
 	// === REMINDERS ===
 	jobs.StartConsultReminderLoop(ctx, bot, database)
@@ -120,71 +211,26 @@ func main() {
 	// === Фоновые задачи ===
 	// app.StartSchoolYearNotifier(bot, database, cfg.Location) // если функция поддерживает tz
 
+	// === WORKERS: апдейты одного чата — по порядку, разных чатов — параллельно ===
+	pool := app.NewUpdatePool(ctx, cfg.UpdateWorkers, cfg.UpdateQueueSize, func(c context.Context, upd tgbotapi.Update) {
+		app.ProcessUpdate(c, bot, database, upd)
+	})
+	lg.Sugar.Infow("update pool started", "workers", cfg.UpdateWorkers, "queue", cfg.UpdateQueueSize)
+
 	for {
 		select {
 		case <-ctx.Done():
-			lg.Sugar.Infow("shutdown requested")
-			time.Sleep(300 * time.Millisecond)
+			lg.Sugar.Infow("shutdown requested, draining updates")
+			drainCtx, cancel := context.WithTimeout(context.Background(), cfg.UpdateDrainTimeout)
+			if err := pool.Drain(drainCtx); err != nil {
+				lg.Sugar.Warnw("update drain", "err", err)
+			}
+			cancel()
 			return
 		case upd := <-updates:
-			metrics.BotUpdates.Inc()
-
-			// callback/message как было — только завернём в recover-защиту
-			func() {
-				defer func() {
-					if r := recover(); r != nil {
-						sentry.CurrentHub().Recover(r)
-						lg.Sugar.Errorw("panic in update", "panic", r)
-						metrics.HandlerErrors.Inc()
-					}
-				}()
-
-				// формируем per-update контекст с таймаутом и метаданными
-				baseCtx, cancel := ctxutil.WithTimeout(ctx, 15*time.Second)
-				defer cancel()
-
-				var chatID int64
-				var userID int64
-				op := "update"
-
-				if upd.CallbackQuery != nil {
-					if upd.CallbackQuery.Message != nil && upd.CallbackQuery.Message.Chat != nil {
-						chatID = upd.CallbackQuery.Message.Chat.ID
-					}
-					if upd.CallbackQuery.From != nil {
-						userID = upd.CallbackQuery.From.ID
-					}
-					op = "callback"
-				}
-				if upd.Message != nil {
-					if upd.Message.Chat != nil {
-						chatID = upd.Message.Chat.ID
-					}
-					if upd.Message.From != nil {
-						userID = upd.Message.From.ID
-					}
-					op = "message"
-				}
-
-				// Привязываем метаданные к контексту
-				updCtx := ctxutil.WithOp(baseCtx, op)
-				if chatID != 0 {
-					updCtx = ctxutil.WithChatID(updCtx, chatID)
-				}
-				if userID != 0 {
-					updCtx = ctxutil.WithUserID(updCtx, userID)
-				}
-
-				// передаём ctx в app-уровень
-				if upd.CallbackQuery != nil {
-					app.HandleCallback(updCtx, bot, database, upd.CallbackQuery)
-					return
-				}
-				if upd.Message != nil {
-					app.HandleMessage(updCtx, bot, database, upd.Message)
-					return
-				}
-			}()
+			if err := pool.Submit(ctx, upd); err != nil {
+				lg.Sugar.Warnw("update dropped", "update_id", upd.UpdateID, "err", err)
+			}
 		}
 	}
 }
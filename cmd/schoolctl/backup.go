@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/backup"
+	"github.com/Spok95/telegram-school-bot/internal/bot/handlers/migrations"
+)
+
+// catalog — каталог бэкапов бота (BACKUP_DIR) с ключами шифрования из окружения.
+func (e *env) catalog() (*backup.Catalog, error) {
+	keys, err := backup.ParseKeyring(e.getenv("BACKUP_ENCRYPTION_KEYS"), e.getenv("BACKUP_ENCRYPTION_KEY_ID"))
+	if err != nil {
+		return nil, fmt.Errorf("BACKUP_ENCRYPTION_KEYS: %w", err)
+	}
+	dir := e.getenv("BACKUP_DIR")
+	if dir == "" {
+		dir = "/app/backups"
+	}
+	return backup.NewCatalog(dir, keys), nil
+}
+
+func backupCmd(ctx context.Context, e *env, args []string) (any, error) {
+	fs := newFlags("backup")
+	out := fs.String("out", "", "")
+	if _, err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+	c, err := e.catalog()
+	if err != nil {
+		return nil, err
+	}
+	dbx, err := e.db()
+	if err != nil {
+		return nil, err
+	}
+	if *out == "" {
+		*out = filepath.Join(c.Dir, fmt.Sprintf("school_db_%s.zip", time.Now().Format("2006-01-02_1504")))
+	}
+	// с ключами архив шифруется, как в «📤 Экспорт БД»
+	if c.Keys.Enabled() && *out != "-" && !backup.IsEncrypted(*out) {
+		*out += backup.EncryptedExt
+	}
+
+	var m *backup.Manifest
+	write := func(w io.Writer) error {
+		var enc io.WriteCloser
+		if c.Keys.Enabled() {
+			if enc, err = c.Keys.Encrypt(w); err != nil {
+				return err
+			}
+			w = enc
+		}
+		if m, err = backup.WriteZip(ctx, dbx, w); err != nil {
+			return err
+		}
+		if enc != nil {
+			return enc.Close()
+		}
+		return nil
+	}
+	if *out == "-" {
+		return nil, write(e.stdout)
+	}
+	if err := writeFileAtomic(*out, write); err != nil {
+		return nil, err
+	}
+	res := map[string]any{
+		"file": *out, "schema_version": m.SchemaVersion,
+		"tables": len(m.Tables), "rows": m.TotalRows(), "encrypted": c.Keys.Enabled(),
+	}
+	if c.Keys.Enabled() {
+		res["key_id"] = c.Keys.CurrentID()
+	}
+	return res, nil
+}
+
+type planJSON struct {
+	ArchiveVersion int64                `json:"archive_version"`
+	TargetVersion  int64                `json:"target_version"`
+	Changes        []backup.TableChange `json:"changes"`
+	Unchanged      int                  `json:"unchanged"`
+	Problems       []string             `json:"problems,omitempty"`
+	Warnings       []string             `json:"warnings,omitempty"`
+}
+
+func toPlanJSON(p *backup.Plan) planJSON {
+	changes := p.Changes
+	if changes == nil {
+		changes = []backup.TableChange{}
+	}
+	return planJSON{
+		ArchiveVersion: p.ArchiveVersion, TargetVersion: p.TargetVersion, Changes: changes,
+		Unchanged: p.Unchanged, Problems: p.Problems, Warnings: p.Warnings,
+	}
+}
+
+// restoreCmd — то же безопасное восстановление, что в боте: пробный запуск во временной схеме,
+// снимок текущей БД, восстановление, сверка и откат к снимку при ошибке. Без --yes — только пробный запуск.
+func restoreCmd(ctx context.Context, e *env, args []string) (any, error) {
+	fs := newFlags("restore")
+	file := fs.String("file", "", "")
+	yes := fs.Bool("yes", false, "")
+	if _, err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+	name := filepath.Base(*file)
+	if *file == "" {
+		return nil, usagef("нужен --file")
+	}
+	// дамп восстанавливает sidecar — из консоли его не достать
+	if !strings.HasSuffix(strings.ToLower(backup.PlainName(name)), ".zip") {
+		return nil, usagef("--file: нужна выгрузка *.zip или *.zip.enc; дампы sidecar восстанавливаются через бота")
+	}
+	c, err := e.catalog()
+	if err != nil {
+		return nil, err
+	}
+	dbx, err := e.db()
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &backup.Entry{Name: name, Path: *file, Encrypted: backup.IsEncrypted(name)}
+	path, cleanup, err := c.Decrypted(entry, os.TempDir())
+	if err != nil {
+		return nil, fmt.Errorf("чтение бэкапа: %w", err)
+	}
+	defer cleanup()
+
+	ch, err := backup.TestRestore(ctx, dbx, path)
+	if err != nil {
+		return nil, fmt.Errorf("пробное восстановление не удалось: %w", err)
+	}
+	target, err := migrations.Latest()
+	if err != nil {
+		return nil, err
+	}
+	current, err := backup.TableCounts(ctx, dbx)
+	if err != nil {
+		return nil, err
+	}
+	deps, err := backup.ForeignKeys(ctx, dbx)
+	if err != nil {
+		return nil, err
+	}
+	plan := backup.PlanRestore(ch, current, deps, target)
+	if !plan.OK() {
+		return nil, fmt.Errorf("восстанавливать из этого бэкапа нельзя: %s", strings.Join(plan.Problems, "; "))
+	}
+	if !*yes {
+		return map[string]any{"file": *file, "dry_run": true, "plan": toPlanJSON(plan)}, nil
+	}
+
+	snap, err := c.Snapshot(ctx, dbx, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("снимок текущей БД, восстановление отменено: %w", err)
+	}
+	err = backup.RestoreZipChecked(ctx, dbx, path, func(after map[string]int64) error {
+		return plan.CheckRestored(ch, after)
+	})
+	if err == nil {
+		return map[string]any{"file": *file, "restored": true, "snapshot": snap.Path, "plan": toPlanJSON(plan)}, nil
+	}
+
+	// откат нужен и после Ctrl+C
+	rctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Minute)
+	defer cancel()
+	if rerr := c.Rollback(rctx, dbx, snap); rerr != nil {
+		return nil, fmt.Errorf("восстановление: %v; откат к снимку %s не удался: %w — восстановите снимок вручную", err, snap.Path, rerr)
+	}
+	return nil, fmt.Errorf("восстановление: %w; БД возвращена к снимку %s", err, snap.Path)
+}
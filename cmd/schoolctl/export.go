@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/export"
+	"github.com/Spok95/telegram-school-bot/internal/roster"
+)
+
+func exportScores(ctx context.Context, e *env, args []string) (any, error) {
+	fs := newFlags("export scores")
+	class := fs.String("class", "", "")
+	periodID := fs.Int64("period", 0, "")
+	format := fs.String("format", "json", "")
+	out := fs.String("out", "", "")
+	if _, err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+	number, letter, ok := roster.ParseClass(*class)
+	if !ok {
+		return nil, usagef("--class: класс вида 7А")
+	}
+	switch *format {
+	case "json", "csv", "xlsx":
+	default:
+		return nil, usagef("--format: json, csv или xlsx")
+	}
+	if *format == "xlsx" && *out == "" {
+		return nil, usagef("для xlsx нужен --out ФАЙЛ")
+	}
+
+	dbx, err := e.db()
+	if err != nil {
+		return nil, err
+	}
+	if *periodID == 0 {
+		p, err := db.GetActivePeriod(ctx, dbx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("нет активного периода — укажите --period (см. period list)")
+		}
+		if err != nil {
+			return nil, err
+		}
+		*periodID = p.ID
+	}
+	scores, err := db.GetScoresByClassAndPeriod(ctx, dbx, int64(number), letter, *periodID)
+	if err != nil {
+		return nil, err
+	}
+	collective, err := db.GetClassCollectiveByPeriod(ctx, dbx, int64(number), letter, *periodID)
+	if err != nil {
+		return nil, err
+	}
+	rows := export.ClassScoreRows(scores, collective)
+	classTitle := fmt.Sprintf("%d%s", number, letter)
+
+	if *out == "" {
+		if *format == "csv" {
+			return nil, export.WriteClassScoresCSV(e.stdout, rows)
+		}
+		return map[string]any{"class": classTitle, "period_id": *periodID, "rows": rows}, nil
+	}
+
+	if err := writeFileAtomic(*out, func(w io.Writer) error {
+		switch *format {
+		case "xlsx":
+			f, err := export.ClassScoresWorkbook(rows)
+			if err != nil {
+				return err
+			}
+			return f.Write(w)
+		case "csv":
+			return export.WriteClassScoresCSV(w, rows)
+		default:
+			return json.NewEncoder(w).Encode(rows)
+		}
+	}); err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"class": classTitle, "period_id": *periodID, "format": *format,
+		"file": *out, "rows": len(rows),
+	}, nil
+}
+
+// writeFileAtomic пишет во временный .part и переименовывает: недописанный файл не останется под итоговым именем.
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(path+".part", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(path+".part", path)
+	}
+	if err != nil {
+		_ = os.Remove(path + ".part")
+	}
+	return err
+}
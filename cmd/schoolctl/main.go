@@ -0,0 +1,167 @@
+// schoolctl — админские операции без Telegram: миграции, администраторы, пользователи,
+// периоды, выгрузка баллов, бэкап и восстановление, пересчёт коллективного рейтинга.
+//
+// Результат команды — одна строка JSON в stdout, ошибка — JSON {"error": …} в stderr и
+// код выхода 1 (2 — неверные аргументы), поэтому schoolctl удобно вызывать из cron и скриптов.
+// Подключение — как у бота: DATABASE_URL из окружения или .env.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/joho/godotenv"
+)
+
+// command — подкоманда; name из одного или двух слов: «backup», «migrate up».
+type command struct {
+	name  string
+	args  string
+	about string
+	run   func(ctx context.Context, e *env, args []string) (any, error)
+}
+
+var commands = []command{
+	{"migrate up", "", "применить все миграции", migrateUp},
+	{"migrate down", "--yes", "откатить последнюю миграцию", migrateDown},
+	{"migrate status", "", "состояние миграций", migrateStatus},
+	{"admin add", "--telegram-id N [--name ФИО]", "сделать пользователя администратором (создать, если его нет)", adminAdd},
+	{"admin remove", "--telegram-id N [--role teacher|administration]", "снять роль администратора", adminRemove},
+	{"user find", "ЗАПРОС [--limit N]", "найти пользователей по ФИО или классу («7А»)", userFind},
+	{"user deactivate", "--id N", "деактивировать пользователя", userDeactivate},
+	{"period list", "", "учебные периоды", periodList},
+	{"period create", "--name ИМЯ --start 2025-09-01 --end 2025-12-31 [--activate]", "создать период", periodCreate},
+	{"period activate", "--id N", "сделать период активным", periodActivate},
+	{"export scores", "--class 7А [--period N] [--format xlsx|csv|json] [--out ФАЙЛ]", "баллы класса за период", exportScores},
+	{"backup", "[--out ФАЙЛ|-]", "выгрузка БД в zip с CSV (в BACKUP_DIR по умолчанию)", backupCmd},
+	{"restore", "--file ФАЙЛ [--yes]", "восстановление из zip: без --yes — только пробный запуск", restoreCmd},
+	{"recompute-collective", "[--dry-run]", "сверить и исправить коллективный рейтинг классов по журналу", recomputeCollective},
+}
+
+// usageError — неверные аргументы: код выхода 2.
+type usageError struct{ msg string }
+
+func (e usageError) Error() string { return e.msg }
+
+func usagef(format string, a ...any) error { return usageError{fmt.Sprintf(format, a...)} }
+
+// env — то, что нужно командам: БД открывается при первом обращении.
+type env struct {
+	stdout io.Writer
+	getenv func(string) string
+	dbx    *sql.DB
+}
+
+func (e *env) db() (*sql.DB, error) {
+	if e.dbx != nil {
+		return e.dbx, nil
+	}
+	dsn := e.getenv("DATABASE_URL")
+	if dsn == "" {
+		return nil, errors.New("DATABASE_URL не задан")
+	}
+	dbx, err := db.Open(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("подключение к БД: %w", err)
+	}
+	e.dbx = dbx
+	return dbx, nil
+}
+
+func main() {
+	_ = godotenv.Load()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], os.Stdout, os.Stderr, os.Getenv)
+	stop()
+	os.Exit(code)
+}
+
+func run(ctx context.Context, args []string, stdout, stderr io.Writer, getenv func(string) string) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage(stdout)
+		return 0
+	}
+	cmd, rest := findCommand(args)
+	if cmd == nil {
+		writeError(stderr, strings.Join(args[:min(2, len(args))], " "), usagef("неизвестная команда; список: schoolctl help"))
+		return 2
+	}
+
+	e := &env{stdout: stdout, getenv: getenv}
+	defer func() {
+		if e.dbx != nil {
+			_ = e.dbx.Close()
+		}
+	}()
+	res, err := cmd.run(ctx, e, rest)
+	if err != nil {
+		writeError(stderr, cmd.name, err)
+		var ue usageError
+		if errors.As(err, &ue) {
+			return 2
+		}
+		return 1
+	}
+	// nil — команда сама вывела данные (файл в stdout)
+	if res != nil {
+		if err := json.NewEncoder(stdout).Encode(res); err != nil {
+			return 1
+		}
+	}
+	return 0
+}
+
+func findCommand(args []string) (*command, []string) {
+	for i := range commands {
+		words := strings.Fields(commands[i].name)
+		if len(args) >= len(words) && strings.Join(args[:len(words)], " ") == commands[i].name {
+			return &commands[i], args[len(words):]
+		}
+	}
+	return nil, nil
+}
+
+func writeError(w io.Writer, cmd string, err error) {
+	_ = json.NewEncoder(w).Encode(map[string]string{"command": cmd, "error": err.Error()})
+}
+
+func printUsage(w io.Writer) {
+	_, _ = fmt.Fprintln(w, "schoolctl — админские операции с БД бота. Результат — JSON в stdout.")
+	_, _ = fmt.Fprintln(w, "\nКоманды:")
+	for _, c := range commands {
+		_, _ = fmt.Fprintf(w, "  %s %s\n      %s\n", c.name, c.args, c.about)
+	}
+}
+
+// newFlags — флаги подкоманды: ошибки разбора возвращаются, а не печатаются.
+func newFlags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+// parseFlags разбирает флаги; позиционные аргументы допускаются и до, и после флагов.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var pos []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, usagef("%s: %v", fs.Name(), err)
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return pos, nil
+		}
+		pos = append(pos, args[0])
+		args = args[1:]
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func runCLI(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	getenv := func(string) string { return "" }
+	code := run(context.Background(), args, &stdout, &stderr, getenv)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun_Help(t *testing.T) {
+	code, out, _ := runCLI(t, "help")
+	if code != 0 || !strings.Contains(out, "migrate status") || !strings.Contains(out, "recompute-collective") {
+		t.Fatalf("help: код %d, вывод %q", code, out)
+	}
+}
+
+func TestRun_Errors(t *testing.T) {
+	cases := []struct {
+		args []string
+		code int
+		cmd  string
+	}{
+		{[]string{"nope"}, 2, "nope"},
+		{[]string{"migrate", "down"}, 2, "migrate down"},
+		{[]string{"admin", "add", "--bogus"}, 2, "admin add"},
+		{[]string{"export", "scores", "--class", "??"}, 2, "export scores"},
+		{[]string{"restore", "--file", "school.sql.gz"}, 2, "restore"},
+		// аргументы верные, но DATABASE_URL не задан
+		{[]string{"period", "list"}, 1, "period list"},
+	}
+	for _, c := range cases {
+		code, out, errOut := runCLI(t, c.args...)
+		if code != c.code || out != "" {
+			t.Errorf("%v: код %d (ожидали %d), stdout %q", c.args, code, c.code, out)
+			continue
+		}
+		var e map[string]string
+		if err := json.Unmarshal([]byte(errOut), &e); err != nil || e["command"] != c.cmd || e["error"] == "" {
+			t.Errorf("%v: stderr %q", c.args, errOut)
+		}
+	}
+}
+
+func TestParseFlags_Positional(t *testing.T) {
+	fs := newFlags("user find")
+	limit := fs.Int("limit", 20, "")
+	pos, err := parseFlags(fs, []string{"Иванов", "--limit", "5", "7А"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *limit != 5 || !reflect.DeepEqual(pos, []string{"Иванов", "7А"}) {
+		t.Fatalf("limit=%d pos=%v", *limit, pos)
+	}
+
+	if _, err := parseFlags(newFlags("x"), []string{"-h"}); err == nil || !strings.Contains(err.Error(), flag.ErrHelp.Error()) {
+		t.Fatalf("-h: %v", err)
+	}
+}
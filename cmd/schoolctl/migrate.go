@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/bot/handlers/migrations"
+	"github.com/pressly/goose/v3"
+)
+
+type migrationJSON struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	State     string     `json:"state,omitempty"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+func provider(e *env) (*goose.Provider, error) {
+	dbx, err := e.db()
+	if err != nil {
+		return nil, err
+	}
+	return goose.NewProvider(goose.DialectPostgres, dbx, migrations.FS)
+}
+
+func migrateUp(ctx context.Context, e *env, args []string) (any, error) {
+	if _, err := parseFlags(newFlags("migrate up"), args); err != nil {
+		return nil, err
+	}
+	p, err := provider(e)
+	if err != nil {
+		return nil, err
+	}
+	from, err := p.GetDBVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	results, err := p.Up(ctx)
+	if err != nil {
+		return nil, err
+	}
+	applied := []migrationJSON{}
+	for _, r := range results {
+		applied = append(applied, migrationJSON{Version: r.Source.Version, Name: path.Base(r.Source.Path)})
+	}
+	to, err := p.GetDBVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"from": from, "to": to, "applied": applied}, nil
+}
+
+func migrateDown(ctx context.Context, e *env, args []string) (any, error) {
+	fs := newFlags("migrate down")
+	yes := fs.Bool("yes", false, "")
+	if _, err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+	// down-миграции удаляют таблицы вместе с данными
+	if !*yes {
+		return nil, usagef("откат миграции может удалить данные; подтвердите флагом --yes")
+	}
+	p, err := provider(e)
+	if err != nil {
+		return nil, err
+	}
+	from, err := p.GetDBVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r, err := p.Down(ctx)
+	if errors.Is(err, goose.ErrNoNextVersion) {
+		return map[string]any{"from": from, "to": from, "reverted": nil}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	to, err := p.GetDBVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"from": from, "to": to,
+		"reverted": migrationJSON{Version: r.Source.Version, Name: path.Base(r.Source.Path)},
+	}, nil
+}
+
+func migrateStatus(ctx context.Context, e *env, args []string) (any, error) {
+	if _, err := parseFlags(newFlags("migrate status"), args); err != nil {
+		return nil, err
+	}
+	p, err := provider(e)
+	if err != nil {
+		return nil, err
+	}
+	current, latest, err := p.GetVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := p.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]migrationJSON, 0, len(statuses))
+	pending := 0
+	for _, s := range statuses {
+		m := migrationJSON{Version: s.Source.Version, Name: path.Base(s.Source.Path), State: string(s.State)}
+		if s.State == goose.StateApplied {
+			at := s.AppliedAt
+			m.AppliedAt = &at
+		} else {
+			pending++
+		}
+		out = append(out, m)
+	}
+	return map[string]any{"current": current, "latest": latest, "pending": pending, "migrations": out}, nil
+}
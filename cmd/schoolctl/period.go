@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/models"
+)
+
+const dateLayout = "2006-01-02"
+
+type periodJSON struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	IsActive bool   `json:"is_active"`
+}
+
+func toPeriodJSON(p models.Period) periodJSON {
+	return periodJSON{
+		ID: p.ID, Name: p.Name, IsActive: p.IsActive,
+		Start: p.StartDate.Format(dateLayout), End: p.EndDate.Format(dateLayout),
+	}
+}
+
+func periodList(ctx context.Context, e *env, args []string) (any, error) {
+	if _, err := parseFlags(newFlags("period list"), args); err != nil {
+		return nil, err
+	}
+	dbx, err := e.db()
+	if err != nil {
+		return nil, err
+	}
+	periods, err := db.ListPeriods(ctx, dbx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]periodJSON, 0, len(periods))
+	for _, p := range periods {
+		out = append(out, toPeriodJSON(p))
+	}
+	return map[string]any{"periods": out}, nil
+}
+
+func periodCreate(ctx context.Context, e *env, args []string) (any, error) {
+	fs := newFlags("period create")
+	name := fs.String("name", "", "")
+	start := fs.String("start", "", "")
+	end := fs.String("end", "", "")
+	activate := fs.Bool("activate", false, "")
+	if _, err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+	p := models.Period{Name: strings.TrimSpace(*name)}
+	if p.Name == "" {
+		return nil, usagef("нужно --name")
+	}
+	var err error
+	if p.StartDate, err = time.Parse(dateLayout, *start); err != nil {
+		return nil, usagef("--start: дата в формате ГГГГ-ММ-ДД")
+	}
+	if p.EndDate, err = time.Parse(dateLayout, *end); err != nil {
+		return nil, usagef("--end: дата в формате ГГГГ-ММ-ДД")
+	}
+	dbx, err := e.db()
+	if err != nil {
+		return nil, err
+	}
+	if p.ID, err = db.CreatePeriod(ctx, dbx, p); err != nil {
+		return nil, err
+	}
+	out := map[string]any{}
+	if *activate {
+		if err := db.ActivatePeriod(ctx, dbx, p.ID); err != nil {
+			return nil, err
+		}
+		p.IsActive = true
+		addPeriodWarning(out, p, time.Now())
+	}
+	out["period"] = toPeriodJSON(p)
+	return out, nil
+}
+
+func periodActivate(ctx context.Context, e *env, args []string) (any, error) {
+	fs := newFlags("period activate")
+	id := fs.Int64("id", 0, "")
+	if _, err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+	if *id <= 0 {
+		return nil, usagef("нужен --id периода (см. period list)")
+	}
+	dbx, err := e.db()
+	if err != nil {
+		return nil, err
+	}
+	if err := db.ActivatePeriod(ctx, dbx, *id); errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("период %d не найден", *id)
+	} else if err != nil {
+		return nil, err
+	}
+	p, err := db.GetPeriodByID(ctx, dbx, int(*id))
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]any{"period": toPeriodJSON(*p)}
+	addPeriodWarning(out, *p, time.Now())
+	return out, nil
+}
+
+// addPeriodWarning — бот при запуске выбирает активный период по датам и перезапишет ручной выбор.
+func addPeriodWarning(out map[string]any, p models.Period, now time.Time) {
+	today := now.Format(dateLayout)
+	if today < p.StartDate.Format(dateLayout) || today > p.EndDate.Format(dateLayout) {
+		out["warning"] = "сегодняшняя дата вне периода: после перезапуска бот снова выберет активный период по датам"
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/models"
+)
+
+type userJSON struct {
+	ID            int64      `json:"id"`
+	TelegramID    int64      `json:"telegram_id"`
+	Name          string     `json:"name"`
+	Role          string     `json:"role"`
+	Class         string     `json:"class,omitempty"`
+	Confirmed     bool       `json:"confirmed"`
+	IsActive      bool       `json:"is_active"`
+	DeactivatedAt *time.Time `json:"deactivated_at,omitempty"`
+}
+
+func toUserJSON(u models.User) userJSON {
+	out := userJSON{
+		ID: u.ID, TelegramID: u.TelegramID, Name: u.Name,
+		Confirmed: u.Confirmed, IsActive: u.IsActive, DeactivatedAt: u.DeactivatedAt,
+	}
+	if u.Role != nil {
+		out.Role = string(*u.Role)
+	}
+	if u.ClassNumber != nil && u.ClassLetter != nil {
+		out.Class = fmt.Sprintf("%d%s", *u.ClassNumber, *u.ClassLetter)
+	}
+	return out
+}
+
+func adminAdd(ctx context.Context, e *env, args []string) (any, error) {
+	fs := newFlags("admin add")
+	tgID := fs.Int64("telegram-id", 0, "")
+	name := fs.String("name", "Админ", "")
+	if _, err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+	if *tgID <= 0 {
+		return nil, usagef("нужен --telegram-id")
+	}
+	dbx, err := e.db()
+	if err != nil {
+		return nil, err
+	}
+	id, err := db.AddAdmin(ctx, dbx, *tgID, strings.TrimSpace(*name))
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"user_id": id, "telegram_id": *tgID, "role": models.Admin}, nil
+}
+
+func adminRemove(ctx context.Context, e *env, args []string) (any, error) {
+	fs := newFlags("admin remove")
+	tgID := fs.Int64("telegram-id", 0, "")
+	role := fs.String("role", string(models.Teacher), "")
+	if _, err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+	if *tgID <= 0 {
+		return nil, usagef("нужен --telegram-id")
+	}
+	newRole := models.Role(*role)
+	if newRole != models.Teacher && newRole != models.Administration {
+		return nil, usagef("--role: teacher или administration")
+	}
+	dbx, err := e.db()
+	if err != nil {
+		return nil, err
+	}
+	id, err := db.RemoveAdmin(ctx, dbx, *tgID, newRole)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]any{"user_id": id, "telegram_id": *tgID, "role": newRole}
+	// ADMIN_IDS даёт права администратора в обход роли в БД
+	if _, ok := db.EnvAdminIDs()[*tgID]; ok {
+		out["warning"] = "telegram_id указан в ADMIN_IDS — уберите его оттуда, иначе права администратора останутся"
+	}
+	return out, nil
+}
+
+func userFind(ctx context.Context, e *env, args []string) (any, error) {
+	fs := newFlags("user find")
+	limit := fs.Int("limit", 20, "")
+	pos, err := parseFlags(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	q := strings.TrimSpace(strings.Join(pos, " "))
+	if q == "" {
+		return nil, usagef("нужен запрос: часть ФИО или класс («7А»)")
+	}
+	dbx, err := e.db()
+	if err != nil {
+		return nil, err
+	}
+	users, err := db.FindUsersByQuery(ctx, dbx, q, *limit)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]userJSON, 0, len(users))
+	for _, u := range users {
+		out = append(out, toUserJSON(u))
+	}
+	return map[string]any{"query": q, "users": out}, nil
+}
+
+func userDeactivate(ctx context.Context, e *env, args []string) (any, error) {
+	fs := newFlags("user deactivate")
+	id := fs.Int64("id", 0, "")
+	if _, err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+	if *id <= 0 {
+		return nil, usagef("нужен --id пользователя (см. user find)")
+	}
+	dbx, err := e.db()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.GetUserByID(ctx, dbx, *id); errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("пользователь %d не найден", *id)
+	} else if err != nil {
+		return nil, err
+	}
+	parents, err := db.DeactivateUserCascade(ctx, dbx, *id, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	u, err := db.GetUserByID(ctx, dbx, *id)
+	if err != nil {
+		return nil, err
+	}
+	if parents == nil {
+		parents = []int64{}
+	}
+	return map[string]any{"user": toUserJSON(u), "parents_refreshed": parents}, nil
+}
+
+func recomputeCollective(ctx context.Context, e *env, args []string) (any, error) {
+	fs := newFlags("recompute-collective")
+	dry := fs.Bool("dry-run", false, "")
+	if _, err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+	dbx, err := e.db()
+	if err != nil {
+		return nil, err
+	}
+	drifts, err := db.ReconcileCollective(ctx, dbx, !*dry)
+	if err != nil {
+		return nil, err
+	}
+	type driftJSON struct {
+		ClassID  int64  `json:"class_id"`
+		Class    string `json:"class"`
+		Stored   int64  `json:"stored"`
+		Computed int64  `json:"computed"`
+	}
+	out := make([]driftJSON, 0, len(drifts))
+	for _, d := range drifts {
+		out = append(out, driftJSON{
+			ClassID: d.ClassID, Class: fmt.Sprintf("%d%s", d.ClassNumber, d.ClassLetter),
+			Stored: d.Stored, Computed: d.Computed,
+		})
+	}
+	return map[string]any{"fixed": !*dry && len(out) > 0, "drift": out}, nil
+}
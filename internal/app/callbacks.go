@@ -0,0 +1,59 @@
+package app
+
+import (
+	"log"
+
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
+	"github.com/Spok95/telegram-school-bot/internal/metrics"
+	"github.com/Spok95/telegram-school-bot/internal/observability"
+)
+
+// Кнопки с аргументами (формат — см. пакет callback).
+var (
+	cbRegister = callback.NewAction1("reg_", callback.Word(14)) // роль
+
+	// запись родителя
+	cbPickChild   = callback.NewAction1("p_pick_child:", callback.ID)                           // childID
+	cbPickTeacher = callback.NewAction2("p_pick_teacher:", callback.ID, callback.ID)            // teacherID, childID
+	cbPickDate    = callback.NewAction3("p_pick_date:", callback.ID, callback.ID, callback.Day) // teacherID, childID, день
+	cbBook        = callback.NewAction2("p_book:", callback.ID, callback.ID)                    // slotID, childID
+	cbCancelBook  = callback.NewAction1("p_cancel:", callback.ID)                               // slotID
+
+	// лист ожидания
+	cbWaitlist      = callback.NewAction1("p_wl:", callback.ID)                               // childID
+	cbWaitlistPick  = callback.NewAction3("p_wl_t:", callback.ID, callback.ID, callback.Num)  // teacherID, childID, маска дней
+	cbWaitlistOK    = callback.NewAction3("p_wl_ok:", callback.ID, callback.ID, callback.Num) // teacherID, childID, маска дней
+	cbWaitlistLeave = callback.NewAction1("p_wl_leave:", callback.ID)                         // entryID
+	cbWaitlistSkip  = callback.NewAction1("p_wl_skip:", callback.ID)                          // slotID
+
+	// слоты учителя
+	cbSlotsDay   = callback.NewAction1("t_slots:day:", callback.Day)
+	cbSlotsClass = callback.NewAction1("t_slots:toggle_class:", callback.ID) // classID
+	cbManageDay  = callback.NewAction1("t_ms:day:", callback.Day)
+	cbSlotCancel = callback.NewAction1("t_cancel:", callback.ID) // slotID
+	cbSlotDelete = callback.NewAction1("t_del:", callback.ID)    // slotID
+	cbSlotLink   = callback.NewAction1("t_link:", callback.ID)   // slotID
+
+	// шаблоны расписания
+	cbTplView    = callback.NewAction1("t_tpl:view:", callback.ID) // templateID
+	cbTplPause   = callback.NewAction1("t_tpl:pause:", callback.ID)
+	cbTplResume  = callback.NewAction1("t_tpl:resume:", callback.ID)
+	cbTplEdit    = callback.NewAction1("t_tpl:edit:", callback.ID)
+	cbTplDel     = callback.NewAction1("t_tpl:del:", callback.ID)
+	cbTplDelYes  = callback.NewAction1("t_tpl:del_yes:", callback.ID)
+	cbTplWeekday = callback.NewAction1("t_tpl:wd:", callback.Num)   // time.Weekday
+	cbTplClass   = callback.NewAction1("t_tpl:cls:", callback.ID)   // classID
+	cbTplBack    = callback.NewAction1("t_tpl:back:", callback.Num) // шаг мастера
+)
+
+// buttonsFailed — кнопку не удалось закодировать: пишем ошибку и не отправляем клавиатуру.
+func buttonsFailed(bs *callback.Buttons) bool {
+	err := bs.Err()
+	if err == nil {
+		return false
+	}
+	log.Println("callback:", err)
+	observability.CaptureErr(err)
+	metrics.HandlerErrors.Inc()
+	return true
+}
@@ -0,0 +1,76 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Консультации не создаются на нерабочие дни школы: праздники из календаря
+// («📆 Каникулы и праздники») и каникулы из периодов.
+
+// withoutDaysOff убирает старты, попавшие на нерабочие дни.
+// Возвращает оставшиеся старты и число пропущенных дней.
+func withoutDaysOff(ctx context.Context, database *sql.DB, starts []time.Time) ([]time.Time, int, error) {
+	if len(starts) == 0 {
+		return starts, 0, nil
+	}
+	daysOff, err := db.NonWorkingDays(ctx, database, starts[0], starts[len(starts)-1])
+	if err != nil {
+		return nil, 0, err
+	}
+	kept, skipped := filterDaysOff(starts, daysOff)
+	return kept, skipped, nil
+}
+
+// filterDaysOff — чистая часть withoutDaysOff (старты идут по возрастанию).
+func filterDaysOff(starts []time.Time, daysOff map[string]bool) ([]time.Time, int) {
+	kept := make([]time.Time, 0, len(starts))
+	skipped := 0
+	lastSkipped := ""
+	for _, st := range starts {
+		key := st.Format("2006-01-02")
+		if !daysOff[key] {
+			kept = append(kept, st)
+			continue
+		}
+		if key != lastSkipped {
+			skipped++
+			lastSkipped = key
+		}
+	}
+	return kept, skipped
+}
+
+// slotsCreatedText — итог создания слотов с учётом пропущенных нерабочих дней.
+func slotsCreatedText(inserted int64, skippedDays int) string {
+	text := fmt.Sprintf("Готово. Создано слотов: %d.", inserted)
+	if skippedDays > 0 {
+		text += fmt.Sprintf("\nПропущено нерабочих дней: %d.", skippedDays)
+	}
+	return text
+}
+
+// teacherSlotDayRows — 14 дат вперёд для /t_slots (подпись: 16.10 (Ср)), кроме нерабочих.
+func teacherSlotDayRows(ctx context.Context, database *sql.DB, bs *callback.Buttons) [][]tgbotapi.InlineKeyboardButton {
+	today := time.Now().In(time.Local).Truncate(24 * time.Hour)
+	// без календаря покажем все дни: отсеять их можно и при создании слотов
+	daysOff, _ := db.NonWorkingDays(ctx, database, today, today.AddDate(0, 0, 13))
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i := 0; i < 14; i++ {
+		d := today.AddDate(0, 0, i)
+		if daysOff[d.Format("2006-01-02")] {
+			continue
+		}
+		label := d.Format("02.01") + " (" + ruDayShort(d.Weekday()) + ")"
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			bs.Add(cbSlotsDay.Button(label, d)),
+		))
+	}
+	return rows
+}
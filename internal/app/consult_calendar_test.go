@@ -0,0 +1,19 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFilterDaysOff(t *testing.T) {
+	d := func(day, hour int) time.Time { return time.Date(2025, 11, day, hour, 0, 0, 0, time.Local) }
+	starts := []time.Time{d(3, 16), d(4, 16), d(4, 17), d(5, 16)}
+
+	kept, skipped := filterDaysOff(starts, map[string]bool{"2025-11-04": true})
+	if skipped != 1 {
+		t.Fatalf("пропущенных дней: %d, ожидали 1", skipped)
+	}
+	if len(kept) != 2 || !kept[0].Equal(d(3, 16)) || !kept[1].Equal(d(5, 16)) {
+		t.Fatalf("неверные оставшиеся старты: %v", kept)
+	}
+}
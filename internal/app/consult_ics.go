@@ -0,0 +1,190 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/ical"
+	"github.com/Spok95/telegram-school-bot/internal/metrics"
+	"github.com/Spok95/telegram-school-bot/internal/tg"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Консультации в календаре телефона: к карточкам о записи и отмене прикладывается
+// .ics (METHOD:REQUEST / METHOD:CANCEL, UID по id слота), а по секретной ссылке
+// /calendar/<токен>.ics отдаётся лента подписки с записями учителя или родителя.
+
+// CalendarFeedPath — префикс ссылок подписки.
+const CalendarFeedPath = "/calendar/"
+
+// лента подписки: прошедший месяц и полгода вперёд
+const (
+	calendarFeedPast   = 30 * 24 * time.Hour
+	calendarFeedFuture = 180 * 24 * time.Hour
+)
+
+// calendarBaseURL — внешний адрес HTTP-сервера для ссылок подписки; пусто — ссылки не выдаются.
+var calendarBaseURL string
+
+// SetCalendarBaseURL задаёт внешний адрес для ссылок подписки (например, https://bot.school.ru).
+func SetCalendarBaseURL(u string) {
+	calendarBaseURL = strings.TrimRight(strings.TrimSpace(u), "/")
+}
+
+// consultUID — UID события: один и тот же для записи и её отмены.
+func consultUID(slotID int64) string {
+	return fmt.Sprintf("consult-slot-%d@telegram-school-bot", slotID)
+}
+
+// wallClock — start_at/end_at хранятся без часового пояса (время школы):
+// переносим показания часов в time.Local, чтобы в .ics ушёл верный момент.
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local)
+}
+
+// consultEvent — событие для учителя (forTeacher) или родителя. Sequence растёт со
+// временем, поэтому отмена (и повторная запись на тот же слот) заменяют прежнее событие.
+func consultEvent(c db.CalendarConsult, forTeacher, cancelled bool, now time.Time) ical.Event {
+	ev := ical.Event{
+		UID:       consultUID(c.Slot.ID),
+		Sequence:  now.Unix(),
+		Start:     wallClock(c.Slot.StartAt),
+		End:       wallClock(c.Slot.EndAt),
+		Cancelled: cancelled,
+	}
+	var desc []string
+	if forTeacher {
+		ev.Summary = "Консультация: " + c.ParentName
+		desc = append(desc, "Родитель: "+c.ParentName)
+	} else {
+		ev.Summary = "Консультация: " + c.TeacherName
+		desc = append(desc, "Учитель: "+c.TeacherName)
+	}
+	if c.ChildName != "" {
+		desc = append(desc, "Ребёнок: "+c.ChildName)
+	}
+	if c.ClassLabel != "" {
+		desc = append(desc, "Класс: "+c.ClassLabel)
+	}
+	if c.Slot.ConsultFormat == "online" {
+		ev.Location = "Онлайн"
+		// ссылку вводит учитель: в событие попадает только корректная
+		if link := strings.TrimSpace(c.Slot.OnlineURL.String); c.Slot.OnlineURL.Valid && ical.ValidURL(link) {
+			ev.URL = link
+			desc = append(desc, "Ссылка: "+link)
+		}
+	} else {
+		ev.Location = "В школе"
+	}
+	ev.Description = strings.Join(desc, "\n")
+	return ev
+}
+
+// sendConsultICS прикладывает .ics к карточке о записи или отмене.
+func sendConsultICS(bot *tgbotapi.BotAPI, chatID int64, c db.CalendarConsult, forTeacher, cancelled bool) {
+	if chatID == 0 {
+		return
+	}
+	now := time.Now()
+	cal := ical.Calendar{Method: ical.MethodRequest, Events: []ical.Event{consultEvent(c, forTeacher, cancelled, now)}}
+	name, caption := "consultation.ics", "📎 Добавить в календарь"
+	if cancelled {
+		cal.Method = ical.MethodCancel
+		name, caption = "consultation_cancel.ics", "📎 Убрать из календаря"
+	}
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: name, Bytes: cal.Bytes(now)})
+	doc.Caption = caption
+	if _, err := tg.Send(bot, doc); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
+
+// calendarFeedHandler отдаёт ленту подписки по токену из ссылки.
+func calendarFeedHandler(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		token := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, CalendarFeedPath), ".ics")
+		if token == "" || strings.Contains(token, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		userID, ok, err := db.CalendarTokenUser(r.Context(), database, token)
+		if err != nil {
+			log.Println("calendar feed:", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		// start_at хранится временем школы: границы тоже берём по её часам
+		now := time.Now().In(time.Local)
+		consults, err := db.ListCalendarConsults(r.Context(), database, userID, now.Add(-calendarFeedPast), now.Add(calendarFeedFuture))
+		if err != nil {
+			log.Println("calendar feed:", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		cal := ical.Calendar{Method: ical.MethodPublish, Name: "Консультации"}
+		for _, c := range consults {
+			ev := consultEvent(c, c.Slot.TeacherID == userID, false, now)
+			ev.Sequence = 0
+			cal.Events = append(cal.Events, ev)
+		}
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = w.Write(cal.Bytes(now))
+	}
+}
+
+// calendarFeedURL — ссылка подписки пользователя.
+func calendarFeedURL(token string) string {
+	return calendarBaseURL + CalendarFeedPath + token + ".ics"
+}
+
+// HandleCalendarLink — ссылка на подписку и кнопка выпуска новой (старая перестаёт работать).
+func HandleCalendarLink(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, userID, chatID int64, reset bool) {
+	if calendarBaseURL == "" {
+		reply(bot, chatID, "Подписка на календарь не настроена: попросите администратора указать CALENDAR_BASE_URL.")
+		return
+	}
+	get := db.CalendarToken
+	if reset {
+		get = db.ResetCalendarToken
+	}
+	token, err := get(ctx, database, userID)
+	if err != nil {
+		log.Println("calendar token:", err)
+		reply(bot, chatID, "❌ Не удалось получить ссылку, попробуйте позже.")
+		return
+	}
+	text := "🔗 Календарь консультаций\n\n" +
+		"Добавьте ссылку в календарь телефона как подписку — записи будут появляться и исчезать сами:\n" +
+		calendarFeedURL(token) + "\n\n" +
+		"iPhone: Настройки → Календарь → Учётные записи → Новая → Другое → Подписной календарь.\n" +
+		"Android: calendar.google.com → Другие календари → Добавить по URL.\n\n" +
+		"Ссылка личная: не пересылайте её. Если она попала к посторонним, выпустите новую."
+	if reset {
+		text = "✅ Выпущена новая ссылка, старая больше не работает.\n\n" + text
+	}
+	m := tgbotapi.NewMessage(chatID, text)
+	m.DisableWebPagePreview = true
+	m.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("🔄 Новая ссылка", "cal_reset")),
+	)
+	if _, err := tg.Send(bot, m); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
@@ -0,0 +1,42 @@
+package app
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+)
+
+func TestConsultEvent(t *testing.T) {
+	// start_at из БД: показания часов школы в «UTC» без пояса
+	start := time.Date(2025, 11, 5, 16, 0, 0, 0, time.UTC)
+	c := db.CalendarConsult{
+		Slot: db.ConsultSlot{ID: 42, StartAt: start, EndAt: start.Add(20 * time.Minute), ConsultFormat: "online",
+			OnlineURL: sql.NullString{String: " https://meet.example/abc ", Valid: true}},
+		TeacherName: "Петрова А. В.",
+		ParentName:  "Иванова М. С.",
+		ChildName:   "Иванов Иван",
+	}
+	now := time.Date(2025, 11, 1, 10, 0, 0, 0, time.UTC)
+
+	ev := consultEvent(c, false, true, now)
+	if ev.UID != "consult-slot-42@telegram-school-bot" || !ev.Cancelled || ev.Sequence != now.Unix() {
+		t.Fatalf("неверное событие: %+v", ev)
+	}
+	if !ev.Start.Equal(time.Date(2025, 11, 5, 16, 0, 0, 0, time.Local)) {
+		t.Fatalf("время должно трактоваться как время школы: %v", ev.Start)
+	}
+	if ev.Summary != "Консультация: Петрова А. В." || ev.URL != "https://meet.example/abc" {
+		t.Fatalf("событие для родителя: %+v", ev)
+	}
+	if got := consultEvent(c, true, false, now).Summary; got != "Консультация: Иванова М. С." {
+		t.Fatalf("событие для учителя: %q", got)
+	}
+
+	c.Slot.OnlineURL.String = "https://meet.example/abc\r\nATTENDEE:mailto:x@example.org"
+	if ev := consultEvent(c, false, false, now); ev.URL != "" || strings.Contains(ev.Description, "ATTENDEE") {
+		t.Fatalf("ссылка с переводом строки попала в событие: %+v", ev)
+	}
+}
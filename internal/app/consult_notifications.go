@@ -8,6 +8,7 @@ import (
 
 	"github.com/Spok95/telegram-school-bot/internal/metrics"
 	"github.com/Spok95/telegram-school-bot/internal/models"
+	"github.com/Spok95/telegram-school-bot/internal/notify"
 	"github.com/Spok95/telegram-school-bot/internal/tg"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 
@@ -103,10 +104,11 @@ func SendConsultReminder(ctx context.Context, bot *tgbotapi.BotAPI, database *sq
 		textTeacher += "\nСсылка: " + link
 	}
 
-	if _, err := tg.Send(bot, tgbotapi.NewMessage(parentChat, textParent)); err != nil {
+	// напоминания можно выключить в «⚙️ Настройки», в тихие часы они откладываются
+	if err := notify.Send(ctx, database, parentChat, notify.ConsultReminders, textParent); err != nil {
 		metrics.HandlerErrors.Inc()
 	}
-	if _, err := tg.Send(bot, tgbotapi.NewMessage(teacherChat, textTeacher)); err != nil {
+	if err := notify.Send(ctx, database, teacherChat, notify.ConsultReminders, textTeacher); err != nil {
 		metrics.HandlerErrors.Inc()
 	}
 
@@ -146,6 +148,10 @@ func SendConsultBookedNotification(ctx context.Context, bot *tgbotapi.BotAPI, da
 	if _, err := tg.Send(bot, tgbotapi.NewMessage(teacherChat, textTeacher)); err != nil {
 		metrics.HandlerErrors.Inc()
 	}
+
+	ev := db.CalendarConsult{Slot: slot, TeacherName: teacher.Name, ParentName: parent.Name}
+	sendConsultICS(bot, parentChat, ev, false, false)
+	sendConsultICS(bot, teacherChat, ev, true, false)
 	return nil
 }
 
@@ -210,6 +216,10 @@ func SendConsultBookedCard(ctx context.Context, bot *tgbotapi.BotAPI, database *
 		}
 	}
 
+	ev := db.CalendarConsult{Slot: slot, TeacherName: teacher.Name, ParentName: parent.Name,
+		ChildName: child.Name, ClassLabel: className}
+	sendConsultICS(bot, parent.TelegramID, ev, false, false)
+	sendConsultICS(bot, teacher.TelegramID, ev, true, false)
 	return nil
 }
 
@@ -283,5 +293,11 @@ func SendConsultCancelCards(ctx context.Context, bot *tgbotapi.BotAPI, database
 			metrics.HandlerErrors.Inc()
 		}
 	}
+
+	// отмена в календаре: тот же UID, METHOD:CANCEL
+	ev := db.CalendarConsult{Slot: slot, TeacherName: teacher.Name, ParentName: parent.Name,
+		ChildName: childName, ClassLabel: classLabel}
+	sendConsultICS(bot, teacher.TelegramID, ev, true, true)
+	sendConsultICS(bot, parent.TelegramID, ev, false, true)
 	return nil
 }
@@ -4,10 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
 	"github.com/Spok95/telegram-school-bot/internal/metrics"
 	"github.com/Spok95/telegram-school-bot/internal/tg"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -40,6 +40,7 @@ func StartParentConsultFlow(ctx context.Context, bot *tgbotapi.BotAPI, database
 		}
 		return
 	}
+	var bs callback.Buttons
 	var rows [][]tgbotapi.InlineKeyboardButton
 	for _, ch := range children {
 		title := ch.Name
@@ -47,12 +48,15 @@ func StartParentConsultFlow(ctx context.Context, bot *tgbotapi.BotAPI, database
 			title = fmt.Sprintf("%s (%d%s)", ch.Name, ch.ClassNum.Int64, strings.ToUpper(ch.ClassLet.String))
 		}
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(title, fmt.Sprintf("p_pick_child:%d", ch.ID)),
+			bs.Add(cbPickChild.Button(title, ch.ID)),
 		))
 	}
 	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
 		tgbotapi.NewInlineKeyboardButtonData("Отмена", "p_flow:cancel"),
 	))
+	if buttonsFailed(&bs) {
+		return
+	}
 	kb := tgbotapi.NewInlineKeyboardMarkup(rows...)
 	out := tgbotapi.NewMessage(msg.Chat.ID, "Выберите ребёнка:")
 	out.ReplyMarkup = kb
@@ -81,8 +85,11 @@ func TryHandleParentFlowCallbacks(ctx context.Context, bot *tgbotapi.BotAPI, dat
 		StartParentConsultFlow(ctx, bot, database, &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: cb.Message.Chat.ID}})
 		return true
 
-	case strings.HasPrefix(cb.Data, "p_pick_child:"):
-		childID, _ := strconv.ParseInt(strings.TrimPrefix(cb.Data, "p_pick_child:"), 10, 64)
+	case cbPickChild.Match(cb.Data):
+		childID, err := cbPickChild.Parse(cb.Data)
+		if err != nil {
+			return true
+		}
 		ch, err := db.GetUserByID(ctx, database, childID)
 		if err != nil || ch.ID == 0 || (ch.ClassID == nil && (ch.ClassNumber == nil || ch.ClassLetter == nil)) {
 			if _, err := tg.Request(bot, tgbotapi.NewCallback(cb.ID, "У ребёнка не указан класс")); err != nil {
@@ -108,8 +115,29 @@ func TryHandleParentFlowCallbacks(ctx context.Context, bot *tgbotapi.BotAPI, dat
 			}
 			return true
 		}
+		// учителя, у которых всё занято: к ним можно встать в лист ожидания
+		full, err := fullyBookedTeachers(ctx, database, waitlistClassID(ctx, database, ch))
+		if err != nil {
+			observability.CaptureErr(err)
+		}
+		var bs callback.Buttons
+		waitlistRow := tgbotapi.NewInlineKeyboardRow(
+			bs.Add(cbWaitlist.Button("⏳ Лист ожидания", childID)),
+		)
 		if len(teachers) == 0 {
 			edit := tgbotapi.NewEditMessageText(cb.Message.Chat.ID, cb.Message.MessageID, "В этом классе консультации не запланированы.")
+			if len(full) > 0 {
+				edit.Text = "Свободного времени у учителей нет. Встаньте в лист ожидания — " +
+					"бот предложит первое освободившееся время."
+				kb := tgbotapi.NewInlineKeyboardMarkup(waitlistRow, tgbotapi.NewInlineKeyboardRow(
+					tgbotapi.NewInlineKeyboardButtonData("Назад", "p_back:teachers"),
+					tgbotapi.NewInlineKeyboardButtonData("Отмена", "p_flow:cancel"),
+				))
+				edit.ReplyMarkup = &kb
+				if buttonsFailed(&bs) {
+					return true
+				}
+			}
 			if _, err := tg.Send(bot, edit); err != nil {
 				metrics.HandlerErrors.Inc()
 			}
@@ -122,13 +150,19 @@ func TryHandleParentFlowCallbacks(ctx context.Context, bot *tgbotapi.BotAPI, dat
 		var rows [][]tgbotapi.InlineKeyboardButton
 		for _, t := range teachers {
 			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData(t.Name, fmt.Sprintf("p_pick_teacher:%d:%d", t.ID, childID)),
+				bs.Add(cbPickTeacher.Button(t.Name, t.ID, childID)),
 			))
 		}
+		if len(full) > 0 {
+			rows = append(rows, waitlistRow)
+		}
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("Назад", "p_back:teachers"),
 			tgbotapi.NewInlineKeyboardButtonData("Отмена", "p_flow:cancel"),
 		))
+		if buttonsFailed(&bs) {
+			return true
+		}
 		kb := tgbotapi.NewInlineKeyboardMarkup(rows...)
 		edit := tgbotapi.NewEditMessageText(cb.Message.Chat.ID, cb.Message.MessageID, "Выберите учителя:")
 		edit.ReplyMarkup = &kb
@@ -137,13 +171,11 @@ func TryHandleParentFlowCallbacks(ctx context.Context, bot *tgbotapi.BotAPI, dat
 		}
 		return true
 
-	case strings.HasPrefix(cb.Data, "p_pick_teacher:"):
-		parts := strings.Split(cb.Data, ":")
-		if len(parts) != 3 {
+	case cbPickTeacher.Match(cb.Data):
+		teacherID, childID, err := cbPickTeacher.Parse(cb.Data)
+		if err != nil {
 			return true
 		}
-		teacherID, _ := strconv.ParseInt(parts[1], 10, 64)
-		childID, _ := strconv.ParseInt(parts[2], 10, 64)
 		ch, err := db.GetUserByID(ctx, database, childID)
 		if err != nil || ch.ID == 0 || ch.ClassID == nil {
 			if _, err := tg.Request(bot, tgbotapi.NewCallback(cb.ID, "Нет класса у ребёнка")); err != nil {
@@ -175,20 +207,21 @@ func TryHandleParentFlowCallbacks(ctx context.Context, bot *tgbotapi.BotAPI, dat
 			return true
 		}
 
+		var bs callback.Buttons
 		var rows [][]tgbotapi.InlineKeyboardButton
 		for _, d := range days {
 			lbl := fmt.Sprintf("%s %s", ruDayShort(d.Weekday()), d.Format("02.01"))
 			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData(
-					lbl,
-					fmt.Sprintf("p_pick_date:%d:%d:%s", teacherID, childID, d.Format("2006-01-02")),
-				),
+				bs.Add(cbPickDate.Button(lbl, teacherID, childID, d)),
 			))
 		}
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("Назад", fmt.Sprintf("p_pick_child:%d", childID)),
+			bs.Add(cbPickChild.Button("Назад", childID)),
 			tgbotapi.NewInlineKeyboardButtonData("Отмена", "p_flow:cancel"),
 		))
+		if buttonsFailed(&bs) {
+			return true
+		}
 		kb := tgbotapi.NewInlineKeyboardMarkup(rows...)
 		edit := tgbotapi.NewEditMessageText(cb.Message.Chat.ID, cb.Message.MessageID, "Выберите дату:")
 		edit.ReplyMarkup = &kb
@@ -197,14 +230,11 @@ func TryHandleParentFlowCallbacks(ctx context.Context, bot *tgbotapi.BotAPI, dat
 		}
 		return true
 
-	case strings.HasPrefix(cb.Data, "p_pick_date:"):
-		parts := strings.Split(cb.Data, ":")
-		if len(parts) != 4 {
+	case cbPickDate.Match(cb.Data):
+		teacherID, childID, day, err := cbPickDate.Parse(cb.Data)
+		if err != nil {
 			return true
 		}
-		teacherID, _ := strconv.ParseInt(parts[1], 10, 64)
-		childID, _ := strconv.ParseInt(parts[2], 10, 64)
-		day, _ := time.Parse("2006-01-02", parts[3])
 
 		// получить classID ребёнка
 		var classID int64
@@ -233,6 +263,7 @@ func TryHandleParentFlowCallbacks(ctx context.Context, bot *tgbotapi.BotAPI, dat
 			}
 			return true
 		}
+		var bs callback.Buttons
 		var rows [][]tgbotapi.InlineKeyboardButton
 		for _, s := range free {
 			fmtLabel := "оффлайн"
@@ -240,16 +271,19 @@ func TryHandleParentFlowCallbacks(ctx context.Context, bot *tgbotapi.BotAPI, dat
 				fmtLabel = "онлайн"
 			}
 			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData(
+				bs.Add(cbBook.Button(
 					fmt.Sprintf("%s–%s • %s", s.StartAt.Format("15:04"), s.EndAt.Format("15:04"), fmtLabel),
-					fmt.Sprintf("p_book:%d:%d", s.ID, childID),
-				),
+					s.ID, childID,
+				)),
 			))
 		}
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("Назад", fmt.Sprintf("p_pick_teacher:%d:%d", teacherID, childID)),
+			bs.Add(cbPickTeacher.Button("Назад", teacherID, childID)),
 			tgbotapi.NewInlineKeyboardButtonData("Отмена", "p_flow:cancel"),
 		))
+		if buttonsFailed(&bs) {
+			return true
+		}
 		kb := tgbotapi.NewInlineKeyboardMarkup(rows...)
 		edit := tgbotapi.NewEditMessageText(cb.Message.Chat.ID, cb.Message.MessageID, "Свободные слоты:")
 		edit.ReplyMarkup = &kb
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
 	"github.com/Spok95/telegram-school-bot/internal/metrics"
 	"github.com/Spok95/telegram-school-bot/internal/tg"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -72,6 +73,13 @@ func TryHandleParentSlotsCommand(ctx context.Context, bot *tgbotapi.BotAPI, data
 		return true
 	}
 
+	// кнопка брони несёт ребёнка; без выбора его можно взять, только если он один
+	var childID int64
+	if children, err := db.ListChildrenForParent(ctx, database, u.ID); err == nil && len(children) == 1 {
+		childID = children[0].ID
+	}
+
+	var bs callback.Buttons
 	var rows [][]tgbotapi.InlineKeyboardButton
 	for _, s := range free {
 		fmtLabel := "оффлайн"
@@ -85,9 +93,12 @@ func TryHandleParentSlotsCommand(ctx context.Context, bot *tgbotapi.BotAPI, data
 			s.ID,
 		)
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("p_book:%d", s.ID)),
+			bs.Add(cbBook.Button(label, s.ID, childID)),
 		))
 	}
+	if buttonsFailed(&bs) {
+		return true
+	}
 	kb := tgbotapi.NewInlineKeyboardMarkup(rows...)
 	msgOut := tgbotapi.NewMessage(msg.Chat.ID, "Свободные слоты:")
 	msgOut.ReplyMarkup = kb
@@ -99,15 +110,13 @@ func TryHandleParentSlotsCommand(ctx context.Context, bot *tgbotapi.BotAPI, data
 
 // TryHandleParentBookCallback обработка нажатия кнопки брони: p_book:<slotID>:<childID>
 func TryHandleParentBookCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, cb *tgbotapi.CallbackQuery) bool {
-	if cb == nil || cb.Data == "" || !strings.HasPrefix(cb.Data, "p_book:") {
+	if cb == nil || !cbBook.Match(cb.Data) {
 		return false
 	}
-	parts := strings.Split(cb.Data, ":")
-	if len(parts) != 3 {
+	slotID, childID, err := cbBook.Parse(cb.Data)
+	if err != nil {
 		return true
 	}
-	slotID, _ := strconv.ParseInt(parts[1], 10, 64)
-	childID, _ := strconv.ParseInt(parts[2], 10, 64)
 
 	chatID := cb.Message.Chat.ID
 	u, err := db.GetUserByTelegramID(ctx, database, chatID)
@@ -203,7 +212,9 @@ func TryHandleParentMyConsultsCallback(ctx context.Context, bot *tgbotapi.BotAPI
 		_ = sendCb(bot, cb, "Ошибка списка")
 		return true
 	}
-	if len(items) == 0 {
+	var bs callback.Buttons
+	waitlist := parentWaitlistRows(ctx, database, u.ID, &bs)
+	if len(items) == 0 && len(waitlist) == 0 {
 		edit := tgbotapi.NewEditMessageText(chatID, cb.Message.MessageID, "Записей не найдено.")
 		if _, err := tg.Send(bot, edit); err != nil {
 			metrics.HandlerErrors.Inc()
@@ -218,12 +229,16 @@ func TryHandleParentMyConsultsCallback(ctx context.Context, bot *tgbotapi.BotAPI
 		}
 		label := fmt.Sprintf("%s • %s — %s", it.StartAt.Format("02.01 15:04"), fmtLabel, it.Teacher)
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("❌ Отменить: "+label, fmt.Sprintf("p_cancel:%d", it.SlotID)),
+			bs.Add(cbCancelBook.Button("❌ Отменить: "+label, it.SlotID)),
 		))
 	}
+	rows = append(rows, waitlist...)
 	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
 		tgbotapi.NewInlineKeyboardButtonData("Закрыть", "p_flow:cancel"),
 	))
+	if buttonsFailed(&bs) {
+		return true
+	}
 	kb := tgbotapi.NewInlineKeyboardMarkup(rows...)
 	edit := tgbotapi.NewEditMessageText(chatID, cb.Message.MessageID, "Ваши записи:")
 	edit.ReplyMarkup = &kb
@@ -235,10 +250,13 @@ func TryHandleParentMyConsultsCallback(ctx context.Context, bot *tgbotapi.BotAPI
 
 // TryHandleParentCancelCallback отмена своей записи
 func TryHandleParentCancelCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, cb *tgbotapi.CallbackQuery) bool {
-	if cb == nil || cb.Data == "" || !strings.HasPrefix(cb.Data, "p_cancel:") {
+	if cb == nil || !cbCancelBook.Match(cb.Data) {
 		return false
 	}
-	slotID, _ := strconv.ParseInt(strings.TrimPrefix(cb.Data, "p_cancel:"), 10, 64)
+	slotID, err := cbCancelBook.Parse(cb.Data)
+	if err != nil {
+		return true
+	}
 	chatID := cb.Message.Chat.ID
 	u, err := db.GetUserByTelegramID(ctx, database, chatID)
 	if err != nil || u == nil || u.Role == nil || *u.Role != models.Parent {
@@ -257,6 +275,8 @@ func TryHandleParentCancelCallback(ctx context.Context, bot *tgbotapi.BotAPI, da
 	// уведомления: карточки тому, кого это касается (широковещалку мы убрали в notifications)
 	if slot, _ := db.GetSlotByID(ctx, database, slotID); slot != nil {
 		_ = SendConsultCancelCards(ctx, bot, database, u.ID, *slot)
+		// освободившееся время — сначала очереди к учителю
+		offerWaitlistSlotsLogged(ctx, bot, database, slot.TeacherID)
 	}
 	_ = sendCb(bot, cb, "Отменено")
 	return true
@@ -3,7 +3,6 @@ package app
 import (
 	"context"
 	"database/sql"
-	"fmt"
 	"strconv"
 	"strings"
 	"time"
@@ -82,6 +81,16 @@ func TryHandleTeacherAddSlots(ctx context.Context, bot *tgbotapi.BotAPI, databas
 	// Генерация стартов слотов на 4 недели вперёд
 	loc := time.Local // при желании подставим таймзону школы из конфига
 	starts := generateStartsWeeks(weekday, startT, endT, time.Duration(stepMin)*time.Minute, 1, loc)
+	starts, skippedDays, err := withoutDaysOff(ctx, database, starts)
+	if err != nil {
+		observability.CaptureErr(err)
+		reply(bot, chatID, "Ошибка при создании слотов.")
+		return true
+	}
+	if len(starts) == 0 && skippedDays > 0 {
+		reply(bot, chatID, "Этот день нерабочий (праздник или каникулы) — слоты не созданы.")
+		return true
+	}
 
 	// Конвертируем локальные времена в UTC для хранения
 	startsUTC := make([]time.Time, 0, len(starts))
@@ -96,7 +105,8 @@ func TryHandleTeacherAddSlots(ctx context.Context, bot *tgbotapi.BotAPI, databas
 		return true
 	}
 
-	reply(bot, chatID, fmt.Sprintf("Готово. Создано слотов: %d.", inserted))
+	reply(bot, chatID, slotsCreatedText(int64(inserted), skippedDays))
+	offerWaitlistSlotsLogged(ctx, bot, database, u.ID)
 	return true
 }
 
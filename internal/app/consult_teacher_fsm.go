@@ -8,9 +8,10 @@ import (
 	"sort"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmstore"
 	"github.com/Spok95/telegram-school-bot/internal/metrics"
 	"github.com/Spok95/telegram-school-bot/internal/tg"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -35,17 +36,13 @@ type teacherFSMState struct {
 	ConsultFormat    string // 'online' | 'offline'
 }
 
-var teacherFSM sync.Map // key: chatID(int64) -> *teacherFSMState
+var teacherFSM = fsmstore.NewMap[*teacherFSMState]("teacher_slots", 1, fsmstore.DefaultTTL)
 
-func getTeacherFSM(chatID int64) (*teacherFSMState, bool) {
-	v, ok := teacherFSM.Load(chatID)
-	if !ok {
-		return nil, false
-	}
-	return v.(*teacherFSMState), true
+func getTeacherFSM(chatID int64) (*teacherFSMState, bool) { return teacherFSM.Get(chatID) }
+func setTeacherFSM(ctx context.Context, chatID int64, st *teacherFSMState) {
+	teacherFSM.Set(ctx, chatID, st)
 }
-func setTeacherFSM(chatID int64, st *teacherFSMState) { teacherFSM.Store(chatID, st) }
-func clearTeacherFSM(chatID int64)                    { teacherFSM.Delete(chatID) }
+func clearTeacherFSM(ctx context.Context, chatID int64) { teacherFSM.Delete(ctx, chatID) }
 
 // ====== UI helpers ======
 
@@ -85,25 +82,18 @@ func TryHandleTeacherSlotsCommand(ctx context.Context, bot *tgbotapi.BotAPI, dat
 		}
 		return true
 	}
-	clearTeacherFSM(msg.Chat.ID)
 	st := &teacherFSMState{Step: 1}
-	setTeacherFSM(msg.Chat.ID, st)
+	setTeacherFSM(ctx, msg.Chat.ID, st)
+	defer teacherFSM.Save(ctx, msg.Chat.ID)
 
-	today := time.Now().In(time.Local).Truncate(24 * time.Hour)
-	var rows [][]tgbotapi.InlineKeyboardButton
-	wd := []string{"Вс", "Пн", "Вт", "Ср", "Чт", "Пт", "Сб"}
-	for i := 0; i < 14; i++ {
-		d := today.AddDate(0, 0, i)
-		label := d.Format("02.01") + " (" + wd[int(d.Weekday())] + ")"
-		rows = append(rows,
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData(label, "t_slots:day:"+d.Format("2006-01-02")),
-			),
-		)
-	}
+	var bs callback.Buttons
+	rows := teacherSlotDayRows(ctx, database, &bs)
 	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
 		tgbotapi.NewInlineKeyboardButtonData("Отмена", "t_slots:cancel"),
 	))
+	if buttonsFailed(&bs) {
+		return true
+	}
 	kb := tgbotapi.NewInlineKeyboardMarkup(rows...)
 	upsertStepMsg(bot, msg.Chat.ID, st, "Шаг 1/5. Выберите дату:", &kb)
 	return true
@@ -119,14 +109,15 @@ func TryHandleTeacherSlotsCallback(ctx context.Context, bot *tgbotapi.BotAPI, da
 	st, ok := getTeacherFSM(chatID)
 	if !ok {
 		st = &teacherFSMState{Step: 1}
-		setTeacherFSM(chatID, st)
+		setTeacherFSM(ctx, chatID, st)
 	}
+	defer teacherFSM.Save(ctx, chatID)
 	st.MsgID = cb.Message.MessageID // редактируем текущее сообщение
 
 	parts := strings.Split(cb.Data, ":")
 	switch parts[1] {
 	case "cancel":
-		clearTeacherFSM(chatID)
+		clearTeacherFSM(ctx, chatID)
 		edit := tgbotapi.NewEditMessageText(chatID, st.MsgID, "Отменено.")
 		if _, err := tg.Send(bot, edit); err != nil {
 			metrics.HandlerErrors.Inc()
@@ -134,15 +125,14 @@ func TryHandleTeacherSlotsCallback(ctx context.Context, bot *tgbotapi.BotAPI, da
 		return true
 
 	case "day":
-		// parts[2] = YYYY-MM-DD
-		d, err := time.Parse("2006-01-02", parts[2])
+		d, err := cbSlotsDay.Parse(cb.Data)
 		if err != nil {
-			_ = sendCb(bot, cb, "Дата в формате YYYY-MM-DD")
+			_ = sendCb(bot, cb, "Неверная дата")
 			return true
 		}
 		st.Day = d.In(time.Local) // поле Day добавим в состояние (см. ниже)
 		st.Step = 2
-		setTeacherFSM(chatID, st)
+		setTeacherFSM(ctx, chatID, st)
 		kb := tgbotapi.NewInlineKeyboardMarkup(
 			kbRow(
 				tgbotapi.NewInlineKeyboardButtonData("Назад", "t_slots:back:1"),
@@ -157,24 +147,19 @@ func TryHandleTeacherSlotsCallback(ctx context.Context, bot *tgbotapi.BotAPI, da
 		switch step {
 		case 1:
 			st.Step = 1
-			setTeacherFSM(chatID, st)
-			// 14 дат вперёд, подпись: 16.10 (Ср)
-			var rows [][]tgbotapi.InlineKeyboardButton
-			today := time.Now().In(time.Local).Truncate(24 * time.Hour)
-			for i := 0; i < 14; i++ {
-				d := today.AddDate(0, 0, i)
-				label := d.Format("02.01") + " (" + []string{"Вс", "Пн", "Вт", "Ср", "Чт", "Пт", "Сб"}[int(d.Weekday())] + ")"
-				rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-					tgbotapi.NewInlineKeyboardButtonData(label, "t_slots:day:"+d.Format("2006-01-02")),
-				))
-			}
+			setTeacherFSM(ctx, chatID, st)
+			var bs callback.Buttons
+			rows := teacherSlotDayRows(ctx, database, &bs)
 			rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("Отмена", "t_slots:cancel")))
+			if buttonsFailed(&bs) {
+				return true
+			}
 			kb := tgbotapi.NewInlineKeyboardMarkup(rows...)
 			upsertStepMsg(bot, chatID, st, "Шаг 1/5. Выберите дату:", &kb)
 			return true
 		case 2:
 			st.Step = 2
-			setTeacherFSM(chatID, st)
+			setTeacherFSM(ctx, chatID, st)
 			kb := tgbotapi.NewInlineKeyboardMarkup(
 				kbRow(tgbotapi.NewInlineKeyboardButtonData("Назад", "t_slots:back:1"), tgbotapi.NewInlineKeyboardButtonData("Отмена", "t_slots:cancel")),
 			)
@@ -182,7 +167,7 @@ func TryHandleTeacherSlotsCallback(ctx context.Context, bot *tgbotapi.BotAPI, da
 			return true
 		case 3:
 			st.Step = 3
-			setTeacherFSM(chatID, st)
+			setTeacherFSM(ctx, chatID, st)
 			kb := tgbotapi.NewInlineKeyboardMarkup(
 				kbRow(tgbotapi.NewInlineKeyboardButtonData("Назад", "t_slots:back:2"), tgbotapi.NewInlineKeyboardButtonData("Отмена", "t_slots:cancel")),
 			)
@@ -190,14 +175,17 @@ func TryHandleTeacherSlotsCallback(ctx context.Context, bot *tgbotapi.BotAPI, da
 			return true
 		case 4:
 			st.Step = 4
-			setTeacherFSM(chatID, st)
+			setTeacherFSM(ctx, chatID, st)
 			showClassMultiMenu(ctx, bot, database, chatID, st)
 			return true
 		}
 		return true
 
-	case "toggle_class": // t_slots:toggle_class:<id>
-		cid, _ := strconv.ParseInt(parts[2], 10, 64)
+	case "toggle_class":
+		cid, err := cbSlotsClass.Parse(cb.Data)
+		if err != nil {
+			return true
+		}
 		// toggle в st.SelectedClassIDs
 		found := false
 		for i, v := range st.SelectedClassIDs {
@@ -210,7 +198,7 @@ func TryHandleTeacherSlotsCallback(ctx context.Context, bot *tgbotapi.BotAPI, da
 		if !found {
 			st.SelectedClassIDs = append(st.SelectedClassIDs, cid)
 		}
-		setTeacherFSM(chatID, st)
+		setTeacherFSM(ctx, chatID, st)
 		showClassMultiMenu(ctx, bot, database, chatID, st)
 		return true
 
@@ -220,7 +208,7 @@ func TryHandleTeacherSlotsCallback(ctx context.Context, bot *tgbotapi.BotAPI, da
 			return true
 		}
 		st.Step = 5
-		setTeacherFSM(chatID, st)
+		setTeacherFSM(ctx, chatID, st)
 
 		rows := [][]tgbotapi.InlineKeyboardButton{
 			tgbotapi.NewInlineKeyboardRow(
@@ -247,7 +235,7 @@ func TryHandleTeacherSlotsCallback(ctx context.Context, bot *tgbotapi.BotAPI, da
 			return true
 		}
 		st.ConsultFormat = fmtVal
-		setTeacherFSM(chatID, st)
+		setTeacherFSM(ctx, chatID, st)
 
 		// генерируем старты
 		loc := time.Local
@@ -266,7 +254,18 @@ func TryHandleTeacherSlotsCallback(ctx context.Context, bot *tgbotapi.BotAPI, da
 		}
 		if len(starts) == 0 {
 			upsertStepMsg(bot, chatID, st, "Окно времени пустое — слоты не созданы.", nil)
-			clearTeacherFSM(chatID)
+			clearTeacherFSM(ctx, chatID)
+			return true
+		}
+		starts, skippedDays, err := withoutDaysOff(ctx, database, starts)
+		if err != nil {
+			upsertStepMsg(bot, chatID, st, "Ошибка при создании слотов.", nil)
+			clearTeacherFSM(ctx, chatID)
+			return true
+		}
+		if len(starts) == 0 {
+			upsertStepMsg(bot, chatID, st, "Выбранные дни нерабочие (праздники или каникулы) — слоты не созданы.", nil)
+			clearTeacherFSM(ctx, chatID)
 			return true
 		}
 
@@ -286,12 +285,14 @@ func TryHandleTeacherSlotsCallback(ctx context.Context, bot *tgbotapi.BotAPI, da
 			} else {
 				upsertStepMsg(bot, chatID, st, "Ошибка при создании слотов.", nil)
 			}
-			clearTeacherFSM(chatID)
+			clearTeacherFSM(ctx, chatID)
 			return true
 		}
 
-		nextStepBelowInput(bot, chatID, st, fmt.Sprintf("Готово. Создано слотов: %d.", inserted), nil)
-		clearTeacherFSM(chatID)
+		nextStepBelowInput(bot, chatID, st, slotsCreatedText(inserted, skippedDays), nil)
+		clearTeacherFSM(ctx, chatID)
+		// новые слоты — сначала листу ожидания
+		offerWaitlistSlotsLogged(ctx, bot, database, u.ID)
 		return true
 
 	case "csel": // выбор конкретного класса id
@@ -315,7 +316,18 @@ func TryHandleTeacherSlotsCallback(ctx context.Context, bot *tgbotapi.BotAPI, da
 		}
 		if len(starts) == 0 {
 			upsertStepMsg(bot, chatID, st, "Окно времени пустое — слоты не созданы.", nil)
-			clearTeacherFSM(chatID)
+			clearTeacherFSM(ctx, chatID)
+			return true
+		}
+		starts, skippedDays, err := withoutDaysOff(ctx, database, starts)
+		if err != nil {
+			upsertStepMsg(bot, chatID, st, "Ошибка при создании слотов.", nil)
+			clearTeacherFSM(ctx, chatID)
+			return true
+		}
+		if len(starts) == 0 {
+			upsertStepMsg(bot, chatID, st, "Выбранные дни нерабочие (праздники или каникулы) — слоты не созданы.", nil)
+			clearTeacherFSM(ctx, chatID)
 			return true
 		}
 
@@ -337,11 +349,13 @@ func TryHandleTeacherSlotsCallback(ctx context.Context, bot *tgbotapi.BotAPI, da
 			} else {
 				upsertStepMsg(bot, chatID, st, "Ошибка при создании слотов.", nil)
 			}
-			clearTeacherFSM(chatID)
+			clearTeacherFSM(ctx, chatID)
 			return true
 		}
-		nextStepBelowInput(bot, chatID, st, fmt.Sprintf("Готово. Создано слотов: %d.", inserted), nil)
-		clearTeacherFSM(chatID)
+		nextStepBelowInput(bot, chatID, st, slotsCreatedText(inserted, skippedDays), nil)
+		clearTeacherFSM(ctx, chatID)
+		// новые слоты — сначала листу ожидания
+		offerWaitlistSlotsLogged(ctx, bot, database, u.ID)
 		return true
 	}
 	return false
@@ -354,6 +368,7 @@ func TryHandleTeacherSlotsText(ctx context.Context, bot *tgbotapi.BotAPI, databa
 	if !ok {
 		return false
 	}
+	defer teacherFSM.Save(ctx, msg.Chat.ID)
 	switch st.Step {
 	case 2:
 		startT, endT, ok := parseTimeWindow(strings.TrimSpace(msg.Text))
@@ -366,7 +381,7 @@ func TryHandleTeacherSlotsText(ctx context.Context, bot *tgbotapi.BotAPI, databa
 		}
 		st.Start, st.End = startT, endT
 		st.Step = 3
-		setTeacherFSM(msg.Chat.ID, st)
+		setTeacherFSM(ctx, msg.Chat.ID, st)
 		kb := tgbotapi.NewInlineKeyboardMarkup(
 			kbRow(tgbotapi.NewInlineKeyboardButtonData("Назад", "t_slots:back:2"), tgbotapi.NewInlineKeyboardButtonData("Отмена", "t_slots:cancel")),
 		)
@@ -384,7 +399,7 @@ func TryHandleTeacherSlotsText(ctx context.Context, bot *tgbotapi.BotAPI, databa
 		}
 		st.StepMin = stepMin
 		st.Step = 4
-		setTeacherFSM(msg.Chat.ID, st)
+		setTeacherFSM(ctx, msg.Chat.ID, st)
 		showClassMultiMenu(ctx, bot, database, msg.Chat.ID, st)
 		return true
 	}
@@ -420,6 +435,7 @@ func showClassMultiMenu(
 		return classes[i].Number < classes[j].Number
 	})
 
+	var bs callback.Buttons
 	var rows [][]tgbotapi.InlineKeyboardButton
 	for _, c := range classes {
 		title := fmt.Sprintf("%d%s", c.Number, strings.ToUpper(c.Letter))
@@ -427,7 +443,7 @@ func showClassMultiMenu(
 			title = "✅ " + title
 		}
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(title, fmt.Sprintf("t_slots:toggle_class:%d", c.ID)),
+			bs.Add(cbSlotsClass.Button(title, c.ID)),
 		))
 	}
 
@@ -442,6 +458,9 @@ func showClassMultiMenu(
 		),
 	)
 
+	if buttonsFailed(&bs) {
+		return
+	}
 	kb := tgbotapi.NewInlineKeyboardMarkup(rows...)
 	upsertStepMsg(bot, chatID, st, "Шаг 4/5. Выберите один или несколько классов:", &kb)
 }
@@ -4,16 +4,17 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"strconv"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmstore"
 	"github.com/Spok95/telegram-school-bot/internal/metrics"
 	"github.com/Spok95/telegram-school-bot/internal/tg"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 
 	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/ical"
 	"github.com/Spok95/telegram-school-bot/internal/models"
 	"github.com/Spok95/telegram-school-bot/internal/observability"
 )
@@ -43,18 +44,15 @@ type teacherLinkState struct {
 	MsgID  int
 }
 
-var teacherLinkFSM sync.Map // chatID -> teacherLinkState
+var teacherLinkFSM = fsmstore.NewMap[teacherLinkState]("teacher_link", 1, fsmstore.DefaultTTL)
 
-func setTeacherLinkFSM(chatID int64, st teacherLinkState) { teacherLinkFSM.Store(chatID, st) }
-
-func getTeacherLinkFSM(chatID int64) (teacherLinkState, bool) {
-	v, ok := teacherLinkFSM.Load(chatID)
-	if !ok {
-		return teacherLinkState{}, false
-	}
-	return v.(teacherLinkState), true
+func setTeacherLinkFSM(ctx context.Context, chatID int64, st teacherLinkState) {
+	teacherLinkFSM.Set(ctx, chatID, st)
 }
-func clearTeacherLinkFSM(chatID int64) { teacherLinkFSM.Delete(chatID) }
+
+func getTeacherLinkFSM(chatID int64) (teacherLinkState, bool) { return teacherLinkFSM.Get(chatID) }
+
+func clearTeacherLinkFSM(ctx context.Context, chatID int64) { teacherLinkFSM.Delete(ctx, chatID) }
 
 // TryHandleTeacherMySlots /t_myslots — сначала дни текущей недели
 func TryHandleTeacherMySlots(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, msg *tgbotapi.Message) bool {
@@ -76,17 +74,21 @@ func TryHandleTeacherMySlots(ctx context.Context, bot *tgbotapi.BotAPI, database
 		days = append(days, today.AddDate(0, 0, i))
 	}
 
+	var bs callback.Buttons
 	var rows [][]tgbotapi.InlineKeyboardButton
 	for _, d := range days {
 		// подпись в виде: 03.11 (Пн)
 		lbl := fmt.Sprintf("%s (%s)", d.Format("02.01"), ruDayShort(d.Weekday()))
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(lbl, fmt.Sprintf("t_ms:day:%s", d.Format("2006-01-02"))),
+			bs.Add(cbManageDay.Button(lbl, d)),
 		))
 	}
 	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
 		tgbotapi.NewInlineKeyboardButtonData("Отмена", "t_ms:cancel"),
 	))
+	if buttonsFailed(&bs) {
+		return true
+	}
 	kb := tgbotapi.NewInlineKeyboardMarkup(rows...)
 	out := tgbotapi.NewMessage(msg.Chat.ID, "Выберите день (14 дней вперёд):")
 	out.ReplyMarkup = kb
@@ -127,7 +129,7 @@ func TryHandleTeacherManageCallback(ctx context.Context, bot *tgbotapi.BotAPI, d
 			}
 			return true
 
-		case strings.HasPrefix(cb.Data, "t_ms:day:"):
+		case cbManageDay.Match(cb.Data):
 			u, _ := db.GetUserByTelegramID(ctx, database, cb.Message.Chat.ID)
 			if u == nil || u.Role == nil || *u.Role != models.Teacher {
 				if _, err := tg.Request(bot, tgbotapi.NewCallback(cb.ID, "")); err != nil {
@@ -136,7 +138,11 @@ func TryHandleTeacherManageCallback(ctx context.Context, bot *tgbotapi.BotAPI, d
 				return true
 			}
 			loc := time.Local
-			day, _ := time.Parse("2006-01-02", strings.TrimPrefix(cb.Data, "t_ms:day:"))
+			day, err := cbManageDay.Parse(cb.Data)
+			if err != nil {
+				_, _ = tg.Request(bot, tgbotapi.NewCallback(cb.ID, "Неверная дата"))
+				return true
+			}
 			renderTeacherDaySlots(ctx, bot, database, cb.Message.Chat.ID, cb.Message.MessageID, u.ID, day, loc)
 			if _, err := tg.Request(bot, tgbotapi.NewCallback(cb.ID, "")); err != nil {
 				metrics.HandlerErrors.Inc()
@@ -145,15 +151,14 @@ func TryHandleTeacherManageCallback(ctx context.Context, bot *tgbotapi.BotAPI, d
 		}
 	}
 
-	if strings.HasPrefix(cb.Data, "t_link:") {
+	if cbSlotLink.Match(cb.Data) {
 		u, _ := db.GetUserByTelegramID(ctx, database, cb.Message.Chat.ID)
 		if u == nil || u.Role == nil || *u.Role != models.Teacher {
 			_, _ = tg.Request(bot, tgbotapi.NewCallback(cb.ID, ""))
 			return true
 		}
 
-		sid := strings.TrimPrefix(cb.Data, "t_link:")
-		slotID, err := strconv.ParseInt(sid, 10, 64)
+		slotID, err := cbSlotLink.Parse(cb.Data)
 		if err != nil || slotID <= 0 {
 			_, _ = tg.Request(bot, tgbotapi.NewCallback(cb.ID, "Неверный слот"))
 			return true
@@ -172,7 +177,7 @@ func TryHandleTeacherManageCallback(ctx context.Context, bot *tgbotapi.BotAPI, d
 		day := slot.StartAt.In(time.Local)
 		day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
 
-		setTeacherLinkFSM(cb.Message.Chat.ID, teacherLinkState{
+		setTeacherLinkFSM(ctx, cb.Message.Chat.ID, teacherLinkState{
 			SlotID: slotID,
 			Day:    day,
 			MsgID:  cb.Message.MessageID,
@@ -187,7 +192,7 @@ func TryHandleTeacherManageCallback(ctx context.Context, bot *tgbotapi.BotAPI, d
 	}
 
 	// 2) Собственно удаление / отмена
-	if strings.HasPrefix(cb.Data, "t_del:") || strings.HasPrefix(cb.Data, "t_cancel:") {
+	if cbSlotDelete.Match(cb.Data) || cbSlotCancel.Match(cb.Data) {
 		u, _ := db.GetUserByTelegramID(ctx, database, cb.Message.Chat.ID)
 		if u == nil || u.Role == nil || *u.Role != models.Teacher {
 			if _, err := tg.Request(bot, tgbotapi.NewCallback(cb.ID, "")); err != nil {
@@ -195,8 +200,12 @@ func TryHandleTeacherManageCallback(ctx context.Context, bot *tgbotapi.BotAPI, d
 			}
 			return true
 		}
-		sid := strings.TrimPrefix(strings.TrimPrefix(cb.Data, "t_del:"), "t_cancel:")
-		slotID, err := strconv.ParseInt(sid, 10, 64)
+		deleting := cbSlotDelete.Match(cb.Data)
+		parse := cbSlotCancel.Parse
+		if deleting {
+			parse = cbSlotDelete.Parse
+		}
+		slotID, err := parse(cb.Data)
 		if err != nil || slotID <= 0 {
 			if _, err := tg.Request(bot, tgbotapi.NewCallback(cb.ID, "Неверный слот")); err != nil {
 				metrics.HandlerErrors.Inc()
@@ -204,7 +213,7 @@ func TryHandleTeacherManageCallback(ctx context.Context, bot *tgbotapi.BotAPI, d
 			return true
 		}
 
-		if strings.HasPrefix(cb.Data, "t_del:") {
+		if deleting {
 			// читаем ДО удаления, чтобы знать дату
 			slotBefore, _ := db.GetSlotByID(ctx, database, slotID)
 
@@ -270,6 +279,8 @@ func TryHandleTeacherManageCallback(ctx context.Context, bot *tgbotapi.BotAPI, d
 
 		// Карточки + бродкаст используем ДАННЫЕ ДО отмены
 		_ = SendConsultCancelCards(ctx, bot, database, parentID, *slotBefore)
+		// освободившееся время — сначала очереди
+		offerWaitlistSlotsLogged(ctx, bot, database, u.ID)
 
 		day := slotBefore.StartAt.In(time.Local)
 		day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
@@ -293,6 +304,7 @@ func renderTeacherDaySlots(ctx context.Context, bot *tgbotapi.BotAPI, database *
 		return
 	}
 
+	var bs callback.Buttons
 	var rows [][]tgbotapi.InlineKeyboardButton
 	for _, s := range slots {
 		// соберём ВСЕ классы: первичный + связи consult_slot_classes
@@ -361,23 +373,23 @@ func renderTeacherDaySlots(ctx context.Context, bot *tgbotapi.BotAPI, database *
 		if s.BookedByID.Valid {
 			if s.ConsultFormat == "online" {
 				rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-					tgbotapi.NewInlineKeyboardButtonData("Отменить", fmt.Sprintf("t_cancel:%d", s.ID)),
-					tgbotapi.NewInlineKeyboardButtonData("🔗", fmt.Sprintf("t_link:%d", s.ID)),
+					bs.Add(cbSlotCancel.Button("Отменить", s.ID)),
+					bs.Add(cbSlotLink.Button("🔗", s.ID)),
 				))
 			} else {
 				rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-					tgbotapi.NewInlineKeyboardButtonData("Отменить", fmt.Sprintf("t_cancel:%d", s.ID)),
+					bs.Add(cbSlotCancel.Button("Отменить", s.ID)),
 				))
 			}
 		} else {
 			if s.ConsultFormat == "online" {
 				rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-					tgbotapi.NewInlineKeyboardButtonData("Удалить", fmt.Sprintf("t_del:%d", s.ID)),
-					tgbotapi.NewInlineKeyboardButtonData("🔗", fmt.Sprintf("t_link:%d", s.ID)),
+					bs.Add(cbSlotDelete.Button("Удалить", s.ID)),
+					bs.Add(cbSlotLink.Button("🔗", s.ID)),
 				))
 			} else {
 				rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-					tgbotapi.NewInlineKeyboardButtonData("Удалить", fmt.Sprintf("t_del:%d", s.ID)),
+					bs.Add(cbSlotDelete.Button("Удалить", s.ID)),
 				))
 			}
 		}
@@ -389,6 +401,9 @@ func renderTeacherDaySlots(ctx context.Context, bot *tgbotapi.BotAPI, database *
 			tgbotapi.NewInlineKeyboardButtonData("Отмена", "t_ms:cancel"),
 		),
 	)
+	if buttonsFailed(&bs) {
+		return
+	}
 	kb := tgbotapi.NewInlineKeyboardMarkup(rows...)
 	title := "Слоты на " + day.In(loc).Format("02.01.2006 (Mon)")
 	edit := tgbotapi.NewEditMessageText(chatID, msgID, title)
@@ -409,7 +424,7 @@ func TryHandleTeacherLinkText(ctx context.Context, bot *tgbotapi.BotAPI, databas
 
 	u, _ := db.GetUserByTelegramID(ctx, database, msg.Chat.ID)
 	if u == nil || u.Role == nil || *u.Role != models.Teacher {
-		clearTeacherLinkFSM(msg.Chat.ID)
+		clearTeacherLinkFSM(ctx, msg.Chat.ID)
 		return false
 	}
 
@@ -417,28 +432,33 @@ func TryHandleTeacherLinkText(ctx context.Context, bot *tgbotapi.BotAPI, databas
 	if text == "-" {
 		text = ""
 	}
+	// ссылка уходит родителям и в их календари (.ics)
+	if text != "" && !ical.ValidURL(text) {
+		_, _ = tg.Send(bot, tgbotapi.NewMessage(msg.Chat.ID, "Нужна ссылка вида https://… одной строкой. Отправьте ещё раз или «-», чтобы убрать ссылку."))
+		return true
+	}
 
 	// Проверим формат слота ещё раз
 	slot, err := db.GetSlotByID(ctx, database, st.SlotID)
 	if err != nil || slot == nil || slot.TeacherID != u.ID {
-		clearTeacherLinkFSM(msg.Chat.ID)
+		clearTeacherLinkFSM(ctx, msg.Chat.ID)
 		_, _ = tg.Send(bot, tgbotapi.NewMessage(msg.Chat.ID, "Слот не найден или уже недоступен."))
 		return true
 	}
 	if slot.ConsultFormat != "online" {
-		clearTeacherLinkFSM(msg.Chat.ID)
+		clearTeacherLinkFSM(ctx, msg.Chat.ID)
 		_, _ = tg.Send(bot, tgbotapi.NewMessage(msg.Chat.ID, "Это не онлайн-слот, ссылку сохранить нельзя."))
 		return true
 	}
 
 	okUpd, err := db.SetSlotOnlineURL(ctx, database, u.ID, st.SlotID, text)
 	if err != nil || !okUpd {
-		clearTeacherLinkFSM(msg.Chat.ID)
+		clearTeacherLinkFSM(ctx, msg.Chat.ID)
 		_, _ = tg.Send(bot, tgbotapi.NewMessage(msg.Chat.ID, "Не удалось сохранить ссылку (возможно слот уже начался)."))
 		return true
 	}
 
-	clearTeacherLinkFSM(msg.Chat.ID)
+	clearTeacherLinkFSM(ctx, msg.Chat.ID)
 	_, _ = tg.Send(bot, tgbotapi.NewMessage(msg.Chat.ID, "Ссылка сохранена."))
 
 	// Перерисовать список слотов на тот же день в том же сообщении
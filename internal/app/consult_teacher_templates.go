@@ -0,0 +1,612 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmstore"
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/metrics"
+	"github.com/Spok95/telegram-school-bot/internal/tg"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// «🔁 Шаблоны расписания» (/t_templates): учитель один раз описывает еженедельное окно
+// консультаций, а слоты на ближайшие недели создаются сами (см. RunConsultTemplates).
+
+// consultTemplateHorizonDays — на сколько дней вперёд создаются слоты по шаблонам.
+var consultTemplateHorizonDays = 28
+
+// SetConsultTemplateHorizon задаёт горизонт генерации слотов по шаблонам.
+func SetConsultTemplateHorizon(days int) {
+	if days > 0 {
+		consultTemplateHorizonDays = days
+	}
+}
+
+const (
+	tplStepWeekday = 1
+	tplStepWindow  = 2 // ждём текст HH:MM-HH:MM
+	tplStepStep    = 3 // ждём текст — минуты
+	tplStepClasses = 4
+	tplStepFormat  = 5
+)
+
+type tplFSMState struct {
+	Step     int
+	MsgID    int
+	EditID   int64 // 0 — новый шаблон
+	Weekday  int
+	StartMin int
+	EndMin   int
+	StepMin  int
+	ClassIDs []int64
+}
+
+var tplFSM = fsmstore.NewMap[*tplFSMState]("teacher_templates", 1, fsmstore.DefaultTTL)
+
+// teacherTemplatesTextActive — мастер шаблона ждёт время окна или шаг.
+func teacherTemplatesTextActive(chatID int64) bool {
+	st := tplFSM.Value(chatID)
+	return st != nil && (st.Step == tplStepWindow || st.Step == tplStepStep)
+}
+
+// HandleTeacherTemplates — кнопка «🔁 Шаблоны расписания» и /t_templates.
+func HandleTeacherTemplates(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, teacherID, chatID int64) {
+	tplFSM.Delete(ctx, chatID)
+	text, kb, err := templatesListView(ctx, database, teacherID)
+	if err != nil {
+		log.Println("consult templates:", err)
+		reply(bot, chatID, "⚠️ Не удалось загрузить шаблоны.")
+		return
+	}
+	m := tgbotapi.NewMessage(chatID, text)
+	m.ReplyMarkup = kb
+	if _, err := tg.Send(bot, m); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
+
+// HandleTeacherTemplatesCallback — кнопки списка, карточки и мастера шаблона (t_tpl:*).
+func HandleTeacherTemplatesCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, teacherID int64, cb *tgbotapi.CallbackQuery) {
+	chatID := cb.Message.Chat.ID
+	msgID := cb.Message.MessageID
+	parts := strings.Split(cb.Data, ":")
+	if len(parts) < 2 {
+		return
+	}
+	// id — аргумент кнопки с шаблоном; ok=false — данные не разобрались
+	id := func(act callback.Action1[int64]) (int64, bool) {
+		v, err := act.Parse(cb.Data)
+		return v, err == nil
+	}
+
+	switch parts[1] {
+	case "close":
+		tplFSM.Delete(ctx, chatID)
+		tplEdit(bot, chatID, msgID, "Шаблоны расписания закрыты.", nil)
+		return
+
+	case "list":
+		tplFSM.Delete(ctx, chatID)
+		text, kb, err := templatesListView(ctx, database, teacherID)
+		if err != nil {
+			log.Println("consult templates:", err)
+			_ = sendCb(bot, cb, "Не удалось загрузить шаблоны")
+			return
+		}
+		tplEdit(bot, chatID, msgID, text, &kb)
+		return
+
+	case "view":
+		if tplID, ok := id(cbTplView); ok {
+			tplShowCard(ctx, bot, database, cb, teacherID, tplID, "")
+		}
+		return
+
+	case "pause", "resume":
+		paused := parts[1] == "pause"
+		act := cbTplResume
+		if paused {
+			act = cbTplPause
+		}
+		tplID, ok := id(act)
+		if !ok {
+			return
+		}
+		removed, err := db.SetConsultTemplatePaused(ctx, database, teacherID, tplID, paused, time.Now().In(time.Local))
+		if err != nil {
+			tplChangeFailed(bot, cb, err)
+			return
+		}
+		note := fmt.Sprintf("⏸ Шаблон на паузе. Удалено свободных слотов: %d. Записи родителей сохранены.", removed)
+		if !paused {
+			created, err := syncConsultTemplate(ctx, database, teacherID, tplID, consultTemplateHorizonDays)
+			if err != nil {
+				log.Println("consult templates:", err)
+			}
+			note = fmt.Sprintf("▶️ Шаблон снова действует. Создано слотов: %d.", created)
+		}
+		tplShowCard(ctx, bot, database, cb, teacherID, tplID, note)
+		return
+
+	case "del":
+		tplID, ok := id(cbTplDel)
+		if !ok {
+			return
+		}
+		var bs callback.Buttons
+		kb := tgbotapi.NewInlineKeyboardMarkup(kbRow(
+			bs.Add(cbTplDelYes.Button("🗑 Да, удалить", tplID)),
+			bs.Add(cbTplView.Button("Назад", tplID)),
+		))
+		if buttonsFailed(&bs) {
+			return
+		}
+		tplEdit(bot, chatID, msgID, "Удалить шаблон? Его будущие свободные слоты тоже удалятся, записи родителей останутся.", &kb)
+		return
+
+	case "del_yes":
+		tplID, ok := id(cbTplDelYes)
+		if !ok {
+			return
+		}
+		removed, err := db.DeleteConsultTemplate(ctx, database, teacherID, tplID, time.Now().In(time.Local))
+		if err != nil {
+			tplChangeFailed(bot, cb, err)
+			return
+		}
+		text, kb, err := templatesListView(ctx, database, teacherID)
+		if err != nil {
+			log.Println("consult templates:", err)
+			return
+		}
+		tplEdit(bot, chatID, msgID, fmt.Sprintf("🗑 Шаблон удалён, свободных слотов удалено: %d.\n\n%s", removed, text), &kb)
+		return
+
+	case "new":
+		st := &tplFSMState{MsgID: msgID}
+		tplAskWeekday(ctx, bot, chatID, st)
+		return
+
+	case "edit":
+		tplID, ok := id(cbTplEdit)
+		if !ok {
+			return
+		}
+		t, err := db.GetConsultTemplate(ctx, database, teacherID, tplID)
+		if err != nil || t == nil {
+			_ = sendCb(bot, cb, "Шаблон не найден")
+			return
+		}
+		st := &tplFSMState{
+			MsgID: msgID, EditID: t.ID, Weekday: int(t.Weekday),
+			StartMin: t.StartMin, EndMin: t.EndMin, StepMin: t.StepMin,
+			ClassIDs: slices.Clone(t.ClassIDs),
+		}
+		tplAskWeekday(ctx, bot, chatID, st)
+		return
+	}
+
+	// дальше — шаги мастера
+	st := tplFSM.Value(chatID)
+	if st == nil {
+		tplEdit(bot, chatID, msgID, "Мастер шаблона устарел — откройте «🔁 Шаблоны расписания» заново.", nil)
+		return
+	}
+	st.MsgID = msgID
+	defer tplFSM.Save(ctx, chatID)
+
+	switch parts[1] {
+	case "cancel":
+		tplFSM.Delete(ctx, chatID)
+		tplEdit(bot, chatID, msgID, "Отменено.", nil)
+
+	case "wd":
+		wd, err := cbTplWeekday.Parse(cb.Data)
+		if err != nil || wd > 6 {
+			return
+		}
+		st.Weekday = wd
+		st.Step = tplStepWindow
+		tplFSM.Set(ctx, chatID, st)
+		tplAskWindow(bot, chatID, st)
+
+	case "back":
+		step, err := cbTplBack.Parse(cb.Data)
+		if err != nil {
+			return
+		}
+		switch step {
+		case tplStepWeekday:
+			tplAskWeekday(ctx, bot, chatID, st)
+		case tplStepWindow:
+			st.Step = tplStepWindow
+			tplFSM.Set(ctx, chatID, st)
+			tplAskWindow(bot, chatID, st)
+		case tplStepStep:
+			st.Step = tplStepStep
+			tplFSM.Set(ctx, chatID, st)
+			tplAskStep(bot, chatID, st)
+		case tplStepClasses:
+			st.Step = tplStepClasses
+			tplFSM.Set(ctx, chatID, st)
+			tplShowClasses(ctx, bot, database, chatID, st)
+		}
+
+	case "cls":
+		classID, ok := id(cbTplClass)
+		if !ok {
+			return
+		}
+		if i := slices.Index(st.ClassIDs, classID); i >= 0 {
+			st.ClassIDs = slices.Delete(st.ClassIDs, i, i+1)
+		} else {
+			st.ClassIDs = append(st.ClassIDs, classID)
+		}
+		tplFSM.Set(ctx, chatID, st)
+		tplShowClasses(ctx, bot, database, chatID, st)
+
+	case "cls_done":
+		if len(st.ClassIDs) == 0 {
+			_ = sendCb(bot, cb, "Выберите хотя бы один класс")
+			return
+		}
+		st.Step = tplStepFormat
+		tplFSM.Set(ctx, chatID, st)
+		var bs callback.Buttons
+		kb := tgbotapi.NewInlineKeyboardMarkup(
+			kbRow(
+				tgbotapi.NewInlineKeyboardButtonData("Онлайн", "t_tpl:fmt:online"),
+				tgbotapi.NewInlineKeyboardButtonData("Оффлайн", "t_tpl:fmt:offline"),
+			),
+			tplNavRow(&bs, tplStepClasses),
+		)
+		if buttonsFailed(&bs) {
+			return
+		}
+		tplEdit(bot, chatID, msgID, "Шаг 5/5. Формат консультаций:", &kb)
+
+	case "fmt":
+		if len(parts) < 3 || (parts[2] != "online" && parts[2] != "offline") {
+			return
+		}
+		tplSave(ctx, bot, database, teacherID, chatID, st, parts[2])
+	}
+}
+
+// HandleTeacherTemplatesText — время окна и шаг в мастере шаблона.
+func HandleTeacherTemplatesText(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	st := tplFSM.Value(chatID)
+	if st == nil {
+		return
+	}
+	defer tplFSM.Save(ctx, chatID)
+	text := strings.TrimSpace(msg.Text)
+
+	switch st.Step {
+	case tplStepWindow:
+		startT, endT, ok := parseTimeWindow(text)
+		if !ok || !startT.Before(endT) {
+			reply(bot, chatID, "Неверный формат. Пример: 16:00-18:00")
+			return
+		}
+		st.StartMin = startT.Hour()*60 + startT.Minute()
+		st.EndMin = endT.Hour()*60 + endT.Minute()
+		st.Step = tplStepStep
+		tplFSM.Set(ctx, chatID, st)
+		tplDisable(bot, chatID, st)
+		tplAskStep(bot, chatID, st)
+
+	case tplStepStep:
+		stepMin, err := strconv.Atoi(text)
+		if err != nil || stepMin <= 0 || stepMin > st.EndMin-st.StartMin {
+			reply(bot, chatID, fmt.Sprintf("Шаг — число минут от 1 до %d (длина окна).", st.EndMin-st.StartMin))
+			return
+		}
+		st.StepMin = stepMin
+		st.Step = tplStepClasses
+		tplFSM.Set(ctx, chatID, st)
+		tplDisable(bot, chatID, st)
+		tplShowClasses(ctx, bot, database, chatID, st)
+	}
+}
+
+func tplSave(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, teacherID, chatID int64, st *tplFSMState, format string) {
+	t := db.ConsultTemplate{
+		ID: st.EditID, TeacherID: teacherID, Weekday: time.Weekday(st.Weekday),
+		StartMin: st.StartMin, EndMin: st.EndMin, StepMin: st.StepMin,
+		ConsultFormat: format, ClassIDs: st.ClassIDs,
+	}
+	var removed int
+	var err error
+	if st.EditID == 0 {
+		t.ID, err = db.CreateConsultTemplate(ctx, database, t)
+	} else {
+		removed, err = db.UpdateConsultTemplate(ctx, database, t, time.Now().In(time.Local))
+	}
+	tplFSM.Delete(ctx, chatID)
+	if err != nil {
+		log.Println("consult templates:", err)
+		tplEdit(bot, chatID, st.MsgID, "Не удалось сохранить шаблон.", nil)
+		return
+	}
+	created, err := syncConsultTemplate(ctx, database, teacherID, t.ID, consultTemplateHorizonDays)
+	if err != nil {
+		log.Println("consult templates:", err)
+	}
+
+	note := fmt.Sprintf("✅ Шаблон сохранён. Создано слотов на %d дн. вперёд: %d.", consultTemplateHorizonDays, created)
+	if st.EditID != 0 {
+		note = fmt.Sprintf("✅ Шаблон изменён. Свободных слотов пересоздано: удалено %d, создано %d. Занятые слоты не тронуты.", removed, created)
+	}
+	text, kb, err := templateCardView(ctx, database, teacherID, t.ID)
+	if err != nil {
+		tplEdit(bot, chatID, st.MsgID, note, nil)
+		return
+	}
+	tplEdit(bot, chatID, st.MsgID, note+"\n\n"+text, &kb)
+}
+
+// ===== экраны =====
+
+func templatesListView(ctx context.Context, database *sql.DB, teacherID int64) (string, tgbotapi.InlineKeyboardMarkup, error) {
+	list, err := db.ListConsultTemplates(ctx, database, teacherID)
+	if err != nil {
+		return "", tgbotapi.InlineKeyboardMarkup{}, err
+	}
+	names, err := classNames(ctx, database)
+	if err != nil {
+		return "", tgbotapi.InlineKeyboardMarkup{}, err
+	}
+	var b strings.Builder
+	b.WriteString("🔁 Шаблоны расписания\n")
+	if len(list) == 0 {
+		b.WriteString("\nШаблонов пока нет. Шаблон — это еженедельное окно консультаций: слоты по нему " +
+			"создаются автоматически на несколько недель вперёд, каникулы пропускаются.")
+	}
+	var bs callback.Buttons
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, t := range list {
+		line := templateSummary(t, names)
+		fmt.Fprintf(&b, "\n• %s", line)
+		rows = append(rows, kbRow(bs.Add(cbTplView.Button(
+			ruDayShort(t.Weekday)+" "+fmtMinutes(t.StartMin)+"–"+fmtMinutes(t.EndMin)+pausedMark(t),
+			t.ID))))
+	}
+	rows = append(rows,
+		kbRow(tgbotapi.NewInlineKeyboardButtonData("➕ Новый шаблон", "t_tpl:new")),
+		kbRow(tgbotapi.NewInlineKeyboardButtonData("Закрыть", "t_tpl:close")),
+	)
+	if err := bs.Err(); err != nil {
+		return "", tgbotapi.InlineKeyboardMarkup{}, err
+	}
+	return b.String(), tgbotapi.NewInlineKeyboardMarkup(rows...), nil
+}
+
+func templateCardView(ctx context.Context, database *sql.DB, teacherID, id int64) (string, tgbotapi.InlineKeyboardMarkup, error) {
+	t, err := db.GetConsultTemplate(ctx, database, teacherID, id)
+	if err == nil && t == nil {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		return "", tgbotapi.InlineKeyboardMarkup{}, err
+	}
+	names, err := classNames(ctx, database)
+	if err != nil {
+		return "", tgbotapi.InlineKeyboardMarkup{}, err
+	}
+	text := "🔁 Шаблон\n" + templateSummary(*t, names)
+	var bs callback.Buttons
+	pause := bs.Add(cbTplPause.Button("⏸ Пауза", t.ID))
+	if t.Paused {
+		text += "\n\nНа паузе: новые слоты не создаются."
+		pause = bs.Add(cbTplResume.Button("▶️ Возобновить", t.ID))
+	}
+	kb := tgbotapi.NewInlineKeyboardMarkup(
+		kbRow(pause, bs.Add(cbTplEdit.Button("✏️ Изменить", t.ID))),
+		kbRow(
+			bs.Add(cbTplDel.Button("🗑 Удалить", t.ID)),
+			tgbotapi.NewInlineKeyboardButtonData("Назад", "t_tpl:list"),
+		),
+	)
+	if err := bs.Err(); err != nil {
+		return "", tgbotapi.InlineKeyboardMarkup{}, err
+	}
+	return text, kb, nil
+}
+
+func tplShowCard(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, cb *tgbotapi.CallbackQuery, teacherID, id int64, note string) {
+	text, kb, err := templateCardView(ctx, database, teacherID, id)
+	if err != nil {
+		_ = sendCb(bot, cb, "Шаблон не найден")
+		return
+	}
+	if note != "" {
+		text = note + "\n\n" + text
+	}
+	tplEdit(bot, cb.Message.Chat.ID, cb.Message.MessageID, text, &kb)
+}
+
+func tplAskWeekday(ctx context.Context, bot *tgbotapi.BotAPI, chatID int64, st *tplFSMState) {
+	st.Step = tplStepWeekday
+	tplFSM.Set(ctx, chatID, st)
+	tplFSM.Save(ctx, chatID)
+	var bs callback.Buttons
+	var row []tgbotapi.InlineKeyboardButton
+	for _, wd := range []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday} {
+		row = append(row, bs.Add(cbTplWeekday.Button(ruDayShort(wd), int(wd))))
+	}
+	if buttonsFailed(&bs) {
+		return
+	}
+	kb := tgbotapi.NewInlineKeyboardMarkup(row, kbRow(tgbotapi.NewInlineKeyboardButtonData("Отмена", "t_tpl:cancel")))
+	tplEdit(bot, chatID, st.MsgID, "Шаг 1/5. День недели:", &kb)
+}
+
+func tplAskWindow(bot *tgbotapi.BotAPI, chatID int64, st *tplFSMState) {
+	text := "Шаг 2/5. Введите окно консультаций в формате HH:MM-HH:MM (например, 16:00-18:00)"
+	if st.EndMin > 0 {
+		text += "\nСейчас: " + fmtMinutes(st.StartMin) + "-" + fmtMinutes(st.EndMin)
+	}
+	var bs callback.Buttons
+	kb := tgbotapi.NewInlineKeyboardMarkup(tplNavRow(&bs, tplStepWeekday))
+	if buttonsFailed(&bs) {
+		return
+	}
+	tplEdit(bot, chatID, st.MsgID, text, &kb)
+}
+
+func tplAskStep(bot *tgbotapi.BotAPI, chatID int64, st *tplFSMState) {
+	text := "Шаг 3/5. Длительность одной консультации в минутах (например, 15)"
+	if st.StepMin > 0 {
+		text += fmt.Sprintf("\nСейчас: %d", st.StepMin)
+	}
+	var bs callback.Buttons
+	kb := tgbotapi.NewInlineKeyboardMarkup(tplNavRow(&bs, tplStepWindow))
+	if buttonsFailed(&bs) {
+		return
+	}
+	tplSendBelow(bot, chatID, st, text, &kb)
+}
+
+func tplShowClasses(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, chatID int64, st *tplFSMState) {
+	classes, err := db.ListVisibleClasses(ctx, database)
+	if err != nil || len(classes) == 0 {
+		tplEdit(bot, chatID, st.MsgID, "Классы не найдены.", nil)
+		return
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		if classes[i].Number == classes[j].Number {
+			return classes[i].Letter < classes[j].Letter
+		}
+		return classes[i].Number < classes[j].Number
+	})
+	var bs callback.Buttons
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var row []tgbotapi.InlineKeyboardButton
+	for _, c := range classes {
+		title := fmt.Sprintf("%d%s", c.Number, strings.ToUpper(c.Letter))
+		if slices.Contains(st.ClassIDs, c.ID) {
+			title = "✅ " + title
+		}
+		row = append(row, bs.Add(cbTplClass.Button(title, c.ID)))
+		if len(row) == 5 {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+	rows = append(rows,
+		kbRow(tgbotapi.NewInlineKeyboardButtonData("✅ Готово", "t_tpl:cls_done")),
+		tplNavRow(&bs, tplStepStep),
+	)
+	if buttonsFailed(&bs) {
+		return
+	}
+	kb := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	tplSendBelow(bot, chatID, st, "Шаг 4/5. Для каких классов консультации?", &kb)
+}
+
+// ===== helpers =====
+
+func tplNavRow(bs *callback.Buttons, backStep int) []tgbotapi.InlineKeyboardButton {
+	return kbRow(
+		bs.Add(cbTplBack.Button("Назад", backStep)),
+		tgbotapi.NewInlineKeyboardButtonData("Отмена", "t_tpl:cancel"),
+	)
+}
+
+// tplSendBelow — если сообщение мастера уже погашено (после текстового ввода),
+// следующий шаг присылается новым сообщением под ответом учителя.
+func tplSendBelow(bot *tgbotapi.BotAPI, chatID int64, st *tplFSMState, text string, kb *tgbotapi.InlineKeyboardMarkup) {
+	if st.MsgID != 0 {
+		tplEdit(bot, chatID, st.MsgID, text, kb)
+		return
+	}
+	m := tgbotapi.NewMessage(chatID, text)
+	if kb != nil {
+		m.ReplyMarkup = kb
+	}
+	out, err := tg.Send(bot, m)
+	if err != nil {
+		metrics.HandlerErrors.Inc()
+		return
+	}
+	st.MsgID = out.MessageID
+}
+
+// tplDisable гасит кнопки предыдущего шага, чтобы следующий пришёл ниже ввода.
+func tplDisable(bot *tgbotapi.BotAPI, chatID int64, st *tplFSMState) {
+	if st.MsgID != 0 {
+		_, _ = tg.Request(bot, tgbotapi.NewDeleteMessage(chatID, st.MsgID))
+		st.MsgID = 0
+	}
+}
+
+func tplEdit(bot *tgbotapi.BotAPI, chatID int64, msgID int, text string, kb *tgbotapi.InlineKeyboardMarkup) {
+	edit := tgbotapi.NewEditMessageText(chatID, msgID, text)
+	edit.ReplyMarkup = kb
+	if _, err := tg.Send(bot, edit); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
+
+func tplChangeFailed(bot *tgbotapi.BotAPI, cb *tgbotapi.CallbackQuery, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = sendCb(bot, cb, "Шаблон не найден")
+		return
+	}
+	log.Println("consult templates:", err)
+	_ = sendCb(bot, cb, "Не удалось изменить шаблон")
+}
+
+// templateSummary — «Вт 16:00–18:00, по 15 мин, оффлайн; классы: 7А, 7Б».
+func templateSummary(t db.ConsultTemplate, names map[int64]string) string {
+	format := "оффлайн"
+	if t.ConsultFormat == "online" {
+		format = "онлайн"
+	}
+	cls := make([]string, 0, len(t.ClassIDs))
+	for _, id := range t.ClassIDs {
+		if n, ok := names[id]; ok {
+			cls = append(cls, n)
+		}
+	}
+	return fmt.Sprintf("%s %s–%s, по %d мин, %s; классы: %s%s",
+		ruDayShort(t.Weekday), fmtMinutes(t.StartMin), fmtMinutes(t.EndMin), t.StepMin, format,
+		strings.Join(cls, ", "), pausedMark(t))
+}
+
+func pausedMark(t db.ConsultTemplate) string {
+	if t.Paused {
+		return " ⏸"
+	}
+	return ""
+}
+
+func fmtMinutes(m int) string { return fmt.Sprintf("%02d:%02d", m/60, m%60) }
+
+func classNames(ctx context.Context, database *sql.DB) (map[int64]string, error) {
+	classes, err := db.ListVisibleClasses(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[int64]string, len(classes))
+	for _, c := range classes {
+		out[c.ID] = fmt.Sprintf("%d%s", c.Number, strings.ToUpper(c.Letter))
+	}
+	return out, nil
+}
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+)
+
+// Шаблоны расписания консультаций («🔁 Шаблоны расписания») превращаются в слоты
+// фоновой задачей: каждый запуск досоздаёт слоты до горизонта в horizonDays дней.
+// Горизонт шаблона хранится в generated_until, поэтому уже созданные (и удалённые
+// учителем) дни повторно не заполняются. Каникулы пропускаются.
+
+// RunConsultTemplates создаёт слоты по всем активным шаблонам.
+func RunConsultTemplates(ctx context.Context, database *sql.DB, horizonDays int) error {
+	templates, err := db.ListActiveConsultTemplates(ctx, database)
+	if err != nil || len(templates) == 0 {
+		return err
+	}
+	now := time.Now().In(time.Local)
+	today, until := templateHorizon(now, horizonDays)
+	daysOff, err := db.NonWorkingDays(ctx, database, today, until)
+	if err != nil {
+		return err
+	}
+	for _, t := range templates {
+		n, err := generateTemplate(ctx, database, t, now, until, daysOff)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			log.Printf("[consult_templates] шаблон #%d: создано слотов %d", t.ID, n)
+		}
+	}
+	return nil
+}
+
+// syncConsultTemplate сразу создаёт слоты по одному шаблону — после его создания,
+// изменения или снятия с паузы, чтобы учитель не ждал фоновую задачу.
+func syncConsultTemplate(ctx context.Context, database *sql.DB, teacherID, id int64, horizonDays int) (int, error) {
+	t, err := db.GetConsultTemplate(ctx, database, teacherID, id)
+	if err != nil || t == nil || t.Paused {
+		return 0, err
+	}
+	now := time.Now().In(time.Local)
+	today, until := templateHorizon(now, horizonDays)
+	daysOff, err := db.NonWorkingDays(ctx, database, today, until)
+	if err != nil {
+		return 0, err
+	}
+	return generateTemplate(ctx, database, *t, now, until, daysOff)
+}
+
+func generateTemplate(ctx context.Context, database *sql.DB, t db.ConsultTemplate, now, until time.Time, daysOff map[string]bool) (int, error) {
+	from := dayStart(now)
+	if t.GeneratedUntil != nil {
+		// DATE из БД приходит полуночью в UTC: берём календарную дату, а не момент
+		next := time.Date(t.GeneratedUntil.Year(), t.GeneratedUntil.Month(), t.GeneratedUntil.Day()+1, 0, 0, 0, 0, time.Local)
+		if next.After(from) {
+			from = next
+		}
+	}
+	if from.After(until) {
+		return 0, nil
+	}
+	starts := templateStarts(t, from, until, now, daysOff)
+	return db.GenerateTemplateSlots(ctx, database, t, starts, until)
+}
+
+// templateHorizon — первый и последний день горизонта генерации.
+func templateHorizon(now time.Time, horizonDays int) (time.Time, time.Time) {
+	today := dayStart(now)
+	return today, today.AddDate(0, 0, horizonDays-1)
+}
+
+func dayStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// templateStarts — начала слотов шаблона в днях [from, until], кроме нерабочих
+// дней и уже прошедшего времени.
+func templateStarts(t db.ConsultTemplate, from, until, now time.Time, daysOff map[string]bool) []time.Time {
+	if t.StepMin <= 0 {
+		return nil
+	}
+	var starts []time.Time
+	for day := dayStart(from); !day.After(until); day = day.AddDate(0, 0, 1) {
+		if day.Weekday() != t.Weekday || daysOff[day.Format("2006-01-02")] {
+			continue
+		}
+		for m := t.StartMin; m+t.StepMin <= t.EndMin; m += t.StepMin {
+			tm := time.Date(day.Year(), day.Month(), day.Day(), m/60, m%60, 0, 0, day.Location())
+			if tm.After(now) {
+				starts = append(starts, tm)
+			}
+		}
+	}
+	return starts
+}
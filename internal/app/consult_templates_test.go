@@ -0,0 +1,34 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+)
+
+func TestTemplateStarts_SkipsDaysOffAndPast(t *testing.T) {
+	loc := time.FixedZone("MSK", 3*3600)
+	tpl := db.ConsultTemplate{Weekday: time.Tuesday, StartMin: 16 * 60, EndMin: 17*60 + 10, StepMin: 20}
+
+	// вторник 04.11.2025 — каникулы, сейчас — вторник 28.10.2025 16:30
+	now := time.Date(2025, 10, 28, 16, 30, 0, 0, loc)
+	from := dayStart(now)
+	until := from.AddDate(0, 0, 21) // по 18.11 включительно
+	starts := templateStarts(tpl, from, until, now, map[string]bool{"2025-11-04": true})
+
+	var got []string
+	for _, s := range starts {
+		got = append(got, s.Format("02.01 15:04"))
+	}
+	// 28.10: 16:00 и 16:20 уже прошли, 16:40 ещё впереди; слот 17:00–17:20 не влезает в окно
+	want := []string{"28.10 16:40", "11.11 16:00", "11.11 16:20", "11.11 16:40", "18.11 16:00", "18.11 16:20", "18.11 16:40"}
+	if len(got) != len(want) {
+		t.Fatalf("ожидали %v, получили %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("ожидали %v, получили %v", want, got)
+		}
+	}
+}
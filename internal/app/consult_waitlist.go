@@ -0,0 +1,359 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/metrics"
+	"github.com/Spok95/telegram-school-bot/internal/models"
+	"github.com/Spok95/telegram-school-bot/internal/observability"
+	"github.com/Spok95/telegram-school-bot/internal/tg"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Лист ожидания консультаций: если у учителя не осталось свободного времени для класса,
+// родитель встаёт в очередь (при желании — только на удобные дни недели). Освободившийся
+// после отмены или новый слот сначала закрепляется за первым подходящим родителем из
+// очереди на waitlistOfferTTL: ему приходит сообщение с кнопкой записи в одно касание.
+// Отказ или истёкший срок передают слот следующему, а когда очередь кончилась — всем.
+
+// waitlistOfferTTL — сколько слот ждёт ответа родителя из очереди.
+var waitlistOfferTTL = 30 * time.Minute
+
+// SetWaitlistOfferTTL задаёт срок предложения слота из листа ожидания.
+func SetWaitlistOfferTTL(d time.Duration) {
+	if d > 0 {
+		waitlistOfferTTL = d
+	}
+}
+
+// дни недели на выбор в порядке школьной недели
+var waitlistWeekdays = []time.Weekday{
+	time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday,
+}
+
+// weekdaysFromMask — битовая маска дней из кнопок (бит = time.Weekday) в список для БД.
+func weekdaysFromMask(mask int) []int64 {
+	var out []int64
+	for _, wd := range waitlistWeekdays {
+		if mask&(1<<uint(wd)) != 0 {
+			out = append(out, int64(wd))
+		}
+	}
+	return out
+}
+
+// weekdaysLabel — «Пн, Ср» или «любой день».
+func weekdaysLabel(days []int64) string {
+	if len(days) == 0 {
+		return "любой день"
+	}
+	names := make([]string, 0, len(days))
+	for _, d := range days {
+		names = append(names, ruDayShort(time.Weekday(d)))
+	}
+	return strings.Join(names, ", ")
+}
+
+// RunWaitlistOffers — фоновая задача: слоты с истёкшими предложениями и новые слоты
+// (например, из шаблонов) предлагаются следующим в очереди.
+func RunWaitlistOffers(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB) error {
+	teachers, err := db.ListWaitlistTeachers(ctx, database)
+	if err != nil {
+		return err
+	}
+	for _, id := range teachers {
+		if err := offerWaitlistSlots(ctx, bot, database, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// offerWaitlistSlots закрепляет свободные слоты учителя за родителями из очереди и
+// рассылает предложения. Вызывается после отмены записи и создания слотов.
+func offerWaitlistSlots(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, teacherID int64) error {
+	offers, err := db.AssignWaitlistOffers(ctx, database, teacherID, waitlistOfferTTL)
+	if err != nil {
+		return err
+	}
+	if len(offers) == 0 {
+		return nil
+	}
+	teacher, err := db.GetUserByID(ctx, database, teacherID)
+	if err != nil {
+		return err
+	}
+	for _, o := range offers {
+		sendWaitlistOffer(ctx, bot, database, teacher.Name, o)
+	}
+	return nil
+}
+
+// offerWaitlistSlotsLogged — то же из обработчиков (синхронно): ошибка только пишется в лог
+// и не мешает ответу пользователю.
+func offerWaitlistSlotsLogged(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, teacherID int64) {
+	if err := offerWaitlistSlots(ctx, bot, database, teacherID); err != nil {
+		log.Println("waitlist offers:", err)
+		observability.CaptureErr(err)
+	}
+}
+
+func sendWaitlistOffer(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, teacherName string, o db.WaitlistOffer) {
+	parent, err := db.GetUserByID(ctx, database, o.ParentID)
+	if err != nil || parent.TelegramID == 0 {
+		return
+	}
+	slot, err := db.GetSlotByID(ctx, database, o.SlotID)
+	if err != nil || slot == nil {
+		return
+	}
+	child, _ := db.GetUserByID(ctx, database, o.ChildID)
+
+	fmtLabel := "оффлайн"
+	if slot.ConsultFormat == "online" {
+		fmtLabel = "онлайн"
+	}
+	text := fmt.Sprintf(
+		"🔔 Освободилось время для консультации\nУчитель: %s\nДата/время: %s %s–%s\nФормат: %s",
+		teacherName, ruDayShort(slot.StartAt.Weekday()), slot.StartAt.Format("02.01.2006 15:04"), slot.EndAt.Format("15:04"), fmtLabel,
+	)
+	if child.Name != "" {
+		text += "\nРебёнок: " + child.Name
+	}
+	text += fmt.Sprintf("\n\nВремя закреплено за вами до %s, потом его смогут занять другие.",
+		o.ExpiresAt.In(time.Local).Format("15:04"))
+
+	var bs callback.Buttons
+	m := tgbotapi.NewMessage(parent.TelegramID, text)
+	m.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		bs.Add(cbBook.Button("✅ Записаться", o.SlotID, o.ChildID)),
+		bs.Add(cbWaitlistSkip.Button("Не подходит", o.SlotID)),
+	))
+	if buttonsFailed(&bs) {
+		return
+	}
+	if _, err := tg.Send(bot, m); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
+
+// waitlistClassID — класс ребёнка для очереди (как в выборе слотов).
+func waitlistClassID(ctx context.Context, database *sql.DB, ch models.User) int64 {
+	if ch.ClassID != nil {
+		return *ch.ClassID
+	}
+	if ch.ClassNumber != nil && ch.ClassLetter != nil {
+		if cls, _ := db.GetClassByNumberLetter(ctx, database, int(*ch.ClassNumber), *ch.ClassLetter); cls != nil {
+			return cls.ID
+		}
+	}
+	return 0
+}
+
+// fullyBookedTeachers — учителя класса без свободного времени: прошедший месяц
+// показывает, что учитель ведёт консультации, две недели вперёд — как в выборе слотов.
+func fullyBookedTeachers(ctx context.Context, database *sql.DB, classID int64) ([]db.TeacherLite, error) {
+	if classID == 0 {
+		return nil, nil
+	}
+	today := dayStart(time.Now().In(time.Local))
+	return db.ListFullyBookedTeachersForClass(ctx, database, classID, today.AddDate(0, 0, -28), today.AddDate(0, 0, 14), 50)
+}
+
+// parentWaitlistRows — кнопки выхода из очередей для «📋 Мои записи».
+func parentWaitlistRows(ctx context.Context, database *sql.DB, parentID int64, bs *callback.Buttons) [][]tgbotapi.InlineKeyboardButton {
+	entries, err := db.ListParentWaitlist(ctx, database, parentID)
+	if err != nil {
+		observability.CaptureErr(err)
+		return nil
+	}
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, e := range entries {
+		label := fmt.Sprintf("⏳ Выйти из очереди: %s (%s, %s)", e.TeacherName, e.ChildName, weekdaysLabel(e.Weekdays))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			bs.Add(cbWaitlistLeave.Button(label, e.ID)),
+		))
+	}
+	return rows
+}
+
+// TryHandleParentWaitlistCallback — лист ожидания:
+// p_wl:<child> — учителя без свободного времени;
+// p_wl_t:<teacher>:<child>:<маска дней> — выбор удобных дней;
+// p_wl_ok:<teacher>:<child>:<маска дней> — встать в очередь;
+// p_wl_leave:<entry> — выйти из очереди; p_wl_skip:<slot> — отказаться от предложенного слота.
+func TryHandleParentWaitlistCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, cb *tgbotapi.CallbackQuery) bool {
+	if cb == nil || !strings.HasPrefix(cb.Data, "p_wl") {
+		return false
+	}
+	chatID := cb.Message.Chat.ID
+	u, err := db.GetUserByTelegramID(ctx, database, chatID)
+	if err != nil || u == nil || u.Role == nil || *u.Role != models.Parent {
+		_ = sendCb(bot, cb, "Только для родителей")
+		return true
+	}
+	var bs callback.Buttons
+	edit := func(text string, rows [][]tgbotapi.InlineKeyboardButton) {
+		if buttonsFailed(&bs) {
+			return
+		}
+		e := tgbotapi.NewEditMessageText(chatID, cb.Message.MessageID, text)
+		if len(rows) > 0 {
+			kb := tgbotapi.NewInlineKeyboardMarkup(rows...)
+			e.ReplyMarkup = &kb
+		}
+		if _, err := tg.Send(bot, e); err != nil {
+			metrics.HandlerErrors.Inc()
+		}
+	}
+
+	switch {
+	case cbWaitlist.Match(cb.Data):
+		childID, err := cbWaitlist.Parse(cb.Data)
+		if err != nil {
+			return true
+		}
+		ch, err := db.GetUserByID(ctx, database, childID)
+		if err != nil || ch.ID == 0 {
+			_ = sendCb(bot, cb, "Неверный ребёнок")
+			return true
+		}
+		teachers, err := fullyBookedTeachers(ctx, database, waitlistClassID(ctx, database, ch))
+		if err != nil {
+			observability.CaptureErr(err)
+			_ = sendCb(bot, cb, "Ошибка при получении учителей")
+			return true
+		}
+		if len(teachers) == 0 {
+			_ = sendCb(bot, cb, "У всех учителей есть свободное время")
+			return true
+		}
+		var rows [][]tgbotapi.InlineKeyboardButton
+		for _, t := range teachers {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+				bs.Add(cbWaitlistPick.Button(t.Name, t.ID, childID, 0)),
+			))
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			bs.Add(cbPickChild.Button("Назад", childID)),
+			tgbotapi.NewInlineKeyboardButtonData("Отмена", "p_flow:cancel"),
+		))
+		edit("⏳ Лист ожидания\nУ этих учителей всё время занято. Выберите учителя — "+
+			"когда освободится время, бот предложит его вам первым.", rows)
+		return true
+
+	case cbWaitlistPick.Match(cb.Data), cbWaitlistOK.Match(cb.Data):
+		picking := cbWaitlistPick.Match(cb.Data)
+		parse := cbWaitlistOK.Parse
+		if picking {
+			parse = cbWaitlistPick.Parse
+		}
+		teacherID, childID, mask, err := parse(cb.Data)
+		if err != nil {
+			return true
+		}
+		teacher, err := db.GetUserByID(ctx, database, teacherID)
+		if err != nil || teacher.ID == 0 {
+			_ = sendCb(bot, cb, "Учитель не найден")
+			return true
+		}
+
+		if picking {
+			var rows [][]tgbotapi.InlineKeyboardButton
+			var row []tgbotapi.InlineKeyboardButton
+			for _, wd := range waitlistWeekdays {
+				bit := 1 << uint(wd)
+				lbl := ruDayShort(wd)
+				if mask&bit != 0 {
+					lbl = "✅ " + lbl
+				}
+				row = append(row, bs.Add(cbWaitlistPick.Button(lbl, teacherID, childID, mask^bit)))
+				if len(row) == 3 {
+					rows = append(rows, row)
+					row = nil
+				}
+			}
+			rows = append(rows,
+				tgbotapi.NewInlineKeyboardRow(
+					bs.Add(cbWaitlistOK.Button("⏳ Встать в очередь", teacherID, childID, mask)),
+				),
+				tgbotapi.NewInlineKeyboardRow(
+					bs.Add(cbWaitlist.Button("Назад", childID)),
+					tgbotapi.NewInlineKeyboardButtonData("Отмена", "p_flow:cancel"),
+				),
+			)
+			edit(fmt.Sprintf("⏳ Лист ожидания: %s\nОтметьте удобные дни (необязательно) — сейчас: %s.",
+				teacher.Name, weekdaysLabel(weekdaysFromMask(mask))), rows)
+			return true
+		}
+
+		ch, err := db.GetUserByID(ctx, database, childID)
+		if err != nil || ch.ID == 0 {
+			_ = sendCb(bot, cb, "Неверный ребёнок")
+			return true
+		}
+		classID := waitlistClassID(ctx, database, ch)
+		if classID == 0 {
+			_ = sendCb(bot, cb, "У ребёнка не указан класс")
+			return true
+		}
+		days := weekdaysFromMask(mask)
+		if _, err := db.JoinWaitlist(ctx, database, teacherID, classID, u.ID, childID, days); err != nil {
+			observability.CaptureErr(err)
+			_ = sendCb(bot, cb, "Не удалось встать в очередь")
+			return true
+		}
+		edit(fmt.Sprintf("✅ Вы в листе ожидания: %s, %s.\nКогда освободится время, бот пришлёт предложение — "+
+			"на ответ будет %d мин. Выйти из очереди можно в «📋 Мои записи».",
+			teacher.Name, weekdaysLabel(days), int(waitlistOfferTTL/time.Minute)), nil)
+		_ = sendCb(bot, cb, "Готово")
+		// вдруг время уже освободилось, пока родитель выбирал дни
+		offerWaitlistSlotsLogged(ctx, bot, database, teacherID)
+		return true
+
+	case cbWaitlistLeave.Match(cb.Data):
+		entryID, err := cbWaitlistLeave.Parse(cb.Data)
+		if err != nil {
+			return true
+		}
+		teacherID, ok, err := db.LeaveWaitlist(ctx, database, u.ID, entryID)
+		if err != nil {
+			observability.CaptureErr(err)
+			_ = sendCb(bot, cb, "Ошибка")
+			return true
+		}
+		if !ok {
+			_ = sendCb(bot, cb, "Вы уже не в очереди")
+			return true
+		}
+		_ = sendCb(bot, cb, "Вы вышли из листа ожидания")
+		offerWaitlistSlotsLogged(ctx, bot, database, teacherID)
+		return true
+
+	case cbWaitlistSkip.Match(cb.Data):
+		slotID, err := cbWaitlistSkip.Parse(cb.Data)
+		if err != nil {
+			return true
+		}
+		teacherID, ok, err := db.DeclineWaitlistOffer(ctx, database, u.ID, slotID)
+		if err != nil {
+			observability.CaptureErr(err)
+			_ = sendCb(bot, cb, "Ошибка")
+			return true
+		}
+		edit("Хорошо, это время предложим следующему. Вы остаётесь в листе ожидания.", nil)
+		_ = sendCb(bot, cb, "")
+		if ok {
+			offerWaitlistSlotsLogged(ctx, bot, database, teacherID)
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,17 @@
+package app
+
+import "testing"
+
+func TestWaitlistWeekdays(t *testing.T) {
+	// Пн (бит 1) и Ср (бит 3); бит воскресенья в выборе не участвует
+	days := weekdaysFromMask(1<<1 | 1<<3 | 1<<0)
+	if len(days) != 2 || days[0] != 1 || days[1] != 3 {
+		t.Fatalf("неверные дни: %v", days)
+	}
+	if got := weekdaysLabel(days); got != "Пн, Ср" {
+		t.Fatalf("подпись: %q", got)
+	}
+	if got := weekdaysLabel(nil); got != "любой день" {
+		t.Fatalf("пустой выбор: %q", got)
+	}
+}
@@ -0,0 +1,67 @@
+package app
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/backup"
+)
+
+// DBExportPath — эндпоинт выгрузки БД в zip с CSV.
+const DBExportPath = "/export/db.zip"
+
+// NewDBExportHandler отдаёт архив той же выгрузки, что «📦 Выгрузка БД», потоком.
+// Авторизация — заголовок «Authorization: Bearer <DB_EXPORT_TOKEN>».
+// С ключами шифрования архив отдаётся зашифрованным (school_db_….zip.enc).
+func NewDBExportHandler(database *sql.DB, token string, keys *backup.Keyring) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		name := fmt.Sprintf("school_db_%s.zip", time.Now().Format("2006-01-02_1504"))
+		if keys.Enabled() {
+			name += backup.EncryptedExt
+			w.Header().Set("Content-Type", "application/octet-stream")
+		} else {
+			w.Header().Set("Content-Type", "application/zip")
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, name))
+		var out io.Writer = w
+		var enc io.WriteCloser
+		if keys.Enabled() {
+			var err error
+			if enc, err = keys.Encrypt(w); err != nil {
+				log.Println("db export (http):", err)
+				http.Error(w, "export failed", http.StatusInternalServerError)
+				return
+			}
+			out = enc
+		}
+		// архив пишется по мере чтения: после первых байт статус уже не поменять,
+		// поэтому об ошибке на середине говорит только оборванный zip и лог
+		// (у зашифрованного нет последнего куска — расшифровка его не примет)
+		if _, err := backup.WriteZip(r.Context(), database, out); err != nil {
+			log.Println("db export (http):", err)
+			return
+		}
+		if enc != nil {
+			if err := enc.Close(); err != nil {
+				log.Println("db export (http):", err)
+			}
+		}
+	})
+}
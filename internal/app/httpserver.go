@@ -14,6 +14,12 @@ import (
 
 type HTTPServer struct {
 	srv *http.Server
+	mux *http.ServeMux
+}
+
+// Handle добавляет обработчик на уже запущенный сервер (например, вебхук Telegram).
+func (s *HTTPServer) Handle(pattern string, h http.Handler) {
+	s.mux.Handle(pattern, h)
 }
 
 func StartHTTP(ctx context.Context, addr string, db *sql.DB) *HTTPServer {
@@ -129,6 +135,9 @@ func StartHTTP(ctx context.Context, addr string, db *sql.DB) *HTTPServer {
 		cw.Flush()
 	})
 
+	// подписка на консультации в календаре телефона: /calendar/<токен>.ics
+	mux.HandleFunc(CalendarFeedPath, calendarFeedHandler(db))
+
 	srv := &http.Server{Addr: addr, Handler: mux}
 
 	go func() {
@@ -142,5 +151,5 @@ func StartHTTP(ctx context.Context, addr string, db *sql.DB) *HTTPServer {
 		_ = srv.Shutdown(shCtx)
 	}()
 
-	return &HTTPServer{srv: srv}
+	return &HTTPServer{srv: srv, mux: mux}
 }
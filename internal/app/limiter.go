@@ -11,29 +11,6 @@ import (
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
-// ChatLimiter предотвращает одновременный запуск двух сценариев в одном чате.
-type ChatLimiter struct {
-	mu   sync.Mutex
-	byID map[int64]*sync.Mutex
-}
-
-func NewChatLimiter() *ChatLimiter {
-	return &ChatLimiter{byID: make(map[int64]*sync.Mutex)}
-}
-
-func (l *ChatLimiter) lock(chatID int64) func() {
-	l.mu.Lock()
-	m, ok := l.byID[chatID]
-	if !ok {
-		m = &sync.Mutex{}
-		l.byID[chatID] = m
-	}
-	l.mu.Unlock()
-
-	m.Lock()
-	return func() { m.Unlock() }
-}
-
 type rateBucket struct {
 	tokens   float64
 	last     time.Time
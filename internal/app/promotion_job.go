@@ -0,0 +1,61 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/bot/handlers"
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/tg"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// RunScheduledPromotion выполняет запланированный перевод классов, если его дата наступила
+// (по локальному времени школы), и сообщает админам итог. Повторный запуск в тот же день
+// ничего не делает: перевод переходит в статус done.
+func RunScheduledPromotion(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, loc *time.Location) error {
+	now := time.Now().In(loc)
+	sch, err := db.GetScheduledPromotion(ctx, database)
+	if err != nil {
+		return err
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if sch == nil || sch.EffectiveDate.After(today) {
+		return nil
+	}
+
+	// план считаем до перевода: после него ученики уже в новых классах
+	plan, err := db.PlanPromotion(ctx, database)
+	if err != nil {
+		return err
+	}
+	p, err := db.ApplyDuePromotion(ctx, database, now)
+	var text string
+	switch {
+	case errors.Is(err, db.ErrPromotionThisYear):
+		text = "⚠️ Запланированный перевод классов отменён: в этом учебном году перевод уже выполнялся."
+	case err != nil:
+		return err
+	case p == nil:
+		return nil
+	default:
+		text = fmt.Sprintf("🎓 Выполнен запланированный перевод классов (%s).\nПереведено %d, выпущено %d.\n\n%s\n\n"+
+			"Откатить: «🎓 Перевод классов» → «↩️ Откатить последний перевод».",
+			p.EffectiveDate.Format("02.01.2006"), p.Promoted, p.Graduated, handlers.FormatPromotionPlan(plan))
+	}
+
+	ids, err := db.GetAdminTelegramIDs(ctx, database)
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	for _, chatID := range ids {
+		if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, text)); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,80 @@
+package app
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/roster"
+)
+
+// RosterImportPath — эндпоинт импорта списков классов.
+const RosterImportPath = "/import/roster"
+
+// NewRosterImportHandler принимает список класса (.xlsx/.csv) и отвечает Excel-отчётом.
+// Авторизация — заголовок «Authorization: Bearer <ROSTER_IMPORT_TOKEN>».
+// Файл передаётся полем file в multipart/form-data или телом запроса с ?filename=roster.xlsx.
+// Итоги дублируются в заголовках X-Roster-Created / X-Roster-Matched / X-Roster-Rejected.
+func NewRosterImportHandler(database *sql.DB, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, roster.MaxFileSize+1<<20)
+		var (
+			name string
+			body io.Reader
+		)
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			f, hdr, err := r.FormFile("file")
+			if err != nil {
+				http.Error(w, "file field is required", http.StatusBadRequest)
+				return
+			}
+			defer func() { _ = f.Close() }()
+			name, body = hdr.Filename, f
+		} else {
+			name, body = r.URL.Query().Get("filename"), r.Body
+		}
+
+		res, report, err := roster.Import(r.Context(), database, name, body, db.RosterSourceHTTP, nil)
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			switch {
+			case errors.As(err, &maxErr):
+				http.Error(w, "file too large", http.StatusRequestEntityTooLarge)
+			case errors.Is(err, roster.ErrUnsupported), errors.Is(err, roster.ErrEmpty),
+				errors.Is(err, roster.ErrTooManyRows), errors.Is(err, roster.ErrNoColumns):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			default:
+				log.Println("roster import (http):", err)
+				http.Error(w, "import failed", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		w.Header().Set("Content-Disposition",
+			fmt.Sprintf(`attachment; filename="roster_report_%s.xlsx"`, time.Now().Format("2006-01-02_1504")))
+		w.Header().Set("X-Roster-Created", strconv.Itoa(res.Created))
+		w.Header().Set("X-Roster-Matched", strconv.Itoa(res.Matched))
+		w.Header().Set("X-Roster-Rejected", strconv.Itoa(res.Rejected))
+		_, _ = w.Write(report)
+	})
+}
@@ -0,0 +1,338 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/metrics"
+	"github.com/Spok95/telegram-school-bot/internal/models"
+	"github.com/Spok95/telegram-school-bot/internal/tg"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Request — входящее сообщение или колбэк вместе с найденным пользователем.
+type Request struct {
+	Ctx    context.Context
+	Bot    *tgbotapi.BotAPI
+	DB     *sql.DB
+	ChatID int64
+	User   *models.User // nil — пользователь не зарегистрирован
+
+	Msg *tgbotapi.Message       // для текстовых маршрутов
+	CB  *tgbotapi.CallbackQuery // для колбэков
+}
+
+// Role — роль пользователя или "" для незарегистрированного.
+func (r *Request) Role() models.Role {
+	if r.User == nil || r.User.Role == nil {
+		return ""
+	}
+	return *r.User.Role
+}
+
+// Route — точка входа бота: команда, кнопка меню или колбэк.
+type Route struct {
+	Name string
+	Help string // строка для /help; пусто — маршрут служебный и в /help не попадает
+
+	Commands []string // "/add_score" — сравнивается с первым словом сообщения
+	Buttons  []string // точный текст кнопки меню
+	Data     []string // точное значение callback data
+	Prefixes []string // префикс callback data
+
+	Roles     []models.Role // пусто — любой зарегистрированный пользователь
+	AdminOnly bool          // только ADMIN_IDS из конфигурации
+	Public    bool          // доступен и незарегистрированным
+
+	// BeforeStates — команда срабатывает даже посреди активного сценария (/start).
+	BeforeStates bool
+	// Active — маршрут действует, только пока у чата активен сценарий.
+	Active func(chatID int64) bool
+
+	Handle func(r *Request)
+}
+
+func (rt *Route) active(chatID int64) bool {
+	return rt.Active == nil || rt.Active(chatID)
+}
+
+// allowed — проверка доступа по регистрации и роли (активность проверяется раньше, в Router).
+func (rt *Route) allowed(r *Request) bool {
+	if rt.Public {
+		return true
+	}
+	if r.Role() == "" {
+		return false
+	}
+	if rt.AdminOnly && !db.IsAdminID(r.ChatID) {
+		return false
+	}
+	if len(rt.Roles) == 0 {
+		return true
+	}
+	for _, role := range rt.Roles {
+		if role == r.Role() {
+			return true
+		}
+	}
+	return false
+}
+
+// Router — таблица маршрутов вместо цепочки if/switch в диспетчере.
+// Порядок обработки текста: команды BeforeStates → активные сценарии (AddState) →
+// команды и кнопки (Add) → сценарии-«добивки» (AddFallback). Колбэки: точное
+// совпадение data важнее префикса, длинный префикс важнее короткого,
+// маршрут с активным сценарием важнее маршрута без условия.
+type Router struct {
+	routes    []*Route
+	states    []*Route
+	fallbacks []*Route
+}
+
+func NewRouter() *Router { return &Router{} }
+
+// Add регистрирует команду/кнопку/колбэк.
+func (rr *Router) Add(rt Route) { rr.routes = append(rr.routes, &rt) }
+
+// AddState регистрирует сценарий, который забирает любой текст, пока Active(chatID) == true.
+func (rr *Router) AddState(rt Route) { rr.states = append(rr.states, &rt) }
+
+// AddFallback — как AddState, но проверяется после команд и кнопок.
+func (rr *Router) AddFallback(rt Route) { rr.fallbacks = append(rr.fallbacks, &rt) }
+
+// Routes возвращает зарегистрированные команды, кнопки и колбэки (для /help и тестов).
+func (rr *Router) Routes() []Route {
+	out := make([]Route, 0, len(rr.routes))
+	for _, rt := range rr.routes {
+		out = append(out, *rt)
+	}
+	return out
+}
+
+// commandOf — первое слово сообщения без @botname.
+func commandOf(text string) string {
+	f := strings.Fields(text)
+	if len(f) == 0 || !strings.HasPrefix(f[0], "/") {
+		return ""
+	}
+	cmd, _, _ := strings.Cut(f[0], "@")
+	return cmd
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (rr *Router) matchText(text string, chatID int64, beforeStates bool) *Route {
+	cmd := commandOf(text)
+	var found *Route
+	for _, rt := range rr.routes {
+		if rt.BeforeStates != beforeStates || !rt.active(chatID) {
+			continue
+		}
+		if (cmd != "" && contains(rt.Commands, cmd)) || contains(rt.Buttons, text) {
+			if rt.Active != nil {
+				return rt
+			}
+			if found == nil {
+				found = rt
+			}
+		}
+	}
+	return found
+}
+
+func (rr *Router) matchCallback(data string, chatID int64) *Route {
+	var best *Route
+	bestScore := -1
+	for _, rt := range rr.routes {
+		if !rt.active(chatID) {
+			continue
+		}
+		score := -1
+		if contains(rt.Data, data) {
+			score = 1 << 16
+		}
+		for _, p := range rt.Prefixes {
+			if strings.HasPrefix(data, p) && len(p) > score {
+				score = len(p)
+			}
+		}
+		if score < 0 {
+			continue
+		}
+		if rt.Active != nil {
+			score += 1 << 20
+		}
+		if score > bestScore {
+			best, bestScore = rt, score
+		}
+	}
+	return best
+}
+
+func (rr *Router) firstActive(list []*Route, r *Request) *Route {
+	for _, rt := range list {
+		if rt.active(r.ChatID) && rt.allowed(r) {
+			return rt
+		}
+	}
+	return nil
+}
+
+// HandleMessage маршрутизирует текстовое сообщение.
+func (rr *Router) HandleMessage(r *Request) {
+	if !rr.checkActiveUser(r) {
+		return
+	}
+	text := r.Msg.Text
+
+	if rt := rr.matchText(text, r.ChatID, true); rt != nil {
+		rr.run(rt, r)
+		return
+	}
+	if rt := rr.firstActive(rr.states, r); rt != nil {
+		rt.Handle(r)
+		return
+	}
+	if rt := rr.matchText(text, r.ChatID, false); rt != nil {
+		rr.run(rt, r)
+		return
+	}
+	if rt := rr.firstActive(rr.fallbacks, r); rt != nil {
+		rt.Handle(r)
+		return
+	}
+
+	if r.Role() == "" {
+		reply(r.Bot, r.ChatID, msgNotRegistered)
+		return
+	}
+	reply(r.Bot, r.ChatID, msgUnknownCommand)
+}
+
+// HandleCallback маршрутизирует нажатие inline-кнопки.
+func (rr *Router) HandleCallback(r *Request) {
+	if !rr.checkActiveUser(r) {
+		return
+	}
+	rt := rr.matchCallback(r.CB.Data, r.ChatID)
+	if rt == nil {
+		reply(r.Bot, r.ChatID, msgUnknownCommand)
+		return
+	}
+	rr.run(rt, r)
+}
+
+func (rr *Router) run(rt *Route, r *Request) {
+	if !rt.allowed(r) {
+		if r.Role() == "" {
+			reply(r.Bot, r.ChatID, msgNotRegistered)
+		} else {
+			reply(r.Bot, r.ChatID, msgRoleDenied)
+		}
+		return
+	}
+	rt.Handle(r)
+}
+
+// checkActiveUser — единая защёлка: неактивным пользователям бот недоступен.
+func (rr *Router) checkActiveUser(r *Request) bool {
+	if r.User == nil || r.User.IsActive {
+		return true
+	}
+	rm := tgbotapi.NewMessage(r.ChatID, msgInactive)
+	// на случай, если у пользователя осталась старая клавиатура — уберём
+	rm.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
+	if _, err := tg.Send(r.Bot, rm); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+	return false
+}
+
+// HelpText — список доступных пользователю команд и кнопок.
+func (rr *Router) HelpText(r *Request) string {
+	var lines []string
+	for _, rt := range rr.routes {
+		if rt.Help == "" || rt.Active != nil || !rt.allowed(r) {
+			continue
+		}
+		keys := append(append([]string(nil), rt.Commands...), rt.Buttons...)
+		if len(keys) == 0 {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("• %s — %s", strings.Join(keys, ", "), rt.Help))
+	}
+	if len(lines) == 0 {
+		return "Доступных команд нет. Нажмите /start."
+	}
+	return "Доступные команды:\n" + strings.Join(lines, "\n")
+}
+
+// Conflicts ищет маршруты, которые претендуют на одни и те же апдейты:
+// одинаковые команды/кнопки/data и префиксы, перекрывающие чужие префиксы или data.
+// Маршрут с Active и маршрут без условия конфликтом не считаются — первый намеренно
+// перехватывает апдейты, пока активен сценарий.
+func (rr *Router) Conflicts() []string {
+	var out []string
+	for i, a := range rr.routes {
+		for _, b := range rr.routes[i+1:] {
+			if (a.Active == nil) != (b.Active == nil) {
+				continue
+			}
+			pair := a.Name + " / " + b.Name
+			for _, k := range a.Commands {
+				if contains(b.Commands, k) {
+					out = append(out, fmt.Sprintf("%s: команда %q", pair, k))
+				}
+			}
+			for _, k := range a.Buttons {
+				if contains(b.Buttons, k) {
+					out = append(out, fmt.Sprintf("%s: кнопка %q", pair, k))
+				}
+			}
+			for _, k := range a.Data {
+				if contains(b.Data, k) {
+					out = append(out, fmt.Sprintf("%s: data %q", pair, k))
+				}
+			}
+			out = append(out, prefixConflicts(pair, a, b)...)
+			out = append(out, prefixConflicts(pair, b, a)...)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func prefixConflicts(pair string, a, b *Route) []string {
+	var out []string
+	for _, p := range a.Prefixes {
+		for _, q := range b.Prefixes {
+			if strings.HasPrefix(q, p) {
+				out = append(out, fmt.Sprintf("%s: префикс %q перекрывает %q", pair, p, q))
+			}
+		}
+		for _, d := range b.Data {
+			if strings.HasPrefix(d, p) {
+				out = append(out, fmt.Sprintf("%s: префикс %q перекрывает data %q", pair, p, d))
+			}
+		}
+	}
+	return out
+}
+
+const (
+	msgNotRegistered  = "⚠️ Вы не зарегистрированы. Пожалуйста, нажмите /start для начала."
+	msgUnknownCommand = "⚠️ Неизвестная команда. Используйте /start"
+	msgRoleDenied     = "Недоступно для вашей роли."
+	msgInactive       = "🚫 Доступ к боту временно закрыт. Обратитесь к администратору."
+)
@@ -0,0 +1,105 @@
+package app
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Spok95/telegram-school-bot/internal/models"
+)
+
+func TestBotRouter_NoAmbiguousRoutes(t *testing.T) {
+	if c := newBotRouter().Conflicts(); len(c) > 0 {
+		t.Fatalf("неоднозначные маршруты:\n%s", strings.Join(c, "\n"))
+	}
+}
+
+func TestBotRouter_RoutesAreComplete(t *testing.T) {
+	for _, rt := range newBotRouter().Routes() {
+		if rt.Name == "" || rt.Handle == nil {
+			t.Fatalf("маршрут без имени или обработчика: %+v", rt)
+		}
+		if len(rt.Commands)+len(rt.Buttons)+len(rt.Data)+len(rt.Prefixes) == 0 {
+			t.Fatalf("маршрут %q ни на что не реагирует", rt.Name)
+		}
+	}
+}
+
+func TestRouter_ConflictsDetected(t *testing.T) {
+	noop := func(*Request) {}
+	rr := NewRouter()
+	rr.Add(Route{Name: "a", Prefixes: []string{"exp_"}, Commands: []string{"/x"}, Handle: noop})
+	rr.Add(Route{Name: "b", Prefixes: []string{"exp_users_"}, Handle: noop})
+	rr.Add(Route{Name: "c", Data: []string{"exp_done"}, Commands: []string{"/x"}, Handle: noop})
+	// маршрут сценария намеренно перекрывает обычный — это не конфликт
+	rr.Add(Route{Name: "d", Prefixes: []string{"exp_"}, Active: func(int64) bool { return true }, Handle: noop})
+
+	c := rr.Conflicts()
+	want := []string{
+		`a / b: префикс "exp_" перекрывает "exp_users_"`,
+		`a / c: команда "/x"`,
+		`a / c: префикс "exp_" перекрывает data "exp_done"`,
+	}
+	if strings.Join(c, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("ожидали конфликты:\n%s\nполучили:\n%s", strings.Join(want, "\n"), strings.Join(c, "\n"))
+	}
+}
+
+func TestRouter_CallbackPrecedence(t *testing.T) {
+	noop := func(*Request) {}
+	active := false
+	rr := NewRouter()
+	rr.Add(Route{Name: "short", Prefixes: []string{"x_"}, Handle: noop})
+	rr.Add(Route{Name: "long", Prefixes: []string{"x_long_"}, Handle: noop})
+	rr.Add(Route{Name: "exact", Data: []string{"x_long_done"}, Handle: noop})
+	rr.Add(Route{Name: "state", Prefixes: []string{"x_"}, Active: func(int64) bool { return active }, Handle: noop})
+
+	cases := map[string]string{
+		"x_1":         "short",
+		"x_long_1":    "long",
+		"x_long_done": "exact",
+	}
+	for data, want := range cases {
+		if got := rr.matchCallback(data, 1); got == nil || got.Name != want {
+			t.Fatalf("%q: ожидали %q, получили %+v", data, want, got)
+		}
+	}
+	if rr.matchCallback("y_1", 1) != nil {
+		t.Fatal("неизвестный колбэк не должен находить маршрут")
+	}
+
+	active = true
+	if got := rr.matchCallback("x_long_done", 1); got == nil || got.Name != "state" {
+		t.Fatalf("активный сценарий должен перехватывать колбэк, получили %+v", got)
+	}
+}
+
+func TestRouter_TextMatchAndAccess(t *testing.T) {
+	noop := func(*Request) {}
+	rr := NewRouter()
+	rr.Add(Route{Name: "slots", Commands: []string{"/p_slots"}, Roles: []models.Role{models.Parent}, Help: "слоты", Handle: noop})
+	rr.Add(Route{Name: "menu", Buttons: []string{"📅 Периоды"}, Roles: []models.Role{models.Admin}, Help: "периоды", Handle: noop})
+	rr.Add(Route{Name: "start", Commands: []string{"/start"}, Public: true, BeforeStates: true, Help: "старт", Handle: noop})
+
+	if got := rr.matchText("/p_slots@school_bot 12 2025-09-01", 1, false); got == nil || got.Name != "slots" {
+		t.Fatalf("команда с аргументами и @bot не распознана: %+v", got)
+	}
+	if got := rr.matchText("📅 Периоды", 1, false); got == nil || got.Name != "menu" {
+		t.Fatalf("кнопка меню не распознана: %+v", got)
+	}
+	if rr.matchText("/start", 1, false) != nil || rr.matchText("/start", 1, true) == nil {
+		t.Fatal("/start должен матчиться только на этапе BeforeStates")
+	}
+
+	role := models.Parent
+	parentReq := &Request{ChatID: 1, User: &models.User{Role: &role, IsActive: true}}
+	help := rr.HelpText(parentReq)
+	if !strings.Contains(help, "/p_slots") || strings.Contains(help, "Периоды") {
+		t.Fatalf("/help должен показывать только доступные роли маршруты:\n%s", help)
+	}
+	if rr.routes[1].allowed(parentReq) {
+		t.Fatal("родителю не должен быть доступен админский маршрут")
+	}
+	if rr.routes[0].allowed(&Request{ChatID: 1}) || !rr.routes[2].allowed(&Request{ChatID: 1}) {
+		t.Fatal("незарегистрированному доступны только публичные маршруты")
+	}
+}
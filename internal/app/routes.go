@@ -0,0 +1,636 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/bot/auth"
+	"github.com/Spok95/telegram-school-bot/internal/bot/handlers"
+	"github.com/Spok95/telegram-school-bot/internal/models"
+)
+
+var (
+	staff      = []models.Role{models.Admin, models.Administration}
+	adminOnly  = []models.Role{models.Admin}
+	teacher    = []models.Role{models.Teacher}
+	parent     = []models.Role{models.Parent}
+	studParent = []models.Role{models.Student, models.Parent}
+	teachPar   = []models.Role{models.Teacher, models.Parent}
+)
+
+// router — все точки входа бота. Новая функция = новая запись в newBotRouter.
+// Заполняется в init: обработчик /help сам обращается к router.
+var router *Router
+
+func init() { router = newBotRouter() }
+
+func newBotRouter() *Router {
+	rr := NewRouter()
+
+	// ===== Без регистрации =====
+	rr.Add(Route{
+		Name: "start", Commands: []string{"/start"}, Public: true, BeforeStates: true,
+		Help:   "главное меню / регистрация",
+		Handle: handleStart,
+	})
+	rr.Add(Route{
+		Name: "help", Commands: []string{"/help"}, Public: true, BeforeStates: true,
+		Help: "список команд",
+		Handle: func(r *Request) {
+			reply(r.Bot, r.ChatID, router.HelpText(r))
+		},
+	})
+	rr.Add(Route{
+		Name: "registration", Prefixes: []string{"reg_"}, Public: true,
+		Handle: handleRegistrationRole,
+	})
+	rr.Add(Route{
+		Name: "student_registration", Public: true,
+		Prefixes: []string{"student_class_num_", "student_class_letter_"},
+		Data:     []string{"student_back", "student_cancel"},
+		Handle: func(r *Request) {
+			auth.HandleStudentCallback(r.Ctx, r.CB, r.Bot, r.DB)
+		},
+	})
+	rr.Add(Route{
+		Name: "parent_registration", Public: true,
+		Prefixes: []string{"parent_class_num_", "parent_class_letter_"},
+		Data:     []string{"parent_back", "parent_cancel"},
+		Handle: func(r *Request) {
+			auth.HandleParentCallback(r.Ctx, r.Bot, r.DB, r.CB)
+		},
+	})
+
+	// ===== Активные сценарии: забирают любой текст =====
+	rr.AddState(Route{Name: "add_score", Active: func(id int64) bool { return handlers.GetAddScoreState(id) != nil },
+		Handle: func(r *Request) { handlers.HandleAddScoreText(r.Ctx, r.Bot, r.Msg) }})
+	rr.AddState(Route{Name: "remove_score", Active: func(id int64) bool { return handlers.GetRemoveScoreState(id) != nil },
+		Handle: func(r *Request) { handlers.HandleRemoveText(r.Ctx, r.Bot, r.DB, r.Msg) }})
+	rr.AddState(Route{Name: "set_period", Active: func(id int64) bool { return handlers.GetSetPeriodState(id) != nil },
+		Handle: func(r *Request) { handlers.HandleSetPeriodInput(r.Ctx, r.Bot, r.Msg) }})
+	rr.AddState(Route{Name: "auction", Active: func(id int64) bool { return handlers.GetAuctionState(id) != nil },
+		Handle: func(r *Request) { handlers.HandleAuctionText(r.Ctx, r.Bot, r.DB, r.Msg) }})
+	rr.AddState(Route{Name: "export", Active: func(id int64) bool { return handlers.GetExportState(id) != nil },
+		Handle: func(r *Request) { handlers.HandleExportText(r.Ctx, r.Bot, r.DB, r.Msg) }})
+	rr.AddState(Route{Name: "admin_users", Active: func(id int64) bool { return handlers.GetAdminUsersState(id) != nil },
+		Handle: func(r *Request) { handlers.HandleAdminUsersText(r.Ctx, r.Bot, r.DB, r.Msg) }})
+	rr.AddState(Route{Name: "catalog", Active: func(id int64) bool { return handlers.GetCatalogState(id) != nil },
+		Handle: func(r *Request) { handlers.HandleCatalogText(r.Ctx, r.Bot, r.DB, r.Msg) }})
+	rr.AddState(Route{Name: "score_fix", Roles: staff, Active: handlers.ScoreFixTextActive,
+		Handle: func(r *Request) { handlers.HandleScoreFixText(r.Ctx, r.Bot, r.DB, r.Msg) }})
+	rr.AddState(Route{Name: "promotion", Active: handlers.PromotionAwaitsDate,
+		Handle: func(r *Request) { handlers.HandlePromotionText(r.Ctx, r.Bot, r.DB, r.Msg) }})
+	rr.AddState(Route{Name: "invite_registration", Public: true, Active: auth.InviteFSMActive,
+		Handle: func(r *Request) { auth.HandleInviteFSM(r.Ctx, r.Bot, r.DB, r.Msg) }})
+	rr.AddState(Route{Name: "roster_import", Roles: adminOnly, Active: handlers.RosterImportActive,
+		Handle: func(r *Request) { handlers.HandleRosterImportMessage(r.Ctx, r.Bot, r.DB, r.Msg) }})
+	rr.AddState(Route{Name: "holidays", Roles: adminOnly, Active: handlers.HolidaysAwaitInput,
+		Handle: func(r *Request) { handlers.HandleHolidaysInput(r.Ctx, r.Bot, r.DB, r.Msg) }})
+	rr.AddState(Route{Name: "add_child", Active: func(id int64) bool { return auth.GetAddChildFSMState(id) != "" },
+		Handle: func(r *Request) { auth.HandleAddChildText(r.Ctx, r.Bot, r.DB, r.Msg) }})
+	rr.AddState(Route{Name: "teacher_link", Roles: teacher, Active: func(id int64) bool { _, ok := getTeacherLinkFSM(id); return ok },
+		Handle: func(r *Request) { TryHandleTeacherLinkText(r.Ctx, r.Bot, r.DB, r.Msg) }})
+	rr.AddState(Route{Name: "teacher_slots", Active: teacherSlotsTextActive,
+		Handle: func(r *Request) { TryHandleTeacherSlotsText(r.Ctx, r.Bot, r.DB, r.Msg) }})
+	rr.AddState(Route{Name: "teacher_templates", Roles: teacher, Active: teacherTemplatesTextActive,
+		Handle: func(r *Request) { HandleTeacherTemplatesText(r.Ctx, r.Bot, r.DB, r.Msg) }})
+	rr.AddState(Route{Name: "broadcast", Roles: staff, Active: handlers.BroadcastAwaitsInput,
+		Handle: func(r *Request) { handlers.HandleBroadcastInput(r.Ctx, r.Bot, r.DB, r.User, r.Msg) }})
+	rr.AddState(Route{Name: "notify_settings", Active: handlers.NotifySettingsAwaitsText,
+		Handle: func(r *Request) { handlers.HandleNotifySettingsText(r.Ctx, r.Bot, r.DB, r.User, r.Msg) }})
+
+	// ===== Баллы =====
+	rr.Add(Route{
+		Name: "add_score", Commands: []string{"/add_score"}, Buttons: []string{"➕ Начислить баллы"},
+		Help: "начислить баллы",
+		Handle: func(r *Request) {
+			handlers.StartAddScoreFSM(r.Ctx, r.Bot, r.DB, r.Msg)
+		},
+	})
+	rr.Add(Route{
+		Name:     "add_score_cb",
+		Prefixes: []string{"add_score_", "add_class_", "add_confirm:"},
+		Data:     []string{"add_comment", "add_students_done", "add_select_all_students", "add_back", "add_cancel"},
+		Handle: func(r *Request) {
+			handlers.HandleAddScoreCallback(r.Ctx, r.Bot, r.DB, r.CB)
+		},
+	})
+	rr.Add(Route{
+		Name: "remove_score", Commands: []string{"/remove_score"}, Buttons: []string{"📉 Списать баллы"},
+		Help: "списать баллы",
+		Handle: func(r *Request) {
+			handlers.StartRemoveScoreFSM(r.Ctx, r.Bot, r.DB, r.Msg)
+		},
+	})
+	rr.Add(Route{
+		Name:     "remove_score_cb",
+		Prefixes: []string{"remove_category_", "remove_level_", "remove_class_", "remove_score_", "remove_student_"},
+		Data:     []string{"remove_students_done", "remove_select_all_students", "remove_back", "remove_cancel"},
+		Handle: func(r *Request) {
+			handlers.HandleRemoveCallback(r.Ctx, r.Bot, r.DB, r.CB)
+		},
+	})
+	rr.Add(Route{
+		Name: "my_score", Commands: []string{"/my_score"}, Buttons: []string{"📊 Мой рейтинг"},
+		Help: "мой рейтинг",
+		Handle: func(r *Request) {
+			handlers.HandleMyScore(r.Ctx, r.Bot, r.DB, r.Msg)
+		},
+	})
+	rr.Add(Route{
+		Name: "history_excel", Buttons: []string{"📜 История получения баллов"}, Roles: studParent,
+		Help:   "история начислений в Excel",
+		Handle: handleHistoryExcel,
+	})
+	rr.Add(Route{
+		Name: "history_excel_cb", Prefixes: []string{"hist_excel_student_"},
+		Handle: func(r *Request) {
+			handlers.HandleHistoryExcelCallback(r.Ctx, r.Bot, r.DB, r.CB)
+		},
+	})
+	rr.Add(Route{
+		Name: "approvals", Commands: []string{"/approvals"}, Buttons: []string{"📥 Заявки на баллы"}, Roles: staff,
+		Help: "заявки на баллы",
+		Handle: func(r *Request) {
+			handlers.ShowPendingScores(r.Ctx, r.Bot, r.DB, r.ChatID)
+		},
+	})
+	rr.Add(Route{
+		Name: "score_approval", Prefixes: []string{"score_confirm_", "score_reject_"},
+		Handle: func(r *Request) {
+			handlers.HandleScoreApprovalCallback(r.Ctx, r.CB, r.Bot, r.DB, r.ChatID)
+		},
+	})
+	rr.Add(Route{
+		Name: "score_fix", Buttons: []string{"📝 Исправить начисление"}, Roles: staff,
+		Help: "отменить или исправить подтверждённое начисление",
+		Handle: func(r *Request) {
+			handlers.StartScoreFixFSM(r.Ctx, r.Bot, r.Msg)
+		},
+	})
+	rr.Add(Route{
+		Name: "score_fix_cb", Prefixes: []string{"scorefix_"}, Roles: staff,
+		Handle: func(r *Request) {
+			handlers.HandleScoreFixCallback(r.Ctx, r.Bot, r.DB, r.CB)
+		},
+	})
+	rr.Add(Route{
+		Name: "auction", Commands: []string{"/auction"}, Buttons: []string{"🎯 Аукцион"}, Roles: staff,
+		Help: "аукцион",
+		Handle: func(r *Request) {
+			handlers.StartAuctionFSM(r.Ctx, r.Bot, r.DB, r.Msg)
+		},
+	})
+	rr.Add(Route{
+		Name:     "auction_cb",
+		Prefixes: []string{"auction_mode_", "auction_class_number_", "auction_class_letter_", "auction_select_student_"},
+		Data:     []string{"auction_students_done", "auction_back", "auction_cancel"},
+		Handle: func(r *Request) {
+			handlers.HandleAuctionCallback(r.Ctx, r.Bot, r.DB, r.CB)
+		},
+	})
+
+	// ===== Родитель и дети =====
+	rr.Add(Route{
+		Name: "add_child", Buttons: []string{"➕ Добавить ребёнка"},
+		Help: "привязать ещё одного ребёнка",
+		Handle: func(r *Request) {
+			auth.StartAddChild(r.Ctx, r.Bot, r.Msg)
+		},
+	})
+	rr.Add(Route{
+		Name: "add_child_cb", Active: func(id int64) bool { return auth.GetAddChildFSMState(id) != "" },
+		Prefixes: []string{"parent_class_num_", "parent_class_letter_"},
+		Data:     []string{"add_child_back", "add_child_cancel"},
+		Handle: func(r *Request) {
+			auth.HandleAddChildCallback(r.Ctx, r.Bot, r.DB, r.CB)
+		},
+	})
+	rr.Add(Route{
+		Name: "add_another_child", Data: []string{"add_another_child_yes", "add_another_child_no"},
+		Handle: handleAddAnotherChild,
+	})
+	rr.Add(Route{
+		Name: "child_rating", Buttons: []string{"📊 Рейтинг ребёнка"}, Roles: parent,
+		Help: "рейтинг ребёнка",
+		Handle: func(r *Request) {
+			handlers.HandleParentRatingRequest(r.Ctx, r.Bot, r.DB, r.ChatID, r.User.ID)
+		},
+	})
+	rr.Add(Route{
+		Name: "child_rating_cb", Prefixes: []string{"show_rating_student_"},
+		Handle: handleShowStudentRating,
+	})
+	rr.Add(Route{
+		Name: "notify_settings", Buttons: []string{"⚙️ Настройки"},
+		Help: "уведомления и тихие часы",
+		Handle: func(r *Request) {
+			handlers.HandleNotifySettings(r.Ctx, r.Bot, r.DB, r.User, r.ChatID)
+		},
+	})
+	rr.Add(Route{
+		Name: "notify_settings_cb", Prefixes: []string{"ns_"},
+		Handle: func(r *Request) {
+			handlers.HandleNotifySettingsCallback(r.Ctx, r.Bot, r.DB, r.User, r.CB)
+		},
+	})
+	rr.Add(Route{
+		Name: "broadcasts", Buttons: []string{"📨 Рассылки"}, Roles: staff,
+		Help: "рассылки по классам, параллелям и ролям",
+		Handle: func(r *Request) {
+			handlers.HandleBroadcasts(r.Ctx, r.Bot, r.DB, r.ChatID)
+		},
+	})
+	rr.Add(Route{
+		Name: "broadcasts_cb", Prefixes: []string{"bc_"}, Roles: staff,
+		Handle: func(r *Request) {
+			handlers.HandleBroadcastCallback(r.Ctx, r.Bot, r.DB, r.User, r.CB)
+		},
+	})
+	rr.Add(Route{
+		Name: "leaderboard", Buttons: []string{"🏆 Рейтинг"},
+		Help: "рейтинг учеников и классов",
+		Handle: func(r *Request) {
+			handlers.HandleLeaderboard(r.Ctx, r.Bot, r.DB, r.User, r.ChatID)
+		},
+	})
+	rr.Add(Route{
+		Name: "leaderboard_cb", Prefixes: []string{"lb_"},
+		Handle: func(r *Request) {
+			handlers.HandleLeaderboardCallback(r.Ctx, r.Bot, r.DB, r.User, r.CB)
+		},
+	})
+
+	// ===== Администрирование =====
+	rr.Add(Route{
+		Name: "pending_users", Buttons: []string{"📥 Заявки на авторизацию"}, AdminOnly: true,
+		Help: "заявки на регистрацию и привязку детей",
+		Handle: func(r *Request) {
+			handlers.ShowPendingUsers(r.Ctx, r.Bot, r.DB, r.ChatID)
+			handlers.ShowPendingParentLinks(r.Ctx, r.Bot, r.DB, r.ChatID)
+		},
+	})
+	rr.Add(Route{
+		Name: "user_approval", Prefixes: []string{"confirm_", "reject_"},
+		Handle: func(r *Request) {
+			handlers.HandleAdminCallback(r.Ctx, r.CB, r.DB, r.Bot, r.ChatID)
+		},
+	})
+	rr.Add(Route{
+		Name: "parent_link_approval", Prefixes: []string{"link_confirm_", "link_reject_"},
+		Handle: func(r *Request) {
+			handlers.HandleParentLinkApprovalCallback(r.Ctx, r.CB, r.Bot, r.DB)
+		},
+	})
+	rr.Add(Route{
+		Name: "periods", Commands: []string{"/periods"}, Buttons: []string{"📅 Периоды"}, Roles: adminOnly,
+		Help: "учебные периоды",
+		Handle: func(r *Request) {
+			handlers.StartAdminPeriods(r.Ctx, r.Bot, r.DB, r.Msg)
+		},
+	})
+	rr.Add(Route{
+		Name: "periods_cb", Prefixes: []string{"peradm_"}, Roles: adminOnly,
+		Handle: handleAdminPeriodsCallback,
+	})
+	rr.Add(Route{
+		Name: "set_period_cb", Prefixes: []string{"per_"},
+		Handle: func(r *Request) {
+			handlers.HandleSetPeriodCallback(r.Ctx, r.Bot, r.DB, r.CB)
+		},
+	})
+	rr.Add(Route{
+		Name: "export", Commands: []string{"/export"}, Buttons: []string{"📥 Экспорт отчёта"}, Roles: staff,
+		Help: "экспорт отчёта в Excel",
+		Handle: func(r *Request) {
+			// долгая операция: свой таймаут, порядок в чате гарантирует пул воркеров
+			bg, cancel := context.WithTimeout(context.WithoutCancel(r.Ctx), 2*time.Minute)
+			defer cancel()
+			handlers.StartExportFSM(bg, r.Bot, r.DB, r.Msg)
+		},
+	})
+	rr.Add(Route{
+		Name: "export_cb",
+		Prefixes: []string{"export_type_", "export_period_", "export_mode_", "export_class_number_",
+			"export_class_letter_", "export_select_student_", "export_schoolyear_"},
+		Data: []string{"export_students_done", "export_back", "export_cancel"},
+		Handle: func(r *Request) {
+			handlers.HandleExportCallback(r.Ctx, r.Bot, r.DB, r.CB)
+		},
+	})
+	rr.Add(Route{
+		Name: "export_users_cb", Prefixes: []string{"exp_users_"}, Roles: staff,
+		Handle: handleExportUsersCallback,
+	})
+	rr.Add(Route{
+		Name: "admin_users", Buttons: []string{"👥 Пользователи"}, Roles: adminOnly,
+		Help: "пользователи",
+		Handle: func(r *Request) {
+			handlers.StartAdminUsersFSM(r.Ctx, r.Bot, r.Msg)
+		},
+	})
+	rr.Add(Route{
+		Name: "admin_users_cb", Prefixes: []string{"admusr_"}, Roles: adminOnly,
+		Handle: func(r *Request) {
+			handlers.HandleAdminUsersCallback(r.Ctx, r.Bot, r.DB, r.CB)
+		},
+	})
+	rr.Add(Route{
+		Name: "catalog", Buttons: []string{"🗂 Справочники"}, Roles: adminOnly,
+		Help: "справочники",
+		Handle: func(r *Request) {
+			handlers.StartCatalogFSM(r.Ctx, r.Bot, r.DB, r.Msg)
+		},
+	})
+	rr.Add(Route{
+		Name: "catalog_cb", Prefixes: []string{"catalog_"}, Roles: adminOnly,
+		Handle: func(r *Request) {
+			handlers.HandleCatalogCallback(r.Ctx, r.Bot, r.DB, r.CB)
+		},
+	})
+	rr.Add(Route{
+		Name: "promotion", Buttons: []string{"🎓 Перевод классов"}, Roles: adminOnly,
+		Help: "перевод учеников в следующий класс",
+		Handle: func(r *Request) {
+			handlers.StartPromotionFSM(r.Ctx, r.Bot, r.DB, r.Msg)
+		},
+	})
+	rr.Add(Route{
+		Name: "promotion_cb", Prefixes: []string{"promo_"}, Roles: adminOnly,
+		Handle: func(r *Request) {
+			handlers.HandlePromotionCallback(r.Ctx, r.Bot, r.DB, r.CB)
+		},
+	})
+	rr.Add(Route{
+		Name: "reconcile", Commands: []string{"/reconcile"}, Roles: adminOnly,
+		Help: "сверка коллективного рейтинга с журналом начислений",
+		Handle: func(r *Request) {
+			handlers.HandleReconcileCollective(r.Ctx, r.Bot, r.DB, r.ChatID)
+		},
+	})
+	rr.Add(Route{
+		Name: "reconcile_cb", Data: []string{"reconcile_fix", "reconcile_cancel"}, Roles: adminOnly,
+		Handle: func(r *Request) {
+			handlers.HandleReconcileCallback(r.Ctx, r.Bot, r.DB, r.CB)
+		},
+	})
+	rr.Add(Route{
+		Name: "invites", Buttons: []string{"🎟 Приглашения"}, Roles: adminOnly,
+		Help: "коды и QR-листы для регистрации без подтверждения",
+		Handle: func(r *Request) {
+			handlers.StartInviteAdmin(r.Ctx, r.Bot, r.Msg)
+		},
+	})
+	rr.Add(Route{
+		Name: "invites_cb", Prefixes: []string{"invite_"}, Roles: adminOnly,
+		Handle: func(r *Request) {
+			handlers.HandleInviteAdminCallback(r.Ctx, r.Bot, r.DB, r.CB)
+		},
+	})
+	rr.Add(Route{
+		Name: "roster_import", Buttons: []string{"📋 Импорт списка классов"}, Roles: adminOnly,
+		Help: "импорт учеников и родителей из Excel/CSV",
+		Handle: func(r *Request) {
+			handlers.StartRosterImport(r.Ctx, r.Bot, r.Msg)
+		},
+	})
+	rr.Add(Route{
+		Name: "roster_import_cb", Data: []string{"roster_cancel"}, Roles: adminOnly,
+		Handle: func(r *Request) {
+			handlers.HandleRosterImportCallback(r.Ctx, r.Bot, r.CB)
+		},
+	})
+	rr.Add(Route{
+		Name: "holidays", Buttons: []string{"📆 Каникулы и праздники"}, Roles: adminOnly,
+		Help: "календарь нерабочих дней: без консультаций",
+		Handle: func(r *Request) {
+			handlers.HandleHolidays(r.Ctx, r.Bot, r.DB, r.ChatID)
+		},
+	})
+	rr.Add(Route{
+		Name: "holidays_cb", Data: []string{"hol_add", "hol_del", "hol_cancel", "hol_close"}, Roles: adminOnly,
+		Handle: func(r *Request) {
+			handlers.HandleHolidaysCallback(r.Ctx, r.Bot, r.CB)
+		},
+	})
+	rr.Add(Route{
+		Name: "backup", Commands: []string{"/backup"}, Buttons: []string{"💾 Бэкап БД"}, Roles: adminOnly,
+		Help: "резервная копия БД",
+		Handle: func(r *Request) {
+			bg, cancel := context.WithTimeout(context.WithoutCancel(r.Ctx), 2*time.Minute)
+			defer cancel()
+			handlers.HandleAdminBackup(bg, r.Bot, r.DB, r.ChatID)
+		},
+	})
+	rr.Add(Route{
+		Name: "export_db", Commands: []string{"/export_db"}, Buttons: []string{"📦 Выгрузка БД"}, Roles: adminOnly,
+		Help: "выгрузка БД в zip с CSV (без sidecar)",
+		Handle: func(r *Request) {
+			bg, cancel := context.WithTimeout(context.WithoutCancel(r.Ctx), 5*time.Minute)
+			defer cancel()
+			handlers.HandleAdminExportDB(bg, r.Bot, r.DB, r.ChatID)
+		},
+	})
+	rr.Add(Route{
+		Name: "restore_latest", Buttons: []string{"♻️ Восстановить БД"}, Roles: adminOnly,
+		Help: "каталог бэкапов: выбрать копию и восстановить БД",
+		Handle: func(r *Request) {
+			handlers.HandleBackupCatalog(r.Ctx, r.Bot, r.DB, r.ChatID)
+		},
+	})
+	rr.Add(Route{
+		Name: "backup_catalog_cb", Prefixes: []string{"bk_pick:", "bk_do:", "bk_check:"}, Data: []string{"bk_cancel"},
+		Roles: adminOnly,
+		Handle: func(r *Request) {
+			// пробное восстановление и само восстановление долгие: свой таймаут
+			bg, cancel := context.WithTimeout(context.WithoutCancel(r.Ctx), 15*time.Minute)
+			defer cancel()
+			handlers.HandleBackupCatalogCallback(bg, r.Bot, r.DB, r.CB)
+		},
+	})
+	rr.Add(Route{
+		Name: "backup_latest_cb", Data: []string{handlers.BackupLatestData}, Roles: adminOnly,
+		Handle: handleBackupLatest,
+	})
+	rr.Add(Route{
+		Name: "restore_latest_cb", Data: []string{"restore_latest:yes", "restore_latest:no"}, Roles: adminOnly,
+		Handle: handleRestoreLatestCallback,
+	})
+	rr.Add(Route{
+		Name: "restore_upload", Buttons: []string{"📥 Восстановить из файла"}, Roles: adminOnly,
+		Help: "восстановить БД из файла",
+		Handle: func(r *Request) {
+			bg, cancel := context.WithTimeout(context.WithoutCancel(r.Ctx), 2*time.Minute)
+			defer cancel()
+			handlers.HandleAdminRestoreStart(bg, r.Bot, r.DB, r.ChatID)
+		},
+	})
+	rr.Add(Route{
+		Name: "restore_upload_cb", Data: []string{"restore_cancel"},
+		Handle: func(r *Request) {
+			handlers.HandleAdminRestoreCallback(r.Ctx, r.Bot, r.DB, r.CB)
+		},
+	})
+
+	// ===== Консультации =====
+	rr.Add(Route{
+		Name: "consult_help", Commands: []string{"/consult_help"},
+		Help:   "справка по консультациям",
+		Handle: handleConsultHelp,
+	})
+	rr.Add(Route{
+		Name: "teacher_slots", Commands: []string{"/t_slots"}, Buttons: []string{"🗓 Создать слоты"}, Roles: teacher,
+		Help: "создать слоты консультаций",
+		Handle: func(r *Request) {
+			// кнопка меню эмулирует /t_slots
+			msg := *r.Msg
+			msg.Text = "/t_slots"
+			TryHandleTeacherSlotsCommand(r.Ctx, r.Bot, r.DB, &msg)
+		},
+	})
+	rr.Add(Route{
+		Name: "teacher_slots_cb", Prefixes: []string{"t_slots:"},
+		Handle: func(r *Request) {
+			TryHandleTeacherSlotsCallback(r.Ctx, r.Bot, r.DB, r.CB)
+		},
+	})
+	rr.Add(Route{
+		Name: "teacher_templates", Commands: []string{"/t_templates"}, Buttons: []string{"🔁 Шаблоны расписания"}, Roles: teacher,
+		Help: "еженедельные шаблоны расписания консультаций",
+		Handle: func(r *Request) {
+			HandleTeacherTemplates(r.Ctx, r.Bot, r.DB, r.User.ID, r.ChatID)
+		},
+	})
+	rr.Add(Route{
+		Name: "teacher_templates_cb", Prefixes: []string{"t_tpl:"}, Roles: teacher,
+		Handle: func(r *Request) {
+			HandleTeacherTemplatesCallback(r.Ctx, r.Bot, r.DB, r.User.ID, r.CB)
+		},
+	})
+	rr.Add(Route{
+		Name: "calendar_link", Commands: []string{"/calendar"}, Buttons: []string{"🔗 Календарь на телефоне"},
+		Roles: teachPar,
+		Help:  "ссылка на подписку: консультации в календаре телефона",
+		Handle: func(r *Request) {
+			HandleCalendarLink(r.Ctx, r.Bot, r.DB, r.User.ID, r.ChatID, false)
+		},
+	})
+	rr.Add(Route{
+		Name: "calendar_link_cb", Data: []string{"cal_reset"}, Roles: teachPar,
+		Handle: func(r *Request) {
+			HandleCalendarLink(r.Ctx, r.Bot, r.DB, r.User.ID, r.ChatID, true)
+		},
+	})
+	rr.Add(Route{
+		Name: "teacher_addslots", Commands: []string{"/t_addslots"}, Roles: teacher,
+		Help: "добавить слоты одной командой",
+		Handle: func(r *Request) {
+			TryHandleTeacherAddSlots(r.Ctx, r.Bot, r.DB, r.Msg)
+		},
+	})
+	rr.Add(Route{
+		Name: "teacher_myslots", Commands: []string{"/t_myslots"}, Buttons: []string{"📋 Мои слоты"}, Roles: teacher,
+		Help: "мои слоты",
+		Handle: func(r *Request) {
+			msg := *r.Msg
+			msg.Text = "/t_myslots"
+			TryHandleTeacherMySlots(r.Ctx, r.Bot, r.DB, &msg)
+		},
+	})
+	rr.Add(Route{
+		Name:     "teacher_manage_cb",
+		Prefixes: []string{"t_ms:", "t_link:", "t_del:", "t_cancel:"},
+		Data:     []string{"t_noop"},
+		Handle: func(r *Request) {
+			TryHandleTeacherManageCallback(r.Ctx, r.Bot, r.DB, r.CB)
+		},
+	})
+	rr.Add(Route{
+		Name: "teacher_schedule", Roles: teacher,
+		Buttons: []string{"📘 Расписание", "📘 Мои консультации", "Расписание", "Мои консультации"},
+		Help:    "мои консультации на 2 недели (Excel)",
+		Handle:  handleTeacherConsultReport,
+	})
+	rr.Add(Route{
+		Name: "consult_report", Commands: []string{"/consult_report"}, Buttons: []string{"📈 Отчёт консультаций"}, Roles: staff,
+		Help:   "отчёт по консультациям (Excel)",
+		Handle: handleAdminConsultReport,
+	})
+	rr.Add(Route{
+		Name: "parent_consult", Buttons: []string{"📅 Записаться на консультацию"}, Roles: parent,
+		Help: "записаться на консультацию",
+		Handle: func(r *Request) {
+			StartParentConsultFlow(r.Ctx, r.Bot, r.DB, r.Msg)
+		},
+	})
+	rr.Add(Route{
+		Name:     "parent_flow_cb",
+		Prefixes: []string{"p_flow:cancel", "p_back:teachers", "p_pick_child:", "p_pick_teacher:", "p_pick_date:"},
+		Handle: func(r *Request) {
+			TryHandleParentFlowCallbacks(r.Ctx, r.Bot, r.DB, r.CB)
+		},
+	})
+	rr.Add(Route{
+		Name: "parent_slots", Commands: []string{"/p_slots"}, Roles: parent,
+		Help: "свободные слоты учителя кнопками",
+		Handle: func(r *Request) {
+			TryHandleParentSlotsCommand(r.Ctx, r.Bot, r.DB, r.Msg)
+		},
+	})
+	rr.Add(Route{
+		Name: "parent_cmds", Commands: []string{"/p_free", "/p_book"}, Roles: parent,
+		Help: "свободные слоты списком / запись по ID",
+		Handle: func(r *Request) {
+			TryHandleParentCommands(r.Ctx, r.Bot, r.DB, r.Msg)
+		},
+	})
+	rr.Add(Route{
+		Name: "parent_book_cb", Prefixes: []string{"p_book:"},
+		Handle: func(r *Request) {
+			TryHandleParentBookCallback(r.Ctx, r.Bot, r.DB, r.CB)
+		},
+	})
+	rr.Add(Route{
+		Name: "parent_bookings", Buttons: []string{"📋 Мои записи"}, Roles: parent,
+		Help:   "мои записи на консультации",
+		Handle: handleParentBookings,
+	})
+	rr.Add(Route{
+		Name: "parent_bookings_cb", Data: []string{"p_my_consults"},
+		Handle: func(r *Request) {
+			TryHandleParentMyConsultsCallback(r.Ctx, r.Bot, r.DB, r.CB)
+		},
+	})
+	rr.Add(Route{
+		Name: "parent_cancel_cb", Prefixes: []string{"p_cancel:"},
+		Handle: func(r *Request) {
+			TryHandleParentCancelCallback(r.Ctx, r.Bot, r.DB, r.CB)
+		},
+	})
+	rr.Add(Route{
+		Name:     "parent_waitlist_cb",
+		Prefixes: []string{"p_wl:", "p_wl_t:", "p_wl_ok:", "p_wl_leave:", "p_wl_skip:"},
+		Handle: func(r *Request) {
+			TryHandleParentWaitlistCallback(r.Ctx, r.Bot, r.DB, r.CB)
+		},
+	})
+
+	// ===== После команд =====
+	rr.AddFallback(Route{Name: "admin_periods_text", Roles: adminOnly,
+		Active: func(id int64) bool { _, ok := handlers.PeriodsFSMActive(id); return ok },
+		Handle: func(r *Request) { handlers.HandleAdminPeriodsText(r.Ctx, r.Bot, r.DB, r.Msg) }})
+	// регистрация (и старые сценарии auth для зарегистрированных) — по роли, выбранной в /start
+	rr.AddFallback(Route{Name: "auth_fsm", Public: true,
+		Active: func(id int64) bool { return getUserFSMRole(id) != "" },
+		Handle: func(r *Request) {
+			auth.HandleFSMMessage(r.Ctx, r.ChatID, r.Msg.Text, getUserFSMRole(r.ChatID), r.Bot, r.DB)
+		}})
+
+	return rr
+}
+
+// teacherSlotsTextActive — мастер /t_slots ждёт текст только на шагах 2 (время) и 3 (длительность).
+func teacherSlotsTextActive(chatID int64) bool {
+	st, ok := getTeacherFSM(chatID)
+	return ok && (st.Step == 2 || st.Step == 3)
+}
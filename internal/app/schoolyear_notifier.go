@@ -7,8 +7,7 @@ import (
 	"time"
 
 	"github.com/Spok95/telegram-school-bot/internal/db"
-	"github.com/Spok95/telegram-school-bot/internal/tg"
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/Spok95/telegram-school-bot/internal/notify"
 )
 
 // Дедупликация: чтобы не слать вторично в тот же учебный год
@@ -17,7 +16,7 @@ var lastNotifiedStartYear int
 // RunSchoolYearNotifier выполняет ОДНУ проверку и, если сегодня 1 сентября
 // и уже позже 07:00 локального времени — шлёт уведомление админам.
 // Возвращает первую системную ошибку отправки/БД (для метрики job_errors).
-func RunSchoolYearNotifier(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB) error {
+func RunSchoolYearNotifier(ctx context.Context, database *sql.DB) error {
 	now := time.Now()
 	// 1 сентября после 07:00 локального времени
 	if now.Month() == time.September && now.Day() == 1 && now.Hour() >= 7 {
@@ -39,7 +38,7 @@ func RunSchoolYearNotifier(ctx context.Context, bot *tgbotapi.BotAPI, database *
 
 		var firstErr error
 		for _, chatID := range ids {
-			if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, text)); err != nil && firstErr == nil {
+			if err := notify.Send(ctx, database, chatID, notify.SchoolYear, text); err != nil && firstErr == nil {
 				firstErr = err
 			}
 		}
@@ -0,0 +1,89 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/notify"
+)
+
+// scoreNoticeRecipients — сколько получателей обрабатываем за один запуск.
+const scoreNoticeRecipients = 200
+
+// RunScoreNotifications отправляет накопившиеся уведомления о баллах: каждому получателю —
+// одно сообщение не чаще раза в window. Неотправленное остаётся в очереди до следующего запуска.
+func RunScoreNotifications(ctx context.Context, database *sql.DB, window time.Duration) error {
+	notices, err := db.DueScoreNotices(ctx, database, window, scoreNoticeRecipients)
+	if err != nil {
+		return err
+	}
+	if len(notices) == 0 {
+		return nil
+	}
+
+	balances := map[int64]int{}
+	var firstErr error
+	for start := 0; start < len(notices); {
+		end := start
+		for end < len(notices) && notices[end].UserID == notices[start].UserID {
+			end++
+		}
+		batch := notices[start:end]
+		start = end
+
+		text, err := formatScoreNotices(ctx, database, batch, balances)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if err := notify.Send(ctx, database, batch[0].ChatID, notify.Scores, text); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		ids := make([]int64, len(batch))
+		for i, n := range batch {
+			ids[i] = n.ID
+		}
+		if err := db.MarkScoreNoticesSent(ctx, database, ids); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// formatScoreNotices — текст уведомления: изменения по каждому ученику и его баланс.
+func formatScoreNotices(ctx context.Context, database *sql.DB, batch []db.ScoreNotice, balances map[int64]int) (string, error) {
+	var b strings.Builder
+	b.WriteString("🔔 Изменения баллов")
+	for i, n := range batch {
+		if i == 0 || n.StudentID != batch[i-1].StudentID {
+			fmt.Fprintf(&b, "\n\n👤 %s\n", n.StudentName)
+		}
+		fmt.Fprintf(&b, "%+d — %s", n.Points, n.Category)
+		if n.Comment != nil && strings.TrimSpace(*n.Comment) != "" {
+			fmt.Fprintf(&b, " (%s)", strings.TrimSpace(*n.Comment))
+		}
+		b.WriteString("\n")
+		if i == len(batch)-1 || batch[i+1].StudentID != n.StudentID {
+			bal, ok := balances[n.StudentID]
+			if !ok {
+				var err error
+				if bal, err = db.GetApprovedScoreSum(ctx, database, n.StudentID); err != nil {
+					return "", err
+				}
+				balances[n.StudentID] = bal
+			}
+			fmt.Fprintf(&b, "Баланс: %d", bal)
+		}
+	}
+	b.WriteString("\n\nОтключить уведомления: «⚙️ Настройки».")
+	return b.String(), nil
+}
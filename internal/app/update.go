@@ -0,0 +1,111 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/bot/handlers"
+	"github.com/Spok95/telegram-school-bot/internal/ctxutil"
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/metrics"
+	"github.com/Spok95/telegram-school-bot/internal/tg"
+	"github.com/getsentry/sentry-go"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// updateTimeout — сколько максимум живёт обработка одного апдейта.
+const updateTimeout = 15 * time.Second
+
+// ProcessUpdate — общий конвейер обработки апдейта для polling и webhook:
+// recover-защита, per-update контекст с таймаутом и метаданными, маршрутизация.
+func ProcessUpdate(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, upd tgbotapi.Update) {
+	metrics.BotUpdates.Inc()
+
+	defer func() {
+		if r := recover(); r != nil {
+			sentry.CurrentHub().Recover(r)
+			log.Printf("panic in update %d: %v", upd.UpdateID, r)
+			metrics.HandlerErrors.Inc()
+		}
+	}()
+
+	// формируем per-update контекст с таймаутом и метаданными
+	baseCtx, cancel := ctxutil.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
+	var chatID int64
+	var userID int64
+	op := "update"
+
+	if upd.CallbackQuery != nil {
+		if upd.CallbackQuery.Message != nil && upd.CallbackQuery.Message.Chat != nil {
+			chatID = upd.CallbackQuery.Message.Chat.ID
+		}
+		if upd.CallbackQuery.From != nil {
+			userID = upd.CallbackQuery.From.ID
+		}
+		op = "callback"
+	}
+	if upd.Message != nil {
+		if upd.Message.Chat != nil {
+			chatID = upd.Message.Chat.ID
+		}
+		if upd.Message.From != nil {
+			userID = upd.Message.From.ID
+		}
+		op = "message"
+	}
+
+	// Привязываем метаданные к контексту
+	updCtx := ctxutil.WithOp(baseCtx, op)
+	if chatID != 0 {
+		updCtx = ctxutil.WithChatID(updCtx, chatID)
+	}
+	if userID != 0 {
+		updCtx = ctxutil.WithUserID(updCtx, userID)
+	}
+
+	// чат, запустивший восстановление, ждёт его в своей очереди; остальным — отказ
+	if handlers.RestoreInProgress() {
+		rejectDuringRestore(bot, upd)
+		return
+	}
+
+	if upd.MyChatMember != nil {
+		handleMyChatMember(updCtx, database, upd.MyChatMember)
+		return
+	}
+	if upd.CallbackQuery != nil {
+		HandleCallback(updCtx, bot, database, upd.CallbackQuery)
+		return
+	}
+	if upd.Message != nil {
+		HandleMessage(updCtx, bot, database, upd.Message)
+		return
+	}
+}
+
+// handleMyChatMember — пользователь заблокировал бота или снова открыл с ним чат.
+// Пока бот заблокирован, очередь outbox ему ничего не ставит.
+func handleMyChatMember(ctx context.Context, database *sql.DB, m *tgbotapi.ChatMemberUpdated) {
+	if m.Chat.Type != "private" {
+		return
+	}
+	blocked := m.NewChatMember.Status == "kicked"
+	if err := db.SetChatBlocked(ctx, database, m.Chat.ID, blocked); err != nil {
+		log.Printf("my_chat_member %d: %v", m.Chat.ID, err)
+	}
+}
+
+// rejectDuringRestore отвечает на апдейт, не трогая БД: данные скоро заменит восстановление.
+func rejectDuringRestore(bot *tgbotapi.BotAPI, upd tgbotapi.Update) {
+	const text = "⏳ Идёт восстановление базы данных. Повторите через несколько минут."
+	switch {
+	case upd.CallbackQuery != nil:
+		_, _ = tg.Request(bot, tgbotapi.NewCallback(upd.CallbackQuery.ID, text))
+	case upd.Message != nil && upd.Message.Chat != nil:
+		_, _ = tg.Send(bot, tgbotapi.NewMessage(upd.Message.Chat.ID, text))
+	}
+}
@@ -0,0 +1,71 @@
+package app
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+
+	"github.com/Spok95/telegram-school-bot/internal/metrics"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// webhookSecretHeader — заголовок, в котором Telegram присылает secret_token из setWebhook.
+const webhookSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// webhookMaxBody — апдейты Telegram заметно меньше, лимит защищает от мусора.
+const webhookMaxBody = 1 << 20
+
+// NewWebhookHandler принимает апдейты от Telegram и передаёт их в out.
+// 200 отдаём только после того, как апдейт забрали из канала: если бот
+// останавливается (ctx отменён), отвечаем 503 — Telegram повторит доставку позже.
+func NewWebhookHandler(ctx context.Context, secret string, out chan<- tgbotapi.Update) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			metrics.WebhookRequests.WithLabelValues("bad_method").Inc()
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		got := r.Header.Get(webhookSecretHeader)
+		if secret == "" || subtle.ConstantTimeCompare([]byte(got), []byte(secret)) != 1 {
+			metrics.WebhookRequests.WithLabelValues("unauthorized").Inc()
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var upd tgbotapi.Update
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, webhookMaxBody)).Decode(&upd); err != nil {
+			metrics.WebhookRequests.WithLabelValues("bad_request").Inc()
+			http.Error(w, "bad update", http.StatusBadRequest)
+			return
+		}
+
+		select {
+		case out <- upd:
+			metrics.WebhookRequests.WithLabelValues("ok").Inc()
+			w.WriteHeader(http.StatusOK)
+		case <-ctx.Done():
+			metrics.WebhookRequests.WithLabelValues("shutdown").Inc()
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		case <-r.Context().Done():
+			metrics.WebhookRequests.WithLabelValues("canceled").Inc()
+		}
+	})
+}
+
+// SetWebhook регистрирует URL вебхука вместе с secret_token
+// (в tgbotapi v5.5 поля secret_token в WebhookConfig нет, поэтому запрос собираем сами).
+func SetWebhook(bot *tgbotapi.BotAPI, url, secret string) error {
+	_, err := bot.MakeRequest("setWebhook", tgbotapi.Params{
+		"url":          url,
+		"secret_token": secret,
+	})
+	return err
+}
+
+// DeleteWebhook снимает вебхук — без этого getUpdates (polling) отвечает 409.
+func DeleteWebhook(bot *tgbotapi.BotAPI) error {
+	_, err := bot.Request(tgbotapi.DeleteWebhookConfig{})
+	return err
+}
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// fakeTelegram — минимальный «Telegram», который шлёт апдейты на вебхук как настоящий.
+type fakeTelegram struct {
+	url    string
+	secret string
+}
+
+func (f fakeTelegram) post(t *testing.T, body string) int {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, f.url, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if f.secret != "" {
+		req.Header.Set(webhookSecretHeader, f.secret)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode
+}
+
+const testUpdate = `{"update_id":1001,"message":{"message_id":5,"date":1700000000,
+	"chat":{"id":42,"type":"private"},"from":{"id":42,"is_bot":false,"first_name":"Иван"},"text":"/start"}}`
+
+func startWebhook(t *testing.T, ctx context.Context, secret string) (string, chan tgbotapi.Update) {
+	t.Helper()
+	ch := make(chan tgbotapi.Update)
+	mux := http.NewServeMux()
+	mux.Handle("/telegram/webhook", NewWebhookHandler(ctx, secret, ch))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv.URL + "/telegram/webhook", ch
+}
+
+func TestWebhook_DeliversUpdate(t *testing.T) {
+	url, ch := startWebhook(t, context.Background(), "s3cret")
+
+	got := make(chan tgbotapi.Update, 1)
+	go func() { got <- <-ch }()
+
+	if code := (fakeTelegram{url: url, secret: "s3cret"}).post(t, testUpdate); code != http.StatusOK {
+		t.Fatalf("ожидали 200, получили %d", code)
+	}
+	select {
+	case upd := <-got:
+		if upd.UpdateID != 1001 || upd.Message == nil || upd.Message.Chat.ID != 42 || upd.Message.Text != "/start" {
+			t.Fatalf("апдейт разобран неверно: %+v", upd)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("апдейт не дошёл до канала")
+	}
+}
+
+func TestWebhook_RejectsBadRequests(t *testing.T) {
+	url, _ := startWebhook(t, context.Background(), "s3cret")
+
+	if code := (fakeTelegram{url: url, secret: "wrong"}).post(t, testUpdate); code != http.StatusUnauthorized {
+		t.Fatalf("неверный секрет: ожидали 401, получили %d", code)
+	}
+	if code := (fakeTelegram{url: url}).post(t, testUpdate); code != http.StatusUnauthorized {
+		t.Fatalf("без секрета: ожидали 401, получили %d", code)
+	}
+	if code := (fakeTelegram{url: url, secret: "s3cret"}).post(t, "{not json"); code != http.StatusBadRequest {
+		t.Fatalf("битый JSON: ожидали 400, получили %d", code)
+	}
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("GET: ожидали 405, получили %d", resp.StatusCode)
+	}
+}
+
+func TestWebhook_ShutdownReturns503(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	url, _ := startWebhook(t, ctx, "s3cret")
+	cancel()
+
+	// канал никто не читает, бот останавливается — Telegram должен повторить доставку
+	if code := (fakeTelegram{url: url, secret: "s3cret"}).post(t, testUpdate); code != http.StatusServiceUnavailable {
+		t.Fatalf("ожидали 503 при остановке, получили %d", code)
+	}
+}
@@ -0,0 +1,173 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/metrics"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ErrPoolClosed — пул уже останавливается и новые апдейты не принимает.
+var ErrPoolClosed = errors.New("update pool closed")
+
+// UpdatePool — пул воркеров для апдейтов.
+// Апдейты одного чата обрабатываются строго по очереди (сценарии FSM не пересекаются),
+// разные чаты — параллельно. Очередь ограничена: когда она заполнена, Submit ждёт.
+type UpdatePool struct {
+	handle func(context.Context, tgbotapi.Update)
+	ctx    context.Context
+
+	slots chan struct{}   // свободные места в очереди
+	ready chan *chatQueue // чаты, у которых есть работа и которых ещё никто не взял
+
+	mu     sync.Mutex
+	chats  map[int64]*chatQueue
+	closed bool
+
+	wg sync.WaitGroup
+}
+
+type queuedUpdate struct {
+	upd tgbotapi.Update
+	at  time.Time
+}
+
+// chatQueue живёт в UpdatePool.chats, пока у чата есть необработанные апдейты.
+type chatQueue struct {
+	chatID int64
+	items  []queuedUpdate
+}
+
+// NewUpdatePool запускает workers воркеров с общей очередью на queueSize апдейтов.
+// handle получает контекст, не зависящий от отмены ctx: при остановке уже принятые
+// апдейты дорабатываются (см. Drain).
+func NewUpdatePool(ctx context.Context, workers, queueSize int, handle func(context.Context, tgbotapi.Update)) *UpdatePool {
+	if workers <= 0 {
+		workers = 1
+	}
+	if queueSize < workers {
+		queueSize = workers
+	}
+	p := &UpdatePool{
+		handle: handle,
+		ctx:    context.WithoutCancel(ctx),
+		slots:  make(chan struct{}, queueSize),
+		// в ready не может оказаться больше чатов, чем апдейтов в очереди, — отправка не блокируется
+		ready: make(chan *chatQueue, queueSize),
+		chats: make(map[int64]*chatQueue),
+	}
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.worker()
+	}
+	return p
+}
+
+// Submit ставит апдейт в очередь его чата. Если очередь заполнена — ждёт
+// освобождения места или отмены ctx (backpressure для polling/webhook).
+func (p *UpdatePool) Submit(ctx context.Context, upd tgbotapi.Update) error {
+	select {
+	case p.slots <- struct{}{}:
+	default:
+		metrics.UpdatePoolBackpressure.Inc()
+		select {
+		case p.slots <- struct{}{}:
+		case <-ctx.Done():
+			metrics.UpdatePoolDropped.Inc()
+			return ctx.Err()
+		}
+	}
+
+	chatID := updateChatID(upd)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		<-p.slots
+		metrics.UpdatePoolDropped.Inc()
+		return ErrPoolClosed
+	}
+	metrics.UpdatePoolQueueDepth.Inc()
+	item := queuedUpdate{upd: upd, at: time.Now()}
+	if q, ok := p.chats[chatID]; ok {
+		// чат уже в работе или ждёт воркера — просто дописываем в хвост
+		q.items = append(q.items, item)
+		return nil
+	}
+	q := &chatQueue{chatID: chatID, items: []queuedUpdate{item}}
+	p.chats[chatID] = q
+	p.ready <- q
+	return nil
+}
+
+// Drain перестаёт принимать апдейты и ждёт, пока воркеры обработают уже принятые.
+// Возвращает ctx.Err(), если не уложились.
+func (p *UpdatePool) Drain(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.ready)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *UpdatePool) worker() {
+	defer p.wg.Done()
+	for q := range p.ready {
+		// воркер держит чат, пока у него не кончатся апдейты: так сохраняется порядок
+		for {
+			p.mu.Lock()
+			if len(q.items) == 0 {
+				delete(p.chats, q.chatID)
+				p.mu.Unlock()
+				break
+			}
+			item := q.items[0]
+			q.items = q.items[1:]
+			p.mu.Unlock()
+
+			metrics.UpdatePoolWait.Observe(time.Since(item.at).Seconds())
+			metrics.UpdatePoolBusy.Inc()
+			p.handle(p.ctx, item.upd)
+			metrics.UpdatePoolBusy.Dec()
+			metrics.UpdatePoolQueueDepth.Dec()
+			<-p.slots
+		}
+	}
+}
+
+// updateChatID — ключ шардирования: чат сообщения/колбэка, иначе отправитель.
+func updateChatID(upd tgbotapi.Update) int64 {
+	switch {
+	case upd.CallbackQuery != nil:
+		if upd.CallbackQuery.Message != nil && upd.CallbackQuery.Message.Chat != nil {
+			return upd.CallbackQuery.Message.Chat.ID
+		}
+		if upd.CallbackQuery.From != nil {
+			return upd.CallbackQuery.From.ID
+		}
+	case upd.Message != nil:
+		if upd.Message.Chat != nil {
+			return upd.Message.Chat.ID
+		}
+		if upd.Message.From != nil {
+			return upd.Message.From.ID
+		}
+	}
+	return 0
+}
@@ -0,0 +1,114 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func chatUpdate(id int, chatID int64) tgbotapi.Update {
+	return tgbotapi.Update{
+		UpdateID: id,
+		Message:  &tgbotapi.Message{MessageID: id, Chat: &tgbotapi.Chat{ID: chatID}},
+	}
+}
+
+func TestUpdatePool_KeepsOrderWithinChat(t *testing.T) {
+	var mu sync.Mutex
+	got := map[int64][]int{}
+
+	p := NewUpdatePool(context.Background(), 4, 64, func(_ context.Context, upd tgbotapi.Update) {
+		// небольшая задержка, чтобы воркеры реально пересекались
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		got[upd.Message.Chat.ID] = append(got[upd.Message.Chat.ID], upd.UpdateID)
+		mu.Unlock()
+	})
+
+	for i := 0; i < 20; i++ {
+		for chat := int64(1); chat <= 3; chat++ {
+			if err := p.Submit(context.Background(), chatUpdate(i, chat)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := p.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for chat := int64(1); chat <= 3; chat++ {
+		ids := got[chat]
+		if len(ids) != 20 {
+			t.Fatalf("чат %d: ожидали 20 апдейтов, получили %d", chat, len(ids))
+		}
+		for i, id := range ids {
+			if id != i {
+				t.Fatalf("чат %d: нарушен порядок: %v", chat, ids)
+			}
+		}
+	}
+}
+
+func TestUpdatePool_SlowChatDoesNotBlockOthers(t *testing.T) {
+	release := make(chan struct{})
+	fast := make(chan struct{}, 1)
+
+	p := NewUpdatePool(context.Background(), 2, 8, func(_ context.Context, upd tgbotapi.Update) {
+		if upd.Message.Chat.ID == 1 {
+			<-release // «долгий экспорт»
+			return
+		}
+		fast <- struct{}{}
+	})
+	defer func() {
+		close(release)
+		_ = p.Drain(context.Background())
+	}()
+
+	_ = p.Submit(context.Background(), chatUpdate(1, 1))
+	_ = p.Submit(context.Background(), chatUpdate(2, 2))
+
+	select {
+	case <-fast:
+	case <-time.After(time.Second):
+		t.Fatal("апдейт другого чата ждёт медленный чат")
+	}
+}
+
+func TestUpdatePool_BackpressureAndDrain(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	handled := 0
+
+	p := NewUpdatePool(context.Background(), 1, 2, func(_ context.Context, _ tgbotapi.Update) {
+		<-release
+		mu.Lock()
+		handled++
+		mu.Unlock()
+	})
+
+	_ = p.Submit(context.Background(), chatUpdate(1, 1))
+	_ = p.Submit(context.Background(), chatUpdate(2, 1))
+
+	// очередь заполнена — Submit должен ждать и сдаться по контексту
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := p.Submit(ctx, chatUpdate(3, 2)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("ожидали DeadlineExceeded при полной очереди, получили %v", err)
+	}
+
+	close(release)
+	if err := p.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if handled != 2 {
+		t.Fatalf("при остановке должны дообработаться все принятые апдейты, обработано %d", handled)
+	}
+	if err := p.Submit(context.Background(), chatUpdate(4, 1)); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("после Drain ожидали ErrPoolClosed, получили %v", err)
+	}
+}
@@ -0,0 +1,394 @@
+// Package backup — переносимая логическая копия БД: zip-архив с data/<таблица>.csv по
+// каждой таблице и manifest.json (версия схемы goose, число строк, контрольные суммы).
+// Архив понимает «📥 Восстановить из файла», для него не нужен sidecar с pg_dump.
+package backup
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Format — метка формата в manifest.json.
+const Format = "telegram-school-bot/csv-zip/1"
+
+// ManifestName — имя манифеста внутри архива.
+const ManifestName = "manifest.json"
+
+// служебная таблица goose в копию не попадает: версия схемы записывается в манифест
+const gooseTable = "goose_db_version"
+
+// Table — одна таблица архива.
+type Table struct {
+	Name   string `json:"name"`
+	File   string `json:"file"`
+	Rows   int64  `json:"rows"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest описывает архив. Таблицы перечислены в порядке загрузки: сначала те,
+// на которые ссылаются внешние ключи.
+type Manifest struct {
+	Format        string    `json:"format"`
+	CreatedAt     time.Time `json:"created_at"`
+	SchemaVersion int64     `json:"schema_version"`
+	Tables        []Table   `json:"tables"`
+}
+
+// TotalRows — сколько строк во всех таблицах.
+func (m *Manifest) TotalRows() int64 {
+	var n int64
+	for _, t := range m.Tables {
+		n += t.Rows
+	}
+	return n
+}
+
+// Counts — строки по таблицам.
+func (m *Manifest) Counts() map[string]int64 {
+	out := make(map[string]int64, len(m.Tables))
+	for _, t := range m.Tables {
+		out[t.Name] = t.Rows
+	}
+	return out
+}
+
+// DataFile — путь CSV таблицы внутри архива.
+func DataFile(table string) string { return "data/" + table + ".csv" }
+
+// WriteZip выгружает все таблицы схемы public в zip, который пишется в w по мере чтения.
+// Данные читаются в одной транзакции REPEATABLE READ — архив согласован на один момент.
+// Значения пишутся в текстовом виде PostgreSQL (время — в UTC) как есть, без обрезки пробелов:
+// NULL — ячейка \N (NullCell), значение, начинающееся с обратной косой черты, получает
+// ещё одну впереди (\N в тексте — \\N), пустая ячейка — пустая строка.
+func WriteZip(ctx context.Context, database *sql.DB, w io.Writer) (*Manifest, error) {
+	tx, err := database.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx, `SET LOCAL TimeZone = 'UTC'; SET LOCAL DateStyle = 'ISO, YMD'`); err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{Format: Format, CreatedAt: time.Now().UTC()}
+	if m.SchemaVersion, err = schemaVersion(ctx, tx); err != nil {
+		return nil, fmt.Errorf("schema version: %w", err)
+	}
+	tables, err := tablesInLoadOrder(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	zw := zip.NewWriter(w)
+	for _, name := range tables {
+		t, err := writeTable(ctx, tx, zw, name, m.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("export %s: %w", name, err)
+		}
+		m.Tables = append(m.Tables, t)
+	}
+
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: ManifestName, Method: zip.Deflate, Modified: m.CreatedAt})
+	if err != nil {
+		return nil, err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(m); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// schemaVersion — последняя применённая миграция goose (0, если БД создана без goose).
+func schemaVersion(ctx context.Context, tx *sql.Tx) (int64, error) {
+	var reg sql.NullString
+	if err := tx.QueryRowContext(ctx, `SELECT to_regclass('public.`+gooseTable+`')::text`).Scan(&reg); err != nil {
+		return 0, err
+	}
+	if !reg.Valid {
+		return 0, nil
+	}
+	var v int64
+	err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version_id), 0) FROM `+gooseTable+` WHERE is_applied`).Scan(&v)
+	return v, err
+}
+
+// tablesInLoadOrder — таблицы public так, чтобы таблица шла после тех, на которые ссылается.
+// Восстановление делает TRUNCATE … CASCADE по порядку архива, поэтому порядок важен.
+func tablesInLoadOrder(ctx context.Context, tx *sql.Tx) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT c.relname
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = 'public' AND c.relkind = 'r' AND c.relname <> $1
+	`, gooseTable)
+	if err != nil {
+		return nil, err
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		tables = append(tables, name)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	deps, err := foreignKeys(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	return loadOrder(tables, deps), nil
+}
+
+// ForeignKeys — внешние ключи рабочей схемы: таблица → таблицы, на которые она ссылается.
+func ForeignKeys(ctx context.Context, database *sql.DB) (map[string][]string, error) {
+	return foreignKeys(ctx, database)
+}
+
+func foreignKeys(ctx context.Context, q queryer) (map[string][]string, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT cl.relname, ref.relname
+		FROM pg_constraint co
+		JOIN pg_class cl  ON cl.oid = co.conrelid
+		JOIN pg_class ref ON ref.oid = co.confrelid
+		JOIN pg_namespace n ON n.oid = cl.relnamespace
+		WHERE co.contype = 'f' AND n.nspname = 'public'
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	deps := map[string][]string{}
+	for rows.Next() {
+		var child, parent string
+		if err := rows.Scan(&child, &parent); err != nil {
+			return nil, err
+		}
+		deps[child] = append(deps[child], parent)
+	}
+	return deps, rows.Err()
+}
+
+// loadOrder — топологическая сортировка по внешним ключам (deps: таблица → на кого ссылается).
+// При равенстве — по алфавиту; ссылки на себя не мешают, таблицы из цикла идут в конце.
+func loadOrder(tables []string, deps map[string][]string) []string {
+	known := map[string]bool{}
+	for _, t := range tables {
+		known[t] = true
+	}
+	pending := map[string]int{}
+	children := map[string][]string{}
+	for _, t := range tables {
+		seen := map[string]bool{}
+		for _, p := range deps[t] {
+			if p == t || !known[p] || seen[p] {
+				continue
+			}
+			seen[p] = true
+			pending[t]++
+			children[p] = append(children[p], t)
+		}
+	}
+
+	var ready, out []string
+	for _, t := range tables {
+		if pending[t] == 0 {
+			ready = append(ready, t)
+		}
+	}
+	done := map[string]bool{}
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		t := ready[0]
+		ready = ready[1:]
+		out = append(out, t)
+		done[t] = true
+		for _, c := range children[t] {
+			if pending[c]--; pending[c] == 0 {
+				ready = append(ready, c)
+			}
+		}
+	}
+	var rest []string
+	for _, t := range tables {
+		if !done[t] {
+			rest = append(rest, t)
+		}
+	}
+	sort.Strings(rest)
+	return append(out, rest...)
+}
+
+func writeTable(ctx context.Context, tx *sql.Tx, zw *zip.Writer, table string, modified time.Time) (Table, error) {
+	t := Table{Name: table, File: DataFile(table)}
+	cols, order, err := tableColumns(ctx, tx, table)
+	if err != nil {
+		return t, err
+	}
+
+	sel := make([]string, len(cols))
+	header := make([]string, len(cols))
+	for i, c := range cols {
+		sel[i] = quoteIdent(c) + "::text"
+		header[i] = c
+	}
+	q := "SELECT " + strings.Join(sel, ", ") + " FROM " + quoteIdent(table)
+	if len(order) > 0 {
+		q += " ORDER BY " + strings.Join(order, ", ")
+	}
+	rows, err := tx.QueryContext(ctx, q)
+	if err != nil {
+		return t, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: t.File, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return t, err
+	}
+	h := sha256.New()
+	cw := csv.NewWriter(io.MultiWriter(f, h))
+	if err := cw.Write(header); err != nil {
+		return t, err
+	}
+	vals := make([]sql.NullString, len(cols))
+	ptrs := make([]any, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	rec := make([]string, len(cols))
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return t, err
+		}
+		for i, v := range vals {
+			rec[i] = encodeCell(v)
+		}
+		if err := cw.Write(rec); err != nil {
+			return t, err
+		}
+		t.Rows++
+	}
+	if err := rows.Err(); err != nil {
+		return t, err
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return t, err
+	}
+	t.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return t, nil
+}
+
+// NullCell — NULL в CSV архива с манифестом. Значение, которое начинается с '\', пишется
+// с ещё одним '\' впереди: текст «\N» не спутать с NULL, а пустая строка и пробелы по краям сохраняются.
+const NullCell = `\N`
+
+func encodeCell(v sql.NullString) string {
+	switch {
+	case !v.Valid:
+		return NullCell
+	case strings.HasPrefix(v.String, `\`):
+		return `\` + v.String
+	}
+	return v.String
+}
+
+// decodeCell — значение ячейки для INSERT; null — NULL. strict — архив с манифестом
+// (см. encodeCell). Старые архивы без манифеста читаются как раньше: пробелы по краям
+// обрезаются, "", "<nil>" и "null" — NULL, но пустая ячейка в NOT NULL-тексте — пустая строка.
+func decodeCell(v string, strict, notNullText bool) (s string, null bool) {
+	if strict {
+		if v == NullCell {
+			return "", true
+		}
+		return strings.TrimPrefix(v, `\`), false
+	}
+	s = strings.TrimSpace(v)
+	if s == "" && notNullText {
+		return "", false
+	}
+	if s == "" || s == "<nil>" || strings.EqualFold(s, "null") {
+		return "", true
+	}
+	return s, false
+}
+
+// tableColumns — колонки таблицы (без вычисляемых) и сортировка по первичному ключу:
+// у ссылок на себя (score_ledger.reverses_id) исходная строка идёт раньше ссылающейся.
+func tableColumns(ctx context.Context, tx *sql.Tx, table string) (cols, order []string, err error) {
+	reg := "public." + quoteIdent(table)
+	rows, err := tx.QueryContext(ctx, `
+		SELECT a.attname
+		FROM pg_attribute a
+		WHERE a.attrelid = $1::regclass AND a.attnum > 0 AND NOT a.attisdropped AND a.attgenerated = ''
+		ORDER BY a.attnum
+	`, reg)
+	if err != nil {
+		return nil, nil, err
+	}
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			_ = rows.Close()
+			return nil, nil, err
+		}
+		cols = append(cols, c)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	rows, err = tx.QueryContext(ctx, `
+		SELECT a.attname
+		FROM pg_index i
+		JOIN LATERAL unnest(i.indkey) WITH ORDINALITY AS k(attnum, pos) ON TRUE
+		JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = k.attnum
+		WHERE i.indrelid = $1::regclass AND i.indisprimary
+		ORDER BY k.pos
+	`, reg)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			return nil, nil, err
+		}
+		order = append(order, quoteIdent(c))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(order) == 0 {
+		// без первичного ключа — полный порядок по всем колонкам, чтобы архив был воспроизводим
+		for i := range cols {
+			order = append(order, fmt.Sprint(i+1))
+		}
+	}
+	return cols, order, nil
+}
+
+func quoteIdent(id string) string {
+	return `"` + strings.ReplaceAll(id, `"`, `""`) + `"`
+}
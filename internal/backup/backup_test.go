@@ -0,0 +1,143 @@
+package backup
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestLoadOrder(t *testing.T) {
+	tables := []string{"scores", "score_ledger", "users", "categories", "consult_slots", "consult_waitlist"}
+	deps := map[string][]string{
+		"scores":        {"users", "categories", "users"},
+		"score_ledger":  {"scores", "score_ledger", "users"},
+		"consult_slots": {"users", "consult_waitlist"},
+		// ссылка на таблицу вне схемы не учитывается
+		"consult_waitlist": {"users", "classes"},
+	}
+	got := loadOrder(tables, deps)
+	want := []string{"categories", "users", "consult_waitlist", "consult_slots", "scores", "score_ledger"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("порядок %v, ожидали %v", got, want)
+	}
+
+	// цикл не теряет таблицы
+	got = loadOrder([]string{"a", "b", "c"}, map[string][]string{"a": {"b"}, "b": {"a"}})
+	if !reflect.DeepEqual(got, []string{"c", "a", "b"}) {
+		t.Fatalf("цикл: %v", got)
+	}
+}
+
+func testArchive(t *testing.T, csvBody string, rows int64, extra map[string]string) *zip.Reader {
+	t.Helper()
+	sum := sha256.Sum256([]byte(csvBody))
+	m := Manifest{Format: Format, SchemaVersion: 24, Tables: []Table{{
+		Name: "users", File: DataFile("users"), Rows: rows, SHA256: hex.EncodeToString(sum[:]),
+	}}}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := map[string]string{DataFile("users"): csvBody}
+	for k, v := range extra {
+		files[k] = v
+	}
+	for name, body := range files {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = f.Write([]byte(body))
+	}
+	f, _ := zw.Create(ManifestName)
+	_ = json.NewEncoder(f).Encode(m)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zr
+}
+
+func TestVerify(t *testing.T) {
+	body := "id,name\n1,\"Иванов, Иван\"\n2,\"многострочное\nимя\"\n"
+
+	zr := testArchive(t, body, 2, nil)
+	m, err := ReadManifest(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.SchemaVersion != 24 || m.TotalRows() != 2 {
+		t.Fatalf("неверный манифест: %+v", m)
+	}
+	if err := Verify(zr, m); err != nil {
+		t.Fatalf("целый архив не прошёл проверку: %v", err)
+	}
+
+	for name, zr := range map[string]*zip.Reader{
+		"число строк":    testArchive(t, body, 3, nil),
+		"лишняя таблица": testArchive(t, body, 2, map[string]string{DataFile("scores"): "id\n"}),
+	} {
+		m, err := ReadManifest(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Verify(zr, m); !errors.Is(err, ErrCorrupted) {
+			t.Errorf("%s: ожидали ErrCorrupted, получили %v", name, err)
+		}
+	}
+
+	// подменённые данные
+	m.Tables[0].SHA256 = hex.EncodeToString(make([]byte, 32))
+	if err := Verify(zr, m); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("контрольная сумма: ожидали ErrCorrupted, получили %v", err)
+	}
+}
+
+func TestCellRoundTrip(t *testing.T) {
+	values := []sql.NullString{
+		{}, // NULL
+		{String: "", Valid: true},
+		{String: " x ", Valid: true},
+		{String: "null", Valid: true},
+		{String: `\N`, Valid: true},
+		{String: `\\x`, Valid: true},
+		{String: "<nil>", Valid: true},
+	}
+	// через настоящий CSV: запись как в writeTable, чтение как при восстановлении
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	rec := make([]string, len(values))
+	for i, v := range values {
+		rec[i] = encodeCell(v)
+	}
+	if err := w.Write(rec); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	got, err := csv.NewReader(&buf).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range values {
+		s, null := decodeCell(got[i], true, false)
+		if null != !v.Valid || s != v.String {
+			t.Errorf("%q: прочитали %q (null=%v)", v.String, s, null)
+		}
+	}
+
+	// старые архивы без манифеста читаются по-старому
+	if _, null := decodeCell(" null ", false, false); !null {
+		t.Error("в старом архиве «null» — NULL")
+	}
+	if s, null := decodeCell("", false, true); null || s != "" {
+		t.Error("в старом архиве пустая ячейка NOT NULL-текста — пустая строка")
+	}
+}
@@ -0,0 +1,489 @@
+package backup
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// checkSuffix — рядом с бэкапом лежит результат его пробного восстановления.
+const checkSuffix = ".check.json"
+
+// latestLink — симлинк sidecar на последний дамп; в каталоге это не отдельная копия.
+const latestLink = "latest.sql.gz"
+
+var ErrNotFound = errors.New("бэкап не найден")
+
+// Check — результат пробного восстановления бэкапа во временную схему.
+type Check struct {
+	CheckedAt     time.Time `json:"checked_at"`
+	OK            bool      `json:"ok"`
+	Error         string    `json:"error,omitempty"`
+	SchemaVersion int64     `json:"schema_version"`
+	Tables        int       `json:"tables"`
+	Rows          int64     `json:"rows"`
+	// Counts — строки по таблицам; у проверок до появления пробного запуска восстановления их нет
+	Counts map[string]int64 `json:"counts,omitempty"`
+}
+
+// Entry — файл бэкапа в каталоге.
+type Entry struct {
+	ID        string // короткий идентификатор для кнопок: имя файла в callback data не влезает
+	Name      string
+	Path      string
+	Size      int64
+	CreatedAt time.Time
+	// SchemaVersion — версия схемы goose: из манифеста zip или из последней проверки; 0 — неизвестна
+	SchemaVersion int64
+	Check         *Check // nil — ещё не проверялся
+	Encrypted     bool
+}
+
+// tmpPrefix — расшифрованные на время восстановления копии; в каталог они не входят.
+const tmpPrefix = "tmp-restore-"
+
+// Catalog — бэкапы в локальном каталоге: дампы sidecar (*.sql.gz, *.sql) и выгрузки *.zip,
+// в том числе зашифрованные (*.enc). С ключами (Keys) незашифрованные копии шифруются.
+type Catalog struct {
+	Dir  string
+	Keys *Keyring
+}
+
+func NewCatalog(dir string, keys *Keyring) *Catalog { return &Catalog{Dir: dir, Keys: keys} }
+
+// IsBackupName — файл, который каталог считает бэкапом.
+func IsBackupName(name string) bool {
+	n := strings.ToLower(PlainName(name))
+	return strings.HasSuffix(n, ".sql.gz") || strings.HasSuffix(n, ".sql") || strings.HasSuffix(n, ".zip")
+}
+
+func entryID(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:6])
+}
+
+// List — бэкапы каталога, новые первыми. Несуществующий каталог — пустой список.
+func (c *Catalog) List() ([]Entry, error) {
+	des, err := os.ReadDir(c.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []Entry
+	for _, de := range des {
+		name := de.Name()
+		if !de.Type().IsRegular() || name == latestLink || strings.HasPrefix(name, tmpPrefix) || !IsBackupName(name) {
+			continue
+		}
+		fi, err := de.Info()
+		if err != nil {
+			continue // файл удалили между ReadDir и Info
+		}
+		e := Entry{
+			ID:        entryID(name),
+			Name:      name,
+			Path:      filepath.Join(c.Dir, name),
+			Size:      fi.Size(),
+			CreatedAt: backupTime(name, fi.ModTime()),
+			Encrypted: IsEncrypted(name),
+		}
+		if ch, err := c.loadCheck(name); err == nil {
+			e.Check = ch
+			if ch.OK {
+				e.SchemaVersion = ch.SchemaVersion
+			}
+		}
+		if !e.Encrypted && strings.HasSuffix(strings.ToLower(name), ".zip") {
+			if m, err := readZipManifest(e.Path); err == nil {
+				e.SchemaVersion = m.SchemaVersion
+				e.CreatedAt = m.CreatedAt
+			}
+		}
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.After(out[j].CreatedAt)
+		}
+		return out[i].Name > out[j].Name
+	})
+	return out, nil
+}
+
+// Get — бэкап по ID из List.
+func (c *Catalog) Get(id string) (*Entry, error) {
+	list, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		if list[i].ID == id {
+			return &list[i], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// GetByName — бэкап по имени файла.
+func (c *Catalog) GetByName(name string) (*Entry, error) { return c.Get(entryID(filepath.Base(name))) }
+
+// Import кладёт файл в каталог под именем manual-<время>-<имя> и возвращает запись.
+// В имени остаются только латиница, цифры и «._-»: его передают sidecar в запросе.
+func (c *Catalog) Import(src, name string, now time.Time) (*Entry, error) {
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	name = "manual-" + now.Format("2006-01-02_150405") + "-" + unsafeNameRe.ReplaceAllString(filepath.Base(name), "_")
+	in, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = in.Close() }()
+	out, err := os.OpenFile(filepath.Join(c.Dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := out.ReadFrom(in); err != nil {
+		_ = out.Close()
+		return nil, err
+	}
+	if err := out.Close(); err != nil {
+		return nil, err
+	}
+	return c.Get(entryID(name))
+}
+
+// Latest — копия, на которую указывает симлинк sidecar latest.sql.gz (в том числе уже зашифрованная).
+func (c *Catalog) Latest() (*Entry, error) {
+	target, err := os.Readlink(filepath.Join(c.Dir, latestLink))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	e, err := c.GetByName(target)
+	if errors.Is(err, ErrNotFound) {
+		return c.GetByName(target + EncryptedExt)
+	}
+	return e, err
+}
+
+// SnapshotPrefix — снимок БД, который делается перед восстановлением.
+const SnapshotPrefix = "pre-restore-"
+
+// Snapshot выгружает текущую БД в каталог (pre-restore-<время>.zip, с ключами — зашифрованным).
+func (c *Catalog) Snapshot(ctx context.Context, database *sql.DB, now time.Time) (*Entry, error) {
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	name := SnapshotPrefix + now.Format("2006-01-02_150405") + ".zip"
+	path := filepath.Join(c.Dir, name)
+	f, err := os.OpenFile(path+".part", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	_, err = WriteZip(ctx, database, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(path+".part", path)
+	}
+	if err != nil {
+		_ = os.Remove(path + ".part")
+		return nil, err
+	}
+	e, err := c.GetByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Seal(e); err != nil {
+		return nil, fmt.Errorf("encrypt: %w", err)
+	}
+	return e, nil
+}
+
+// Rollback возвращает БД к снимку. Если схема испорчена (дамп восстановился
+// наполовину или не прошли миграции), она пересоздаётся миграциями и снимок грузится заново.
+func (c *Catalog) Rollback(ctx context.Context, database *sql.DB, snap *Entry) error {
+	path, cleanup, err := c.Decrypted(snap, os.TempDir())
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	m, err := readZipManifest(path)
+	if err != nil {
+		return err
+	}
+	// снимок сделан на текущей схеме, миграции после него строк не меняют — сверяем до фиксации
+	load := func() error {
+		if err := RestoreZipChecked(ctx, database, path, func(after map[string]int64) error {
+			return CompareCounts(m.Counts(), after)
+		}); err != nil {
+			return err
+		}
+		return Migrate(ctx, database)
+	}
+	if err = load(); err == nil {
+		return nil
+	}
+	log.Println("backup: rollback: reset schema after:", err)
+	if _, err := database.ExecContext(ctx, `DROP SCHEMA public CASCADE; CREATE SCHEMA public`); err != nil {
+		return fmt.Errorf("reset schema: %w", err)
+	}
+	return load()
+}
+
+func (c *Catalog) loadCheck(name string) (*Check, error) {
+	b, err := os.ReadFile(filepath.Join(c.Dir, name+checkSuffix))
+	if err != nil {
+		return nil, err
+	}
+	var ch Check
+	if err := json.Unmarshal(b, &ch); err != nil {
+		return nil, err
+	}
+	return &ch, nil
+}
+
+// SaveCheck записывает результат проверки рядом с бэкапом.
+func (c *Catalog) SaveCheck(e *Entry, ch *Check) error {
+	b, err := json.MarshalIndent(ch, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(c.Dir, e.Name+checkSuffix), b, 0o644)
+}
+
+// Verify восстанавливает бэкап во временную схему, сохраняет и возвращает результат.
+// Ошибка — только если проверку не удалось провести; неудачная проверка — Check.OK=false.
+func (c *Catalog) Verify(ctx context.Context, database *sql.DB, e *Entry) (*Check, error) {
+	path, cleanup, err := c.Decrypted(e, os.TempDir())
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	ch, err := TestRestore(ctx, database, path)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		ch = &Check{Error: err.Error()}
+	}
+	ch.CheckedAt = time.Now().UTC()
+	if err := c.SaveCheck(e, ch); err != nil {
+		return ch, err
+	}
+	e.Check = ch
+	return ch, nil
+}
+
+// Prune удаляет бэкапы, которые не оставляет политика, и возвращает удалённые.
+// Симлинк latest.sql.gz и файл, на который он указывает, не трогаются.
+func (c *Catalog) Prune(p Retention, loc *time.Location) ([]Entry, error) {
+	if !p.Enabled() {
+		return nil, nil
+	}
+	list, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+	keep := p.Keep(list, loc)
+	if target, err := os.Readlink(filepath.Join(c.Dir, latestLink)); err == nil {
+		keep[filepath.Base(target)] = true
+		keep[filepath.Base(target)+EncryptedExt] = true
+	}
+	var pruned []Entry
+	for _, e := range list {
+		if keep[e.Name] {
+			continue
+		}
+		if err := os.Remove(e.Path); err != nil {
+			return pruned, err
+		}
+		_ = os.Remove(e.Path + checkSuffix)
+		pruned = append(pruned, e)
+	}
+	return pruned, nil
+}
+
+// Decrypted — путь к расшифрованной копии бэкапа в dir (у незашифрованного — сам файл)
+// и функция, которая её удаляет.
+func (c *Catalog) Decrypted(e *Entry, dir string) (string, func(), error) {
+	if !e.Encrypted {
+		return e.Path, func() {}, nil
+	}
+	in, err := os.Open(e.Path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer func() { _ = in.Close() }()
+	r, _, err := c.Keys.Decrypt(in)
+	if err != nil {
+		return "", nil, err
+	}
+	out, err := os.CreateTemp(dir, tmpPrefix+"*-"+PlainName(e.Name))
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { _ = os.Remove(out.Name()) }
+	if _, err := io.Copy(out, r); err != nil {
+		_ = out.Close()
+		cleanup()
+		return "", nil, err
+	}
+	if err := out.Close(); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return out.Name(), cleanup, nil
+}
+
+// Seal шифрует бэкап текущим ключом: рядом появляется <имя>.enc, исходный файл удаляется.
+func (c *Catalog) Seal(e *Entry) error {
+	if e.Encrypted || !c.Keys.Enabled() {
+		return nil
+	}
+	in, err := os.Open(e.Path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	part := e.Path + EncryptedExt + ".part"
+	out, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	w, err := c.Keys.Encrypt(out)
+	if err == nil {
+		_, err = io.Copy(w, in)
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(part, e.Path+EncryptedExt)
+	}
+	if err != nil {
+		_ = os.Remove(part)
+		return err
+	}
+	_ = os.Rename(e.Path+checkSuffix, e.Path+EncryptedExt+checkSuffix)
+	if err := os.Remove(e.Path); err != nil {
+		return err
+	}
+	e.Name, e.Path, e.ID, e.Encrypted = e.Name+EncryptedExt, e.Path+EncryptedExt, entryID(e.Name+EncryptedExt), true
+	return nil
+}
+
+// SealAll шифрует незашифрованные бэкапы, изменённые раньше olderThan.
+func (c *Catalog) SealAll(olderThan time.Time) ([]Entry, error) {
+	if !c.Keys.Enabled() {
+		return nil, nil
+	}
+	list, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+	var sealed []Entry
+	for i := range list {
+		e := &list[i]
+		if e.Encrypted {
+			continue
+		}
+		if fi, err := os.Stat(e.Path); err != nil || fi.ModTime().After(olderThan) {
+			continue
+		}
+		if err := c.Seal(e); err != nil {
+			return sealed, fmt.Errorf("%s: %w", e.Name, err)
+		}
+		sealed = append(sealed, *e)
+	}
+	return sealed, nil
+}
+
+// Maintain — фоновая работа с каталогом: шифрует новые копии (если заданы ключи),
+// удаляет лишнее по политике и проверяет самый новый ещё не проверенный бэкап (по одному за запуск, чтобы не нагружать БД).
+func (c *Catalog) Maintain(ctx context.Context, database *sql.DB, p Retention, loc *time.Location) error {
+	// файл, который sidecar, возможно, ещё пишет, не трогаем
+	if _, err := c.SealAll(time.Now().Add(-10 * time.Minute)); err != nil {
+		return fmt.Errorf("encrypt: %w", err)
+	}
+	pruned, err := c.Prune(p, loc)
+	for _, e := range pruned {
+		log.Printf("backup: удалён по политике хранения: %s", e.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("prune: %w", err)
+	}
+	list, err := c.List()
+	if err != nil {
+		return err
+	}
+	for i := range list {
+		if list[i].Check != nil {
+			continue
+		}
+		ch, err := c.Verify(ctx, database, &list[i])
+		if err != nil {
+			return fmt.Errorf("verify %s: %w", list[i].Name, err)
+		}
+		if !ch.OK {
+			return fmt.Errorf("бэкап %s не прошёл проверку: %s", list[i].Name, ch.Error)
+		}
+		break
+	}
+	return nil
+}
+
+var unsafeNameRe = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// имена файлов sidecar и бота: school-20261017T020000Z.sql.gz, school_db_2026-10-17_1504.zip
+var (
+	utcStampRe   = regexp.MustCompile(`(\d{8}T\d{6}Z)`)
+	localStampRe = regexp.MustCompile(`(\d{4}-\d{2}-\d{2}_\d{4})`)
+)
+
+// backupTime — время создания из имени файла, иначе время изменения файла.
+func backupTime(name string, mod time.Time) time.Time {
+	if m := utcStampRe.FindString(name); m != "" {
+		if t, err := time.Parse("20060102T150405Z", m); err == nil {
+			return t
+		}
+	}
+	// у manual-<время загрузки>-<исходное имя> важнее исходное имя: берём последнюю метку
+	if ms := localStampRe.FindAllString(name, -1); len(ms) > 0 {
+		if t, err := time.ParseInLocation("2006-01-02_1504", ms[len(ms)-1], time.Local); err == nil {
+			return t
+		}
+	}
+	return mod
+}
+
+func readZipManifest(path string) (*Manifest, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = zr.Close() }()
+	return ReadManifest(&zr.Reader)
+}
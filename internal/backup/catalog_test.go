@@ -0,0 +1,166 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestRetentionKeep(t *testing.T) {
+	loc := time.UTC
+	start := time.Date(2026, 10, 17, 5, 0, 0, 0, loc) // суббота
+	var entries []Entry
+	// ежедневные бэкапы за 100 дней, 17 октября — ещё и ручной днём
+	entries = append(entries, Entry{Name: "manual", CreatedAt: start.Add(8 * time.Hour)})
+	for d := 0; d < 100; d++ {
+		at := start.AddDate(0, 0, -d)
+		entries = append(entries, Entry{Name: at.Format("2006-01-02"), CreatedAt: at})
+	}
+
+	keep := Retention{Daily: 3, Weekly: 2, Monthly: 3}.Keep(entries, loc)
+	var got []string
+	for name := range keep {
+		got = append(got, name)
+	}
+	sort.Strings(got)
+	want := []string{
+		"2026-08-31", // последний бэкап августа (месяцы: октябрь, сентябрь, август)
+		"2026-09-30",
+		"2026-10-11", // воскресенье — последний день прошлой недели
+		"2026-10-15", "2026-10-16",
+		"manual", // самый свежий за 17-е
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("оставили %v, ожидали %v", got, want)
+	}
+
+	if len(Retention{}.Keep(entries, loc)) != 1 {
+		t.Fatal("без политики должен остаться хотя бы самый новый")
+	}
+}
+
+func TestCatalogListAndPrune(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, mod time.Time) {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_ = os.Chtimes(p, mod, mod)
+	}
+	old := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	write("school-20261015T020000Z.sql.gz", old)
+	write("school-20261016T020000Z.sql.gz", old)
+	write("school-20261017T020000Z.sql.gz", old)
+	write("notes.txt", old)
+	write("school-20261016T020000Z.sql.gz"+checkSuffix, old)
+	if err := os.Symlink("school-20261015T020000Z.sql.gz", filepath.Join(dir, latestLink)); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCatalog(dir, nil)
+	list, err := c.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 || list[0].Name != "school-20261017T020000Z.sql.gz" {
+		t.Fatalf("список: %+v", list)
+	}
+	if !list[0].CreatedAt.Equal(time.Date(2026, 10, 17, 2, 0, 0, 0, time.UTC)) {
+		t.Fatalf("время из имени: %v", list[0].CreatedAt)
+	}
+	if e, err := c.Get(list[1].ID); err != nil || e.Name != list[1].Name {
+		t.Fatalf("Get: %v %v", e, err)
+	}
+
+	pruned, err := c.Prune(Retention{Daily: 1}, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 15-е держит симлинк latest.sql.gz
+	if len(pruned) != 1 || pruned[0].Name != "school-20261016T020000Z.sql.gz" {
+		t.Fatalf("удалены %+v", pruned)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "school-20261016T020000Z.sql.gz"+checkSuffix)); !os.IsNotExist(err) {
+		t.Fatal("результат проверки удалённого бэкапа остался")
+	}
+	if list, _ := c.List(); len(list) != 2 {
+		t.Fatalf("после очистки: %+v", list)
+	}
+}
+
+func TestCopyTextFields(t *testing.T) {
+	got := copyTextFields(`1	\N	Иванов\tИван	a\\b\nc	\x41\101`)
+	want := []any{"1", nil, "Иванов\tИван", "a\\b\nc", "AA"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("%#v", got)
+	}
+}
+
+func TestSkipDumpStatement(t *testing.T) {
+	for q, skip := range map[string]bool{
+		"SET statement_timeout = 0;":                                    true,
+		"SELECT pg_catalog.set_config('search_path', '', false);":       true,
+		"CREATE EXTENSION IF NOT EXISTS btree_gist WITH SCHEMA public;": true,
+		"ALTER TABLE public.users OWNER TO school;":                     true,
+		"CREATE TABLE public.users (\n    id bigint NOT NULL\n);":       false,
+		"SELECT pg_catalog.setval('public.users_id_seq', 5, true);":     false,
+	} {
+		if skipDumpStatement(q) != skip {
+			t.Errorf("%q: skip=%v", q, !skip)
+		}
+	}
+	if got := publicRe.ReplaceAllString("SELECT pg_catalog.setval('public.users_id_seq', 1) FROM my_public.x", scratchSchema+"."); got !=
+		"SELECT pg_catalog.setval('backup_check.users_id_seq', 1) FROM my_public.x" {
+		t.Fatal(got)
+	}
+}
+
+func TestCatalogSeal(t *testing.T) {
+	dir := t.TempDir()
+	keys, err := ParseKeyring("k1:"+testKey(t), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := "school-20261017T020000Z.sql.gz"
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("дамп"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+checkSuffix), []byte(`{"ok":true,"schema_version":24}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	_ = os.Chtimes(filepath.Join(dir, name), old, old)
+
+	c := NewCatalog(dir, keys)
+	sealed, err := c.SealAll(time.Now())
+	if err != nil || len(sealed) != 1 {
+		t.Fatalf("зашифровано %d: %v", len(sealed), err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+		t.Fatal("открытый дамп остался в каталоге")
+	}
+	e, err := c.GetByName(name + EncryptedExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.Encrypted || e.SchemaVersion != 24 || e.Check == nil {
+		t.Fatalf("запись после шифрования: %+v", e)
+	}
+
+	path, cleanup, err := c.Decrypted(e, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := os.ReadFile(path)
+	cleanup()
+	if string(b) != "дамп" || filepath.Ext(path) != ".gz" {
+		t.Fatalf("расшифровано %q в %s", b, path)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("расшифрованная копия не удалена")
+	}
+}
@@ -0,0 +1,274 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Шифрование бэкапов: AES-256-GCM потоком по кускам по 64 КБ (схема STREAM).
+//
+//	заголовок: "TSBENC01" | длина ID ключа (1 байт) | ID ключа | префикс nonce (7 байт)
+//	куски:     шифротекст куска + тег GCM; nonce = префикс | номер куска (4 байта) | 1 у последнего
+//
+// Заголовок — дополнительные данные каждого куска: подменить ID ключа, переставить
+// или отрезать куски незаметно нельзя. ID ключа в заголовке позволяет менять ключи:
+// новые бэкапы шифруются текущим, старые расшифровываются тем, которым были зашифрованы.
+
+// EncryptedExt — расширение зашифрованного бэкапа: school-….sql.gz.enc, school_db_….zip.enc.
+const EncryptedExt = ".enc"
+
+const (
+	encMagic     = "TSBENC01"
+	encChunk     = 64 << 10
+	encPrefixLen = 7
+)
+
+var (
+	ErrNotEncrypted = errors.New("файл не зашифрован ключом бота")
+	ErrUnknownKey   = errors.New("нет ключа для расшифровки")
+)
+
+// IsEncrypted — зашифрованный бэкап по имени файла.
+func IsEncrypted(name string) bool { return strings.HasSuffix(strings.ToLower(name), EncryptedExt) }
+
+// SniffEncrypted проверяет по заголовку, что поток зашифрован ключом бота, а не только назван .enc.
+// Возвращает reader, который отдаёт поток целиком, вместе с прочитанным заголовком.
+func SniffEncrypted(r io.Reader) (io.Reader, bool, error) {
+	head := make([]byte, len(encMagic))
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, false, err
+	}
+	return io.MultiReader(bytes.NewReader(head[:n]), r), string(head[:n]) == encMagic, nil
+}
+
+// PlainName — имя файла без .enc.
+func PlainName(name string) string {
+	if IsEncrypted(name) {
+		return name[:len(name)-len(EncryptedExt)]
+	}
+	return name
+}
+
+// Keyring — ключи шифрования по ID. nil — шифрование выключено.
+type Keyring struct {
+	keys    map[string][]byte
+	current string
+}
+
+// ParseKeyring разбирает «id:ключ,id2:ключ2», ключ — 32 байта в base64 (openssl rand -base64 32).
+// current — ID ключа для новых бэкапов, пусто — первый в списке. Пустой spec — шифрование выключено.
+func ParseKeyring(spec, current string) (*Keyring, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	k := &Keyring{keys: map[string][]byte{}}
+	for _, part := range strings.Split(spec, ",") {
+		id, b64key, ok := strings.Cut(strings.TrimSpace(part), ":")
+		id = strings.TrimSpace(id)
+		if !ok || id == "" || len(id) > 255 {
+			return nil, fmt.Errorf("ключ %q: нужен формат id:base64", part)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(b64key))
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("ключ %q: нужно 32 байта в base64", id)
+		}
+		if _, dup := k.keys[id]; dup {
+			return nil, fmt.Errorf("ключ %q указан дважды", id)
+		}
+		k.keys[id] = key
+		if k.current == "" {
+			k.current = id
+		}
+	}
+	if current = strings.TrimSpace(current); current != "" {
+		if _, ok := k.keys[current]; !ok {
+			return nil, fmt.Errorf("текущий ключ %q не найден среди ключей", current)
+		}
+		k.current = current
+	}
+	return k, nil
+}
+
+// Enabled — включено ли шифрование.
+func (k *Keyring) Enabled() bool { return k != nil && len(k.keys) > 0 }
+
+// CurrentID — ID ключа, которым шифруются новые бэкапы.
+func (k *Keyring) CurrentID() string {
+	if !k.Enabled() {
+		return ""
+	}
+	return k.current
+}
+
+// Encrypt — поток шифрования текущим ключом в w. Close дописывает последний кусок.
+func (k *Keyring) Encrypt(w io.Writer) (io.WriteCloser, error) {
+	if !k.Enabled() {
+		return nil, ErrUnknownKey
+	}
+	aead, err := newAEAD(k.keys[k.current])
+	if err != nil {
+		return nil, err
+	}
+	hdr := make([]byte, 0, len(encMagic)+1+len(k.current)+encPrefixLen)
+	hdr = append(hdr, encMagic...)
+	hdr = append(hdr, byte(len(k.current)))
+	hdr = append(hdr, k.current...)
+	prefix := make([]byte, encPrefixLen)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	hdr = append(hdr, prefix...)
+	if _, err := w.Write(hdr); err != nil {
+		return nil, err
+	}
+	return &encWriter{w: w, aead: aead, hdr: hdr, prefix: prefix, buf: make([]byte, 0, encChunk)}, nil
+}
+
+// Decrypt — поток расшифровки; ключ выбирается по ID из заголовка.
+func (k *Keyring) Decrypt(r io.Reader) (io.Reader, string, error) {
+	head := make([]byte, len(encMagic)+1)
+	if _, err := io.ReadFull(r, head); err != nil || string(head[:len(encMagic)]) != encMagic {
+		return nil, "", ErrNotEncrypted
+	}
+	rest := make([]byte, int(head[len(encMagic)])+encPrefixLen)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, "", fmt.Errorf("%w: заголовок оборван", ErrCorrupted)
+	}
+	id := string(rest[:len(rest)-encPrefixLen])
+	if !k.Enabled() || k.keys[id] == nil {
+		return nil, id, fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+	aead, err := newAEAD(k.keys[id])
+	if err != nil {
+		return nil, id, err
+	}
+	return &encReader{
+		r: r, aead: aead,
+		hdr:    append(head, rest...),
+		prefix: rest[len(rest)-encPrefixLen:],
+		chunk:  make([]byte, encChunk+aead.Overhead()+1),
+	}, id, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(prefix []byte, n uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[encPrefixLen:], n)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+type encWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	hdr    []byte
+	prefix []byte
+	buf    []byte
+	n      uint32
+	closed bool
+}
+
+func (e *encWriter) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, errors.New("запись в закрытый поток шифрования")
+	}
+	written := 0
+	for len(p) > 0 {
+		// полный кусок уходит, только когда известно, что он не последний
+		if len(e.buf) == encChunk {
+			if err := e.flush(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(e.buf[len(e.buf):encChunk], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (e *encWriter) flush(last bool) error {
+	out := e.aead.Seal(nil, chunkNonce(e.prefix, e.n, last), e.buf, e.hdr)
+	e.n++
+	e.buf = e.buf[:0]
+	_, err := e.w.Write(out)
+	return err
+}
+
+func (e *encWriter) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	return e.flush(true)
+}
+
+type encReader struct {
+	r      io.Reader
+	aead   cipher.AEAD
+	hdr    []byte
+	prefix []byte
+	chunk  []byte // кусок + тег + 1 байт заглядывания вперёд
+	ahead  []byte // заглянувший байт следующего куска
+	plain  bytes.Reader
+	n      uint32
+	done   bool
+}
+
+func (d *encReader) Read(p []byte) (int, error) {
+	for d.plain.Len() == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+	return d.plain.Read(p)
+}
+
+func (d *encReader) next() error {
+	size := encChunk + d.aead.Overhead()
+	buf := d.chunk[:0]
+	buf = append(buf, d.ahead...)
+	n, err := io.ReadFull(d.r, d.chunk[len(buf):size+1])
+	buf = d.chunk[:len(buf)+n]
+	switch {
+	case err == nil:
+		// прочитали байт следующего куска — этот не последний
+		d.ahead = append(d.ahead[:0], buf[size])
+		buf = buf[:size]
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		d.done = true
+	default:
+		return err
+	}
+	pt, err := d.aead.Open(nil, chunkNonce(d.prefix, d.n, d.done), buf, d.hdr)
+	if err != nil {
+		return fmt.Errorf("%w: не удалось расшифровать (неверный ключ или файл изменён)", ErrCorrupted)
+	}
+	d.n++
+	d.plain.Reset(pt)
+	return nil
+}
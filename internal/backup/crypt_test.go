@@ -0,0 +1,153 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"testing"
+)
+
+func testKey(t *testing.T) string {
+	t.Helper()
+	k := make([]byte, 32)
+	if _, err := rand.Read(k); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(k)
+}
+
+func encrypt(t *testing.T, k *Keyring, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := k.Encrypt(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// пишем неровными порциями, чтобы границы записей не совпадали с кусками
+	for p := data; len(p) > 0; {
+		n := min(len(p), 10000)
+		if _, err := w.Write(p[:n]); err != nil {
+			t.Fatal(err)
+		}
+		p = p[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decrypt(k *Keyring, enc []byte) ([]byte, string, error) {
+	r, id, err := k.Decrypt(bytes.NewReader(enc))
+	if err != nil {
+		return nil, id, err
+	}
+	out, err := io.ReadAll(r)
+	return out, id, err
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	k, err := ParseKeyring("2026a:"+testKey(t), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{0, 1, encChunk - 1, encChunk, encChunk + 1, 3*encChunk + 123} {
+		data := make([]byte, size)
+		_, _ = rand.Read(data)
+		got, id, err := decrypt(k, encrypt(t, k, data))
+		if err != nil {
+			t.Fatalf("%d байт: %v", size, err)
+		}
+		if id != "2026a" || !bytes.Equal(got, data) {
+			t.Fatalf("%d байт: данные не совпали (ключ %q)", size, id)
+		}
+	}
+}
+
+func TestEncryptKeyRotation(t *testing.T) {
+	oldKey, newKey := testKey(t), testKey(t)
+	before, _ := ParseKeyring("old:"+oldKey, "")
+	enc := encrypt(t, before, []byte("Иванов Иван, 7А"))
+
+	// новый ключ стал текущим, старый оставлен для расшифровки
+	after, err := ParseKeyring("old:"+oldKey+", new:"+newKey, "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.CurrentID() != "new" {
+		t.Fatalf("текущий ключ %q", after.CurrentID())
+	}
+	if got, id, err := decrypt(after, enc); err != nil || id != "old" || string(got) != "Иванов Иван, 7А" {
+		t.Fatalf("старый бэкап: %q %q %v", got, id, err)
+	}
+	if _, id, _ := decrypt(after, encrypt(t, after, []byte("x"))); id != "new" {
+		t.Fatalf("новый бэкап зашифрован ключом %q", id)
+	}
+
+	// без старого ключа — понятная ошибка
+	onlyNew, _ := ParseKeyring("new:"+newKey, "")
+	if _, _, err := decrypt(onlyNew, enc); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("ожидали ErrUnknownKey, получили %v", err)
+	}
+}
+
+func TestDecryptRejectsTampering(t *testing.T) {
+	k, _ := ParseKeyring("k:"+testKey(t), "")
+	data := make([]byte, 2*encChunk+10)
+	enc := encrypt(t, k, data)
+
+	flipped := append([]byte(nil), enc...)
+	flipped[len(flipped)/2] ^= 1
+	cut := enc[:len(enc)-(10+16)] // отрезан последний кусок целиком
+	for name, b := range map[string][]byte{"изменён байт": flipped, "обрезан": cut} {
+		if _, _, err := decrypt(k, b); !errors.Is(err, ErrCorrupted) {
+			t.Errorf("%s: ожидали ErrCorrupted, получили %v", name, err)
+		}
+	}
+	if _, _, err := decrypt(k, []byte("PK\x03\x04 обычный zip")); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("незашифрованный файл: %v", err)
+	}
+}
+
+func TestParseKeyring(t *testing.T) {
+	if k, err := ParseKeyring("  ", ""); err != nil || k.Enabled() {
+		t.Fatalf("пустая настройка должна выключать шифрование: %v", err)
+	}
+	for _, spec := range []string{"nokey", "a:bm90LWEta2V5", "a:" + testKey(t) + ",a:" + testKey(t)} {
+		if _, err := ParseKeyring(spec, ""); err == nil {
+			t.Errorf("%q: ожидали ошибку", spec)
+		}
+	}
+	if _, err := ParseKeyring("a:"+testKey(t), "b"); err == nil {
+		t.Error("неизвестный текущий ключ должен быть ошибкой")
+	}
+}
+
+func TestSniffEncrypted(t *testing.T) {
+	k, err := ParseKeyring("2026a:"+testKey(t), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := encrypt(t, k, []byte("PK\x03\x04 zip"))
+	for _, tc := range []struct {
+		data []byte
+		want bool
+	}{
+		{enc, true},
+		{[]byte("PK\x03\x04 zip"), false},
+		{[]byte("TSB"), false},
+		{nil, false},
+	} {
+		r, got, err := SniffEncrypted(bytes.NewReader(tc.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// заголовок не должен пропасть из потока
+		rest, _ := io.ReadAll(r)
+		if got != tc.want || !bytes.Equal(rest, tc.data) {
+			t.Fatalf("%q: зашифрован=%v, поток %q", tc.data, got, rest)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package backup
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var (
+	ErrNoManifest = errors.New("в архиве нет manifest.json")
+	ErrFormat     = errors.New("неизвестный формат архива")
+	ErrCorrupted  = errors.New("архив повреждён")
+)
+
+// ReadManifest читает manifest.json архива. Старые архивы без манифеста — ErrNoManifest.
+func ReadManifest(zr *zip.Reader) (*Manifest, error) {
+	for _, f := range zr.File {
+		if f.Name != ManifestName {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = rc.Close() }()
+		var m Manifest
+		if err := json.NewDecoder(io.LimitReader(rc, 1<<20)).Decode(&m); err != nil {
+			return nil, fmt.Errorf("%w: manifest.json: %v", ErrCorrupted, err)
+		}
+		if m.Format != Format {
+			return nil, fmt.Errorf("%w: %q", ErrFormat, m.Format)
+		}
+		return &m, nil
+	}
+	return nil, ErrNoManifest
+}
+
+// Verify сверяет CSV архива с манифестом: контрольные суммы, число строк и то,
+// что в data/ нет таблиц, которых нет в манифесте.
+func Verify(zr *zip.Reader, m *Manifest) error {
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		if strings.HasPrefix(f.Name, "data/") && strings.HasSuffix(f.Name, ".csv") {
+			files[f.Name] = f
+		}
+	}
+	for _, t := range m.Tables {
+		f, ok := files[t.File]
+		if !ok {
+			return fmt.Errorf("%w: нет файла %s", ErrCorrupted, t.File)
+		}
+		delete(files, t.File)
+		sum, rows, err := csvStats(f)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrCorrupted, t.File, err)
+		}
+		if sum != t.SHA256 {
+			return fmt.Errorf("%w: %s: контрольная сумма не совпадает", ErrCorrupted, t.File)
+		}
+		if rows != t.Rows {
+			return fmt.Errorf("%w: %s: строк %d, в манифесте %d", ErrCorrupted, t.File, rows, t.Rows)
+		}
+	}
+	for name := range files {
+		return fmt.Errorf("%w: файла %s нет в манифесте", ErrCorrupted, name)
+	}
+	return nil
+}
+
+// csvStats — sha256 файла и число строк данных (без заголовка).
+func csvStats(f *zip.File) (string, int64, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() { _ = rc.Close() }()
+	h := sha256.New()
+	r := csv.NewReader(io.TeeReader(rc, h))
+	r.FieldsPerRecord = -1
+	var rows int64
+	for {
+		_, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", 0, err
+		}
+		rows++
+	}
+	if rows > 0 {
+		rows-- // заголовок
+	}
+	// дочитываем хвост, если csv.Reader остановился раньше конца файла
+	if _, err := io.Copy(h, rc); err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), rows, nil
+}
@@ -0,0 +1,188 @@
+package backup
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RequiredTables — без этих таблиц бот не работает; бэкап без них восстанавливать нельзя.
+var RequiredTables = []string{"users", "classes", "categories", "periods", "scores"}
+
+// TableChange — сколько строк в таблице сейчас и сколько будет после восстановления.
+type TableChange struct {
+	Table  string `json:"table"`
+	Before int64  `json:"before"`
+	After  int64  `json:"after"`
+}
+
+// Plan — пробный запуск восстановления: что изменится и можно ли восстанавливать.
+type Plan struct {
+	ArchiveVersion int64 // версия схемы бэкапа, 0 — неизвестна
+	TargetVersion  int64 // версия схемы встроенных миграций бота
+	Changes        []TableChange
+	Unchanged      int
+	Problems       []string // восстановление запрещено
+	Warnings       []string
+}
+
+// OK — восстанавливать можно.
+func (p *Plan) OK() bool { return len(p.Problems) == 0 }
+
+// Migrated — после восстановления дампа будут применены миграции.
+func (p *Plan) Migrated() bool {
+	return p.ArchiveVersion > 0 && p.ArchiveVersion < p.TargetVersion
+}
+
+// PlanRestore сравнивает проверенный бэкап с текущей БД: версию схемы с миграциями бота
+// (target), наличие обязательных таблиц и число строк по таблицам. deps — внешние ключи
+// текущей БД (см. ForeignKeys): по ним видно, какие таблицы очистит TRUNCATE … CASCADE.
+func PlanRestore(ch *Check, current map[string]int64, deps map[string][]string, target int64) *Plan {
+	p := &Plan{ArchiveVersion: ch.SchemaVersion, TargetVersion: target}
+	if !ch.OK {
+		p.Problems = append(p.Problems, "пробное восстановление не удалось: "+ch.Error)
+		return p
+	}
+
+	switch {
+	case ch.SchemaVersion > target:
+		p.Problems = append(p.Problems, fmt.Sprintf(
+			"бэкап сделан более новой версией бота: схема %d, бот знает только до %d", ch.SchemaVersion, target))
+	case ch.SchemaVersion == 0:
+		p.Warnings = append(p.Warnings, "версия схемы бэкапа неизвестна — данные ложатся в текущие таблицы")
+	case ch.SchemaVersion < target:
+		p.Warnings = append(p.Warnings, fmt.Sprintf(
+			"бэкап на схеме %d: после восстановления будут применены миграции до %d", ch.SchemaVersion, target))
+	}
+
+	var missing []string
+	for _, t := range RequiredTables {
+		if _, ok := ch.Counts[t]; !ok {
+			missing = append(missing, t)
+		}
+	}
+	if len(missing) > 0 {
+		p.Problems = append(p.Problems, "в бэкапе нет обязательных таблиц: "+strings.Join(missing, ", "))
+	}
+
+	cascaded := truncatedWith(ch.Counts, current, deps)
+	var cleared, kept []string
+	for t, before := range current {
+		if _, ok := ch.Counts[t]; ok {
+			continue
+		}
+		if !cascaded[t] {
+			kept = append(kept, t)
+			continue
+		}
+		cleared = append(cleared, t)
+		if before != 0 {
+			p.Changes = append(p.Changes, TableChange{Table: t, Before: before, After: 0})
+		} else {
+			p.Unchanged++
+		}
+	}
+	for t, n := range ch.Counts {
+		if before := current[t]; before != n {
+			p.Changes = append(p.Changes, TableChange{Table: t, Before: before, After: n})
+		} else {
+			p.Unchanged++
+		}
+	}
+	if len(cleared) > 0 {
+		sort.Strings(cleared)
+		p.Warnings = append(p.Warnings, "нет в бэкапе и будут очищены (ссылаются на восстанавливаемые таблицы): "+strings.Join(cleared, ", "))
+	}
+	if len(kept) > 0 {
+		sort.Strings(kept)
+		p.Warnings = append(p.Warnings, "нет в бэкапе, останутся как есть: "+strings.Join(kept, ", "))
+	}
+	// бэкап чужой школы или почти пустой копии видно по пользователям
+	if before, after := current["users"], ch.Counts["users"]; before >= 10 && after*2 < before {
+		p.Warnings = append(p.Warnings, fmt.Sprintf(
+			"пользователей станет %d вместо %d — проверьте, что это бэкап вашей школы", after, before))
+	}
+
+	sort.Slice(p.Changes, func(i, j int) bool {
+		di, dj := abs(p.Changes[i].After-p.Changes[i].Before), abs(p.Changes[j].After-p.Changes[j].Before)
+		if di != dj {
+			return di > dj
+		}
+		return p.Changes[i].Table < p.Changes[j].Table
+	})
+	return p
+}
+
+// truncatedWith — таблицы, которые TRUNCATE … CASCADE очистит вместе с таблицами архива:
+// все, кто прямо или через другие таблицы ссылается на них внешним ключом.
+func truncatedWith(archived, current map[string]int64, deps map[string][]string) map[string]bool {
+	referencedBy := map[string][]string{}
+	for child, parents := range deps {
+		for _, parent := range parents {
+			referencedBy[parent] = append(referencedBy[parent], child)
+		}
+	}
+	out := map[string]bool{}
+	var queue []string
+	for t := range archived {
+		// таблицы, которой нет в БД, восстановление пропускает
+		if _, ok := current[t]; ok {
+			out[t] = true
+			queue = append(queue, t)
+		}
+	}
+	for len(queue) > 0 {
+		t := queue[0]
+		queue = queue[1:]
+		for _, child := range referencedBy[t] {
+			if !out[child] {
+				out[child] = true
+				queue = append(queue, child)
+			}
+		}
+	}
+	return out
+}
+
+// CheckRestored сверяет БД после восстановления с бэкапом. После миграций сверяются
+// только обязательные таблицы: миграции могут дописывать служебные данные.
+func (p *Plan) CheckRestored(ch *Check, after map[string]int64) error {
+	want := ch.Counts
+	if p.Migrated() {
+		want = make(map[string]int64, len(RequiredTables))
+		for _, t := range RequiredTables {
+			want[t] = ch.Counts[t]
+		}
+	}
+	return CompareCounts(want, after)
+}
+
+// CompareCounts — в БД (got) те же таблицы из want с тем же числом строк.
+func CompareCounts(want, got map[string]int64) error {
+	tables := make([]string, 0, len(want))
+	for t := range want {
+		tables = append(tables, t)
+	}
+	sort.Strings(tables)
+	var bad []string
+	for _, t := range tables {
+		n, ok := got[t]
+		switch {
+		case !ok:
+			bad = append(bad, t+": таблицы нет")
+		case n != want[t]:
+			bad = append(bad, fmt.Sprintf("%s: %d строк вместо %d", t, n, want[t]))
+		}
+	}
+	if len(bad) > 0 {
+		return fmt.Errorf("БД после восстановления не совпадает с бэкапом: %s", strings.Join(bad, "; "))
+	}
+	return nil
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,66 @@
+package backup
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPlanRestore(t *testing.T) {
+	current := map[string]int64{
+		"users": 100, "classes": 20, "categories": 5, "periods": 2, "scores": 900,
+		"outbox": 3, "notify_prefs": 12, "calendar_tokens": 0, "consult_requests": 0, "consult_waitlist": 4,
+	}
+	// consult_waitlist ссылается на users не напрямую, а через consult_requests
+	deps := map[string][]string{
+		"scores": {"users", "categories", "periods"}, "notify_prefs": {"users"},
+		"calendar_tokens": {"users"}, "consult_waitlist": {"consult_requests"}, "consult_requests": {"users"},
+	}
+	ch := &Check{OK: true, SchemaVersion: 22, Counts: map[string]int64{
+		"users": 40, "classes": 20, "categories": 5, "periods": 3, "scores": 300,
+	}}
+
+	p := PlanRestore(ch, current, deps, 24)
+	if !p.OK() {
+		t.Fatalf("проблемы: %v", p.Problems)
+	}
+	if !p.Migrated() {
+		t.Fatal("бэкап старее бота — ожидали миграции")
+	}
+	// + notify_prefs и consult_waitlist обнулятся, calendar_tokens и consult_requests уже пусты
+	if p.Unchanged != 4 || len(p.Changes) != 5 || p.Changes[0].Table != "scores" {
+		t.Fatalf("изменения: %+v, без изменений %d", p.Changes, p.Unchanged)
+	}
+	warn := strings.Join(p.Warnings, "\n")
+	for _, s := range []string{
+		"миграции до 24", "пользователей станет 40 вместо 100",
+		"будут очищены (ссылаются на восстанавливаемые таблицы): calendar_tokens, consult_requests, consult_waitlist, notify_prefs",
+		"останутся как есть: outbox",
+	} {
+		if !strings.Contains(warn, s) {
+			t.Errorf("нет предупреждения %q в %q", s, warn)
+		}
+	}
+
+	// после миграций сверяются только обязательные таблицы
+	after := map[string]int64{"users": 40, "classes": 20, "categories": 5, "periods": 3, "scores": 300, "score_ledger": 7}
+	if err := p.CheckRestored(ch, after); err != nil {
+		t.Fatal(err)
+	}
+	after["users"] = 39
+	if err := p.CheckRestored(ch, after); err == nil || !strings.Contains(err.Error(), "users: 39 строк вместо 40") {
+		t.Fatalf("ожидали расхождение по users, получили %v", err)
+	}
+
+	newer := PlanRestore(&Check{OK: true, SchemaVersion: 30, Counts: ch.Counts}, current, deps, 24)
+	if newer.OK() {
+		t.Fatal("бэкап новее бота восстанавливать нельзя")
+	}
+	partial := PlanRestore(&Check{OK: true, SchemaVersion: 24, Counts: map[string]int64{"users": 1}}, current, deps, 24)
+	if partial.OK() || !strings.Contains(partial.Problems[0], "classes, categories, periods, scores") {
+		t.Fatalf("проблемы: %v", partial.Problems)
+	}
+	failed := PlanRestore(&Check{Error: "insert or update violates foreign key"}, current, deps, 24)
+	if failed.OK() {
+		t.Fatal("непрошедший проверку бэкап восстанавливать нельзя")
+	}
+}
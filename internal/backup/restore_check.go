@@ -0,0 +1,533 @@
+package backup
+
+import (
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// scratchSchema — схема пробного восстановления. Она живёт только внутри транзакции,
+// которая в конце откатывается: рабочие таблицы и место на диске не затрагиваются.
+const scratchSchema = "backup_check"
+
+// TestRestore восстанавливает бэкап (*.zip, *.sql.gz, *.sql) во временную схему и
+// считает, что в неё попало. Ошибка — бэкап восстановить не удалось.
+func TestRestore(ctx context.Context, database *sql.DB, path string) (*Check, error) {
+	tx, err := database.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// две проверки одновременно ждут друг друга, а не спорят за одну схему
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, scratchSchema); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `CREATE SCHEMA `+scratchSchema); err != nil {
+		return nil, err
+	}
+
+	ch := &Check{}
+	name := strings.ToLower(filepath.Base(path))
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		err = checkZip(ctx, tx, path, ch)
+	case strings.HasSuffix(name, ".sql.gz"), strings.HasSuffix(name, ".sql"):
+		err = checkDump(ctx, tx, path, ch)
+	default:
+		err = fmt.Errorf("%w: %s", ErrFormat, filepath.Base(path))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := scratchStats(ctx, tx, ch); err != nil {
+		return nil, err
+	}
+	ch.OK = true
+	return ch, nil
+}
+
+// scratchStats — таблицы и строки временной схемы; версию схемы дамп несёт в таблице goose.
+func scratchStats(ctx context.Context, tx *sql.Tx, ch *Check) error {
+	counts, err := tableCounts(ctx, tx, scratchSchema)
+	if err != nil {
+		return err
+	}
+	ch.Counts, ch.Tables, ch.Rows = counts, len(counts), 0
+	for _, n := range counts {
+		ch.Rows += n
+	}
+
+	var reg sql.NullString
+	if err := tx.QueryRowContext(ctx, `SELECT to_regclass($1)::text`, scratchSchema+"."+gooseTable).Scan(&reg); err != nil {
+		return err
+	}
+	if reg.Valid {
+		return tx.QueryRowContext(ctx,
+			`SELECT COALESCE(MAX(version_id), 0) FROM `+scratchSchema+`.`+gooseTable+` WHERE is_applied`).Scan(&ch.SchemaVersion)
+	}
+	return nil
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// TableCounts — строки в таблицах рабочей схемы (без служебной таблицы goose).
+func TableCounts(ctx context.Context, database *sql.DB) (map[string]int64, error) {
+	return tableCounts(ctx, database, "public")
+}
+
+func tableCounts(ctx context.Context, q queryer, schema string) (map[string]int64, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT c.relname FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relkind = 'r' AND c.relname <> $2
+	`, schema, gooseTable)
+	if err != nil {
+		return nil, err
+	}
+	var tables []string
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(tables))
+	for _, t := range tables {
+		var n int64
+		if err := q.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+quoteIdent(schema)+`.`+quoteIdent(t)).Scan(&n); err != nil {
+			return nil, err
+		}
+		counts[t] = n
+	}
+	return counts, nil
+}
+
+// checkZip — таблицы создаются по образцу текущей схемы (LIKE public.<t>), данные
+// грузятся через COPY, затем навешиваются внешние ключи — так проверяется и ссылочная целостность.
+func checkZip(ctx context.Context, tx *sql.Tx, path string, ch *Check) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCorrupted, err)
+	}
+	defer func() { _ = zr.Close() }()
+
+	m, err := ReadManifest(&zr.Reader)
+	switch {
+	case err == nil:
+		if err := Verify(&zr.Reader, m); err != nil {
+			return err
+		}
+		ch.SchemaVersion = m.SchemaVersion
+	case !errors.Is(err, ErrNoManifest):
+		return err
+	}
+	strict := m != nil
+
+	var loaded []string
+	for _, f := range zr.File {
+		if !strings.HasPrefix(f.Name, "data/") || !strings.HasSuffix(f.Name, ".csv") {
+			continue
+		}
+		table := strings.TrimSuffix(filepath.Base(f.Name), ".csv")
+		var reg sql.NullString
+		if err := tx.QueryRowContext(ctx, `SELECT to_regclass($1)::text`, "public."+quoteIdent(table)).Scan(&reg); err != nil {
+			return err
+		}
+		if !reg.Valid {
+			return fmt.Errorf("таблицы %s нет в текущей схеме БД", table)
+		}
+		if _, err := tx.ExecContext(ctx, `CREATE TABLE `+scratchSchema+`.`+quoteIdent(table)+
+			` (LIKE public.`+quoteIdent(table)+` INCLUDING ALL)`); err != nil {
+			return fmt.Errorf("%s: %w", table, err)
+		}
+		if err := copyCSV(ctx, tx, table, f, strict); err != nil {
+			return fmt.Errorf("%s: %w", table, err)
+		}
+		loaded = append(loaded, table)
+	}
+	if len(loaded) == 0 {
+		return errors.New("в архиве нет data/*.csv")
+	}
+	return addForeignKeys(ctx, tx, loaded)
+}
+
+func copyCSV(ctx context.Context, tx *sql.Tx, table string, f *zip.File, strict bool) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rc.Close() }()
+	r := csv.NewReader(rc)
+	header, err := r.Read()
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	notNull, err := notNullTextColumns(ctx, tx, table)
+	if err != nil {
+		return err
+	}
+
+	cols := make([]string, len(header))
+	for i, c := range header {
+		cols[i] = quoteIdent(strings.TrimSpace(c))
+	}
+	ins := newRowInserter(ctx, tx, scratchSchema+`.`+quoteIdent(table), cols)
+	for {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(rec) != len(header) {
+			return fmt.Errorf("строка из %d полей, в заголовке %d", len(rec), len(header))
+		}
+		vals := make([]any, len(header))
+		for i, v := range rec {
+			// как при восстановлении
+			if s, null := decodeCell(v, strict, notNull[strings.TrimSpace(header[i])]); !null {
+				vals[i] = s
+			}
+		}
+		if err := ins.Add(vals); err != nil {
+			return err
+		}
+	}
+	return ins.Flush()
+}
+
+// rowInserter вставляет строки пачками. COPY через database/sql умеет только lib/pq,
+// а бот работает через pgx — поэтому обычный INSERT на много строк.
+type rowInserter struct {
+	ctx    context.Context
+	tx     *sql.Tx
+	prefix string
+	ncol   int
+	args   []any
+	rows   int
+}
+
+// insertBatchRows — строк в одном INSERT; параметров в запросе не больше 65535.
+const insertBatchRows = 500
+
+func newRowInserter(ctx context.Context, tx *sql.Tx, table string, quotedCols []string) *rowInserter {
+	return &rowInserter{
+		ctx: ctx, tx: tx, ncol: len(quotedCols),
+		prefix: `INSERT INTO ` + table + ` (` + strings.Join(quotedCols, ", ") + `) VALUES `,
+	}
+}
+
+func (r *rowInserter) Add(vals []any) error {
+	if len(vals) != r.ncol {
+		return fmt.Errorf("строка из %d полей, колонок %d", len(vals), r.ncol)
+	}
+	r.args = append(r.args, vals...)
+	r.rows++
+	if r.rows == insertBatchRows || len(r.args)+r.ncol > 65535 {
+		return r.Flush()
+	}
+	return nil
+}
+
+func (r *rowInserter) Flush() error {
+	if r.rows == 0 {
+		return nil
+	}
+	var b strings.Builder
+	b.WriteString(r.prefix)
+	n := 0
+	for i := 0; i < r.rows; i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		for j := 0; j < r.ncol; j++ {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+		}
+		b.WriteByte(')')
+	}
+	_, err := r.tx.ExecContext(r.ctx, b.String(), r.args...)
+	r.args, r.rows = r.args[:0], 0
+	return err
+}
+
+func notNullTextColumns(ctx context.Context, tx *sql.Tx, table string) (map[string]bool, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT column_name FROM information_schema.columns
+		WHERE table_schema = $1 AND table_name = $2 AND is_nullable = 'NO'
+		  AND data_type IN ('text', 'character varying', 'character')
+	`, scratchSchema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	m := map[string]bool{}
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			return nil, err
+		}
+		m[c] = true
+	}
+	return m, rows.Err()
+}
+
+// addForeignKeys переносит внешние ключи public между загруженными таблицами.
+func addForeignKeys(ctx context.Context, tx *sql.Tx, tables []string) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT cl.relname, co.conname, pg_get_constraintdef(co.oid)
+		FROM pg_constraint co
+		JOIN pg_class cl  ON cl.oid = co.conrelid
+		JOIN pg_class ref ON ref.oid = co.confrelid
+		JOIN pg_namespace n ON n.oid = cl.relnamespace
+		WHERE co.contype = 'f' AND n.nspname = 'public'
+		  AND cl.relname = ANY(string_to_array($1, ',')) AND ref.relname = ANY(string_to_array($1, ','))
+	`, strings.Join(tables, ","))
+	if err != nil {
+		return err
+	}
+	type fk struct{ table, name, def string }
+	var fks []fk
+	for rows.Next() {
+		var f fk
+		if err := rows.Scan(&f.table, &f.name, &f.def); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		fks = append(fks, f)
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	// определения ключей без схемы (public в search_path): теперь они указывают на копии
+	if _, err := tx.ExecContext(ctx, `SET LOCAL search_path = `+scratchSchema+`, public`); err != nil {
+		return err
+	}
+	for _, f := range fks {
+		if _, err := tx.ExecContext(ctx, `ALTER TABLE `+quoteIdent(f.table)+
+			` ADD CONSTRAINT `+quoteIdent(f.name)+` `+f.def); err != nil {
+			return fmt.Errorf("%s: %w", f.table, err)
+		}
+	}
+	return nil
+}
+
+// publicRe — ссылка на схему public в дампе; pg_dump пишет все имена со схемой.
+var publicRe = regexp.MustCompile(`\bpublic\.`)
+
+// checkDump выполняет текстовый дамп pg_dump, заменив схему public на временную.
+// Служебное (SET, расширения, сама схема, права) пропускается; данные COPY вставляются INSERT'ом.
+func checkDump(ctx context.Context, tx *sql.Tx, path string, ch *Check) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	var r io.Reader = f
+	if strings.HasSuffix(strings.ToLower(path), ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrCorrupted, err)
+		}
+		defer func() { _ = gz.Close() }()
+		r = gz
+	}
+	if _, err := tx.ExecContext(ctx, `SET LOCAL search_path = `+scratchSchema+`, public`); err != nil {
+		return err
+	}
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 64<<20)
+	var stmt strings.Builder
+	statements := 0
+	for sc.Scan() {
+		line := sc.Text()
+		if stmt.Len() == 0 {
+			t := strings.TrimSpace(line)
+			// комментарии и метакоманды psql (\connect, \restrict …)
+			if t == "" || strings.HasPrefix(t, "--") || strings.HasPrefix(t, `\`) {
+				continue
+			}
+		}
+		stmt.WriteString(line)
+		stmt.WriteByte('\n')
+		if !strings.HasSuffix(strings.TrimSpace(line), ";") {
+			continue
+		}
+		q := strings.TrimSpace(stmt.String())
+		stmt.Reset()
+		statements++
+
+		if strings.HasPrefix(q, "COPY ") && strings.HasSuffix(q, "FROM stdin;") {
+			q = publicRe.ReplaceAllString(strings.TrimSuffix(q, ";"), scratchSchema+".")
+			if err := copyDumpData(ctx, tx, q, sc); err != nil {
+				return err
+			}
+			continue
+		}
+		if skipDumpStatement(q) {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, publicRe.ReplaceAllString(q, scratchSchema+".")); err != nil {
+			return fmt.Errorf("%s: %w", firstLine(q), err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrCorrupted, err)
+	}
+	if stmt.Len() > 0 {
+		return fmt.Errorf("%w: дамп оборван", ErrCorrupted)
+	}
+	if statements == 0 {
+		return fmt.Errorf("%w: в дампе нет SQL", ErrCorrupted)
+	}
+	return nil
+}
+
+// copyStmtRe — заголовок блока данных pg_dump: COPY схема.таблица (колонки) FROM stdin;
+var copyStmtRe = regexp.MustCompile(`^COPY\s+(\S+)\s*\(([^)]*)\)\s+FROM stdin;$`)
+
+// copyDumpData — строки блока COPY … FROM stdin до «\.».
+func copyDumpData(ctx context.Context, tx *sql.Tx, q string, sc *bufio.Scanner) error {
+	m := copyStmtRe.FindStringSubmatch(q)
+	if m == nil {
+		return fmt.Errorf("%w: непонятный блок данных %s", ErrCorrupted, firstLine(q))
+	}
+	cols := strings.Split(m[2], ",")
+	for i := range cols {
+		cols[i] = strings.TrimSpace(cols[i])
+	}
+	ins := newRowInserter(ctx, tx, m[1], cols)
+	for sc.Scan() {
+		line := sc.Text()
+		if line == `\.` {
+			if err := ins.Flush(); err != nil {
+				return fmt.Errorf("%s: %w", firstLine(q), err)
+			}
+			return nil
+		}
+		if err := ins.Add(copyTextFields(line)); err != nil {
+			return fmt.Errorf("%s: %w", firstLine(q), err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrCorrupted, err)
+	}
+	return fmt.Errorf("%w: дамп оборван внутри %s", ErrCorrupted, firstLine(q))
+}
+
+func skipDumpStatement(q string) bool {
+	for _, p := range []string{
+		"SET ", "SELECT pg_catalog.set_config(", "CREATE EXTENSION", "COMMENT ON EXTENSION",
+		"CREATE SCHEMA", "COMMENT ON SCHEMA", "ALTER SCHEMA", "ALTER DEFAULT PRIVILEGES", "GRANT ", "REVOKE ",
+	} {
+		if strings.HasPrefix(q, p) {
+			return true
+		}
+	}
+	return strings.Contains(q, " OWNER TO ")
+}
+
+func firstLine(q string) string {
+	q, _, _ = strings.Cut(q, "\n")
+	if len(q) > 80 {
+		q = q[:80] + "…"
+	}
+	return q
+}
+
+// copyTextFields разбирает строку текстового формата COPY: поля через TAB, \N — NULL.
+func copyTextFields(line string) []any {
+	parts := strings.Split(line, "\t")
+	out := make([]any, len(parts))
+	for i, p := range parts {
+		if p == `\N` {
+			continue
+		}
+		out[i] = unescapeCopy(p)
+	}
+	return out
+}
+
+func unescapeCopy(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i+1 == len(s) {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch c = s[i]; c {
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'v':
+			b.WriteByte('\v')
+		case 'x':
+			j := i + 1
+			for j < len(s) && j < i+3 && isHex(s[j]) {
+				j++
+			}
+			if j == i+1 {
+				b.WriteByte('x')
+				continue
+			}
+			v, _ := strconv.ParseUint(s[i+1:j], 16, 8)
+			b.WriteByte(byte(v))
+			i = j - 1
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			j := i
+			for j < len(s) && j < i+3 && s[j] >= '0' && s[j] <= '7' {
+				j++
+			}
+			v, _ := strconv.ParseUint(s[i:j], 8, 8)
+			b.WriteByte(byte(v))
+			i = j - 1
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
@@ -0,0 +1,76 @@
+//go:build testutil
+// +build testutil
+
+package backup_test
+
+import (
+	"archive/zip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/backup"
+	"github.com/Spok95/telegram-school-bot/internal/testutil/testdb"
+)
+
+func TestTestRestore_Zip(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+	h, err := testdb.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	if _, err := h.DB.ExecContext(ctx, `
+		INSERT INTO users (telegram_id, name, role, confirmed) VALUES (1, 'Админ', 'admin', TRUE)`); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	good := filepath.Join(dir, "school_db_2026-10-17_1504.zip")
+	f, err := os.Create(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backup.WriteZip(ctx, h.DB, f); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	ch, err := backup.TestRestore(ctx, h.DB, good)
+	if err != nil {
+		t.Fatalf("целый архив не восстановился: %v", err)
+	}
+	if !ch.OK || ch.Tables == 0 || ch.Rows == 0 {
+		t.Fatalf("неожиданный результат: %+v", ch)
+	}
+
+	// старый архив без манифеста с «висячей» ссылкой на ученика
+	bad := filepath.Join(dir, "legacy.zip")
+	f, err = os.Create(bad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	w, _ := zw.Create("data/users.csv")
+	_, _ = w.Write([]byte("id,telegram_id,name,role,confirmed\n1,1,Админ,admin,true\n"))
+	w, _ = zw.Create("data/parents_students.csv")
+	_, _ = w.Write([]byte("parent_id,student_id\n1,200\n"))
+	_ = zw.Close()
+	_ = f.Close()
+	if _, err := backup.TestRestore(ctx, h.DB, bad); err == nil {
+		t.Fatal("архив с нарушенной ссылкой прошёл проверку")
+	}
+
+	// временная схема после проверки не остаётся
+	var n int
+	if err := h.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM pg_namespace WHERE nspname = 'backup_check'`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatal("схема backup_check осталась в БД")
+	}
+}
@@ -0,0 +1,54 @@
+package backup
+
+import (
+	"fmt"
+	"time"
+)
+
+// Retention — сколько копий хранить: самую свежую за каждый из последних Daily дней,
+// Weekly недель и Monthly месяцев (считаются только дни/недели/месяцы, где бэкапы есть).
+// Уровни складываются: копия остаётся, если её оставляет хотя бы один. 0 — уровень выключен.
+type Retention struct {
+	Daily, Weekly, Monthly int
+}
+
+// Enabled — задан ли хоть один уровень; без политики ничего не удаляется.
+func (p Retention) Enabled() bool { return p.Daily > 0 || p.Weekly > 0 || p.Monthly > 0 }
+
+func (p Retention) String() string {
+	if !p.Enabled() {
+		return "без удаления"
+	}
+	return fmt.Sprintf("%d дн. / %d нед. / %d мес.", p.Daily, p.Weekly, p.Monthly)
+}
+
+// Keep — имена бэкапов, которые оставляет политика. entries — новые первыми (как из List).
+// Самый новый бэкап остаётся всегда.
+func (p Retention) Keep(entries []Entry, loc *time.Location) map[string]bool {
+	keep := map[string]bool{}
+	if len(entries) == 0 {
+		return keep
+	}
+	keep[entries[0].Name] = true
+	tier := func(n int, bucket func(time.Time) string) {
+		seen := map[string]bool{}
+		for _, e := range entries {
+			if len(seen) >= n {
+				return
+			}
+			b := bucket(e.CreatedAt.In(loc))
+			if seen[b] {
+				continue
+			}
+			seen[b] = true
+			keep[e.Name] = true
+		}
+	}
+	tier(p.Daily, func(t time.Time) string { return t.Format("2006-01-02") })
+	tier(p.Weekly, func(t time.Time) string {
+		y, w := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", y, w)
+	})
+	tier(p.Monthly, func(t time.Time) string { return t.Format("2006-01") })
+	return keep
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
 	"time"
@@ -49,3 +50,16 @@ func RestoreLatest(ctx context.Context) (string, error) {
 	}
 	return s, nil
 }
+
+// Restore восстанавливает БД из конкретного дампа каталога (имя файла в /backups sidecar).
+func Restore(ctx context.Context, name string) (string, error) {
+	s, err := do(ctx, "/cgi-bin/restore?file="+url.QueryEscape(name), 5*time.Minute)
+	if err != nil {
+		return "", err
+	}
+	// при успехе скрипт печатает путь восстановленного файла, иначе — причину
+	if !strings.HasSuffix(s, "/"+name) {
+		return "", fmt.Errorf("restore %s: %s", name, s)
+	}
+	return s, nil
+}
@@ -8,7 +8,9 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
 	"github.com/Spok95/telegram-school-bot/internal/bot/handlers"
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmstore"
 	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmutil"
 	"github.com/Spok95/telegram-school-bot/internal/db"
 	"github.com/Spok95/telegram-school-bot/internal/metrics"
@@ -24,8 +26,8 @@ const (
 )
 
 var (
-	addChildFSM  = make(map[int64]string)
-	addChildData = make(map[int64]*ParentRegisterData)
+	addChildFSM  = fsmstore.NewMap[string]("add_child", 1, fsmstore.DefaultTTL)
+	addChildData = fsmstore.NewMap[*ParentRegisterData]("add_child_data", 1, fsmstore.DefaultTTL)
 )
 
 // ===== helpers (как в export/add/remove) =====
@@ -62,13 +64,16 @@ func addChildInlineClassNumbersFromDB(ctx context.Context, database *sql.DB) [][
 	}
 	sort.Ints(nums)
 
+	var bs callback.Buttons
 	var rows [][]tgbotapi.InlineKeyboardButton
 	for _, n := range nums {
-		cb := fmt.Sprintf("parent_class_num_%d", n)
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d класс", n), cb),
+			bs.Add(cbParentClassNum.Button(fmt.Sprintf("%d класс", n), n)),
 		))
 	}
+	if buttonsFailed(&bs) {
+		return [][]tgbotapi.InlineKeyboardButton{addChildBackCancelRow()}
+	}
 	rows = append(rows, addChildBackCancelRow())
 	return rows
 }
@@ -81,15 +86,19 @@ func addChildInlineClassLettersFromDB(ctx context.Context, database *sql.DB, num
 		}
 	}
 
+	var bs callback.Buttons
 	var rows [][]tgbotapi.InlineKeyboardButton
 	for _, c := range classes {
 		if c.Number != number {
 			continue
 		}
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(strings.ToUpper(c.Letter), "parent_class_letter_"+strings.ToUpper(c.Letter)),
+			bs.Add(cbParentClassLetter.Button(strings.ToUpper(c.Letter), strings.ToUpper(c.Letter))),
 		))
 	}
+	if buttonsFailed(&bs) {
+		return [][]tgbotapi.InlineKeyboardButton{addChildBackCancelRow()}
+	}
 	rows = append(rows, addChildBackCancelRow())
 	return rows
 }
@@ -103,8 +112,8 @@ func StartAddChild(ctx context.Context, bot *tgbotapi.BotAPI, msg *tgbotapi.Mess
 	default:
 	}
 	chatID := msg.Chat.ID
-	addChildFSM[chatID] = StateAddChildName
-	addChildData[chatID] = &ParentRegisterData{}
+	addChildFSM.Set(ctx, chatID, StateAddChildName)
+	addChildData.Set(ctx, chatID, &ParentRegisterData{})
 	if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "Введите ФИО ребёнка, которого хотите добавить:\n(или напишите Отмена)")); err != nil {
 		metrics.HandlerErrors.Inc()
 	}
@@ -116,8 +125,8 @@ func HandleAddChildText(ctx context.Context, bot *tgbotapi.BotAPI, database *sql
 
 	trimmed := strings.TrimSpace(msg.Text)
 	if strings.EqualFold(trimmed, "отмена") || strings.EqualFold(trimmed, "/cancel") {
-		delete(addChildFSM, chatID)
-		delete(addChildData, chatID)
+		addChildFSM.Delete(ctx, chatID)
+		addChildData.Delete(ctx, chatID)
 		if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "🚫 Добавление ребёнка отменено.")); err != nil {
 			metrics.HandlerErrors.Inc()
 		}
@@ -129,8 +138,10 @@ func HandleAddChildText(ctx context.Context, bot *tgbotapi.BotAPI, database *sql
 		fio := strings.TrimSpace(msg.Text)
 		fio = db.ToTitleRU(fio)
 
-		addChildData[chatID].StudentName = fio
-		addChildFSM[chatID] = StateAddChildClassNumber
+		addChildData.Value(chatID).StudentName = fio
+
+		addChildData.Save(ctx, chatID)
+		addChildFSM.Set(ctx, chatID, StateAddChildClassNumber)
 
 		// тянем только видимые классы
 		rows := addChildInlineClassNumbersFromDB(ctx, database)
@@ -148,8 +159,9 @@ func HandleAddChildText(ctx context.Context, bot *tgbotapi.BotAPI, database *sql
 			}
 			return
 		}
-		addChildData[chatID].ClassNumber = number
-		addChildFSM[chatID] = StateAddChildClassLetter
+		addChildData.Value(chatID).ClassNumber = number
+		addChildData.Save(ctx, chatID)
+		addChildFSM.Set(ctx, chatID, StateAddChildClassLetter)
 		// создадим карточку выбора буквы
 		rows := addChildInlineClassLettersFromDB(ctx, database, number)
 		out := tgbotapi.NewMessage(chatID, "Выберите букву класса:")
@@ -171,7 +183,7 @@ func HandleAddChildText(ctx context.Context, bot *tgbotapi.BotAPI, database *sql
 }
 
 func GetAddChildFSMState(chatID int64) string {
-	return addChildFSM[chatID]
+	return addChildFSM.Value(chatID)
 }
 
 // ===== Коллбеки (ЕДИНАЯ точка) =====
@@ -184,8 +196,8 @@ func HandleAddChildCallback(ctx context.Context, bot *tgbotapi.BotAPI, database
 
 	// Отмена
 	if data == "add_child_cancel" {
-		delete(addChildFSM, chatID)
-		delete(addChildData, chatID)
+		addChildFSM.Delete(ctx, chatID)
+		addChildData.Delete(ctx, chatID)
 		fsmutil.DisableMarkup(bot, chatID, messageID)
 		if _, err := tg.Send(bot, tgbotapi.NewEditMessageText(chatID, messageID, "🚫 Добавление ребёнка отменено.")); err != nil {
 			metrics.HandlerErrors.Inc()
@@ -201,9 +213,9 @@ func HandleAddChildCallback(ctx context.Context, bot *tgbotapi.BotAPI, database
 			if _, err := tg.Send(bot, tgbotapi.NewEditMessageText(chatID, messageID, "Введите ФИО ребёнка, которого хотите добавить:\n(или напишите Отмена)")); err != nil {
 				metrics.HandlerErrors.Inc()
 			}
-			addChildFSM[chatID] = StateAddChildName
+			addChildFSM.Set(ctx, chatID, StateAddChildName)
 		case StateAddChildClassLetter:
-			addChildFSM[chatID] = StateAddChildClassNumber
+			addChildFSM.Set(ctx, chatID, StateAddChildClassNumber)
 			addChildEditMenu(bot, chatID, messageID, "Выберите номер класса ребёнка:", addChildInlineClassNumbersFromDB(ctx, database))
 		case StateAddChildWaiting:
 			if _, err := tg.Request(bot, tgbotapi.NewCallback(cb.ID, "Заявка уже отправлена, ожидайте подтверждения.")); err != nil {
@@ -218,25 +230,28 @@ func HandleAddChildCallback(ctx context.Context, bot *tgbotapi.BotAPI, database
 	}
 
 	// Выбор номера
-	if strings.HasPrefix(data, "parent_class_num_") && (state == StateAddChildClassNumber || state == StateAddChildName) {
-		numStr := strings.TrimPrefix(data, "parent_class_num_")
-		num, err := strconv.Atoi(numStr)
+	if cbParentClassNum.Match(data) && (state == StateAddChildClassNumber || state == StateAddChildName) {
+		num, err := cbParentClassNum.Parse(data)
 		if err != nil || num < 1 || num > 11 {
 			if _, err := tg.Send(bot, tgbotapi.NewCallback(cb.ID, "Неверный номер класса")); err != nil {
 				metrics.HandlerErrors.Inc()
 			}
 			return
 		}
-		addChildData[chatID].ClassNumber = num
-		addChildFSM[chatID] = StateAddChildClassLetter
-		rows := addChildInlineClassLettersFromDB(ctx, database, addChildData[chatID].ClassNumber)
+		addChildData.Value(chatID).ClassNumber = num
+		addChildData.Save(ctx, chatID)
+		addChildFSM.Set(ctx, chatID, StateAddChildClassLetter)
+		rows := addChildInlineClassLettersFromDB(ctx, database, addChildData.Value(chatID).ClassNumber)
 		addChildEditMenu(bot, chatID, messageID, "Выберите букву класса:", rows)
 		return
 	}
 
 	// Выбор буквы
-	if strings.HasPrefix(data, "parent_class_letter_") && state == StateAddChildClassLetter {
-		letter := strings.TrimPrefix(data, "parent_class_letter_")
+	if cbParentClassLetter.Match(data) && state == StateAddChildClassLetter {
+		letter, err := cbParentClassLetter.Parse(data)
+		if err != nil {
+			return
+		}
 		handleAddChildFinish(ctx, bot, database, chatID, messageID, letter)
 		return
 	}
@@ -245,21 +260,22 @@ func HandleAddChildCallback(ctx context.Context, bot *tgbotapi.BotAPI, database
 // ===== Завершение: создаём заявку на привязку, а не сразу связь =====
 
 func handleAddChildFinish(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, chatID int64, messageID int, letter string) {
-	addChildData[chatID].ClassLetter = letter
-	addChildFSM[chatID] = StateAddChildWaiting
+	addChildData.Value(chatID).ClassLetter = letter
+	addChildData.Save(ctx, chatID)
+	addChildFSM.Set(ctx, chatID, StateAddChildWaiting)
 
 	// Находим ученика
 	studentID, err := FindStudentID(ctx, database, &ParentRegisterData{
-		StudentName: addChildData[chatID].StudentName,
-		ClassNumber: addChildData[chatID].ClassNumber,
-		ClassLetter: addChildData[chatID].ClassLetter,
+		StudentName: addChildData.Value(chatID).StudentName,
+		ClassNumber: addChildData.Value(chatID).ClassNumber,
+		ClassLetter: addChildData.Value(chatID).ClassLetter,
 	})
 	if err != nil {
 		fsmutil.DisableMarkup(bot, chatID, messageID)
 		if _, err := tg.Send(bot, tgbotapi.NewEditMessageText(chatID, messageID, "❌ Ученик не найден. Введите ФИО заново:")); err != nil {
 			metrics.HandlerErrors.Inc()
 		}
-		addChildFSM[chatID] = StateAddChildName
+		addChildFSM.Set(ctx, chatID, StateAddChildName)
 		return
 	}
 
@@ -270,8 +286,8 @@ func handleAddChildFinish(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 		if _, err := tg.Send(bot, tgbotapi.NewEditMessageText(chatID, messageID, "❌ Ошибка при создании заявки. Попробуйте позже.")); err != nil {
 			metrics.HandlerErrors.Inc()
 		}
-		delete(addChildFSM, chatID)
-		delete(addChildData, chatID)
+		addChildFSM.Delete(ctx, chatID)
+		addChildData.Delete(ctx, chatID)
 		return
 	}
 
@@ -282,8 +298,8 @@ func handleAddChildFinish(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 	if _, err := tg.Send(bot, tgbotapi.NewEditMessageText(chatID, messageID, "📨 Заявка на добавление ребёнка отправлена администратору. Ожидайте подтверждения.")); err != nil {
 		metrics.HandlerErrors.Inc()
 	}
-	delete(addChildFSM, chatID)
-	delete(addChildData, chatID)
+	addChildFSM.Delete(ctx, chatID)
+	addChildData.Delete(ctx, chatID)
 }
 
 // ===== База/заявки =====
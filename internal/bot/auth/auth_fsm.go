@@ -3,11 +3,15 @@ package auth
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/Spok95/telegram-school-bot/internal/models"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
+// registrationTTL — регистрация может ждать ответа пользователя дольше обычных мастеров.
+const registrationTTL = 7 * 24 * time.Hour
+
 func StartRegistration(ctx context.Context, chatID int64, role string, bot *tgbotapi.BotAPI) {
 	select {
 	case <-ctx.Done():
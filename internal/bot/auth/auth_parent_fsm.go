@@ -6,10 +6,12 @@ import (
 	"fmt"
 	"log"
 	"sort"
-	"strconv"
 	"strings"
 
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
 	"github.com/Spok95/telegram-school-bot/internal/bot/handlers"
+	"github.com/Spok95/telegram-school-bot/internal/bot/menu"
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmstore"
 	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmutil"
 	"github.com/Spok95/telegram-school-bot/internal/db"
 	"github.com/Spok95/telegram-school-bot/internal/metrics"
@@ -28,8 +30,8 @@ const (
 )
 
 var (
-	parentFSM  = make(map[int64]ParentFSMState)
-	parentData = make(map[int64]*ParentRegisterData)
+	parentFSM  = fsmstore.NewMap[ParentFSMState]("parent_reg", 1, registrationTTL)
+	parentData = fsmstore.NewMap[*ParentRegisterData]("parent_reg_data", 1, registrationTTL)
 )
 
 type ParentRegisterData struct {
@@ -62,13 +64,16 @@ func parentClassNumberRowsFromDB(ctx context.Context, database *sql.DB) [][]tgbo
 	}
 	sort.Ints(nums)
 
+	var bs callback.Buttons
 	var rows [][]tgbotapi.InlineKeyboardButton
 	for _, n := range nums {
-		cb := fmt.Sprintf("parent_class_num_%d", n)
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d класс", n), cb),
+			bs.Add(cbParentClassNum.Button(fmt.Sprintf("%d класс", n), n)),
 		))
 	}
+	if buttonsFailed(&bs) {
+		return [][]tgbotapi.InlineKeyboardButton{parentBackCancelRow()}
+	}
 	rows = append(rows, parentBackCancelRow())
 	return rows
 }
@@ -81,15 +86,19 @@ func parentClassLetterRowsFromDB(ctx context.Context, database *sql.DB, number i
 		}
 	}
 
+	var bs callback.Buttons
 	var rows [][]tgbotapi.InlineKeyboardButton
 	for _, c := range classes {
 		if c.Number != number {
 			continue
 		}
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(strings.ToUpper(c.Letter), "parent_class_letter_"+strings.ToUpper(c.Letter)),
+			bs.Add(cbParentClassLetter.Button(strings.ToUpper(c.Letter), strings.ToUpper(c.Letter))),
 		))
 	}
+	if buttonsFailed(&bs) {
+		return [][]tgbotapi.InlineKeyboardButton{parentBackCancelRow()}
+	}
 	rows = append(rows, parentBackCancelRow())
 	return rows
 }
@@ -109,8 +118,8 @@ func StartParentRegistration(ctx context.Context, chatID int64, _ *tgbotapi.User
 		return
 	default:
 	}
-	parentFSM[chatID] = StateParentName
-	parentData[chatID] = &ParentRegisterData{}
+	parentFSM.Set(ctx, chatID, StateParentName)
+	parentData.Set(ctx, chatID, &ParentRegisterData{})
 	if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "Введите ваше ФИО:")); err != nil {
 		metrics.HandlerErrors.Inc()
 	}
@@ -124,22 +133,23 @@ func HandleParentFSM(ctx context.Context, chatID int64, msg string, bot *tgbotap
 	}
 	trimmed := strings.TrimSpace(msg)
 	if strings.EqualFold(trimmed, "отмена") || strings.EqualFold(trimmed, "/cancel") {
-		delete(parentFSM, chatID)
-		delete(parentData, chatID)
+		parentFSM.Delete(ctx, chatID)
+		parentData.Delete(ctx, chatID)
 		if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "🚫 Регистрация отменена. Нажмите /start, чтобы начать заново.")); err != nil {
 			metrics.HandlerErrors.Inc()
 		}
 		return
 	}
 
-	state := parentFSM[chatID]
+	state := parentFSM.Value(chatID)
 
 	if state == StateParentName {
-		if parentData[chatID] == nil {
-			parentData[chatID] = &ParentRegisterData{}
+		if parentData.Value(chatID) == nil {
+			parentData.Set(ctx, chatID, &ParentRegisterData{})
 		}
-		parentData[chatID].ParentName = db.ToTitleRU(strings.TrimSpace(msg))
-		parentFSM[chatID] = StateParentStudentName
+		parentData.Value(chatID).ParentName = db.ToTitleRU(strings.TrimSpace(msg))
+		parentData.Save(ctx, chatID)
+		parentFSM.Set(ctx, chatID, StateParentStudentName)
 		if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "Введите ФИО ребёнка, которого вы представляете:")); err != nil {
 			metrics.HandlerErrors.Inc()
 		}
@@ -147,11 +157,12 @@ func HandleParentFSM(ctx context.Context, chatID int64, msg string, bot *tgbotap
 	}
 
 	if state == StateParentStudentName {
-		if parentData[chatID] == nil {
-			parentData[chatID] = &ParentRegisterData{}
+		if parentData.Value(chatID) == nil {
+			parentData.Set(ctx, chatID, &ParentRegisterData{})
 		}
-		parentData[chatID].StudentName = db.ToTitleRU(strings.TrimSpace(msg))
-		parentFSM[chatID] = StateParentClassNumber
+		parentData.Value(chatID).StudentName = db.ToTitleRU(strings.TrimSpace(msg))
+		parentData.Save(ctx, chatID)
+		parentFSM.Set(ctx, chatID, StateParentClassNumber)
 
 		rows := parentClassNumberRowsFromDB(ctx, database)
 
@@ -166,11 +177,11 @@ func HandleParentFSM(ctx context.Context, chatID int64, msg string, bot *tgbotap
 func HandleParentCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, cq *tgbotapi.CallbackQuery) {
 	chatID := cq.Message.Chat.ID
 	data := cq.Data
-	state := parentFSM[chatID]
+	state := parentFSM.Value(chatID)
 
 	if data == "parent_cancel" {
-		delete(parentFSM, chatID)
-		delete(parentData, chatID)
+		parentFSM.Delete(ctx, chatID)
+		parentData.Delete(ctx, chatID)
 		fsmutil.DisableMarkup(bot, chatID, cq.Message.MessageID)
 		if _, err := tg.Send(bot, tgbotapi.NewEditMessageText(chatID, cq.Message.MessageID, "🚫 Регистрация отменена. Нажмите /start, чтобы начать заново.")); err != nil {
 			metrics.HandlerErrors.Inc()
@@ -184,15 +195,15 @@ func HandleParentCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 			if _, err := tg.Send(bot, tgbotapi.NewEditMessageText(chatID, cq.Message.MessageID, "Введите ваше ФИО:")); err != nil {
 				metrics.HandlerErrors.Inc()
 			}
-			parentFSM[chatID] = StateParentName
+			parentFSM.Set(ctx, chatID, StateParentName)
 		case StateParentClassNumber:
 			fsmutil.DisableMarkup(bot, chatID, cq.Message.MessageID)
 			if _, err := tg.Send(bot, tgbotapi.NewEditMessageText(chatID, cq.Message.MessageID, "Введите ФИО ребёнка:")); err != nil {
 				metrics.HandlerErrors.Inc()
 			}
-			parentFSM[chatID] = StateParentStudentName
+			parentFSM.Set(ctx, chatID, StateParentStudentName)
 		case StateParentClassLetter:
-			parentFSM[chatID] = StateParentClassNumber
+			parentFSM.Set(ctx, chatID, StateParentClassNumber)
 			rows := parentClassNumberRowsFromDB(ctx, database)
 			parentEditMenu(bot, chatID, cq.Message.MessageID, "Выберите номер класса ребёнка:", rows)
 		case StateParentWaiting:
@@ -207,42 +218,67 @@ func HandleParentCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 		return
 	}
 
-	if strings.HasPrefix(data, "parent_class_num_") {
-		numStr := strings.TrimPrefix(data, "parent_class_num_")
-		num, _ := strconv.Atoi(numStr)
-		if parentData[chatID] == nil {
-			parentData[chatID] = &ParentRegisterData{}
+	if cbParentClassNum.Match(data) {
+		num, err := cbParentClassNum.Parse(data)
+		if err != nil {
+			return
 		}
-		parentData[chatID].ClassNumber = num
-		parentFSM[chatID] = StateParentClassLetter
+		if parentData.Value(chatID) == nil {
+			parentData.Set(ctx, chatID, &ParentRegisterData{})
+		}
+		parentData.Value(chatID).ClassNumber = num
+		parentData.Save(ctx, chatID)
+		parentFSM.Set(ctx, chatID, StateParentClassLetter)
 		rows := parentClassLetterRowsFromDB(ctx, database, num)
 		parentEditMenu(bot, chatID, cq.Message.MessageID, "Выберите букву класса:", rows)
 		return
 	}
 
-	if strings.HasPrefix(data, "parent_class_letter_") {
-		letter := strings.TrimPrefix(data, "parent_class_letter_")
-		parentData[chatID].ClassLetter = letter
-		parentFSM[chatID] = StateParentWaiting
+	if cbParentClassLetter.Match(data) {
+		letter, err := cbParentClassLetter.Parse(data)
+		if err != nil {
+			return
+		}
+		parentData.Value(chatID).ClassLetter = letter
+		parentData.Save(ctx, chatID)
+		parentFSM.Set(ctx, chatID, StateParentWaiting)
 
-		studentID, err := FindStudentID(ctx, database, parentData[chatID])
+		studentID, err := FindStudentID(ctx, database, parentData.Value(chatID))
 		if err != nil {
 			fsmutil.DisableMarkup(bot, chatID, cq.Message.MessageID)
 			if _, err := tg.Send(bot, tgbotapi.NewEditMessageText(chatID, cq.Message.MessageID, "❌ Ученик не найден. Введите ФИО заново:")); err != nil {
 				metrics.HandlerErrors.Inc()
 			}
-			parentFSM[chatID] = StateParentStudentName
+			parentFSM.Set(ctx, chatID, StateParentStudentName)
+			return
+		}
+
+		// родитель мог прийти из импорта списка класса уже привязанным к ребёнку
+		if claimed, err := db.ClaimParentPlaceholder(ctx, database, chatID, int64(studentID), parentData.Value(chatID).ParentName); err != nil {
+			log.Printf("[PARENT_ERROR] claim placeholder: %v", err)
+		} else if claimed != 0 {
+			fsmutil.DisableMarkup(bot, chatID, cq.Message.MessageID)
+			if _, err := tg.Send(bot, tgbotapi.NewEditMessageText(chatID, cq.Message.MessageID, "✅ Вы есть в списке родителей класса — регистрация подтверждена.")); err != nil {
+				metrics.HandlerErrors.Inc()
+			}
+			welcome := tgbotapi.NewMessage(chatID, "Добро пожаловать!")
+			welcome.ReplyMarkup = menu.GetRoleMenu("parent")
+			if _, err := tg.Send(bot, welcome); err != nil {
+				metrics.HandlerErrors.Inc()
+			}
+			parentFSM.Delete(ctx, chatID)
+			parentData.Delete(ctx, chatID)
 			return
 		}
 
-		parentID, err := SaveParentRequest(ctx, database, chatID, studentID, parentData[chatID].ParentName)
+		parentID, err := SaveParentRequest(ctx, database, chatID, studentID, parentData.Value(chatID).ParentName)
 		if err != nil {
 			fsmutil.DisableMarkup(bot, chatID, cq.Message.MessageID)
 			if _, err := tg.Send(bot, tgbotapi.NewEditMessageText(chatID, cq.Message.MessageID, "Ошибка при сохранении. Попробуйте позже.")); err != nil {
 				metrics.HandlerErrors.Inc()
 			}
-			delete(parentFSM, chatID)
-			delete(parentData, chatID)
+			parentFSM.Delete(ctx, chatID)
+			parentData.Delete(ctx, chatID)
 			return
 		}
 		fsmutil.DisableMarkup(bot, chatID, cq.Message.MessageID)
@@ -250,8 +286,8 @@ func HandleParentCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 			metrics.HandlerErrors.Inc()
 		}
 		handlers.NotifyAdminsAboutNewUser(ctx, bot, database, parentID)
-		delete(parentFSM, chatID)
-		delete(parentData, chatID)
+		parentFSM.Delete(ctx, chatID)
+		parentData.Delete(ctx, chatID)
 		return
 	}
 }
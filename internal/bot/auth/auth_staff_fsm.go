@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/Spok95/telegram-school-bot/internal/bot/handlers"
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmstore"
 	"github.com/Spok95/telegram-school-bot/internal/metrics"
 	"github.com/Spok95/telegram-school-bot/internal/tg"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -19,8 +20,8 @@ const (
 )
 
 var (
-	staffFSM  = make(map[int64]StaffFSMState)
-	staffData = make(map[int64]string)
+	staffFSM  = fsmstore.NewMap[StaffFSMState]("staff_reg", 1, registrationTTL)
+	staffData = fsmstore.NewMap[string]("staff_reg_data", 1, registrationTTL)
 )
 
 func StartStaffRegistration(ctx context.Context, chatID int64, bot *tgbotapi.BotAPI) {
@@ -29,7 +30,7 @@ func StartStaffRegistration(ctx context.Context, chatID int64, bot *tgbotapi.Bot
 		return
 	default:
 	}
-	staffFSM[chatID] = StateStaffName
+	staffFSM.Set(ctx, chatID, StateStaffName)
 	if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "Введите ваше ФИО:")); err != nil {
 		metrics.HandlerErrors.Inc()
 	}
@@ -38,27 +39,27 @@ func StartStaffRegistration(ctx context.Context, chatID int64, bot *tgbotapi.Bot
 func HandleStaffFSM(ctx context.Context, chatID int64, msg string, bot *tgbotapi.BotAPI, database *sql.DB, role string) {
 	trimmed := strings.TrimSpace(msg)
 	if strings.EqualFold(trimmed, "отмена") || strings.EqualFold(trimmed, "/cancel") {
-		delete(staffFSM, chatID)
-		delete(staffData, chatID)
+		staffFSM.Delete(ctx, chatID)
+		staffData.Delete(ctx, chatID)
 		if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "🚫 Регистрация отменена. Нажмите /start, чтобы начать заново.")); err != nil {
 			metrics.HandlerErrors.Inc()
 		}
 		return
 	}
 
-	state := staffFSM[chatID]
+	state := staffFSM.Value(chatID)
 
 	if state == StateStaffName {
-		staffData[chatID] = msg
-		staffFSM[chatID] = StateStaffWait
+		staffData.Set(ctx, chatID, msg)
+		staffFSM.Set(ctx, chatID, StateStaffWait)
 
 		id, err := SaveStaffRequest(ctx, database, chatID, msg, role)
 		if err != nil {
 			if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "Ошибка при сохранении заявки. Попробуйте позже.")); err != nil {
 				metrics.HandlerErrors.Inc()
 			}
-			delete(staffFSM, chatID)
-			delete(staffData, chatID)
+			staffFSM.Delete(ctx, chatID)
+			staffData.Delete(ctx, chatID)
 			return
 		}
 		if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "Заявка на регистрацию отправлена администратору. Ожидайте подтверждения.")); err != nil {
@@ -66,8 +67,8 @@ func HandleStaffFSM(ctx context.Context, chatID int64, msg string, bot *tgbotapi
 		}
 		handlers.NotifyAdminsAboutNewUser(ctx, bot, database, id)
 
-		delete(staffFSM, chatID)
-		delete(staffData, chatID)
+		staffFSM.Delete(ctx, chatID)
+		staffData.Delete(ctx, chatID)
 	}
 }
 
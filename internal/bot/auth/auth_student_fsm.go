@@ -4,10 +4,13 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"strconv"
+	"log"
 	"strings"
 
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
 	"github.com/Spok95/telegram-school-bot/internal/bot/handlers"
+	"github.com/Spok95/telegram-school-bot/internal/bot/menu"
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmstore"
 	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmutil"
 	"github.com/Spok95/telegram-school-bot/internal/db"
 	"github.com/Spok95/telegram-school-bot/internal/metrics"
@@ -25,8 +28,8 @@ const (
 )
 
 var (
-	studentFSM  = make(map[int64]StudentFSMState)
-	studentData = make(map[int64]*StudentRegisterData)
+	studentFSM  = fsmstore.NewMap[StudentFSMState]("student_reg", 1, registrationTTL)
+	studentData = fsmstore.NewMap[*StudentRegisterData]("student_reg_data", 1, registrationTTL)
 )
 
 type StudentRegisterData struct {
@@ -59,13 +62,16 @@ func studentClassNumberRowsFromDB(ctx context.Context, database *sql.DB) [][]tgb
 	// тут добавь
 	// sort.Ints(nums)
 
+	var bs callback.Buttons
 	var rows [][]tgbotapi.InlineKeyboardButton
 	for _, n := range nums {
-		cb := fmt.Sprintf("student_class_num_%d", n)
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d класс", n), cb),
+			bs.Add(cbStudentClassNum.Button(fmt.Sprintf("%d класс", n), n)),
 		))
 	}
+	if buttonsFailed(&bs) {
+		return [][]tgbotapi.InlineKeyboardButton{studentBackCancelRow()}
+	}
 	rows = append(rows, studentBackCancelRow())
 	return rows
 }
@@ -78,15 +84,19 @@ func studentClassLetterRowsFromDB(ctx context.Context, database *sql.DB, number
 		}
 	}
 
+	var bs callback.Buttons
 	var rows [][]tgbotapi.InlineKeyboardButton
 	for _, c := range classes {
 		if c.Number != number {
 			continue
 		}
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(strings.ToUpper(c.Letter), "student_class_letter_"+strings.ToUpper(c.Letter)),
+			bs.Add(cbStudentClassLetter.Button(strings.ToUpper(c.Letter), strings.ToUpper(c.Letter))),
 		))
 	}
+	if buttonsFailed(&bs) {
+		return [][]tgbotapi.InlineKeyboardButton{studentBackCancelRow()}
+	}
 	rows = append(rows, studentBackCancelRow())
 	return rows
 }
@@ -107,10 +117,8 @@ func StartStudentRegistration(ctx context.Context, chatID int64, bot *tgbotapi.B
 		return
 	default:
 	}
-	delete(studentFSM, chatID)
-	delete(studentData, chatID)
-
-	studentFSM[chatID] = StateStudentName
+	studentData.Delete(ctx, chatID)
+	studentFSM.Set(ctx, chatID, StateStudentName)
 	if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "Введите ваше ФИО:")); err != nil {
 		metrics.HandlerErrors.Inc()
 	}
@@ -125,19 +133,19 @@ func HandleStudentFSM(ctx context.Context, chatID int64, msg string, bot *tgbota
 	}
 	trimmed := strings.TrimSpace(msg)
 	if strings.EqualFold(trimmed, "отмена") || strings.EqualFold(trimmed, "/cancel") {
-		delete(studentFSM, chatID)
-		delete(studentData, chatID)
+		studentFSM.Delete(ctx, chatID)
+		studentData.Delete(ctx, chatID)
 		if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "🚫 Регистрация отменена. Нажмите /start, чтобы начать заново.")); err != nil {
 			metrics.HandlerErrors.Inc()
 		}
 		return
 	}
 
-	state := studentFSM[chatID]
+	state := studentFSM.Value(chatID)
 
 	if state == StateStudentName {
-		studentData[chatID] = &StudentRegisterData{Name: msg}
-		studentFSM[chatID] = StateStudentClassNum
+		studentData.Set(ctx, chatID, &StudentRegisterData{Name: msg})
+		studentFSM.Set(ctx, chatID, StateStudentClassNum)
 
 		rows := studentClassNumberRowsFromDB(ctx, database)
 
@@ -169,8 +177,8 @@ func HandleStudentCallback(ctx context.Context, cb *tgbotapi.CallbackQuery, bot
 	chatID := cb.Message.Chat.ID
 	data := cb.Data
 	if data == "student_cancel" {
-		delete(studentFSM, chatID)
-		delete(studentData, chatID)
+		studentFSM.Delete(ctx, chatID)
+		studentData.Delete(ctx, chatID)
 		fsmutil.DisableMarkup(bot, chatID, cb.Message.MessageID)
 		if _, err := tg.Send(bot, tgbotapi.NewEditMessageText(chatID, cb.Message.MessageID, "🚫 Регистрация отменена. Нажмите /start, чтобы начать заново.")); err != nil {
 			metrics.HandlerErrors.Inc()
@@ -178,15 +186,15 @@ func HandleStudentCallback(ctx context.Context, cb *tgbotapi.CallbackQuery, bot
 		return
 	}
 	if data == "student_back" {
-		switch studentFSM[chatID] {
+		switch studentFSM.Value(chatID) {
 		case StateStudentClassNum:
 			fsmutil.DisableMarkup(bot, chatID, cb.Message.MessageID)
 			if _, err := tg.Send(bot, tgbotapi.NewEditMessageText(chatID, cb.Message.MessageID, "Введите ваше ФИО:")); err != nil {
 				metrics.HandlerErrors.Inc()
 			}
-			studentFSM[chatID] = StateStudentName
+			studentFSM.Set(ctx, chatID, StateStudentName)
 		case StateStudentLetterBtn:
-			studentFSM[chatID] = StateStudentClassNum
+			studentFSM.Set(ctx, chatID, StateStudentClassNum)
 			rows := studentClassNumberRowsFromDB(ctx, database)
 			studentEditMenu(bot, chatID, cb.Message.MessageID, "Выберите номер класса:", rows)
 		case StateStudentWaitingConfirm:
@@ -201,38 +209,61 @@ func HandleStudentCallback(ctx context.Context, cb *tgbotapi.CallbackQuery, bot
 		return
 	}
 
-	if strings.HasPrefix(data, "student_class_num_") {
-		numStr := strings.TrimPrefix(data, "student_class_num_")
-		num, err := strconv.Atoi(numStr)
+	if cbStudentClassNum.Match(data) {
+		num, err := cbStudentClassNum.Parse(data)
 		if err != nil || num < 1 || num > 11 {
 			if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "Некорректный номер класса.")); err != nil {
 				metrics.HandlerErrors.Inc()
 			}
 			return
 		}
-		if studentData[chatID] == nil {
-			studentData[chatID] = &StudentRegisterData{}
+		if studentData.Value(chatID) == nil {
+			studentData.Set(ctx, chatID, &StudentRegisterData{})
 		}
-		studentData[chatID].ClassNumber = int64(num)
-		studentFSM[chatID] = StateStudentLetterBtn
+		studentData.Value(chatID).ClassNumber = int64(num)
+		studentData.Save(ctx, chatID)
+		studentFSM.Set(ctx, chatID, StateStudentLetterBtn)
 		rows := studentClassLetterRowsFromDB(ctx, database, num)
 		studentEditMenu(bot, chatID, cb.Message.MessageID, "Выберите букву класса:", rows)
 		return
 	}
 
-	if strings.HasPrefix(data, "student_class_letter_") {
-		letter := strings.TrimPrefix(data, "student_class_letter_")
-		studentData[chatID].ClassLetter = letter
-		studentFSM[chatID] = StateStudentWaitingConfirm
+	if cbStudentClassLetter.Match(data) {
+		letter, err := cbStudentClassLetter.Parse(data)
+		if err != nil {
+			return
+		}
+		studentData.Value(chatID).ClassLetter = letter
+		studentData.Save(ctx, chatID)
+		studentFSM.Set(ctx, chatID, StateStudentWaitingConfirm)
+
+		// ученик мог быть заведён админом заранее (импорт списка класса) — тогда заявка не нужна
+		d := studentData.Value(chatID)
+		if claimed, err := db.ClaimStudentPlaceholder(ctx, database, chatID, d.Name, d.ClassNumber, d.ClassLetter); err != nil {
+			log.Printf("[STUDENT_ERROR] claim placeholder: %v", err)
+		} else if claimed != 0 {
+			fsmutil.DisableMarkup(bot, chatID, cb.Message.MessageID)
+			if _, err := tg.Send(bot, tgbotapi.NewEditMessageText(chatID, cb.Message.MessageID, "✅ Вы есть в списке класса — регистрация подтверждена.")); err != nil {
+				metrics.HandlerErrors.Inc()
+			}
+			welcome := tgbotapi.NewMessage(chatID, "Добро пожаловать!")
+			welcome.ReplyMarkup = menu.GetRoleMenu("student")
+			if _, err := tg.Send(bot, welcome); err != nil {
+				metrics.HandlerErrors.Inc()
+			}
+			studentFSM.Delete(ctx, chatID)
+			studentData.Delete(ctx, chatID)
+			return
+		}
 
-		id, err := SaveStudentRequest(ctx, database, chatID, studentData[chatID])
+		id, err := SaveStudentRequest(ctx, database, chatID, studentData.Value(chatID))
 		if err != nil {
 			fsmutil.DisableMarkup(bot, chatID, cb.Message.MessageID)
 			if _, err := tg.Send(bot, tgbotapi.NewEditMessageText(chatID, cb.Message.MessageID, "Ошибка при сохранении заявки. Попробуйте позже.")); err != nil {
 				metrics.HandlerErrors.Inc()
 			}
-			delete(studentFSM, chatID)
-			delete(studentData, chatID)
+			studentFSM.Delete(ctx, chatID)
+			studentData.Delete(ctx, chatID)
 			return
 		}
 		fsmutil.DisableMarkup(bot, chatID, cb.Message.MessageID)
@@ -240,8 +271,8 @@ func HandleStudentCallback(ctx context.Context, cb *tgbotapi.CallbackQuery, bot
 			metrics.HandlerErrors.Inc()
 		}
 		handlers.NotifyAdminsAboutNewUser(ctx, bot, database, id)
-		delete(studentFSM, chatID)
-		delete(studentData, chatID)
+		studentFSM.Delete(ctx, chatID)
+		studentData.Delete(ctx, chatID)
 		return
 	}
 }
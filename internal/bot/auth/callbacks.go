@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"log"
+
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
+	"github.com/Spok95/telegram-school-bot/internal/metrics"
+	"github.com/Spok95/telegram-school-bot/internal/observability"
+)
+
+// Кнопки выбора класса при регистрации (формат — см. пакет callback).
+// Родитель и добавление ребёнка пользуются одними кнопками.
+var (
+	cbParentClassNum     = callback.NewAction1("parent_class_num_", callback.Num)
+	cbParentClassLetter  = callback.NewAction1("parent_class_letter_", callback.Word(8))
+	cbStudentClassNum    = callback.NewAction1("student_class_num_", callback.Num)
+	cbStudentClassLetter = callback.NewAction1("student_class_letter_", callback.Word(8))
+)
+
+// buttonsFailed — кнопку не удалось закодировать: пишем ошибку и не отправляем клавиатуру.
+func buttonsFailed(bs *callback.Buttons) bool {
+	err := bs.Err()
+	if err == nil {
+		return false
+	}
+	log.Println("callback:", err)
+	observability.CaptureErr(err)
+	metrics.HandlerErrors.Inc()
+	return true
+}
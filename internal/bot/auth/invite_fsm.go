@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/bot/menu"
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmstore"
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmutil"
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/metrics"
+	"github.com/Spok95/telegram-school-bot/internal/models"
+	"github.com/Spok95/telegram-school-bot/internal/tg"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// inviteFSM — код приглашения, по которому ждём ФИО.
+var inviteFSM = fsmstore.NewMap[string]("invite_reg", 1, registrationTTL)
+
+// InviteFSMActive — пользователь пришёл по коду и бот ждёт ФИО.
+func InviteFSMActive(chatID int64) bool { return inviteFSM.Value(chatID) != "" }
+
+// InviteDescription — для кого код, человеческим языком.
+func InviteDescription(c *db.InviteCode) string {
+	switch {
+	case c.Role == models.Parent:
+		return fmt.Sprintf("родитель ученика %s (%s)", c.StudentName, c.ClassLabel)
+	case c.Role == models.Student && c.StudentID != nil:
+		return fmt.Sprintf("ученик %s (%s)", c.StudentName, c.ClassLabel)
+	case c.Role == models.Student:
+		return fmt.Sprintf("ученик %s класса", c.ClassLabel)
+	case c.Role == models.Teacher:
+		return "учитель"
+	case c.Role == models.Administration:
+		return "администрация"
+	}
+	return string(c.Role)
+}
+
+// StartInviteRegistration — /start <код>: проверяем код и либо сразу регистрируем,
+// либо спрашиваем ФИО. user — текущая учётка (nil, если пользователь не зарегистрирован).
+func StartInviteRegistration(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, chatID int64, user *models.User, code string) {
+	c, err := db.GetInviteCode(ctx, database, code)
+	if err == nil {
+		err = c.Usable(time.Now())
+	}
+	if err != nil {
+		inviteReply(bot, chatID, inviteErrorText(err))
+		return
+	}
+
+	if user != nil {
+		// зарегистрированный родитель по коду родителя добавляет ещё одного ребёнка
+		if user.Role != nil && *user.Role == models.Parent && c.Role == models.Parent {
+			redeemInvite(ctx, bot, database, chatID, c.Code, user.Name)
+			return
+		}
+		inviteReply(bot, chatID, inviteErrorText(db.ErrInviteRegistered))
+		return
+	}
+
+	// код важнее начатой вручную регистрации
+	studentFSM.Delete(ctx, chatID)
+	studentData.Delete(ctx, chatID)
+	parentFSM.Delete(ctx, chatID)
+	parentData.Delete(ctx, chatID)
+	staffFSM.Delete(ctx, chatID)
+	staffData.Delete(ctx, chatID)
+	db.SetUserFSMRole(ctx, chatID, "")
+
+	if !c.NeedsName() {
+		redeemInvite(ctx, bot, database, chatID, c.Code, "")
+		return
+	}
+	inviteFSM.Set(ctx, chatID, c.Code)
+	inviteReply(bot, chatID, fmt.Sprintf("🎟 Приглашение: %s.\n\nВведите ваше ФИО:", InviteDescription(c)))
+}
+
+// HandleInviteFSM — ФИО для регистрации по коду.
+func HandleInviteFSM(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	if fsmutil.IsCancelText(msg.Text) {
+		inviteFSM.Delete(ctx, chatID)
+		inviteReply(bot, chatID, "🚫 Регистрация отменена. Откройте ссылку приглашения ещё раз, чтобы начать заново.")
+		return
+	}
+	name := strings.Join(strings.Fields(msg.Text), " ")
+	if len([]rune(name)) < 3 {
+		inviteReply(bot, chatID, "Введите ФИО полностью, например: Иванов Иван Иванович.")
+		return
+	}
+	code := inviteFSM.Value(chatID)
+	inviteFSM.Delete(ctx, chatID)
+	redeemInvite(ctx, bot, database, chatID, code, name)
+}
+
+func redeemInvite(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, chatID int64, code, name string) {
+	c, _, err := db.RedeemInvite(ctx, database, code, chatID, name, time.Now())
+	if err != nil {
+		if !isInviteError(err) {
+			log.Printf("[INVITE_ERROR] redeem %s: %v", code, err)
+			metrics.HandlerErrors.Inc()
+		}
+		inviteReply(bot, chatID, inviteErrorText(err))
+		return
+	}
+
+	role := string(c.Role)
+	db.SetUserFSMRole(ctx, chatID, role)
+	text := "✅ Регистрация подтверждена по приглашению (" + InviteDescription(c) + "). Добро пожаловать!"
+	if c.Role == models.Parent {
+		text = "✅ Ребёнок " + c.StudentName + " (" + c.ClassLabel + ") привязан по приглашению."
+	}
+	m := tgbotapi.NewMessage(chatID, text)
+	m.ReplyMarkup = menu.GetRoleMenu(role)
+	if _, err := tg.Send(bot, m); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
+
+func isInviteError(err error) bool {
+	for _, e := range []error{db.ErrInviteNotFound, db.ErrInviteExpired, db.ErrInviteUsedUp,
+		db.ErrInviteRevoked, db.ErrInviteTaken, db.ErrInviteRegistered} {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
+
+func inviteErrorText(err error) string {
+	if errors.Is(err, db.ErrInviteRegistered) {
+		return "ℹ️ Вы уже зарегистрированы — код приглашения не нужен."
+	}
+	if isInviteError(err) {
+		return "❌ " + capitalize(err.Error()) + ".\nОбратитесь к администратору школы или зарегистрируйтесь через /start."
+	}
+	return "Ошибка при регистрации по приглашению. Попробуйте позже."
+}
+
+func capitalize(s string) string {
+	r := []rune(s)
+	if len(r) == 0 {
+		return s
+	}
+	return strings.ToUpper(string(r[0])) + string(r[1:])
+}
+
+func inviteReply(bot *tgbotapi.BotAPI, chatID int64, text string) {
+	if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, text)); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
@@ -0,0 +1,284 @@
+package callback
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const argSep = ":"
+
+// Field — кодировка аргумента кнопки: значение типа T пишется не длиннее Width байт
+// и однозначно читается обратно.
+type Field[T any] struct {
+	Width int
+	enc   func(T) (string, error)
+	dec   func(string) (T, error)
+}
+
+var (
+	// ID — неотрицательный идентификатор (BIGSERIAL, метка времени): base36, до 13 знаков.
+	ID = Field[int64]{Width: 13, enc: encodeID, dec: decodeID}
+	// IntID — как ID, для int-идентификаторов (категории, уровни).
+	IntID = Field[int]{Width: 13, enc: func(v int) (string, error) { return encodeID(int64(v)) }, dec: decodeIntID}
+	// Num — небольшое неотрицательное число (номер класса, дни, маска, год): base36, меньше 36³.
+	Num = Field[int]{Width: 3, enc: encodeNum, dec: decodeNum}
+	// Day — календарная дата: ГГГГММДД, читается как полночь UTC.
+	Day = Field[time.Time]{Width: len(dayLayout), enc: encodeDay, dec: decodeDay}
+)
+
+// Word — строка из известного набора (роль, вид отчёта, буква класса) не длиннее max байт.
+func Word(max int) Field[string] {
+	return Field[string]{
+		Width: max,
+		enc: func(s string) (string, error) {
+			if s == "" || len(s) > max || !utf8.ValidString(s) || strings.ContainsAny(s, argSep+sigSep) {
+				return "", fmt.Errorf("%w: строка %q (до %d байт)", ErrMalformed, s, max)
+			}
+			return s, nil
+		},
+		dec: func(s string) (string, error) {
+			if s == "" || len(s) > max {
+				return "", fmt.Errorf("%w: строка %q", ErrMalformed, s)
+			}
+			return s, nil
+		},
+	}
+}
+
+const (
+	numLimit  = 36 * 36 * 36
+	dayLayout = "20060102"
+)
+
+func encodeID(v int64) (string, error) {
+	if v < 0 {
+		return "", fmt.Errorf("%w: отрицательный идентификатор %d", ErrMalformed, v)
+	}
+	return strconv.FormatInt(v, 36), nil
+}
+
+func decodeID(s string) (int64, error) {
+	v, err := strconv.ParseInt(s, 36, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("%w: идентификатор %q", ErrMalformed, s)
+	}
+	return v, nil
+}
+
+func decodeIntID(s string) (int, error) {
+	v, err := decodeID(s)
+	if err != nil {
+		return 0, err
+	}
+	if int64(int(v)) != v {
+		return 0, fmt.Errorf("%w: идентификатор %q", ErrMalformed, s)
+	}
+	return int(v), nil
+}
+
+func encodeNum(v int) (string, error) {
+	if v < 0 || v >= numLimit {
+		return "", fmt.Errorf("%w: число %d вне 0…%d", ErrMalformed, v, numLimit-1)
+	}
+	return strconv.FormatInt(int64(v), 36), nil
+}
+
+func decodeNum(s string) (int, error) {
+	v, err := strconv.ParseInt(s, 36, 32)
+	if err != nil || v < 0 || v >= numLimit {
+		return 0, fmt.Errorf("%w: число %q", ErrMalformed, s)
+	}
+	return int(v), nil
+}
+
+func encodeDay(t time.Time) (string, error) {
+	if y := t.Year(); y < 1 || y > 9999 {
+		return "", fmt.Errorf("%w: дата %v", ErrMalformed, t)
+	}
+	return t.Format(dayLayout), nil
+}
+
+func decodeDay(s string) (time.Time, error) {
+	t, err := time.Parse(dayLayout, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: дата %q", ErrMalformed, s)
+	}
+	return t, nil
+}
+
+// action — общее у действий: префикс и поля по порядку.
+type action struct {
+	prefix string
+	widths []int
+}
+
+func newAction(prefix string, widths ...int) action {
+	n := len(prefix) + len(argSep)*(len(widths)-1)
+	for _, w := range widths {
+		n += w
+	}
+	register(prefix, n)
+	return action{prefix: prefix, widths: widths}
+}
+
+// Prefix — префикс действия (по нему кнопку находит маршрутизатор).
+func (a action) Prefix() string { return a.prefix }
+
+// Match — данные кнопки этого действия.
+func (a action) Match(data string) bool { return strings.HasPrefix(data, a.prefix) }
+
+func (a action) join(parts ...string) (string, error) {
+	data := a.prefix + strings.Join(parts, argSep)
+	if len(data) > MaxDataLen {
+		return "", fmt.Errorf("%w: %q (%d+%d)", ErrTooLong, data, len(data), SigLen)
+	}
+	return data, nil
+}
+
+func (a action) split(data string) ([]string, error) {
+	rest, ok := strings.CutPrefix(data, a.prefix)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q без префикса %q", ErrMalformed, data, a.prefix)
+	}
+	parts := strings.Split(rest, argSep)
+	if len(parts) != len(a.widths) {
+		return nil, fmt.Errorf("%w: %q — ожидали аргументов: %d", ErrMalformed, data, len(a.widths))
+	}
+	return parts, nil
+}
+
+// Action1 — действие с одним аргументом.
+type Action1[A any] struct {
+	action
+	a Field[A]
+}
+
+// NewAction1 — действие с префиксом prefix и аргументом, закодированным полем a.
+func NewAction1[A any](prefix string, a Field[A]) Action1[A] {
+	return Action1[A]{newAction(prefix, a.Width), a}
+}
+
+// Data — данные кнопки.
+func (x Action1[A]) Data(a A) (string, error) {
+	sa, err := x.a.enc(a)
+	if err != nil {
+		return "", err
+	}
+	return x.join(sa)
+}
+
+// Button — inline-кнопка действия.
+func (x Action1[A]) Button(text string, a A) (tgbotapi.InlineKeyboardButton, error) {
+	data, err := x.Data(a)
+	return tgbotapi.NewInlineKeyboardButtonData(text, data), err
+}
+
+// Parse — аргумент из данных кнопки.
+func (x Action1[A]) Parse(data string) (a A, err error) {
+	parts, err := x.split(data)
+	if err != nil {
+		return a, err
+	}
+	return x.a.dec(parts[0])
+}
+
+// Action2 — действие с двумя аргументами.
+type Action2[A, B any] struct {
+	action
+	a Field[A]
+	b Field[B]
+}
+
+// NewAction2 — действие с префиксом prefix и аргументами, закодированными полями a и b.
+func NewAction2[A, B any](prefix string, a Field[A], b Field[B]) Action2[A, B] {
+	return Action2[A, B]{newAction(prefix, a.Width, b.Width), a, b}
+}
+
+// Data — данные кнопки.
+func (x Action2[A, B]) Data(a A, b B) (string, error) {
+	sa, err := x.a.enc(a)
+	if err != nil {
+		return "", err
+	}
+	sb, err := x.b.enc(b)
+	if err != nil {
+		return "", err
+	}
+	return x.join(sa, sb)
+}
+
+// Button — inline-кнопка действия.
+func (x Action2[A, B]) Button(text string, a A, b B) (tgbotapi.InlineKeyboardButton, error) {
+	data, err := x.Data(a, b)
+	return tgbotapi.NewInlineKeyboardButtonData(text, data), err
+}
+
+// Parse — аргументы из данных кнопки.
+func (x Action2[A, B]) Parse(data string) (a A, b B, err error) {
+	parts, err := x.split(data)
+	if err != nil {
+		return a, b, err
+	}
+	if a, err = x.a.dec(parts[0]); err != nil {
+		return a, b, err
+	}
+	b, err = x.b.dec(parts[1])
+	return a, b, err
+}
+
+// Action3 — действие с тремя аргументами.
+type Action3[A, B, C any] struct {
+	action
+	a Field[A]
+	b Field[B]
+	c Field[C]
+}
+
+// NewAction3 — действие с префиксом prefix и аргументами, закодированными полями a, b и c.
+func NewAction3[A, B, C any](prefix string, a Field[A], b Field[B], c Field[C]) Action3[A, B, C] {
+	return Action3[A, B, C]{newAction(prefix, a.Width, b.Width, c.Width), a, b, c}
+}
+
+// Data — данные кнопки.
+func (x Action3[A, B, C]) Data(a A, b B, c C) (string, error) {
+	sa, err := x.a.enc(a)
+	if err != nil {
+		return "", err
+	}
+	sb, err := x.b.enc(b)
+	if err != nil {
+		return "", err
+	}
+	sc, err := x.c.enc(c)
+	if err != nil {
+		return "", err
+	}
+	return x.join(sa, sb, sc)
+}
+
+// Button — inline-кнопка действия.
+func (x Action3[A, B, C]) Button(text string, a A, b B, c C) (tgbotapi.InlineKeyboardButton, error) {
+	data, err := x.Data(a, b, c)
+	return tgbotapi.NewInlineKeyboardButtonData(text, data), err
+}
+
+// Parse — аргументы из данных кнопки.
+func (x Action3[A, B, C]) Parse(data string) (a A, b B, c C, err error) {
+	parts, err := x.split(data)
+	if err != nil {
+		return a, b, c, err
+	}
+	if a, err = x.a.dec(parts[0]); err != nil {
+		return a, b, c, err
+	}
+	if b, err = x.b.dec(parts[1]); err != nil {
+		return a, b, c, err
+	}
+	c, err = x.c.dec(parts[2])
+	return a, b, c, err
+}
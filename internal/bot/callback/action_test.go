@@ -0,0 +1,96 @@
+package callback
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAction_RoundTrip(t *testing.T) {
+	act := NewAction3("test_rt:", ID, Num, Day)
+	day := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	// худшие аргументы дают ровно зарегистрированную длину
+	data, err := act.Data(math.MaxInt64, numLimit-1, day)
+	if err != nil {
+		t.Fatalf("данные: %v", err)
+	}
+	if want := Registered()["test_rt:"]; len(data) != want {
+		t.Fatalf("длина %d, зарегистрировано %d: %q", len(data), want, data)
+	}
+	id, n, d, err := act.Parse(data)
+	if err != nil || id != math.MaxInt64 || n != numLimit-1 || !d.Equal(day) {
+		t.Fatalf("разбор %q: %d, %d, %v, %v", data, id, n, d, err)
+	}
+
+	words := NewAction2("test_w:", Word(8), IntID)
+	data, err = words.Data("7А", 42)
+	if err != nil {
+		t.Fatalf("данные: %v", err)
+	}
+	if w, v, err := words.Parse(data); err != nil || w != "7А" || v != 42 {
+		t.Fatalf("разбор %q: %q, %d, %v", data, w, v, err)
+	}
+	if !words.Match(data) || act.Match(data) {
+		t.Fatalf("Match по префиксу: %q", data)
+	}
+}
+
+func TestAction_DataErrors(t *testing.T) {
+	ids := NewAction1("test_id:", ID)
+	nums := NewAction1("test_num:", Num)
+	words := NewAction1("test_word:", Word(8))
+
+	for name, err := range map[string]error{
+		"отрицательный ID":    second(ids.Data(-1)),
+		"число вне диапазона": second(nums.Data(numLimit)),
+		"пустая строка":       second(words.Data("")),
+		"длинная строка":      second(words.Data("ninechars")),
+		"разделитель":         second(words.Data("a:b")),
+		"знак подписи":        second(words.Data("a|b")),
+	} {
+		if !errors.Is(err, ErrMalformed) {
+			t.Errorf("%s: ожидали ErrMalformed, получили %v", name, err)
+		}
+	}
+
+	// действие в обход реестра: поле шире, чем позволяет лимит
+	long := Action1[string]{action{prefix: "x", widths: []int{MaxDataLen}}, Word(MaxDataLen)}
+	if _, err := long.Data(strings.Repeat("y", MaxDataLen-1)); err != nil {
+		t.Fatalf("данные ровно по лимиту: %v", err)
+	}
+	if _, err := long.Button("кнопка", strings.Repeat("y", MaxDataLen)); !errors.Is(err, ErrTooLong) {
+		t.Fatalf("ожидали ErrTooLong, получили %v", err)
+	}
+}
+
+func TestAction_ParseErrors(t *testing.T) {
+	pair := NewAction2("test_pair:", ID, Day)
+	for _, data := range []string{
+		"other:1:20250901",
+		"test_pair:1",
+		"test_pair:1:20250901:2",
+		"test_pair:-1:20250901",
+		"test_pair:!:20250901",
+		"test_pair:1:2025-09-01",
+	} {
+		if _, _, err := pair.Parse(data); !errors.Is(err, ErrMalformed) {
+			t.Errorf("%q: ожидали ErrMalformed, получили %v", data, err)
+		}
+	}
+}
+
+func TestButtons_KeepsFirstError(t *testing.T) {
+	ids := NewAction1("test_btn:", ID)
+	var bs Buttons
+	bs.Add(ids.Button("ok", 1))
+	bs.Add(ids.Button("bad", -1))
+	bs.Data(ids.Data(-2))
+	if err := bs.Err(); err == nil || !strings.Contains(err.Error(), "-1") {
+		t.Fatalf("ожидали первую ошибку, получили %v", err)
+	}
+}
+
+func second[T any](_ T, err error) error { return err }
@@ -0,0 +1,40 @@
+package callback_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
+
+	// пакеты с кнопками: их действия регистрируются при инициализации
+	_ "github.com/Spok95/telegram-school-bot/internal/app"
+	_ "github.com/Spok95/telegram-school-bot/internal/bot/auth"
+	_ "github.com/Spok95/telegram-school-bot/internal/bot/handlers"
+)
+
+// TestRegistered_FitButton — данные каждого действия с худшими аргументами (длина —
+// по ширине полей) влезают в кнопку вместе с подписью.
+func TestRegistered_FitButton(t *testing.T) {
+	reg := callback.Registered()
+	if len(reg) < 80 {
+		t.Fatalf("зарегистрировано всего %d действий — пакеты с кнопками не подключены?", len(reg))
+	}
+	for prefix, n := range reg {
+		if n > callback.MaxDataLen {
+			t.Errorf("%q: до %d байт, лимит %d", prefix, n, callback.MaxDataLen)
+		}
+	}
+}
+
+// TestRegistered_DistinctPrefixes — префикс одного действия не начинает другой,
+// иначе Match короткого поймает чужие кнопки.
+func TestRegistered_DistinctPrefixes(t *testing.T) {
+	reg := callback.Registered()
+	for a := range reg {
+		for b := range reg {
+			if a != b && strings.HasPrefix(b, a) {
+				t.Errorf("префикс %q начинает %q", a, b)
+			}
+		}
+	}
+}
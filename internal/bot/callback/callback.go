@@ -0,0 +1,76 @@
+// Package callback — формат callback data inline-кнопок.
+//
+// Кнопка с аргументами — это действие (Action1…Action3): префикс для маршрутизации
+// и типизированные поля с фиксированной кодировкой ("score_confirm_16", "p_pick_teacher:7:f").
+// Длину данных задают типы полей, поэтому она известна заранее и проверяется тестом
+// по всем действиям. Перед отправкой tg.Send подписывает каждую кнопку: к данным
+// дописывается "|" + base64(время выдачи + HMAC от chatID, времени и данных).
+// Диспетчер проверяет подпись до маршрутизации, поэтому обработчики работают
+// с исходными данными, а поддельные и устаревшие кнопки до них не доходят.
+package callback
+
+import (
+	"errors"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// MaxLen — лимит Telegram на callback_data (в байтах).
+const MaxLen = 64
+
+var (
+	ErrTooLong   = errors.New("callback data длиннее 64 байт")
+	ErrMalformed = errors.New("неверный формат callback data")
+	ErrUnsigned  = errors.New("callback data без подписи")
+	ErrForged    = errors.New("неверная подпись callback data")
+	ErrExpired   = errors.New("кнопка устарела")
+)
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]int{}
+)
+
+// register запоминает предельную длину данных действия (см. Registered).
+func register(prefix string, n int) {
+	registryMu.Lock()
+	registry[prefix] = n
+	registryMu.Unlock()
+}
+
+// Registered — все созданные действия: префикс → наибольшая длина данных с худшими аргументами.
+func Registered() map[string]int {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	out := make(map[string]int, len(registry))
+	for p, n := range registry {
+		out[p] = n
+	}
+	return out
+}
+
+// Buttons собирает ошибки кодирования кнопок, чтобы клавиатуру можно было строить
+// выражениями: kb.Add(act.Button(…)) в строках, kb.Err() — перед отправкой.
+type Buttons struct {
+	err error
+}
+
+// Add возвращает кнопку и запоминает первую ошибку.
+func (b *Buttons) Add(btn tgbotapi.InlineKeyboardButton, err error) tgbotapi.InlineKeyboardButton {
+	if err != nil && b.err == nil {
+		b.err = err
+	}
+	return btn
+}
+
+// Data — как Add, для данных кнопки, собранной вручную.
+func (b *Buttons) Data(data string, err error) string {
+	if err != nil && b.err == nil {
+		b.err = err
+	}
+	return data
+}
+
+// Err — первая ошибка кодирования.
+func (b *Buttons) Err() error { return b.err }
@@ -0,0 +1,126 @@
+package callback
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sigSep = "|"
+	macLen = 6 // 48 бит: перебором за время жизни кнопки не подобрать
+	// clockSkew — допуск на кнопки «из будущего» (расхождение часов между репликами)
+	clockSkew = 5 * time.Minute
+)
+
+var (
+	b64 = base64.RawURLEncoding
+	// SigLen — сколько байт подпись добавляет к данным: разделитель + 4 байта времени + HMAC
+	SigLen = len(sigSep) + b64.EncodedLen(4+macLen)
+	// MaxDataLen — сколько байт остаётся на сами данные кнопки.
+	MaxDataLen = MaxLen - SigLen
+)
+
+// Codec подписывает и проверяет callback data.
+type Codec struct {
+	key []byte
+	ttl time.Duration
+	now func() time.Time
+}
+
+// NewCodec — ключ HMAC и срок жизни кнопки (0 — без ограничения).
+func NewCodec(key []byte, ttl time.Duration) *Codec {
+	return &Codec{key: append([]byte(nil), key...), ttl: ttl, now: time.Now}
+}
+
+func (c *Codec) mac(chatID int64, issued uint32, data string) []byte {
+	h := hmac.New(sha256.New, c.key)
+	var buf [12]byte
+	binary.BigEndian.PutUint64(buf[:8], uint64(chatID))
+	binary.BigEndian.PutUint32(buf[8:], issued)
+	h.Write(buf[:])
+	h.Write([]byte(data))
+	return h.Sum(nil)[:macLen]
+}
+
+// Sign дописывает к данным время выдачи и подпись для конкретного чата.
+func (c *Codec) Sign(chatID int64, data string) (string, error) {
+	if len(data)+SigLen > MaxLen {
+		return "", fmt.Errorf("%w: %q (%d+%d)", ErrTooLong, data, len(data), SigLen)
+	}
+	issued := uint32(c.now().Unix())
+	raw := make([]byte, 4, 4+macLen)
+	binary.BigEndian.PutUint32(raw, issued)
+	raw = append(raw, c.mac(chatID, issued, data)...)
+	return data + sigSep + b64.EncodeToString(raw), nil
+}
+
+// stripSig убирает из токена подпись правильного вида (какой бы она ни была по сроку и ключу).
+func stripSig(token string) string {
+	i := strings.LastIndex(token, sigSep)
+	if i < 0 {
+		return token
+	}
+	if raw, err := b64.DecodeString(token[i+1:]); err != nil || len(raw) != 4+macLen {
+		return token
+	}
+	return token[:i]
+}
+
+// Verify проверяет подпись и срок жизни и возвращает исходные данные.
+func (c *Codec) Verify(chatID int64, token string) (string, error) {
+	i := strings.LastIndex(token, sigSep)
+	if i < 0 {
+		return "", ErrUnsigned
+	}
+	data, sig := token[:i], token[i+1:]
+	raw, err := b64.DecodeString(sig)
+	if err != nil || len(raw) != 4+macLen {
+		return "", ErrForged
+	}
+	issued := binary.BigEndian.Uint32(raw[:4])
+	if !hmac.Equal(raw[4:], c.mac(chatID, issued, data)) {
+		return "", ErrForged
+	}
+	at := time.Unix(int64(issued), 0)
+	now := c.now()
+	if at.After(now.Add(clockSkew)) {
+		return "", ErrForged
+	}
+	if c.ttl > 0 && now.Sub(at) > c.ttl {
+		return "", ErrExpired
+	}
+	return data, nil
+}
+
+var (
+	defMu    sync.RWMutex
+	defCodec = newRandomCodec()
+)
+
+// newRandomCodec — кодек по умолчанию (тесты, запуск без Init): ключ живёт до рестарта.
+func newRandomCodec() *Codec {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	return NewCodec(key, 0)
+}
+
+// Init задаёт ключ и срок жизни кнопок для всего процесса (вызывается из main).
+func Init(key []byte, ttl time.Duration) {
+	defMu.Lock()
+	defCodec = NewCodec(key, ttl)
+	defMu.Unlock()
+}
+
+// Default — текущий кодек процесса.
+func Default() *Codec {
+	defMu.RLock()
+	defer defMu.RUnlock()
+	return defCodec
+}
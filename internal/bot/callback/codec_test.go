@@ -0,0 +1,125 @@
+package callback
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func testCodec(ttl time.Duration) (*Codec, *time.Time) {
+	c := NewCodec([]byte("test-key"), ttl)
+	now := time.Date(2025, 9, 1, 10, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	return c, &now
+}
+
+func TestCodec_RoundTrip(t *testing.T) {
+	c, _ := testCodec(time.Hour)
+	data := "p_pick_teacher:7:f"
+	tok, err := c.Sign(42, data)
+	if err != nil {
+		t.Fatalf("подпись: %v", err)
+	}
+	if len(tok) > MaxLen || len(tok) != len(data)+SigLen {
+		t.Fatalf("неожиданная длина токена %d: %q", len(tok), tok)
+	}
+	got, err := c.Verify(42, tok)
+	if err != nil || got != data {
+		t.Fatalf("ожидали %q, получили %q (%v)", data, got, err)
+	}
+}
+
+func TestCodec_Rejects(t *testing.T) {
+	c, now := testCodec(time.Hour)
+	tok, _ := c.Sign(42, "score_confirm_5")
+
+	if _, err := c.Verify(43, tok); !errors.Is(err, ErrForged) {
+		t.Fatalf("кнопка из чужого чата должна отклоняться, получили %v", err)
+	}
+	tampered := strings.Replace(tok, "score_confirm_5", "score_confirm_6", 1)
+	if _, err := c.Verify(42, tampered); !errors.Is(err, ErrForged) {
+		t.Fatalf("изменённые данные должны отклоняться, получили %v", err)
+	}
+	if _, err := c.Verify(42, "score_confirm_5"); !errors.Is(err, ErrUnsigned) {
+		t.Fatalf("кнопка без подписи должна отклоняться, получили %v", err)
+	}
+	other := NewCodec([]byte("other-key"), time.Hour)
+	if _, err := other.Verify(42, tok); !errors.Is(err, ErrForged) {
+		t.Fatalf("чужой ключ не должен принимать подпись, получили %v", err)
+	}
+
+	*now = now.Add(2 * time.Hour)
+	if _, err := c.Verify(42, tok); !errors.Is(err, ErrExpired) {
+		t.Fatalf("устаревшая кнопка должна отклоняться, получили %v", err)
+	}
+}
+
+func TestCodec_TooLong(t *testing.T) {
+	c, _ := testCodec(0)
+	if _, err := c.Sign(1, strings.Repeat("x", MaxLen-SigLen)); err != nil {
+		t.Fatalf("данные ровно по лимиту должны подписываться: %v", err)
+	}
+	if _, err := c.Sign(1, strings.Repeat("x", MaxLen-SigLen+1)); !errors.Is(err, ErrTooLong) {
+		t.Fatalf("ожидали ErrTooLong, получили %v", err)
+	}
+}
+
+func TestSignChattable(t *testing.T) {
+	c, _ := testCodec(time.Hour)
+	kb := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("Да", "score_confirm_5"),
+		tgbotapi.NewInlineKeyboardButtonURL("Ссылка", "https://example.org"),
+	))
+	msg := tgbotapi.NewMessage(42, "карточка")
+	msg.ReplyMarkup = kb
+
+	signed, err := c.SignChattable(msg)
+	if err != nil {
+		t.Fatalf("подпись сообщения: %v", err)
+	}
+	out := signed.(tgbotapi.MessageConfig).ReplyMarkup.(tgbotapi.InlineKeyboardMarkup)
+	if *kb.InlineKeyboard[0][0].CallbackData != "score_confirm_5" {
+		t.Fatal("исходная клавиатура не должна меняться")
+	}
+	tok := *out.InlineKeyboard[0][0].CallbackData
+	if got, err := c.Verify(42, tok); err != nil || got != "score_confirm_5" {
+		t.Fatalf("кнопка подписана неверно: %q, %v", got, err)
+	}
+	if out.InlineKeyboard[0][1].CallbackData != nil {
+		t.Fatal("URL-кнопка не должна получать callback data")
+	}
+
+	// повторная отправка уже подписанной клавиатуры не подписывает её второй раз
+	edit := tgbotapi.NewEditMessageReplyMarkup(42, 1, out)
+	again, err := c.SignChattable(edit)
+	if err != nil {
+		t.Fatalf("подпись правки: %v", err)
+	}
+	if got := *again.(tgbotapi.EditMessageReplyMarkupConfig).ReplyMarkup.InlineKeyboard[0][0].CallbackData; got != tok {
+		t.Fatalf("ожидали прежний токен %q, получили %q", tok, got)
+	}
+}
+
+func TestSignMarkup_ReplacesStaleSignature(t *testing.T) {
+	c, now := testCodec(time.Hour)
+	old, _ := c.Sign(42, "score_confirm_5")
+	*now = now.Add(2 * time.Hour)
+
+	kb := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("Да", old),
+	))
+	out, err := c.SignMarkup(42, kb)
+	if err != nil {
+		t.Fatalf("подпись: %v", err)
+	}
+	tok := *out.InlineKeyboard[0][0].CallbackData
+	if got, err := c.Verify(42, tok); err != nil || got != "score_confirm_5" {
+		t.Fatalf("ожидали переподписанные исходные данные, получили %q (%v)", got, err)
+	}
+	if strings.Count(tok, sigSep) != 1 {
+		t.Fatalf("старая подпись осталась в токене: %q", tok)
+	}
+}
@@ -0,0 +1,81 @@
+package callback
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// SignMarkup возвращает копию клавиатуры с подписанными callback-кнопками.
+// Исходная клавиатура не меняется (её могут переиспользовать для другого чата);
+// уже подписанные для этого чата кнопки повторно не подписываются, а у устаревших
+// и подписанных для другого чата старая подпись заменяется новой.
+func (c *Codec) SignMarkup(chatID int64, mk tgbotapi.InlineKeyboardMarkup) (tgbotapi.InlineKeyboardMarkup, error) {
+	out := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: make([][]tgbotapi.InlineKeyboardButton, len(mk.InlineKeyboard))}
+	for i, row := range mk.InlineKeyboard {
+		out.InlineKeyboard[i] = make([]tgbotapi.InlineKeyboardButton, len(row))
+		for j, btn := range row {
+			if btn.CallbackData != nil {
+				if _, err := c.Verify(chatID, *btn.CallbackData); err != nil {
+					signed, err := c.Sign(chatID, stripSig(*btn.CallbackData))
+					if err != nil {
+						return mk, err
+					}
+					btn.CallbackData = &signed
+				}
+			}
+			out.InlineKeyboard[i][j] = btn
+		}
+	}
+	return out, nil
+}
+
+// SignChattable подписывает inline-клавиатуру в исходящем запросе к Telegram.
+// Типы без клавиатуры возвращаются как есть.
+func (c *Codec) SignChattable(msg tgbotapi.Chattable) (tgbotapi.Chattable, error) {
+	var err error
+	switch m := msg.(type) {
+	case tgbotapi.MessageConfig:
+		m.BaseChat, err = c.signBaseChat(m.BaseChat)
+		return m, err
+	case tgbotapi.DocumentConfig:
+		m.BaseChat, err = c.signBaseChat(m.BaseChat)
+		return m, err
+	case tgbotapi.PhotoConfig:
+		m.BaseChat, err = c.signBaseChat(m.BaseChat)
+		return m, err
+	case tgbotapi.EditMessageTextConfig:
+		m.BaseEdit, err = c.signBaseEdit(m.BaseEdit)
+		return m, err
+	case tgbotapi.EditMessageReplyMarkupConfig:
+		m.BaseEdit, err = c.signBaseEdit(m.BaseEdit)
+		return m, err
+	case tgbotapi.EditMessageCaptionConfig:
+		m.BaseEdit, err = c.signBaseEdit(m.BaseEdit)
+		return m, err
+	}
+	return msg, nil
+}
+
+func (c *Codec) signBaseChat(b tgbotapi.BaseChat) (tgbotapi.BaseChat, error) {
+	switch mk := b.ReplyMarkup.(type) {
+	case tgbotapi.InlineKeyboardMarkup:
+		signed, err := c.SignMarkup(b.ChatID, mk)
+		b.ReplyMarkup = signed
+		return b, err
+	case *tgbotapi.InlineKeyboardMarkup:
+		if mk != nil {
+			signed, err := c.SignMarkup(b.ChatID, *mk)
+			b.ReplyMarkup = &signed
+			return b, err
+		}
+	}
+	return b, nil
+}
+
+func (c *Codec) signBaseEdit(b tgbotapi.BaseEdit) (tgbotapi.BaseEdit, error) {
+	if b.ReplyMarkup == nil {
+		return b, nil
+	}
+	signed, err := c.SignMarkup(b.ChatID, *b.ReplyMarkup)
+	b.ReplyMarkup = &signed
+	return b, err
+}
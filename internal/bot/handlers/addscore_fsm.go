@@ -6,14 +6,16 @@ import (
 	"fmt"
 	"log"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmstore"
 	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmutil"
 	"github.com/Spok95/telegram-school-bot/internal/db"
 	"github.com/Spok95/telegram-school-bot/internal/metrics"
 	"github.com/Spok95/telegram-school-bot/internal/models"
+	"github.com/Spok95/telegram-school-bot/internal/rating"
 	"github.com/Spok95/telegram-school-bot/internal/tg"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -26,7 +28,7 @@ type AddFSMState struct {
 	CategoryID           int
 	LevelID              int
 	Comment              string
-	RequestID            string
+	RequestID            int64
 	CategoryName         string
 	LevelLabel           string
 	LevelValue           int
@@ -34,7 +36,17 @@ type AddFSMState struct {
 	MessageID            int
 }
 
-var addStates = make(map[int64]*AddFSMState)
+var addStates = fsmstore.NewMap[*AddFSMState]("add_score", 2, fsmstore.DefaultTTL)
+
+// Кнопки мастера начисления (формат — см. пакет callback).
+var (
+	cbAddClassNum    = callback.NewAction1("add_class_num_", callback.Num)
+	cbAddClassLetter = callback.NewAction1("add_class_letter_", callback.Word(8))
+	cbAddStudent     = callback.NewAction1("add_score_student_", callback.ID)
+	cbAddCategory    = callback.NewAction1("add_score_category_", callback.IntID)
+	cbAddLevel       = callback.NewAction1("add_score_level_", callback.IntID)
+	cbAddConfirm     = callback.NewAction1("add_confirm:", callback.ID) // RequestID карточки
+)
 
 // ==== helpers ====
 
@@ -64,11 +76,10 @@ func StartAddScoreFSM(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.D
 		}
 		return
 	}
-	delete(addStates, chatID)
-	addStates[chatID] = &AddFSMState{
+	addStates.Set(ctx, chatID, &AddFSMState{
 		Step:               1,
 		SelectedStudentIDs: []int64{},
-	}
+	})
 
 	out := tgbotapi.NewMessage(chatID, "Выберите номер класса:")
 
@@ -92,15 +103,18 @@ func StartAddScoreFSM(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.D
 	}
 	sort.Ints(nums)
 
+	var bs callback.Buttons
 	var rows [][]tgbotapi.InlineKeyboardButton
 	for _, n := range nums {
-		cb := fmt.Sprintf("add_class_num_%d", n)
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d класс", n), cb),
+			bs.Add(cbAddClassNum.Button(fmt.Sprintf("%d класс", n), n)),
 		))
 	}
 	rows = append(rows, addBackCancelRow())
 
+	if buttonsFailed(&bs) {
+		return
+	}
 	out.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
 	if _, err := tg.Send(bot, out); err != nil {
 		metrics.HandlerErrors.Inc()
@@ -111,15 +125,17 @@ func StartAddScoreFSM(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.D
 
 func HandleAddScoreCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, cq *tgbotapi.CallbackQuery) {
 	chatID := cq.From.ID
-	state, ok := addStates[chatID]
+	state, ok := addStates.Get(chatID)
 	if !ok {
 		return
 	}
+	defer addStates.Save(ctx, chatID)
 	data := cq.Data
+	var bs callback.Buttons
 
 	// ❌ Отмена — прячем клавиатуру у этого сообщения и меняем текст
 	if data == "add_cancel" {
-		delete(addStates, chatID)
+		addStates.Delete(ctx, chatID)
 		fsmutil.DisableMarkup(bot, chatID, cq.Message.MessageID)
 		edit := tgbotapi.NewEditMessageText(chatID, cq.Message.MessageID, "🚫 Начисление отменено.")
 		if _, err := tg.Send(bot, edit); err != nil {
@@ -129,17 +145,17 @@ func HandleAddScoreCallback(ctx context.Context, bot *tgbotapi.BotAPI, database
 	}
 
 	// Обработка подтверждения (мгновенная запись)
-	if strings.HasPrefix(data, "add_confirm:") {
-		rid := strings.TrimPrefix(data, "add_confirm:")
+	if cbAddConfirm.Match(data) {
+		rid, err := cbAddConfirm.Parse(data)
 
 		// простая проверка идемпотентности по request_id
-		if rid == "" || rid != state.RequestID {
+		if err != nil || rid == 0 || rid != state.RequestID {
 			fsmutil.DisableMarkup(bot, chatID, cq.Message.MessageID)
 			return
 		}
 
 		// one-shot защита на чат: если уже обрабатывается — игнор
-		key := fmt.Sprintf("add_confirm:%s", rid)
+		key := fmt.Sprintf("add_confirm:%d", rid)
 		if !fsmutil.SetPending(chatID, key) {
 			return
 		}
@@ -160,7 +176,7 @@ func HandleAddScoreCallback(ctx context.Context, bot *tgbotapi.BotAPI, database
 			if _, err := tg.Send(bot, edit); err != nil {
 				metrics.HandlerErrors.Inc()
 			}
-			delete(addStates, chatID)
+			addStates.Delete(ctx, chatID)
 			return
 		}
 		now := time.Now()
@@ -196,7 +212,13 @@ func HandleAddScoreCallback(ctx context.Context, bot *tgbotapi.BotAPI, database
 			}
 		}
 
-		msgText := "✅ Баллы начислены. 30% учтены в коллективном рейтинге класса."
+		msgText := "✅ Баллы начислены."
+		if cat, err := db.GetCategoryByID(ctx, database, int64(state.CategoryID)); err == nil && level != nil {
+			rule := rating.Rule{Affects: cat.AffectsCollective, Percent: cat.CollectivePercent}.WithLevel(level.CollectivePercent)
+			if rule.Affects && rule.Percent > 0 {
+				msgText += fmt.Sprintf(" %d%% учтены в коллективном рейтинге класса.", rule.Percent)
+			}
+		}
 		if len(skipped) > 0 {
 			msgText += "\n⚠️ Пропущены (неактивны): " + strings.Join(skipped, ", ")
 		}
@@ -204,7 +226,7 @@ func HandleAddScoreCallback(ctx context.Context, bot *tgbotapi.BotAPI, database
 		if _, err := tg.Send(bot, edit); err != nil {
 			metrics.HandlerErrors.Inc()
 		}
-		delete(addStates, chatID)
+		addStates.Delete(ctx, chatID)
 		return
 	}
 
@@ -240,13 +262,15 @@ func HandleAddScoreCallback(ctx context.Context, bot *tgbotapi.BotAPI, database
 
 			var rows [][]tgbotapi.InlineKeyboardButton
 			for _, n := range nums {
-				cb := fmt.Sprintf("add_class_num_%d", n)
 				rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-					tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d класс", n), cb),
+					bs.Add(cbAddClassNum.Button(fmt.Sprintf("%d класс", n), n)),
 				))
 			}
 			rows = append(rows, addBackCancelRow())
 
+			if buttonsFailed(&bs) {
+				return
+			}
 			addEditMenu(bot, chatID, cq.Message.MessageID, "Выберите номер класса:", rows)
 			return
 		case 3: // выбирали учеников → вернёмся к букве
@@ -264,11 +288,14 @@ func HandleAddScoreCallback(ctx context.Context, bot *tgbotapi.BotAPI, database
 					continue
 				}
 				rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-					tgbotapi.NewInlineKeyboardButtonData(strings.ToUpper(c.Letter), "add_class_letter_"+strings.ToUpper(c.Letter)),
+					bs.Add(cbAddClassLetter.Button(strings.ToUpper(c.Letter), strings.ToUpper(c.Letter))),
 				))
 			}
 			rows = append(rows, addBackCancelRow())
 
+			if buttonsFailed(&bs) {
+				return
+			}
 			addEditMenu(bot, chatID, cq.Message.MessageID, "Выберите букву класса:", rows)
 			return
 		case 4: // выбирали категорию → назад к ученикам
@@ -281,15 +308,17 @@ func HandleAddScoreCallback(ctx context.Context, bot *tgbotapi.BotAPI, database
 				if containsInt64(state.SelectedStudentIDs, s.ID) {
 					label = "✅ " + label
 				}
-				callback := fmt.Sprintf("add_score_student_%d", s.ID)
 				buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
-					tgbotapi.NewInlineKeyboardButtonData(label, callback),
+					bs.Add(cbAddStudent.Button(label, s.ID)),
 				))
 			}
 			buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
 				tgbotapi.NewInlineKeyboardButtonData("✅ Выбрать всех", "add_select_all_students"),
 			))
 			buttons = append(buttons, addBackCancelRow())
+			if buttonsFailed(&bs) {
+				return
+			}
 			addEditMenu(bot, chatID, cq.Message.MessageID, "Выберите ученика или учеников:", buttons)
 			return
 		case 5: // выбирали уровень → назад к категории
@@ -309,12 +338,14 @@ func HandleAddScoreCallback(ctx context.Context, bot *tgbotapi.BotAPI, database
 			}
 			var buttons [][]tgbotapi.InlineKeyboardButton
 			for _, c := range categories {
-				callback := fmt.Sprintf("add_score_category_%d", c.ID)
 				buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
-					tgbotapi.NewInlineKeyboardButtonData(c.Name, callback),
+					bs.Add(cbAddCategory.Button(c.Name, c.ID)),
 				))
 			}
 			buttons = append(buttons, addBackCancelRow())
+			if buttonsFailed(&bs) {
+				return
+			}
 			addEditMenu(bot, chatID, cq.Message.MessageID, "Выберите категорию:", buttons)
 			return
 		case 6: // карточка подтверждения → назад к выбору уровня
@@ -322,13 +353,15 @@ func HandleAddScoreCallback(ctx context.Context, bot *tgbotapi.BotAPI, database
 			levels, _ := db.GetLevelsByCategoryIDFull(ctx, database, int64(state.CategoryID), false)
 			var buttons [][]tgbotapi.InlineKeyboardButton
 			for _, l := range levels {
-				callback := fmt.Sprintf("add_score_level_%d", l.ID)
 				label := fmt.Sprintf("%s (%d)", l.Label, l.Value)
 				buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
-					tgbotapi.NewInlineKeyboardButtonData(label, callback),
+					bs.Add(cbAddLevel.Button(label, l.ID)),
 				))
 			}
 			buttons = append(buttons, addBackCancelRow())
+			if buttonsFailed(&bs) {
+				return
+			}
 			addEditMenu(bot, chatID, cq.Message.MessageID, "Выберите уровень:", buttons)
 			return
 		case 7: // ввод комментария → назад к карточке подтверждения
@@ -336,7 +369,7 @@ func HandleAddScoreCallback(ctx context.Context, bot *tgbotapi.BotAPI, database
 			renderAddConfirm(bot, chatID, cq.Message.MessageID, state)
 			return
 		default:
-			delete(addStates, chatID)
+			addStates.Delete(ctx, chatID)
 			fsmutil.DisableMarkup(bot, chatID, cq.Message.MessageID)
 			edit := tgbotapi.NewEditMessageText(chatID, cq.Message.MessageID, "🚫 Начисление отменено.")
 			if _, err := tg.Send(bot, edit); err != nil {
@@ -348,10 +381,12 @@ func HandleAddScoreCallback(ctx context.Context, bot *tgbotapi.BotAPI, database
 
 	// ==== обычные ветки ====
 
-	if strings.HasPrefix(data, "add_class_num_") {
-		numStr := strings.TrimPrefix(data, "add_class_num_")
-		num, _ := strconv.ParseInt(numStr, 10, 64)
-		state.ClassNumber = num
+	if cbAddClassNum.Match(data) {
+		num, err := cbAddClassNum.Parse(data)
+		if err != nil {
+			return
+		}
+		state.ClassNumber = int64(num)
 		state.Step = 2
 
 		// тянем видимые классы и рисуем только буквы этого номера
@@ -367,22 +402,29 @@ func HandleAddScoreCallback(ctx context.Context, bot *tgbotapi.BotAPI, database
 				continue
 			}
 			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData(strings.ToUpper(c.Letter), "add_class_letter_"+strings.ToUpper(c.Letter)),
+				bs.Add(cbAddClassLetter.Button(strings.ToUpper(c.Letter), strings.ToUpper(c.Letter))),
 			))
 		}
 		rows = append(rows, addBackCancelRow())
 
+		if buttonsFailed(&bs) {
+			return
+		}
 		addEditMenu(bot, chatID, cq.Message.MessageID, "Выберите букву класса:", rows)
 		return
 	}
 
-	if strings.HasPrefix(data, "add_class_letter_") {
-		state.ClassLetter = strings.TrimPrefix(data, "add_class_letter_")
+	if cbAddClassLetter.Match(data) {
+		letter, err := cbAddClassLetter.Parse(data)
+		if err != nil {
+			return
+		}
+		state.ClassLetter = letter
 		state.Step = 3
 
 		students, _ := db.GetStudentsByClass(ctx, database, state.ClassNumber, state.ClassLetter)
 		if len(students) == 0 {
-			delete(addStates, chatID)
+			addStates.Delete(ctx, chatID)
 			fsmutil.DisableMarkup(bot, chatID, cq.Message.MessageID)
 			edit := tgbotapi.NewEditMessageText(chatID, cq.Message.MessageID, "❌ В этом классе нет учеников.")
 			if _, err := tg.Send(bot, edit); err != nil {
@@ -392,9 +434,8 @@ func HandleAddScoreCallback(ctx context.Context, bot *tgbotapi.BotAPI, database
 		}
 		var buttons [][]tgbotapi.InlineKeyboardButton
 		for _, s := range students {
-			callback := fmt.Sprintf("add_score_student_%d", s.ID)
 			buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData(s.Name, callback),
+				bs.Add(cbAddStudent.Button(s.Name, s.ID)),
 			))
 		}
 		buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
@@ -402,15 +443,19 @@ func HandleAddScoreCallback(ctx context.Context, bot *tgbotapi.BotAPI, database
 		))
 		buttons = append(buttons, addBackCancelRow())
 
+		if buttonsFailed(&bs) {
+			return
+		}
 		addEditMenu(bot, chatID, cq.Message.MessageID, "Выберите ученика или учеников:", buttons)
 		return
 	}
 
-	if strings.HasPrefix(data, "add_score_student_") || data == "add_select_all_students" {
-		idStr := strings.TrimPrefix(data, "add_score_student_")
-		id, _ := strconv.ParseInt(idStr, 10, 64)
-
+	if cbAddStudent.Match(data) || data == "add_select_all_students" {
 		if data != "add_select_all_students" {
+			id, err := cbAddStudent.Parse(data)
+			if err != nil {
+				return
+			}
 			// toggle: если уже выбран — снимаем
 			removed := false
 			for i, sid := range state.SelectedStudentIDs {
@@ -448,9 +493,8 @@ func HandleAddScoreCallback(ctx context.Context, bot *tgbotapi.BotAPI, database
 			if containsInt64(state.SelectedStudentIDs, s.ID) {
 				label = "✅ " + label
 			}
-			callback := fmt.Sprintf("add_score_student_%d", s.ID)
 			buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData(label, callback),
+				bs.Add(cbAddStudent.Button(label, s.ID)),
 			))
 		}
 		buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
@@ -463,6 +507,9 @@ func HandleAddScoreCallback(ctx context.Context, bot *tgbotapi.BotAPI, database
 		}
 		buttons = append(buttons, addBackCancelRow())
 
+		if buttonsFailed(&bs) {
+			return
+		}
 		addEditMenu(bot, chatID, cq.Message.MessageID, "Выберите ученика или учеников:", buttons)
 		return
 	}
@@ -486,36 +533,46 @@ func HandleAddScoreCallback(ctx context.Context, bot *tgbotapi.BotAPI, database
 
 		var buttons [][]tgbotapi.InlineKeyboardButton
 		for _, c := range categories {
-			callback := fmt.Sprintf("add_score_category_%d", c.ID)
 			buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData(c.Name, callback),
+				bs.Add(cbAddCategory.Button(c.Name, c.ID)),
 			))
 		}
 		buttons = append(buttons, addBackCancelRow())
+		if buttonsFailed(&bs) {
+			return
+		}
 		addEditMenu(bot, chatID, cq.Message.MessageID, "Выберите категорию:", buttons)
 		return
 	}
 
-	if strings.HasPrefix(data, "add_score_category_") {
-		catID, _ := strconv.Atoi(strings.TrimPrefix(data, "add_score_category_"))
+	if cbAddCategory.Match(data) {
+		catID, err := cbAddCategory.Parse(data)
+		if err != nil {
+			return
+		}
 		state.CategoryID = catID
 		state.Step = 5
 		levels, _ := db.GetLevelsByCategoryIDFull(ctx, database, int64(state.CategoryID), false)
 		var buttons [][]tgbotapi.InlineKeyboardButton
 		for _, l := range levels {
-			callback := fmt.Sprintf("add_score_level_%d", l.ID)
 			label := fmt.Sprintf("%s (%d)", l.Label, l.Value)
 			buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData(label, callback),
+				bs.Add(cbAddLevel.Button(label, l.ID)),
 			))
 		}
 		buttons = append(buttons, addBackCancelRow())
+		if buttonsFailed(&bs) {
+			return
+		}
 		addEditMenu(bot, chatID, cq.Message.MessageID, "Выберите уровень:", buttons)
 		return
 	}
 
-	if strings.HasPrefix(data, "add_score_level_") {
-		lvlID, _ := strconv.Atoi(strings.TrimPrefix(data, "add_score_level_"))
+	if cbAddLevel.Match(data) {
+		lvlID, err := cbAddLevel.Parse(data)
+		if err != nil {
+			return
+		}
 		state.LevelID = lvlID
 		state.Step = 6
 
@@ -544,7 +601,7 @@ func HandleAddScoreCallback(ctx context.Context, bot *tgbotapi.BotAPI, database
 			if _, err := tg.Send(bot, edit); err != nil {
 				metrics.HandlerErrors.Inc()
 			}
-			delete(addStates, chatID)
+			addStates.Delete(ctx, chatID)
 			return
 		}
 
@@ -560,7 +617,7 @@ func HandleAddScoreCallback(ctx context.Context, bot *tgbotapi.BotAPI, database
 		}
 		state.SelectedStudentNames = names
 
-		state.RequestID = fmt.Sprintf("%d_%d", chatID, time.Now().UnixNano())
+		state.RequestID = time.Now().UnixNano()
 		state.MessageID = cq.Message.MessageID
 
 		// рендер карточки подтверждения
@@ -578,15 +635,16 @@ func HandleAddScoreText(ctx context.Context, bot *tgbotapi.BotAPI, msg *tgbotapi
 	default:
 	}
 	chatID := msg.Chat.ID
-	state, ok := addStates[chatID]
+	state, ok := addStates.Get(chatID)
 	if !ok {
 		return
 	}
+	defer addStates.Save(ctx, chatID)
 
 	if state.Step == 7 {
 		// ввод опционального комментария
 		if fsmutil.IsCancelText(msg.Text) {
-			delete(addStates, chatID)
+			addStates.Delete(ctx, chatID)
 			if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "🚫 Начисление отменено.")); err != nil {
 				metrics.HandlerErrors.Inc()
 			}
@@ -614,12 +672,12 @@ func HandleAddScoreText(ctx context.Context, bot *tgbotapi.BotAPI, msg *tgbotapi
 		}
 		return
 	}
-	delete(addStates, chatID)
+	addStates.Delete(ctx, chatID)
 }
 
 // GetAddScoreState доступ из main.go
 func GetAddScoreState(chatID int64) *AddFSMState {
-	return addStates[chatID]
+	return addStates.Value(chatID)
 }
 
 // renderAddConfirm — единый рендер карточки подтверждения начисления.
@@ -633,13 +691,17 @@ func renderAddConfirm(bot *tgbotapi.BotAPI, chatID int64, messageID int, state *
 	if trim := strings.TrimSpace(state.Comment); trim != "" {
 		text += "\nКомментарий: " + trim
 	}
+	var bs callback.Buttons
 	rows := [][]tgbotapi.InlineKeyboardButton{
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("✏️ Комментарий", "add_comment"),
-			tgbotapi.NewInlineKeyboardButtonData("✅ Да", "add_confirm:"+state.RequestID),
+			bs.Add(cbAddConfirm.Button("✅ Да", state.RequestID)),
 		),
 	}
 	rows = append(rows, addBackCancelRow())
+	if buttonsFailed(&bs) {
+		return
+	}
 	markup := tgbotapi.NewInlineKeyboardMarkup(rows...)
 	edit := tgbotapi.NewEditMessageText(chatID, messageID, text)
 	edit.ReplyMarkup = &markup
@@ -5,17 +5,26 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
-	"strings"
 	"time"
 
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
 	"github.com/Spok95/telegram-school-bot/internal/bot/menu"
 	"github.com/Spok95/telegram-school-bot/internal/db"
 	"github.com/Spok95/telegram-school-bot/internal/metrics"
 	"github.com/Spok95/telegram-school-bot/internal/models"
+	"github.com/Spok95/telegram-school-bot/internal/notify"
 	"github.com/Spok95/telegram-school-bot/internal/tg"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
+// Кнопки заявок (формат — см. пакет callback).
+var (
+	cbUserConfirm = callback.NewAction1("confirm_", callback.ID)      // users.id
+	cbUserReject  = callback.NewAction1("reject_", callback.ID)       // users.id
+	cbLinkConfirm = callback.NewAction1("link_confirm_", callback.ID) // parent_link_requests.id
+	cbLinkReject  = callback.NewAction1("link_reject_", callback.ID)
+)
+
 var notifiedAdmins = make(map[int64]bool)
 
 func ShowPendingUsers(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, chatID int64) {
@@ -101,8 +110,12 @@ func ShowPendingUsers(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.D
 			msg = fmt.Sprintf("Заявка:\n👤 %s\n🧩 Роль: %s\nTelegramID: %d", name, role, tgID)
 		}
 
-		btnYes := tgbotapi.NewInlineKeyboardButtonData("✅ Подтвердить", fmt.Sprintf("confirm_%d", id))
-		brnNo := tgbotapi.NewInlineKeyboardButtonData("❌ Отклонить", fmt.Sprintf("reject_%d", id))
+		var bs callback.Buttons
+		btnYes := bs.Add(cbUserConfirm.Button("✅ Подтвердить", int64(id)))
+		brnNo := bs.Add(cbUserReject.Button("❌ Отклонить", int64(id)))
+		if buttonsFailed(&bs) {
+			continue
+		}
 		markup := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(btnYes, brnNo))
 
 		message := tgbotapi.NewMessage(adminID, msg)
@@ -113,16 +126,17 @@ func ShowPendingUsers(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.D
 	}
 }
 
-func HandleAdminCallback(ctx context.Context, callback *tgbotapi.CallbackQuery, database *sql.DB, bot *tgbotapi.BotAPI, adminID int64) {
-	data := callback.Data
-	messageID := callback.Message.MessageID
-	chatID := callback.Message.Chat.ID
-	adminUsername := callback.From.UserName
-
-	if strings.HasPrefix(data, "confirm_") {
-		idStr := strings.TrimPrefix(data, "confirm_")
+func HandleAdminCallback(ctx context.Context, cq *tgbotapi.CallbackQuery, database *sql.DB, bot *tgbotapi.BotAPI, adminID int64) {
+	data := cq.Data
+	messageID := cq.Message.MessageID
+	chatID := cq.Message.Chat.ID
+	adminUsername := cq.From.UserName
 
-		err := ConfirmUser(ctx, database, bot, idStr, adminID)
+	if cbUserConfirm.Match(data) {
+		userID, err := cbUserConfirm.Parse(data)
+		if err == nil {
+			err = ConfirmUser(ctx, database, bot, userID, adminID)
+		}
 		if err != nil {
 			if _, err := tg.Send(bot, tgbotapi.NewMessage(adminID, "❌ Ошибка подтверждения заявки.")); err != nil {
 				metrics.HandlerErrors.Inc()
@@ -135,10 +149,11 @@ func HandleAdminCallback(ctx context.Context, callback *tgbotapi.CallbackQuery,
 		if _, err := tg.Send(bot, edit); err != nil {
 			metrics.HandlerErrors.Inc()
 		}
-	} else if strings.HasPrefix(data, "reject_") {
-		idStr := strings.TrimPrefix(data, "reject_")
-
-		err := RejectUser(ctx, database, bot, idStr)
+	} else if cbUserReject.Match(data) {
+		userID, err := cbUserReject.Parse(data)
+		if err == nil {
+			err = RejectUser(ctx, database, bot, userID)
+		}
 		if err != nil {
 			if _, err := tg.Send(bot, tgbotapi.NewMessage(adminID, "❌ Ошибка отклонения заявки.")); err != nil {
 				metrics.HandlerErrors.Inc()
@@ -157,7 +172,7 @@ func HandleAdminCallback(ctx context.Context, callback *tgbotapi.CallbackQuery,
 	}
 }
 
-func ConfirmUser(ctx context.Context, database *sql.DB, bot *tgbotapi.BotAPI, name string, adminTG int64) error {
+func ConfirmUser(ctx context.Context, database *sql.DB, bot *tgbotapi.BotAPI, userID, adminTG int64) error {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 	tx, err := database.BeginTx(ctx, &sql.TxOptions{})
@@ -167,21 +182,21 @@ func ConfirmUser(ctx context.Context, database *sql.DB, bot *tgbotapi.BotAPI, na
 	defer func() { _ = tx.Rollback() }()
 
 	var telegramID int64
-	err = tx.QueryRowContext(ctx, `SELECT telegram_id FROM users WHERE id = $1`, name).Scan(&telegramID)
+	err = tx.QueryRowContext(ctx, `SELECT telegram_id FROM users WHERE id = $1`, userID).Scan(&telegramID)
 	if err != nil {
 		return err
 	}
 
 	// Получаем текущую роль (до подтверждения)
 	var role string
-	err = tx.QueryRowContext(ctx, `SELECT role FROM users WHERE id = $1 AND confirmed = FALSE`, name).Scan(&role)
+	err = tx.QueryRowContext(ctx, `SELECT role FROM users WHERE id = $1 AND confirmed = FALSE`, userID).Scan(&role)
 	if err != nil {
 		// либо уже подтверждён, либо не найден
 		return fmt.Errorf("заявка не найдена или уже обработана")
 	}
 
 	// Подтверждаем, только если ещё не подтверждён
-	res, err := tx.ExecContext(ctx, `UPDATE users SET confirmed = TRUE WHERE id = $1 AND confirmed = FALSE`, name)
+	res, err := tx.ExecContext(ctx, `UPDATE users SET confirmed = TRUE WHERE id = $1 AND confirmed = FALSE`, userID)
 	if err != nil {
 		return err
 	}
@@ -200,7 +215,7 @@ func ConfirmUser(ctx context.Context, database *sql.DB, bot *tgbotapi.BotAPI, na
 	_, err = tx.ExecContext(ctx, `
 		INSERT INTO role_changes (user_id, old_role, new_role, changed_by, changed_at)
 		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
-	`, name, "unconfirmed", role, adminID)
+	`, userID, "unconfirmed", role, adminID)
 	if err != nil {
 		return err
 	}
@@ -218,14 +233,14 @@ func ConfirmUser(ctx context.Context, database *sql.DB, bot *tgbotapi.BotAPI, na
 	return nil
 }
 
-func RejectUser(ctx context.Context, database *sql.DB, bot *tgbotapi.BotAPI, name string) error {
+func RejectUser(ctx context.Context, database *sql.DB, bot *tgbotapi.BotAPI, userID int64) error {
 	var telegramID int64
-	err := database.QueryRowContext(ctx, `SELECT telegram_id FROM users WHERE id = $1`, name).Scan(&telegramID)
+	err := database.QueryRowContext(ctx, `SELECT telegram_id FROM users WHERE id = $1`, userID).Scan(&telegramID)
 	if err != nil {
 		return err
 	}
 
-	_, err = database.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, name)
+	_, err = database.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, userID)
 	if err != nil {
 		return err
 	}
@@ -281,8 +296,12 @@ func NotifyAdminsAboutNewUser(ctx context.Context, bot *tgbotapi.BotAPI, databas
 	}
 
 	// кнопки подтверждения/отклонения такие же, как в ShowPendingUsers
-	btnYes := tgbotapi.NewInlineKeyboardButtonData("✅ Подтвердить", fmt.Sprintf("confirm_%d", userID))
-	btnNo := tgbotapi.NewInlineKeyboardButtonData("❌ Отклонить", fmt.Sprintf("reject_%d", userID))
+	var bs callback.Buttons
+	btnYes := bs.Add(cbUserConfirm.Button("✅ Подтвердить", userID))
+	btnNo := bs.Add(cbUserReject.Button("❌ Отклонить", userID))
+	if buttonsFailed(&bs) {
+		return
+	}
 	markup := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(btnYes, btnNo))
 
 	// уведомляем всех админов
@@ -297,9 +316,7 @@ func NotifyAdminsAboutNewUser(ctx context.Context, bot *tgbotapi.BotAPI, databas
 		if err := rows.Scan(&adminTG); err != nil {
 			continue
 		}
-		m := tgbotapi.NewMessage(adminTG, msg)
-		m.ReplyMarkup = markup
-		if _, err := tg.Send(bot, m); err != nil {
+		if err := notify.SendMarkup(ctx, database, adminTG, notify.AuthRequests, msg, &markup); err != nil {
 			metrics.HandlerErrors.Inc()
 		}
 	}
@@ -329,8 +346,8 @@ func NotifyAdminsAboutScoreRequest(ctx context.Context, bot *tgbotapi.BotAPI, da
 		// Отправим уведомление только один раз
 		if !notifiedAdmins[tgID] {
 			notifiedAdmins[tgID] = true
-			msg := tgbotapi.NewMessage(tgID, fmt.Sprintf("📥 Появились новые заявки для подтверждения %s.", action))
-			if _, err := tg.Send(bot, msg); err != nil {
+			text := fmt.Sprintf("📥 Появились новые заявки для подтверждения %s.", action)
+			if err := notify.Send(ctx, database, tgID, notify.ScoreRequests, text); err != nil {
 				metrics.HandlerErrors.Inc()
 			}
 		}
@@ -367,12 +384,16 @@ func ShowPendingParentLinks(ctx context.Context, bot *tgbotapi.BotAPI, database
 		msg := fmt.Sprintf("Заявка на привязку:\n👤 Родитель: %s\n👦 Ребёнок: %s\n🏫 Класс: %s%s",
 			parentName, studentName, classNumber.String, classLetter,
 		)
+		var bs callback.Buttons
 		markup := tgbotapi.NewInlineKeyboardMarkup(
 			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("✅ Подтвердить", fmt.Sprintf("link_confirm_%d", id)),
-				tgbotapi.NewInlineKeyboardButtonData("❌ Отклонить", fmt.Sprintf("link_reject_%d", id)),
+				bs.Add(cbLinkConfirm.Button("✅ Подтвердить", int64(id))),
+				bs.Add(cbLinkReject.Button("❌ Отклонить", int64(id))),
 			),
 		)
+		if buttonsFailed(&bs) {
+			continue
+		}
 		m := tgbotapi.NewMessage(chatID, msg)
 		m.ReplyMarkup = markup
 		if _, err := tg.Send(bot, m); err != nil {
@@ -393,14 +414,17 @@ func HandleParentLinkApprovalCallback(ctx context.Context, cb *tgbotapi.Callback
 	msgID := cb.Message.MessageID
 	adminUsername := cb.From.UserName
 
-	getIDs := func(reqID string) (parentID, studentID int64, err error) {
+	getIDs := func(reqID int64) (parentID, studentID int64, err error) {
 		err = database.QueryRowContext(ctx, `SELECT parent_id, student_id FROM parent_link_requests WHERE id = $1`, reqID).
 			Scan(&parentID, &studentID)
 		return parentID, studentID, err
 	}
 
-	if strings.HasPrefix(data, "link_confirm_") {
-		reqID := strings.TrimPrefix(data, "link_confirm_")
+	if cbLinkConfirm.Match(data) {
+		reqID, err := cbLinkConfirm.Parse(data)
+		if err != nil {
+			return
+		}
 		parentID, studentID, err := getIDs(reqID)
 		if err != nil {
 			if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "❌ Заявка не найдена.")); err != nil {
@@ -455,7 +479,8 @@ func HandleParentLinkApprovalCallback(ctx context.Context, cb *tgbotapi.Callback
 				metrics.HandlerErrors.Inc()
 			}
 		}
-		if sTG != 0 {
+		// ученик из импорта списка ещё не зарегистрировался — писать некуда
+		if sTG != 0 && !db.IsPlaceholderTelegramID(sTG) {
 			if _, err := tg.Send(bot, tgbotapi.NewMessage(sTG, "ℹ️ Ваш родитель привязан в системе.")); err != nil {
 				metrics.HandlerErrors.Inc()
 			}
@@ -471,8 +496,11 @@ func HandleParentLinkApprovalCallback(ctx context.Context, cb *tgbotapi.Callback
 		return
 	}
 
-	if strings.HasPrefix(data, "link_reject_") {
-		reqID := strings.TrimPrefix(data, "link_reject_")
+	if cbLinkReject.Match(data) {
+		reqID, err := cbLinkReject.Parse(data)
+		if err != nil {
+			return
+		}
 		var parentID int64
 		_ = database.QueryRowContext(ctx, `SELECT parent_id FROM parent_link_requests WHERE id = $1`, reqID).Scan(&parentID)
 		_, _ = database.ExecContext(ctx, `DELETE FROM parent_link_requests WHERE id = $1`, reqID)
@@ -514,7 +542,7 @@ func NotifyAdminsAboutParentLink(ctx context.Context, bot *tgbotapi.BotAPI, data
 		}
 		text := "📥 Новая заявка на привязку ребёнка. Откройте «📥 Заявки на авторизацию», чтобы обработать."
 		// Можно отправлять сразу карточки (ShowPendingParentLinks), но обычно делаем по кнопке в меню
-		if _, err := tg.Send(bot, tgbotapi.NewMessage(tgID, text)); err != nil {
+		if err := notify.Send(ctx, database, tgID, notify.ParentLinks, text); err != nil {
 			metrics.HandlerErrors.Inc()
 		}
 	}
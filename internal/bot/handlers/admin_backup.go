@@ -40,5 +40,20 @@ func HandleAdminBackup(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.
 		return
 	}
 
+	// с ключами шифрования копия сразу шифруется: открытый дамп в каталоге не остаётся
+	if backupCatalog.Keys.Enabled() {
+		e, err := backupCatalog.GetByName(path)
+		if err == nil {
+			err = backupCatalog.Seal(e)
+		}
+		if err != nil {
+			metrics.HandlerErrors.Inc()
+			observability.CaptureErr(err)
+			_, _ = tg.Send(bot, tgbotapi.NewMessage(chatID, fmt.Sprintf("⚠️ Бэкап сохранён (%s), но не зашифрован: %v", path, err)))
+			return
+		}
+		path = e.Name + " 🔒"
+	}
+
 	_, _ = tg.Send(bot, tgbotapi.NewMessage(chatID, "✅ Готово. Сохранено: "+path))
 }
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/backup"
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmutil"
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/metrics"
+	"github.com/Spok95/telegram-school-bot/internal/tg"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Каталог бэкапов («♻️ Восстановить БД»): дампы sidecar и выгрузки из общего каталога,
+// выбор копии для восстановления и пробное восстановление во временную схему.
+
+const (
+	bkPick   = "bk_pick:"
+	bkDo     = "bk_do:"
+	bkCheck  = "bk_check:"
+	bkCancel = "bk_cancel"
+	// BackupLatestData — восстановление последнего дампа sidecar (latest.sql.gz)
+	BackupLatestData = "bk_latest"
+
+	// столько последних бэкапов показываем кнопками
+	bkListLimit = 10
+)
+
+// Кнопки бэкапа: аргумент — backup.Entry.ID (формат — см. пакет callback).
+var (
+	cbBackupPick  = callback.NewAction1(bkPick, callback.Word(12))
+	cbBackupDo    = callback.NewAction1(bkDo, callback.Word(12))
+	cbBackupCheck = callback.NewAction1(bkCheck, callback.Word(12))
+)
+
+var (
+	backupCatalog   = backup.NewCatalog("backups", nil)
+	backupRetention backup.Retention
+)
+
+// SetBackupCatalog задаёт каталог бэкапов (общий с sidecar) и политику хранения.
+func SetBackupCatalog(c *backup.Catalog, p backup.Retention) {
+	backupCatalog, backupRetention = c, p
+}
+
+// HandleBackupCatalog — список бэкапов с размером, временем, версией схемы и итогом проверки.
+func HandleBackupCatalog(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, chatID int64) {
+	if !isAdminChat(ctx, database, chatID) {
+		backupReply(bot, chatID, "🚫 Только для администратора")
+		return
+	}
+	list, err := backupCatalog.List()
+	if err != nil {
+		metrics.HandlerErrors.Inc()
+		backupReply(bot, chatID, fmt.Sprintf("❌ Не удалось прочитать каталог бэкапов: %v", err))
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "🗂 Бэкапы (%s)\nХранение: %s\n\n", backupCatalog.Dir, backupRetention)
+	var bs callback.Buttons
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if len(list) == 0 {
+		b.WriteString("В каталоге нет бэкапов. Сделайте «💾 Бэкап БД» или восстановите последний дамп sidecar.\n")
+	}
+	for i, e := range list {
+		if i == bkListLimit {
+			fmt.Fprintf(&b, "…и ещё %d (старые удаляются по политике хранения)\n", len(list)-bkListLimit)
+			break
+		}
+		fmt.Fprintf(&b, "%d) %s\n", i+1, backupLine(e))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			bs.Add(cbBackupPick.Button(
+				fmt.Sprintf("%d) %s", i+1, e.CreatedAt.In(time.Local).Format("02.01.2006 15:04")),
+				e.ID)),
+		))
+	}
+	b.WriteString("\nВыберите бэкап для восстановления.")
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("♻️ Последний дамп sidecar", BackupLatestData),
+		tgbotapi.NewInlineKeyboardButtonData("❌ Закрыть", bkCancel),
+	))
+	if buttonsFailed(&bs) {
+		return
+	}
+
+	m := tgbotapi.NewMessage(chatID, b.String())
+	m.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	if _, err := tg.Send(bot, m); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
+
+// HandleBackupCatalogCallback — выбор бэкапа, проверка и восстановление.
+func HandleBackupCatalogCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, cb *tgbotapi.CallbackQuery) {
+	chatID := cb.Message.Chat.ID
+	if _, err := tg.Request(bot, tgbotapi.NewCallback(cb.ID, "")); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+	fsmutil.DisableMarkup(bot, chatID, cb.Message.MessageID)
+	if cb.Data == bkCancel {
+		return
+	}
+	if !isAdminChat(ctx, database, chatID) {
+		backupReply(bot, chatID, "🚫 Только для администратора")
+		return
+	}
+
+	var act callback.Action1[string]
+	for _, a := range []callback.Action1[string]{cbBackupPick, cbBackupDo, cbBackupCheck} {
+		if a.Match(cb.Data) {
+			act = a
+		}
+	}
+	id, err := act.Parse(cb.Data)
+	if err != nil {
+		return
+	}
+	e, err := backupCatalog.Get(id)
+	if errors.Is(err, backup.ErrNotFound) {
+		backupReply(bot, chatID, "⚠️ Бэкап не найден — возможно, он удалён по политике хранения.")
+		return
+	}
+	if err != nil {
+		metrics.HandlerErrors.Inc()
+		backupReply(bot, chatID, fmt.Sprintf("❌ Не удалось прочитать каталог бэкапов: %v", err))
+		return
+	}
+
+	switch act.Prefix() {
+	case bkPick:
+		showRestorePlan(ctx, bot, database, chatID, e)
+	case bkCheck:
+		// повторная проверка — заново, даже если результат уже есть
+		e.Check = nil
+		showRestorePlan(ctx, bot, database, chatID, e)
+	case bkDo:
+		safeRestore(ctx, bot, database, chatID, e)
+	}
+}
+
+// RunBackupMaintenance — фоновая работа с каталогом: очистка по политике и проверка новых бэкапов.
+func RunBackupMaintenance(ctx context.Context, database *sql.DB) error {
+	return backupCatalog.Maintain(ctx, database, backupRetention, time.Local)
+}
+
+func backupLine(e backup.Entry) string {
+	parts := []string{
+		e.CreatedAt.In(time.Local).Format("02.01.2006 15:04"),
+		formatBackupSize(e.Size),
+	}
+	if e.Encrypted {
+		parts = append(parts, "🔒")
+	}
+	if e.SchemaVersion > 0 {
+		parts = append(parts, fmt.Sprintf("схема %d", e.SchemaVersion))
+	} else {
+		parts = append(parts, "схема ?")
+	}
+	switch {
+	case e.Check == nil:
+		parts = append(parts, "⏳ не проверен")
+	case e.Check.OK:
+		parts = append(parts, fmt.Sprintf("✅ проверен %s (%d строк)",
+			e.Check.CheckedAt.In(time.Local).Format("02.01 15:04"), e.Check.Rows))
+	default:
+		parts = append(parts, "❌ не прошёл проверку")
+	}
+	return strings.Join(parts, " · ")
+}
+
+func formatBackupSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f МБ", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%d КБ", n>>10)
+	default:
+		return fmt.Sprintf("%d Б", n)
+	}
+}
+
+func isAdminChat(ctx context.Context, database *sql.DB, chatID int64) bool {
+	user, err := db.GetUserByTelegramID(ctx, database, chatID)
+	return err == nil && user != nil && user.Role != nil && *user.Role == "admin"
+}
+
+func backupReply(bot *tgbotapi.BotAPI, chatID int64, text string) {
+	if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, text)); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
@@ -7,9 +7,13 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmstore"
 	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmutil"
 	"github.com/Spok95/telegram-school-bot/internal/db"
 	"github.com/Spok95/telegram-school-bot/internal/metrics"
+	"github.com/Spok95/telegram-school-bot/internal/models"
+	"github.com/Spok95/telegram-school-bot/internal/rating"
 	"github.com/Spok95/telegram-school-bot/internal/tg"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -22,7 +26,23 @@ type CatalogFSMState struct {
 	TempLevelValue *int
 }
 
-var catalogStates = map[int64]*CatalogFSMState{}
+var catalogStates = fsmstore.NewMap[*CatalogFSMState]("catalog", 1, fsmstore.DefaultTTL)
+
+// Кнопки справочников (формат — см. пакет callback); аргумент — id категории, уровня или класса.
+var (
+	cbCatOpen       = callback.NewAction1("catalog_cat_open_", callback.ID)
+	cbCatRename     = callback.NewAction1("catalog_cat_rename_", callback.ID)
+	cbCatToggle     = callback.NewAction1("catalog_cat_toggle_", callback.ID)
+	cbCatCollective = callback.NewAction1("catalog_cat_coll_", callback.ID)
+	cbCatPercent    = callback.NewAction1("catalog_cat_pct_", callback.ID)
+	cbCatLevels     = callback.NewAction1("catalog_levels_", callback.ID)
+	cbLvlOpen       = callback.NewAction1("catalog_lvl_open_", callback.ID)
+	cbLvlAdd        = callback.NewAction1("catalog_lvl_add_", callback.ID)
+	cbLvlRename     = callback.NewAction1("catalog_lvl_rename_", callback.ID)
+	cbLvlToggle     = callback.NewAction1("catalog_lvl_toggle_", callback.ID)
+	cbLvlPercent    = callback.NewAction1("catalog_lvl_pct_", callback.ID)
+	cbClsToggle     = callback.NewAction1("catalog_cls_toggle_", callback.ID)
+)
 
 // ====== helpers
 
@@ -46,16 +66,24 @@ func mark(b bool) string {
 	return "🚫"
 }
 
+// collectiveRuleText — как категория влияет на коллективный рейтинг класса.
+func collectiveRuleText(c *models.Category) string {
+	if !c.AffectsCollective {
+		return "🏆 Не влияет на коллективный рейтинг класса."
+	}
+	return fmt.Sprintf("🏆 В коллективный рейтинг класса идёт %d%% баллов.", c.CollectivePercent)
+}
+
 // ====== start
 
 func StartCatalogFSM(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, msg *tgbotapi.Message) {
 	chatID := msg.Chat.ID
-	catalogStates[chatID] = &CatalogFSMState{Step: 1}
+	catalogStates.Set(ctx, chatID, &CatalogFSMState{Step: 1})
 	showCategoriesList(ctx, bot, chatID, 0, false, database)
 }
 
 func GetCatalogState(userID int64) *CatalogFSMState {
-	return catalogStates[userID]
+	return catalogStates.Value(userID)
 }
 
 // ====== UI builders
@@ -64,10 +92,11 @@ func showCategoriesList(ctx context.Context, bot *tgbotapi.BotAPI, chatID int64,
 	cats, _ := db.GetCategories(ctx, database, true)
 
 	text := "🗂 Справочники → Категории"
+	var bs callback.Buttons
 	var rows [][]tgbotapi.InlineKeyboardButton
 	for _, c := range cats {
 		row := tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%s %s", c.Name, mark(c.IsActive)), fmt.Sprintf("catalog_cat_open_%d", c.ID)),
+			bs.Add(cbCatOpen.Button(fmt.Sprintf("%s %s", c.Name, mark(c.IsActive)), int64(c.ID))),
 		)
 		rows = append(rows, row)
 	}
@@ -75,6 +104,9 @@ func showCategoriesList(ctx context.Context, bot *tgbotapi.BotAPI, chatID int64,
 	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("🏫 Классы", "catalog_classes")))
 	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", "catalog_cancel")))
 
+	if buttonsFailed(&bs) {
+		return
+	}
 	if edit && messageID != 0 {
 		editTextAndMarkup(bot, chatID, messageID, text, rows)
 		return
@@ -88,20 +120,31 @@ func showCategoriesList(ctx context.Context, bot *tgbotapi.BotAPI, chatID int64,
 
 func showCategoryCard(ctx context.Context, bot *tgbotapi.BotAPI, chatID int64, messageID int, catID int64, database *sql.DB) {
 	c, _ := db.GetCategoryByID(ctx, database, catID)
-	text := fmt.Sprintf("📁 Категория: %s %s", c.Name, mark(c.IsActive))
+	text := fmt.Sprintf("📁 Категория: %s %s\n%s", c.Name, mark(c.IsActive), collectiveRuleText(c))
+	var bs callback.Buttons
 	rows := [][]tgbotapi.InlineKeyboardButton{
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("✏️ Переименовать", fmt.Sprintf("catalog_cat_rename_%d", c.ID)),
-			tgbotapi.NewInlineKeyboardButtonData(
+			bs.Add(cbCatRename.Button("✏️ Переименовать", int64(c.ID))),
+			bs.Add(cbCatToggle.Button(
 				map[bool]string{true: "👁️ Скрыть", false: "👁️ Показать"}[c.IsActive],
-				fmt.Sprintf("catalog_cat_toggle_%d", c.ID),
-			),
+				int64(c.ID),
+			)),
 		),
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("📶 Уровни", fmt.Sprintf("catalog_levels_%d", c.ID)),
+			bs.Add(cbCatCollective.Button(
+				"🏆 В рейтинг класса "+mark(c.AffectsCollective),
+				int64(c.ID),
+			)),
+			bs.Add(cbCatPercent.Button("📊 Процент классу", int64(c.ID))),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			bs.Add(cbCatLevels.Button("📶 Уровни", int64(c.ID))),
 		),
 		catBackCancel(),
 	}
+	if buttonsFailed(&bs) {
+		return
+	}
 	editTextAndMarkup(bot, chatID, messageID, text, rows)
 }
 
@@ -111,34 +154,55 @@ func showLevels(ctx context.Context, bot *tgbotapi.BotAPI, chatID int64, message
 
 	text := fmt.Sprintf("📶 Уровни категории «%s»", c.Name)
 
+	var bs callback.Buttons
 	var rows [][]tgbotapi.InlineKeyboardButton
 	for _, l := range levels {
 		label := fmt.Sprintf("%s (%d) %s", l.Label, l.Value, mark(l.IsActive))
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("catalog_lvl_open_%d", l.ID)),
+			bs.Add(cbLvlOpen.Button(label, int64(l.ID))),
 		))
 	}
 	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-		tgbotapi.NewInlineKeyboardButtonData("➕ Добавить уровень", fmt.Sprintf("catalog_lvl_add_%d", catID)),
+		bs.Add(cbLvlAdd.Button("➕ Добавить уровень", catID)),
 	))
 	rows = append(rows, catBackCancel())
 
+	if buttonsFailed(&bs) {
+		return
+	}
 	editTextAndMarkup(bot, chatID, messageID, text, rows)
 }
 
 func showLevelCard(ctx context.Context, bot *tgbotapi.BotAPI, chatID int64, messageID int, levelID int64, database *sql.DB) {
 	l, _ := db.GetLevelByID(ctx, database, int(levelID))
 	text := fmt.Sprintf("🔢 Уровень: %s (%d) %s", l.Label, l.Value, mark(l.IsActive))
+	if c, err := db.GetCategoryByID(ctx, database, int64(l.CategoryID)); err == nil {
+		switch {
+		case !c.AffectsCollective:
+			text += "\n🏆 Категория не влияет на рейтинг класса."
+		case l.CollectivePercent != nil:
+			text += fmt.Sprintf("\n📊 В рейтинг класса: %d%% (задано для уровня)", *l.CollectivePercent)
+		default:
+			text += fmt.Sprintf("\n📊 В рейтинг класса: %d%% (как у категории)", c.CollectivePercent)
+		}
+	}
+	var bs callback.Buttons
 	rows := [][]tgbotapi.InlineKeyboardButton{
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("✏️ Переименовать", fmt.Sprintf("catalog_lvl_rename_%d", l.ID)),
-			tgbotapi.NewInlineKeyboardButtonData(
+			bs.Add(cbLvlRename.Button("✏️ Переименовать", int64(l.ID))),
+			bs.Add(cbLvlToggle.Button(
 				map[bool]string{true: "👁️ Скрыть", false: "👁️ Показать"}[l.IsActive],
-				fmt.Sprintf("catalog_lvl_toggle_%d", l.ID),
-			),
+				int64(l.ID),
+			)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			bs.Add(cbLvlPercent.Button("📊 Процент классу", int64(l.ID))),
 		),
 		catBackCancel(),
 	}
+	if buttonsFailed(&bs) {
+		return
+	}
 	editTextAndMarkup(bot, chatID, messageID, text, rows)
 }
 
@@ -159,6 +223,7 @@ func showClassesList(
 	}
 
 	text := "🏫 Справочники → Классы\n\nНажмите на класс, чтобы скрыть/показать его в списках."
+	var bs callback.Buttons
 	var rows [][]tgbotapi.InlineKeyboardButton
 	for _, c := range classes {
 		label := fmt.Sprintf("%d%s", c.Number, strings.ToUpper(c.Letter))
@@ -166,7 +231,7 @@ func showClassesList(
 			label += " (скрыт)"
 		}
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("catalog_cls_toggle_%d", c.ID)),
+			bs.Add(cbClsToggle.Button(label, c.ID)),
 		))
 	}
 	// назад в справочники
@@ -174,6 +239,9 @@ func showClassesList(
 		tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", "catalog_backroot"),
 	))
 
+	if buttonsFailed(&bs) {
+		return
+	}
 	if edit {
 		editTextAndMarkup(bot, chatID, messageID, text, rows)
 		return
@@ -189,15 +257,16 @@ func showClassesList(
 
 func HandleCatalogCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, cq *tgbotapi.CallbackQuery) {
 	chatID := cq.Message.Chat.ID
-	st := catalogStates[chatID]
+	st := catalogStates.Value(chatID)
 	if st == nil {
 		return
 	}
+	defer catalogStates.Save(ctx, chatID)
 	data := cq.Data
 
 	// Отмена
 	if data == "catalog_cancel" {
-		delete(catalogStates, chatID)
+		catalogStates.Delete(ctx, chatID)
 		fsmutil.DisableMarkup(bot, chatID, cq.Message.MessageID)
 		edit := tgbotapi.NewEditMessageText(chatID, cq.Message.MessageID, "🚫 Справочники: отменено.")
 		if _, err := tg.Send(bot, edit); err != nil {
@@ -233,58 +302,123 @@ func HandleCatalogCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *
 		rows := [][]tgbotapi.InlineKeyboardButton{catBackCancel()}
 		editTextAndMarkup(bot, chatID, cq.Message.MessageID, "✏️ Введите название новой категории:", rows)
 
-	case strings.HasPrefix(data, "catalog_cat_open_"):
-		id, _ := strconv.ParseInt(strings.TrimPrefix(data, "catalog_cat_open_"), 10, 64)
+	case cbCatOpen.Match(data):
+		id, err := cbCatOpen.Parse(data)
+		if err != nil {
+			return
+		}
 		st.CategoryID = &id
 		showCategoryCard(ctx, bot, chatID, cq.Message.MessageID, id, database)
 
-	case strings.HasPrefix(data, "catalog_cat_toggle_"):
-		id, _ := strconv.ParseInt(strings.TrimPrefix(data, "catalog_cat_toggle_"), 10, 64)
+	case cbCatToggle.Match(data):
+		id, err := cbCatToggle.Parse(data)
+		if err != nil {
+			return
+		}
 		c, _ := db.GetCategoryByID(ctx, database, id)
 		_ = db.SetCategoryActive(ctx, database, id, !c.IsActive)
 		showCategoryCard(ctx, bot, chatID, cq.Message.MessageID, id, database)
 
-	case strings.HasPrefix(data, "catalog_cat_rename_"):
-		id, _ := strconv.ParseInt(strings.TrimPrefix(data, "catalog_cat_rename_"), 10, 64)
+	case cbCatRename.Match(data):
+		id, err := cbCatRename.Parse(data)
+		if err != nil {
+			return
+		}
 		st.CategoryID = &id
 		st.Awaiting = "cat_rename"
 		rows := [][]tgbotapi.InlineKeyboardButton{catBackCancel()}
 		editTextAndMarkup(bot, chatID, cq.Message.MessageID, "✏️ Введите новое имя категории:", rows)
 
-	case strings.HasPrefix(data, "catalog_levels_"):
-		id, _ := strconv.ParseInt(strings.TrimPrefix(data, "catalog_levels_"), 10, 64)
+	case cbCatCollective.Match(data):
+		id, err := cbCatCollective.Parse(data)
+		if err != nil {
+			return
+		}
+		c, err := db.GetCategoryByID(ctx, database, id)
+		if err != nil {
+			showCategoriesList(ctx, bot, chatID, cq.Message.MessageID, true, database)
+			return
+		}
+		if err := db.SetCategoryCollective(ctx, database, id, !c.AffectsCollective, c.CollectivePercent); err != nil {
+			metrics.HandlerErrors.Inc()
+		}
+		showCategoryCard(ctx, bot, chatID, cq.Message.MessageID, id, database)
+
+	case cbCatPercent.Match(data):
+		id, err := cbCatPercent.Parse(data)
+		if err != nil {
+			return
+		}
+		st.CategoryID = &id
+		st.Awaiting = "cat_percent"
+		rows := [][]tgbotapi.InlineKeyboardButton{catBackCancel()}
+		editTextAndMarkup(bot, chatID, cq.Message.MessageID,
+			"📊 Какой процент баллов ученика идёт в коллективный рейтинг класса? Введите число от 0 до 100.\n\n"+
+				"Уже подтверждённые начисления не пересчитываются — новое правило действует для новых.", rows)
+
+	case cbCatLevels.Match(data):
+		id, err := cbCatLevels.Parse(data)
+		if err != nil {
+			return
+		}
 		st.CategoryID = &id
 		showLevels(ctx, bot, chatID, cq.Message.MessageID, id, database)
 
 	// уровни
-	case strings.HasPrefix(data, "catalog_lvl_add_"):
-		catID, _ := strconv.ParseInt(strings.TrimPrefix(data, "catalog_lvl_add_"), 10, 64)
+	case cbLvlAdd.Match(data):
+		catID, err := cbLvlAdd.Parse(data)
+		if err != nil {
+			return
+		}
 		st.CategoryID = &catID
 		st.Awaiting = "level_value"
 		st.TempLevelValue = nil
 		rows := [][]tgbotapi.InlineKeyboardButton{catBackCancel()}
 		editTextAndMarkup(bot, chatID, cq.Message.MessageID, "✏️ Введите числовое значение уровня (например, 100/200/300):", rows)
 
-	case strings.HasPrefix(data, "catalog_lvl_open_"):
-		lvlID, _ := strconv.ParseInt(strings.TrimPrefix(data, "catalog_lvl_open_"), 10, 64)
+	case cbLvlOpen.Match(data):
+		lvlID, err := cbLvlOpen.Parse(data)
+		if err != nil {
+			return
+		}
 		st.LevelID = &lvlID
 		showLevelCard(ctx, bot, chatID, cq.Message.MessageID, lvlID, database)
 
-	case strings.HasPrefix(data, "catalog_lvl_toggle_"):
-		lvlID, _ := strconv.ParseInt(strings.TrimPrefix(data, "catalog_lvl_toggle_"), 10, 64)
+	case cbLvlToggle.Match(data):
+		lvlID, err := cbLvlToggle.Parse(data)
+		if err != nil {
+			return
+		}
 		l, _ := db.GetLevelByID(ctx, database, int(lvlID))
 		_ = db.SetLevelActive(ctx, database, lvlID, !l.IsActive)
 		showLevelCard(ctx, bot, chatID, cq.Message.MessageID, lvlID, database)
 
-	case strings.HasPrefix(data, "catalog_lvl_rename_"):
-		lvlID, _ := strconv.ParseInt(strings.TrimPrefix(data, "catalog_lvl_rename_"), 10, 64)
+	case cbLvlPercent.Match(data):
+		lvlID, err := cbLvlPercent.Parse(data)
+		if err != nil {
+			return
+		}
+		st.LevelID = &lvlID
+		st.Awaiting = "level_percent"
+		rows := [][]tgbotapi.InlineKeyboardButton{catBackCancel()}
+		editTextAndMarkup(bot, chatID, cq.Message.MessageID,
+			"📊 Процент для этого уровня: число от 0 до 100 или «-», чтобы брать процент категории.\n\n"+
+				"Уже подтверждённые начисления не пересчитываются — новое правило действует для новых.", rows)
+
+	case cbLvlRename.Match(data):
+		lvlID, err := cbLvlRename.Parse(data)
+		if err != nil {
+			return
+		}
 		st.LevelID = &lvlID
 		st.Awaiting = "level_label_edit"
 		rows := [][]tgbotapi.InlineKeyboardButton{catBackCancel()}
 		editTextAndMarkup(bot, chatID, cq.Message.MessageID, "✏️ Введите новое имя (label) для уровня:", rows)
-	case strings.HasPrefix(data, "catalog_cls_toggle_"):
-		idStr := strings.TrimPrefix(data, "catalog_cls_toggle_")
-		clsID, _ := strconv.ParseInt(idStr, 10, 64)
+	case cbClsToggle.Match(data):
+		clsID, err := cbClsToggle.Parse(data)
+		if err != nil {
+			return
+		}
 
 		cls, err := db.GetClassByID(ctx, database, clsID)
 		if err != nil || cls == nil {
@@ -310,14 +444,15 @@ func HandleCatalogCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *
 
 func HandleCatalogText(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, msg *tgbotapi.Message) {
 	chatID := msg.Chat.ID
-	st := catalogStates[chatID]
+	st := catalogStates.Value(chatID)
 	if st == nil {
 		return
 	}
+	defer catalogStates.Save(ctx, chatID)
 
 	// текстовая отмена
 	if fsmutil.IsCancelText(msg.Text) {
-		delete(catalogStates, chatID)
+		catalogStates.Delete(ctx, chatID)
 		if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "🚫 Справочники: отменено.")); err != nil {
 			metrics.HandlerErrors.Inc()
 		}
@@ -375,6 +510,54 @@ func HandleCatalogText(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.
 		// вернём карточку
 		showCategoryCard(ctx, bot, chatID, msg.MessageID-1, *st.CategoryID, database) // -1: текст пришёл отдельным msg
 
+	case "cat_percent":
+		if st.CategoryID == nil {
+			return
+		}
+		pct, err := strconv.Atoi(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(msg.Text), "%")))
+		if err != nil || !rating.ValidPercent(pct) {
+			if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "⚠️ Введите число от 0 до 100 или «отмена».")); err != nil {
+				metrics.HandlerErrors.Inc()
+			}
+			return
+		}
+		c, err := db.GetCategoryByID(ctx, database, *st.CategoryID)
+		if err != nil {
+			return
+		}
+		if err := db.SetCategoryCollective(ctx, database, *st.CategoryID, c.AffectsCollective, pct); err != nil {
+			if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "❌ Не удалось сохранить процент.")); err != nil {
+				metrics.HandlerErrors.Inc()
+			}
+			return
+		}
+		st.Awaiting = ""
+		showCategoryCard(ctx, bot, chatID, msg.MessageID-1, *st.CategoryID, database)
+
+	case "level_percent":
+		if st.LevelID == nil {
+			return
+		}
+		var pct *int
+		if txt := strings.TrimSpace(msg.Text); txt != "-" {
+			v, err := strconv.Atoi(strings.TrimSpace(strings.TrimSuffix(txt, "%")))
+			if err != nil || !rating.ValidPercent(v) {
+				if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "⚠️ Введите число от 0 до 100, «-» или «отмена».")); err != nil {
+					metrics.HandlerErrors.Inc()
+				}
+				return
+			}
+			pct = &v
+		}
+		if err := db.SetLevelCollectivePercent(ctx, database, *st.LevelID, pct); err != nil {
+			if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "❌ Не удалось сохранить процент.")); err != nil {
+				metrics.HandlerErrors.Inc()
+			}
+			return
+		}
+		st.Awaiting = ""
+		showLevelCard(ctx, bot, chatID, msg.MessageID-1, *st.LevelID, database)
+
 	case "level_value":
 		val, err := strconv.Atoi(strings.TrimSpace(msg.Text))
 		if err != nil || val <= 0 {
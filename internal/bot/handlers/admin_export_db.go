@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/backup"
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/metrics"
+	"github.com/Spok95/telegram-school-bot/internal/observability"
+	"github.com/Spok95/telegram-school-bot/internal/tg"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// HandleAdminExportDB — выгружает БД в zip с CSV силами самого бота и присылает файл.
+// Архив принимает «📥 Восстановить из файла».
+func HandleAdminExportDB(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, chatID int64) {
+	user, err := db.GetUserByTelegramID(ctx, database, chatID)
+	if err != nil || user == nil || user.Role == nil || *user.Role != "admin" {
+		if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "🚫 Только для администратора")); err != nil {
+			metrics.HandlerErrors.Inc()
+			observability.CaptureErr(err)
+		}
+		return
+	}
+	if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "⌛ Выгружаю базу…")); err != nil {
+		metrics.HandlerErrors.Inc()
+		observability.CaptureErr(err)
+	}
+
+	f, err := os.CreateTemp("", "export_db_*.zip")
+	if err != nil {
+		_, _ = tg.Send(bot, tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ Не удалось выгрузить базу: %v", err)))
+		return
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	defer func() { _ = f.Close() }()
+
+	name := fmt.Sprintf("school_db_%s.zip", time.Now().Format("2006-01-02_1504"))
+	m, err := writeExportZip(ctx, database, f)
+	if err == nil {
+		_, err = f.Seek(0, 0)
+	}
+	if err != nil {
+		metrics.HandlerErrors.Inc()
+		observability.CaptureErr(err)
+		_, _ = tg.Send(bot, tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ Не удалось выгрузить базу: %v", err)))
+		return
+	}
+	if backupCatalog.Keys.Enabled() {
+		name += backup.EncryptedExt
+	}
+
+	caption := fmt.Sprintf("📦 Выгрузка БД: таблиц %d, строк %d, версия схемы %d.\n"+
+		"Файл подходит для «📥 Восстановить из файла».", len(m.Tables), m.TotalRows(), m.SchemaVersion)
+	if backupCatalog.Keys.Enabled() {
+		caption += fmt.Sprintf("\n🔒 Зашифрован ключом %q.", backupCatalog.Keys.CurrentID())
+	}
+	if err := sendBackupDocument(bot, chatID, name, f, caption); err != nil {
+		metrics.HandlerErrors.Inc()
+		observability.CaptureErr(err)
+		_, _ = tg.Send(bot, tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ Не удалось отправить файл: %v", err)))
+	}
+}
+
+// writeExportZip пишет выгрузку в w, при включённом шифровании — зашифрованной.
+func writeExportZip(ctx context.Context, database *sql.DB, w io.Writer) (*backup.Manifest, error) {
+	if !backupCatalog.Keys.Enabled() {
+		return backup.WriteZip(ctx, database, w)
+	}
+	enc, err := backupCatalog.Keys.Encrypt(w)
+	if err != nil {
+		return nil, err
+	}
+	m, err := backup.WriteZip(ctx, database, enc)
+	if err != nil {
+		return nil, err
+	}
+	return m, enc.Close()
+}
+
+// sendBackupDocument отправляет бэкап в чат. При включённом шифровании незашифрованный
+// файл в Telegram не уходит: данные детей не должны оседать на серверах мессенджера.
+// Проверяется содержимое, а не имя: .enc к имени дописывает сам вызывающий.
+func sendBackupDocument(bot *tgbotapi.BotAPI, chatID int64, name string, r io.Reader, caption string) error {
+	if backupCatalog.Keys.Enabled() {
+		var encrypted bool
+		var err error
+		if r, encrypted, err = backup.SniffEncrypted(r); err != nil {
+			return err
+		}
+		if !encrypted {
+			return errors.New("включено шифрование бэкапов: незашифрованный файл в Telegram не отправляется")
+		}
+	}
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileReader{Name: name, Reader: r})
+	doc.Caption = caption
+	_, err := tg.Send(bot, doc)
+	return err
+}
@@ -0,0 +1,118 @@
+//go:build testutil
+// +build testutil
+
+package handlers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/backup"
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/models"
+	"github.com/Spok95/telegram-school-bot/internal/testutil/testdb"
+)
+
+func TestExportDB_RoundTrip(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+	h, err := testdb.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	adminID := mustSeedUser(ctx, t, h.DB, "Админ", models.Admin, nil, nil)
+	stID := mustSeedUser(ctx, t, h.DB, "Иванов, Иван \"младший\"", models.Student, ptrInt64(7), ptrString("А"))
+	if err := db.AddScore(ctx, h.DB, models.Score{
+		StudentID: stID, CategoryID: int64(db.GetCategoryIDByName(ctx, h.DB, "Внеурочная активность")),
+		Points: 50, Type: "add", Status: "approved", CreatedBy: adminID, CreatedAt: time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// комментарии: NULL, пустой, с пробелами по краям и текст «null» должны вернуться как были
+	comments := []*string{nil, ptrString(""), ptrString(" x "), ptrString("null")}
+	for _, c := range comments {
+		if err := db.AddScore(ctx, h.DB, models.Score{
+			StudentID: stID, CategoryID: int64(db.GetCategoryIDByName(ctx, h.DB, "Внеурочная активность")),
+			Points: 1, Type: "add", Status: "pending", Comment: c, CreatedBy: adminID, CreatedAt: time.Now(),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// пустой title в NOT NULL-колонке должен пережить выгрузку как '', а не NULL
+	if _, err := db.AddHolidays(ctx, h.DB, []db.Holiday{{Day: time.Date(2026, 1, 7, 0, 0, 0, 0, time.UTC)}}, adminID); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "db.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := backup.WriteZip(ctx, h.DB, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	if m.SchemaVersion == 0 {
+		t.Fatal("в манифесте нет версии схемы")
+	}
+	want := map[string]int64{}
+	for _, tb := range m.Tables {
+		want[tb.Name] = tb.Rows
+	}
+	if want["users"] != 2 || want["scores"] != 5 || want["school_holidays"] != 1 {
+		t.Fatalf("неожиданное число строк: %v", want)
+	}
+
+	// портим данные и восстанавливаем из архива
+	if _, err := h.DB.ExecContext(ctx, `TRUNCATE users CASCADE`); err != nil {
+		t.Fatal(err)
+	}
+	if err := backup.RestoreZip(ctx, h.DB, path); err != nil {
+		t.Fatalf("восстановление: %v", err)
+	}
+	got, err := backup.TableCounts(ctx, h.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := backup.CompareCounts(want, got); err != nil {
+		t.Error(err)
+	}
+	var name string
+	if err := h.DB.QueryRowContext(ctx, `SELECT name FROM users WHERE id = $1`, stID).Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+	if name != "Иванов, Иван \"младший\"" {
+		t.Fatalf("имя после восстановления: %q", name)
+	}
+
+	rows, err := h.DB.QueryContext(ctx, `SELECT comment FROM scores WHERE points = 1 ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restored []*string
+	for rows.Next() {
+		var c *string
+		if err := rows.Scan(&c); err != nil {
+			t.Fatal(err)
+		}
+		restored = append(restored, c)
+	}
+	_ = rows.Close()
+	if len(restored) != len(comments) {
+		t.Fatalf("комментариев после восстановления: %d", len(restored))
+	}
+	for i, c := range comments {
+		if (c == nil) != (restored[i] == nil) || (c != nil && *c != *restored[i]) {
+			t.Errorf("комментарий %d: было %v, стало %v", i, c, restored[i])
+		}
+	}
+
+	// новые записи после восстановления не конфликтуют по id
+	mustSeedUser(ctx, t, h.DB, "Новый", models.Teacher, nil, nil)
+}
@@ -5,10 +5,11 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmstore"
 	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmutil"
 	"github.com/Spok95/telegram-school-bot/internal/db"
 	"github.com/Spok95/telegram-school-bot/internal/metrics"
@@ -33,7 +34,7 @@ type EditPeriodState struct {
 	Step      int
 }
 
-var periodsStates = map[int64]*PeriodsFSMState{}
+var periodsStates = fsmstore.NewMap[*PeriodsFSMState]("admin_periods", 1, fsmstore.DefaultTTL)
 
 const (
 	perAdmCancel   = "peradm_cancel"
@@ -46,11 +47,15 @@ const (
 	editStepConfirm  = 3
 )
 
+// cbPeriodEdit — «✏️ Изменить» период (формат — см. пакет callback).
+var cbPeriodEdit = callback.NewAction1(perAdmEditPref, callback.ID)
+
 // StartAdminPeriods Старт: список периодов + «Создать / Изменить»
 func StartAdminPeriods(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, msg *tgbotapi.Message) {
 	chatID := msg.Chat.ID
 	state := &PeriodsFSMState{}
-	periodsStates[chatID] = state
+	periodsStates.Set(ctx, chatID, state)
+	defer periodsStates.Save(ctx, chatID)
 	showPeriodsList(ctx, bot, database, chatID, state)
 }
 
@@ -71,16 +76,19 @@ func showPeriodsList(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB
 
 		text += fmt.Sprintf("• %s (%s–%s)%s\n", p.Name, p.StartDate.Format("02.01.2006"), p.EndDate.Format("02.01.2006"), tag)
 	}
+	var bs callback.Buttons
 	var rows [][]tgbotapi.InlineKeyboardButton
 	for _, p := range per {
-		cb := fmt.Sprintf("%s%d", perAdmEditPref, p.ID)
 		label := fmt.Sprintf("✏️ Изменить: %s", p.Name)
-		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(label, cb)))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(bs.Add(cbPeriodEdit.Button(label, p.ID))))
 	}
 	rows = append(rows,
 		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("➕ Создать период", perAdmCreate)),
 		tgbotapi.NewInlineKeyboardRow(fsmutil.BackCancelRow(perAdmBack, perAdmCancel)...),
 	)
+	if buttonsFailed(&bs) {
+		return
+	}
 	mk := tgbotapi.NewInlineKeyboardMarkup(rows...)
 	msgOut := tgbotapi.NewMessage(chatID, text)
 	msgOut.ReplyMarkup = mk
@@ -91,10 +99,11 @@ func showPeriodsList(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB
 // HandleAdminPeriodsCallback коллбэки списка
 func HandleAdminPeriodsCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, cb *tgbotapi.CallbackQuery) {
 	chatID := cb.Message.Chat.ID
-	st := periodsStates[chatID]
+	st := periodsStates.Value(chatID)
 	if st == nil {
 		return
 	}
+	defer periodsStates.Save(ctx, chatID)
 	if _, err := tg.Request(bot, tgbotapi.NewCallback(cb.ID, "")); err != nil {
 		metrics.HandlerErrors.Inc()
 	}
@@ -109,7 +118,7 @@ func HandleAdminPeriodsCallback(ctx context.Context, bot *tgbotapi.BotAPI, datab
 		if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "🚫 Отменено.")); err != nil {
 			metrics.HandlerErrors.Inc()
 		}
-		delete(periodsStates, chatID)
+		periodsStates.Delete(ctx, chatID)
 		return
 	case perAdmBack:
 		if st.Editing != nil {
@@ -123,16 +132,17 @@ func HandleAdminPeriodsCallback(ctx context.Context, bot *tgbotapi.BotAPI, datab
 		if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "↩️ Возврат в меню.")); err != nil {
 			metrics.HandlerErrors.Inc()
 		}
-		delete(periodsStates, chatID)
+		periodsStates.Delete(ctx, chatID)
 		return
 	case perAdmCreate:
-		delete(periodsStates, chatID)
+		periodsStates.Delete(ctx, chatID)
 		StartSetPeriodFSM(ctx, bot, cb.Message) // переиспользуем создание
 		return
-	case perAdmEditPref:
-		idStr := strings.TrimPrefix(data, perAdmEditPref)
-		pid64, err := strconv.ParseInt(strings.TrimSpace(idStr), 10, 64)
-
+	default:
+		if !cbPeriodEdit.Match(data) {
+			return
+		}
+		pid64, err := cbPeriodEdit.Parse(data)
 		if err != nil || pid64 <= 0 {
 			if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "❌ Некорректный идентификатор периода. Попробуйте обновить список.")); err != nil {
 				metrics.HandlerErrors.Inc()
@@ -179,7 +189,7 @@ func showEditCard(bot *tgbotapi.BotAPI, chatID int64, ep *EditPeriodState) {
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("Изменить даты", "peradm_edit_both")))
 	}
 	rows = append(rows, tgbotapi.NewInlineKeyboardRow(fsmutil.BackCancelRow(perAdmBack, perAdmCancel)...))
-	edit := tgbotapi.NewEditMessageText(chatID, periodsStates[chatID].MessageID, txt)
+	edit := tgbotapi.NewEditMessageText(chatID, periodsStates.Value(chatID).MessageID, txt)
 	edit.ReplyMarkup = &tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
 	if _, err := tg.Send(bot, edit); err != nil {
 		metrics.HandlerErrors.Inc()
@@ -187,17 +197,18 @@ func showEditCard(bot *tgbotapi.BotAPI, chatID int64, ep *EditPeriodState) {
 }
 
 // HandleAdminPeriodsText Текстовые шаги редактирования
-func HandleAdminPeriodsText(ctx context.Context, bot *tgbotapi.BotAPI, msg *tgbotapi.Message) {
+func HandleAdminPeriodsText(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, msg *tgbotapi.Message) {
 	select {
 	case <-ctx.Done():
 		return
 	default:
 	}
 	chatID := msg.Chat.ID
-	st := periodsStates[chatID]
+	st := periodsStates.Value(chatID)
 	if st == nil || st.Editing == nil {
 		return
 	}
+	defer periodsStates.Save(ctx, chatID)
 	ep := st.Editing
 	switch ep.Step {
 	case editStepAskStart:
@@ -242,6 +253,7 @@ func HandleAdminPeriodsText(ctx context.Context, bot *tgbotapi.BotAPI, msg *tgbo
 		}
 		ep.Step = editStepConfirm
 		txt := fmt.Sprintf("Подтвердите изменение дат:\n%s — %s", ep.StartDate.Format("02.01.2006"), ep.EndDate.Format("02.01.2006"))
+		txt += periodHolidayWarning(ctx, database, ep.StartDate, ep.EndDate)
 		rows := [][]tgbotapi.InlineKeyboardButton{
 			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("✅ Сохранить", "peradm_save")),
 			fsmutil.BackCancelRow(perAdmBack, perAdmCancel),
@@ -258,10 +270,11 @@ func HandleAdminPeriodsText(ctx context.Context, bot *tgbotapi.BotAPI, msg *tgbo
 // HandleAdminPeriodsEditCallback Колбэки редактора
 func HandleAdminPeriodsEditCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, cb *tgbotapi.CallbackQuery) {
 	chatID := cb.Message.Chat.ID
-	st := periodsStates[chatID]
+	st := periodsStates.Value(chatID)
 	if st == nil || st.Editing == nil {
 		return
 	}
+	defer periodsStates.Save(ctx, chatID)
 	ep := st.Editing
 	if _, err := tg.Request(bot, tgbotapi.NewCallback(cb.ID, "")); err != nil {
 		metrics.HandlerErrors.Inc()
@@ -341,8 +354,28 @@ func validateEditDates(ep *EditPeriodState) error {
 	return nil
 }
 
+// periodHolidayWarning — предупреждение, если начало или конец периода приходится
+// на день из календаря праздников. Сохранять такой период не запрещено.
+func periodHolidayWarning(ctx context.Context, database *sql.DB, start, end time.Time) string {
+	var warn strings.Builder
+	for _, b := range []struct {
+		label string
+		day   time.Time
+	}{{"Начало", start}, {"Окончание", end}} {
+		title, ok, err := db.HolidayTitle(ctx, database, b.day)
+		if err != nil || !ok {
+			continue
+		}
+		if title == "" {
+			title = "нерабочий день"
+		}
+		fmt.Fprintf(&warn, "\n⚠️ %s периода (%s) приходится на праздник: %s.", b.label, b.day.Format("02.01.2006"), title)
+	}
+	return warn.String()
+}
+
 // PeriodsFSMActive helper для dispatcher
 func PeriodsFSMActive(chatID int64) (*PeriodsFSMState, bool) {
-	st, ok := periodsStates[chatID]
+	st, ok := periodsStates.Get(chatID)
 	return st, ok
 }
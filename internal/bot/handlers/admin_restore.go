@@ -1,12 +1,8 @@
 package handlers
 
 import (
-	"archive/zip"
-	"bytes"
-	"compress/gzip"
 	"context"
 	"database/sql"
-	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
@@ -14,65 +10,46 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 
-	"github.com/Spok95/telegram-school-bot/internal/backupclient"
-	"github.com/Spok95/telegram-school-bot/internal/bot/handlers/migrations"
+	"github.com/Spok95/telegram-school-bot/internal/backup"
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmstore"
 	"github.com/Spok95/telegram-school-bot/internal/ctxutil"
 	"github.com/Spok95/telegram-school-bot/internal/db"
 	"github.com/Spok95/telegram-school-bot/internal/metrics"
 	"github.com/Spok95/telegram-school-bot/internal/tg"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"github.com/pressly/goose/v3"
 )
 
-// HandleAdminRestoreLatest — восстанавливает БД из последнего файла в ./backups через sidecar
+// HandleAdminRestoreLatest — пробный запуск восстановления последнего дампа sidecar (latest.sql.gz);
+// само восстановление — после подтверждения, через безопасный сценарий каталога.
 func HandleAdminRestoreLatest(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, chatID int64) {
-	ctx, cancel := ctxutil.WithTimeout(ctx, 5*time.Minute)
+	ctx, cancel := ctxutil.WithTimeout(ctx, 10*time.Minute)
 	defer cancel()
 
-	user, _ := db.GetUserByTelegramID(ctx, database, chatID)
-	if user == nil || user.Role == nil || *user.Role != "admin" {
-		_, _ = tg.Send(bot, tgbotapi.NewMessage(chatID, "🚫 Только для администратора"))
-		return
-	}
-
-	_, _ = tg.Send(bot, tgbotapi.NewMessage(chatID, "🛠 Восстанавливаю БД из последнего бэкапа…"))
-
-	body, err := backupclient.RestoreLatest(ctx)
-	if err != nil {
-		_, _ = tg.Send(bot, tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ Не удалось восстановить: %v", err)))
+	if !isAdminChat(ctx, database, chatID) {
+		backupReply(bot, chatID, "🚫 Только для администратора")
 		return
 	}
-
-	// уберём простыню — возьмём только первую строку
-	log.Printf("restore-latest output:\n%s", body)
-	line := strings.SplitN(body, "\n", 2)[0]
-
-	// если CGI написал, что restore failed — покажем красным
-	lower := strings.ToLower(line)
-	if strings.Contains(lower, "failed") || strings.Contains(lower, "error") {
-		_, _ = tg.Send(bot, tgbotapi.NewMessage(chatID, "❌ Восстановление завершилось с ошибкой: "+line))
+	e, err := backupCatalog.Latest()
+	if errors.Is(err, backup.ErrNotFound) {
+		backupReply(bot, chatID, "⚠️ Последний дамп sidecar не найден в каталоге "+backupCatalog.Dir+
+			". Сделайте «💾 Бэкап БД» или выберите копию в «♻️ Восстановить БД».")
 		return
 	}
-
-	// если всё норм — после восстановления прогоняем миграции
-	if err := runMigrations(ctx, database); err != nil {
-		// покажем, что восстановили, но миграции не доехали
-		_, _ = tg.Send(bot, tgbotapi.NewMessage(chatID,
-			"✅ Восстановлено, но не удалось применить миграции: "+err.Error()))
+	if err != nil {
+		metrics.HandlerErrors.Inc()
+		backupReply(bot, chatID, fmt.Sprintf("❌ Не удалось прочитать каталог бэкапов: %v", err))
 		return
 	}
-
-	_, _ = tg.Send(bot, tgbotapi.NewMessage(chatID, "✅ Готово. Восстановлено из: "+line))
+	showRestorePlan(ctx, bot, database, chatID, e)
 }
 
 // простейший FSM по chatID
-var restoreWaiting = map[int64]bool{}
+var restoreWaiting = fsmstore.NewMap[bool]("restore_upload", 1, time.Hour)
 
-func AdminRestoreFSMActive(chatID int64) bool { return restoreWaiting[chatID] }
+func AdminRestoreFSMActive(chatID int64) bool { return restoreWaiting.Value(chatID) }
 
 func HandleAdminRestoreStart(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, chatID int64) {
 	user, _ := db.GetUserByTelegramID(ctx, database, chatID)
@@ -82,11 +59,13 @@ func HandleAdminRestoreStart(ctx context.Context, bot *tgbotapi.BotAPI, database
 		}
 		return
 	}
-	restoreWaiting[chatID] = true
+	restoreWaiting.Set(ctx, chatID, true)
 
 	text := "⚠️ Восстановление перезапишет данные в существующих таблицах.\n\n" +
-		"Пришлите файл бэкапа из «💾 Бэкап БД» — это *.sql.gz (поддерживаются также *.sql и *.zip). " +
-		"Я загружу файл и восстановлю данные."
+		"Пришлите файл бэкапа из «💾 Бэкап БД» (*.sql.gz, поддерживается и *.sql) или архив из «📦 Выгрузка БД» (*.zip). " +
+		"Зашифрованные копии (*.enc) расшифровываются ключами бота. " +
+		"Я сохраню файл в каталог бэкапов, проверю его пробным восстановлением и покажу, что изменится; " +
+		"перед восстановлением будет сделан снимок текущей БД."
 
 	cancel := tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", "restore_cancel")
 	m := tgbotapi.NewMessage(chatID, text)
@@ -131,7 +110,7 @@ func HandleAdminRestoreCallback(ctx context.Context, bot *tgbotapi.BotAPI, datab
 	}
 
 	if cb.Data == "restore_cancel" {
-		delete(restoreWaiting, chatID)
+		restoreWaiting.Delete(ctx, chatID)
 
 		// отредактировать сообщение и убрать кнопки
 		emptyKB := tgbotapi.InlineKeyboardMarkup{
@@ -145,20 +124,24 @@ func HandleAdminRestoreCallback(ctx context.Context, bot *tgbotapi.BotAPI, datab
 	}
 }
 
+// HandleAdminRestoreMessage принимает файл бэкапа и показывает план восстановления.
+// ctx должен быть отвязан от таймаута апдейта: пробное восстановление большого бэкапа идёт минутами.
 func HandleAdminRestoreMessage(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, msg *tgbotapi.Message) {
-	ctx, cancel := ctxutil.WithTimeout(ctx, 10*time.Minute)
-	defer cancel()
 	chatID := msg.Chat.ID
 	if !AdminRestoreFSMActive(chatID) {
 		return
 	}
 	if msg.Document == nil {
-		if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "Пришлите файл бэкапа: *.sql.gz / *.sql / *.zip.")); err != nil {
+		if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "Пришлите файл бэкапа: *.sql.gz / *.sql / *.zip (или они же с .enc).")); err != nil {
 			metrics.HandlerErrors.Inc()
 		}
 		return
 	}
-	defer func() { delete(restoreWaiting, chatID) }()
+	if !backup.IsBackupName(msg.Document.FileName) {
+		backupReply(bot, chatID, "Это не файл бэкапа. Поддерживаются *.sql.gz / *.sql / *.zip (или они же с .enc).")
+		return
+	}
+	defer func() { restoreWaiting.Delete(ctx, chatID) }()
 
 	// качаем файл из Telegram
 	path, err := downloadTelegramFile(ctx, bot, msg.Document.FileID, msg.Document.FileName)
@@ -170,20 +153,20 @@ func HandleAdminRestoreMessage(ctx context.Context, bot *tgbotapi.BotAPI, databa
 	}
 	defer func() { _ = os.Remove(path) }()
 
-	if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "⌛ Восстанавливаю БД из бэкапа…")); err != nil {
+	// файл попадает в каталог бэкапов: дальше — тот же пробный запуск и безопасное восстановление
+	e, err := backupCatalog.Import(path, msg.Document.FileName, time.Now())
+	if err != nil {
+		log.Println("restore import:", err)
 		metrics.HandlerErrors.Inc()
-	}
-
-	if err := restoreFromUpload(ctx, database, path); err != nil {
-		log.Println("restore error:", err)
-		if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ Ошибка восстановления: %v", err))); err != nil {
-			metrics.HandlerErrors.Inc()
-		}
+		backupReply(bot, chatID, fmt.Sprintf("❌ Не удалось сохранить файл в каталог бэкапов: %v", err))
 		return
 	}
-	if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "✅ Готово. База восстановлена.")); err != nil {
-		metrics.HandlerErrors.Inc()
+	// копия в каталоге не должна лежать открытой, если шифрование включено
+	if err := backupCatalog.Seal(e); err != nil {
+		log.Println("backup encrypt:", err)
 	}
+	backupReply(bot, chatID, "📥 Файл сохранён в каталог бэкапов: "+e.Name)
+	showRestorePlan(ctx, bot, database, chatID, e)
 }
 
 func downloadTelegramFile(ctx context.Context, bot *tgbotapi.BotAPI, fileID string, origName string) (string, error) {
@@ -223,389 +206,3 @@ func downloadTelegramFile(ctx context.Context, bot *tgbotapi.BotAPI, fileID stri
 	}
 	return tmp, nil
 }
-
-func restoreFromZip(ctx context.Context, database *sql.DB, zipPath string) error {
-	zr, err := zip.OpenReader(zipPath)
-	if err != nil {
-		return err
-	}
-	defer func() { _ = zr.Close() }()
-
-	// Если таблиц нет — создадим схему миграциями
-	if err := ensureSchemaContext(ctx, database); err != nil {
-		return fmt.Errorf("ensure schema: %w", err)
-	}
-
-	// читаем все CSV в память (обычно объёмы умеренные)
-	type tableDump struct {
-		name string
-		csv  *csv.Reader
-		r    io.ReadCloser
-	}
-	var dumps []tableDump
-	for _, f := range zr.File {
-		if strings.HasPrefix(f.Name, "data/") && strings.HasSuffix(f.Name, ".csv") {
-			rc, err := f.Open()
-			if err != nil {
-				return err
-			}
-			// оборачиваем, чтобы csv.Reader не закрыл нам zip-ридер раньше времени
-			buf := &bytes.Buffer{}
-			if _, err := io.Copy(buf, rc); err != nil {
-				_ = rc.Close()
-				return err
-			}
-			_ = rc.Close()
-			r := io.NopCloser(bytes.NewReader(buf.Bytes()))
-			dumps = append(dumps, tableDump{
-				name: strings.TrimSuffix(filepath.Base(f.Name), ".csv"),
-				csv:  csv.NewReader(bytes.NewReader(buf.Bytes())),
-				r:    r,
-			})
-		}
-	}
-	if len(dumps) == 0 {
-		return errors.New("в архиве нет data/*.csv")
-	}
-
-	// порядок загрузки (учёт FK)
-	order := []string{
-		"users", "classes", "categories", "periods", "parents_students",
-		"scores", "role_changes", "score_levels",
-	}
-	index := map[string]tableDump{}
-	for _, d := range dumps {
-		index[d.name] = d
-	}
-
-	tx, err := database.BeginTx(ctx, &sql.TxOptions{})
-	if err != nil {
-		return fmt.Errorf("begin tx: %w", err)
-	}
-	defer func() { _ = tx.Rollback() }()
-
-	// TRUNCATE (если таблицы существуют) и заливка
-	for _, t := range order {
-		d, ok := index[t]
-		if !ok {
-			continue
-		}
-		exists, err := tableExistsContext(ctx, tx, t)
-		if err != nil {
-			return err
-		}
-		if exists {
-			if _, err := tx.ExecContext(ctx, `TRUNCATE `+quoteIdent(t)+` CASCADE`); err != nil {
-				return fmt.Errorf("truncate %s: %w", t, err)
-			}
-		} else {
-			log.Println("info: skip truncate — table not exists:", t)
-		}
-		if err := loadCSVContext(ctx, tx, t, d.csv); err != nil {
-			return fmt.Errorf("load %s: %w", t, err)
-		}
-		if err := resetSequenceContext(ctx, tx, t); err != nil {
-			return fmt.Errorf("reset seq %s: %w", t, err)
-		}
-	}
-	// загружаем «остальные» таблицы из архива (если были новые)
-	for _, d := range dumps {
-		skip := false
-		for _, t := range order {
-			if t == d.name {
-				skip = true
-				break
-			}
-		}
-		if skip {
-			continue
-		}
-		exists, err := tableExistsContext(ctx, tx, d.name)
-		if err != nil {
-			return err
-		}
-		if !exists {
-			log.Println("info: skip restore — table not exists in DB:", d.name)
-			continue
-		}
-		if _, err := tx.ExecContext(ctx, `TRUNCATE `+quoteIdent(d.name)+` CASCADE`); err != nil {
-			return fmt.Errorf("truncate %s: %w", d.name, err)
-		}
-		if err := loadCSVContext(ctx, tx, d.name, d.csv); err != nil {
-			return fmt.Errorf("load %s: %w", d.name, err)
-		}
-		if err := resetSequenceContext(ctx, tx, d.name); err != nil {
-			return fmt.Errorf("reset seq %s: %w", d.name, err)
-		}
-	}
-
-	if err := tx.Commit(); err != nil {
-		return err
-	}
-	return nil
-}
-
-func ensureSchemaContext(ctx context.Context, database *sql.DB) error {
-	// проверим наличие таблиц
-	var n int
-	if err := database.QueryRowContext(ctx, `SELECT count(*) FROM information_schema.tables WHERE table_schema='public'`).Scan(&n); err != nil {
-		return err
-	}
-	if n > 0 {
-		return nil
-	}
-	// накатываем миграции из embed FS
-	goose.SetBaseFS(migrations.FS)
-	return goose.Up(database, ".")
-}
-
-func loadCSVContext(ctx context.Context, tx *sql.Tx, table string, r *csv.Reader) error {
-	cols, err := r.Read()
-	if err != nil {
-		return err
-	}
-	// узнаём типы колонок из information_schema (нужно для корректного парсинга дат/времен)
-	colTypes, err := getColumnTypesContext(ctx, tx, table)
-	if err != nil {
-		return err
-	}
-
-	ph := make([]string, len(cols))
-	for i := range cols {
-		ph[i] = "$" + strconv.Itoa(i+1)
-	}
-	// безопасная сборка SQL без fmt.Sprintf + квотирование идентификаторов
-	qcols := make([]string, len(cols))
-	for i, c := range cols {
-		qcols[i] = quoteIdent(c)
-	}
-	stmt := "INSERT INTO " + quoteIdent(table) +
-		" (" + strings.Join(qcols, ",") + ") VALUES (" + strings.Join(ph, ",") + ")"
-
-	for {
-		rec, err := r.Read()
-		if errors.Is(err, io.EOF) {
-			break
-		}
-		if err != nil {
-			return err
-		}
-		args := make([]any, len(rec))
-		for i, v := range rec {
-			s := strings.TrimSpace(v)
-			// принимаем старые бэкапы: "", "<nil>", "null" → NULL
-			if s == "" || s == "<nil>" || strings.EqualFold(s, "null") {
-				args[i] = nil
-				continue
-			}
-			// преобразуем по типу колонки
-			t := strings.ToLower(colTypes[cols[i]])
-			switch {
-			case strings.Contains(t, "timestamp") || t == "date":
-				if tt, perr := parseTimeFlex(s); perr == nil {
-					args[i] = tt
-				} else {
-					// в крайнем случае отправим как строку (пусть упадёт на конкретном месте)
-					args[i] = s
-				}
-			case strings.Contains(t, "boolean"):
-				// пусть PG сам приведёт из 't/true/1' — строку отправляем как есть
-				args[i] = s
-			case strings.Contains(t, "integer") || strings.Contains(t, "bigint") ||
-				strings.Contains(t, "smallint") || strings.Contains(t, "numeric") ||
-				strings.Contains(t, "double"):
-				// числа удобно оставить строкой — PG приведёт, но без "<nil>"
-				args[i] = s
-			default:
-				args[i] = s
-			}
-		}
-		if _, err := tx.ExecContext(ctx, stmt, args...); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-// Получаем map[column_name]data_type для таблицы
-func getColumnTypesContext(ctx context.Context, tx *sql.Tx, table string) (map[string]string, error) {
-	rows, err := tx.QueryContext(ctx, `
-        SELECT column_name, data_type
-        FROM information_schema.columns
-        WHERE table_schema='public' AND table_name = $1
-    `, table)
-	if err != nil {
-		return nil, err
-	}
-	defer func() { _ = rows.Close() }()
-	m := make(map[string]string)
-	for rows.Next() {
-		var name, dt string
-		if err := rows.Scan(&name, &dt); err != nil {
-			return nil, err
-		}
-		m[name] = dt
-	}
-	return m, rows.Err()
-}
-
-// Парсим время из нескольких распространённых форматов (RFC3339/RFC3339Nano и Go-строка с зоной типа "MSK")
-func parseTimeFlex(s string) (time.Time, error) {
-	layouts := []string{
-		time.RFC3339Nano,
-		time.RFC3339,
-		"2006-01-02 15:04:05.999999999 -0700 MST", // например: 2025-08-24 04:13:10.69002 +0300 MSK
-		"2006-01-02 15:04:05 -0700 MST",
-		"2006-01-02 15:04:05.999999999Z07:00",
-		"2006-01-02 15:04:05Z07:00",
-		"2006-01-02",
-	}
-	var lastErr error
-	for _, layout := range layouts {
-		if t, err := time.Parse(layout, s); err == nil {
-			return t, nil
-		} else {
-			lastErr = err
-		}
-	}
-	return time.Time{}, lastErr
-}
-
-func resetSequenceContext(ctx context.Context, tx *sql.Tx, table string) error {
-	// 1) Есть ли вообще колонка id?
-	var hasID bool
-	if err := tx.QueryRowContext(ctx, `
-		SELECT EXISTS (
-		  SELECT 1 FROM information_schema.columns
-		  WHERE table_schema='public' AND table_name=$1 AND column_name='id'
-		)`, table).Scan(&hasID); err != nil {
-		return err
-	}
-	if !hasID {
-		return nil // у таблицы нет id — нечего сбрасывать
-	}
-
-	// 2) Есть ли последовательность у id?
-	var seq sql.NullString
-	if err := tx.QueryRowContext(ctx, `SELECT pg_get_serial_sequence($1,'id')`, table).Scan(&seq); err != nil {
-		return err
-	}
-	if !seq.Valid || seq.String == "" {
-		return nil // id не serial/identity — сброс не нужен
-	}
-
-	// 3) Вычисляем MAX(id); если строк нет — ставим value=1, is_called=false
-	qTable := quoteIdent(table)
-	var maxID sql.NullInt64
-	if err := tx.QueryRowContext(ctx, "SELECT MAX(id) FROM "+qTable).Scan(&maxID); err != nil {
-		return err
-	}
-	var value int64 = 1
-	isCalled := false
-	if maxID.Valid {
-		if maxID.Int64 >= 1 {
-			value = maxID.Int64
-			isCalled = true
-		} else {
-			value = 1
-			isCalled = false
-		}
-	}
-	// 4) setval по найденной последовательности
-	_, err := tx.ExecContext(ctx, `SELECT setval($1::regclass, $2, $3)`, seq.String, value, isCalled)
-	return err
-}
-
-// tableExists — проверка существования таблицы в public
-func tableExistsContext(ctx context.Context, tx *sql.Tx, table string) (bool, error) {
-	var exists bool
-	err := tx.QueryRowContext(ctx, `
-		SELECT EXISTS (
-		  SELECT 1 FROM information_schema.tables
-		  WHERE table_schema='public' AND table_name=$1
-		)`, table).Scan(&exists)
-	return exists, err
-}
-
-// quoteIdent — экранирует идентификатор для SQL
-func quoteIdent(id string) string {
-	return `"` + strings.ReplaceAll(id, `"`, `""`) + `"`
-}
-
-// restoreFromUpload — универсальная восстановлялка:
-//   - *.zip (старый формат с CSV) → restoreFromZip
-//   - *.sql.gz / *.sql (бэкап sidecar'а) → кладём в /backups с новым таймштампом и зовём RestoreLatest
-func restoreFromUpload(ctx context.Context, database *sql.DB, localPath string) error {
-	name := strings.ToLower(filepath.Base(localPath))
-
-	// 1) ZIP с CSV — оставляем текущую логику
-	if strings.HasSuffix(name, ".zip") {
-		return restoreFromZip(ctx, database, localPath)
-	}
-
-	// 2) .sql.gz или .sql — кладём в /backups и просим sidecar восстановить "последний"
-	dstDir := "/backups"
-	if err := os.MkdirAll(dstDir, 0o755); err != nil {
-		return fmt.Errorf("mkdir backups: %w", err)
-	}
-
-	ts := time.Now().Format("2006-01-02_150405")
-	base := filepath.Base(localPath)
-
-	// Если .sql — сожмём в .sql.gz (sidecar обычно ждёт gzip)
-	dstPath := filepath.Join(dstDir, "manual-"+ts+"-"+base)
-	if strings.HasSuffix(name, ".sql") {
-		dstPath += ".gz"
-		in, err := os.Open(localPath)
-		if err != nil {
-			return err
-		}
-		defer func() { _ = in.Close() }()
-		out, err := os.Create(dstPath)
-		if err != nil {
-			return err
-		}
-		gz := gzip.NewWriter(out)
-		if _, err := io.Copy(gz, in); err != nil {
-			_ = gz.Close()
-			_ = out.Close()
-			return err
-		}
-		if err := gz.Close(); err != nil {
-			_ = out.Close()
-			return err
-		}
-		if err := out.Close(); err != nil {
-			return err
-		}
-	} else {
-		// .sql.gz — просто копируем как новый "последний" файл
-		src, err := os.Open(localPath)
-		if err != nil {
-			return err
-		}
-		defer func() { _ = src.Close() }()
-		out, err := os.Create(dstPath)
-		if err != nil {
-			return err
-		}
-		if _, err := io.Copy(out, src); err != nil {
-			_ = out.Close()
-			return err
-		}
-		if err := out.Close(); err != nil {
-			return err
-		}
-	}
-
-	// Просим sidecar восстановить "последний" файл в /backups
-	if _, err := backupclient.RestoreLatest(ctx); err != nil {
-		return fmt.Errorf("restore-latest: %w", err)
-	}
-	return nil
-}
-
-func runMigrations(ctx context.Context, database *sql.DB) error {
-	goose.SetBaseFS(migrations.FS)
-	return goose.UpContext(ctx, database, ".")
-}
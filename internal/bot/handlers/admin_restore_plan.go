@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/backup"
+	"github.com/Spok95/telegram-school-bot/internal/backupclient"
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
+	"github.com/Spok95/telegram-school-bot/internal/bot/handlers/migrations"
+	"github.com/Spok95/telegram-school-bot/internal/metrics"
+	"github.com/Spok95/telegram-school-bot/internal/observability"
+	"github.com/Spok95/telegram-school-bot/internal/tg"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Безопасное восстановление: пробный запуск во временной схеме и сравнение с текущей БД,
+// снимок текущей БД перед восстановлением, сверка результата и откат к снимку при любой ошибке.
+
+// столько изменённых таблиц показываем в пробном запуске
+const planChangesLimit = 15
+
+// одно восстановление за раз: второе поверх первого сломало бы и снимок, и откат
+var restoreMu sync.Mutex
+
+// restoring — от снимка до сверки (или отката): записи в БД в это время либо затрёт
+// восстановление, либо они сломают сверку дампа sidecar, которую не провести в одной транзакции.
+var restoring atomic.Bool
+
+// RestoreInProgress — идёт восстановление БД: апдейты и фоновые задачи на это время откладываются.
+func RestoreInProgress() bool { return restoring.Load() }
+
+// showRestorePlan — пробный запуск восстановления бэкапа; кнопка «Восстановить» — только если
+// бэкап прошёл проверку.
+func showRestorePlan(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, chatID int64, e *backup.Entry) {
+	// у старых проверок нет числа строк по таблицам — без него пробный запуск не показать
+	if e.Check == nil || (e.Check.OK && e.Check.Counts == nil) {
+		backupReply(bot, chatID, "⌛ Пробное восстановление "+e.Name+" во временную схему…")
+		if _, err := backupCatalog.Verify(ctx, database, e); err != nil {
+			metrics.HandlerErrors.Inc()
+			backupReply(bot, chatID, "❌ Не удалось провести проверку: "+verifyErrText(err))
+			return
+		}
+	}
+	plan, err := planRestore(ctx, database, e.Check)
+	if err != nil {
+		metrics.HandlerErrors.Inc()
+		backupReply(bot, chatID, fmt.Sprintf("❌ Не удалось сравнить бэкап с текущей БД: %v", err))
+		return
+	}
+
+	var bs callback.Buttons
+	var row []tgbotapi.InlineKeyboardButton
+	if plan.OK() {
+		row = append(row, bs.Add(cbBackupDo.Button("✅ Восстановить", e.ID)))
+	} else {
+		row = append(row, bs.Add(cbBackupCheck.Button("🔍 Проверить снова", e.ID)))
+	}
+	row = append(row, tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", bkCancel))
+	if buttonsFailed(&bs) {
+		return
+	}
+	m := tgbotapi.NewMessage(chatID, restorePlanText(e, plan))
+	m.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(row)
+	if _, err := tg.Send(bot, m); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
+
+func planRestore(ctx context.Context, database *sql.DB, ch *backup.Check) (*backup.Plan, error) {
+	target, err := migrations.Latest()
+	if err != nil {
+		return nil, err
+	}
+	current, err := backup.TableCounts(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+	deps, err := backup.ForeignKeys(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+	return backup.PlanRestore(ch, current, deps, target), nil
+}
+
+func restorePlanText(e *backup.Entry, p *backup.Plan) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "🔎 Пробное восстановление: %s\n%s\n\n", e.Name, backupLine(*e))
+	for _, s := range p.Problems {
+		b.WriteString("❌ " + s + "\n")
+	}
+	if !p.OK() {
+		b.WriteString("\nВосстанавливать из этого бэкапа нельзя.")
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "Схема: бэкап %s, бот %d. Строк в бэкапе: %d в %d таблицах, внешние ключи согласованы.\n\n",
+		schemaVersionText(p.ArchiveVersion), p.TargetVersion, e.Check.Rows, e.Check.Tables)
+	if len(p.Changes) == 0 {
+		b.WriteString("Данные по числу строк совпадают с текущей БД.\n")
+	} else {
+		b.WriteString("Что изменится (сейчас → после):\n")
+		for i, c := range p.Changes {
+			if i == planChangesLimit {
+				fmt.Fprintf(&b, "…и ещё %d таблиц\n", len(p.Changes)-planChangesLimit)
+				break
+			}
+			fmt.Fprintf(&b, "• %s: %d → %d (%+d)\n", c.Table, c.Before, c.After, c.After-c.Before)
+		}
+		if p.Unchanged > 0 {
+			fmt.Fprintf(&b, "Без изменений: %d таблиц.\n", p.Unchanged)
+		}
+	}
+	for _, s := range p.Warnings {
+		b.WriteString("⚠️ " + s + "\n")
+	}
+	b.WriteString("\nПеред восстановлением будет сделан снимок текущей БД; " +
+		"если что-то пойдёт не так, база автоматически вернётся к нему.")
+	return b.String()
+}
+
+func schemaVersionText(v int64) string {
+	if v == 0 {
+		return "?"
+	}
+	return fmt.Sprint(v)
+}
+
+func verifyErrText(err error) string {
+	if errors.Is(err, backup.ErrUnknownKey) && !backupCatalog.Keys.Enabled() {
+		return "файл зашифрован, а ключи BACKUP_ENCRYPTION_KEYS не заданы"
+	}
+	return err.Error()
+}
+
+// safeRestore — снимок текущей БД, восстановление, сверка с бэкапом; при ошибке — откат к снимку.
+func safeRestore(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, chatID int64, e *backup.Entry) {
+	if !restoreMu.TryLock() {
+		backupReply(bot, chatID, "⏳ Уже идёт восстановление — дождитесь его окончания.")
+		return
+	}
+	defer restoreMu.Unlock()
+
+	if e.Check == nil || e.Check.Counts == nil {
+		backupReply(bot, chatID, "⌛ Проверяю бэкап перед восстановлением…")
+		if _, err := backupCatalog.Verify(ctx, database, e); err != nil {
+			metrics.HandlerErrors.Inc()
+			backupReply(bot, chatID, "❌ Не удалось провести проверку, восстановление отменено: "+verifyErrText(err))
+			return
+		}
+	}
+	plan, err := planRestore(ctx, database, e.Check)
+	if err != nil {
+		metrics.HandlerErrors.Inc()
+		backupReply(bot, chatID, fmt.Sprintf("❌ Не удалось сравнить бэкап с текущей БД: %v", err))
+		return
+	}
+	if !plan.OK() {
+		backupReply(bot, chatID, "❌ Восстановление отменено: "+strings.Join(plan.Problems, "; "))
+		return
+	}
+
+	// зашифрованный бэкап расшифровывается во временный файл: zip читает бот,
+	// дамп — sidecar, поэтому копия дампа кладётся в общий каталог
+	zipped := strings.HasSuffix(strings.ToLower(backup.PlainName(e.Name)), ".zip")
+	dir := backupCatalog.Dir
+	if zipped {
+		dir = os.TempDir()
+	}
+	path, cleanup, err := backupCatalog.Decrypted(e, dir)
+	if err != nil {
+		metrics.HandlerErrors.Inc()
+		backupReply(bot, chatID, "❌ Не удалось прочитать бэкап: "+verifyErrText(err))
+		return
+	}
+	defer cleanup()
+
+	restoring.Store(true)
+	defer restoring.Store(false)
+
+	backupReply(bot, chatID, "📸 Делаю снимок текущей БД…")
+	snap, err := backupCatalog.Snapshot(ctx, database, time.Now())
+	if err != nil {
+		metrics.HandlerErrors.Inc()
+		backupReply(bot, chatID, fmt.Sprintf("❌ Не удалось сделать снимок текущей БД, восстановление отменено: %v", err))
+		return
+	}
+
+	backupReply(bot, chatID, "🛠 Восстанавливаю БД из "+e.Name+"…")
+	err = applyRestore(ctx, database, e, plan, path, zipped)
+	if err == nil {
+		backupReply(bot, chatID, "✅ Готово. База восстановлена из "+e.Name+".\nСнимок прежней БД: "+snap.Name)
+		return
+	}
+
+	log.Println("restore error:", err)
+	metrics.HandlerErrors.Inc()
+	observability.CaptureErr(err)
+	backupReply(bot, chatID, fmt.Sprintf("❌ Ошибка восстановления: %v\n↩️ Возвращаю БД к снимку %s…", err, snap.Name))
+	// откат нужен и тогда, когда время на восстановление вышло
+	rctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Minute)
+	defer cancel()
+	if err := backupCatalog.Rollback(rctx, database, snap); err != nil {
+		log.Println("rollback error:", err)
+		observability.CaptureErr(err)
+		backupReply(bot, chatID, fmt.Sprintf("🆘 Не удалось вернуть БД к снимку: %v\n"+
+			"Снимок лежит в каталоге бэкапов: %s — восстановите его вручную.", err, snap.Name))
+		return
+	}
+	backupReply(bot, chatID, "↩️ БД возвращена к состоянию до восстановления.")
+}
+
+// applyRestore восстанавливает бэкап (zip — бот, дамп — sidecar и миграции) и сверяет
+// число строк в БД с бэкапом. zip сверяется внутри транзакции восстановления: записи
+// других чатов и фоновых задач, дождавшиеся снятия блокировок, сверку не ломают.
+func applyRestore(ctx context.Context, database *sql.DB, e *backup.Entry, plan *backup.Plan, path string, zipped bool) error {
+	if zipped {
+		return backup.RestoreZipChecked(ctx, database, path, func(after map[string]int64) error {
+			return plan.CheckRestored(e.Check, after)
+		})
+	}
+	out, err := backupclient.Restore(ctx, filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	log.Printf("restore %s: %s", e.Name, out)
+	if err := backup.Migrate(ctx, database); err != nil {
+		return fmt.Errorf("migrations: %w", err)
+	}
+	after, err := backup.TableCounts(ctx, database)
+	if err != nil {
+		return err
+	}
+	return plan.CheckRestored(e.Check, after)
+}
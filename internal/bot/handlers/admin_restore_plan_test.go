@@ -0,0 +1,145 @@
+//go:build testutil
+// +build testutil
+
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/backup"
+	"github.com/Spok95/telegram-school-bot/internal/models"
+	"github.com/Spok95/telegram-school-bot/internal/testutil/testdb"
+)
+
+func TestCatalogRollback_BrokenSchema(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+	h, err := testdb.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	prev := backupCatalog
+	backupCatalog = backup.NewCatalog(t.TempDir(), nil)
+	defer func() { backupCatalog = prev }()
+
+	mustSeedUser(ctx, t, h.DB, "Админ", models.Admin, nil, nil)
+	mustSeedUser(ctx, t, h.DB, "Петров Пётр", models.Student, ptrInt64(5), ptrString("Б"))
+	want, err := backup.TableCounts(ctx, h.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snap, err := backupCatalog.Snapshot(ctx, h.DB, time.Now())
+	if err != nil {
+		t.Fatalf("снимок: %v", err)
+	}
+	// так выглядит БД после дампа, восстановившегося наполовину
+	if _, err := h.DB.ExecContext(ctx, `DROP TABLE scores CASCADE; DELETE FROM users`); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := backupCatalog.Rollback(ctx, h.DB, snap); err != nil {
+		t.Fatalf("откат: %v", err)
+	}
+	got, err := backup.TableCounts(ctx, h.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := backup.CompareCounts(want, got); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Запись из другого чата, пришедшая во время восстановления zip, не должна ломать сверку
+// и откатывать удачное восстановление.
+func TestApplyRestore_ConcurrentInsert(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+	h, err := testdb.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	mustSeedUser(ctx, t, h.DB, "Админ", models.Admin, nil, nil)
+	mustSeedUser(ctx, t, h.DB, "Петров Пётр", models.Student, ptrInt64(5), ptrString("Б"))
+	path := filepath.Join(t.TempDir(), "db.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := backup.WriteZip(ctx, h.DB, f)
+	_ = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &backup.Entry{Name: "db.zip", Path: path, Check: &backup.Check{OK: true, SchemaVersion: m.SchemaVersion, Counts: m.Counts()}}
+	plan, err := planRestore(ctx, h.DB, e.Check)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// держим categories: восстановление остановится на ней, уже очистив users
+	hold, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = hold.Rollback() }()
+	if _, err := hold.ExecContext(ctx, `LOCK TABLE categories IN ACCESS SHARE MODE`); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := make(chan error, 1)
+	go func() { restored <- applyRestore(ctx, h.DB, e, plan, path, true) }()
+	waitLockWait(ctx, t, h.DB, "TRUNCATE%")
+
+	inserted := make(chan error, 1)
+	go func() {
+		_, err := h.DB.ExecContext(ctx, `INSERT INTO users (telegram_id, name, role, confirmed) VALUES ($1, $2, 'student', TRUE)`,
+			int64(999001), "Новый ученик")
+		inserted <- err
+	}()
+	waitLockWait(ctx, t, h.DB, "INSERT INTO users%")
+	_ = hold.Rollback()
+
+	if err := <-restored; err != nil {
+		t.Fatalf("восстановление откатилось бы из-за параллельной записи: %v", err)
+	}
+	if err := <-inserted; err != nil {
+		t.Fatal(err)
+	}
+	var n int64
+	if err := h.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM users`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if want := e.Check.Counts["users"] + 1; n != want {
+		t.Fatalf("пользователей %d, ожидали %d (бэкап и запись, дождавшаяся восстановления)", n, want)
+	}
+}
+
+// waitLockWait ждёт, пока запрос, начинающийся с pattern, встанет в ожидание блокировки.
+func waitLockWait(ctx context.Context, t *testing.T, database *sql.DB, pattern string) {
+	t.Helper()
+	for {
+		var n int
+		if err := database.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM pg_stat_activity WHERE wait_event_type = 'Lock' AND query LIKE $1`, pattern).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n > 0 {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("не дождались ожидания блокировки %q", pattern)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+}
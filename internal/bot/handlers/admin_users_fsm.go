@@ -9,6 +9,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmstore"
 	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmutil"
 	"github.com/Spok95/telegram-school-bot/internal/db"
 	"github.com/Spok95/telegram-school-bot/internal/metrics"
@@ -26,9 +28,16 @@ type adminUsersState struct {
 	MessageID      int
 }
 
-var adminUsersStates = map[int64]*adminUsersState{}
+// Кнопки с аргументом (формат — см. пакет callback).
+var (
+	cbAdmUserPick  = callback.NewAction1("admusr_pick_", callback.ID)
+	cbAdmUserSet   = callback.NewAction1("admusr_set_", callback.Word(14))   // роль
+	cbAdmUserApply = callback.NewAction1("admusr_apply_", callback.Word(14)) // роль
+)
+
+var adminUsersStates = fsmstore.NewMap[*adminUsersState]("admin_users", 1, fsmstore.DefaultTTL)
 
-func GetAdminUsersState(chatID int64) *adminUsersState { return adminUsersStates[chatID] }
+func GetAdminUsersState(chatID int64) *adminUsersState { return adminUsersStates.Value(chatID) }
 
 // ─── ENTRY
 
@@ -39,22 +48,22 @@ func StartAdminUsersFSM(ctx context.Context, bot *tgbotapi.BotAPI, msg *tgbotapi
 	default:
 	}
 	chatID := msg.Chat.ID
-	adminUsersStates[chatID] = &adminUsersState{Step: 1}
 	edit := tgbotapi.NewMessage(chatID, "👥 Управление пользователями\nВведите имя или класс (например, 7А) для поиска:")
 	edit.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
 		fsmutil.BackCancelRow("admusr_back_to_menu", "admusr_cancel"))
 	sent, _ := tg.Send(bot, edit)
-	adminUsersStates[chatID].MessageID = sent.MessageID
+	adminUsersStates.Set(ctx, chatID, &adminUsersState{Step: 1, MessageID: sent.MessageID})
 }
 
 // ─── TEXT HANDLER
 
 func HandleAdminUsersText(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, msg *tgbotapi.Message) {
 	chatID := msg.Chat.ID
-	state := adminUsersStates[chatID]
+	state := adminUsersStates.Value(chatID)
 	if state == nil {
 		return
 	}
+	defer adminUsersStates.Save(ctx, chatID)
 
 	switch state.Step {
 	case 1:
@@ -71,6 +80,7 @@ func HandleAdminUsersText(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 			return
 		}
 		text := fmt.Sprintf("Найдено %d пользователей. Выберите:", len(users))
+		var bs callback.Buttons
 		var rows [][]tgbotapi.InlineKeyboardButton
 		for _, u := range users {
 			labelRole := "(нет роли)"
@@ -81,10 +91,13 @@ func HandleAdminUsersText(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 			if u.ClassNumber != nil && u.ClassLetter != nil {
 				labelClass = fmt.Sprintf(" • %d%s", int(*u.ClassNumber), *u.ClassLetter)
 			}
-			btn := tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%s • %s%s", u.Name, labelRole, labelClass), fmt.Sprintf("admusr_pick_%d", u.ID))
+			btn := bs.Add(cbAdmUserPick.Button(fmt.Sprintf("%s • %s%s", u.Name, labelRole, labelClass), u.ID))
 			rows = append(rows, tgbotapi.NewInlineKeyboardRow(btn))
 		}
 		rows = append(rows, fsmutil.BackCancelRow("admusr_back_to_search", "admusr_cancel"))
+		if buttonsFailed(&bs) {
+			return
+		}
 		mk := tgbotapi.NewInlineKeyboardMarkup(rows...)
 		edit := tgbotapi.NewEditMessageText(chatID, state.MessageID, text)
 		edit.ReplyMarkup = &mk
@@ -125,10 +138,11 @@ func HandleAdminUsersText(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 
 func HandleAdminUsersCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, cb *tgbotapi.CallbackQuery) {
 	chatID := cb.Message.Chat.ID
-	state := adminUsersStates[chatID]
+	state := adminUsersStates.Value(chatID)
 	if state == nil {
 		return
 	}
+	defer adminUsersStates.Save(ctx, chatID)
 	data := cb.Data
 
 	// Отмена
@@ -137,14 +151,14 @@ func HandleAdminUsersCallback(ctx context.Context, bot *tgbotapi.BotAPI, databas
 		if _, err := tg.Send(bot, tgbotapi.NewEditMessageText(chatID, state.MessageID, "🚫 Отменено.")); err != nil {
 			metrics.HandlerErrors.Inc()
 		}
-		delete(adminUsersStates, chatID)
+		adminUsersStates.Delete(ctx, chatID)
 		return
 	}
 
 	// выбор пользователя из списка
-	if strings.HasPrefix(data, "admusr_pick_") {
-		var uid int64
-		if _, err := fmt.Sscanf(data, "admusr_pick_%d", &uid); err != nil {
+	if cbAdmUserPick.Match(data) {
+		uid, err := cbAdmUserPick.Parse(data)
+		if err != nil {
 			return
 		}
 		state.SelectedUserID = uid
@@ -185,31 +199,24 @@ func HandleAdminUsersCallback(ctx context.Context, bot *tgbotapi.BotAPI, databas
 			metrics.HandlerErrors.Inc()
 		}
 
-		now := time.Now()
-		if err := db.DeactivateUser(ctx, database, state.SelectedUserID, now); err != nil {
+		// у ученика заодно пересчитываются родители (если не ученик — связей просто нет)
+		if _, err := db.DeactivateUserCascade(ctx, database, state.SelectedUserID, time.Now()); err != nil {
 			log.Println("deactivate user error:", err)
 			if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "❌ Не удалось деактивировать пользователя")); err != nil {
 				metrics.HandlerErrors.Inc()
 			}
 			return
 		}
-		// пересчитываем родителей, если это ученик (по связям; если не ученик — просто не будет строк)
-		rows, err := database.QueryContext(ctx, `SELECT parent_id FROM parents_students WHERE student_id = $1`, state.SelectedUserID)
-		if err == nil {
-			defer func() { _ = rows.Close() }()
-			for rows.Next() {
-				var pid int64
-				if scanErr := rows.Scan(&pid); scanErr == nil {
-					_ = db.RefreshParentActiveFlag(ctx, database, pid)
-				}
-			}
-		}
 		// сообщим и перерисуем карточку
 		if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "✅ Пользователь деактивирован")); err != nil {
 			metrics.HandlerErrors.Inc()
 		}
 		// триггерим заново отрисовку выбранного
-		cb.Data = fmt.Sprintf("admusr_pick_%d", state.SelectedUserID)
+		pick, err := cbAdmUserPick.Data(state.SelectedUserID)
+		if err != nil {
+			return
+		}
+		cb.Data = pick
 		HandleAdminUsersCallback(ctx, bot, database, cb)
 		return
 	}
@@ -239,13 +246,20 @@ func HandleAdminUsersCallback(ctx context.Context, bot *tgbotapi.BotAPI, databas
 		if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "✅ Пользователь активирован")); err != nil {
 			metrics.HandlerErrors.Inc()
 		}
-		cb.Data = fmt.Sprintf("admusr_pick_%d", state.SelectedUserID)
+		pick, err := cbAdmUserPick.Data(state.SelectedUserID)
+		if err != nil {
+			return
+		}
+		cb.Data = pick
 		HandleAdminUsersCallback(ctx, bot, database, cb)
 		return
 	}
 
-	if strings.HasPrefix(data, "admusr_set_") {
-		role := strings.TrimPrefix(data, "admusr_set_")
+	if cbAdmUserSet.Match(data) {
+		role, err := cbAdmUserSet.Parse(data)
+		if err != nil {
+			return
+		}
 		state.PendingRole = role
 
 		// Для ученика сначала спросим класс
@@ -260,12 +274,16 @@ func HandleAdminUsersCallback(ctx context.Context, bot *tgbotapi.BotAPI, databas
 			return
 		}
 		// Для остальных ролей сразу подтверждение
+		var bs callback.Buttons
 		rows := [][]tgbotapi.InlineKeyboardButton{
 			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("✅ Подтвердить", "admusr_apply_"+role),
+				bs.Add(cbAdmUserApply.Button("✅ Подтвердить", role)),
 			),
 			fsmutil.BackCancelRow("admusr_back_to_role", "admusr_cancel"),
 		}
+		if buttonsFailed(&bs) {
+			return
+		}
 		mk := tgbotapi.NewInlineKeyboardMarkup(rows...)
 		edit := tgbotapi.NewEditMessageText(chatID, state.MessageID, fmt.Sprintf("Сменить роль на «%s»?", humanRole(role)))
 		edit.ReplyMarkup = &mk
@@ -276,10 +294,10 @@ func HandleAdminUsersCallback(ctx context.Context, bot *tgbotapi.BotAPI, databas
 		return
 	}
 	// подтверждение (общий случай) ИЛИ подтверждение для student
-	if strings.HasPrefix(data, "admusr_apply_") || data == "admusr_apply_student" {
-		role := strings.TrimPrefix(data, "admusr_apply_")
-		if role == "" {
-			role = state.PendingRole
+	if cbAdmUserApply.Match(data) {
+		role, err := cbAdmUserApply.Parse(data)
+		if err != nil {
+			return
 		}
 		admin, _ := db.GetUserByTelegramID(ctx, database, chatID)
 		if admin == nil || admin.Role == nil || (*admin.Role != "admin") {
@@ -289,7 +307,6 @@ func HandleAdminUsersCallback(ctx context.Context, bot *tgbotapi.BotAPI, databas
 			return
 		}
 
-		var err error
 		if role == "student" || state.PendingRole == "student" {
 			err = db.ChangeRoleToStudentWithAudit(ctx, database, state.SelectedUserID, state.ClassNumber, state.ClassLetter, admin.ID)
 		} else {
@@ -305,8 +322,10 @@ func HandleAdminUsersCallback(ctx context.Context, bot *tgbotapi.BotAPI, databas
 		// уведомление пользователю
 		target, _ := db.GetUserByID(ctx, database, state.SelectedUserID)
 		txt := fmt.Sprintf("Ваша роль была изменена на «%s». Нажмите /start, чтобы обновить меню.", humanRole(role))
-		if _, err := tg.Send(bot, tgbotapi.NewMessage(target.TelegramID, txt)); err != nil {
-			metrics.HandlerErrors.Inc()
+		if !db.IsPlaceholderTelegramID(target.TelegramID) {
+			if _, err := tg.Send(bot, tgbotapi.NewMessage(target.TelegramID, txt)); err != nil {
+				metrics.HandlerErrors.Inc()
+			}
 		}
 
 		// ── РЕТРОСПЕКТИВА/АВТО-ДЕАКТИВАЦИЯ РОДИТЕЛЕЙ ─────────────────────────────
@@ -338,7 +357,7 @@ func HandleAdminUsersCallback(ctx context.Context, bot *tgbotapi.BotAPI, databas
 		if _, err := tg.Send(bot, edit); err != nil {
 			metrics.HandlerErrors.Inc()
 		}
-		delete(adminUsersStates, chatID)
+		adminUsersStates.Delete(ctx, chatID)
 		return
 	}
 
@@ -370,6 +389,7 @@ func HandleAdminUsersCallback(ctx context.Context, bot *tgbotapi.BotAPI, databas
 		// восстановить список найденных по state.query
 		users, _ := db.FindUsersByQuery(ctx, database, state.Query, 50)
 		text := fmt.Sprintf("Найдено %d пользователей. Выберите:", len(users))
+		var bs callback.Buttons
 		var rows [][]tgbotapi.InlineKeyboardButton
 		for _, u := range users {
 			labelRole := "(нет роли)"
@@ -380,13 +400,16 @@ func HandleAdminUsersCallback(ctx context.Context, bot *tgbotapi.BotAPI, databas
 			if u.ClassNumber != nil && u.ClassLetter != nil {
 				labelClass = fmt.Sprintf(" • %d%s", int(*u.ClassNumber), *u.ClassLetter)
 			}
-			btn := tgbotapi.NewInlineKeyboardButtonData(
+			btn := bs.Add(cbAdmUserPick.Button(
 				fmt.Sprintf("%s • %s%s", u.Name, labelRole, labelClass),
-				fmt.Sprintf("admusr_pick_%d", u.ID),
-			)
+				u.ID,
+			))
 			rows = append(rows, tgbotapi.NewInlineKeyboardRow(btn))
 		}
 		rows = append(rows, fsmutil.BackCancelRow("admusr_back_to_search", "admusr_cancel"))
+		if buttonsFailed(&bs) {
+			return
+		}
 		mk := tgbotapi.NewInlineKeyboardMarkup(rows...)
 		edit := tgbotapi.NewEditMessageText(chatID, state.MessageID, text)
 		edit.ReplyMarkup = &mk
@@ -415,7 +438,7 @@ func HandleAdminUsersCallback(ctx context.Context, bot *tgbotapi.BotAPI, databas
 		if _, err := tg.Send(bot, tgbotapi.NewEditMessageText(chatID, state.MessageID, "🚫 Отменено.")); err != nil {
 			metrics.HandlerErrors.Inc()
 		}
-		delete(adminUsersStates, chatID)
+		adminUsersStates.Delete(ctx, chatID)
 		return
 	}
 }
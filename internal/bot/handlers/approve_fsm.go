@@ -5,10 +5,9 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
-	"strconv"
-	"strings"
 	"time"
 
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
 	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmutil"
 	"github.com/Spok95/telegram-school-bot/internal/db"
 	"github.com/Spok95/telegram-school-bot/internal/metrics"
@@ -16,6 +15,12 @@ import (
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
+// Кнопки заявки (формат — см. пакет callback).
+var (
+	cbScoreConfirm = callback.NewAction1("score_confirm_", callback.ID) // scoreID
+	cbScoreReject  = callback.NewAction1("score_reject_", callback.ID)
+)
+
 // ShowPendingScores показывает администратору все заявки с status = 'pending'
 func ShowPendingScores(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, adminID int64) {
 	// запрет неактивным
@@ -59,8 +64,12 @@ func ShowPendingScores(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.
 		text := fmt.Sprintf("Заявка от %s\n👤 Ученик: %s\n🏫 Класс: %s\n📚 Категория: %s\n💯 Баллы: %d (%s)\n📝 Комментарий: %s",
 			creator.Name, student.Name, class, s.CategoryLabel, s.Points, s.Type, comment)
 
-		approveBtn := tgbotapi.NewInlineKeyboardButtonData("✅ Подтвердить", fmt.Sprintf("score_confirm_%d", s.ID))
-		rejectBtn := tgbotapi.NewInlineKeyboardButtonData("❌ Отклонить", fmt.Sprintf("score_reject_%d", s.ID))
+		var bs callback.Buttons
+		approveBtn := bs.Add(cbScoreConfirm.Button("✅ Подтвердить", s.ID))
+		rejectBtn := bs.Add(cbScoreReject.Button("❌ Отклонить", s.ID))
+		if buttonsFailed(&bs) {
+			continue
+		}
 		markup := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(approveBtn, rejectBtn))
 
 		msg := tgbotapi.NewMessage(adminID, text)
@@ -73,28 +82,29 @@ func ShowPendingScores(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.
 }
 
 // HandleScoreApprovalCallback обрабатывает нажатия на кнопки подтверждения/отклонения заявок
-func HandleScoreApprovalCallback(ctx context.Context, callback *tgbotapi.CallbackQuery, bot *tgbotapi.BotAPI, database *sql.DB, userID int64) {
-	data := callback.Data
-	var action, idStr string
+func HandleScoreApprovalCallback(ctx context.Context, cq *tgbotapi.CallbackQuery, bot *tgbotapi.BotAPI, database *sql.DB, userID int64) {
+	data := cq.Data
+	var action string
+	var scoreID int64
+	var err error
 
 	switch {
-	case strings.HasPrefix(data, "score_confirm_"):
+	case cbScoreConfirm.Match(data):
 		action = "approve"
-		idStr = strings.TrimPrefix(data, "score_confirm_")
-	case strings.HasPrefix(data, "score_reject_"):
+		scoreID, err = cbScoreConfirm.Parse(data)
+	case cbScoreReject.Match(data):
 		action = "reject"
-		idStr = strings.TrimPrefix(data, "score_reject_")
+		scoreID, err = cbScoreReject.Parse(data)
 	default:
 		return
 	}
-	scoreID, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
 		log.Println("неверный ID заявки:", err)
 		return
 	}
 
-	chatID := callback.Message.Chat.ID
-	messageID := callback.Message.MessageID
+	chatID := cq.Message.Chat.ID
+	messageID := cq.Message.MessageID
 	user, _ := db.GetUserByTelegramID(ctx, database, userID)
 
 	var resultText string
@@ -131,7 +141,7 @@ func HandleScoreApprovalCallback(ctx context.Context, callback *tgbotapi.Callbac
 		metrics.HandlerErrors.Inc()
 	}
 
-	if _, err := tg.Request(bot, tgbotapi.NewCallback(callback.ID, "Обработано")); err != nil {
+	if _, err := tg.Request(bot, tgbotapi.NewCallback(cq.ID, "Обработано")); err != nil {
 		metrics.HandlerErrors.Inc()
 	}
 }
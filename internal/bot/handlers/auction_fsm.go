@@ -10,6 +10,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmstore"
 	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmutil"
 	"github.com/Spok95/telegram-school-bot/internal/db"
 	"github.com/Spok95/telegram-school-bot/internal/metrics"
@@ -35,7 +37,15 @@ type AuctionFSMState struct {
 	PointsToRemove     int
 }
 
-var auctionStates = make(map[int64]*AuctionFSMState)
+// Кнопки с аргументом (формат — см. пакет callback).
+var (
+	cbAuctionMode        = callback.NewAction1("auction_mode_", callback.Word(8)) // "students" | "class"
+	cbAuctionClassNumber = callback.NewAction1("auction_class_number_", callback.Num)
+	cbAuctionClassLetter = callback.NewAction1("auction_class_letter_", callback.Word(8))
+	cbAuctionStudent     = callback.NewAction1("auction_select_student_", callback.ID)
+)
+
+var auctionStates = fsmstore.NewMap[*AuctionFSMState]("auction", 1, fsmstore.DefaultTTL)
 
 // ——— helpers ———
 
@@ -43,7 +53,7 @@ func auctionBackCancelRow() []tgbotapi.InlineKeyboardButton {
 	return fsmutil.BackCancelRow("auction_back", "auction_cancel")
 }
 
-func auctionClassNumberRowsFromDB(ctx context.Context, database *sql.DB, prefix string) [][]tgbotapi.InlineKeyboardButton {
+func auctionClassNumberRowsFromDB(ctx context.Context, database *sql.DB) [][]tgbotapi.InlineKeyboardButton {
 	classes, err := db.ListVisibleClasses(ctx, database)
 	if err != nil || len(classes) == 0 {
 		return [][]tgbotapi.InlineKeyboardButton{
@@ -62,18 +72,17 @@ func auctionClassNumberRowsFromDB(ctx context.Context, database *sql.DB, prefix
 	}
 	sort.Ints(nums)
 
+	var bs callback.Buttons
 	var rows [][]tgbotapi.InlineKeyboardButton
 	for _, n := range nums {
-		cb := fmt.Sprintf("%s%d", prefix, n)
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d класс", n), cb),
+			bs.Add(cbAuctionClassNumber.Button(fmt.Sprintf("%d класс", n), n)),
 		))
 	}
-	rows = append(rows, auctionBackCancelRow())
-	return rows
+	return auctionRows(&bs, rows)
 }
 
-func auctionClassLetterRowsFromDB(ctx context.Context, database *sql.DB, prefix string, number int64) [][]tgbotapi.InlineKeyboardButton {
+func auctionClassLetterRowsFromDB(ctx context.Context, database *sql.DB, number int64) [][]tgbotapi.InlineKeyboardButton {
 	classes, err := db.ListVisibleClasses(ctx, database)
 	if err != nil || len(classes) == 0 {
 		return [][]tgbotapi.InlineKeyboardButton{
@@ -81,18 +90,26 @@ func auctionClassLetterRowsFromDB(ctx context.Context, database *sql.DB, prefix
 		}
 	}
 
+	var bs callback.Buttons
 	var rows [][]tgbotapi.InlineKeyboardButton
 	for _, c := range classes {
 		if int64(c.Number) != number {
 			continue
 		}
-		cb := fmt.Sprintf("%s%s", prefix, strings.ToUpper(c.Letter))
+		letter := strings.ToUpper(c.Letter)
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(strings.ToUpper(c.Letter), cb),
+			bs.Add(cbAuctionClassLetter.Button(letter, letter)),
 		))
 	}
-	rows = append(rows, auctionBackCancelRow())
-	return rows
+	return auctionRows(&bs, rows)
+}
+
+// auctionRows дописывает «Назад/Отмена»; если кнопку не удалось закодировать — остаётся только она.
+func auctionRows(bs *callback.Buttons, rows [][]tgbotapi.InlineKeyboardButton) [][]tgbotapi.InlineKeyboardButton {
+	if buttonsFailed(bs) {
+		rows = nil
+	}
+	return append(rows, auctionBackCancelRow())
 }
 
 // ——— start ———
@@ -106,7 +123,7 @@ func StartAuctionFSM(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB
 		}
 		return
 	}
-	auctionStates[chatID] = &AuctionFSMState{Step: AuctionStepMode}
+	auctionStates.Set(ctx, chatID, &AuctionFSMState{Step: AuctionStepMode})
 
 	text := "Выберите режим аукциона:\n🧍 Ученики — списать с отдельных учеников\n🏫 Класс — списать со всего класса"
 	markup := tgbotapi.NewInlineKeyboardMarkup(
@@ -129,16 +146,17 @@ func StartAuctionFSM(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB
 
 func HandleAuctionCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, cq *tgbotapi.CallbackQuery) {
 	chatID := cq.Message.Chat.ID
-	state := auctionStates[chatID]
+	state := auctionStates.Value(chatID)
 	if state == nil {
 		return
 	}
+	defer auctionStates.Save(ctx, chatID)
 
 	data := cq.Data
 
 	// ❌ Отмена
 	if data == "auction_cancel" {
-		delete(auctionStates, chatID)
+		auctionStates.Delete(ctx, chatID)
 		fsmutil.DisableMarkup(bot, chatID, cq.Message.MessageID)
 		edit := tgbotapi.NewEditMessageText(chatID, cq.Message.MessageID, "🚫 Аукцион отменён.")
 		if _, err := tg.Send(bot, edit); err != nil {
@@ -169,7 +187,7 @@ func HandleAuctionCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *
 			return
 		case AuctionStepClassLetter:
 			state.Step = AuctionStepClassNumber
-			rows := auctionClassNumberRowsFromDB(ctx, database, "auction_class_number_")
+			rows := auctionClassNumberRowsFromDB(ctx, database)
 			mk := tgbotapi.NewInlineKeyboardMarkup(rows...)
 			edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, cq.Message.MessageID, "Выберите номер класса:", mk)
 			if _, err := tg.Send(bot, edit); err != nil {
@@ -178,7 +196,7 @@ func HandleAuctionCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *
 			return
 		case AuctionStepStudentSelect: // назад к букве
 			state.Step = AuctionStepClassLetter
-			rows := auctionClassLetterRowsFromDB(ctx, database, "auction_class_letter_", state.ClassNumber)
+			rows := auctionClassLetterRowsFromDB(ctx, database, state.ClassNumber)
 			mk := tgbotapi.NewInlineKeyboardMarkup(rows...)
 			edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, cq.Message.MessageID, "Выберите букву класса:", mk)
 			if _, err := tg.Send(bot, edit); err != nil {
@@ -191,7 +209,7 @@ func HandleAuctionCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *
 				promptStudentSelect(ctx, cq, bot, database)
 			} else {
 				state.Step = AuctionStepClassLetter
-				rows := auctionClassLetterRowsFromDB(ctx, database, "auction_class_letter_", state.ClassNumber)
+				rows := auctionClassLetterRowsFromDB(ctx, database, state.ClassNumber)
 				mk := tgbotapi.NewInlineKeyboardMarkup(rows...)
 				edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, cq.Message.MessageID, "Выберите букву класса:", mk)
 				if _, err := tg.Send(bot, edit); err != nil {
@@ -202,7 +220,7 @@ func HandleAuctionCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *
 
 		default:
 			// safety: отмена
-			delete(auctionStates, chatID)
+			auctionStates.Delete(ctx, chatID)
 			fsmutil.DisableMarkup(bot, chatID, cq.Message.MessageID)
 			edit := tgbotapi.NewEditMessageText(chatID, cq.Message.MessageID, "🚫 Аукцион отменён.")
 			if _, err := tg.Send(bot, edit); err != nil {
@@ -213,32 +231,41 @@ func HandleAuctionCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *
 	}
 
 	switch {
-	case strings.HasPrefix(data, "auction_mode_"):
-		state.Mode = strings.TrimPrefix(data, "auction_mode_")
+	case cbAuctionMode.Match(data):
+		mode, err := cbAuctionMode.Parse(data)
+		if err != nil {
+			return
+		}
+		state.Mode = mode
 		state.Step = AuctionStepClassNumber
 
-		rows := auctionClassNumberRowsFromDB(ctx, database, "auction_class_number_")
+		rows := auctionClassNumberRowsFromDB(ctx, database)
 		mk := tgbotapi.NewInlineKeyboardMarkup(rows...)
 		edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, cq.Message.MessageID, "Выберите номер класса:", mk)
 		if _, err := tg.Send(bot, edit); err != nil {
 			metrics.HandlerErrors.Inc()
 		}
 
-	case strings.HasPrefix(data, "auction_class_number_"):
-		numStr := strings.TrimPrefix(data, "auction_class_number_")
-		classNumber, _ := strconv.ParseInt(numStr, 10, 64)
-		state.ClassNumber = classNumber
+	case cbAuctionClassNumber.Match(data):
+		classNumber, err := cbAuctionClassNumber.Parse(data)
+		if err != nil {
+			return
+		}
+		state.ClassNumber = int64(classNumber)
 		state.Step = AuctionStepClassLetter
 
-		rows := auctionClassLetterRowsFromDB(ctx, database, "auction_class_letter_", classNumber)
+		rows := auctionClassLetterRowsFromDB(ctx, database, state.ClassNumber)
 		mk := tgbotapi.NewInlineKeyboardMarkup(rows...)
 		edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, cq.Message.MessageID, "Выберите букву класса:", mk)
 		if _, err := tg.Send(bot, edit); err != nil {
 			metrics.HandlerErrors.Inc()
 		}
 
-	case strings.HasPrefix(data, "auction_class_letter_"):
-		letter := strings.TrimPrefix(data, "auction_class_letter_")
+	case cbAuctionClassLetter.Match(data):
+		letter, err := cbAuctionClassLetter.Parse(data)
+		if err != nil {
+			return
+		}
 		state.ClassLetter = letter
 		if state.Mode == "students" {
 			state.Step = AuctionStepStudentSelect
@@ -250,7 +277,7 @@ func HandleAuctionCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *
 				if _, err := tg.Send(bot, edit); err != nil {
 					metrics.HandlerErrors.Inc()
 				}
-				delete(auctionStates, chatID)
+				auctionStates.Delete(ctx, chatID)
 				return
 			}
 			for _, s := range students {
@@ -260,9 +287,11 @@ func HandleAuctionCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *
 			promptPointsInput(cq, bot)
 		}
 
-	case strings.HasPrefix(data, "auction_select_student_"):
-		idStr := strings.TrimPrefix(data, "auction_select_student_")
-		id, _ := strconv.ParseInt(idStr, 10, 64)
+	case cbAuctionStudent.Match(data):
+		id, err := cbAuctionStudent.Parse(data)
+		if err != nil {
+			return
+		}
 		// toggle
 		found := false
 		for i, existing := range state.SelectedStudentIDs {
@@ -293,14 +322,15 @@ func HandleAuctionCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *
 
 func HandleAuctionText(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, msg *tgbotapi.Message) {
 	chatID := msg.Chat.ID
-	state := auctionStates[chatID]
+	state := auctionStates.Value(chatID)
 	if state == nil || state.Step != AuctionStepPoints {
 		return
 	}
+	defer auctionStates.Save(ctx, chatID)
 
 	// текстовая отмена
 	if fsmutil.IsCancelText(msg.Text) {
-		delete(auctionStates, chatID)
+		auctionStates.Delete(ctx, chatID)
 		if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "🚫 Аукцион отменён.")); err != nil {
 			metrics.HandlerErrors.Inc()
 		}
@@ -356,7 +386,7 @@ func HandleAuctionText(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.
 		if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, text)); err != nil {
 			metrics.HandlerErrors.Inc()
 		}
-		delete(auctionStates, chatID)
+		auctionStates.Delete(ctx, chatID)
 		return
 	}
 	if len(eligible) == 0 {
@@ -367,7 +397,7 @@ func HandleAuctionText(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.
 		if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, text)); err != nil {
 			metrics.HandlerErrors.Inc()
 		}
-		delete(auctionStates, chatID)
+		auctionStates.Delete(ctx, chatID)
 		return
 	}
 	user, err := db.GetUserByTelegramID(ctx, database, chatID)
@@ -414,16 +444,17 @@ func HandleAuctionText(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.
 	if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, msgOut)); err != nil {
 		metrics.HandlerErrors.Inc()
 	}
-	delete(auctionStates, chatID)
+	auctionStates.Delete(ctx, chatID)
 }
 
 // ——— menus (edit current message) ———
 
 func promptStudentSelect(ctx context.Context, cq *tgbotapi.CallbackQuery, bot *tgbotapi.BotAPI, database *sql.DB) {
 	chatID := cq.Message.Chat.ID
-	state := auctionStates[chatID]
+	state := auctionStates.Value(chatID)
 	students, _ := db.GetStudentsByClass(ctx, database, state.ClassNumber, state.ClassLetter)
 
+	var bs callback.Buttons
 	var rows [][]tgbotapi.InlineKeyboardButton
 	for _, student := range students {
 		selected := ""
@@ -434,13 +465,15 @@ func promptStudentSelect(ctx context.Context, cq *tgbotapi.CallbackQuery, bot *t
 			}
 		}
 		label := fmt.Sprintf("%s%s", student.Name, selected)
-		cbData := fmt.Sprintf("auction_select_student_%d", student.ID)
-		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(label, cbData)))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(bs.Add(cbAuctionStudent.Button(label, student.ID))))
 	}
 	if len(state.SelectedStudentIDs) > 0 {
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("Готово", "auction_students_done")))
 	}
 	rows = append(rows, auctionBackCancelRow())
+	if buttonsFailed(&bs) {
+		return
+	}
 
 	edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, cq.Message.MessageID, "👥 Выберите учеников для аукциона:", tgbotapi.NewInlineKeyboardMarkup(rows...))
 	if _, err := tg.Send(bot, edit); err != nil {
@@ -465,5 +498,5 @@ func promptPointsInput(cq *tgbotapi.CallbackQuery, bot *tgbotapi.BotAPI) {
 // ——— accessors ———
 
 func GetAuctionState(userID int64) *AuctionFSMState {
-	return auctionStates[userID]
+	return auctionStates.Value(userID)
 }
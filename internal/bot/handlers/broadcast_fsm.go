@@ -0,0 +1,757 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmstore"
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmutil"
+	"github.com/Spok95/telegram-school-bot/internal/broadcast"
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/metrics"
+	"github.com/Spok95/telegram-school-bot/internal/models"
+	"github.com/Spok95/telegram-school-bot/internal/tg"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// «📨 Рассылки»: администрация выбирает аудиторию (классы, параллель, роль или
+// сотрудников), пишет текст (можно с фото или файлом), видит число получателей
+// и отправляет сразу или в назначенное время. Сообщения уходят через outbox,
+// а по каждой рассылке доступен отчёт о доставке.
+
+const (
+	bcStepText     = "text"
+	bcStepSchedule = "schedule"
+
+	bcListLimit    = 10
+	bcMaxText      = 4096
+	bcMaxCaption   = 1024
+	bcScheduleForm = "02.01.2006 15:04"
+)
+
+type broadcastState struct {
+	Step      string // "" — выбор кнопками, bcStepText / bcStepSchedule — ждём ввод
+	MessageID int
+
+	Audience db.BroadcastAudience
+	Parallel int // выбранная параллель для вида «parallel»
+	Number   int // параллель, классы которой сейчас на экране
+
+	Text             string
+	AttachmentType   string
+	AttachmentFileID string
+}
+
+var broadcastStates = fsmstore.NewMap[*broadcastState]("broadcast", 1, fsmstore.DefaultTTL)
+
+// BroadcastAwaitsInput — ждём текст рассылки или время отправки.
+func BroadcastAwaitsInput(chatID int64) bool {
+	st := broadcastStates.Value(chatID)
+	return st != nil && st.Step != ""
+}
+
+// HandleBroadcasts — кнопка «📨 Рассылки»: последние рассылки и создание новой.
+func HandleBroadcasts(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, chatID int64) {
+	text, mk, err := broadcastListView(ctx, database)
+	if err != nil {
+		log.Println("broadcasts:", err)
+		bcReply(bot, chatID, "❌ Не удалось загрузить рассылки.")
+		return
+	}
+	m := tgbotapi.NewMessage(chatID, text)
+	m.ReplyMarkup = mk
+	if _, err := tg.Send(bot, m); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
+
+// HandleBroadcastCallback — кнопки мастера рассылки и отчёта.
+func HandleBroadcastCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, user *models.User, cb *tgbotapi.CallbackQuery) {
+	chatID := cb.Message.Chat.ID
+	msgID := cb.Message.MessageID
+	data := cb.Data
+	st := broadcastStates.Value(chatID)
+
+	save := func() {
+		broadcastStates.Set(ctx, chatID, st)
+		broadcastStates.Save(ctx, chatID)
+	}
+
+	switch {
+	case data == "bc_close":
+		broadcastStates.Delete(ctx, chatID)
+		fsmutil.DisableMarkup(bot, chatID, msgID)
+		return
+
+	case data == "bc_cancel":
+		broadcastStates.Delete(ctx, chatID)
+		bcEdit(bot, chatID, msgID, "🚫 Рассылка отменена.", nil)
+		return
+
+	case data == "bc_list":
+		broadcastStates.Delete(ctx, chatID)
+		text, mk, err := broadcastListView(ctx, database)
+		if err != nil {
+			log.Println("broadcasts:", err)
+			bcAlert(bot, cb.ID, "Не удалось загрузить рассылки")
+			return
+		}
+		bcEdit(bot, chatID, msgID, text, &mk)
+		return
+
+	case cbBcView.Match(data):
+		id, err := cbBcView.Parse(data)
+		if err != nil {
+			return
+		}
+		bcShowReport(ctx, bot, database, cb.ID, chatID, msgID, id)
+		return
+
+	case cbBcStop.Match(data):
+		id, err := cbBcStop.Parse(data)
+		if err != nil {
+			return
+		}
+		if err := db.CancelBroadcast(ctx, database, id); err != nil {
+			if errors.Is(err, db.ErrBroadcastNotPending) {
+				bcAlert(bot, cb.ID, "Рассылка уже отправлена")
+			} else {
+				log.Println("broadcasts:", err)
+				bcAlert(bot, cb.ID, "Не удалось отменить рассылку")
+			}
+		}
+		bcShowReport(ctx, bot, database, cb.ID, chatID, msgID, id)
+		return
+
+	case data == "bc_new":
+		st = &broadcastState{MessageID: msgID}
+		save()
+		bcEdit(bot, chatID, msgID, "📨 Новая рассылка\nКому отправить?", ptrMarkup(bcKindMarkup()))
+		return
+	}
+
+	// дальше — шаги мастера; без состояния они устарели
+	if st == nil {
+		fsmutil.DisableMarkup(bot, chatID, msgID)
+		return
+	}
+	st.MessageID = msgID
+
+	var bs callback.Buttons
+	switch {
+	case data == "bc_kind":
+		st.Step = ""
+		st.Audience = db.BroadcastAudience{}
+		save()
+		bcEdit(bot, chatID, msgID, "📨 Новая рассылка\nКому отправить?", ptrMarkup(bcKindMarkup()))
+
+	case data == "bc_kind:staff":
+		st.Audience = db.BroadcastAudience{Kind: db.AudienceStaff}
+		bcAskText(ctx, bot, st, chatID)
+
+	case data == "bc_kind:role":
+		st.Audience = db.BroadcastAudience{Kind: db.AudienceRole}
+		save()
+		mk := bcRoleMarkup(&bs)
+		if buttonsFailed(&bs) {
+			return
+		}
+		bcEdit(bot, chatID, msgID, "👤 Какой роли отправить?", &mk)
+
+	case cbBcRole.Match(data):
+		role, err := cbBcRole.Parse(data)
+		if err != nil || !slices.Contains(bcRoles, models.Role(role)) {
+			return
+		}
+		st.Audience = db.BroadcastAudience{Kind: db.AudienceRole, Role: role}
+		bcAskText(ctx, bot, st, chatID)
+
+	case data == "bc_kind:classes", data == "bc_kind:parallel":
+		parallel := data == "bc_kind:parallel"
+		st.Audience = db.BroadcastAudience{Kind: db.AudienceClasses}
+		st.Parallel, st.Number = 0, 0
+		if parallel {
+			st.Parallel = -1 // ждём выбор параллели
+		}
+		save()
+		bcShowNumbers(ctx, bot, database, st, chatID, cb.ID)
+
+	case data == "bc_numbers":
+		st.Number = 0
+		save()
+		bcShowNumbers(ctx, bot, database, st, chatID, cb.ID)
+
+	case cbBcNum.Match(data):
+		n, err := cbBcNum.Parse(data)
+		if err != nil {
+			return
+		}
+		classes, err := db.ListClassesByNumber(ctx, database, n)
+		if err != nil {
+			log.Println("broadcasts:", err)
+			bcAlert(bot, cb.ID, "Не удалось загрузить классы")
+			return
+		}
+		if st.Parallel != 0 {
+			// вся параллель сразу
+			st.Parallel = n
+			st.Audience.ClassIDs = st.Audience.ClassIDs[:0]
+			for _, c := range classes {
+				st.Audience.ClassIDs = append(st.Audience.ClassIDs, c.ID)
+			}
+			save()
+			mk := bcWhoMarkup(&bs, "bc_numbers")
+			if buttonsFailed(&bs) {
+				return
+			}
+			bcEdit(bot, chatID, msgID, fmt.Sprintf("🔢 %d-е классы. Кому отправить?", n), &mk)
+			return
+		}
+		st.Number = n
+		save()
+		mk := bcLettersMarkup(&bs, st, classes)
+		if buttonsFailed(&bs) {
+			return
+		}
+		bcEdit(bot, chatID, msgID, bcClassesPrompt(st), &mk)
+
+	case cbBcClass.Match(data):
+		id, err := cbBcClass.Parse(data)
+		if err != nil || st.Number == 0 {
+			return
+		}
+		if i := slices.Index(st.Audience.ClassIDs, id); i >= 0 {
+			st.Audience.ClassIDs = slices.Delete(st.Audience.ClassIDs, i, i+1)
+		} else {
+			st.Audience.ClassIDs = append(st.Audience.ClassIDs, id)
+		}
+		save()
+		classes, err := db.ListClassesByNumber(ctx, database, st.Number)
+		if err != nil {
+			log.Println("broadcasts:", err)
+			return
+		}
+		mk := bcLettersMarkup(&bs, st, classes)
+		if buttonsFailed(&bs) {
+			return
+		}
+		bcEdit(bot, chatID, msgID, bcClassesPrompt(st), &mk)
+
+	case data == "bc_cls_done":
+		if len(st.Audience.ClassIDs) == 0 {
+			bcAlert(bot, cb.ID, "Выберите хотя бы один класс")
+			return
+		}
+		save()
+		mk := bcWhoMarkup(&bs, "bc_numbers")
+		if buttonsFailed(&bs) {
+			return
+		}
+		bcEdit(bot, chatID, msgID, "🏫 Кому из выбранных классов отправить?", &mk)
+
+	case cbBcWho.Match(data):
+		who, err := cbBcWho.Parse(data)
+		if err != nil {
+			return
+		}
+		if who != db.WhoStudents && who != db.WhoParents && who != db.WhoBoth {
+			return
+		}
+		if len(st.Audience.ClassIDs) == 0 {
+			return
+		}
+		st.Audience.Who = who
+		bcAskText(ctx, bot, st, chatID)
+
+	case data == "bc_edit":
+		bcAskText(ctx, bot, st, chatID)
+
+	case data == "bc_schedule":
+		st.Step = bcStepSchedule
+		save()
+		back := tgbotapi.NewInlineKeyboardMarkup(fsmutil.BackCancelRow("bc_preview", "bc_cancel"))
+		bcEdit(bot, chatID, msgID, "🕒 Когда отправить? Введите дату и время в формате ДД.ММ.ГГГГ ЧЧ:ММ, например "+
+			time.Now().Add(24*time.Hour).Format("02.01.2006")+" 09:00.", &back)
+
+	case data == "bc_preview":
+		st.Step = ""
+		save()
+		bcShowPreview(ctx, bot, database, st, chatID, msgID)
+
+	case data == "bc_send":
+		if st.Text == "" && st.AttachmentFileID == "" {
+			return
+		}
+		bcCreate(ctx, bot, database, user, st, chatID, time.Now())
+	}
+}
+
+// HandleBroadcastInput — текст рассылки (с фото или файлом) или время отправки.
+func HandleBroadcastInput(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, user *models.User, msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	st := broadcastStates.Value(chatID)
+	if st == nil {
+		return
+	}
+	if fsmutil.IsCancelText(msg.Text) {
+		fsmutil.DisableMarkup(bot, chatID, st.MessageID)
+		broadcastStates.Delete(ctx, chatID)
+		bcReply(bot, chatID, "🚫 Рассылка отменена.")
+		return
+	}
+
+	switch st.Step {
+	case bcStepText:
+		text, attType, fileID := msg.Text, "", ""
+		switch {
+		case len(msg.Photo) > 0:
+			text, attType, fileID = msg.Caption, "photo", msg.Photo[len(msg.Photo)-1].FileID
+		case msg.Document != nil:
+			text, attType, fileID = msg.Caption, "document", msg.Document.FileID
+		}
+		text = strings.TrimSpace(text)
+		if text == "" && fileID == "" {
+			bcReply(bot, chatID, "⚠️ Отправьте текст рассылки, фото или файл с подписью.")
+			return
+		}
+		limit := bcMaxText
+		if fileID != "" {
+			limit = bcMaxCaption
+		}
+		if utf8.RuneCountInString(text) > limit {
+			bcReply(bot, chatID, fmt.Sprintf("⚠️ Слишком длинный текст: не больше %d символов.", limit))
+			return
+		}
+		st.Text, st.AttachmentType, st.AttachmentFileID = text, attType, fileID
+
+	case bcStepSchedule:
+		at, err := time.ParseInLocation(bcScheduleForm, strings.TrimSpace(msg.Text), time.Local)
+		if err != nil {
+			bcReply(bot, chatID, "⚠️ Не понял время. Формат: ДД.ММ.ГГГГ ЧЧ:ММ, например 01.09.2026 09:00.")
+			return
+		}
+		if !at.After(time.Now()) {
+			bcReply(bot, chatID, "⚠️ Это время уже прошло — укажите время в будущем.")
+			return
+		}
+		fsmutil.DisableMarkup(bot, chatID, st.MessageID)
+		bcCreate(ctx, bot, database, user, st, chatID, at)
+		return
+
+	default:
+		return
+	}
+
+	// превью — новым сообщением под введённым текстом
+	fsmutil.DisableMarkup(bot, chatID, st.MessageID)
+	st.Step = ""
+	m, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "⏳ Считаю получателей…"))
+	if err != nil {
+		metrics.HandlerErrors.Inc()
+		return
+	}
+	st.MessageID = m.MessageID
+	broadcastStates.Set(ctx, chatID, st)
+	broadcastStates.Save(ctx, chatID)
+	bcShowPreview(ctx, bot, database, st, chatID, m.MessageID)
+}
+
+// bcRoles — роли, которым можно отправить рассылку целиком.
+// Кнопки мастера с аргументом (формат — см. пакет callback).
+var (
+	cbBcView  = callback.NewAction1("bc_view:", callback.ID)       // broadcastID
+	cbBcStop  = callback.NewAction1("bc_stop:", callback.ID)       // broadcastID
+	cbBcRole  = callback.NewAction1("bc_role:", callback.Word(14)) // models.Role
+	cbBcNum   = callback.NewAction1("bc_num:", callback.Num)       // параллель
+	cbBcClass = callback.NewAction1("bc_cls:", callback.ID)        // classID
+	cbBcWho   = callback.NewAction1("bc_who:", callback.Word(8))   // db.Who*
+)
+
+var bcRoles = []models.Role{models.Student, models.Parent, models.Teacher, models.Administration, models.Admin}
+
+func bcAskText(ctx context.Context, bot *tgbotapi.BotAPI, st *broadcastState, chatID int64) {
+	st.Step = bcStepText
+	broadcastStates.Set(ctx, chatID, st)
+	broadcastStates.Save(ctx, chatID)
+	back := tgbotapi.NewInlineKeyboardMarkup(fsmutil.BackCancelRow("bc_kind", "bc_cancel"))
+	bcEdit(bot, chatID, st.MessageID, "✏️ Получатели: "+bcAudienceLabel(st, nil)+
+		"\n\nОтправьте текст рассылки. Можно прислать фото или файл — подпись к нему станет текстом.", &back)
+}
+
+func bcShowNumbers(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, st *broadcastState, chatID int64, cbID string) {
+	nums, err := db.ListClassNumbers(ctx, database)
+	if err != nil {
+		log.Println("broadcasts:", err)
+		bcAlert(bot, cbID, "Не удалось загрузить классы")
+		return
+	}
+	var bs callback.Buttons
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var row []tgbotapi.InlineKeyboardButton
+	for _, n := range nums {
+		row = append(row, bs.Add(cbBcNum.Button(fmt.Sprint(n), n)))
+		if len(row) == 6 {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+	text := "🔢 Выберите параллель:"
+	if st.Parallel == 0 {
+		text = bcClassesPrompt(st) + "\nВыберите параллель, затем буквы классов."
+		if n := len(st.Audience.ClassIDs); n > 0 {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("✅ Готово (%d)", n), "bc_cls_done")))
+		}
+	}
+	rows = append(rows, fsmutil.BackCancelRow("bc_kind", "bc_cancel"))
+	if buttonsFailed(&bs) {
+		return
+	}
+	bcEdit(bot, chatID, st.MessageID, text, ptrMarkup(tgbotapi.NewInlineKeyboardMarkup(rows...)))
+}
+
+func bcClassesPrompt(st *broadcastState) string {
+	return fmt.Sprintf("🏫 Выбрано классов: %d", len(st.Audience.ClassIDs))
+}
+
+func bcLettersMarkup(bs *callback.Buttons, st *broadcastState, classes []db.Class) tgbotapi.InlineKeyboardMarkup {
+	var row []tgbotapi.InlineKeyboardButton
+	for _, c := range classes {
+		label := fmt.Sprintf("%d%s", c.Number, c.Letter)
+		if slices.Contains(st.Audience.ClassIDs, c.ID) {
+			label = "✅ " + label
+		}
+		row = append(row, bs.Add(cbBcClass.Button(label, c.ID)))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(
+		row,
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("➕ Другая параллель", "bc_numbers"),
+			tgbotapi.NewInlineKeyboardButtonData("✅ Готово", "bc_cls_done"),
+		),
+		fsmutil.BackCancelRow("bc_numbers", "bc_cancel"),
+	)
+}
+
+func bcKindMarkup() tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🏫 Классы", "bc_kind:classes"),
+			tgbotapi.NewInlineKeyboardButtonData("🔢 Параллель", "bc_kind:parallel"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("👤 Роль", "bc_kind:role"),
+			tgbotapi.NewInlineKeyboardButtonData("👔 Сотрудники", "bc_kind:staff"),
+		),
+		fsmutil.BackCancelRow("bc_list", "bc_cancel"),
+	)
+}
+
+func bcRoleMarkup(bs *callback.Buttons) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, r := range bcRoles {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			bs.Add(cbBcRole.Button(bcRoleTitle(r), string(r)))))
+	}
+	rows = append(rows, fsmutil.BackCancelRow("bc_kind", "bc_cancel"))
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func bcWhoMarkup(bs *callback.Buttons, back string) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			bs.Add(cbBcWho.Button("🎒 Ученикам", db.WhoStudents)),
+			bs.Add(cbBcWho.Button("👪 Родителям", db.WhoParents)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			bs.Add(cbBcWho.Button("👥 Ученикам и родителям", db.WhoBoth)),
+		),
+		fsmutil.BackCancelRow(back, "bc_cancel"),
+	)
+}
+
+// bcRoleTitle — роль во множественном числе для подписи аудитории.
+func bcRoleTitle(r models.Role) string {
+	switch r {
+	case models.Student:
+		return "Ученики"
+	case models.Parent:
+		return "Родители"
+	case models.Teacher:
+		return "Учителя"
+	case models.Administration:
+		return "Администрация"
+	case models.Admin:
+		return "Админы"
+	}
+	return string(r)
+}
+
+// bcAudienceLabel — подпись аудитории для превью и отчёта. classes — выбранные классы
+// (нужны для вида «классы», если не заданы — выводится их количество).
+func bcAudienceLabel(st *broadcastState, classes []db.Class) string {
+	a := st.Audience
+	var who string
+	switch a.Who {
+	case db.WhoStudents:
+		who = " — ученики"
+	case db.WhoParents:
+		who = " — родители"
+	case db.WhoBoth:
+		who = " — ученики и родители"
+	}
+	switch a.Kind {
+	case db.AudienceStaff:
+		return "сотрудники (учителя, администрация, админы)"
+	case db.AudienceRole:
+		return "все: " + strings.ToLower(bcRoleTitle(models.Role(a.Role)))
+	case db.AudienceClasses:
+		if st.Parallel > 0 {
+			return fmt.Sprintf("%d-е классы%s", st.Parallel, who)
+		}
+		if len(classes) == 0 {
+			return fmt.Sprintf("классов: %d%s", len(a.ClassIDs), who)
+		}
+		names := make([]string, 0, len(classes))
+		for _, c := range classes {
+			names = append(names, fmt.Sprintf("%d%s", c.Number, c.Letter))
+		}
+		return strings.Join(names, ", ") + who
+	}
+	return "—"
+}
+
+func bcSelectedClasses(ctx context.Context, database *sql.DB, ids []int64) ([]db.Class, error) {
+	out := make([]db.Class, 0, len(ids))
+	for _, id := range ids {
+		c, err := db.GetClassByID(ctx, database, id)
+		if err != nil {
+			return nil, err
+		}
+		if c != nil {
+			out = append(out, *c)
+		}
+	}
+	slices.SortFunc(out, func(a, b db.Class) int {
+		if a.Number != b.Number {
+			return a.Number - b.Number
+		}
+		return strings.Compare(a.Letter, b.Letter)
+	})
+	return out, nil
+}
+
+func bcShowPreview(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, st *broadcastState, chatID int64, msgID int) {
+	recipients, err := db.BroadcastRecipients(ctx, database, st.Audience)
+	if err == nil {
+		var classes []db.Class
+		if classes, err = bcSelectedClasses(ctx, database, st.Audience.ClassIDs); err == nil {
+			blocked := 0
+			for _, r := range recipients {
+				if r.Blocked {
+					blocked++
+				}
+			}
+			var b strings.Builder
+			b.WriteString("📨 Проверьте рассылку\n\n")
+			fmt.Fprintf(&b, "Кому: %s\nПолучателей: %d", bcAudienceLabel(st, classes), len(recipients))
+			if blocked > 0 {
+				fmt.Fprintf(&b, " (из них %d заблокировали бота)", blocked)
+			}
+			switch st.AttachmentType {
+			case "photo":
+				b.WriteString("\nВложение: 🖼 фото")
+			case "document":
+				b.WriteString("\nВложение: 📎 файл")
+			}
+			b.WriteString("\n\n" + st.Text)
+
+			mk := tgbotapi.NewInlineKeyboardMarkup(
+				tgbotapi.NewInlineKeyboardRow(
+					tgbotapi.NewInlineKeyboardButtonData("🚀 Отправить сейчас", "bc_send"),
+					tgbotapi.NewInlineKeyboardButtonData("🕒 Запланировать", "bc_schedule"),
+				),
+				tgbotapi.NewInlineKeyboardRow(
+					tgbotapi.NewInlineKeyboardButtonData("✏️ Изменить текст", "bc_edit"),
+					tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", "bc_cancel"),
+				),
+			)
+			if len(recipients) == 0 {
+				b.WriteString("\n\n⚠️ В аудитории нет ни одного получателя.")
+				mk = tgbotapi.NewInlineKeyboardMarkup(fsmutil.BackCancelRow("bc_kind", "bc_cancel"))
+			}
+			bcEdit(bot, chatID, msgID, b.String(), &mk)
+			return
+		}
+	}
+	log.Println("broadcasts:", err)
+	bcEdit(bot, chatID, msgID, "❌ Не удалось посчитать получателей.", nil)
+}
+
+// bcCreate сохраняет рассылку; время в прошлом — отправка сразу.
+func bcCreate(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, user *models.User, st *broadcastState, chatID int64, at time.Time) {
+	classes, err := bcSelectedClasses(ctx, database, st.Audience.ClassIDs)
+	if err != nil {
+		log.Println("broadcasts:", err)
+		bcReply(bot, chatID, "❌ Не удалось сохранить рассылку.")
+		return
+	}
+	b := db.Broadcast{
+		CreatedBy:        user.ID,
+		Audience:         st.Audience,
+		AudienceLabel:    bcAudienceLabel(st, classes),
+		Text:             st.Text,
+		AttachmentType:   st.AttachmentType,
+		AttachmentFileID: st.AttachmentFileID,
+		ScheduledAt:      at,
+	}
+	id, err := db.CreateBroadcast(ctx, database, b)
+	if err != nil {
+		log.Println("broadcasts:", err)
+		bcReply(bot, chatID, "❌ Не удалось сохранить рассылку.")
+		return
+	}
+	msgID := st.MessageID
+	broadcastStates.Delete(ctx, chatID)
+
+	if at.After(time.Now()) {
+		// запланированную отправит фоновая задача; карточка — новым сообщением под введённым временем
+		bcShowReport(ctx, bot, database, "", chatID, 0, id)
+		return
+	}
+	if _, err := broadcast.Queue(ctx, database, id); err != nil {
+		// рассылка сохранена — её подхватит фоновая задача
+		log.Println("broadcasts: queue:", err)
+	}
+	bcShowReport(ctx, bot, database, "", chatID, msgID, id)
+}
+
+// bcShowReport показывает рассылку с итогами доставки; msgID == 0 — новым сообщением.
+func bcShowReport(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, cbID string, chatID int64, msgID int, id int64) {
+	b, err := db.GetBroadcast(ctx, database, id)
+	var rep db.BroadcastReport
+	if err == nil && b != nil {
+		rep, err = db.GetBroadcastReport(ctx, database, id)
+	}
+	if err != nil || b == nil {
+		if err != nil {
+			log.Println("broadcasts:", err)
+		}
+		if cbID != "" {
+			bcAlert(bot, cbID, "Рассылка не найдена")
+		}
+		return
+	}
+
+	text := broadcastReportText(*b, rep)
+	var bs callback.Buttons
+	rows := [][]tgbotapi.InlineKeyboardButton{}
+	if b.QueuedAt == nil && b.CancelledAt == nil {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			bs.Add(cbBcStop.Button("🛑 Отменить рассылку", b.ID))))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		bs.Add(cbBcView.Button("🔄 Обновить", b.ID)),
+		tgbotapi.NewInlineKeyboardButtonData("⬅️ К рассылкам", "bc_list"),
+	))
+	if buttonsFailed(&bs) {
+		return
+	}
+	mk := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	if msgID == 0 {
+		m := tgbotapi.NewMessage(chatID, text)
+		m.ReplyMarkup = mk
+		if _, err := tg.Send(bot, m); err != nil {
+			metrics.HandlerErrors.Inc()
+		}
+		return
+	}
+	bcEdit(bot, chatID, msgID, text, &mk)
+}
+
+func broadcastReportText(b db.Broadcast, rep db.BroadcastReport) string {
+	var s strings.Builder
+	fmt.Fprintf(&s, "📨 Рассылка #%d\nКому: %s\n", b.ID, b.AudienceLabel)
+	switch {
+	case b.CancelledAt != nil:
+		s.WriteString("Статус: 🛑 отменена")
+	case b.QueuedAt == nil:
+		fmt.Fprintf(&s, "Статус: 🕒 запланирована на %s", b.ScheduledAt.In(time.Local).Format(bcScheduleForm))
+	default:
+		fmt.Fprintf(&s, "Статус: отправлена %s\nПолучателей: %d\n\n✅ Доставлено: %d\n⏳ В очереди: %d\n🚫 Заблокировали бота: %d\n❌ Не доставлено: %d",
+			b.QueuedAt.In(time.Local).Format(bcScheduleForm), b.Recipients, rep.Sent, rep.Pending, rep.Blocked, rep.Failed)
+	}
+	s.WriteString("\n\n" + bcShort(b.Text, 300))
+	return s.String()
+}
+
+func broadcastListView(ctx context.Context, database *sql.DB) (string, tgbotapi.InlineKeyboardMarkup, error) {
+	list, err := db.ListBroadcasts(ctx, database, bcListLimit)
+	if err != nil {
+		return "", tgbotapi.InlineKeyboardMarkup{}, err
+	}
+	text := "📨 Рассылки"
+	if len(list) == 0 {
+		text += "\n\nРассылок пока не было."
+	}
+	var bs callback.Buttons
+	rows := [][]tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("➕ Новая рассылка", "bc_new")),
+	}
+	for _, b := range list {
+		mark := "✅"
+		switch {
+		case b.CancelledAt != nil:
+			mark = "🛑"
+		case b.QueuedAt == nil:
+			mark = "🕒"
+		}
+		label := fmt.Sprintf("%s #%d %s · %s", mark, b.ID, b.ScheduledAt.In(time.Local).Format("02.01 15:04"), bcShort(b.AudienceLabel, 30))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			bs.Add(cbBcView.Button(label, b.ID))))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("✖️ Закрыть", "bc_close")))
+	return text, tgbotapi.NewInlineKeyboardMarkup(rows...), bs.Err()
+}
+
+// bcShort обрезает строку до n символов.
+func bcShort(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
+
+func ptrMarkup(mk tgbotapi.InlineKeyboardMarkup) *tgbotapi.InlineKeyboardMarkup { return &mk }
+
+func bcEdit(bot *tgbotapi.BotAPI, chatID int64, msgID int, text string, mk *tgbotapi.InlineKeyboardMarkup) {
+	edit := tgbotapi.NewEditMessageText(chatID, msgID, text)
+	edit.ReplyMarkup = mk
+	if _, err := tg.Send(bot, edit); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
+
+func bcAlert(bot *tgbotapi.BotAPI, cbID, text string) {
+	if _, err := tg.Request(bot, tgbotapi.NewCallback(cbID, text)); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
+
+func bcReply(bot *tgbotapi.BotAPI, chatID int64, text string) {
+	if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, text)); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
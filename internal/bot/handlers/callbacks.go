@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"log"
+
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
+	"github.com/Spok95/telegram-school-bot/internal/metrics"
+	"github.com/Spok95/telegram-school-bot/internal/observability"
+)
+
+// buttonsFailed — кнопку не удалось закодировать: пишем ошибку и не отправляем клавиатуру.
+func buttonsFailed(bs *callback.Buttons) bool {
+	err := bs.Err()
+	if err == nil {
+		return false
+	}
+	log.Println("callback:", err)
+	observability.CaptureErr(err)
+	metrics.HandlerErrors.Inc()
+	return true
+}
@@ -6,10 +6,11 @@ import (
 	"fmt"
 	"log"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmstore"
 	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmutil"
 	"github.com/Spok95/telegram-school-bot/internal/db"
 	"github.com/Spok95/telegram-school-bot/internal/metrics"
@@ -42,9 +43,19 @@ type ExportFSMState struct {
 	SelectedStudentIDs []int64
 }
 
-var exportStates = make(map[int64]*ExportFSMState)
+// Кнопки с аргументом (формат — см. пакет callback).
+var (
+	cbExportType        = callback.NewAction1("export_type_", callback.Word(7)) // "student" | "class" | "school"
+	cbExportPeriod      = callback.NewAction1("export_period_", callback.ID)
+	cbExportClassNumber = callback.NewAction1("export_class_number_", callback.Num)
+	cbExportClassLetter = callback.NewAction1("export_class_letter_", callback.Word(8))
+	cbExportStudent     = callback.NewAction1("export_select_student_", callback.ID)
+	cbExportSchoolYear  = callback.NewAction1("export_schoolyear_", callback.Num) // год начала
+)
+
+var exportStates = fsmstore.NewMap[*ExportFSMState]("export", 1, fsmstore.DefaultTTL)
 
-func exportClassNumberRowsFromDB(ctx context.Context, database *sql.DB, prefix string) [][]tgbotapi.InlineKeyboardButton {
+func exportClassNumberRowsFromDB(ctx context.Context, database *sql.DB) [][]tgbotapi.InlineKeyboardButton {
 	classes, err := db.ListVisibleClasses(ctx, database)
 	if err != nil || len(classes) == 0 {
 		return [][]tgbotapi.InlineKeyboardButton{
@@ -62,18 +73,17 @@ func exportClassNumberRowsFromDB(ctx context.Context, database *sql.DB, prefix s
 	}
 	sort.Ints(nums)
 
+	var bs callback.Buttons
 	var rows [][]tgbotapi.InlineKeyboardButton
 	for _, n := range nums {
-		cb := fmt.Sprintf("%s%d", prefix, n)
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d класс", n), cb),
+			bs.Add(cbExportClassNumber.Button(fmt.Sprintf("%d класс", n), n)),
 		))
 	}
-	rows = append(rows, fsmutil.BackCancelRow("export_back", "export_cancel"))
-	return rows
+	return exportRows(&bs, rows)
 }
 
-func exportClassLetterRowsFromDB(ctx context.Context, database *sql.DB, prefix string, number int64) [][]tgbotapi.InlineKeyboardButton {
+func exportClassLetterRowsFromDB(ctx context.Context, database *sql.DB, number int64) [][]tgbotapi.InlineKeyboardButton {
 	classes, err := db.ListVisibleClasses(ctx, database)
 	if err != nil || len(classes) == 0 {
 		return [][]tgbotapi.InlineKeyboardButton{
@@ -81,18 +91,26 @@ func exportClassLetterRowsFromDB(ctx context.Context, database *sql.DB, prefix s
 		}
 	}
 
+	var bs callback.Buttons
 	var rows [][]tgbotapi.InlineKeyboardButton
 	for _, c := range classes {
 		if int64(c.Number) != number {
 			continue
 		}
-		cb := fmt.Sprintf("%s%s", prefix, strings.ToUpper(c.Letter))
+		letter := strings.ToUpper(c.Letter)
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(strings.ToUpper(c.Letter), cb),
+			bs.Add(cbExportClassLetter.Button(letter, letter)),
 		))
 	}
-	rows = append(rows, fsmutil.BackCancelRow("export_back", "export_cancel"))
-	return rows
+	return exportRows(&bs, rows)
+}
+
+// exportRows дописывает «Назад/Отмена»; если кнопку не удалось закодировать — остаётся только она.
+func exportRows(bs *callback.Buttons, rows [][]tgbotapi.InlineKeyboardButton) [][]tgbotapi.InlineKeyboardButton {
+	if buttonsFailed(bs) {
+		rows = nil
+	}
+	return append(rows, fsmutil.BackCancelRow("export_back", "export_cancel"))
 }
 
 // StartExportFSM стартовое меню (новое сообщение)
@@ -105,7 +123,7 @@ func StartExportFSM(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB,
 		}
 		return
 	}
-	exportStates[chatID] = &ExportFSMState{Step: ExportStepReportType}
+	exportStates.Set(ctx, chatID, &ExportFSMState{Step: ExportStepReportType})
 
 	rows := [][]tgbotapi.InlineKeyboardButton{
 		tgbotapi.NewInlineKeyboardRow(
@@ -131,15 +149,16 @@ func StartExportFSM(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB,
 
 func HandleExportCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, cq *tgbotapi.CallbackQuery) {
 	chatID := cq.Message.Chat.ID
-	state, ok := exportStates[chatID]
+	state, ok := exportStates.Get(chatID)
 	if !ok {
 		return
 	}
+	defer exportStates.Save(ctx, chatID)
 	data := cq.Data
 
 	// ❌ Отмена — прячем клаву и меняем текст у ЭТОГО же сообщения
 	if data == "export_cancel" {
-		delete(exportStates, chatID)
+		exportStates.Delete(ctx, chatID)
 		fsmutil.DisableMarkup(bot, chatID, cq.Message.MessageID)
 		edit := tgbotapi.NewEditMessageText(chatID, cq.Message.MessageID, "🚫 Экспорт отменён.")
 		if _, err := tg.Send(bot, edit); err != nil {
@@ -165,12 +184,12 @@ func HandleExportCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 			return
 		case ExportStepClassLetter:
 			state.Step = ExportStepClassNumber
-			rows := exportClassNumberRowsFromDB(ctx, database, "export_class_number_")
+			rows := exportClassNumberRowsFromDB(ctx, database)
 			editMenu(bot, chatID, cq.Message.MessageID, "🔢 Выберите номер класса:", rows)
 			return
 		case ExportStepStudentSelect:
 			state.Step = ExportStepClassLetter
-			rows := exportClassLetterRowsFromDB(ctx, database, "export_class_letter_", state.ClassNumber)
+			rows := exportClassLetterRowsFromDB(ctx, database, state.ClassNumber)
 			editMenu(bot, chatID, cq.Message.MessageID, "🔠 Выберите букву класса:", rows)
 			return
 		case ExportStepCustomStartDate:
@@ -197,7 +216,7 @@ func HandleExportCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 			return
 
 		default:
-			delete(exportStates, chatID)
+			exportStates.Delete(ctx, chatID)
 			fsmutil.DisableMarkup(bot, chatID, cq.Message.MessageID)
 			edit := tgbotapi.NewEditMessageText(chatID, cq.Message.MessageID, "🚫 Экспорт отменён.")
 			if _, err := tg.Send(bot, edit); err != nil {
@@ -209,8 +228,8 @@ func HandleExportCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 
 	switch state.Step {
 	case ExportStepReportType:
-		if strings.HasPrefix(data, "export_type_") {
-			state.ReportType = strings.TrimPrefix(data, "export_type_")
+		if rt, err := cbExportType.Parse(data); err == nil {
+			state.ReportType = rt
 			state.Step = ExportStepPeriodMode
 			editMenu(bot, chatID, cq.Message.MessageID, "📅 Выберите режим периода:", periodModeRows())
 		}
@@ -223,23 +242,26 @@ func HandleExportCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 			_ = db.SetActivePeriod(ctx, database)
 			periods, err := db.ListPeriods(ctx, database)
 			if err != nil || len(periods) == 0 {
-				delete(exportStates, chatID)
+				exportStates.Delete(ctx, chatID)
 				edit := tgbotapi.NewEditMessageText(chatID, cq.Message.MessageID, "❌ Не удалось загрузить периоды.")
 				if _, err := tg.Send(bot, edit); err != nil {
 					metrics.HandlerErrors.Inc()
 				}
 				return
 			}
+			var bs callback.Buttons
 			var rows [][]tgbotapi.InlineKeyboardButton
 			for _, p := range periods {
 				label := p.Name
 				if p.IsActive {
 					label += " ✅"
 				}
-				cb := "export_period_" + strconv.FormatInt(p.ID, 10)
-				rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(label, cb)))
+				rows = append(rows, tgbotapi.NewInlineKeyboardRow(bs.Add(cbExportPeriod.Button(label, p.ID))))
 			}
 			rows = append(rows, fsmutil.BackCancelRow("export_back", "export_cancel"))
+			if buttonsFailed(&bs) {
+				return
+			}
 			editMenu(bot, chatID, cq.Message.MessageID, "📘 Выберите учебный период:", rows)
 
 		case "export_mode_custom":
@@ -260,14 +282,12 @@ func HandleExportCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 		case "export_mode_schoolyear":
 			state.PeriodMode = "schoolyear"
 			state.Step = ExportStepSchoolYearSelect
-			editMenu(bot, chatID, cq.Message.MessageID, "📘 Выберите учебный год:", schoolYearRows("export_schoolyear_"))
+			editMenu(bot, chatID, cq.Message.MessageID, "📘 Выберите учебный год:", schoolYearRows())
 			return
 		}
 
 	case ExportStepFixedPeriodSelect:
-		if strings.HasPrefix(data, "export_period_") {
-			idStr := strings.TrimPrefix(data, "export_period_")
-			id, _ := strconv.ParseInt(idStr, 10, 64)
+		if id, err := cbExportPeriod.Parse(data); err == nil {
 			state.PeriodID = &id
 
 			// дальше — в зависимости от типа отчёта
@@ -276,26 +296,26 @@ func HandleExportCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 					metrics.HandlerErrors.Inc()
 				}
 				generateExportReport(ctx, bot, database, chatID, state)
-				delete(exportStates, chatID)
+				exportStates.Delete(ctx, chatID)
 				return
 			}
 			// student / class → выбор номера класса (редактирование)
 			state.Step = ExportStepClassNumber
-			rows := exportClassNumberRowsFromDB(ctx, database, "export_class_number_")
+			rows := exportClassNumberRowsFromDB(ctx, database)
 			editMenu(bot, chatID, cq.Message.MessageID, "🔢 Выберите номер класса:", rows)
 		}
 
 	case ExportStepClassNumber:
-		if strings.HasPrefix(data, "export_class_number_") {
-			state.ClassNumber, _ = strconv.ParseInt(strings.TrimPrefix(data, "export_class_number_"), 10, 64)
+		if n, err := cbExportClassNumber.Parse(data); err == nil {
+			state.ClassNumber = int64(n)
 			state.Step = ExportStepClassLetter
-			rows := exportClassLetterRowsFromDB(ctx, database, "export_class_letter_", state.ClassNumber)
+			rows := exportClassLetterRowsFromDB(ctx, database, state.ClassNumber)
 			editMenu(bot, chatID, cq.Message.MessageID, "🔠 Выберите букву класса:", rows)
 		}
 
 	case ExportStepClassLetter:
-		if strings.HasPrefix(data, "export_class_letter_") {
-			state.ClassLetter = strings.TrimPrefix(data, "export_class_letter_")
+		if letter, err := cbExportClassLetter.Parse(data); err == nil {
+			state.ClassLetter = letter
 			if state.ReportType == "student" {
 				state.Step = ExportStepStudentSelect
 				// тут нам важно оставить тот же message_id, поэтому редактируем только клавиатуру
@@ -305,14 +325,12 @@ func HandleExportCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 					metrics.HandlerErrors.Inc()
 				}
 				generateExportReport(ctx, bot, database, chatID, state)
-				delete(exportStates, chatID)
+				exportStates.Delete(ctx, chatID)
 			}
 		}
 
 	case ExportStepStudentSelect:
-		if strings.HasPrefix(data, "export_select_student_") {
-			idStr := strings.TrimPrefix(data, "export_select_student_")
-			id, _ := strconv.ParseInt(idStr, 10, 64)
+		if id, err := cbExportStudent.Parse(data); err == nil {
 			found := false
 			for i, sid := range state.SelectedStudentIDs {
 				if sid == id {
@@ -337,11 +355,10 @@ func HandleExportCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 				metrics.HandlerErrors.Inc()
 			}
 			generateExportReport(ctx, bot, database, chatID, state)
-			delete(exportStates, chatID)
+			exportStates.Delete(ctx, chatID)
 		}
 	case ExportStepSchoolYearSelect:
-		if strings.HasPrefix(data, "export_schoolyear_") {
-			startYear, _ := strconv.Atoi(strings.TrimPrefix(data, "export_schoolyear_"))
+		if startYear, err := cbExportSchoolYear.Parse(data); err == nil {
 			from, to := db.SchoolYearBoundsByStartYear(startYear)
 			state.PeriodMode = "schoolyear"
 			state.FromDate, state.ToDate = &from, &to
@@ -351,12 +368,12 @@ func HandleExportCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 			case "student":
 				state.SelectedStudentIDs = nil
 				state.Step = ExportStepClassNumber
-				rows := exportClassNumberRowsFromDB(ctx, database, "export_class_number_")
+				rows := exportClassNumberRowsFromDB(ctx, database)
 				editMenu(bot, chatID, cq.Message.MessageID, "🔢 Выберите номер класса:", rows)
 				return
 			case "class":
 				state.Step = ExportStepClassNumber
-				rows := exportClassNumberRowsFromDB(ctx, database, "export_class_number_")
+				rows := exportClassNumberRowsFromDB(ctx, database)
 				editMenu(bot, chatID, cq.Message.MessageID, "🔢 Выберите номер класса:", rows)
 				return
 			case "school":
@@ -365,7 +382,7 @@ func HandleExportCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 					metrics.HandlerErrors.Inc()
 				}
 				generateExportReport(ctx, bot, database, chatID, state)
-				delete(exportStates, chatID)
+				exportStates.Delete(ctx, chatID)
 				return
 			}
 		}
@@ -374,14 +391,15 @@ func HandleExportCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 
 func HandleExportText(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, msg *tgbotapi.Message) {
 	chatID := msg.Chat.ID
-	state := exportStates[chatID]
+	state := exportStates.Value(chatID)
 	if state == nil {
 		return
 	}
+	defer exportStates.Save(ctx, chatID)
 
 	// текстовая отмена
 	if fsmutil.IsCancelText(msg.Text) {
-		delete(exportStates, chatID)
+		exportStates.Delete(ctx, chatID)
 		if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "🚫 Экспорт отменён.")); err != nil {
 			metrics.HandlerErrors.Inc()
 		}
@@ -435,12 +453,12 @@ func HandleExportText(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.D
 				metrics.HandlerErrors.Inc()
 			}
 			generateExportReport(ctx, bot, database, chatID, state)
-			delete(exportStates, chatID)
+			exportStates.Delete(ctx, chatID)
 			return
 		}
 		state.Step = ExportStepClassNumber
 		msgOut := tgbotapi.NewMessage(chatID, "🔢 Выберите номер класса:")
-		rows := exportClassNumberRowsFromDB(ctx, database, "export_class_number_")
+		rows := exportClassNumberRowsFromDB(ctx, database)
 		msgOut.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
 		if _, err := tg.Send(bot, msgOut); err != nil {
 			metrics.HandlerErrors.Inc()
@@ -494,7 +512,7 @@ func editMenu(bot *tgbotapi.BotAPI, chatID int64, messageID int, text string, ro
 // Выбор студентов — редактируем только клавиатуру у текущего сообщения
 func promptStudentSelectExport(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, cq *tgbotapi.CallbackQuery) {
 	chatID := cq.Message.Chat.ID
-	state := exportStates[chatID]
+	state := exportStates.Value(chatID)
 	students, err := db.GetStudentsByClass(ctx, database, state.ClassNumber, state.ClassLetter)
 	if err != nil {
 		edit := tgbotapi.NewEditMessageText(chatID, cq.Message.MessageID, "❌ Не удалось получить список учеников.")
@@ -504,6 +522,7 @@ func promptStudentSelectExport(ctx context.Context, bot *tgbotapi.BotAPI, databa
 		return
 	}
 
+	var bs callback.Buttons
 	var rows [][]tgbotapi.InlineKeyboardButton
 	for _, student := range students {
 		selected := ""
@@ -514,13 +533,15 @@ func promptStudentSelectExport(ctx context.Context, bot *tgbotapi.BotAPI, databa
 			}
 		}
 		label := fmt.Sprintf("%s%s", student.Name, selected)
-		cb := fmt.Sprintf("export_select_student_%d", student.ID)
-		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(label, cb)))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(bs.Add(cbExportStudent.Button(label, student.ID))))
 	}
 	if len(state.SelectedStudentIDs) > 0 {
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("Готово", "export_students_done")))
 	}
 	rows = append(rows, fsmutil.BackCancelRow("export_back", "export_cancel"))
+	if buttonsFailed(&bs) {
+		return
+	}
 
 	edit := tgbotapi.NewEditMessageReplyMarkup(chatID, cq.Message.MessageID, tgbotapi.NewInlineKeyboardMarkup(rows...))
 	if _, err := tg.Send(bot, edit); err != nil {
@@ -690,57 +711,39 @@ func generateExportReport(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 }
 
 func GetExportState(userID int64) *ExportFSMState {
-	return exportStates[userID]
+	return exportStates.Value(userID)
 }
 
-func ClearExportState(userID int64) {
-	delete(exportStates, userID)
+func ClearExportState(ctx context.Context, userID int64) {
+	exportStates.Delete(ctx, userID)
 }
 
-func schoolYearRows(prefix string) [][]tgbotapi.InlineKeyboardButton {
+func schoolYearRows() [][]tgbotapi.InlineKeyboardButton {
 	now := time.Now()
 	cur := db.CurrentSchoolYearStartYear(now)
+	var bs callback.Buttons
 	var rows [][]tgbotapi.InlineKeyboardButton
 	for y := cur; y >= cur-5; y-- {
 		label := db.SchoolYearLabel(y)
-		cb := fmt.Sprintf("%s%d", prefix, y)
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(label, cb),
+			bs.Add(cbExportSchoolYear.Button(label, y)),
 		))
 	}
-	rows = append(rows, fsmutil.BackCancelRow("export_back", "export_cancel"))
-	return rows
+	return exportRows(&bs, rows)
 }
 
+// report — название класса и его коллективный рейтинг за выбранный период по журналу начислений.
 func report(ctx context.Context, state *ExportFSMState, database *sql.DB) (collective int64, className string) {
 	className = fmt.Sprintf("%d%s", int(state.ClassNumber), state.ClassLetter)
-	auctionID := db.GetCategoryIDByName(ctx, database, "Аукцион")
-	if state.PeriodID != nil {
-		if classScores, err2 := db.GetScoresByClassAndPeriod(ctx, database, state.ClassNumber, state.ClassLetter, *state.PeriodID); err2 == nil {
-			stu := map[int64]int{}
-			for _, sc := range classScores {
-				if sc.CategoryID == int64(auctionID) {
-					continue
-				}
-				stu[sc.StudentID] += sc.Points
-			}
-			for _, tot := range stu {
-				collective += int64((tot * 30) / 100)
-			}
-		}
-	} else if state.FromDate != nil && state.ToDate != nil {
-		if classScores, err2 := db.GetScoresByClassAndDateRange(ctx, database, int(state.ClassNumber), state.ClassLetter, *state.FromDate, *state.ToDate); err2 == nil {
-			stu := map[int64]int{}
-			for _, sc := range classScores {
-				if sc.CategoryID == int64(auctionID) {
-					continue
-				}
-				stu[sc.StudentID] += sc.Points
-			}
-			for _, tot := range stu {
-				collective += int64((tot * 30) / 100)
-			}
-		}
+	var err error
+	switch {
+	case state.PeriodID != nil:
+		collective, err = db.GetClassCollectiveByPeriod(ctx, database, state.ClassNumber, state.ClassLetter, *state.PeriodID)
+	case state.FromDate != nil && state.ToDate != nil:
+		collective, err = db.GetClassCollective(ctx, database, state.ClassNumber, state.ClassLetter, *state.FromDate, *state.ToDate)
+	}
+	if err != nil {
+		log.Println("export: collective:", err)
 	}
 	return collective, className
 }
@@ -7,6 +7,7 @@ import (
 	"log"
 	"time"
 
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmstore"
 	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmutil"
 	"github.com/Spok95/telegram-school-bot/internal/db"
 	"github.com/Spok95/telegram-school-bot/internal/export"
@@ -21,7 +22,7 @@ type exportUsersState struct {
 	Step            int // 1=экран параметров → 2=генерация
 }
 
-var expUsers = map[int64]*exportUsersState{}
+var expUsers = fsmstore.NewMap[*exportUsersState]("export_users", 1, fsmstore.DefaultTTL)
 
 const (
 	cbEUToggle   = "exp_users_toggle"
@@ -38,7 +39,8 @@ func StartExportUsers(ctx context.Context, bot *tgbotapi.BotAPI, _ *sql.DB, msg
 	}
 	chatID := msg.Chat.ID
 	st := &exportUsersState{IncludeInactive: false, Step: 1}
-	expUsers[chatID] = st
+	expUsers.Set(ctx, chatID, st)
+	defer expUsers.Save(ctx, chatID)
 
 	text := "Экспорт → Пользователи\n\nСформировать Excel со вкладками: Все, Учителя, Администрация, Ученики, Родители."
 	var rows [][]tgbotapi.InlineKeyboardButton
@@ -61,10 +63,11 @@ func StartExportUsers(ctx context.Context, bot *tgbotapi.BotAPI, _ *sql.DB, msg
 
 func HandleExportUsersCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, cb *tgbotapi.CallbackQuery, isAdmin bool) {
 	chatID := cb.Message.Chat.ID
-	state := expUsers[chatID]
+	state := expUsers.Value(chatID)
 	if state == nil {
 		return
 	}
+	defer expUsers.Save(ctx, chatID)
 	if _, err := tg.Request(bot, tgbotapi.NewCallback(cb.ID, "")); err != nil {
 		metrics.HandlerErrors.Inc()
 	}
@@ -79,7 +82,7 @@ func HandleExportUsersCallback(ctx context.Context, bot *tgbotapi.BotAPI, databa
 		if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "🚫 Отменено.")); err != nil {
 			metrics.HandlerErrors.Inc()
 		}
-		delete(expUsers, chatID)
+		expUsers.Delete(ctx, chatID)
 		return
 	case cbEUBack:
 		// Назад — закрываем экран пользователей и возвращаемся в общее меню экспорта
@@ -87,7 +90,7 @@ func HandleExportUsersCallback(ctx context.Context, bot *tgbotapi.BotAPI, databa
 		if _, err := tg.Request(bot, disable); err != nil {
 			metrics.HandlerErrors.Inc()
 		}
-		delete(expUsers, chatID)
+		expUsers.Delete(ctx, chatID)
 		StartExportFSM(ctx, bot, database, cb.Message)
 		return
 	case cbEUToggle:
@@ -129,31 +132,31 @@ func HandleExportUsersCallback(ctx context.Context, bot *tgbotapi.BotAPI, databa
 		go func(c context.Context) {
 			defer cancel()
 			defer fsmutil.ClearPending(chatID, key)
-			defer delete(expUsers, chatID)
+			defer expUsers.Delete(ctx, chatID)
 
 			all, err := db.ListAllUsers(c, database, state.IncludeInactive)
 			if err != nil {
-				fail(bot, chatID, state, err)
+				fail(ctx, bot, chatID, state, err)
 				return
 			}
 			teachers, err := db.ListTeachers(c, database, state.IncludeInactive)
 			if err != nil {
-				fail(bot, chatID, state, err)
+				fail(ctx, bot, chatID, state, err)
 				return
 			}
 			admins, err := db.ListAdministration(c, database, state.IncludeInactive)
 			if err != nil {
-				fail(bot, chatID, state, err)
+				fail(ctx, bot, chatID, state, err)
 				return
 			}
 			students, err := db.ListStudents(c, database, state.IncludeInactive)
 			if err != nil {
-				fail(bot, chatID, state, err)
+				fail(ctx, bot, chatID, state, err)
 				return
 			}
 			parents, err := db.ListParents(c, database, state.IncludeInactive)
 			if err != nil {
-				fail(bot, chatID, state, err)
+				fail(ctx, bot, chatID, state, err)
 				return
 			}
 
@@ -203,12 +206,12 @@ func HandleExportUsersCallback(ctx context.Context, bot *tgbotapi.BotAPI, databa
 
 			wb, err := export.NewUsersWorkbook(sheets)
 			if err != nil {
-				fail(bot, chatID, state, err)
+				fail(ctx, bot, chatID, state, err)
 				return
 			}
 			path, err := wb.SaveTemp()
 			if err != nil {
-				fail(bot, chatID, state, err)
+				fail(ctx, bot, chatID, state, err)
 				return
 			}
 
@@ -240,12 +243,12 @@ func captionInactive(on bool) string {
 	return "Только активные"
 }
 
-func fail(bot *tgbotapi.BotAPI, chatID int64, st *exportUsersState, err error) {
+func fail(ctx context.Context, bot *tgbotapi.BotAPI, chatID int64, st *exportUsersState, err error) {
 	log.Printf("[EXPORT_USERS] %v", err)
 	if _, err := tg.Send(bot, tgbotapi.NewEditMessageText(chatID, st.MessageID, "❌ Ошибка при формировании экспорта.")); err != nil {
 		metrics.HandlerErrors.Inc()
 	}
-	delete(expUsers, chatID)
+	expUsers.Delete(ctx, chatID)
 }
 
 // Отправить новое сообщение и удалить старое → гарантированная перерисовка клавиатуры
@@ -5,10 +5,9 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
-	"strconv"
-	"strings"
 	"time"
 
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
 	"github.com/Spok95/telegram-school-bot/internal/db"
 	"github.com/Spok95/telegram-school-bot/internal/metrics"
 	"github.com/Spok95/telegram-school-bot/internal/models"
@@ -16,6 +15,9 @@ import (
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
+// cbHistoryStudent — выбор ребёнка для отчёта (формат — см. пакет callback).
+var cbHistoryStudent = callback.NewAction1("hist_excel_student_", callback.ID)
+
 // StartStudentHistoryExcel Ученик → Excel история за активный период
 func StartStudentHistoryExcel(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, msg *tgbotapi.Message) {
 	chatID := msg.Chat.ID
@@ -79,11 +81,14 @@ func StartParentHistoryExcel(ctx context.Context, bot *tgbotapi.BotAPI, database
 		return
 	}
 	// Выбор ребёнка
+	var bs callback.Buttons
 	var rows [][]tgbotapi.InlineKeyboardButton
 	for _, c := range children {
 		label := fmt.Sprintf("%s (%d%s)", c.Name, *c.ClassNumber, *c.ClassLetter)
-		cb := fmt.Sprintf("hist_excel_student_%d", c.ID)
-		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(label, cb)))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(bs.Add(cbHistoryStudent.Button(label, c.ID))))
+	}
+	if buttonsFailed(&bs) {
+		return
 	}
 	markup := tgbotapi.NewInlineKeyboardMarkup(rows...)
 	msgOut := tgbotapi.NewMessage(chatID, "Выберите ребёнка для отчёта за текущий период:")
@@ -101,9 +106,8 @@ func HandleHistoryExcelCallback(ctx context.Context, bot *tgbotapi.BotAPI, datab
 		metrics.HandlerErrors.Inc()
 	}
 
-	if strings.HasPrefix(data, "hist_excel_student_") {
-		idStr := strings.TrimPrefix(data, "hist_excel_student_")
-		stuID, err := strconv.ParseInt(idStr, 10, 64)
+	if cbHistoryStudent.Match(data) {
+		stuID, err := cbHistoryStudent.Parse(data)
 		if err != nil {
 			if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "Ошибка: не удалось определить ребёнка.")); err != nil {
 				metrics.HandlerErrors.Inc()
@@ -141,7 +145,7 @@ func generateAndSendStudentHistoryExcel(ctx context.Context, bot *tgbotapi.BotAP
 		}
 		return
 	}
-	collective := calcCollectiveForClassPeriod(ctx, database, int64(classNumber), classLetter, periodID) // без «Аукцион»
+	collective := calcCollectiveForClassPeriod(ctx, database, int64(classNumber), classLetter, periodID)
 	className := fmt.Sprintf("%d%s", classNumber, classLetter)
 
 	filePath, err := generateStudentReport(scores, collective, className, periodName)
@@ -159,23 +163,12 @@ func generateAndSendStudentHistoryExcel(ctx context.Context, bot *tgbotapi.BotAP
 	}
 }
 
-// calcCollectiveForClassPeriod Коллективный рейтинг класса за период (30%), исключая категорию «Аукцион».
+// calcCollectiveForClassPeriod Коллективный рейтинг класса за период — по журналу начислений.
 func calcCollectiveForClassPeriod(ctx context.Context, database *sql.DB, classNumber int64, classLetter string, periodID int64) int64 {
-	classScores, err := db.GetScoresByClassAndPeriod(ctx, database, classNumber, classLetter, periodID)
+	collective, err := db.GetClassCollectiveByPeriod(ctx, database, classNumber, classLetter, periodID)
 	if err != nil {
+		log.Println("history export: collective:", err)
 		return 0
 	}
-	auctionID := db.GetCategoryIDByName(ctx, database, "Аукцион")
-	totals := map[int64]int{}
-	for _, sc := range classScores {
-		if int(sc.CategoryID) == auctionID {
-			continue
-		}
-		totals[sc.StudentID] += sc.Points
-	}
-	var collective int64 = 0
-	for _, t := range totals {
-		collective += int64((t * 30) / 100)
-	}
 	return collective
 }
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmstore"
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmutil"
+	"github.com/Spok95/telegram-school-bot/internal/ctxutil"
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/holidays"
+	"github.com/Spok95/telegram-school-bot/internal/metrics"
+	"github.com/Spok95/telegram-school-bot/internal/tg"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Календарь нерабочих дней («📆 Каникулы и праздники»): в эти дни консультации
+// не создаются и не предлагаются для записи.
+
+const (
+	holAdd    = "hol_add"
+	holDel    = "hol_del"
+	holCancel = "hol_cancel"
+	holClose  = "hol_close"
+
+	holModeAdd = "add"
+	holModeDel = "del"
+
+	// столько дней календаря показываем в списке
+	holListLimit = 200
+)
+
+type holidayState struct {
+	Mode  string
+	MsgID int
+}
+
+var holidayStates = fsmstore.NewMap[*holidayState]("holidays", 1, time.Hour)
+
+// HolidaysAwaitInput — админ добавляет или удаляет дни и бот ждёт ввод.
+func HolidaysAwaitInput(chatID int64) bool { return holidayStates.Value(chatID) != nil }
+
+// HandleHolidays — список ближайших нерабочих дней и кнопки управления.
+func HandleHolidays(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, chatID int64) {
+	holidayStates.Delete(ctx, chatID)
+	list, err := db.ListHolidays(ctx, database, time.Now().In(time.Local), holListLimit)
+	if err != nil {
+		metrics.HandlerErrors.Inc()
+		holidayReply(bot, chatID, "❌ Не удалось загрузить календарь.")
+		return
+	}
+	var b strings.Builder
+	b.WriteString("📆 Каникулы и праздники\n\n")
+	if len(list) == 0 {
+		b.WriteString("Нерабочих дней впереди нет.\n")
+	}
+	for _, r := range holidayRanges(list) {
+		b.WriteString("• " + r + "\n")
+	}
+	b.WriteString("\nВ эти дни слоты консультаций не создаются, а свободные слоты скрыты от записи. " +
+		"Каникулы также берутся из периодов, в названии которых есть «каникулы».")
+
+	m := tgbotapi.NewMessage(chatID, b.String())
+	m.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("➕ Добавить", holAdd),
+			tgbotapi.NewInlineKeyboardButtonData("➖ Удалить", holDel),
+		),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("✖️ Закрыть", holClose)),
+	)
+	if _, err := tg.Send(bot, m); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
+
+// HandleHolidaysCallback — кнопки списка и отмена ввода.
+func HandleHolidaysCallback(ctx context.Context, bot *tgbotapi.BotAPI, cb *tgbotapi.CallbackQuery) {
+	chatID := cb.Message.Chat.ID
+	if _, err := tg.Request(bot, tgbotapi.NewCallback(cb.ID, "")); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+	fsmutil.DisableMarkup(bot, chatID, cb.Message.MessageID)
+
+	var text, mode string
+	switch cb.Data {
+	case holAdd:
+		mode = holModeAdd
+		text = "➕ Отправьте даты, по одной на строку:\n" +
+			"04.11.2025 День народного единства\n" +
+			"30.12.2025-08.01.2026 Зимние каникулы\n\n" +
+			"Или пришлите файл .ics (экспорт календаря) или .csv со строками «дата;название» / «с;по;название»."
+	case holDel:
+		mode = holModeDel
+		text = "➖ Отправьте дату или диапазон, которые нужно убрать из календаря:\n" +
+			"04.11.2025 или 30.12.2025-08.01.2026"
+	case holCancel:
+		if st := holidayStates.Value(chatID); st != nil && st.MsgID != cb.Message.MessageID {
+			fsmutil.DisableMarkup(bot, chatID, st.MsgID)
+		}
+		holidayStates.Delete(ctx, chatID)
+		holidayReply(bot, chatID, "🚫 Отменено.")
+		return
+	default: // holClose
+		holidayStates.Delete(ctx, chatID)
+		return
+	}
+
+	m := tgbotapi.NewMessage(chatID, text)
+	m.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", holCancel)),
+	)
+	sent, err := tg.Send(bot, m)
+	if err != nil {
+		metrics.HandlerErrors.Inc()
+		return
+	}
+	holidayStates.Set(ctx, chatID, &holidayState{Mode: mode, MsgID: sent.MessageID})
+}
+
+// HandleHolidaysInput — даты текстом или файл календаря. При ошибке ввод можно
+// исправить и прислать снова; после успеха показывается обновлённый список.
+func HandleHolidaysInput(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	st := holidayStates.Value(chatID)
+	if st == nil {
+		return
+	}
+	if fsmutil.IsCancelText(msg.Text) {
+		fsmutil.DisableMarkup(bot, chatID, st.MsgID)
+		holidayStates.Delete(ctx, chatID)
+		holidayReply(bot, chatID, "🚫 Отменено.")
+		return
+	}
+
+	var (
+		result string
+		err    error
+	)
+	switch {
+	case st.Mode == holModeDel:
+		result, err = deleteHolidays(ctx, database, msg.Text)
+	case msg.Document != nil:
+		result, err = importHolidays(ctx, bot, database, chatID, msg.Document)
+	default:
+		result, err = addHolidays(ctx, database, chatID, msg.Text)
+	}
+	if err != nil {
+		holidayReply(bot, chatID, "❌ "+err.Error()+"\nИсправьте и отправьте снова или нажмите «❌ Отмена».")
+		return
+	}
+	fsmutil.DisableMarkup(bot, chatID, st.MsgID)
+	holidayReply(bot, chatID, result)
+	HandleHolidays(ctx, bot, database, chatID)
+}
+
+func addHolidays(ctx context.Context, database *sql.DB, chatID int64, text string) (string, error) {
+	var days []db.Holiday
+	for i, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		parsed, err := holidays.ParseLine(line)
+		if err != nil {
+			return "", fmt.Errorf("строка %d: %w", i+1, err)
+		}
+		days = append(days, parsed...)
+	}
+	if len(days) == 0 {
+		return "", fmt.Errorf("не найдено ни одной даты")
+	}
+	if len(days) > holidays.MaxDays {
+		return "", holidays.ErrTooManyDays
+	}
+	return saveHolidays(ctx, database, chatID, days)
+}
+
+func importHolidays(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, chatID int64, doc *tgbotapi.Document) (string, error) {
+	if doc.FileSize > holidays.MaxFileSize {
+		return "", fmt.Errorf("файл слишком большой (больше %d МБ)", holidays.MaxFileSize>>20)
+	}
+	ctx, cancel := ctxutil.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	path, err := downloadTelegramFile(ctx, bot, doc.FileID, doc.FileName)
+	if err != nil {
+		return "", fmt.Errorf("не удалось скачать файл: %w", err)
+	}
+	defer func() { _ = os.Remove(path) }()
+	f, err := os.Open(path)
+	if err != nil {
+		metrics.HandlerErrors.Inc()
+		return "", fmt.Errorf("не удалось открыть файл: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	days, err := holidays.Parse(doc.FileName, f)
+	if err != nil {
+		log.Println("holidays import:", err)
+		return "", err
+	}
+	return saveHolidays(ctx, database, chatID, days)
+}
+
+func saveHolidays(ctx context.Context, database *sql.DB, chatID int64, days []db.Holiday) (string, error) {
+	var createdBy int64
+	if u, err := db.GetUserByTelegramID(ctx, database, chatID); err == nil && u != nil {
+		createdBy = u.ID
+	}
+	added, err := db.AddHolidays(ctx, database, days, createdBy)
+	if err != nil {
+		metrics.HandlerErrors.Inc()
+		return "", fmt.Errorf("не удалось сохранить календарь")
+	}
+	return fmt.Sprintf("✅ Добавлено дней: %d, обновлено: %d.", added, len(days)-added), nil
+}
+
+func deleteHolidays(ctx context.Context, database *sql.DB, text string) (string, error) {
+	from, to, err := holidays.ParseRange(text)
+	if err != nil {
+		return "", err
+	}
+	n, err := db.DeleteHolidays(ctx, database, from, to)
+	if err != nil {
+		metrics.HandlerErrors.Inc()
+		return "", fmt.Errorf("не удалось изменить календарь")
+	}
+	return fmt.Sprintf("✅ Удалено дней: %d.", n), nil
+}
+
+// holidayRanges сворачивает идущие подряд дни с одинаковым названием:
+// «30.12.2025–08.01.2026 Зимние каникулы».
+func holidayRanges(list []db.Holiday) []string {
+	var out []string
+	for i := 0; i < len(list); {
+		j := i
+		for j+1 < len(list) && list[j+1].Title == list[i].Title &&
+			list[j+1].Day.Sub(list[j].Day) <= 24*time.Hour {
+			j++
+		}
+		line := list[i].Day.Format("02.01.2006")
+		if j > i {
+			line += "–" + list[j].Day.Format("02.01.2006")
+		}
+		if list[i].Title != "" {
+			line += " " + list[i].Title
+		}
+		out = append(out, line)
+		i = j + 1
+	}
+	return out
+}
+
+func holidayReply(bot *tgbotapi.BotAPI, chatID int64, text string) {
+	if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, text)); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+)
+
+func TestHolidayRanges(t *testing.T) {
+	d := func(m time.Month, day int) time.Time { return time.Date(2025, m, day, 0, 0, 0, 0, time.UTC) }
+	list := []db.Holiday{
+		{Day: d(11, 4), Title: "День народного единства"},
+		{Day: d(12, 30), Title: "Зимние каникулы"},
+		{Day: d(12, 31), Title: "Зимние каникулы"},
+		{Day: d(12, 31).AddDate(0, 0, 1), Title: "Зимние каникулы"},
+		{Day: d(12, 31).AddDate(0, 0, 3), Title: "Зимние каникулы"}, // разрыв
+	}
+	got := strings.Join(holidayRanges(list), "|")
+	want := "04.11.2025 День народного единства|30.12.2025–01.01.2026 Зимние каникулы|03.01.2026 Зимние каникулы"
+	if got != want {
+		t.Fatalf("получили %q, ожидали %q", got, want)
+	}
+}
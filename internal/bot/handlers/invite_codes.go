@@ -0,0 +1,413 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmstore"
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmutil"
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/export"
+	"github.com/Spok95/telegram-school-bot/internal/metrics"
+	"github.com/Spok95/telegram-school-bot/internal/models"
+	"github.com/Spok95/telegram-school-bot/internal/tg"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/skip2/go-qrcode"
+)
+
+// InviteAdminState — мастер «🎟 Приглашения»: что за код создаём и для какого класса.
+type InviteAdminState struct {
+	MessageID int
+	Kind      string // teacher | administration | class | sheet
+	ClassID   int64
+	MaxUses   int
+}
+
+var inviteAdminStates = fsmstore.NewMap[*InviteAdminState]("invite_admin", 1, fsmstore.DefaultTTL)
+
+const (
+	inviteKind   = "invite_kind:"
+	inviteClass  = "invite_class:"
+	inviteUses   = "invite_uses:"
+	inviteTTL    = "invite_ttl:"
+	inviteList   = "invite_list"
+	inviteRevoke = "invite_revoke:"
+	inviteBack   = "invite_back"
+	inviteCancel = "invite_cancel"
+)
+
+// Кнопки мастера с аргументом (формат — см. пакет callback).
+var (
+	cbInviteKind   = callback.NewAction1(inviteKind, callback.Word(14)) // роль или inviteKindClass/inviteKindSheet
+	cbInviteClass  = callback.NewAction1(inviteClass, callback.ID)
+	cbInviteUses   = callback.NewAction1(inviteUses, callback.Num)
+	cbInviteTTL    = callback.NewAction1(inviteTTL, callback.Num) // дни
+	cbInviteRevoke = callback.NewAction1(inviteRevoke, callback.ID)
+)
+
+const (
+	inviteKindClass = "class"
+	inviteKindSheet = "sheet"
+)
+
+// коды из QR-листа: ученику — один вход, родителю — на двоих родителей
+const (
+	sheetStudentUses = 1
+	sheetParentUses  = 2
+)
+
+// StartInviteAdmin — главное меню приглашений.
+func StartInviteAdmin(ctx context.Context, bot *tgbotapi.BotAPI, msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	st := &InviteAdminState{}
+	inviteAdminStates.Set(ctx, chatID, st)
+	defer inviteAdminStates.Save(ctx, chatID)
+
+	var bs callback.Buttons
+	out := tgbotapi.NewMessage(chatID, inviteMenuText)
+	out.ReplyMarkup = inviteMenu(&bs)
+	if buttonsFailed(&bs) {
+		return
+	}
+	sent, err := tg.Send(bot, out)
+	if err != nil {
+		metrics.HandlerErrors.Inc()
+		return
+	}
+	st.MessageID = sent.MessageID
+}
+
+const inviteMenuText = "🎟 Приглашения\n\n" +
+	"Код открывает регистрацию по ссылке t.me/<бот>?start=<код> без подтверждения администратором. " +
+	"У кода есть срок действия и лимит использований.\n\n" +
+	"QR-лист класса — по коду на каждого ученика и его родителей, для печати и раздачи."
+
+func inviteMenu(bs *callback.Buttons) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			bs.Add(cbInviteKind.Button("👩‍🏫 Учитель", string(models.Teacher))),
+			bs.Add(cbInviteKind.Button("🏛 Администрация", string(models.Administration))),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			bs.Add(cbInviteKind.Button("🎒 Код класса для учеников", inviteKindClass)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			bs.Add(cbInviteKind.Button("🖨 QR-лист класса", inviteKindSheet)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📋 Действующие коды", inviteList),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", inviteCancel),
+		),
+	)
+}
+
+// HandleInviteAdminCallback — шаги мастера: вид кода → класс → лимит → срок.
+func HandleInviteAdminCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, cq *tgbotapi.CallbackQuery) {
+	chatID := cq.Message.Chat.ID
+	msgID := cq.Message.MessageID
+	data := cq.Data
+
+	st := inviteAdminStates.Value(chatID)
+	if st == nil {
+		st = &InviteAdminState{}
+		inviteAdminStates.Set(ctx, chatID, st)
+	}
+	st.MessageID = msgID
+	defer inviteAdminStates.Save(ctx, chatID)
+
+	// edit — следующий шаг мастера, если все его кнопки закодировались
+	var bs callback.Buttons
+	edit := func(text string, mk tgbotapi.InlineKeyboardMarkup) {
+		if buttonsFailed(&bs) {
+			return
+		}
+		editInvite(bot, chatID, msgID, text, &mk)
+	}
+
+	switch {
+	case data == inviteCancel:
+		inviteAdminStates.Delete(ctx, chatID)
+		fsmutil.DisableMarkup(bot, chatID, msgID)
+		editInvite(bot, chatID, msgID, "🚫 Отменено.", nil)
+
+	case data == inviteBack:
+		*st = InviteAdminState{MessageID: msgID}
+		edit(inviteMenuText, inviteMenu(&bs))
+
+	case cbInviteKind.Match(data):
+		kind, err := cbInviteKind.Parse(data)
+		if err != nil {
+			return
+		}
+		st.Kind = kind
+		st.ClassID, st.MaxUses = 0, 0
+		switch st.Kind {
+		case inviteKindClass, inviteKindSheet:
+			edit("Выберите класс:", inviteClassMenu(ctx, database, &bs))
+		case string(models.Teacher), string(models.Administration):
+			edit("Сколько человек смогут зарегистрироваться по коду?", inviteUsesMenu(&bs, 1, 5, 20))
+		}
+
+	case cbInviteClass.Match(data):
+		id, err := cbInviteClass.Parse(data)
+		if err != nil {
+			return
+		}
+		st.ClassID = id
+		if st.Kind == inviteKindSheet {
+			edit("Сколько действуют коды из листа?", inviteTTLMenu(&bs))
+			return
+		}
+		edit("Сколько учеников смогут зарегистрироваться по коду класса?", inviteUsesMenu(&bs, 30, 40, 60))
+
+	case cbInviteUses.Match(data):
+		n, err := cbInviteUses.Parse(data)
+		if err != nil || n < 1 {
+			return
+		}
+		st.MaxUses = n
+		edit("Сколько действует код?", inviteTTLMenu(&bs))
+
+	case cbInviteTTL.Match(data):
+		days, err := cbInviteTTL.Parse(data)
+		if err != nil || days < 1 || st.Kind == "" {
+			return
+		}
+		expires := time.Now().AddDate(0, 0, days)
+		fsmutil.DisableMarkup(bot, chatID, msgID)
+		if st.Kind == inviteKindSheet {
+			sendInviteSheet(ctx, bot, database, chatID, st.ClassID, expires)
+		} else {
+			createSingleInvite(ctx, bot, database, chatID, st, expires)
+		}
+		inviteAdminStates.Delete(ctx, chatID)
+
+	case data == inviteList:
+		showInviteList(ctx, bot, database, chatID, msgID)
+
+	case cbInviteRevoke.Match(data):
+		id, err := cbInviteRevoke.Parse(data)
+		if err != nil {
+			return
+		}
+		if err := db.RevokeInviteCode(ctx, database, id); err != nil {
+			metrics.HandlerErrors.Inc()
+		}
+		showInviteList(ctx, bot, database, chatID, msgID)
+	}
+}
+
+func inviteClassMenu(ctx context.Context, database *sql.DB, bs *callback.Buttons) tgbotapi.InlineKeyboardMarkup {
+	classes, err := db.ListVisibleClasses(ctx, database)
+	if err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var row []tgbotapi.InlineKeyboardButton
+	for i, c := range classes {
+		if i > 0 && c.Number != classes[i-1].Number {
+			rows = append(rows, row)
+			row = nil
+		}
+		row = append(row, bs.Add(cbInviteClass.Button(
+			fmt.Sprintf("%d%s", c.Number, strings.ToUpper(c.Letter)), c.ID)))
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+	rows = append(rows, fsmutil.BackCancelRow(inviteBack, inviteCancel))
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func inviteUsesMenu(bs *callback.Buttons, options ...int) tgbotapi.InlineKeyboardMarkup {
+	var row []tgbotapi.InlineKeyboardButton
+	for _, n := range options {
+		row = append(row, bs.Add(cbInviteUses.Button(fmt.Sprintf("%d", n), n)))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(row, fsmutil.BackCancelRow(inviteBack, inviteCancel))
+}
+
+func inviteTTLMenu(bs *callback.Buttons) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			bs.Add(cbInviteTTL.Button("3 дня", 3)),
+			bs.Add(cbInviteTTL.Button("Неделя", 7)),
+			bs.Add(cbInviteTTL.Button("Месяц", 30)),
+		),
+		fsmutil.BackCancelRow(inviteBack, inviteCancel),
+	)
+}
+
+// InviteLink — deep link на регистрацию по коду.
+func InviteLink(bot *tgbotapi.BotAPI, code string) string {
+	return fmt.Sprintf("https://t.me/%s?start=%s", bot.Self.UserName, code)
+}
+
+func createSingleInvite(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, chatID int64, st *InviteAdminState, expires time.Time) {
+	n := db.NewInvite{MaxUses: st.MaxUses, ExpiresAt: expires, CreatedBy: actorUserID(ctx, database, chatID)}
+	if st.Kind == inviteKindClass {
+		classID := st.ClassID
+		n.Role, n.ClassID = models.Student, &classID
+	} else {
+		n.Role = models.Role(st.Kind)
+	}
+	codes, err := db.CreateInviteCodes(ctx, database, []db.NewInvite{n})
+	if err != nil {
+		log.Println("create invite:", err)
+		metrics.HandlerErrors.Inc()
+		inviteReply(bot, chatID, "⚠️ Не удалось создать код: "+err.Error())
+		return
+	}
+	c, err := db.GetInviteCode(ctx, database, codes[0].Code)
+	if err != nil {
+		metrics.HandlerErrors.Inc()
+		return
+	}
+
+	link := InviteLink(bot, c.Code)
+	caption := fmt.Sprintf("🎟 Код: %s\nДля: %s\nИспользований: до %d\nДействует до: %s\n\n%s",
+		c.Code, inviteAudience(c), c.MaxUses, c.ExpiresAt.Format("02.01.2006"), link)
+	png, err := qrcode.Encode(link, qrcode.Medium, 512)
+	if err != nil {
+		inviteReply(bot, chatID, caption)
+		return
+	}
+	photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileBytes{Name: "invite_" + c.Code + ".png", Bytes: png})
+	photo.Caption = caption
+	if _, err := tg.Send(bot, photo); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
+
+// inviteAudience — для кого код (в сообщениях админу).
+func inviteAudience(c *db.InviteCode) string {
+	switch {
+	case c.Role == models.Parent:
+		return "родитель — " + c.StudentName + " (" + c.ClassLabel + ")"
+	case c.Role == models.Student && c.StudentID != nil:
+		return "ученик — " + c.StudentName + " (" + c.ClassLabel + ")"
+	case c.Role == models.Student:
+		return "ученики " + c.ClassLabel
+	default:
+		return humanRole(string(c.Role))
+	}
+}
+
+func sendInviteSheet(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, chatID, classID int64, expires time.Time) {
+	class, err := db.GetClassByID(ctx, database, classID)
+	if err != nil || class == nil {
+		inviteReply(bot, chatID, "⚠️ Класс не найден.")
+		return
+	}
+	label := fmt.Sprintf("%d%s", class.Number, strings.ToUpper(class.Letter))
+	targets, err := db.ListClassInviteTargets(ctx, database, classID)
+	if err != nil {
+		metrics.HandlerErrors.Inc()
+		inviteReply(bot, chatID, "⚠️ Не удалось получить список класса.")
+		return
+	}
+	if len(targets) == 0 {
+		inviteReply(bot, chatID, "В классе "+label+" нет учеников. Сначала загрузите список через «📋 Импорт списка классов».")
+		return
+	}
+
+	createdBy := actorUserID(ctx, database, chatID)
+	var (
+		invites  []db.NewInvite
+		students []string
+	)
+	for _, t := range targets {
+		id := t.StudentID
+		if !t.Registered {
+			invites = append(invites, db.NewInvite{Role: models.Student, StudentID: &id, MaxUses: sheetStudentUses, ExpiresAt: expires, CreatedBy: createdBy})
+			students = append(students, t.Name)
+		}
+		invites = append(invites, db.NewInvite{Role: models.Parent, StudentID: &id, MaxUses: sheetParentUses, ExpiresAt: expires, CreatedBy: createdBy})
+		students = append(students, t.Name)
+	}
+	codes, err := db.CreateInviteCodes(ctx, database, invites)
+	if err != nil {
+		log.Println("create class invites:", err)
+		metrics.HandlerErrors.Inc()
+		inviteReply(bot, chatID, "⚠️ Не удалось создать коды: "+err.Error())
+		return
+	}
+
+	until := "до " + expires.Format("02.01.2006")
+	rows := make([]export.InviteSheetRow, 0, len(codes))
+	for i, c := range codes {
+		audience := "Родитель"
+		if c.Role == models.Student {
+			audience = "Ученик"
+		}
+		rows = append(rows, export.InviteSheetRow{
+			Name: students[i], Audience: audience, Code: c.Code, Link: InviteLink(bot, c.Code), Expires: until,
+		})
+	}
+	file, err := export.InviteQRSheet("Приглашения "+label, rows)
+	if err != nil {
+		log.Println("invite sheet:", err)
+		metrics.HandlerErrors.Inc()
+		inviteReply(bot, chatID, "⚠️ Не удалось сформировать лист: "+err.Error())
+		return
+	}
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{
+		Name:  fmt.Sprintf("invites_%s_%s.xlsx", label, time.Now().Format("2006-01-02")),
+		Bytes: file,
+	})
+	doc.Caption = fmt.Sprintf("🖨 QR-лист %s: %d кодов, действуют %s.\nКод ученика — на один вход, код родителя — на двоих родителей.",
+		label, len(codes), until)
+	if _, err := tg.Send(bot, doc); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
+
+func showInviteList(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, chatID int64, msgID int) {
+	codes, err := db.ListActiveInviteCodes(ctx, database, time.Now(), 20)
+	if err != nil {
+		metrics.HandlerErrors.Inc()
+		return
+	}
+	var b strings.Builder
+	b.WriteString("📋 Действующие коды\n\n")
+	var bs callback.Buttons
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if len(codes) == 0 {
+		b.WriteString("Нет действующих кодов сотрудников и классов.")
+	}
+	for i := range codes {
+		c := &codes[i]
+		b.WriteString(fmt.Sprintf("• %s — %s, использовано %d из %d, до %s\n",
+			c.Code, inviteAudience(c), c.UsedCount, c.MaxUses, c.ExpiresAt.Format("02.01.2006")))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			bs.Add(cbInviteRevoke.Button("🗑 Отозвать "+c.Code, c.ID)),
+		))
+	}
+	rows = append(rows, fsmutil.BackCancelRow(inviteBack, inviteCancel))
+	if buttonsFailed(&bs) {
+		return
+	}
+	mk := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	editInvite(bot, chatID, msgID, b.String(), &mk)
+}
+
+func editInvite(bot *tgbotapi.BotAPI, chatID int64, msgID int, text string, mk *tgbotapi.InlineKeyboardMarkup) {
+	edit := tgbotapi.NewEditMessageText(chatID, msgID, text)
+	edit.ReplyMarkup = mk
+	if _, err := tg.Send(bot, edit); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
+
+func inviteReply(bot *tgbotapi.BotAPI, chatID int64, text string) {
+	if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, text)); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
@@ -0,0 +1,374 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmutil"
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/metrics"
+	"github.com/Spok95/telegram-school-bot/internal/models"
+	"github.com/Spok95/telegram-school-bot/internal/rating"
+	"github.com/Spok95/telegram-school-bot/internal/tg"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Экран «🏆 Рейтинг»: одно сообщение, кнопки перерисовывают его.
+// Всё, что нужно для перерисовки, лежит в callback data (кнопки подписаны),
+// поэтому состояние FSM не нужно.
+
+const leaderboardTop = 10
+
+// Что показываем.
+const (
+	lbSchool   = "school"   // ученики школы
+	lbParallel = "parallel" // ученики параллели
+	lbClass    = "class"    // ученики класса
+	lbClasses  = "classes"  // коллективный рейтинг классов
+)
+
+// За какой срок.
+const (
+	lbPeriod = "period" // активный учебный период
+	lbYear   = "year"   // текущий учебный год
+)
+
+type lbView struct {
+	Scope     string
+	Span      string
+	StudentID int64 // чьё место показываем: сам ученик или ребёнок родителя; 0 — сотрудник
+}
+
+// Кнопки экрана (формат — см. пакет callback).
+var (
+	cbLbView       = callback.NewAction3("lb_view:", callback.Word(8), callback.Word(6), callback.ID) // lbView
+	cbLbPrivacy    = callback.NewAction1("lb_privacy:", callback.ID)                                  // studentID
+	cbLbPrivacySet = callback.NewAction2("lb_privacy_set:", callback.ID, callback.Word(8))            // studentID, rating.Display*
+)
+
+func (v lbView) button(title string) (tgbotapi.InlineKeyboardButton, error) {
+	return cbLbView.Button(title, v.Scope, v.Span, v.StudentID)
+}
+
+// HandleLeaderboard — кнопка «🏆 Рейтинг».
+func HandleLeaderboard(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, user *models.User, chatID int64) {
+	v := lbView{Scope: lbSchool, Span: lbPeriod}
+	switch *user.Role {
+	case models.Student:
+		v.StudentID = user.ID
+		v.Scope = lbClass
+	case models.Parent:
+		if children, err := db.GetChildrenByParentID(ctx, database, user.ID); err == nil && len(children) > 0 {
+			v.StudentID = children[0].ID
+			v.Scope = lbClass
+		}
+	}
+	var bs callback.Buttons
+	text, mk := renderLeaderboard(ctx, database, user, v, &bs)
+	if buttonsFailed(&bs) {
+		return
+	}
+	m := tgbotapi.NewMessage(chatID, text)
+	m.ReplyMarkup = mk
+	if _, err := tg.Send(bot, m); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
+
+// HandleLeaderboardCallback — переключение вида и настройки приватности.
+func HandleLeaderboardCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, user *models.User, cb *tgbotapi.CallbackQuery) {
+	chatID := cb.Message.Chat.ID
+	msgID := cb.Message.MessageID
+	data := cb.Data
+
+	switch {
+	case data == "lb_close":
+		fsmutil.DisableMarkup(bot, chatID, msgID)
+
+	case cbLbView.Match(data):
+		scope, span, sid, err := cbLbView.Parse(data)
+		if err != nil {
+			return
+		}
+		v := lbView{Scope: scope, Span: span, StudentID: sid}
+		if !lbCanView(ctx, database, user, v.StudentID) {
+			return
+		}
+		var bs callback.Buttons
+		text, mk := renderLeaderboard(ctx, database, user, v, &bs)
+		if buttonsFailed(&bs) {
+			return
+		}
+		lbEdit(bot, chatID, msgID, text, mk)
+
+	case cbLbPrivacy.Match(data):
+		sid, err := cbLbPrivacy.Parse(data)
+		if err != nil || sid == 0 || !lbCanView(ctx, database, user, sid) {
+			return
+		}
+		lbShowPrivacy(ctx, bot, database, user, chatID, msgID, sid, "")
+
+	case cbLbPrivacySet.Match(data):
+		sid, mode, err := cbLbPrivacySet.Parse(data)
+		if err != nil || sid == 0 || !lbCanView(ctx, database, user, sid) {
+			return
+		}
+		note := "✅ Сохранено."
+		if err := db.SetRatingDisplay(ctx, database, sid, mode); err != nil {
+			log.Println("leaderboard: privacy:", err)
+			note = "❌ Не удалось сохранить настройку."
+		}
+		lbShowPrivacy(ctx, bot, database, user, chatID, msgID, sid, note)
+	}
+}
+
+// lbCanView — ученик смотрит только своё место, родитель — места своих детей,
+// сотрудники — без «своего» ученика.
+func lbCanView(ctx context.Context, database *sql.DB, user *models.User, studentID int64) bool {
+	switch *user.Role {
+	case models.Student:
+		return studentID == user.ID
+	case models.Parent:
+		if studentID == 0 {
+			return true
+		}
+		children, err := db.GetChildrenByParentID(ctx, database, user.ID)
+		if err != nil {
+			return false
+		}
+		for _, c := range children {
+			if c.ID == studentID {
+				return true
+			}
+		}
+		return false
+	default:
+		return studentID == 0
+	}
+}
+
+// lbBounds — границы [from, to) и подпись срока. Без активного периода — учебный год.
+func lbBounds(ctx context.Context, database *sql.DB, span string) (from, to time.Time, title string, fallback bool) {
+	if span == lbPeriod {
+		if p, err := db.GetActivePeriod(ctx, database); err == nil && p != nil {
+			return p.StartDate, p.EndDate.Add(24 * time.Hour), fmt.Sprintf("период «%s»", p.Name), false
+		}
+		fallback = true
+	}
+	now := time.Now()
+	from, to = db.SchoolYearBounds(now)
+	return from, to, "учебный год " + db.SchoolYearLabel(db.CurrentSchoolYearStartYear(now)), fallback
+}
+
+func renderLeaderboard(ctx context.Context, database *sql.DB, user *models.User, v lbView, bs *callback.Buttons) (string, tgbotapi.InlineKeyboardMarkup) {
+	staff := *user.Role != models.Student && *user.Role != models.Parent
+
+	var subject *models.User
+	if v.StudentID != 0 {
+		if u, err := db.GetUserByID(ctx, database, v.StudentID); err == nil && u.ClassNumber != nil && u.ClassLetter != nil {
+			subject = &u
+		}
+	}
+	if subject == nil && (v.Scope == lbParallel || v.Scope == lbClass) {
+		v.Scope = lbSchool
+	}
+	if v.Span != lbYear {
+		v.Span = lbPeriod
+	}
+
+	from, to, spanTitle, fallback := lbBounds(ctx, database, v.Span)
+	var b strings.Builder
+	switch v.Scope {
+	case lbClasses:
+		fmt.Fprintf(&b, "🏆 Коллективный рейтинг классов — %s\n", spanTitle)
+	case lbParallel:
+		fmt.Fprintf(&b, "🏆 Рейтинг %d-х классов — %s\n", *subject.ClassNumber, spanTitle)
+	case lbClass:
+		fmt.Fprintf(&b, "🏆 Рейтинг %d%s класса — %s\n", *subject.ClassNumber, *subject.ClassLetter, spanTitle)
+	default:
+		v.Scope = lbSchool
+		fmt.Fprintf(&b, "🏆 Рейтинг школы — %s\n", spanTitle)
+	}
+	if fallback {
+		b.WriteString("(активного периода нет — показан учебный год)\n")
+	}
+	b.WriteString("\n")
+
+	who := "Ваше место"
+	if *user.Role == models.Parent {
+		who = "Место ребёнка"
+	}
+	if err := lbWriteTable(ctx, database, &b, v, subject, staff, who, from, to); err != nil {
+		log.Println("leaderboard:", err)
+		b.WriteString("⚠️ Не удалось получить рейтинг.")
+	}
+
+	return strings.TrimRight(b.String(), "\n"), lbKeyboard(ctx, database, user, v, subject, bs)
+}
+
+// lbWriteTable — строки рейтинга. staff — показывать ФИО всех, who — подпись к месту смотрящего.
+func lbWriteTable(ctx context.Context, database *sql.DB, b *strings.Builder, v lbView, subject *models.User, staff bool, who string, from, to time.Time) error {
+	if v.Scope == lbClasses {
+		classes, err := db.GetClassStandings(ctx, database, from, to)
+		if err != nil {
+			return err
+		}
+		ranked := rating.RankClasses(classes)
+		if len(ranked) == 0 {
+			b.WriteString("Пока нет классов с учениками.")
+			return nil
+		}
+		var mine *rating.ClassStanding
+		for i, c := range ranked {
+			own := subject != nil && c.ClassNumber == *subject.ClassNumber && c.ClassLetter == *subject.ClassLetter
+			if own {
+				mine = &ranked[i]
+			}
+			if i < leaderboardTop {
+				fmt.Fprintf(b, "%s%d. %d%s — %d\n", lbMark(own), c.Place, c.ClassNumber, c.ClassLetter, c.Points)
+			}
+		}
+		if mine != nil {
+			fmt.Fprintf(b, "\n📍 Место класса: %d из %d (%d)", mine.Place, len(ranked), mine.Points)
+		}
+		return nil
+	}
+
+	var number int64
+	var letter string
+	if v.Scope == lbParallel || v.Scope == lbClass {
+		number = *subject.ClassNumber
+	}
+	if v.Scope == lbClass {
+		letter = *subject.ClassLetter
+	}
+	list, err := db.GetStudentStandings(ctx, database, number, letter, from, to)
+	if err != nil {
+		return err
+	}
+	board := rating.Rank(list, v.StudentID, leaderboardTop)
+	if len(board.Top) == 0 {
+		b.WriteString("Пока в рейтинге никого нет.")
+	}
+	for _, p := range board.Top {
+		own := p.StudentID == v.StudentID
+		name := rating.DisplayName(p.Name, p.Display, staff || own)
+		if v.Scope == lbClass {
+			fmt.Fprintf(b, "%s%d. %s — %d\n", lbMark(own), p.Place, name, p.Points)
+		} else {
+			fmt.Fprintf(b, "%s%d. %s (%d%s) — %d\n", lbMark(own), p.Place, name, p.ClassNumber, p.ClassLetter, p.Points)
+		}
+	}
+	if board.Me != nil {
+		fmt.Fprintf(b, "\n📍 %s: %d из %d (%d баллов)", who, board.Me.Place, board.Count, board.Me.Points)
+		if board.Me.Display == rating.DisplayHidden {
+			b.WriteString("\n🔒 Скрыт из рейтинга: другие это место не видят.")
+		}
+	}
+	return nil
+}
+
+func lbMark(own bool) string {
+	if own {
+		return "👉 "
+	}
+	return ""
+}
+
+func lbKeyboard(ctx context.Context, database *sql.DB, user *models.User, v lbView, subject *models.User, bs *callback.Buttons) tgbotapi.InlineKeyboardMarkup {
+	btn := func(title string, nv lbView, active bool) tgbotapi.InlineKeyboardButton {
+		if active {
+			title = "• " + title
+		}
+		return bs.Add(nv.button(title))
+	}
+	with := func(scope, span string, sid int64) lbView {
+		return lbView{Scope: scope, Span: span, StudentID: sid}
+	}
+
+	scopes := []tgbotapi.InlineKeyboardButton{btn("🏫 Школа", with(lbSchool, v.Span, v.StudentID), v.Scope == lbSchool)}
+	if subject != nil {
+		scopes = append(scopes,
+			btn("🔢 Параллель", with(lbParallel, v.Span, v.StudentID), v.Scope == lbParallel),
+			btn("👥 Класс", with(lbClass, v.Span, v.StudentID), v.Scope == lbClass),
+		)
+	}
+	scopes = append(scopes, btn("🏆 Классы", with(lbClasses, v.Span, v.StudentID), v.Scope == lbClasses))
+
+	rows := [][]tgbotapi.InlineKeyboardButton{
+		scopes,
+		{
+			btn("📅 Период", with(v.Scope, lbPeriod, v.StudentID), v.Span == lbPeriod),
+			btn("🎓 Учебный год", with(v.Scope, lbYear, v.StudentID), v.Span == lbYear),
+		},
+	}
+
+	if *user.Role == models.Parent {
+		if children, err := db.GetChildrenByParentID(ctx, database, user.ID); err == nil && len(children) > 1 {
+			var row []tgbotapi.InlineKeyboardButton
+			for _, c := range children {
+				row = append(row, btn(shortName(c.Name), with(v.Scope, v.Span, c.ID), c.ID == v.StudentID))
+			}
+			rows = append(rows, row)
+		}
+	}
+	if v.StudentID != 0 {
+		title := "🔒 Как меня показывать"
+		if *user.Role == models.Parent {
+			title = "🔒 Как показывать ребёнка"
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			bs.Add(cbLbPrivacy.Button(title, v.StudentID))))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("❌ Закрыть", "lb_close")))
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func lbShowPrivacy(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, user *models.User, chatID int64, msgID int, studentID int64, note string) {
+	mode, err := db.GetRatingDisplay(ctx, database, studentID)
+	if err != nil {
+		log.Println("leaderboard: privacy:", err)
+		mode = rating.DisplayFull
+	}
+	who := "вас"
+	if *user.Role == models.Parent {
+		who = "ребёнка"
+	}
+	text := fmt.Sprintf("🔒 Как показывать %s в рейтинге другим ученикам и родителям?\n"+
+		"Учителя и администрация всегда видят ФИО.", who)
+	if note != "" {
+		text = note + "\n\n" + text
+	}
+	var bs callback.Buttons
+	opt := func(title, m string) []tgbotapi.InlineKeyboardButton {
+		if m == mode {
+			title = "✅ " + title
+		}
+		return tgbotapi.NewInlineKeyboardRow(
+			bs.Add(cbLbPrivacySet.Button(title, studentID, m)))
+	}
+	mk := tgbotapi.NewInlineKeyboardMarkup(
+		opt("ФИО полностью", rating.DisplayFull),
+		opt("Только инициалы", rating.DisplayInitials),
+		opt("Не участвовать в рейтинге", rating.DisplayHidden),
+		tgbotapi.NewInlineKeyboardRow(bs.Add(
+			lbView{Scope: lbClass, Span: lbPeriod, StudentID: studentID}.button("⬅️ Назад"))),
+	)
+	if buttonsFailed(&bs) {
+		return
+	}
+	lbEdit(bot, chatID, msgID, text, mk)
+}
+
+func lbEdit(bot *tgbotapi.BotAPI, chatID int64, msgID int, text string, mk tgbotapi.InlineKeyboardMarkup) {
+	edit := tgbotapi.NewEditMessageText(chatID, msgID, text)
+	edit.ReplyMarkup = &mk
+	if _, err := tg.Send(bot, edit); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS fsm_states (
+    fsm        TEXT        NOT NULL,
+    chat_id    BIGINT      NOT NULL,
+    version    INT         NOT NULL DEFAULT 1,
+    state      JSONB       NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (fsm, chat_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_fsm_states_expires ON fsm_states(expires_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS fsm_states;
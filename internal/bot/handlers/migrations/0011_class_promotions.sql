@@ -0,0 +1,35 @@
+-- +goose Up
+-- Перевод учеников в следующий класс: один запуск = одна строка,
+-- по каждому ученику — строка журнала (для отчёта и отката).
+CREATE TABLE IF NOT EXISTS class_promotions (
+    id             BIGSERIAL PRIMARY KEY,
+    status         TEXT        NOT NULL CHECK (status IN ('scheduled','done','rolled_back','cancelled')),
+    effective_date DATE        NOT NULL,
+    created_by     BIGINT      REFERENCES users(id) ON DELETE SET NULL,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    applied_at     TIMESTAMPTZ,
+    promoted       INT         NOT NULL DEFAULT 0,
+    graduated      INT         NOT NULL DEFAULT 0,
+    rolled_back_at TIMESTAMPTZ,
+    rolled_back_by BIGINT      REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- запланированным может быть только один перевод
+CREATE UNIQUE INDEX IF NOT EXISTS uq_class_promotions_scheduled
+    ON class_promotions((status)) WHERE status = 'scheduled';
+
+CREATE TABLE IF NOT EXISTS class_promotion_items (
+    promotion_id     BIGINT  NOT NULL REFERENCES class_promotions(id) ON DELETE CASCADE,
+    user_id          BIGINT  NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    old_class_id     BIGINT,
+    old_class_number INT     NOT NULL,
+    old_class_letter TEXT,
+    new_class_id     BIGINT,
+    new_class_number INT,
+    graduated        BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (promotion_id, user_id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS class_promotion_items;
+DROP TABLE IF EXISTS class_promotions;
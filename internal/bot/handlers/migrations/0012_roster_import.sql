@@ -0,0 +1,31 @@
+-- +goose Up
+-- Импорт списков классов: ученики и родители из файла заводятся заранее
+-- как «заготовки» (is_placeholder) и привязываются к Telegram при регистрации.
+-- У заготовки ещё нет чата, поэтому telegram_id — отрицательный номер из последовательности.
+CREATE SEQUENCE IF NOT EXISTS roster_placeholder_seq;
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS is_placeholder BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS phone          TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_users_placeholder_name
+    ON users(UPPER(name)) WHERE is_placeholder;
+
+CREATE TABLE IF NOT EXISTS roster_imports (
+    id         BIGSERIAL PRIMARY KEY,
+    source     TEXT        NOT NULL CHECK (source IN ('bot','http')),
+    file_name  TEXT        NOT NULL DEFAULT '',
+    created_by BIGINT      REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created    INT         NOT NULL DEFAULT 0,
+    matched    INT         NOT NULL DEFAULT 0,
+    rejected   INT         NOT NULL DEFAULT 0
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS roster_imports;
+DROP INDEX IF EXISTS idx_users_placeholder_name;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS phone,
+    DROP COLUMN IF EXISTS is_placeholder;
+DROP SEQUENCE IF EXISTS roster_placeholder_seq;
@@ -0,0 +1,30 @@
+-- +goose Up
+-- Коды приглашения: регистрация по ссылке /start <код> без ручного подтверждения.
+CREATE TABLE IF NOT EXISTS invite_codes (
+    id         BIGSERIAL PRIMARY KEY,
+    code       TEXT        NOT NULL UNIQUE,
+    role       TEXT        NOT NULL CHECK (role IN ('student','parent','teacher','administration')),
+    class_id   BIGINT      REFERENCES classes(id) ON DELETE CASCADE,
+    student_id BIGINT      REFERENCES users(id) ON DELETE CASCADE,
+    max_uses   INT         NOT NULL DEFAULT 1 CHECK (max_uses > 0),
+    used_count INT         NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_by BIGINT      REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    revoked_at TIMESTAMPTZ,
+    CHECK (used_count <= max_uses)
+);
+
+CREATE INDEX IF NOT EXISTS idx_invite_codes_student ON invite_codes(student_id);
+
+-- кто и когда зарегистрировался по коду
+CREATE TABLE IF NOT EXISTS invite_code_uses (
+    code_id BIGINT      NOT NULL REFERENCES invite_codes(id) ON DELETE CASCADE,
+    user_id BIGINT      NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    used_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (code_id, user_id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS invite_code_uses;
+DROP TABLE IF EXISTS invite_codes;
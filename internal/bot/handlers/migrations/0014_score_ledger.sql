@@ -0,0 +1,65 @@
+-- +goose Up
+-- Журнал начислений: в него только дописывают. Подтверждение заявки — запись approve,
+-- отмена — reversal со ссылкой на отменяемую запись, исправление — отмена + correction.
+-- Баллы ученика и коллективный рейтинг класса считаются по журналу;
+-- classes.collective_score — только кэш суммы, расхождения ищет /reconcile.
+CREATE TABLE IF NOT EXISTS score_ledger (
+    id           BIGSERIAL PRIMARY KEY,
+    score_id     BIGINT    NOT NULL REFERENCES scores(id) ON DELETE CASCADE,
+    kind         TEXT      NOT NULL CHECK (kind IN ('approve','correction','reversal')),
+    reverses_id  BIGINT    REFERENCES score_ledger(id),
+    student_id   BIGINT    NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    class_id     BIGINT    REFERENCES classes(id),
+    category_id  BIGINT    NOT NULL REFERENCES categories(id),
+    points       INT       NOT NULL,
+    collective   INT       NOT NULL DEFAULT 0,
+    reason       TEXT,
+    effective_at TIMESTAMP NOT NULL,
+    created_by   BIGINT    REFERENCES users(id) ON DELETE SET NULL,
+    created_at   TIMESTAMP NOT NULL DEFAULT NOW(),
+    CHECK ((kind = 'reversal') = (reverses_id IS NOT NULL))
+);
+
+-- запись отменяется не больше одного раза
+CREATE UNIQUE INDEX IF NOT EXISTS uq_score_ledger_reverses
+    ON score_ledger(reverses_id) WHERE reverses_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_score_ledger_score ON score_ledger(score_id);
+CREATE INDEX IF NOT EXISTS idx_score_ledger_student ON score_ledger(student_id, effective_at);
+CREATE INDEX IF NOT EXISTS idx_score_ledger_class ON score_ledger(class_id, effective_at);
+
+-- уже подтверждённые заявки переносим в журнал по тем же правилам,
+-- что были в коде: 30% от баллов в коллективный рейтинг, кроме «Аукциона»
+INSERT INTO score_ledger (score_id, kind, student_id, class_id, category_id, points, collective,
+                          effective_at, created_by, created_at)
+SELECT s.id, 'approve', s.student_id, COALESCE(u.class_id, c.id), s.category_id, s.points,
+       CASE WHEN cat.name = 'Аукцион' THEN 0 ELSE s.points * 30 / 100 END,
+       s.created_at, s.approved_by, COALESCE(s.approved_at, s.created_at)
+FROM scores s
+JOIN users u ON u.id = s.student_id
+JOIN categories cat ON cat.id = s.category_id
+LEFT JOIN classes c ON c.number = u.class_number AND c.letter = u.class_letter
+WHERE s.status = 'approved'
+ORDER BY s.id;
+
+-- записи журнала в форме строк scores: отчёты читают отсюда вместо scores
+CREATE OR REPLACE VIEW score_entries AS
+SELECT l.score_id                    AS id,
+       l.id                          AS entry_id,
+       l.kind,
+       l.student_id,
+       l.category_id,
+       l.points,
+       s.type,
+       COALESCE(l.reason, s.comment) AS comment,
+       'approved'::TEXT              AS status,
+       s.approved_by,
+       s.approved_at,
+       s.created_by,
+       l.effective_at                AS created_at,
+       s.period_id
+FROM score_ledger l
+JOIN scores s ON s.id = l.score_id;
+
+-- +goose Down
+DROP VIEW IF EXISTS score_entries;
+DROP TABLE IF EXISTS score_ledger;
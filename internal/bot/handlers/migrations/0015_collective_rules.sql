@@ -0,0 +1,60 @@
+-- +goose Up
+-- Правило коллективного рейтинга теперь в справочнике, а не в коде:
+-- какой процент баллов идёт классу и влияет ли категория на рейтинг вообще.
+-- Значения по умолчанию повторяют прежнее правило «30%, кроме „Аукциона“».
+ALTER TABLE categories
+    ADD COLUMN IF NOT EXISTS affects_collective BOOLEAN NOT NULL DEFAULT TRUE,
+    ADD COLUMN IF NOT EXISTS collective_percent INT NOT NULL DEFAULT 30
+        CHECK (collective_percent BETWEEN 0 AND 100);
+
+UPDATE categories SET affects_collective = FALSE WHERE name = 'Аукцион';
+
+-- процент для отдельного уровня; NULL — как у категории
+ALTER TABLE score_levels
+    ADD COLUMN IF NOT EXISTS collective_percent INT
+        CHECK (collective_percent BETWEEN 0 AND 100);
+
+-- отчётам нужен вклад каждой записи в рейтинг класса — он посчитан при записи в журнал
+CREATE OR REPLACE VIEW score_entries AS
+SELECT l.score_id                    AS id,
+       l.id                          AS entry_id,
+       l.kind,
+       l.student_id,
+       l.category_id,
+       l.points,
+       s.type,
+       COALESCE(l.reason, s.comment) AS comment,
+       'approved'::TEXT              AS status,
+       s.approved_by,
+       s.approved_at,
+       s.created_by,
+       l.effective_at                AS created_at,
+       s.period_id,
+       l.collective
+FROM score_ledger l
+JOIN scores s ON s.id = l.score_id;
+
+-- +goose Down
+DROP VIEW IF EXISTS score_entries;
+CREATE VIEW score_entries AS
+SELECT l.score_id                    AS id,
+       l.id                          AS entry_id,
+       l.kind,
+       l.student_id,
+       l.category_id,
+       l.points,
+       s.type,
+       COALESCE(l.reason, s.comment) AS comment,
+       'approved'::TEXT              AS status,
+       s.approved_by,
+       s.approved_at,
+       s.created_by,
+       l.effective_at                AS created_at,
+       s.period_id
+FROM score_ledger l
+JOIN scores s ON s.id = l.score_id;
+
+ALTER TABLE score_levels DROP COLUMN IF EXISTS collective_percent;
+ALTER TABLE categories
+    DROP COLUMN IF EXISTS collective_percent,
+    DROP COLUMN IF EXISTS affects_collective;
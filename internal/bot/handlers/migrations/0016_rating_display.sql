@@ -0,0 +1,10 @@
+-- +goose Up
+-- Как ученик показан в «🏆 Рейтинг» другим ученикам и родителям:
+-- full — ФИО, initials — инициалы, hidden — не участвует (сам видит своё место).
+-- Сотрудники школы видят ФИО всегда, как и в выгрузках.
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS rating_display TEXT NOT NULL DEFAULT 'full'
+        CHECK (rating_display IN ('full', 'initials', 'hidden'));
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN IF EXISTS rating_display;
@@ -0,0 +1,31 @@
+-- +goose Up
+-- Уведомления ученику и родителям о подтверждённых начислениях и списаниях.
+-- Включаются самим пользователем (notify_prefs, kind = 'scores'); подтверждение заявки ставит
+-- уведомление в очередь, фоновая задача раз в несколько минут отправляет
+-- каждому получателю одно сообщение со всем, что накопилось.
+-- Настройки по типам уведомлений: строки есть только у тех, кто менял значение
+-- по умолчанию (см. internal/notify).
+CREATE TABLE IF NOT EXISTS notify_prefs (
+    user_id BIGINT  NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind    TEXT    NOT NULL,
+    enabled BOOLEAN NOT NULL,
+    PRIMARY KEY (user_id, kind)
+);
+
+CREATE TABLE IF NOT EXISTS score_notifications (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    BIGINT    NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    score_id   BIGINT    NOT NULL REFERENCES scores(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    sent_at    TIMESTAMP,
+    UNIQUE (user_id, score_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_score_notifications_pending
+    ON score_notifications(user_id, id) WHERE sent_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_score_notifications_sent
+    ON score_notifications(user_id, sent_at) WHERE sent_at IS NOT NULL;
+
+-- +goose Down
+DROP TABLE IF EXISTS score_notifications;
+DROP TABLE IF EXISTS notify_prefs;
@@ -0,0 +1,25 @@
+-- +goose Up
+-- Настройки уведомлений («⚙️ Настройки»): переключатели по типам живут в notify_prefs
+-- (появились вместе с уведомлениями о баллах), здесь — тихие часы в часовом поясе школы.
+-- Тихие часы: минуты от полуночи, интервал может переходить через полночь (22:00–07:00).
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS quiet_from SMALLINT CHECK (quiet_from BETWEEN 0 AND 1439),
+    ADD COLUMN IF NOT EXISTS quiet_to   SMALLINT CHECK (quiet_to BETWEEN 0 AND 1439);
+
+-- Отложенные сообщения: всё, что пришлось на тихие часы, уходит после not_before.
+CREATE TABLE IF NOT EXISTS outbox (
+    id         BIGSERIAL PRIMARY KEY,
+    chat_id    BIGINT      NOT NULL,
+    user_id    BIGINT      REFERENCES users(id) ON DELETE CASCADE,
+    kind       TEXT        NOT NULL,
+    text       TEXT        NOT NULL,
+    not_before TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    sent_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_due ON outbox(not_before) WHERE sent_at IS NULL;
+
+-- +goose Down
+DROP TABLE IF EXISTS outbox;
+ALTER TABLE users DROP COLUMN IF EXISTS quiet_from, DROP COLUMN IF EXISTS quiet_to;
@@ -0,0 +1,29 @@
+-- +goose Up
+-- Очередь исходящих сообщений: outbox из 0018 становится общей очередью с повторами.
+-- not_before — время следующей попытки (конец тихих часов, backoff или retry_after);
+-- сообщение, которое так и не удалось доставить, получает failed_at и больше не отправляется.
+ALTER TABLE outbox
+    ADD COLUMN IF NOT EXISTS reply_markup TEXT,
+    ADD COLUMN IF NOT EXISTS attempts     INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS last_error   TEXT,
+    ADD COLUMN IF NOT EXISTS failed_at    TIMESTAMPTZ;
+
+DROP INDEX IF EXISTS idx_outbox_due;
+CREATE INDEX IF NOT EXISTS idx_outbox_due ON outbox(not_before, id) WHERE sent_at IS NULL AND failed_at IS NULL;
+
+-- Пользователь заблокировал бота (Telegram ответил 403): сообщения ему не ставятся в очередь,
+-- пока он снова не откроет чат с ботом.
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS blocked_at TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN IF EXISTS blocked_at;
+
+DROP INDEX IF EXISTS idx_outbox_due;
+DELETE FROM outbox WHERE failed_at IS NOT NULL;
+ALTER TABLE outbox
+    DROP COLUMN IF EXISTS reply_markup,
+    DROP COLUMN IF EXISTS attempts,
+    DROP COLUMN IF EXISTS last_error,
+    DROP COLUMN IF EXISTS failed_at;
+CREATE INDEX IF NOT EXISTS idx_outbox_due ON outbox(not_before) WHERE sent_at IS NULL;
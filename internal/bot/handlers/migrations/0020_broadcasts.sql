@@ -0,0 +1,39 @@
+-- +goose Up
+-- Рассылки администрации («📨 Рассылки»): аудитория, текст с необязательным вложением,
+-- время отправки. В момент отправки рассылка раскладывается по получателям в outbox,
+-- а отчёт (доставлено / в очереди / заблокировали бота / не доставлено) считается по нему.
+CREATE TABLE IF NOT EXISTS broadcasts (
+    id                 BIGSERIAL PRIMARY KEY,
+    created_by         BIGINT      REFERENCES users(id) ON DELETE SET NULL,
+    audience           JSONB       NOT NULL,
+    audience_label     TEXT        NOT NULL,
+    text               TEXT        NOT NULL,
+    attachment_type    TEXT        CHECK (attachment_type IN ('photo', 'document')),
+    attachment_file_id TEXT,
+    scheduled_at       TIMESTAMPTZ NOT NULL,
+    queued_at          TIMESTAMPTZ,
+    cancelled_at       TIMESTAMPTZ,
+    recipients         INT         NOT NULL DEFAULT 0,
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_broadcasts_due
+    ON broadcasts(scheduled_at) WHERE queued_at IS NULL AND cancelled_at IS NULL;
+
+ALTER TABLE outbox
+    ADD COLUMN IF NOT EXISTS broadcast_id       BIGINT REFERENCES broadcasts(id) ON DELETE CASCADE,
+    ADD COLUMN IF NOT EXISTS attachment_type    TEXT,
+    ADD COLUMN IF NOT EXISTS attachment_file_id TEXT,
+    -- сообщение не доставлено, потому что пользователь заблокировал бота
+    ADD COLUMN IF NOT EXISTS blocked            BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_outbox_broadcast ON outbox(broadcast_id) WHERE broadcast_id IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_outbox_broadcast;
+ALTER TABLE outbox
+    DROP COLUMN IF EXISTS broadcast_id,
+    DROP COLUMN IF EXISTS attachment_type,
+    DROP COLUMN IF EXISTS attachment_file_id,
+    DROP COLUMN IF EXISTS blocked;
+DROP TABLE IF EXISTS broadcasts;
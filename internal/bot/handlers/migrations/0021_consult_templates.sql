@@ -0,0 +1,35 @@
+-- +goose Up
+-- Шаблоны расписания консультаций учителя: «каждый вторник 16:00–18:00 по 15 минут для 7А, 7Б».
+-- Фоновая задача превращает их в слоты consult_slots на скользящий горизонт вперёд,
+-- пропуская каникулы. generated_until — до какого дня слоты уже созданы: удалённый учителем
+-- свободный слот не появится снова, а после изменения шаблона горизонт считается заново.
+CREATE TABLE IF NOT EXISTS consult_templates (
+    id              BIGSERIAL PRIMARY KEY,
+    teacher_id      BIGINT   NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    weekday         SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6), -- 0 — воскресенье, как time.Weekday
+    start_min       SMALLINT NOT NULL CHECK (start_min BETWEEN 0 AND 1439),
+    end_min         SMALLINT NOT NULL CHECK (end_min BETWEEN 1 AND 1440),
+    step_min        SMALLINT NOT NULL CHECK (step_min > 0),
+    consult_format  TEXT     NOT NULL DEFAULT 'offline' CHECK (consult_format IN ('online', 'offline')),
+    class_ids       BIGINT[] NOT NULL,
+    paused          BOOLEAN  NOT NULL DEFAULT FALSE,
+    generated_until DATE,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (end_min > start_min),
+    CHECK (cardinality(class_ids) > 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_consult_templates_teacher ON consult_templates(teacher_id);
+
+-- слот, созданный по шаблону; записи на него переживают удаление шаблона
+ALTER TABLE consult_slots
+    ADD COLUMN IF NOT EXISTS template_id BIGINT REFERENCES consult_templates(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_consult_slots_template
+    ON consult_slots(template_id, start_at) WHERE template_id IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_consult_slots_template;
+ALTER TABLE consult_slots DROP COLUMN IF EXISTS template_id;
+DROP TABLE IF EXISTS consult_templates;
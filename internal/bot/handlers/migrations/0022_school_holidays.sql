@@ -0,0 +1,13 @@
+-- +goose Up
+-- Календарь нерабочих дней школы: праздники и каникулы по дням. Ведётся админом
+-- («📆 Каникулы и праздники»), можно загрузить из .ics или .csv. В эти дни не создаются
+-- слоты консультаций, а родителям не показываются свободные слоты.
+CREATE TABLE IF NOT EXISTS school_holidays (
+    day        DATE PRIMARY KEY,
+    title      TEXT        NOT NULL DEFAULT '',
+    created_by BIGINT      REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS school_holidays;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- Секретные ссылки на подписку iCal: по токену отдаётся расписание учителя
+-- или записи родителя. Новый токен делает старую ссылку недействительной.
+CREATE TABLE IF NOT EXISTS calendar_tokens (
+    user_id    BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    token      TEXT        NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS calendar_tokens;
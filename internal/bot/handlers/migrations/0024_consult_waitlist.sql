@@ -0,0 +1,43 @@
+-- +goose Up
+-- Лист ожидания консультаций: родитель встаёт в очередь к учителю для класса ребёнка,
+-- при желании — только на выбранные дни недели (weekdays: 0 — воскресенье … 6 — суббота,
+-- пусто — любой день). Освободившийся или новый слот сначала на время закрепляется
+-- за первым подходящим родителем из очереди и лишь потом становится доступен всем.
+CREATE TABLE IF NOT EXISTS consult_waitlist (
+    id         BIGSERIAL PRIMARY KEY,
+    teacher_id BIGINT      NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    class_id   BIGINT      NOT NULL REFERENCES classes(id) ON DELETE CASCADE,
+    parent_id  BIGINT      NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    child_id   BIGINT      NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    weekdays   SMALLINT[]  NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (teacher_id, parent_id, child_id)
+);
+
+CREATE INDEX IF NOT EXISTS ix_consult_waitlist_queue ON consult_waitlist (teacher_id, created_at, id);
+CREATE INDEX IF NOT EXISTS ix_consult_waitlist_parent ON consult_waitlist (parent_id);
+
+-- предложение слота родителю из очереди: до offer_expires_at слот видит только он
+ALTER TABLE consult_slots
+    ADD COLUMN IF NOT EXISTS offer_waitlist_id BIGINT REFERENCES consult_waitlist(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS offer_parent_id   BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS offer_expires_at  TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS ix_consult_slots_offer ON consult_slots (offer_expires_at) WHERE offer_expires_at IS NOT NULL;
+
+-- какие слоты уже предлагались записи очереди: от отказа повторно не предлагаем
+CREATE TABLE IF NOT EXISTS consult_waitlist_offers (
+    waitlist_id BIGINT      NOT NULL REFERENCES consult_waitlist(id) ON DELETE CASCADE,
+    slot_id     BIGINT      NOT NULL REFERENCES consult_slots(id) ON DELETE CASCADE,
+    offered_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (waitlist_id, slot_id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS consult_waitlist_offers;
+DROP INDEX IF EXISTS ix_consult_slots_offer;
+ALTER TABLE consult_slots
+    DROP COLUMN IF EXISTS offer_expires_at,
+    DROP COLUMN IF EXISTS offer_parent_id,
+    DROP COLUMN IF EXISTS offer_waitlist_id;
+DROP TABLE IF EXISTS consult_waitlist;
@@ -1,6 +1,28 @@
 package migrations
 
-import "embed"
+import (
+	"embed"
+	"io/fs"
+
+	"github.com/pressly/goose/v3"
+)
 
 //go:embed *.sql
 var FS embed.FS
+
+// Latest — версия схемы после всех встроенных миграций.
+func Latest() (int64, error) {
+	names, err := fs.Glob(FS, "*.sql")
+	if err != nil {
+		return 0, err
+	}
+	var latest int64
+	for _, name := range names {
+		v, err := goose.NumericComponent(name)
+		if err != nil {
+			return 0, err
+		}
+		latest = max(latest, v)
+	}
+	return latest, nil
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"time"
 
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
 	"github.com/Spok95/telegram-school-bot/internal/db"
 	"github.com/Spok95/telegram-school-bot/internal/metrics"
 	"github.com/Spok95/telegram-school-bot/internal/models"
@@ -57,7 +58,7 @@ func HandleMyScore(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB,
 	defer cancel()
 	rows, err := database.QueryContext(ctx, `
 		SELECT c.label, SUM(s.points) AS total
-		FROM scores s
+		FROM score_entries s
 		JOIN categories c ON s.category_id = c.id
 		WHERE s.student_id = $1 
 		  AND s.status = 'approved'
@@ -142,6 +143,9 @@ func abs(n int) int {
 	return n
 }
 
+// CbShowRating — выбор ребёнка для рейтинга (формат — см. пакет callback); разбирает диспетчер.
+var CbShowRating = callback.NewAction1("show_rating_student_", callback.ID)
+
 func HandleParentRatingRequest(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, chatID int64, parentID int64) {
 	children, err := db.GetChildrenByParentID(ctx, database, parentID)
 	if err != nil || len(children) == 0 {
@@ -156,14 +160,17 @@ func HandleParentRatingRequest(ctx context.Context, bot *tgbotapi.BotAPI, databa
 		return
 	}
 
+	var bs callback.Buttons
 	var rows [][]tgbotapi.InlineKeyboardButton
 	for _, child := range children {
 		text := fmt.Sprintf("%s (%d%s класс)", child.Name, *child.ClassNumber, *child.ClassLetter)
-		callback := fmt.Sprintf("show_rating_student_%d", child.ID)
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(text, callback),
+			bs.Add(CbShowRating.Button(text, child.ID)),
 		))
 	}
+	if buttonsFailed(&bs) {
+		return
+	}
 
 	markup := tgbotapi.NewInlineKeyboardMarkup(rows...)
 	msg := tgbotapi.NewMessage(chatID, "Выберите ребёнка для просмотра рейтинга:")
@@ -190,7 +197,7 @@ func ShowStudentRating(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.
 	defer cancel()
 	rows, err := database.QueryContext(ctx, `
 		SELECT c.label, SUM(s.points) AS total
-		FROM scores s
+		FROM score_entries s
 		JOIN categories c ON s.category_id = c.id
 		WHERE s.student_id = $1 
 		  AND s.status = 'approved'
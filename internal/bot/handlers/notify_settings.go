@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmstore"
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmutil"
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/metrics"
+	"github.com/Spok95/telegram-school-bot/internal/models"
+	"github.com/Spok95/telegram-school-bot/internal/notify"
+	"github.com/Spok95/telegram-school-bot/internal/tg"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Экран «⚙️ Настройки»: переключатели уведомлений и тихие часы.
+// Кнопки перерисовывают одно сообщение; состояние нужно только на время
+// ввода своих тихих часов текстом.
+
+type notifySettingsState struct {
+	MessageID int
+}
+
+var notifySettingsStates = fsmstore.NewMap[*notifySettingsState]("notify_settings", 1, fsmstore.DefaultTTL)
+
+// Кнопки экрана (формат — см. пакет callback).
+var (
+	cbNotifyToggle   = callback.NewAction1("ns_toggle:", callback.Word(20))             // notify.Kind
+	cbNotifyQuietSet = callback.NewAction2("ns_quiet_set:", callback.Num, callback.Num) // минуты от полуночи
+)
+
+// готовые варианты тихих часов, минуты от полуночи
+var quietPresets = []notify.QuietHours{
+	{From: 21 * 60, To: 8 * 60},
+	{From: 22 * 60, To: 7 * 60},
+	{From: 23 * 60, To: 7 * 60},
+}
+
+// NotifySettingsAwaitsText — ждём тихие часы текстом.
+func NotifySettingsAwaitsText(chatID int64) bool {
+	return notifySettingsStates.Value(chatID) != nil
+}
+
+// HandleNotifySettings — кнопка «⚙️ Настройки».
+func HandleNotifySettings(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, user *models.User, chatID int64) {
+	text, mk, err := notifySettingsView(ctx, database, user)
+	if err != nil {
+		log.Println("notify settings:", err)
+		if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "❌ Не удалось загрузить настройки.")); err != nil {
+			metrics.HandlerErrors.Inc()
+		}
+		return
+	}
+	m := tgbotapi.NewMessage(chatID, text)
+	m.ReplyMarkup = mk
+	if _, err := tg.Send(bot, m); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
+
+// HandleNotifySettingsCallback — кнопки экрана настроек.
+func HandleNotifySettingsCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, user *models.User, cb *tgbotapi.CallbackQuery) {
+	chatID := cb.Message.Chat.ID
+	msgID := cb.Message.MessageID
+	data := cb.Data
+
+	switch {
+	case data == "ns_close":
+		notifySettingsStates.Delete(ctx, chatID)
+		fsmutil.DisableMarkup(bot, chatID, msgID)
+		return
+
+	case data == "ns_quiet":
+		notifySettingsStates.Delete(ctx, chatID)
+		var bs callback.Buttons
+		mk := quietHoursMarkup(&bs)
+		if buttonsFailed(&bs) {
+			return
+		}
+		editNotifySettings(bot, chatID, msgID, quietHoursText(), mk)
+		return
+
+	case data == "ns_quiet_custom":
+		notifySettingsStates.Set(ctx, chatID, &notifySettingsState{MessageID: msgID})
+		notifySettingsStates.Save(ctx, chatID)
+		back := tgbotapi.NewInlineKeyboardMarkup(fsmutil.BackCancelRow("ns_quiet", "ns_close"))
+		editNotifySettings(bot, chatID, msgID, "🌙 Отправьте тихие часы в формате ЧЧ:ММ-ЧЧ:ММ, например 22:30-07:00.", back)
+		return
+
+	case cbNotifyQuietSet.Match(data):
+		from, to, err := cbNotifyQuietSet.Parse(data)
+		if err != nil {
+			return
+		}
+		if err := db.SetQuietHours(ctx, database, user.ID, from, to); err != nil {
+			log.Println("notify settings:", err)
+			notifySettingsAlert(bot, cb.ID)
+			return
+		}
+
+	case cbNotifyToggle.Match(data):
+		k, err := cbNotifyToggle.Parse(data)
+		if err != nil {
+			return
+		}
+		kind := notify.Kind(k)
+		if _, ok := notify.Lookup(kind); !ok {
+			return
+		}
+		s, err := db.GetNotifySettings(ctx, database, user.ID)
+		if err == nil {
+			err = db.SetNotifyPref(ctx, database, user.ID, string(kind), !notify.Enabled(s.Prefs, kind))
+		}
+		if err != nil {
+			log.Println("notify settings:", err)
+			notifySettingsAlert(bot, cb.ID)
+			return
+		}
+
+	case data == "ns_back":
+		notifySettingsStates.Delete(ctx, chatID)
+
+	default:
+		return
+	}
+
+	text, mk, err := notifySettingsView(ctx, database, user)
+	if err != nil {
+		log.Println("notify settings:", err)
+		notifySettingsAlert(bot, cb.ID)
+		return
+	}
+	editNotifySettings(bot, chatID, msgID, text, mk)
+}
+
+// HandleNotifySettingsText — свои тихие часы текстом.
+func HandleNotifySettingsText(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, user *models.User, msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	st := notifySettingsStates.Value(chatID)
+	if st == nil {
+		return
+	}
+	if fsmutil.IsCancelText(msg.Text) {
+		fsmutil.DisableMarkup(bot, chatID, st.MessageID)
+		notifySettingsStates.Delete(ctx, chatID)
+		notifySettingsReply(bot, chatID, "🚫 Отменено.")
+		return
+	}
+	q, err := notify.ParseQuietHours(msg.Text)
+	if err != nil {
+		notifySettingsReply(bot, chatID, "⚠️ Не понял время: "+err.Error()+". Пример: 22:30-07:00.")
+		return
+	}
+	if err := db.SetQuietHours(ctx, database, user.ID, q.From, q.To); err != nil {
+		log.Println("notify settings:", err)
+		notifySettingsReply(bot, chatID, "❌ Не удалось сохранить тихие часы.")
+		return
+	}
+	fsmutil.DisableMarkup(bot, chatID, st.MessageID)
+	notifySettingsStates.Delete(ctx, chatID)
+	HandleNotifySettings(ctx, bot, database, user, chatID)
+}
+
+func notifySettingsView(ctx context.Context, database *sql.DB, user *models.User) (string, tgbotapi.InlineKeyboardMarkup, error) {
+	s, err := db.GetNotifySettings(ctx, database, user.ID)
+	if err != nil {
+		return "", tgbotapi.InlineKeyboardMarkup{}, err
+	}
+	q := notify.QuietHours{From: s.QuietFrom, To: s.QuietTo}
+
+	var b strings.Builder
+	b.WriteString("⚙️ Настройки уведомлений\n")
+	var bs callback.Buttons
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, k := range notify.KindsFor(*user.Role) {
+		mark := "🔕"
+		if notify.Enabled(s.Prefs, k.Kind) {
+			mark = "🔔"
+		}
+		fmt.Fprintf(&b, "\n%s %s", mark, k.Title)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			bs.Add(cbNotifyToggle.Button(mark+" "+k.Title, string(k.Kind))),
+		))
+	}
+	fmt.Fprintf(&b, "\n\n🌙 Тихие часы: %s", q)
+	if q.Enabled() {
+		b.WriteString("\nСообщения, пришедшие в это время, придут после их окончания.")
+	}
+	rows = append(rows,
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("🌙 Тихие часы", "ns_quiet")),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("✖️ Закрыть", "ns_close")),
+	)
+	return b.String(), tgbotapi.NewInlineKeyboardMarkup(rows...), bs.Err()
+}
+
+func quietHoursText() string {
+	return "🌙 Тихие часы — время, когда бот ничего не присылает (по времени школы).\nВыберите вариант или задайте свой:"
+}
+
+func quietHoursMarkup(bs *callback.Buttons) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, q := range quietPresets {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			bs.Add(cbNotifyQuietSet.Button(q.String(), q.From, q.To)),
+		))
+	}
+	rows = append(rows,
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✏️ Своё время", "ns_quiet_custom"),
+			bs.Add(cbNotifyQuietSet.Button("🔔 Без тихих часов", 0, 0)),
+		),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", "ns_back")),
+	)
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func editNotifySettings(bot *tgbotapi.BotAPI, chatID int64, msgID int, text string, mk tgbotapi.InlineKeyboardMarkup) {
+	edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, msgID, text, mk)
+	if _, err := tg.Send(bot, edit); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
+
+func notifySettingsAlert(bot *tgbotapi.BotAPI, cbID string) {
+	if _, err := tg.Request(bot, tgbotapi.NewCallback(cbID, "Не удалось сохранить настройку")); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
+
+func notifySettingsReply(bot *tgbotapi.BotAPI, chatID int64, text string) {
+	if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, text)); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
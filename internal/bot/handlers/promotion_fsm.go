@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmstore"
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmutil"
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/metrics"
+	"github.com/Spok95/telegram-school-bot/internal/tg"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// PromotionFSMState — мастер «Перевод классов»: главное сообщение и ожидание даты.
+type PromotionFSMState struct {
+	MessageID   int
+	AwaitDate   bool
+	PreviewSeen bool // «Перевести сейчас» доступно только после предпросмотра
+}
+
+var promotionStates = fsmstore.NewMap[*PromotionFSMState]("class_promotion", 1, fsmstore.DefaultTTL)
+
+const (
+	promoPreview     = "promo_preview"
+	promoRun         = "promo_run"
+	promoRunYes      = "promo_run_yes"
+	promoSchedule    = "promo_schedule"
+	promoUnschedule  = "promo_unschedule"
+	promoRollback    = "promo_rollback"
+	promoRollbackYes = "promo_rollback_yes"
+	promoBack        = "promo_back"
+	promoCancel      = "promo_cancel"
+)
+
+// PromotionAwaitsDate — мастер ждёт ввода даты (остальной текст идёт мимо него).
+func PromotionAwaitsDate(chatID int64) bool {
+	st := promotionStates.Value(chatID)
+	return st != nil && st.AwaitDate
+}
+
+// StartPromotionFSM показывает состояние переводов и действия мастера.
+func StartPromotionFSM(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	st := &PromotionFSMState{}
+	promotionStates.Set(ctx, chatID, st)
+	defer promotionStates.Save(ctx, chatID)
+
+	out := tgbotapi.NewMessage(chatID, promotionStatusText(ctx, database))
+	out.ReplyMarkup = promotionMenu(ctx, database)
+	sent, err := tg.Send(bot, out)
+	if err != nil {
+		metrics.HandlerErrors.Inc()
+		return
+	}
+	st.MessageID = sent.MessageID
+}
+
+func promotionStatusText(ctx context.Context, database *sql.DB) string {
+	var b strings.Builder
+	b.WriteString("🎓 Перевод в следующий класс\n\n")
+	b.WriteString(fmt.Sprintf("Все активные ученики переходят на класс выше, %d-е классы выпускаются и деактивируются. "+
+		"Родители остаются привязаны к своим детям.\n\n", db.MaxClassNumber))
+
+	if sch, err := db.GetScheduledPromotion(ctx, database); err == nil && sch != nil {
+		b.WriteString(fmt.Sprintf("📅 Запланирован на %s\n", sch.EffectiveDate.Format("02.01.2006")))
+	} else {
+		b.WriteString("📅 Перевод не запланирован\n")
+	}
+	if last, err := db.GetLastPromotion(ctx, database); err == nil && last != nil {
+		b.WriteString(fmt.Sprintf("🕓 Последний: %s — переведено %d, выпущено %d",
+			last.EffectiveDate.Format("02.01.2006"), last.Promoted, last.Graduated))
+		if last.Status == db.PromotionRolledBack {
+			b.WriteString(" (откачен)")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func promotionMenu(ctx context.Context, database *sql.DB) tgbotapi.InlineKeyboardMarkup {
+	rows := [][]tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("👀 Предпросмотр", promoPreview)),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("📅 Запланировать", promoSchedule)),
+	}
+	if sch, err := db.GetScheduledPromotion(ctx, database); err == nil && sch != nil {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("🗑 Снять расписание", promoUnschedule)))
+	}
+	if last, err := db.GetLastPromotion(ctx, database); err == nil && last != nil && last.Status == db.PromotionDone {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("↩️ Откатить последний перевод", promoRollback)))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("❌ Закрыть", promoCancel)))
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// FormatPromotionPlan — текст предпросмотра (используется и джобом в уведомлении).
+func FormatPromotionPlan(plan *db.PromotionPlan) string {
+	if len(plan.Moves) == 0 {
+		return "Нет активных учеников с указанным классом — переводить некого."
+	}
+	var b strings.Builder
+	for _, m := range plan.Moves {
+		if m.ToNumber == 0 {
+			b.WriteString(fmt.Sprintf("• %d%s → выпуск: %d\n", m.FromNumber, m.Letter, m.Students))
+		} else {
+			b.WriteString(fmt.Sprintf("• %d%s → %d%s: %d\n", m.FromNumber, m.Letter, m.ToNumber, m.Letter, m.Students))
+		}
+	}
+	b.WriteString(fmt.Sprintf("\nПереводится: %d, выпускается: %d, родительских связей: %d", plan.Promoted, plan.Graduated, plan.ParentLinks))
+	if plan.NewClasses > 0 {
+		b.WriteString(fmt.Sprintf("\nБудет создано классов: %d", plan.NewClasses))
+	}
+	return b.String()
+}
+
+// HandlePromotionCallback — кнопки мастера.
+func HandlePromotionCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, cb *tgbotapi.CallbackQuery) {
+	chatID := cb.Message.Chat.ID
+	st := promotionStates.Value(chatID)
+	if st == nil {
+		// старая клавиатура после рестарта/таймаута — начинаем заново на том же сообщении
+		st = &PromotionFSMState{MessageID: cb.Message.MessageID}
+		promotionStates.Set(ctx, chatID, st)
+	}
+	defer promotionStates.Save(ctx, chatID)
+
+	switch cb.Data {
+	case promoCancel:
+		fsmutil.DisableMarkup(bot, chatID, st.MessageID)
+		promotionStates.Delete(ctx, chatID)
+		promotionReply(bot, chatID, "🚫 Закрыто.")
+		return
+
+	case promoBack:
+		st.AwaitDate = false
+		editPromotion(bot, chatID, st.MessageID, promotionStatusText(ctx, database), promotionMenu(ctx, database))
+		return
+
+	case promoPreview:
+		plan, err := db.PlanPromotion(ctx, database)
+		if err != nil {
+			metrics.HandlerErrors.Inc()
+			promotionReply(bot, chatID, "⚠️ Не удалось посчитать перевод: "+err.Error())
+			return
+		}
+		st.PreviewSeen = true
+		rows := [][]tgbotapi.InlineKeyboardButton{}
+		if len(plan.Moves) > 0 {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("▶️ Перевести сейчас", promoRun)))
+		}
+		rows = append(rows, fsmutil.BackCancelRow(promoBack, promoCancel))
+		editPromotion(bot, chatID, st.MessageID, "👀 Предпросмотр перевода (ничего не изменено):\n\n"+FormatPromotionPlan(plan),
+			tgbotapi.NewInlineKeyboardMarkup(rows...))
+		return
+
+	case promoRun:
+		if !st.PreviewSeen {
+			promotionReply(bot, chatID, "Сначала посмотрите предпросмотр.")
+			return
+		}
+		editPromotion(bot, chatID, st.MessageID,
+			"⚠️ Перевести всех учеников в следующий класс прямо сейчас? Выпускники будут деактивированы.",
+			tgbotapi.NewInlineKeyboardMarkup(
+				tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("✅ Да, перевести", promoRunYes)),
+				fsmutil.BackCancelRow(promoBack, promoCancel),
+			))
+		return
+
+	case promoRunYes:
+		fsmutil.DisableMarkup(bot, chatID, st.MessageID)
+		p, err := db.ApplyPromotion(ctx, database, actorUserID(ctx, database, chatID), time.Now())
+		promotionStates.Delete(ctx, chatID)
+		if err != nil {
+			if !errors.Is(err, db.ErrPromotionThisYear) {
+				metrics.HandlerErrors.Inc()
+			}
+			promotionReply(bot, chatID, "❌ Перевод не выполнен: "+err.Error())
+			return
+		}
+		promotionReply(bot, chatID, fmt.Sprintf("✅ Перевод выполнен: переведено %d, выпущено %d.", p.Promoted, p.Graduated))
+		return
+
+	case promoSchedule:
+		st.AwaitDate = true
+		editPromotion(bot, chatID, st.MessageID,
+			"📅 Введите дату перевода в формате ДД.ММ.ГГГГ (например, 31.08.2026).\nПеревод выполнится автоматически в этот день.",
+			tgbotapi.NewInlineKeyboardMarkup(fsmutil.BackCancelRow(promoBack, promoCancel)))
+		return
+
+	case promoUnschedule:
+		ok, err := db.CancelScheduledPromotion(ctx, database)
+		if err != nil {
+			metrics.HandlerErrors.Inc()
+			promotionReply(bot, chatID, "⚠️ Не удалось снять расписание: "+err.Error())
+			return
+		}
+		if ok {
+			promotionReply(bot, chatID, "🗑 Расписание перевода снято.")
+		}
+		editPromotion(bot, chatID, st.MessageID, promotionStatusText(ctx, database), promotionMenu(ctx, database))
+		return
+
+	case promoRollback:
+		last, err := db.GetLastPromotion(ctx, database)
+		if err != nil || last == nil || last.Status != db.PromotionDone {
+			promotionReply(bot, chatID, "Откатывать нечего.")
+			return
+		}
+		editPromotion(bot, chatID, st.MessageID,
+			fmt.Sprintf("↩️ Откатить перевод от %s? Ученики вернутся в прежние классы, выпускники снова станут активными. "+
+				"Учеников, которых после перевода переместили вручную, откат не тронет.", last.EffectiveDate.Format("02.01.2006")),
+			tgbotapi.NewInlineKeyboardMarkup(
+				tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("✅ Да, откатить", promoRollbackYes)),
+				fsmutil.BackCancelRow(promoBack, promoCancel),
+			))
+		return
+
+	case promoRollbackYes:
+		fsmutil.DisableMarkup(bot, chatID, st.MessageID)
+		p, restored, err := db.RollbackLastPromotion(ctx, database, actorUserID(ctx, database, chatID))
+		promotionStates.Delete(ctx, chatID)
+		if err != nil {
+			if !errors.Is(err, db.ErrNoPromotion) && !errors.Is(err, db.ErrPromotionNotLatest) {
+				metrics.HandlerErrors.Inc()
+			}
+			promotionReply(bot, chatID, "❌ Откат не выполнен: "+err.Error())
+			return
+		}
+		promotionReply(bot, chatID, fmt.Sprintf("✅ Перевод от %s откачен, восстановлено учеников: %d.", p.EffectiveDate.Format("02.01.2006"), restored))
+		return
+	}
+}
+
+// HandlePromotionText — ввод даты для расписания.
+func HandlePromotionText(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	st := promotionStates.Value(chatID)
+	if st == nil || !st.AwaitDate {
+		return
+	}
+	defer promotionStates.Save(ctx, chatID)
+
+	text := strings.TrimSpace(msg.Text)
+	if fsmutil.IsCancelText(text) {
+		fsmutil.DisableMarkup(bot, chatID, st.MessageID)
+		promotionStates.Delete(ctx, chatID)
+		promotionReply(bot, chatID, "🚫 Закрыто.")
+		return
+	}
+	date, err := time.ParseInLocation("02.01.2006", text, time.Local)
+	if err != nil {
+		promotionReply(bot, chatID, "Не понял дату. Формат: ДД.ММ.ГГГГ, например 31.08.2026.")
+		return
+	}
+	p, err := db.SchedulePromotion(ctx, database, date, actorUserID(ctx, database, chatID), time.Now())
+	if err != nil {
+		if errors.Is(err, db.ErrPromotionDateInPast) {
+			promotionReply(bot, chatID, "Дата уже прошла — укажите сегодняшнюю или будущую.")
+			return
+		}
+		metrics.HandlerErrors.Inc()
+		promotionReply(bot, chatID, "⚠️ Не удалось запланировать: "+err.Error())
+		return
+	}
+	st.AwaitDate = false
+	fsmutil.DisableMarkup(bot, chatID, st.MessageID)
+	promotionStates.Delete(ctx, chatID)
+	promotionReply(bot, chatID, fmt.Sprintf("✅ Перевод запланирован на %s. Перед выполнением посмотрите предпросмотр в «🎓 Перевод классов».",
+		p.EffectiveDate.Format("02.01.2006")))
+}
+
+// actorUserID — users.id админа для журналов (nil, если записи нет).
+func actorUserID(ctx context.Context, database *sql.DB, chatID int64) *int64 {
+	u, err := db.GetUserByTelegramID(ctx, database, chatID)
+	if err != nil || u == nil {
+		return nil
+	}
+	return &u.ID
+}
+
+func editPromotion(bot *tgbotapi.BotAPI, chatID int64, messageID int, text string, mk tgbotapi.InlineKeyboardMarkup) {
+	edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, text, mk)
+	if _, err := tg.Send(bot, edit); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
+
+func promotionReply(bot *tgbotapi.BotAPI, chatID int64, text string) {
+	if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, text)); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
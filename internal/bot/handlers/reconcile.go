@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmutil"
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/metrics"
+	"github.com/Spok95/telegram-school-bot/internal/tg"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// HandleReconcileCollective — /reconcile: сверка collective_score классов с журналом начислений.
+func HandleReconcileCollective(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, chatID int64) {
+	drift, err := db.ReconcileCollective(ctx, database, false)
+	if err != nil {
+		log.Println("reconcile:", err)
+		reconcileReply(bot, chatID, "❌ Не удалось сверить коллективный рейтинг.")
+		return
+	}
+	if len(drift) == 0 {
+		reconcileReply(bot, chatID, "✅ Коллективный рейтинг всех классов совпадает с журналом начислений.")
+		return
+	}
+	m := tgbotapi.NewMessage(chatID, "⚠️ Коллективный рейтинг расходится с журналом начислений:\n\n"+
+		formatDrift(drift)+"\n\nИсправить — записать значения из журнала?")
+	m.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🛠 Исправить", "reconcile_fix"),
+		tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", "reconcile_cancel"),
+	))
+	if _, err := tg.Send(bot, m); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
+
+// HandleReconcileCallback — подтверждение исправления расхождений.
+func HandleReconcileCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, cb *tgbotapi.CallbackQuery) {
+	chatID := cb.Message.Chat.ID
+	fsmutil.DisableMarkup(bot, chatID, cb.Message.MessageID)
+	if cb.Data != "reconcile_fix" {
+		reconcileReply(bot, chatID, "🚫 Сверка отменена, значения не менялись.")
+		return
+	}
+	// сверяем заново: за время раздумий могли прийти новые начисления
+	drift, err := db.ReconcileCollective(ctx, database, true)
+	if err != nil {
+		log.Println("reconcile fix:", err)
+		reconcileReply(bot, chatID, "❌ Не удалось исправить коллективный рейтинг.")
+		return
+	}
+	if len(drift) == 0 {
+		reconcileReply(bot, chatID, "✅ Расхождений уже нет.")
+		return
+	}
+	reconcileReply(bot, chatID, "✅ Исправлено по журналу:\n\n"+formatDrift(drift))
+}
+
+func formatDrift(drift []db.CollectiveDrift) string {
+	var b strings.Builder
+	for _, d := range drift {
+		fmt.Fprintf(&b, "• %d%s: было %d, по журналу %d\n", d.ClassNumber, d.ClassLetter, d.Stored, d.Computed)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func reconcileReply(bot *tgbotapi.BotAPI, chatID int64, text string) {
+	if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, text)); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
@@ -5,10 +5,11 @@ import (
 	"database/sql"
 	"fmt"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmstore"
 	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmutil"
 	"github.com/Spok95/telegram-school-bot/internal/db"
 	"github.com/Spok95/telegram-school-bot/internal/metrics"
@@ -27,7 +28,16 @@ type RemoveFSMState struct {
 	Comment            string
 }
 
-var removeStates = make(map[int64]*RemoveFSMState)
+var removeStates = fsmstore.NewMap[*RemoveFSMState]("remove_score", 1, fsmstore.DefaultTTL)
+
+// Кнопки мастера списания (формат — см. пакет callback).
+var (
+	cbRemoveClassNum    = callback.NewAction1("remove_class_num_", callback.Num)
+	cbRemoveClassLetter = callback.NewAction1("remove_class_letter_", callback.Word(8))
+	cbRemoveStudent     = callback.NewAction1("remove_student_", callback.ID)
+	cbRemoveCategory    = callback.NewAction1("remove_category_", callback.IntID)
+	cbRemoveLevel       = callback.NewAction1("remove_level_", callback.IntID)
+)
 
 // ===== helpers
 
@@ -65,11 +75,10 @@ func StartRemoveScoreFSM(ctx context.Context, bot *tgbotapi.BotAPI, database *sq
 		}
 		return
 	}
-	delete(removeStates, chatID)
-	removeStates[chatID] = &RemoveFSMState{
+	removeStates.Set(ctx, chatID, &RemoveFSMState{
 		Step:               1,
 		SelectedStudentIDs: []int64{},
-	}
+	})
 
 	out := tgbotapi.NewMessage(chatID, "Выберите номер класса:")
 
@@ -94,15 +103,18 @@ func StartRemoveScoreFSM(ctx context.Context, bot *tgbotapi.BotAPI, database *sq
 	}
 	sort.Ints(nums)
 
+	var bs callback.Buttons
 	var rows [][]tgbotapi.InlineKeyboardButton
 	for _, n := range nums {
-		cb := fmt.Sprintf("remove_class_num_%d", n)
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d класс", n), cb),
+			bs.Add(cbRemoveClassNum.Button(fmt.Sprintf("%d класс", n), n)),
 		))
 	}
 	rows = append(rows, removeBackCancelRow())
 
+	if buttonsFailed(&bs) {
+		return
+	}
 	out.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
 	if _, err := tg.Send(bot, out); err != nil {
 		metrics.HandlerErrors.Inc()
@@ -113,15 +125,17 @@ func StartRemoveScoreFSM(ctx context.Context, bot *tgbotapi.BotAPI, database *sq
 
 func HandleRemoveCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, cq *tgbotapi.CallbackQuery) {
 	chatID := cq.From.ID
-	state, ok := removeStates[chatID]
+	state, ok := removeStates.Get(chatID)
 	if !ok {
 		return
 	}
+	defer removeStates.Save(ctx, chatID)
 	data := cq.Data
+	var bs callback.Buttons
 
 	// ❌ Отмена — погасить клавиатуру у ЭТОГО сообщения и заменить текст
 	if data == "remove_cancel" {
-		delete(removeStates, chatID)
+		removeStates.Delete(ctx, chatID)
 		fsmutil.DisableMarkup(bot, chatID, cq.Message.MessageID)
 		edit := tgbotapi.NewEditMessageText(chatID, cq.Message.MessageID, "🚫 Списание отменено.")
 		if _, err := tg.Send(bot, edit); err != nil {
@@ -154,13 +168,15 @@ func HandleRemoveCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 
 			var rows [][]tgbotapi.InlineKeyboardButton
 			for _, n := range nums {
-				cb := fmt.Sprintf("remove_class_num_%d", n)
 				rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-					tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d класс", n), cb),
+					bs.Add(cbRemoveClassNum.Button(fmt.Sprintf("%d класс", n), n)),
 				))
 			}
 			rows = append(rows, removeBackCancelRow())
 
+			if buttonsFailed(&bs) {
+				return
+			}
 			removeEditMenu(bot, chatID, cq.Message.MessageID, "Выберите номер класса:", rows)
 			return
 		case 3: // назад к букве
@@ -178,11 +194,14 @@ func HandleRemoveCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 					continue
 				}
 				rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-					tgbotapi.NewInlineKeyboardButtonData(strings.ToUpper(c.Letter), "remove_class_letter_"+strings.ToUpper(c.Letter)),
+					bs.Add(cbRemoveClassLetter.Button(strings.ToUpper(c.Letter), strings.ToUpper(c.Letter))),
 				))
 			}
 			rows = append(rows, removeBackCancelRow())
 
+			if buttonsFailed(&bs) {
+				return
+			}
 			removeEditMenu(bot, chatID, cq.Message.MessageID, "Выберите букву класса:", rows)
 			return
 		case 4: // назад к ученикам
@@ -194,15 +213,17 @@ func HandleRemoveCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 				if containsInt64(state.SelectedStudentIDs, s.ID) {
 					label = "✅ " + label
 				}
-				cb := fmt.Sprintf("remove_student_%d", s.ID)
 				rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-					tgbotapi.NewInlineKeyboardButtonData(label, cb),
+					bs.Add(cbRemoveStudent.Button(label, s.ID)),
 				))
 			}
 			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
 				tgbotapi.NewInlineKeyboardButtonData("✅ Выбрать всех", "remove_select_all_students"),
 			))
 			rows = append(rows, removeBackCancelRow())
+			if buttonsFailed(&bs) {
+				return
+			}
 			removeEditMenu(bot, chatID, cq.Message.MessageID, "Выберите ученика или учеников:", rows)
 			return
 		case 5: // назад к категориям
@@ -219,12 +240,14 @@ func HandleRemoveCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 			}
 			var rows [][]tgbotapi.InlineKeyboardButton
 			for _, c := range categories {
-				cb := fmt.Sprintf("remove_category_%d", c.ID)
 				rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-					tgbotapi.NewInlineKeyboardButtonData(c.Name, cb),
+					bs.Add(cbRemoveCategory.Button(c.Name, c.ID)),
 				))
 			}
 			rows = append(rows, removeBackCancelRow())
+			if buttonsFailed(&bs) {
+				return
+			}
 			removeEditMenu(bot, chatID, cq.Message.MessageID, "Выберите категорию:", rows)
 			return
 		case 6: // текстовый комментарий → назад к уровням
@@ -232,16 +255,18 @@ func HandleRemoveCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 			levels, _ := db.GetLevelsByCategoryIDFull(ctx, database, int64(state.CategoryID), false)
 			var rows [][]tgbotapi.InlineKeyboardButton
 			for _, l := range levels {
-				cb := fmt.Sprintf("remove_level_%d", l.ID)
 				rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-					tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%s (%d)", l.Label, l.Value), cb),
+					bs.Add(cbRemoveLevel.Button(fmt.Sprintf("%s (%d)", l.Label, l.Value), l.ID)),
 				))
 			}
 			rows = append(rows, removeBackCancelRow())
+			if buttonsFailed(&bs) {
+				return
+			}
 			removeEditMenu(bot, chatID, cq.Message.MessageID, "Выберите уровень:", rows)
 			return
 		default:
-			delete(removeStates, chatID)
+			removeStates.Delete(ctx, chatID)
 			fsmutil.DisableMarkup(bot, chatID, cq.Message.MessageID)
 			edit := tgbotapi.NewEditMessageText(chatID, cq.Message.MessageID, "🚫 Списание отменено.")
 			if _, err := tg.Send(bot, edit); err != nil {
@@ -253,10 +278,12 @@ func HandleRemoveCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 
 	// ===== обычные ветки
 
-	if strings.HasPrefix(data, "remove_class_num_") {
-		numStr := strings.TrimPrefix(data, "remove_class_num_")
-		num, _ := strconv.ParseInt(numStr, 10, 64)
-		state.ClassNumber = num
+	if cbRemoveClassNum.Match(data) {
+		num, err := cbRemoveClassNum.Parse(data)
+		if err != nil {
+			return
+		}
+		state.ClassNumber = int64(num)
 		state.Step = 2
 
 		classes, err := db.ListVisibleClasses(ctx, database)
@@ -271,22 +298,29 @@ func HandleRemoveCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 				continue
 			}
 			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData(strings.ToUpper(c.Letter), "remove_class_letter_"+strings.ToUpper(c.Letter)),
+				bs.Add(cbRemoveClassLetter.Button(strings.ToUpper(c.Letter), strings.ToUpper(c.Letter))),
 			))
 		}
 		rows = append(rows, removeBackCancelRow())
 
+		if buttonsFailed(&bs) {
+			return
+		}
 		removeEditMenu(bot, chatID, cq.Message.MessageID, "Выберите букву класса:", rows)
 		return
 	}
 
-	if strings.HasPrefix(data, "remove_class_letter_") {
-		state.ClassLetter = strings.TrimPrefix(data, "remove_class_letter_")
+	if cbRemoveClassLetter.Match(data) {
+		letter, err := cbRemoveClassLetter.Parse(data)
+		if err != nil {
+			return
+		}
+		state.ClassLetter = letter
 		state.Step = 3
 
 		students, _ := db.GetStudentsByClass(ctx, database, state.ClassNumber, state.ClassLetter)
 		if len(students) == 0 {
-			delete(removeStates, chatID)
+			removeStates.Delete(ctx, chatID)
 			fsmutil.DisableMarkup(bot, chatID, cq.Message.MessageID)
 			edit := tgbotapi.NewEditMessageText(chatID, cq.Message.MessageID, "❌ В этом классе нет учеников.")
 			if _, err := tg.Send(bot, edit); err != nil {
@@ -297,24 +331,27 @@ func HandleRemoveCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 
 		var rows [][]tgbotapi.InlineKeyboardButton
 		for _, s := range students {
-			cb := fmt.Sprintf("remove_student_%d", s.ID)
 			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData(s.Name, cb),
+				bs.Add(cbRemoveStudent.Button(s.Name, s.ID)),
 			))
 		}
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("✅ Выбрать всех", "remove_select_all_students"),
 		))
 		rows = append(rows, removeBackCancelRow())
+		if buttonsFailed(&bs) {
+			return
+		}
 		removeEditMenu(bot, chatID, cq.Message.MessageID, "Выберите ученика или учеников:", rows)
 		return
 	}
 
-	if strings.HasPrefix(data, "remove_student_") || data == "remove_select_all_students" {
-		idStr := strings.TrimPrefix(data, "remove_student_")
-		id, _ := strconv.ParseInt(idStr, 10, 64)
-
+	if cbRemoveStudent.Match(data) || data == "remove_select_all_students" {
 		if data != "remove_select_all_students" {
+			id, err := cbRemoveStudent.Parse(data)
+			if err != nil {
+				return
+			}
 			// toggle
 			removed := false
 			for i, sid := range state.SelectedStudentIDs {
@@ -352,9 +389,8 @@ func HandleRemoveCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 			if containsInt64(state.SelectedStudentIDs, s.ID) {
 				label = "✅ " + label
 			}
-			cb := fmt.Sprintf("remove_student_%d", s.ID)
 			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData(label, cb),
+				bs.Add(cbRemoveStudent.Button(label, s.ID)),
 			))
 		}
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
@@ -366,6 +402,9 @@ func HandleRemoveCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 			))
 		}
 		rows = append(rows, removeBackCancelRow())
+		if buttonsFailed(&bs) {
+			return
+		}
 		removeEditMenu(bot, chatID, cq.Message.MessageID, "Выберите ученика или учеников:", rows)
 		return
 	}
@@ -384,36 +423,46 @@ func HandleRemoveCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 		}
 		var rows [][]tgbotapi.InlineKeyboardButton
 		for _, c := range categories {
-			cb := fmt.Sprintf("remove_category_%d", c.ID)
 			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData(c.Name, cb),
+				bs.Add(cbRemoveCategory.Button(c.Name, c.ID)),
 			))
 		}
 		rows = append(rows, removeBackCancelRow())
+		if buttonsFailed(&bs) {
+			return
+		}
 		removeEditMenu(bot, chatID, cq.Message.MessageID, "Выберите категорию:", rows)
 		return
 	}
 
-	if strings.HasPrefix(data, "remove_category_") {
-		catID, _ := strconv.Atoi(strings.TrimPrefix(data, "remove_category_"))
+	if cbRemoveCategory.Match(data) {
+		catID, err := cbRemoveCategory.Parse(data)
+		if err != nil {
+			return
+		}
 		state.CategoryID = catID
 		state.Step = 5
 
 		levels, _ := db.GetLevelsByCategoryIDFull(ctx, database, int64(state.CategoryID), false)
 		var rows [][]tgbotapi.InlineKeyboardButton
 		for _, l := range levels {
-			cb := fmt.Sprintf("remove_level_%d", l.ID)
 			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%s (%d)", l.Label, l.Value), cb),
+				bs.Add(cbRemoveLevel.Button(fmt.Sprintf("%s (%d)", l.Label, l.Value), l.ID)),
 			))
 		}
 		rows = append(rows, removeBackCancelRow())
+		if buttonsFailed(&bs) {
+			return
+		}
 		removeEditMenu(bot, chatID, cq.Message.MessageID, "Выберите уровень:", rows)
 		return
 	}
 
-	if strings.HasPrefix(data, "remove_level_") {
-		lvlID, _ := strconv.Atoi(strings.TrimPrefix(data, "remove_level_"))
+	if cbRemoveLevel.Match(data) {
+		lvlID, err := cbRemoveLevel.Parse(data)
+		if err != nil {
+			return
+		}
 		state.LevelID = lvlID
 		state.Step = 6
 
@@ -428,14 +477,15 @@ func HandleRemoveCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *s
 
 func HandleRemoveText(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, msg *tgbotapi.Message) {
 	chatID := msg.Chat.ID
-	state, ok := removeStates[chatID]
+	state, ok := removeStates.Get(chatID)
 	if !ok || state.Step != 6 {
 		return
 	}
+	defer removeStates.Save(ctx, chatID)
 
 	// поддержка текстовой отмены
 	if fsmutil.IsCancelText(msg.Text) {
-		delete(removeStates, chatID)
+		removeStates.Delete(ctx, chatID)
 		if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "🚫 Списание отменено.")); err != nil {
 			metrics.HandlerErrors.Inc()
 		}
@@ -476,7 +526,7 @@ func HandleRemoveText(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.D
 		if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "❌ Не удалось определить активный период.")); err != nil {
 			metrics.HandlerErrors.Inc()
 		}
-		delete(removeStates, chatID)
+		removeStates.Delete(ctx, chatID)
 		return
 	}
 
@@ -511,10 +561,10 @@ func HandleRemoveText(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.D
 	if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, msgText)); err != nil {
 		metrics.HandlerErrors.Inc()
 	}
-	delete(removeStates, chatID)
+	removeStates.Delete(ctx, chatID)
 }
 
 // GetRemoveScoreState доступ из main.go
 func GetRemoveScoreState(chatID int64) *RemoveFSMState {
-	return removeStates[chatID]
+	return removeStates.Value(chatID)
 }
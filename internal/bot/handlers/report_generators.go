@@ -5,7 +5,6 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
-	"strings"
 	"time"
 
 	"github.com/Spok95/telegram-school-bot/internal/export"
@@ -67,75 +66,14 @@ func generateStudentReport(scores []models.ScoreWithUser, collective int64, clas
 
 // 🏫 По классу
 func generateClassReport(scores []models.ScoreWithUser, collective int64, className string, periodTitle string) (string, error) {
-	type studentGroup struct {
-		Name         string
-		Total        int
-		Class        string
-		Contribution int
-	}
-
-	studentMap := make(map[string]*studentGroup)
-	for _, s := range scores {
-		key := s.StudentName
-		if _, exists := studentMap[key]; !exists {
-			studentMap[key] = &studentGroup{
-				Name:  s.StudentName,
-				Class: fmt.Sprintf("%d%s", s.ClassNumber, s.ClassLetter),
-			}
-		}
-		studentMap[key].Total += s.Points
-	}
-
-	for _, s := range scores {
-		key := s.StudentName
-		if s.CategoryLabel != "Аукцион" {
-			studentMap[key].Contribution += s.Points
-		}
-	}
-
-	// Вычисляем вклад
-	for _, s := range studentMap {
-		s.Contribution = s.Contribution * 30 / 100
-	}
-
-	// Сортировка по убыванию
-	var groups []studentGroup
-	for _, v := range studentMap {
-		groups = append(groups, *v)
-	}
-	sort.Slice(groups, func(i, j int) bool {
-		return strings.ToLower(groups[i].Name) < strings.ToLower(groups[j].Name)
-	})
-
-	f := excelize.NewFile()
-	sheet := "ClassReport"
-	if err := f.SetSheetName("Sheet1", sheet); err != nil {
-		return "", err
-	}
-
-	headers := []string{"ФИО ученика", "Класс", "Суммарный балл", "Вклад в коллективный рейтинг", "Коллективный рейтинг класса"}
-	for i, h := range headers {
-		cell := fmt.Sprintf("%s1", string(rune('A'+i)))
-		if err := f.SetCellValue(sheet, cell, h); err != nil {
-			return "", err
-		}
-	}
-	for i, g := range groups {
-		row := i + 2
-		_ = f.SetCellValue(sheet, fmt.Sprintf("A%d", row), g.Name)
-		_ = f.SetCellValue(sheet, fmt.Sprintf("B%d", row), g.Class)
-		_ = f.SetCellValue(sheet, fmt.Sprintf("C%d", row), g.Total)
-		_ = f.SetCellValue(sheet, fmt.Sprintf("D%d", row), g.Contribution)
-		_ = f.SetCellValue(sheet, fmt.Sprintf("E%d", row), collective)
-	}
-
-	if err := export.ApplyDefaultExcelFormatting(f, sheet); err != nil {
+	f, err := export.ClassScoresWorkbook(export.ClassScoreRows(scores, collective))
+	if err != nil {
 		return "", err
 	}
 	ts := time.Now().Format("20060102-1504")
 	filename := export.BuildClassReportFilename(className, periodTitle, ts)
 	path := filepath.Join(os.TempDir(), filename)
-	err := f.SaveAs(path)
+	err = f.SaveAs(path)
 	return path, err
 }
 
@@ -143,7 +81,6 @@ func generateClassReport(scores []models.ScoreWithUser, collective int64, classN
 func generateSchoolReport(scores []models.ScoreWithUser) (string, error) {
 	type classStat struct {
 		Name   string
-		Total  int
 		Rating int
 	}
 	classMap := make(map[string]*classStat)
@@ -153,15 +90,8 @@ func generateSchoolReport(scores []models.ScoreWithUser) (string, error) {
 		if _, exists := classMap[classKey]; !exists {
 			classMap[classKey] = &classStat{Name: classKey}
 		}
-		// Учитываем только баллы НЕ из категории "Аукцион"
-		if s.CategoryLabel != "Аукцион" {
-			classMap[classKey].Total += s.Points
-		}
-	}
-
-	// Рассчитываем рейтинг как 30% от общей суммы баллов
-	for _, class := range classMap {
-		class.Rating = class.Total * 30 / 100
+		// вклад каждой записи посчитан по правилу категории при записи в журнал
+		classMap[classKey].Rating += s.Collective
 	}
 
 	// Сортировка классов по убыванию рейтинга
@@ -182,8 +112,8 @@ func generateSchoolReport(scores []models.ScoreWithUser) (string, error) {
 		if numI != numJ {
 			return numI < numJ
 		}
-		if classes[i].Total != classes[j].Total {
-			return classes[i].Total > classes[j].Total
+		if classes[i].Rating != classes[j].Rating {
+			return classes[i].Rating > classes[j].Rating
 		}
 		return letI < letJ
 	})
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmstore"
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmutil"
+	"github.com/Spok95/telegram-school-bot/internal/ctxutil"
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/metrics"
+	"github.com/Spok95/telegram-school-bot/internal/roster"
+	"github.com/Spok95/telegram-school-bot/internal/tg"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// rosterWaiting — id сообщения с кнопкой «Отмена», пока бот ждёт файл со списком.
+var rosterWaiting = fsmstore.NewMap[int]("roster_upload", 1, time.Hour)
+
+// RosterImportActive — админ нажал «📋 Импорт списка классов» и бот ждёт файл.
+func RosterImportActive(chatID int64) bool { return rosterWaiting.Value(chatID) != 0 }
+
+// StartRosterImport — просим прислать .xlsx/.csv со списком учеников.
+func StartRosterImport(ctx context.Context, bot *tgbotapi.BotAPI, msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	text := "📋 Импорт списка классов\n\n" +
+		"Пришлите файл .xlsx или .csv (UTF-8). Колонки:\n" +
+		"• «ФИО» — ФИО ученика\n" +
+		"• «Класс» — например, 5А\n" +
+		"• «ФИО родителя», «Телефон» — необязательно\n\n" +
+		"Новые ученики заводятся сразу подтверждёнными и привязываются к Telegram, " +
+		"когда ребёнок (или родитель) зарегистрируется с теми же ФИО и классом. " +
+		"В ответ пришлю отчёт: кого создал, кого нашёл в базе и какие строки отклонил."
+	m := tgbotapi.NewMessage(chatID, text)
+	m.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", "roster_cancel")),
+	)
+	sent, err := tg.Send(bot, m)
+	if err != nil {
+		metrics.HandlerErrors.Inc()
+		return
+	}
+	rosterWaiting.Set(ctx, chatID, sent.MessageID)
+}
+
+// HandleRosterImportCallback — отмена ожидания файла.
+func HandleRosterImportCallback(ctx context.Context, bot *tgbotapi.BotAPI, cb *tgbotapi.CallbackQuery) {
+	chatID := cb.Message.Chat.ID
+	if cb.Data != "roster_cancel" {
+		return
+	}
+	rosterWaiting.Delete(ctx, chatID)
+	fsmutil.DisableMarkup(bot, chatID, cb.Message.MessageID)
+	if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, "🚫 Импорт списка отменён.")); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
+
+// HandleRosterImportMessage — ждём документ; текст «Отмена» выходит из сценария.
+func HandleRosterImportMessage(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	if fsmutil.IsCancelText(msg.Text) {
+		fsmutil.DisableMarkup(bot, chatID, rosterWaiting.Value(chatID))
+		rosterWaiting.Delete(ctx, chatID)
+		rosterReply(bot, chatID, "🚫 Импорт списка отменён.")
+		return
+	}
+	if msg.Document == nil {
+		rosterReply(bot, chatID, "Пришлите файл со списком: .xlsx или .csv.")
+		return
+	}
+	if msg.Document.FileSize > roster.MaxFileSize {
+		rosterReply(bot, chatID, fmt.Sprintf("❌ Файл слишком большой (больше %d МБ).", roster.MaxFileSize>>20))
+		return
+	}
+
+	ctx, cancel := ctxutil.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	path, err := downloadTelegramFile(ctx, bot, msg.Document.FileID, msg.Document.FileName)
+	if err != nil {
+		rosterReply(bot, chatID, fmt.Sprintf("❌ Не удалось скачать файл: %v", err))
+		return
+	}
+	defer func() { _ = os.Remove(path) }()
+	f, err := os.Open(path)
+	if err != nil {
+		metrics.HandlerErrors.Inc()
+		rosterReply(bot, chatID, fmt.Sprintf("❌ Не удалось открыть файл: %v", err))
+		return
+	}
+	defer func() { _ = f.Close() }()
+
+	var createdBy *int64
+	if u, err := db.GetUserByTelegramID(ctx, database, chatID); err == nil && u != nil {
+		createdBy = &u.ID
+	}
+	res, report, err := roster.Import(ctx, database, msg.Document.FileName, f, db.RosterSourceBot, createdBy)
+	if err != nil {
+		log.Println("roster import:", err)
+		// файл можно поправить и прислать заново — сценарий не закрываем
+		rosterReply(bot, chatID, "❌ Импорт не выполнен: "+err.Error()+"\nИсправьте файл и пришлите снова или нажмите «❌ Отмена».")
+		return
+	}
+	fsmutil.DisableMarkup(bot, chatID, rosterWaiting.Value(chatID))
+	rosterWaiting.Delete(ctx, chatID)
+
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{
+		Name:  fmt.Sprintf("roster_report_%s.xlsx", time.Now().Format("2006-01-02_1504")),
+		Bytes: report,
+	})
+	doc.Caption = "📋 Импорт списка завершён\n" + roster.Summary(res)
+	if _, err := tg.Send(bot, doc); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
+
+func rosterReply(bot *tgbotapi.BotAPI, chatID int64, text string) {
+	if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, text)); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
@@ -0,0 +1,513 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmstore"
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmutil"
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/metrics"
+	"github.com/Spok95/telegram-school-bot/internal/models"
+	"github.com/Spok95/telegram-school-bot/internal/notify"
+	"github.com/Spok95/telegram-school-bot/internal/tg"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Шаги, на которых бот ждёт текст.
+const (
+	scoreFixStepQuery  = 1 // ФИО ученика или автора
+	scoreFixStepReason = 2 // причина исправления
+)
+
+// Что делаем с начислением.
+const (
+	scoreFixRevoke = "revoke"
+	scoreFixChange = "change"
+)
+
+type scoreFixState struct {
+	Step       int
+	MessageID  int
+	By         string // "student" | "author"
+	UserID     int64  // выбранный ученик или автор
+	ScoreID    int64
+	Action     string
+	CategoryID int64
+	Points     int
+	Reason     string
+}
+
+// Кнопки с аргументом (формат — см. пакет callback).
+var (
+	cbFixBy       = callback.NewAction1("scorefix_by:", callback.Word(7)) // "student" | "author"
+	cbFixUser     = callback.NewAction1("scorefix_user:", callback.ID)
+	cbFixPick     = callback.NewAction1("scorefix_pick:", callback.ID) // scoreID
+	cbFixCategory = callback.NewAction1("scorefix_cat:", callback.ID)
+	cbFixLevel    = callback.NewAction1("scorefix_lvl:", callback.IntID)
+)
+
+var scoreFixStates = fsmstore.NewMap[*scoreFixState]("score_fix", 1, fsmstore.DefaultTTL)
+
+// ScoreFixTextActive — сценарий ждёт ввод текста (поиск или причина).
+func ScoreFixTextActive(chatID int64) bool {
+	st := scoreFixStates.Value(chatID)
+	return st != nil && (st.Step == scoreFixStepQuery || st.Step == scoreFixStepReason)
+}
+
+// StartScoreFixFSM — «📝 Исправить начисление»: выбор, по кому искать.
+func StartScoreFixFSM(ctx context.Context, bot *tgbotapi.BotAPI, msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	m := tgbotapi.NewMessage(chatID, scoreFixStartText)
+	m.ReplyMarkup = scoreFixStartMarkup()
+	sent, err := tg.Send(bot, m)
+	if err != nil {
+		metrics.HandlerErrors.Inc()
+		return
+	}
+	scoreFixStates.Set(ctx, chatID, &scoreFixState{MessageID: sent.MessageID})
+}
+
+const scoreFixStartText = "📝 Исправить начисление\n\nНайти начисление по ученику или по тому, кто его сделал:"
+
+func scoreFixStartMarkup() tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("👤 По ученику", "scorefix_by:student"),
+			tgbotapi.NewInlineKeyboardButtonData("✍️ По автору", "scorefix_by:author"),
+		),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", "scorefix_cancel")),
+	)
+}
+
+// HandleScoreFixText — поиск пользователя и ввод причины.
+func HandleScoreFixText(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	st := scoreFixStates.Value(chatID)
+	if st == nil {
+		return
+	}
+	if fsmutil.IsCancelText(msg.Text) {
+		fsmutil.DisableMarkup(bot, chatID, st.MessageID)
+		scoreFixStates.Delete(ctx, chatID)
+		scoreFixReply(bot, chatID, "🚫 Исправление отменено.")
+		return
+	}
+	defer scoreFixStates.Save(ctx, chatID)
+
+	switch st.Step {
+	case scoreFixStepQuery:
+		scoreFixShowUsers(ctx, bot, database, chatID, st, strings.TrimSpace(msg.Text))
+	case scoreFixStepReason:
+		reason := strings.Join(strings.Fields(msg.Text), " ")
+		if len([]rune(reason)) < 3 {
+			scoreFixReply(bot, chatID, "Причина обязательна — опишите её хотя бы парой слов.")
+			return
+		}
+		st.Reason = reason
+		st.Step = 0
+		scoreFixConfirm(ctx, bot, database, chatID, st)
+	}
+}
+
+// HandleScoreFixCallback — кнопки сценария (префикс scorefix_).
+func HandleScoreFixCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, cb *tgbotapi.CallbackQuery) {
+	chatID := cb.Message.Chat.ID
+	data := cb.Data
+	if _, err := tg.Request(bot, tgbotapi.NewCallback(cb.ID, "")); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+	st := scoreFixStates.Value(chatID)
+	if st == nil || st.MessageID != cb.Message.MessageID {
+		fsmutil.DisableMarkup(bot, chatID, cb.Message.MessageID)
+		return
+	}
+	defer scoreFixStates.Save(ctx, chatID)
+	// любая кнопка прерывает ожидание текста; нужные шаги включают его снова
+	st.Step = 0
+
+	switch {
+	case data == "scorefix_cancel":
+		fsmutil.DisableMarkup(bot, chatID, st.MessageID)
+		scoreFixStates.Delete(ctx, chatID)
+		scoreFixEdit(bot, chatID, st.MessageID, "🚫 Исправление отменено.", nil)
+
+	case data == "scorefix_back":
+		*st = scoreFixState{MessageID: st.MessageID}
+		mk := scoreFixStartMarkup()
+		scoreFixEdit(bot, chatID, st.MessageID, scoreFixStartText, &mk)
+
+	case cbFixBy.Match(data):
+		by, err := cbFixBy.Parse(data)
+		if err != nil {
+			return
+		}
+		st.By = by
+		st.Step = scoreFixStepQuery
+		text := "Введите ФИО ученика или класс (например, 7А):"
+		if st.By == "author" {
+			text = "Введите ФИО учителя или администратора, который делал начисление:"
+		}
+		mk := tgbotapi.NewInlineKeyboardMarkup(fsmutil.BackCancelRow("scorefix_back", "scorefix_cancel"))
+		scoreFixEdit(bot, chatID, st.MessageID, text, &mk)
+
+	case cbFixUser.Match(data):
+		id, err := cbFixUser.Parse(data)
+		if err != nil {
+			return
+		}
+		st.UserID = id
+		scoreFixShowScores(ctx, bot, database, chatID, st)
+
+	case cbFixPick.Match(data):
+		id, err := cbFixPick.Parse(data)
+		if err != nil {
+			return
+		}
+		st.ScoreID = id
+		scoreFixShowScore(ctx, bot, database, chatID, st)
+
+	case data == "scorefix_list":
+		scoreFixShowScores(ctx, bot, database, chatID, st)
+
+	case data == "scorefix_revoke":
+		st.Action = scoreFixRevoke
+		scoreFixAskReason(bot, chatID, st)
+
+	case data == "scorefix_change":
+		scoreFixShowCategories(ctx, bot, database, chatID, st)
+
+	case cbFixCategory.Match(data):
+		id, err := cbFixCategory.Parse(data)
+		if err != nil {
+			return
+		}
+		st.CategoryID = id
+		scoreFixShowLevels(ctx, bot, database, chatID, st)
+
+	case cbFixLevel.Match(data):
+		levelID, err := cbFixLevel.Parse(data)
+		if err != nil {
+			return
+		}
+		level, err := db.GetLevelByID(ctx, database, levelID)
+		if err != nil || int64(level.CategoryID) != st.CategoryID {
+			scoreFixShowLevels(ctx, bot, database, chatID, st)
+			return
+		}
+		cur, err := db.GetCorrectableScore(ctx, database, st.ScoreID)
+		if err != nil {
+			scoreFixGone(bot, chatID, st, err)
+			return
+		}
+		st.Action = scoreFixChange
+		st.Points = level.Value
+		if cur.Type == "remove" {
+			st.Points = -level.Value
+		}
+		scoreFixAskReason(bot, chatID, st)
+
+	case data == "scorefix_apply":
+		scoreFixApply(ctx, bot, database, chatID, st)
+	}
+}
+
+func scoreFixShowUsers(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, chatID int64, st *scoreFixState, q string) {
+	users, err := db.FindUsersByQuery(ctx, database, q, 50)
+	if err != nil {
+		log.Println("score fix: find users:", err)
+	}
+	var bs callback.Buttons
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, u := range users {
+		if u.Role == nil || len(rows) >= 20 {
+			continue
+		}
+		isStudent := *u.Role == models.Student
+		if (st.By == "student") != isStudent || *u.Role == models.Parent {
+			continue
+		}
+		label := u.Name
+		if isStudent && u.ClassNumber != nil && u.ClassLetter != nil {
+			label = fmt.Sprintf("%s • %d%s", u.Name, *u.ClassNumber, *u.ClassLetter)
+		} else if !isStudent {
+			label = fmt.Sprintf("%s • %s", u.Name, humanRole(string(*u.Role)))
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			bs.Add(cbFixUser.Button(label, u.ID))))
+	}
+	rows = append(rows, fsmutil.BackCancelRow("scorefix_back", "scorefix_cancel"))
+	if buttonsFailed(&bs) {
+		return
+	}
+	mk := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	if len(rows) == 1 {
+		scoreFixEdit(bot, chatID, st.MessageID, "Никого не нашёл. Попробуйте другой запрос:", &mk)
+		return
+	}
+	st.Step = 0
+	scoreFixEdit(bot, chatID, st.MessageID, "Выберите из списка:", &mk)
+}
+
+func scoreFixShowScores(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, chatID int64, st *scoreFixState) {
+	f := db.ScoreFilter{StudentID: st.UserID}
+	if st.By == "author" {
+		f = db.ScoreFilter{AuthorID: st.UserID}
+	}
+	list, err := db.ListCorrectableScores(ctx, database, f, 15)
+	if err != nil {
+		log.Println("score fix: list scores:", err)
+		metrics.HandlerErrors.Inc()
+	}
+	var bs callback.Buttons
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, s := range list {
+		label := fmt.Sprintf("%s • %s • %s %+d", s.CreatedAt.Format("02.01"), shortName(s.StudentName), s.CategoryName, s.Points)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			bs.Add(cbFixPick.Button(label, s.ScoreID))))
+	}
+	rows = append(rows, fsmutil.BackCancelRow("scorefix_back", "scorefix_cancel"))
+	if buttonsFailed(&bs) {
+		return
+	}
+	mk := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	text := "Последние действующие начисления — выберите нужное:"
+	if len(list) == 0 {
+		text = "Действующих начислений не найдено."
+	}
+	scoreFixEdit(bot, chatID, st.MessageID, text, &mk)
+}
+
+func scoreFixShowScore(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, chatID int64, st *scoreFixState) {
+	s, err := db.GetCorrectableScore(ctx, database, st.ScoreID)
+	if err != nil {
+		scoreFixGone(bot, chatID, st, err)
+		return
+	}
+	mk := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🗑 Отменить начисление", "scorefix_revoke"),
+			tgbotapi.NewInlineKeyboardButtonData("✏️ Изменить", "scorefix_change"),
+		),
+		fsmutil.BackCancelRow("scorefix_list", "scorefix_cancel"),
+	)
+	scoreFixEdit(bot, chatID, st.MessageID, scoreCard(s), &mk)
+}
+
+func scoreFixShowCategories(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, chatID int64, st *scoreFixState) {
+	cats, err := db.GetCategories(ctx, database, false)
+	if err != nil {
+		log.Println("score fix: categories:", err)
+		metrics.HandlerErrors.Inc()
+	}
+	var bs callback.Buttons
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, c := range cats {
+		if c.Name == db.AuctionCategory {
+			continue
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			bs.Add(cbFixCategory.Button(c.Name, int64(c.ID)))))
+	}
+	rows = append(rows, fsmutil.BackCancelRow(bs.Data(cbFixPick.Data(st.ScoreID)), "scorefix_cancel"))
+	if buttonsFailed(&bs) {
+		return
+	}
+	mk := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	scoreFixEdit(bot, chatID, st.MessageID, "Выберите правильную категорию:", &mk)
+}
+
+func scoreFixShowLevels(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, chatID int64, st *scoreFixState) {
+	levels, err := db.GetLevelsByCategoryIDFull(ctx, database, st.CategoryID, false)
+	if err != nil {
+		log.Println("score fix: levels:", err)
+		metrics.HandlerErrors.Inc()
+	}
+	var bs callback.Buttons
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, l := range levels {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			bs.Add(cbFixLevel.Button(fmt.Sprintf("%s (%d)", l.Label, l.Value), l.ID))))
+	}
+	rows = append(rows, fsmutil.BackCancelRow("scorefix_change", "scorefix_cancel"))
+	if buttonsFailed(&bs) {
+		return
+	}
+	mk := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	scoreFixEdit(bot, chatID, st.MessageID, "Выберите правильный уровень:", &mk)
+}
+
+func scoreFixAskReason(bot *tgbotapi.BotAPI, chatID int64, st *scoreFixState) {
+	var bs callback.Buttons
+	mk := tgbotapi.NewInlineKeyboardMarkup(fsmutil.BackCancelRow(bs.Data(cbFixPick.Data(st.ScoreID)), "scorefix_cancel"))
+	if buttonsFailed(&bs) {
+		return
+	}
+	st.Step = scoreFixStepReason
+	scoreFixEdit(bot, chatID, st.MessageID, "Укажите причину — её увидят автор начисления, ученик и родители:", &mk)
+}
+
+func scoreFixConfirm(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, chatID int64, st *scoreFixState) {
+	s, err := db.GetCorrectableScore(ctx, database, st.ScoreID)
+	if err != nil {
+		scoreFixGone(bot, chatID, st, err)
+		return
+	}
+	fsmutil.DisableMarkup(bot, chatID, st.MessageID)
+
+	var b strings.Builder
+	b.WriteString(scoreCard(s))
+	if st.Action == scoreFixRevoke {
+		b.WriteString("\n\n🗑 Начисление будет отменено.")
+	} else {
+		fmt.Fprintf(&b, "\n\n✏️ Станет: %s %+d", db.GetCategoryNameByID(ctx, database, int(st.CategoryID)), st.Points)
+	}
+	fmt.Fprintf(&b, "\nПричина: %s", st.Reason)
+
+	var bs callback.Buttons
+	m := tgbotapi.NewMessage(chatID, b.String())
+	m.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("✅ Подтвердить", "scorefix_apply")),
+		fsmutil.BackCancelRow(bs.Data(cbFixPick.Data(st.ScoreID)), "scorefix_cancel"),
+	)
+	if buttonsFailed(&bs) {
+		return
+	}
+	sent, err := tg.Send(bot, m)
+	if err != nil {
+		metrics.HandlerErrors.Inc()
+		return
+	}
+	st.MessageID = sent.MessageID
+}
+
+func scoreFixApply(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, chatID int64, st *scoreFixState) {
+	if st.Reason == "" || st.Action == "" {
+		return
+	}
+	before, err := db.GetCorrectableScore(ctx, database, st.ScoreID)
+	if err != nil {
+		scoreFixGone(bot, chatID, st, err)
+		return
+	}
+	by := actorUserID(ctx, database, chatID)
+
+	if st.Action == scoreFixRevoke {
+		err = db.ReverseScore(ctx, database, st.ScoreID, st.Reason, by)
+	} else {
+		err = db.CorrectScore(ctx, database, st.ScoreID, db.ScoreCorrection{
+			StudentID: before.StudentID, CategoryID: st.CategoryID, Points: st.Points,
+		}, st.Reason, by)
+	}
+	if err != nil {
+		if errors.Is(err, db.ErrScoreNotApproved) {
+			scoreFixGone(bot, chatID, st, err)
+			return
+		}
+		log.Println("score fix: apply:", err)
+		metrics.HandlerErrors.Inc()
+		scoreFixReply(bot, chatID, "❌ Не удалось исправить начисление. Попробуйте позже.")
+		return
+	}
+
+	fsmutil.DisableMarkup(bot, chatID, st.MessageID)
+	scoreFixStates.Delete(ctx, chatID)
+
+	var change string
+	if st.Action == scoreFixRevoke {
+		change = fmt.Sprintf("отменено: %s %+d", before.CategoryName, before.Points)
+	} else {
+		change = fmt.Sprintf("исправлено: было %s %+d, стало %s %+d",
+			before.CategoryName, before.Points, db.GetCategoryNameByID(ctx, database, int(st.CategoryID)), st.Points)
+	}
+	scoreFixReply(bot, chatID, "✅ Начисление "+change+".")
+	notifyScoreFixed(ctx, database, chatID, before, change, st.Reason)
+}
+
+// notifyScoreFixed — автору начисления, ученику и его родителям.
+func notifyScoreFixed(ctx context.Context, database *sql.DB, actorChatID int64, s *db.CorrectableScore, change, reason string) {
+	date := s.CreatedAt.Format("02.01.2006")
+	text := fmt.Sprintf("📝 Начисление от %s (%s) %s.\nПричина: %s", date, s.StudentName, change, reason)
+
+	// автору — как исправление его начисления, ученику и родителям — как изменение баллов
+	type recipient struct {
+		chatID int64
+		kind   notify.Kind
+	}
+	var to []recipient
+	if author, err := db.GetUserByID(ctx, database, s.AuthorID); err == nil && author.IsActive {
+		to = append(to, recipient{author.TelegramID, notify.ScoreFixes})
+	}
+	if student, err := db.GetUserByID(ctx, database, s.StudentID); err == nil && student.IsActive {
+		to = append(to, recipient{student.TelegramID, notify.Scores})
+	}
+	parents, err := db.GetParentTelegramIDs(ctx, database, s.StudentID)
+	if err != nil {
+		log.Println("score fix: parents:", err)
+	}
+	for _, id := range parents {
+		to = append(to, recipient{id, notify.Scores})
+	}
+
+	seen := map[int64]bool{actorChatID: true}
+	for _, r := range to {
+		if seen[r.chatID] || db.IsPlaceholderTelegramID(r.chatID) {
+			continue
+		}
+		seen[r.chatID] = true
+		if err := notify.Send(ctx, database, r.chatID, r.kind, text); err != nil {
+			metrics.HandlerErrors.Inc()
+		}
+	}
+}
+
+func scoreCard(s *db.CorrectableScore) string {
+	class := ""
+	if s.ClassNumber != nil && s.ClassLetter != nil {
+		class = fmt.Sprintf(" (%d%s)", *s.ClassNumber, *s.ClassLetter)
+	}
+	comment := "—"
+	if s.Comment != nil && strings.TrimSpace(*s.Comment) != "" {
+		comment = *s.Comment
+	}
+	return fmt.Sprintf("Ученик: %s%s\nКатегория: %s\nБаллы: %+d\nАвтор: %s\nДата: %s\nКомментарий: %s",
+		s.StudentName, class, s.CategoryName, s.Points, s.AuthorName, s.CreatedAt.Format("02.01.2006 15:04"), comment)
+}
+
+// shortName — «Иванов Иван Иванович» → «Иванов И.»: строка кнопки короткая.
+func shortName(name string) string {
+	parts := strings.Fields(name)
+	if len(parts) < 2 {
+		return name
+	}
+	return parts[0] + " " + string([]rune(parts[1])[:1]) + "."
+}
+
+func scoreFixGone(bot *tgbotapi.BotAPI, chatID int64, st *scoreFixState, err error) {
+	if !errors.Is(err, db.ErrScoreNotApproved) {
+		log.Println("score fix:", err)
+		metrics.HandlerErrors.Inc()
+	}
+	mk := tgbotapi.NewInlineKeyboardMarkup(fsmutil.BackCancelRow("scorefix_list", "scorefix_cancel"))
+	st.Step = 0
+	scoreFixEdit(bot, chatID, st.MessageID, "ℹ️ Начисление уже отменено или исправлено — выберите другое.", &mk)
+}
+
+func scoreFixEdit(bot *tgbotapi.BotAPI, chatID int64, messageID int, text string, mk *tgbotapi.InlineKeyboardMarkup) {
+	edit := tgbotapi.NewEditMessageText(chatID, messageID, text)
+	edit.ReplyMarkup = mk
+	if _, err := tg.Send(bot, edit); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
+
+func scoreFixReply(bot *tgbotapi.BotAPI, chatID int64, text string) {
+	if _, err := tg.Send(bot, tgbotapi.NewMessage(chatID, text)); err != nil {
+		metrics.HandlerErrors.Inc()
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"time"
 
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmstore"
 	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmutil"
 	"github.com/Spok95/telegram-school-bot/internal/db"
 	"github.com/Spok95/telegram-school-bot/internal/metrics"
@@ -35,7 +36,7 @@ type SetPeriodState struct {
 	MessageID int
 }
 
-var periodStates = make(map[int64]*SetPeriodState)
+var periodStates = fsmstore.NewMap[*SetPeriodState]("set_period", 1, fsmstore.DefaultTTL)
 
 func StartSetPeriodFSM(ctx context.Context, bot *tgbotapi.BotAPI, msg *tgbotapi.Message) {
 	select {
@@ -44,10 +45,9 @@ func StartSetPeriodFSM(ctx context.Context, bot *tgbotapi.BotAPI, msg *tgbotapi.
 	default:
 	}
 	chatID := msg.Chat.ID
-	delete(periodStates, chatID)
-
 	state := &SetPeriodState{Step: StepInputName}
-	periodStates[chatID] = state
+	periodStates.Set(ctx, chatID, state)
+	defer periodStates.Save(ctx, chatID)
 
 	mk := tgbotapi.NewInlineKeyboardMarkup(
 		fsmutil.BackCancelRow(perBackToMenu, perCancel), // Назад = выход, Отмена = выход
@@ -62,10 +62,11 @@ func HandleSetPeriodInput(ctx context.Context, bot *tgbotapi.BotAPI, msg *tgbota
 	default:
 	}
 	chatID := msg.Chat.ID
-	state, ok := periodStates[chatID]
+	state, ok := periodStates.Get(chatID)
 	if !ok {
 		return
 	}
+	defer periodStates.Save(ctx, chatID)
 
 	switch state.Step {
 	case StepInputName:
@@ -124,10 +125,11 @@ func HandleSetPeriodInput(ctx context.Context, bot *tgbotapi.BotAPI, msg *tgbota
 
 func HandleSetPeriodCallback(ctx context.Context, bot *tgbotapi.BotAPI, database *sql.DB, cb *tgbotapi.CallbackQuery) {
 	chatID := cb.Message.Chat.ID
-	state := periodStates[chatID]
+	state := periodStates.Value(chatID)
 	if state == nil {
 		return
 	}
+	defer periodStates.Save(ctx, chatID)
 
 	data := cb.Data
 	perAnswer(bot, cb)
@@ -135,7 +137,7 @@ func HandleSetPeriodCallback(ctx context.Context, bot *tgbotapi.BotAPI, database
 	if data == perCancel || data == perBackToMenu {
 		perClearMarkup(bot, chatID, state)
 		perSend(bot, chatID, state, "🚫 Отменено.", tgbotapi.NewInlineKeyboardMarkup())
-		delete(periodStates, chatID)
+		periodStates.Delete(ctx, chatID)
 		return
 	}
 
@@ -175,13 +177,13 @@ func HandleSetPeriodCallback(ctx context.Context, bot *tgbotapi.BotAPI, database
 		}
 		perClearMarkup(bot, chatID, state)
 		perSend(bot, chatID, state, "✅ Новый период успешно создан.", tgbotapi.NewInlineKeyboardMarkup())
-		delete(periodStates, chatID)
+		periodStates.Delete(ctx, chatID)
 		return
 	}
 }
 
 func GetSetPeriodState(chatID int64) *SetPeriodState {
-	return periodStates[chatID]
+	return periodStates.Value(chatID)
 }
 
 func parseDate(input string) (time.Time, error) {
@@ -32,9 +32,11 @@ func studentMenu() tgbotapi.ReplyKeyboardMarkup {
 	return tgbotapi.NewReplyKeyboard(
 		tgbotapi.NewKeyboardButtonRow(
 			tgbotapi.NewKeyboardButton("📊 Мой рейтинг"),
+			tgbotapi.NewKeyboardButton("🏆 Рейтинг"),
 		),
 		tgbotapi.NewKeyboardButtonRow(
 			tgbotapi.NewKeyboardButton("📜 История получения баллов"),
+			tgbotapi.NewKeyboardButton("⚙️ Настройки"),
 		),
 	)
 }
@@ -48,6 +50,10 @@ func teacherMenu() tgbotapi.ReplyKeyboardMarkup {
 
 	kbRows := [][]tgbotapi.KeyboardButton{
 		rows,
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton("🏆 Рейтинг"),
+			tgbotapi.NewKeyboardButton("⚙️ Настройки"),
+		),
 	}
 
 	// консультации — только если включены
@@ -58,6 +64,10 @@ func teacherMenu() tgbotapi.ReplyKeyboardMarkup {
 				tgbotapi.NewKeyboardButton("📋 Мои слоты"),
 				tgbotapi.NewKeyboardButton("📘 Мои консультации"),
 			),
+			tgbotapi.NewKeyboardButtonRow(
+				tgbotapi.NewKeyboardButton("🔁 Шаблоны расписания"),
+				tgbotapi.NewKeyboardButton("🔗 Календарь на телефоне"),
+			),
 		)
 	}
 
@@ -73,9 +83,13 @@ func administrationMenu() tgbotapi.ReplyKeyboardMarkup {
 		),
 		tgbotapi.NewKeyboardButtonRow(
 			tgbotapi.NewKeyboardButton("📥 Заявки на баллы"),
+			tgbotapi.NewKeyboardButton("📝 Исправить начисление"),
+			tgbotapi.NewKeyboardButton("📨 Рассылки"),
 		),
 		tgbotapi.NewKeyboardButtonRow(
 			tgbotapi.NewKeyboardButton("📥 Экспорт отчёта"),
+			tgbotapi.NewKeyboardButton("🏆 Рейтинг"),
+			tgbotapi.NewKeyboardButton("⚙️ Настройки"),
 		),
 	}
 
@@ -99,6 +113,7 @@ func adminMenu() tgbotapi.ReplyKeyboardMarkup {
 		tgbotapi.NewKeyboardButtonRow(
 			tgbotapi.NewKeyboardButton("📥 Заявки на баллы"),
 			tgbotapi.NewKeyboardButton("📥 Заявки на авторизацию"),
+			tgbotapi.NewKeyboardButton("📝 Исправить начисление"),
 		),
 		tgbotapi.NewKeyboardButtonRow(
 			tgbotapi.NewKeyboardButton("📥 Экспорт отчёта"),
@@ -107,13 +122,25 @@ func adminMenu() tgbotapi.ReplyKeyboardMarkup {
 		tgbotapi.NewKeyboardButtonRow(
 			tgbotapi.NewKeyboardButton("📅 Периоды"),
 			tgbotapi.NewKeyboardButton("👥 Пользователи"),
+			tgbotapi.NewKeyboardButton("🎟 Приглашения"),
+		),
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton("🎓 Перевод классов"),
+			tgbotapi.NewKeyboardButton("📋 Импорт списка классов"),
+			tgbotapi.NewKeyboardButton("🏆 Рейтинг"),
 		),
 		tgbotapi.NewKeyboardButtonRow(
 			tgbotapi.NewKeyboardButton("💾 Бэкап БД"),
+			tgbotapi.NewKeyboardButton("📦 Выгрузка БД"),
 			tgbotapi.NewKeyboardButton("♻️ Восстановить БД"),
 		),
 		tgbotapi.NewKeyboardButtonRow(
 			tgbotapi.NewKeyboardButton("📥 Восстановить из файла"),
+			tgbotapi.NewKeyboardButton("📆 Каникулы и праздники"),
+			tgbotapi.NewKeyboardButton("📨 Рассылки"),
+		),
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton("⚙️ Настройки"),
 		),
 	}
 
@@ -135,9 +162,11 @@ func parentMenu() tgbotapi.ReplyKeyboardMarkup {
 		tgbotapi.NewKeyboardButtonRow(
 			tgbotapi.NewKeyboardButton("📊 Рейтинг ребёнка"),
 			tgbotapi.NewKeyboardButton("➕ Добавить ребёнка"),
+			tgbotapi.NewKeyboardButton("⚙️ Настройки"),
 		),
 		tgbotapi.NewKeyboardButtonRow(
 			tgbotapi.NewKeyboardButton("📜 История получения баллов"),
+			tgbotapi.NewKeyboardButton("🏆 Рейтинг"),
 		),
 	}
 
@@ -147,6 +176,7 @@ func parentMenu() tgbotapi.ReplyKeyboardMarkup {
 			tgbotapi.NewKeyboardButtonRow(
 				tgbotapi.NewKeyboardButton("📅 Записаться на консультацию"),
 				tgbotapi.NewKeyboardButton("📋 Мои записи"),
+				tgbotapi.NewKeyboardButton("🔗 Календарь на телефоне"),
 			),
 		)
 	}
@@ -0,0 +1,225 @@
+package fsmstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/ctxutil"
+	"github.com/Spok95/telegram-school-bot/internal/metrics"
+)
+
+// DefaultTTL — сколько живёт незавершённый сценарий без активности пользователя.
+const DefaultTTL = 24 * time.Hour
+
+type loader interface {
+	fsmName() string
+	load(ctx context.Context, s Store) error
+	purge(now time.Time)
+}
+
+// registry — все объявленные Map и текущий бэкенд.
+// До Init используется MemoryStore, поэтому тесты и локальные запуски работают без БД.
+var registry = struct {
+	mu    sync.Mutex
+	store Store
+	maps  []loader
+}{store: NewMemoryStore()}
+
+func currentStore() Store {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	return registry.store
+}
+
+// Init подключает бэкенд и поднимает в память все сохранённые состояния.
+// Вызывается один раз на старте, после миграций.
+func Init(ctx context.Context, s Store) error {
+	registry.mu.Lock()
+	registry.store = s
+	maps := append([]loader(nil), registry.maps...)
+	registry.mu.Unlock()
+
+	var errs []error
+	for _, m := range maps {
+		if err := m.load(ctx, s); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", m.fsmName(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// PurgeExpired чистит истёкшие состояния в бэкенде и в памяти (для jobs.Runner).
+func PurgeExpired(ctx context.Context) error {
+	now := time.Now()
+	registry.mu.Lock()
+	maps := append([]loader(nil), registry.maps...)
+	registry.mu.Unlock()
+
+	for _, m := range maps {
+		m.purge(now)
+	}
+	_, err := currentStore().PurgeExpired(ctx, now)
+	return err
+}
+
+type item[T any] struct {
+	v       T
+	expires time.Time
+}
+
+// Map — типизированное состояние FSM по chatID.
+// Чтение идёт из памяти, запись (Set/Save/Delete) — сквозная в Store.
+// Если состояние — указатель и меняется «на месте», после изменений нужно вызвать Save.
+type Map[T any] struct {
+	name    string
+	version int
+	ttl     time.Duration
+
+	mu    sync.Mutex
+	items map[int64]item[T]
+}
+
+// NewMap объявляет FSM с уникальным именем. version нужно увеличивать при
+// несовместимом изменении структуры T — старые записи при загрузке будут отброшены.
+func NewMap[T any](name string, version int, ttl time.Duration) *Map[T] {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	m := &Map[T]{name: name, version: version, ttl: ttl, items: make(map[int64]item[T])}
+	registry.mu.Lock()
+	registry.maps = append(registry.maps, m)
+	registry.mu.Unlock()
+	return m
+}
+
+func (m *Map[T]) fsmName() string { return m.name }
+
+// Get возвращает состояние чата и признак его наличия.
+func (m *Map[T]) Get(chatID int64) (T, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	it, ok := m.items[chatID]
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	if !it.expires.After(time.Now()) {
+		delete(m.items, chatID)
+		var zero T
+		return zero, false
+	}
+	return it.v, true
+}
+
+// Value — как Get, но без признака наличия (нулевое значение, если состояния нет).
+func (m *Map[T]) Value(chatID int64) T {
+	v, _ := m.Get(chatID)
+	return v
+}
+
+// Has — есть ли у чата активное состояние.
+func (m *Map[T]) Has(chatID int64) bool {
+	_, ok := m.Get(chatID)
+	return ok
+}
+
+// Set заменяет состояние чата и сохраняет его.
+func (m *Map[T]) Set(ctx context.Context, chatID int64, v T) {
+	m.mu.Lock()
+	m.items[chatID] = item[T]{v: v, expires: time.Now().Add(m.ttl)}
+	m.mu.Unlock()
+	m.persist(ctx, chatID, v)
+}
+
+// Save сохраняет текущее состояние чата (после изменения полей по указателю) и продлевает TTL.
+// Если состояния уже нет (его удалили по ходу обработки) — ничего не делает.
+func (m *Map[T]) Save(ctx context.Context, chatID int64) {
+	m.mu.Lock()
+	it, ok := m.items[chatID]
+	if ok {
+		it.expires = time.Now().Add(m.ttl)
+		m.items[chatID] = it
+	}
+	m.mu.Unlock()
+	if ok {
+		m.persist(ctx, chatID, it.v)
+	}
+}
+
+// Delete удаляет состояние чата.
+func (m *Map[T]) Delete(ctx context.Context, chatID int64) {
+	m.mu.Lock()
+	_, ok := m.items[chatID]
+	delete(m.items, chatID)
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	c, cancel := ctxutil.WithDBTimeout(context.WithoutCancel(ctx))
+	defer cancel()
+	if err := currentStore().Delete(c, m.name, chatID); err != nil {
+		log.Printf("[fsmstore] delete fsm=%s chat=%d: %v", m.name, chatID, err)
+		metrics.FSMStoreErrors.Inc()
+	}
+}
+
+func (m *Map[T]) persist(ctx context.Context, chatID int64, v T) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("[fsmstore] marshal fsm=%s chat=%d: %v", m.name, chatID, err)
+		metrics.FSMStoreErrors.Inc()
+		return
+	}
+	// сохраняем даже если контекст апдейта уже истёк — иначе состояние в БД отстанет от памяти
+	c, cancel := ctxutil.WithDBTimeout(context.WithoutCancel(ctx))
+	defer cancel()
+	rec := Record{ChatID: chatID, Version: m.version, Data: data, ExpiresAt: time.Now().Add(m.ttl)}
+	if err := currentStore().Save(c, m.name, rec); err != nil {
+		log.Printf("[fsmstore] save fsm=%s chat=%d: %v", m.name, chatID, err)
+		metrics.FSMStoreErrors.Inc()
+	}
+}
+
+func (m *Map[T]) load(ctx context.Context, s Store) error {
+	recs, err := s.LoadAll(ctx, m.name)
+	if err != nil {
+		return err
+	}
+	loaded := make(map[int64]item[T], len(recs))
+	for _, rec := range recs {
+		if rec.Version != m.version {
+			// формат состояния изменился — продолжать сценарий небезопасно
+			_ = s.Delete(ctx, m.name, rec.ChatID)
+			continue
+		}
+		var v T
+		if err := json.Unmarshal(rec.Data, &v); err != nil {
+			log.Printf("[fsmstore] unmarshal fsm=%s chat=%d: %v", m.name, rec.ChatID, err)
+			_ = s.Delete(ctx, m.name, rec.ChatID)
+			continue
+		}
+		loaded[rec.ChatID] = item[T]{v: v, expires: rec.ExpiresAt}
+	}
+
+	m.mu.Lock()
+	m.items = loaded
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *Map[T]) purge(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, it := range m.items {
+		if !it.expires.After(now) {
+			delete(m.items, id)
+		}
+	}
+}
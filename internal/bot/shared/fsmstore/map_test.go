@@ -0,0 +1,86 @@
+package fsmstore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type testState struct {
+	Step int
+	IDs  []int64
+}
+
+func TestMap_PersistAndReload(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	if err := Init(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMap[*testState]("test_reload", 1, time.Hour)
+	m.Set(ctx, 1, &testState{Step: 1})
+
+	st, ok := m.Get(1)
+	if !ok {
+		t.Fatal("ожидали состояние после Set")
+	}
+	st.Step = 3
+	st.IDs = append(st.IDs, 42)
+	m.Save(ctx, 1)
+
+	// эмулируем рестарт: новая Map с тем же именем поднимает данные из Store
+	restarted := NewMap[*testState]("test_reload", 1, time.Hour)
+	if err := Init(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+	got, ok := restarted.Get(1)
+	if !ok {
+		t.Fatal("состояние потерялось после рестарта")
+	}
+	if got.Step != 3 || len(got.IDs) != 1 || got.IDs[0] != 42 {
+		t.Fatalf("неожиданное состояние после рестарта: %#v", got)
+	}
+
+	restarted.Delete(ctx, 1)
+	recs, _ := store.LoadAll(ctx, "test_reload")
+	if len(recs) != 0 {
+		t.Fatalf("ожидали пустой store после Delete, получили %d записей", len(recs))
+	}
+}
+
+func TestMap_VersionMismatchDropsState(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	if err := Init(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+
+	old := NewMap[string]("test_version", 1, time.Hour)
+	old.Set(ctx, 7, "parent_name")
+
+	bumped := NewMap[string]("test_version", 2, time.Hour)
+	if err := Init(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+	if bumped.Has(7) {
+		t.Fatal("состояние старой версии не должно подниматься")
+	}
+}
+
+func TestMap_TTL(t *testing.T) {
+	ctx := context.Background()
+	if err := Init(ctx, NewMemoryStore()); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMap[bool]("test_ttl", 1, time.Millisecond)
+	m.Set(ctx, 5, true)
+	time.Sleep(5 * time.Millisecond)
+	if m.Value(5) {
+		t.Fatal("истёкшее состояние не должно возвращаться")
+	}
+	if err := PurgeExpired(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
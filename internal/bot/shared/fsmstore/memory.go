@@ -0,0 +1,71 @@
+package fsmstore
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore — хранение в памяти процесса. Используется в тестах и по умолчанию до Init.
+type MemoryStore struct {
+	mu   sync.Mutex
+	data map[string]map[int64]Record
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: make(map[string]map[int64]Record)}
+}
+
+func (s *MemoryStore) LoadAll(_ context.Context, fsm string) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	out := make([]Record, 0, len(s.data[fsm]))
+	for _, rec := range s.data[fsm] {
+		if !rec.ExpiresAt.IsZero() && !rec.ExpiresAt.After(now) {
+			continue
+		}
+		rec.Data = append([]byte(nil), rec.Data...)
+		out = append(out, rec)
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) Save(_ context.Context, fsm string, rec Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.data[fsm]
+	if !ok {
+		m = make(map[int64]Record)
+		s.data[fsm] = m
+	}
+	rec.Data = append([]byte(nil), rec.Data...)
+	m[rec.ChatID] = rec
+	return nil
+}
+
+func (s *MemoryStore) Delete(_ context.Context, fsm string, chatID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.data[fsm], chatID)
+	return nil
+}
+
+func (s *MemoryStore) PurgeExpired(_ context.Context, now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for _, m := range s.data {
+		for id, rec := range m {
+			if !rec.ExpiresAt.IsZero() && !rec.ExpiresAt.After(now) {
+				delete(m, id)
+				n++
+			}
+		}
+	}
+	return n, nil
+}
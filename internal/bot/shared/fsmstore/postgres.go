@@ -0,0 +1,64 @@
+package fsmstore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PostgresStore — хранение состояний в таблице fsm_states (миграция 0010).
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) LoadAll(ctx context.Context, fsm string) ([]Record, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT chat_id, version, state, expires_at
+		FROM fsm_states
+		WHERE fsm = $1 AND expires_at > NOW()
+	`, fsm)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []Record
+	for rows.Next() {
+		var rec Record
+		if err := rows.Scan(&rec.ChatID, &rec.Version, &rec.Data, &rec.ExpiresAt); err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+func (s *PostgresStore) Save(ctx context.Context, fsm string, rec Record) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO fsm_states (fsm, chat_id, version, state, updated_at, expires_at)
+		VALUES ($1, $2, $3, $4::jsonb, NOW(), $5)
+		ON CONFLICT (fsm, chat_id) DO UPDATE
+		SET version = EXCLUDED.version,
+		    state = EXCLUDED.state,
+		    updated_at = NOW(),
+		    expires_at = EXCLUDED.expires_at
+	`, fsm, rec.ChatID, rec.Version, string(rec.Data), rec.ExpiresAt)
+	return err
+}
+
+func (s *PostgresStore) Delete(ctx context.Context, fsm string, chatID int64) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM fsm_states WHERE fsm = $1 AND chat_id = $2`, fsm, chatID)
+	return err
+}
+
+func (s *PostgresStore) PurgeExpired(ctx context.Context, now time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM fsm_states WHERE expires_at <= $1`, now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
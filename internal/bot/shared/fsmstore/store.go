@@ -0,0 +1,29 @@
+// Package fsmstore — хранилище состояний диалоговых FSM (мастеров).
+// Состояние хранится как версионированный JSON на пару (fsm, chat_id) с TTL,
+// поэтому рестарт/деплой бота не «роняет» пользователя посреди сценария.
+package fsmstore
+
+import (
+	"context"
+	"time"
+)
+
+// Record — сохранённое состояние одного FSM для одного чата.
+type Record struct {
+	ChatID    int64
+	Version   int
+	Data      []byte
+	ExpiresAt time.Time
+}
+
+// Store — бэкенд хранения состояний. Реализации: PostgresStore (прод) и MemoryStore (тесты).
+type Store interface {
+	// LoadAll возвращает все неистёкшие записи указанного FSM.
+	LoadAll(ctx context.Context, fsm string) ([]Record, error)
+	// Save создаёт или перезаписывает запись (fsm, rec.ChatID).
+	Save(ctx context.Context, fsm string, rec Record) error
+	// Delete удаляет запись (fsm, chatID); отсутствие записи — не ошибка.
+	Delete(ctx context.Context, fsm string, chatID int64) error
+	// PurgeExpired удаляет записи с истёкшим TTL и возвращает их количество.
+	PurgeExpired(ctx context.Context, now time.Time) (int64, error)
+}
@@ -0,0 +1,60 @@
+// Package broadcast отправляет рассылки администрации: определяет получателей
+// по сохранённой аудитории и ставит сообщения в очередь outbox, откуда они
+// уходят с учётом лимитов Telegram и тихих часов получателей.
+package broadcast
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/notify"
+)
+
+// Queue раскладывает рассылку id по получателям и возвращает их число.
+func Queue(ctx context.Context, database *sql.DB, id int64) (int, error) {
+	b, err := db.GetBroadcast(ctx, database, id)
+	if err != nil {
+		return 0, err
+	}
+	if b == nil {
+		return 0, db.ErrBroadcastNotPending
+	}
+	return queue(ctx, database, *b)
+}
+
+func queue(ctx context.Context, database *sql.DB, b db.Broadcast) (int, error) {
+	recipients, err := db.BroadcastRecipients(ctx, database, b.Audience)
+	if err != nil {
+		return 0, err
+	}
+	notBefore := func(r db.BroadcastRecipient) time.Time {
+		return notify.NotBefore(notify.QuietHours{From: r.QuietFrom, To: r.QuietTo})
+	}
+	if err := db.QueueBroadcast(ctx, database, b, recipients, notBefore); err != nil {
+		return 0, err
+	}
+	return len(recipients), nil
+}
+
+// RunScheduled отправляет запланированные рассылки, время которых наступило.
+func RunScheduled(ctx context.Context, database *sql.DB) error {
+	due, err := db.DueBroadcasts(ctx, database)
+	if err != nil {
+		return err
+	}
+	for _, b := range due {
+		n, err := queue(ctx, database, b)
+		if errors.Is(err, db.ErrBroadcastNotPending) {
+			continue // отменили или отправили параллельно
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("[broadcast] рассылка #%d поставлена в очередь: %d получателей", b.ID, n)
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"crypto/sha256"
 	"fmt"
 	"os"
 	"strconv"
@@ -17,8 +18,61 @@ type Config struct {
 	LogLevel    string
 	Env         string // dev|prod
 	SentryDSN   string // пока не используем
+
+	// Получение апдейтов: polling (по умолчанию) или webhook
+	UpdateMode    string
+	WebhookURL    string // публичный https-адрес, который увидит Telegram
+	WebhookPath   string // путь на нашем HTTP-сервере
+	WebhookSecret string // X-Telegram-Bot-Api-Secret-Token
+
+	// Пул обработки апдейтов
+	UpdateWorkers      int
+	UpdateQueueSize    int
+	UpdateDrainTimeout time.Duration
+
+	// Подпись inline-кнопок (см. internal/bot/callback)
+	CallbackSecret []byte
+	CallbackTTL    time.Duration
+
+	// Импорт списков классов по HTTP; пустой токен — эндпоинт выключен
+	RosterImportToken string
+	DBExportToken     string
+
+	// Уведомления о баллах: не больше одного сообщения получателю за это время
+	ScoreNotifyWindow time.Duration
+
+	// Очередь исходящих сообщений (internal/outbox): лимиты Telegram и повторы
+	OutboxRatePerSec  int           // сообщений в секунду на весь бот
+	OutboxChatGap     time.Duration // пауза между сообщениями в один чат
+	OutboxMaxAttempts int           // после стольких неудач сообщение считается недоставленным
+
+	// Шаблоны расписания консультаций: на сколько дней вперёд создаются слоты
+	ConsultTemplateDays int
+
+	// Внешний адрес HTTP-сервера для ссылок подписки на календарь; пусто — ссылки не выдаются
+	CalendarBaseURL string
+
+	// Лист ожидания консультаций: сколько освободившийся слот закреплён за родителем из очереди
+	WaitlistOfferTTL time.Duration
+
+	// Каталог бэкапов (общий с sidecar pgbackup) и политика хранения: сколько последних
+	// дневных / недельных / месячных копий оставлять; 0 — уровень выключен, все 0 — не удалять
+	BackupDir         string
+	BackupKeepDaily   int
+	BackupKeepWeekly  int
+	BackupKeepMonthly int
+
+	// Шифрование бэкапов: «id:ключ,…» (ключ — 32 байта в base64) и ID ключа для новых копий;
+	// пусто — бэкапы не шифруются
+	BackupEncryptionKeys  string
+	BackupEncryptionKeyID string
 }
 
+const (
+	UpdateModePolling = "polling"
+	UpdateModeWebhook = "webhook"
+)
+
 func Load() (*Config, error) {
 	tz := getenv("TZ", "Europe/Moscow")
 	loc, err := time.LoadLocation(tz)
@@ -40,6 +94,62 @@ func Load() (*Config, error) {
 		LogLevel:    getenv("LOG_LEVEL", "info"),
 		Env:         getenv("ENV", "dev"),
 		SentryDSN:   os.Getenv("SENTRY_DSN"),
+
+		UpdateMode:    strings.ToLower(getenv("UPDATE_MODE", UpdateModePolling)),
+		WebhookURL:    os.Getenv("WEBHOOK_URL"),
+		WebhookPath:   getenv("WEBHOOK_PATH", "/telegram/webhook"),
+		WebhookSecret: os.Getenv("WEBHOOK_SECRET"),
+
+		UpdateWorkers:      getenvInt("UPDATE_WORKERS", 8),
+		UpdateQueueSize:    getenvInt("UPDATE_QUEUE_SIZE", 256),
+		UpdateDrainTimeout: time.Duration(getenvInt("UPDATE_DRAIN_TIMEOUT_SEC", 30)) * time.Second,
+
+		CallbackTTL: time.Duration(getenvInt("CALLBACK_TTL_HOURS", 168)) * time.Hour,
+
+		RosterImportToken: os.Getenv("ROSTER_IMPORT_TOKEN"),
+		DBExportToken:     os.Getenv("DB_EXPORT_TOKEN"),
+
+		ScoreNotifyWindow: time.Duration(getenvInt("SCORE_NOTIFY_BATCH_MIN", 5)) * time.Minute,
+
+		OutboxRatePerSec:  getenvInt("OUTBOX_RATE_PER_SEC", 25),
+		OutboxChatGap:     time.Duration(getenvInt("OUTBOX_CHAT_GAP_MS", 1000)) * time.Millisecond,
+		OutboxMaxAttempts: getenvInt("OUTBOX_MAX_ATTEMPTS", 8),
+
+		ConsultTemplateDays: getenvInt("CONSULT_TEMPLATE_DAYS", 28),
+
+		CalendarBaseURL: os.Getenv("CALENDAR_BASE_URL"),
+
+		WaitlistOfferTTL: time.Duration(getenvInt("WAITLIST_OFFER_MIN", 30)) * time.Minute,
+
+		BackupDir:         getenv("BACKUP_DIR", "/app/backups"),
+		BackupKeepDaily:   getenvCount("BACKUP_KEEP_DAILY", 7),
+		BackupKeepWeekly:  getenvCount("BACKUP_KEEP_WEEKLY", 4),
+		BackupKeepMonthly: getenvCount("BACKUP_KEEP_MONTHLY", 6),
+
+		BackupEncryptionKeys:  os.Getenv("BACKUP_ENCRYPTION_KEYS"),
+		BackupEncryptionKeyID: os.Getenv("BACKUP_ENCRYPTION_KEY_ID"),
+	}
+
+	// Без явного секрета выводим его из токена: кнопки переживают рестарт,
+	// а смена токена заодно инвалидирует старые клавиатуры.
+	if s := os.Getenv("CALLBACK_SECRET"); s != "" {
+		cfg.CallbackSecret = []byte(s)
+	} else {
+		sum := sha256.Sum256([]byte("callback:" + cfg.BotToken))
+		cfg.CallbackSecret = sum[:]
+	}
+
+	switch cfg.UpdateMode {
+	case UpdateModePolling:
+	case UpdateModeWebhook:
+		if cfg.WebhookURL == "" {
+			return nil, fmt.Errorf("UPDATE_MODE=webhook: WEBHOOK_URL is empty")
+		}
+		if cfg.WebhookSecret == "" {
+			return nil, fmt.Errorf("UPDATE_MODE=webhook: WEBHOOK_SECRET is empty")
+		}
+	default:
+		return nil, fmt.Errorf("UPDATE_MODE: unknown mode %q (polling|webhook)", cfg.UpdateMode)
 	}
 	return cfg, nil
 }
@@ -59,6 +169,25 @@ func getenv(k, def string) string {
 	return def
 }
 
+func getenvInt(k string, def int) int {
+	if v := os.Getenv(k); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return def
+}
+
+// getenvCount — как getenvInt, но 0 — допустимое значение (например, «уровень хранения выключен»).
+func getenvCount(k string, def int) int {
+	if v := os.Getenv(k); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return def
+}
+
 func parseIDs(s string) ([]int64, error) {
 	s = strings.TrimSpace(s)
 	if s == "" {
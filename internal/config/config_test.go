@@ -0,0 +1,20 @@
+package config
+
+import "testing"
+
+func TestLoad_BackupKeep(t *testing.T) {
+	t.Setenv("BOT_TOKEN", "token")
+	t.Setenv("DATABASE_URL", "postgres://localhost/school")
+	t.Setenv("BACKUP_KEEP_DAILY", "0")
+	t.Setenv("BACKUP_KEEP_WEEKLY", "-1")
+	t.Setenv("BACKUP_KEEP_MONTHLY", "")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 0 выключает уровень, неверное значение и пустое — значение по умолчанию
+	if cfg.BackupKeepDaily != 0 || cfg.BackupKeepWeekly != 4 || cfg.BackupKeepMonthly != 6 {
+		t.Fatalf("хранение: %d / %d / %d", cfg.BackupKeepDaily, cfg.BackupKeepWeekly, cfg.BackupKeepMonthly)
+	}
+}
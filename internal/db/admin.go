@@ -3,8 +3,12 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
+	"time"
 
+	"github.com/Spok95/telegram-school-bot/internal/bot/shared/fsmstore"
 	"github.com/Spok95/telegram-school-bot/internal/ctxutil"
 	"github.com/Spok95/telegram-school-bot/internal/metrics"
 	"github.com/Spok95/telegram-school-bot/internal/models"
@@ -12,14 +16,15 @@ import (
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
-var UserFSMRole = make(map[int64]string)
+// userFSMRole — роль, выбранная на /start, пока регистрация не завершена.
+var userFSMRole = fsmstore.NewMap[string]("user_role", 1, 7*24*time.Hour)
 
 func EnsureAdmin(ctx context.Context, chatID int64, database *sql.DB, text string, bot *tgbotapi.BotAPI) {
 	ctx, cancel := ctxutil.WithDBTimeout(ctx)
 	defer cancel()
 
 	if IsAdminID(chatID) && text == "/start" {
-		SetUserFSMRole(chatID, "admin")
+		SetUserFSMRole(ctx, chatID, "admin")
 
 		// Проверяем, существует ли админ в базе
 		var exists bool
@@ -63,6 +68,79 @@ func EnsureAdmin(ctx context.Context, chatID int64, database *sql.DB, text strin
 	}
 }
 
-func SetUserFSMRole(chatID int64, role string) {
-	UserFSMRole[chatID] = role
+func SetUserFSMRole(ctx context.Context, chatID int64, role string) {
+	userFSMRole.Set(ctx, chatID, role)
+}
+
+func GetUserFSMRole(chatID int64) string {
+	return userFSMRole.Value(chatID)
+}
+
+// ErrLastAdmin — нельзя снять роль с последнего активного администратора.
+var ErrLastAdmin = errors.New("это последний активный администратор")
+
+// AddAdmin делает пользователя с этим telegram_id администратором; если его ещё нет —
+// создаёт подтверждённым, как при первом /start из ADMIN_IDS. Возвращает id пользователя.
+func AddAdmin(ctx context.Context, database *sql.DB, telegramID int64, name string) (int64, error) {
+	u, err := GetUserByTelegramID(ctx, database, telegramID)
+	if err != nil {
+		return 0, err
+	}
+	if u != nil {
+		if u.Role != nil && *u.Role == models.Admin {
+			return u.ID, nil
+		}
+		return u.ID, ChangeRoleWithCleanup(ctx, database, u.ID, string(models.Admin), u.ID)
+	}
+
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	tx, err := database.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	var id int64
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO users (telegram_id, name, role, confirmed, is_active) VALUES ($1, $2, $3, TRUE, TRUE)
+		RETURNING id`, telegramID, name, models.Admin).Scan(&id); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO role_changes (user_id, old_role, new_role, changed_by, changed_at)
+		VALUES ($1, '', 'admin', $1, NOW())`, id); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// RemoveAdmin снимает роль администратора: пользователь получает роль newRole.
+// Последнего активного администратора снять нельзя. Возвращает id пользователя.
+func RemoveAdmin(ctx context.Context, database *sql.DB, telegramID int64, newRole models.Role) (int64, error) {
+	if newRole == models.Admin || newRole == models.Student {
+		return 0, fmt.Errorf("роль %q не подходит", newRole)
+	}
+	u, err := GetUserByTelegramID(ctx, database, telegramID)
+	if err != nil {
+		return 0, err
+	}
+	if u == nil {
+		return 0, fmt.Errorf("пользователь с telegram_id %d не найден", telegramID)
+	}
+	if u.Role == nil || *u.Role != models.Admin {
+		return u.ID, fmt.Errorf("пользователь %d не администратор", telegramID)
+	}
+
+	dctx, cancel := ctxutil.WithDBTimeout(ctx)
+	var others int
+	err = database.QueryRowContext(dctx, `
+		SELECT COUNT(*) FROM users WHERE role = 'admin' AND is_active = TRUE AND id <> $1`, u.ID).Scan(&others)
+	cancel()
+	if err != nil {
+		return u.ID, err
+	}
+	if others == 0 {
+		return u.ID, ErrLastAdmin
+	}
+	return u.ID, ChangeRoleWithCleanup(ctx, database, u.ID, string(newRole), u.ID)
 }
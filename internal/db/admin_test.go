@@ -0,0 +1,53 @@
+//go:build testutil
+// +build testutil
+
+package db_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/models"
+	"github.com/Spok95/telegram-school-bot/internal/testutil/testdb"
+)
+
+func TestAddRemoveAdmin(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h, err := testdb.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	first, err := db.AddAdmin(ctx, h.DB, 1001, "Первый")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// повторный вызов ничего не создаёт
+	if again, err := db.AddAdmin(ctx, h.DB, 1001, "Первый"); err != nil || again != first {
+		t.Fatalf("повторный AddAdmin: %d, %v (ожидали %d)", again, err, first)
+	}
+
+	if _, err := db.RemoveAdmin(ctx, h.DB, 1001, models.Teacher); !errors.Is(err, db.ErrLastAdmin) {
+		t.Fatalf("последний администратор: %v", err)
+	}
+	if _, err := db.AddAdmin(ctx, h.DB, 1002, "Второй"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.RemoveAdmin(ctx, h.DB, 1001, models.Teacher); err != nil {
+		t.Fatal(err)
+	}
+	u, err := db.GetUserByTelegramID(ctx, h.DB, 1001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Role == nil || *u.Role != models.Teacher {
+		t.Fatalf("роль после снятия: %v", u.Role)
+	}
+	if _, err := db.RemoveAdmin(ctx, h.DB, 1001, models.Teacher); err == nil {
+		t.Fatal("снятие роли у не-администратора должно вернуть ошибку")
+	}
+}
@@ -0,0 +1,265 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/ctxutil"
+	"github.com/lib/pq"
+)
+
+// ErrBroadcastNotPending — рассылка уже отправлена или отменена.
+var ErrBroadcastNotPending = errors.New("рассылка уже отправлена или отменена")
+
+// Виды аудитории рассылки.
+const (
+	AudienceRole    = "role"    // все пользователи одной роли
+	AudienceClasses = "classes" // ученики и/или родители выбранных классов (в том числе параллели)
+	AudienceStaff   = "staff"   // учителя, администрация и админы
+)
+
+// Кому из классов: ученикам, родителям или и тем и другим.
+const (
+	WhoStudents = "students"
+	WhoParents  = "parents"
+	WhoBoth     = "both"
+)
+
+// BroadcastAudience — кому адресована рассылка. Получатели определяются
+// в момент отправки: запланированная рассылка дойдёт и до новых пользователей.
+type BroadcastAudience struct {
+	Kind     string  `json:"kind"`
+	Role     string  `json:"role,omitempty"`
+	ClassIDs []int64 `json:"class_ids,omitempty"`
+	Who      string  `json:"who,omitempty"`
+}
+
+// BroadcastRecipient — получатель рассылки.
+type BroadcastRecipient struct {
+	UserID             int64
+	ChatID             int64
+	Blocked            bool // заблокировал бота — сообщение сразу попадёт в отчёт как недоставленное
+	QuietFrom, QuietTo int
+}
+
+// BroadcastRecipients — активные подтверждённые пользователи с Telegram, попадающие в аудиторию.
+func BroadcastRecipients(ctx context.Context, database *sql.DB, a BroadcastAudience) ([]BroadcastRecipient, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	rows, err := database.QueryContext(ctx, `
+		SELECT u.id, u.telegram_id, u.blocked_at IS NOT NULL, COALESCE(u.quiet_from, 0), COALESCE(u.quiet_to, 0)
+		FROM users u
+		WHERE u.is_active = TRUE AND u.confirmed = TRUE AND u.telegram_id > 0
+		  AND (
+		      ($1::TEXT = 'role' AND u.role = $2)
+		   OR ($1::TEXT = 'staff' AND u.role IN ('teacher', 'administration', 'admin'))
+		   OR ($1::TEXT = 'classes' AND $3::TEXT IN ('students', 'both') AND u.role = 'student'
+		       AND EXISTS (SELECT 1 FROM classes c
+		                   WHERE c.id = ANY($4) AND c.number = u.class_number AND c.letter = u.class_letter))
+		   OR ($1::TEXT = 'classes' AND $3::TEXT IN ('parents', 'both') AND u.role = 'parent'
+		       AND EXISTS (SELECT 1 FROM parents_students ps
+		                   JOIN users s ON s.id = ps.student_id AND s.is_active = TRUE
+		                   JOIN classes c ON c.number = s.class_number AND c.letter = s.class_letter
+		                   WHERE ps.parent_id = u.id AND c.id = ANY($4)))
+		  )
+		ORDER BY u.id
+	`, a.Kind, a.Role, a.Who, pq.Array(a.ClassIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []BroadcastRecipient
+	for rows.Next() {
+		var r BroadcastRecipient
+		if err := rows.Scan(&r.UserID, &r.ChatID, &r.Blocked, &r.QuietFrom, &r.QuietTo); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// Broadcast — рассылка.
+type Broadcast struct {
+	ID               int64
+	CreatedBy        int64
+	Audience         BroadcastAudience
+	AudienceLabel    string
+	Text             string
+	AttachmentType   string // "", "photo" или "document"
+	AttachmentFileID string
+	ScheduledAt      time.Time
+	QueuedAt         *time.Time
+	CancelledAt      *time.Time
+	Recipients       int
+	CreatedAt        time.Time
+}
+
+// CreateBroadcast сохраняет рассылку; отправит её broadcast.Queue — сразу или в ScheduledAt.
+func CreateBroadcast(ctx context.Context, database *sql.DB, b Broadcast) (int64, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	aud, err := json.Marshal(b.Audience)
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	err = database.QueryRowContext(ctx, `
+		INSERT INTO broadcasts (created_by, audience, audience_label, text, attachment_type, attachment_file_id, scheduled_at)
+		VALUES (NULLIF($1, 0), $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7)
+		RETURNING id
+	`, b.CreatedBy, aud, b.AudienceLabel, b.Text, b.AttachmentType, b.AttachmentFileID, b.ScheduledAt).Scan(&id)
+	return id, err
+}
+
+const broadcastColumns = `
+	id, COALESCE(created_by, 0), audience, audience_label, text,
+	COALESCE(attachment_type, ''), COALESCE(attachment_file_id, ''),
+	scheduled_at, queued_at, cancelled_at, recipients, created_at`
+
+func scanBroadcast(row interface{ Scan(...any) error }) (Broadcast, error) {
+	var b Broadcast
+	var aud []byte
+	if err := row.Scan(&b.ID, &b.CreatedBy, &aud, &b.AudienceLabel, &b.Text,
+		&b.AttachmentType, &b.AttachmentFileID,
+		&b.ScheduledAt, &b.QueuedAt, &b.CancelledAt, &b.Recipients, &b.CreatedAt); err != nil {
+		return b, err
+	}
+	return b, json.Unmarshal(aud, &b.Audience)
+}
+
+func queryBroadcasts(ctx context.Context, database *sql.DB, query string, args ...any) ([]Broadcast, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	rows, err := database.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []Broadcast
+	for rows.Next() {
+		b, err := scanBroadcast(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+// GetBroadcast — рассылка по id; nil, если её нет.
+func GetBroadcast(ctx context.Context, database *sql.DB, id int64) (*Broadcast, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	b, err := scanBroadcast(database.QueryRowContext(ctx, `SELECT `+broadcastColumns+` FROM broadcasts WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// ListBroadcasts — последние рассылки, новые сверху.
+func ListBroadcasts(ctx context.Context, database *sql.DB, limit int) ([]Broadcast, error) {
+	return queryBroadcasts(ctx, database, `SELECT `+broadcastColumns+` FROM broadcasts ORDER BY id DESC LIMIT $1`, limit)
+}
+
+// DueBroadcasts — запланированные рассылки, время которых наступило.
+func DueBroadcasts(ctx context.Context, database *sql.DB) ([]Broadcast, error) {
+	return queryBroadcasts(ctx, database, `
+		SELECT `+broadcastColumns+` FROM broadcasts
+		WHERE queued_at IS NULL AND cancelled_at IS NULL AND scheduled_at <= NOW()
+		ORDER BY scheduled_at, id
+	`)
+}
+
+// QueueBroadcast раскладывает рассылку по получателям в outbox и отмечает её отправленной.
+// Заблокировавшие бота сразу получают недоставленное сообщение — так они видны в отчёте.
+// Повторный вызов (или вызов для отменённой рассылки) возвращает ErrBroadcastNotPending.
+func QueueBroadcast(ctx context.Context, database *sql.DB, b Broadcast, recipients []BroadcastRecipient, notBefore func(BroadcastRecipient) time.Time) error {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	tx, err := database.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE broadcasts SET queued_at = NOW(), recipients = $2
+		WHERE id = $1 AND queued_at IS NULL AND cancelled_at IS NULL
+	`, b.ID, len(recipients))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrBroadcastNotPending
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO outbox (chat_id, user_id, kind, text, not_before, broadcast_id, attachment_type, attachment_file_id,
+		                    failed_at, blocked, last_error)
+		VALUES ($1, $2, 'broadcast', $3, COALESCE($4::TIMESTAMPTZ, NOW()), $5, NULLIF($6, ''), NULLIF($7, ''),
+		        CASE WHEN $8 THEN NOW() END, $8, CASE WHEN $8 THEN 'bot blocked by user' END)
+	`)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = stmt.Close() }()
+
+	for _, r := range recipients {
+		var at any
+		if t := notBefore(r); !t.IsZero() {
+			at = t
+		}
+		if _, err := stmt.ExecContext(ctx, r.ChatID, r.UserID, b.Text, at, b.ID, b.AttachmentType, b.AttachmentFileID, r.Blocked); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CancelBroadcast отменяет ещё не отправленную рассылку.
+func CancelBroadcast(ctx context.Context, database *sql.DB, id int64) error {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	res, err := database.ExecContext(ctx, `
+		UPDATE broadcasts SET cancelled_at = NOW()
+		WHERE id = $1 AND queued_at IS NULL AND cancelled_at IS NULL
+	`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrBroadcastNotPending
+	}
+	return nil
+}
+
+// BroadcastReport — итоги доставки рассылки.
+type BroadcastReport struct {
+	Sent, Pending, Blocked, Failed int
+}
+
+// GetBroadcastReport считает итоги доставки по сообщениям рассылки в outbox.
+func GetBroadcastReport(ctx context.Context, database *sql.DB, id int64) (BroadcastReport, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	var r BroadcastReport
+	err := database.QueryRowContext(ctx, `
+		SELECT
+		    COUNT(*) FILTER (WHERE sent_at IS NOT NULL),
+		    COUNT(*) FILTER (WHERE sent_at IS NULL AND failed_at IS NULL),
+		    COUNT(*) FILTER (WHERE failed_at IS NOT NULL AND blocked),
+		    COUNT(*) FILTER (WHERE failed_at IS NOT NULL AND NOT blocked)
+		FROM outbox WHERE broadcast_id = $1
+	`, id).Scan(&r.Sent, &r.Pending, &r.Blocked, &r.Failed)
+	return r, err
+}
@@ -0,0 +1,105 @@
+//go:build testutil
+// +build testutil
+
+package db_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/models"
+	"github.com/Spok95/telegram-school-bot/internal/testutil/testdb"
+)
+
+func TestBroadcast_RecipientsQueueReport(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+	h, err := testdb.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	s7a := mustSeedUser(ctx, t, h.DB, "Ученик 7А", models.Student, ptrInt64(7), ptrString("А"))
+	s7b := mustSeedUser(ctx, t, h.DB, "Ученик 7Б", models.Student, ptrInt64(7), ptrString("Б"))
+	parent := mustSeedUser(ctx, t, h.DB, "Родитель 7А", models.Parent, nil, nil)
+	teacher := mustSeedUser(ctx, t, h.DB, "Учитель", models.Teacher, nil, nil)
+	if _, err := h.DB.ExecContext(ctx, `INSERT INTO parents_students (parent_id, student_id) VALUES ($1, $2)`, parent, s7a); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.DB.ExecContext(ctx, `UPDATE users SET blocked_at = NOW() WHERE id = $1`, parent); err != nil {
+		t.Fatal(err)
+	}
+	var class7a int64
+	if err := h.DB.QueryRowContext(ctx, `SELECT id FROM classes WHERE number = 7 AND letter = 'А'`).Scan(&class7a); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := func(a db.BroadcastAudience) []int64 {
+		t.Helper()
+		rs, err := db.BroadcastRecipients(ctx, h.DB, a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []int64
+		for _, r := range rs {
+			out = append(out, r.UserID)
+		}
+		return out
+	}
+	if got := ids(db.BroadcastAudience{Kind: db.AudienceClasses, ClassIDs: []int64{class7a}, Who: db.WhoBoth}); len(got) != 2 || got[0] != s7a || got[1] != parent {
+		t.Fatalf("7А ученики и родители: ожидали [%d %d], получили %v", s7a, parent, got)
+	}
+	if got := ids(db.BroadcastAudience{Kind: db.AudienceClasses, ClassIDs: []int64{class7a}, Who: db.WhoStudents}); len(got) != 1 || got[0] != s7a {
+		t.Fatalf("7А ученики: получили %v (7Б %d не должен попасть)", got, s7b)
+	}
+	if got := ids(db.BroadcastAudience{Kind: db.AudienceStaff}); len(got) != 1 || got[0] != teacher {
+		t.Fatalf("сотрудники: получили %v", got)
+	}
+	if got := ids(db.BroadcastAudience{Kind: db.AudienceRole, Role: string(models.Student)}); len(got) != 2 {
+		t.Fatalf("все ученики: получили %v", got)
+	}
+
+	aud := db.BroadcastAudience{Kind: db.AudienceClasses, ClassIDs: []int64{class7a}, Who: db.WhoBoth}
+	b := db.Broadcast{Audience: aud, AudienceLabel: "7А — ученики и родители", Text: "Собрание в пятницу", ScheduledAt: time.Now()}
+	if b.ID, err = db.CreateBroadcast(ctx, h.DB, b); err != nil {
+		t.Fatal(err)
+	}
+	if due, err := db.DueBroadcasts(ctx, h.DB); err != nil || len(due) != 1 || due[0].Audience.Who != db.WhoBoth {
+		t.Fatalf("рассылка должна быть к отправке: %+v %v", due, err)
+	}
+
+	rs, err := db.BroadcastRecipients(ctx, h.DB, aud)
+	if err != nil {
+		t.Fatal(err)
+	}
+	asap := func(db.BroadcastRecipient) time.Time { return time.Time{} }
+	if err := db.QueueBroadcast(ctx, h.DB, b, rs, asap); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueueBroadcast(ctx, h.DB, b, rs, asap); !errors.Is(err, db.ErrBroadcastNotPending) {
+		t.Fatalf("повторная отправка должна быть отклонена, получили %v", err)
+	}
+
+	// ученику доставили, родитель заблокировал бота
+	got, err := db.ClaimOutbox(ctx, h.DB, 10, time.Minute)
+	if err != nil || len(got) != 1 || got[0].BroadcastID != b.ID {
+		t.Fatalf("в очереди должно быть одно сообщение рассылки: %+v %v", got, err)
+	}
+	if err := db.MarkOutboxSent(ctx, h.DB, []int64{got[0].ID}); err != nil {
+		t.Fatal(err)
+	}
+	rep, err := db.GetBroadcastReport(ctx, h.DB, b.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep != (db.BroadcastReport{Sent: 1, Blocked: 1}) {
+		t.Fatalf("отчёт: %+v", rep)
+	}
+	if err := db.CancelBroadcast(ctx, h.DB, b.ID); !errors.Is(err, db.ErrBroadcastNotPending) {
+		t.Fatalf("отправленную рассылку отменить нельзя, получили %v", err)
+	}
+}
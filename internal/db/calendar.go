@@ -0,0 +1,145 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/ctxutil"
+)
+
+// VacationNamePattern — периоды, в названии которых есть «каникул» («Осенние каникулы»,
+// «Каникулы 2 четверть»), считаются каникулами: консультации на эти даты не создаются.
+const VacationNamePattern = "%каникул%"
+
+// notNonWorkingDaySQL — SQL-условие «день не нерабочий» для выражения-даты (например, s.start_at::date).
+func notNonWorkingDaySQL(day string) string {
+	return `NOT EXISTS (SELECT 1 FROM school_holidays h WHERE h.day = ` + day + `)
+	  AND NOT EXISTS (SELECT 1 FROM periods p
+	                  WHERE p.name ILIKE '` + VacationNamePattern + `' AND ` + day + ` BETWEEN p.start_date AND p.end_date)`
+}
+
+// NonWorkingDays — нерабочие дни школы в интервале [from, to] (по датам): праздники
+// и каникулы из календаря, а также каникулы из periods. Ключ — дата в формате 2006-01-02.
+func NonWorkingDays(ctx context.Context, database *sql.DB, from, to time.Time) (map[string]bool, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	rows, err := database.QueryContext(ctx, `
+		SELECT d::DATE
+		FROM periods p,
+		     generate_series(GREATEST(p.start_date, $1::DATE), LEAST(p.end_date, $2::DATE), INTERVAL '1 day') AS d
+		WHERE p.name ILIKE $3 AND p.start_date <= $2::DATE AND p.end_date >= $1::DATE
+		UNION
+		SELECT day FROM school_holidays WHERE day BETWEEN $1::DATE AND $2::DATE
+	`, from.Format("2006-01-02"), to.Format("2006-01-02"), VacationNamePattern)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := make(map[string]bool)
+	for rows.Next() {
+		var d time.Time
+		if err := rows.Scan(&d); err != nil {
+			return nil, err
+		}
+		out[d.Format("2006-01-02")] = true
+	}
+	return out, rows.Err()
+}
+
+// HolidayTitle — название дня из календаря; ok == false — дня в календаре нет.
+func HolidayTitle(ctx context.Context, database *sql.DB, day time.Time) (string, bool, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	var title string
+	err := database.QueryRowContext(ctx, `
+		SELECT title FROM school_holidays WHERE day = $1::DATE
+	`, day.Format("2006-01-02")).Scan(&title)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return title, true, nil
+}
+
+// Holiday — нерабочий день календаря.
+type Holiday struct {
+	Day   time.Time
+	Title string
+}
+
+// ListHolidays — дни календаря начиная с from, по порядку.
+func ListHolidays(ctx context.Context, database *sql.DB, from time.Time, limit int) ([]Holiday, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	rows, err := database.QueryContext(ctx, `
+		SELECT day, title FROM school_holidays WHERE day >= $1::DATE ORDER BY day LIMIT $2
+	`, from.Format("2006-01-02"), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []Holiday
+	for rows.Next() {
+		var h Holiday
+		if err := rows.Scan(&h.Day, &h.Title); err != nil {
+			return nil, err
+		}
+		out = append(out, h)
+	}
+	return out, rows.Err()
+}
+
+// AddHolidays добавляет дни в календарь; у уже существующих дней обновляется название.
+// Возвращает число новых дней.
+func AddHolidays(ctx context.Context, database *sql.DB, days []Holiday, createdBy int64) (int, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	tx, err := database.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO school_holidays (day, title, created_by)
+		VALUES ($1::DATE, $2, NULLIF($3, 0))
+		ON CONFLICT (day) DO UPDATE SET title = EXCLUDED.title
+		RETURNING (xmax = 0)
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = stmt.Close() }()
+
+	added := 0
+	for _, h := range days {
+		var inserted bool
+		if err := stmt.QueryRowContext(ctx, h.Day.Format("2006-01-02"), h.Title, createdBy).Scan(&inserted); err != nil {
+			return 0, err
+		}
+		if inserted {
+			added++
+		}
+	}
+	return added, tx.Commit()
+}
+
+// DeleteHolidays убирает из календаря дни [from, to]. Возвращает число удалённых дней.
+func DeleteHolidays(ctx context.Context, database *sql.DB, from, to time.Time) (int, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	res, err := database.ExecContext(ctx, `
+		DELETE FROM school_holidays WHERE day BETWEEN $1::DATE AND $2::DATE
+	`, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/ctxutil"
+)
+
+// newCalendarToken — 32 случайных байта в base64url: токен заменяет пароль в ссылке.
+func newCalendarToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// CalendarToken — токен подписки пользователя; при первом обращении создаётся.
+func CalendarToken(ctx context.Context, database *sql.DB, userID int64) (string, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	token, err := newCalendarToken()
+	if err != nil {
+		return "", err
+	}
+	// при конфликте возвращаем уже выданный токен
+	err = database.QueryRowContext(ctx, `
+		INSERT INTO calendar_tokens (user_id, token) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET user_id = EXCLUDED.user_id
+		RETURNING token
+	`, userID, token).Scan(&token)
+	return token, err
+}
+
+// ResetCalendarToken выдаёт новый токен: старая ссылка перестаёт работать.
+func ResetCalendarToken(ctx context.Context, database *sql.DB, userID int64) (string, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	token, err := newCalendarToken()
+	if err != nil {
+		return "", err
+	}
+	_, err = database.ExecContext(ctx, `
+		INSERT INTO calendar_tokens (user_id, token) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET token = EXCLUDED.token, created_at = NOW()
+	`, userID, token)
+	return token, err
+}
+
+// CalendarTokenUser — id активного пользователя по токену; ok == false — токен неизвестен.
+func CalendarTokenUser(ctx context.Context, database *sql.DB, token string) (int64, bool, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	var id int64
+	err := database.QueryRowContext(ctx, `
+		SELECT u.id
+		FROM calendar_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token = $1 AND u.is_active = TRUE
+	`, token).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return id, true, nil
+}
+
+// CalendarConsult — занятый слот с подписями для календаря.
+type CalendarConsult struct {
+	Slot        ConsultSlot
+	TeacherName string
+	ParentName  string
+	ChildName   string
+	ClassLabel  string
+}
+
+// ListCalendarConsults — записи на консультации в [from, to), где пользователь — учитель
+// или записавшийся родитель. Свободные слоты в календарь не попадают.
+func ListCalendarConsults(ctx context.Context, database *sql.DB, userID int64, from, to time.Time) ([]CalendarConsult, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	rows, err := database.QueryContext(ctx, `
+		SELECT s.id, s.teacher_id, s.class_id, s.start_at, s.end_at, s.booked_by_id, s.consult_format, s.online_url,
+		       COALESCE(t.name, ''), COALESCE(p.name, ''), COALESCE(ch.name, ''),
+		       COALESCE(c.number::text || c.letter, '')
+		FROM consult_slots s
+		LEFT JOIN users t ON t.id = s.teacher_id
+		LEFT JOIN users p ON p.id = s.booked_by_id
+		LEFT JOIN users ch ON ch.id = s.booked_child_id
+		LEFT JOIN classes c ON c.id = COALESCE(s.booked_class_id, s.class_id)
+		WHERE s.booked_by_id IS NOT NULL
+		  AND (s.teacher_id = $1 OR s.booked_by_id = $1)
+		  AND s.start_at >= $2::timestamp without time zone AND s.start_at < $3::timestamp without time zone
+		ORDER BY s.start_at
+	`, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []CalendarConsult
+	for rows.Next() {
+		var c CalendarConsult
+		if err := rows.Scan(&c.Slot.ID, &c.Slot.TeacherID, &c.Slot.ClassID, &c.Slot.StartAt, &c.Slot.EndAt,
+			&c.Slot.BookedByID, &c.Slot.ConsultFormat, &c.Slot.OnlineURL,
+			&c.TeacherName, &c.ParentName, &c.ChildName, &c.ClassLabel); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
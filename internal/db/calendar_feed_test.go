@@ -0,0 +1,75 @@
+//go:build testutil
+// +build testutil
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/models"
+	"github.com/Spok95/telegram-school-bot/internal/testutil/testdb"
+)
+
+func TestCalendarFeed_TokenAndConsults(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+	h, err := testdb.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	teacher := mustSeedUser(ctx, t, h.DB, "Учитель", models.Teacher, nil, nil)
+	parent := mustSeedUser(ctx, t, h.DB, "Родитель", models.Parent, nil, nil)
+	child := mustSeedUser(ctx, t, h.DB, "Ученик", models.Student, ptrInt64(7), ptrString("А"))
+	var classID int64
+	if err := h.DB.QueryRowContext(ctx, `SELECT id FROM classes WHERE number = 7 AND letter = 'А'`).Scan(&classID); err != nil {
+		t.Fatal(err)
+	}
+
+	day := time.Now().AddDate(0, 0, 3)
+	start := time.Date(day.Year(), day.Month(), day.Day(), 16, 0, 0, 0, time.Local)
+	if _, err := db.CreateSlotsMultiClasses(ctx, h.DB, teacher, []int64{classID}, []time.Time{start, start.Add(20 * time.Minute)}, 20, "offline"); err != nil {
+		t.Fatal(err)
+	}
+	var slotID int64
+	if err := h.DB.QueryRowContext(ctx, `SELECT id FROM consult_slots WHERE teacher_id = $1 ORDER BY start_at LIMIT 1`, teacher).Scan(&slotID); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := db.TryBookSlotWithChild(ctx, h.DB, slotID, parent, child, classID); err != nil || !ok {
+		t.Fatalf("бронь: ok=%v err=%v", ok, err)
+	}
+
+	token, err := db.CalendarToken(ctx, h.DB, parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := db.CalendarToken(ctx, h.DB, parent); err != nil || again != token {
+		t.Fatalf("повторный запрос должен вернуть тот же токен: %q %v", again, err)
+	}
+	if id, ok, err := db.CalendarTokenUser(ctx, h.DB, token); err != nil || !ok || id != parent {
+		t.Fatalf("CalendarTokenUser: id=%d ok=%v err=%v", id, ok, err)
+	}
+	fresh, err := db.ResetCalendarToken(ctx, h.DB, parent)
+	if err != nil || fresh == token {
+		t.Fatalf("ResetCalendarToken: %q %v", fresh, err)
+	}
+	if _, ok, _ := db.CalendarTokenUser(ctx, h.DB, token); ok {
+		t.Fatal("старый токен должен перестать работать")
+	}
+
+	from, to := time.Now().AddDate(0, 0, -1), time.Now().AddDate(0, 0, 10)
+	for _, userID := range []int64{teacher, parent} {
+		got, err := db.ListCalendarConsults(ctx, h.DB, userID, from, to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// свободный слот в календарь не попадает
+		if len(got) != 1 || got[0].Slot.ID != slotID || got[0].ChildName != "Ученик" || got[0].ClassLabel != "7А" {
+			t.Fatalf("пользователь %d: неверные записи %+v", userID, got)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+//go:build testutil
+// +build testutil
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/models"
+	"github.com/Spok95/telegram-school-bot/internal/testutil/testdb"
+)
+
+func TestHolidays_HideFreeSlots(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+	h, err := testdb.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	teacher := mustSeedUser(ctx, t, h.DB, "Учитель", models.Teacher, nil, nil)
+	var classID int64
+	if err := h.DB.QueryRowContext(ctx, `SELECT id FROM classes WHERE number = 7 AND letter = 'А'`).Scan(&classID); err != nil {
+		t.Fatal(err)
+	}
+
+	day := time.Now().AddDate(0, 0, 7)
+	holiday := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
+	workday := holiday.AddDate(0, 0, 1)
+	starts := []time.Time{holiday.Add(16 * time.Hour), workday.Add(16 * time.Hour)}
+	if _, err := db.CreateSlotsMultiClasses(ctx, h.DB, teacher, []int64{classID}, starts, 20, "offline"); err != nil {
+		t.Fatal(err)
+	}
+
+	added, err := db.AddHolidays(ctx, h.DB, []db.Holiday{{Day: holiday, Title: "Праздник"}}, 0)
+	if err != nil || added != 1 {
+		t.Fatalf("AddHolidays: added=%d err=%v", added, err)
+	}
+	// повторное добавление обновляет название, а не дублирует день
+	if added, err = db.AddHolidays(ctx, h.DB, []db.Holiday{{Day: holiday, Title: "День города"}}, 0); err != nil || added != 0 {
+		t.Fatalf("повторный AddHolidays: added=%d err=%v", added, err)
+	}
+	if title, ok, err := db.HolidayTitle(ctx, h.DB, holiday); err != nil || !ok || title != "День города" {
+		t.Fatalf("HolidayTitle: %q %v %v", title, ok, err)
+	}
+
+	off, err := db.NonWorkingDays(ctx, h.DB, holiday, workday)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !off[holiday.Format("2006-01-02")] || off[workday.Format("2006-01-02")] {
+		t.Fatalf("неверные нерабочие дни: %v", off)
+	}
+
+	days, err := db.ListDaysWithFreeSlotsByTeacherForClass(ctx, h.DB, teacher, classID, holiday, workday.AddDate(0, 0, 1), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 1 || days[0].Format("2006-01-02") != workday.Format("2006-01-02") {
+		t.Fatalf("в записи должен остаться только рабочий день, получили %v", days)
+	}
+	slots, err := db.ListFreeSlotsByTeacherOnDateForClass(ctx, h.DB, teacher, classID, holiday, time.Local, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slots) != 0 {
+		t.Fatalf("слоты в праздник не должны предлагаться, получили %d", len(slots))
+	}
+
+	if n, err := db.DeleteHolidays(ctx, h.DB, holiday, holiday); err != nil || n != 1 {
+		t.Fatalf("DeleteHolidays: n=%d err=%v", n, err)
+	}
+	if slots, err = db.ListFreeSlotsByTeacherOnDateForClass(ctx, h.DB, teacher, classID, holiday, time.Local, 10); err != nil || len(slots) != 1 {
+		t.Fatalf("после удаления праздника слот снова доступен: %d %v", len(slots), err)
+	}
+}
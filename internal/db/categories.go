@@ -7,13 +7,14 @@ import (
 
 	"github.com/Spok95/telegram-school-bot/internal/ctxutil"
 	"github.com/Spok95/telegram-school-bot/internal/models"
+	"github.com/Spok95/telegram-school-bot/internal/rating"
 )
 
 func GetLevelByID(ctx context.Context, database *sql.DB, levelID int) (*models.ScoreLevel, error) {
 	ctx, cancel := ctxutil.WithDBTimeout(ctx)
 	defer cancel()
 	var level models.ScoreLevel
-	err := database.QueryRowContext(ctx, "SELECT id, value, label, category_id FROM score_levels WHERE id = $1", levelID).Scan(&level.ID, &level.Value, &level.Label, &level.CategoryID)
+	err := database.QueryRowContext(ctx, "SELECT id, value, label, category_id, is_active, collective_percent FROM score_levels WHERE id = $1", levelID).Scan(&level.ID, &level.Value, &level.Label, &level.CategoryID, &level.IsActive, &level.CollectivePercent)
 	if err != nil {
 		return nil, err
 	}
@@ -24,7 +25,7 @@ func GetLevelByID(ctx context.Context, database *sql.DB, levelID int) (*models.S
 func GetCategories(ctx context.Context, database *sql.DB, includeInactive bool) ([]models.Category, error) {
 	ctx, cancel := ctxutil.WithDBTimeout(ctx)
 	defer cancel()
-	query := "SELECT id, name, label, is_active FROM categories"
+	query := "SELECT id, name, label, is_active, affects_collective, collective_percent FROM categories"
 	if !includeInactive {
 		query += " WHERE is_active = TRUE"
 	}
@@ -39,7 +40,7 @@ func GetCategories(ctx context.Context, database *sql.DB, includeInactive bool)
 	var out []models.Category
 	for rows.Next() {
 		var c models.Category
-		if err := rows.Scan(&c.ID, &c.Name, &c.Label, &c.IsActive); err != nil {
+		if err := rows.Scan(&c.ID, &c.Name, &c.Label, &c.IsActive, &c.AffectsCollective, &c.CollectivePercent); err != nil {
 			return nil, err
 		}
 		out = append(out, c)
@@ -54,9 +55,9 @@ func GetCategoryByID(ctx context.Context, database *sql.DB, id int64) (*models.C
 	defer cancel()
 	var c models.Category
 	err := database.QueryRowContext(ctx,
-		"SELECT id, name, label, is_active FROM categories WHERE id = $1",
+		"SELECT id, name, label, is_active, affects_collective, collective_percent FROM categories WHERE id = $1",
 		id,
-	).Scan(&c.ID, &c.Name, &c.Label, &c.IsActive)
+	).Scan(&c.ID, &c.Name, &c.Label, &c.IsActive, &c.AffectsCollective, &c.CollectivePercent)
 	if err != nil {
 		return nil, err
 	}
@@ -115,11 +116,33 @@ func SetCategoryActive(ctx context.Context, database *sql.DB, id int64, active b
 	return nil
 }
 
+// SetCategoryCollective — правило коллективного рейтинга для категории.
+// Уже подтверждённые начисления не пересчитываются: новое правило действует для новых.
+func SetCategoryCollective(ctx context.Context, database *sql.DB, id int64, affects bool, percent int) error {
+	if !rating.ValidPercent(percent) {
+		return errors.New("процент должен быть от 0 до 100")
+	}
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	res, err := database.ExecContext(ctx,
+		"UPDATE categories SET affects_collective = $1, collective_percent = $2 WHERE id = $3",
+		affects, percent, id,
+	)
+	if err != nil {
+		return err
+	}
+	aff, _ := res.RowsAffected()
+	if aff == 0 {
+		return errors.New("категория не найдена")
+	}
+	return nil
+}
+
 // GetLevelsByCategoryIDFull список уровней категории (includeInactive как выше)
 func GetLevelsByCategoryIDFull(ctx context.Context, database *sql.DB, catID int64, includeInactive bool) ([]models.ScoreLevel, error) {
 	ctx, cancel := ctxutil.WithDBTimeout(ctx)
 	defer cancel()
-	query := "SELECT id, value, label, category_id, is_active FROM score_levels WHERE category_id = $1"
+	query := "SELECT id, value, label, category_id, is_active, collective_percent FROM score_levels WHERE category_id = $1"
 	if !includeInactive {
 		query += " AND is_active = TRUE"
 	}
@@ -134,7 +157,7 @@ func GetLevelsByCategoryIDFull(ctx context.Context, database *sql.DB, catID int6
 	var out []models.ScoreLevel
 	for rows.Next() {
 		var l models.ScoreLevel
-		if err := rows.Scan(&l.ID, &l.Value, &l.Label, &l.CategoryID, &l.IsActive); err != nil {
+		if err := rows.Scan(&l.ID, &l.Value, &l.Label, &l.CategoryID, &l.IsActive, &l.CollectivePercent); err != nil {
 			return nil, err
 		}
 		out = append(out, l)
@@ -191,6 +214,27 @@ func SetLevelActive(ctx context.Context, database *sql.DB, id int64, active bool
 	return nil
 }
 
+// SetLevelCollectivePercent — процент уровня для коллективного рейтинга (nil — как у категории).
+func SetLevelCollectivePercent(ctx context.Context, database *sql.DB, id int64, percent *int) error {
+	if percent != nil && !rating.ValidPercent(*percent) {
+		return errors.New("процент должен быть от 0 до 100")
+	}
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	res, err := database.ExecContext(ctx,
+		"UPDATE score_levels SET collective_percent = $1 WHERE id = $2",
+		percent, id,
+	)
+	if err != nil {
+		return err
+	}
+	aff, _ := res.RowsAffected()
+	if aff == 0 {
+		return errors.New("уровень не найден")
+	}
+	return nil
+}
+
 func GetCategoryIDByName(ctx context.Context, database *sql.DB, name string) int {
 	ctx, cancel := ctxutil.WithDBTimeout(ctx)
 	defer cancel()
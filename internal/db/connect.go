@@ -10,17 +10,26 @@ import (
 )
 
 func MustOpen() (*sql.DB, error) {
-	dsn := os.Getenv("DATABASE_URL")
-	db, err := sql.Open("pgx", dsn)
+	db, err := Open(os.Getenv("DATABASE_URL"))
 	if err != nil {
 		panic(err)
 	}
+	return db, nil
+}
+
+// Open — пул соединений с проверкой связи и теми же настройками, что у бота (для schoolctl).
+func Open(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
 	// Клиентский таймаут на первичную проверку соединения
 	{
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 		if err := db.PingContext(ctx); err != nil {
-			panic(err)
+			_ = db.Close()
+			return nil, err
 		}
 	}
 
@@ -0,0 +1,228 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/ctxutil"
+	"github.com/lib/pq"
+)
+
+// ConsultTemplate — шаблон еженедельного расписания консультаций учителя.
+type ConsultTemplate struct {
+	ID             int64
+	TeacherID      int64
+	Weekday        time.Weekday
+	StartMin       int // начало окна, минуты от полуночи
+	EndMin         int // конец окна, минуты от полуночи
+	StepMin        int
+	ConsultFormat  string // "online" | "offline"
+	ClassIDs       []int64
+	Paused         bool
+	GeneratedUntil *time.Time // до какого дня включительно слоты уже созданы
+	UpdatedAt      time.Time
+}
+
+const consultTemplateColumns = `
+	id, teacher_id, weekday, start_min, end_min, step_min, consult_format, class_ids, paused, generated_until, updated_at`
+
+func scanConsultTemplate(row interface{ Scan(...any) error }) (ConsultTemplate, error) {
+	var t ConsultTemplate
+	var wd int
+	err := row.Scan(&t.ID, &t.TeacherID, &wd, &t.StartMin, &t.EndMin, &t.StepMin, &t.ConsultFormat,
+		pq.Array(&t.ClassIDs), &t.Paused, &t.GeneratedUntil, &t.UpdatedAt)
+	t.Weekday = time.Weekday(wd)
+	return t, err
+}
+
+func queryConsultTemplates(ctx context.Context, database *sql.DB, query string, args ...any) ([]ConsultTemplate, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	rows, err := database.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []ConsultTemplate
+	for rows.Next() {
+		t, err := scanConsultTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// CreateConsultTemplate сохраняет шаблон; слоты по нему создаст GenerateTemplateSlots.
+func CreateConsultTemplate(ctx context.Context, database *sql.DB, t ConsultTemplate) (int64, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	var id int64
+	err := database.QueryRowContext(ctx, `
+		INSERT INTO consult_templates (teacher_id, weekday, start_min, end_min, step_min, consult_format, class_ids)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`, t.TeacherID, int(t.Weekday), t.StartMin, t.EndMin, t.StepMin, t.ConsultFormat, pq.Array(t.ClassIDs)).Scan(&id)
+	return id, err
+}
+
+// GetConsultTemplate — шаблон учителя по id; nil, если его нет или он чужой.
+func GetConsultTemplate(ctx context.Context, database *sql.DB, teacherID, id int64) (*ConsultTemplate, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	t, err := scanConsultTemplate(database.QueryRowContext(ctx,
+		`SELECT `+consultTemplateColumns+` FROM consult_templates WHERE id = $1 AND teacher_id = $2`, id, teacherID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// ListConsultTemplates — шаблоны учителя по дням недели и времени.
+func ListConsultTemplates(ctx context.Context, database *sql.DB, teacherID int64) ([]ConsultTemplate, error) {
+	return queryConsultTemplates(ctx, database, `
+		SELECT `+consultTemplateColumns+` FROM consult_templates
+		WHERE teacher_id = $1
+		ORDER BY (weekday + 6) % 7, start_min, id
+	`, teacherID)
+}
+
+// ListActiveConsultTemplates — шаблоны активных учителей, которые не на паузе.
+func ListActiveConsultTemplates(ctx context.Context, database *sql.DB) ([]ConsultTemplate, error) {
+	return queryConsultTemplates(ctx, database, `
+		SELECT `+consultTemplateColumns+` FROM consult_templates t
+		WHERE NOT t.paused
+		  AND EXISTS (SELECT 1 FROM users u WHERE u.id = t.teacher_id AND u.is_active = TRUE)
+		ORDER BY t.id
+	`)
+}
+
+// UpdateConsultTemplate меняет окно, шаг, формат и классы шаблона. Будущие свободные слоты
+// шаблона удаляются, а горизонт сбрасывается — задача создаст слоты заново по новым
+// правилам. Занятые слоты остаются как есть. Возвращает число удалённых слотов.
+func UpdateConsultTemplate(ctx context.Context, database *sql.DB, t ConsultTemplate, now time.Time) (int, error) {
+	return changeConsultTemplate(ctx, database, t.TeacherID, t.ID, now, `
+		UPDATE consult_templates
+		SET weekday = $3, start_min = $4, end_min = $5, step_min = $6, consult_format = $7, class_ids = $8,
+		    generated_until = NULL, updated_at = NOW()
+		WHERE id = $1 AND teacher_id = $2
+	`, int(t.Weekday), t.StartMin, t.EndMin, t.StepMin, t.ConsultFormat, pq.Array(t.ClassIDs))
+}
+
+// SetConsultTemplatePaused ставит шаблон на паузу (будущие свободные слоты удаляются)
+// или снимает с паузы (слоты появятся при следующем запуске задачи).
+func SetConsultTemplatePaused(ctx context.Context, database *sql.DB, teacherID, id int64, paused bool, now time.Time) (int, error) {
+	return changeConsultTemplate(ctx, database, teacherID, id, now, `
+		UPDATE consult_templates
+		SET paused = $3, generated_until = NULL, updated_at = NOW()
+		WHERE id = $1 AND teacher_id = $2
+	`, paused)
+}
+
+// DeleteConsultTemplate удаляет шаблон вместе с его будущими свободными слотами.
+func DeleteConsultTemplate(ctx context.Context, database *sql.DB, teacherID, id int64, now time.Time) (int, error) {
+	return changeConsultTemplate(ctx, database, teacherID, id, now,
+		`DELETE FROM consult_templates WHERE id = $1 AND teacher_id = $2`)
+}
+
+// changeConsultTemplate выполняет изменение шаблона и в той же транзакции убирает
+// его свободные слоты начиная с now. sql.ErrNoRows — шаблона нет или он чужой.
+func changeConsultTemplate(ctx context.Context, database *sql.DB, teacherID, id int64, now time.Time, query string, args ...any) (int, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	tx, err := database.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, `
+		DELETE FROM consult_slots s
+		USING consult_templates t
+		WHERE s.template_id = t.id AND t.id = $1 AND t.teacher_id = $2
+		  AND s.booked_by_id IS NULL AND s.start_at >= $3::timestamp without time zone
+	`, id, teacherID, now)
+	if err != nil {
+		return 0, err
+	}
+	removed, _ := res.RowsAffected()
+
+	res, err = tx.ExecContext(ctx, query, append([]any{id, teacherID}, args...)...)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, sql.ErrNoRows
+	}
+	return int(removed), tx.Commit()
+}
+
+// GenerateTemplateSlots создаёт слоты шаблона на указанные старты и сдвигает его горизонт
+// до until. Старт пропускается, если у учителя на это время уже есть слот (созданный
+// вручную или другим шаблоном). Возвращает число созданных слотов.
+func GenerateTemplateSlots(ctx context.Context, database *sql.DB, t ConsultTemplate, starts []time.Time, until time.Time) (int, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	tx, err := database.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// шаблон могли изменить или поставить на паузу, пока считались старты
+	var paused bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT paused FROM consult_templates WHERE id = $1 AND updated_at = $2 FOR UPDATE
+	`, t.ID, t.UpdatedAt).Scan(&paused)
+	if errors.Is(err, sql.ErrNoRows) || paused {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	dur := time.Duration(t.StepMin) * time.Minute
+	created := 0
+	for _, st := range starts {
+		var slotID int64
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO consult_slots (teacher_id, class_id, start_at, end_at, consult_format, template_id)
+			SELECT $1, $2, $3::timestamp without time zone, $4::timestamp without time zone, $5, $6
+			WHERE NOT EXISTS (
+			    SELECT 1 FROM consult_slots
+			    WHERE teacher_id = $1
+			      AND tsrange(start_at, end_at, '[)') && tsrange($3::timestamp without time zone, $4::timestamp without time zone, '[)')
+			)
+			ON CONFLICT (teacher_id, start_at) DO NOTHING
+			RETURNING id
+		`, t.TeacherID, t.ClassIDs[0], st, st.Add(dur), t.ConsultFormat, t.ID).Scan(&slotID)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO consult_slot_classes (slot_id, class_id)
+			SELECT $1, unnest($2::BIGINT[])
+			ON CONFLICT DO NOTHING
+		`, slotID, pq.Array(t.ClassIDs)); err != nil {
+			return 0, err
+		}
+		created++
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE consult_templates SET generated_until = $2::DATE WHERE id = $1
+	`, t.ID, until.Format("2006-01-02")); err != nil {
+		return 0, err
+	}
+	return created, tx.Commit()
+}
@@ -0,0 +1,102 @@
+//go:build testutil
+// +build testutil
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/models"
+	"github.com/Spok95/telegram-school-bot/internal/testutil/testdb"
+)
+
+func TestConsultTemplates_EditKeepsBookedSlots(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+	h, err := testdb.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	teacher := mustSeedUser(ctx, t, h.DB, "Учитель", models.Teacher, nil, nil)
+	parent := mustSeedUser(ctx, t, h.DB, "Родитель", models.Parent, nil, nil)
+	var classID int64
+	if err := h.DB.QueryRowContext(ctx, `SELECT id FROM classes WHERE number = 7 AND letter = 'А'`).Scan(&classID); err != nil {
+		t.Fatal(err)
+	}
+
+	day := time.Now().AddDate(0, 0, 7)
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
+	tpl := db.ConsultTemplate{TeacherID: teacher, Weekday: day.Weekday(), StartMin: 16 * 60, EndMin: 17 * 60,
+		StepMin: 30, ConsultFormat: "offline", ClassIDs: []int64{classID}}
+	if tpl.ID, err = db.CreateConsultTemplate(ctx, h.DB, tpl); err != nil {
+		t.Fatal(err)
+	}
+	got, err := db.GetConsultTemplate(ctx, h.DB, teacher, tpl.ID)
+	if err != nil || got == nil {
+		t.Fatalf("шаблон не найден: %v", err)
+	}
+	starts := []time.Time{day.Add(16 * time.Hour), day.Add(16*time.Hour + 30*time.Minute)}
+	if n, err := db.GenerateTemplateSlots(ctx, h.DB, *got, starts, day); err != nil || n != 2 {
+		t.Fatalf("ожидали 2 слота: n=%d err=%v", n, err)
+	}
+	// повторный запуск не дублирует слоты: пересекающиеся старты пропускаются
+	if n, err := db.GenerateTemplateSlots(ctx, h.DB, *got, starts, day); err != nil || n != 0 {
+		t.Fatalf("повторная генерация не должна дублировать слоты: n=%d err=%v", n, err)
+	}
+
+	// родитель записался на первый слот
+	if _, err := h.DB.ExecContext(ctx, `
+		UPDATE consult_slots SET booked_by_id = $1, booked_class_id = $2, booked_at = NOW()
+		WHERE template_id = $3 AND start_at = $4::timestamp without time zone
+	`, parent, classID, tpl.ID, starts[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	// изменение шаблона удаляет только свободные будущие слоты
+	tpl.StepMin = 20
+	removed, err := db.UpdateConsultTemplate(ctx, h.DB, tpl, time.Now())
+	if err != nil || removed != 1 {
+		t.Fatalf("ожидали удаление одного свободного слота: removed=%d err=%v", removed, err)
+	}
+	var left int
+	if err := h.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM consult_slots WHERE template_id = $1`, tpl.ID).Scan(&left); err != nil {
+		t.Fatal(err)
+	}
+	if left != 1 {
+		t.Fatalf("занятый слот должен остаться, слотов шаблона: %d", left)
+	}
+	if got, err = db.GetConsultTemplate(ctx, h.DB, teacher, tpl.ID); err != nil || got.GeneratedUntil != nil {
+		t.Fatalf("после изменения горизонт сбрасывается: %+v %v", got, err)
+	}
+
+	// пауза: шаблон не попадает в генерацию, чужой учитель его не видит
+	if _, err := db.SetConsultTemplatePaused(ctx, h.DB, teacher, tpl.ID, true, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	active, err := db.ListActiveConsultTemplates(ctx, h.DB)
+	if err != nil || len(active) != 0 {
+		t.Fatalf("шаблон на паузе не должен генерироваться: %+v %v", active, err)
+	}
+	if other, err := db.GetConsultTemplate(ctx, h.DB, parent, tpl.ID); err != nil || other != nil {
+		t.Fatalf("чужой шаблон недоступен: %+v %v", other, err)
+	}
+
+	// каникулы из periods
+	if _, err := h.DB.ExecContext(ctx, `
+		INSERT INTO periods (name, start_date, end_date) VALUES ('Осенние каникулы', '2025-10-27', '2025-11-04')
+	`); err != nil {
+		t.Fatal(err)
+	}
+	off, err := db.NonWorkingDays(ctx, h.DB, time.Date(2025, 11, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 11, 10, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(off) != 4 || !off["2025-11-04"] || off["2025-11-05"] {
+		t.Fatalf("каникулы 01.11–04.11: получили %v", off)
+	}
+}
@@ -0,0 +1,313 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/ctxutil"
+	"github.com/lib/pq"
+)
+
+// slotOpenSQL — слот не закреплён за родителем из листа ожидания (или срок предложения вышел).
+// prefix — алиас таблицы с точкой («s.») или пустая строка.
+func slotOpenSQL(prefix string) string {
+	return `(` + prefix + `offer_expires_at IS NULL OR ` + prefix + `offer_expires_at <= NOW())`
+}
+
+// WaitlistEntry — место родителя в очереди к учителю. Weekdays — удобные дни недели
+// (0 — воскресенье … 6 — суббота), пусто — подходит любой день.
+type WaitlistEntry struct {
+	ID          int64
+	TeacherID   int64
+	TeacherName string
+	ClassID     int64
+	ChildID     int64
+	ChildName   string
+	Weekdays    []int64
+	CreatedAt   time.Time
+}
+
+// WaitlistOffer — слот, на время закреплённый за родителем из очереди.
+type WaitlistOffer struct {
+	EntryID   int64
+	SlotID    int64
+	ParentID  int64
+	ChildID   int64
+	ClassID   int64
+	ExpiresAt time.Time
+}
+
+// JoinWaitlist ставит родителя в очередь к учителю (для ребёнка из класса classID).
+// Повторная запись только меняет класс и дни, место в очереди сохраняется.
+func JoinWaitlist(ctx context.Context, database *sql.DB, teacherID, classID, parentID, childID int64, weekdays []int64) (int64, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	if weekdays == nil {
+		weekdays = []int64{}
+	}
+	var id int64
+	err := database.QueryRowContext(ctx, `
+		INSERT INTO consult_waitlist (teacher_id, class_id, parent_id, child_id, weekdays)
+		VALUES ($1, $2, $3, $4, $5::smallint[])
+		ON CONFLICT (teacher_id, parent_id, child_id) DO UPDATE
+		SET class_id = EXCLUDED.class_id, weekdays = EXCLUDED.weekdays
+		RETURNING id
+	`, teacherID, classID, parentID, childID, pq.Array(weekdays)).Scan(&id)
+	return id, err
+}
+
+// LeaveWaitlist убирает запись родителя из очереди и освобождает закреплённый за ней слот.
+// Возвращает учителя, чтобы слот можно было сразу предложить следующему.
+func LeaveWaitlist(ctx context.Context, database *sql.DB, parentID, entryID int64) (teacherID int64, ok bool, err error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	tx, err := database.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	err = tx.QueryRowContext(ctx, `
+		SELECT teacher_id FROM consult_waitlist WHERE id = $1 AND parent_id = $2 FOR UPDATE
+	`, entryID, parentID).Scan(&teacherID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE consult_slots
+		SET offer_waitlist_id = NULL, offer_parent_id = NULL, offer_expires_at = NULL
+		WHERE offer_waitlist_id = $1
+	`, entryID); err != nil {
+		return 0, false, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM consult_waitlist WHERE id = $1`, entryID); err != nil {
+		return 0, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, false, err
+	}
+	return teacherID, true, nil
+}
+
+// ListParentWaitlist — очереди, в которых стоит родитель.
+func ListParentWaitlist(ctx context.Context, database *sql.DB, parentID int64) ([]WaitlistEntry, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	rows, err := database.QueryContext(ctx, `
+		SELECT w.id, w.teacher_id, COALESCE(t.name, ''), w.class_id, w.child_id, COALESCE(ch.name, ''),
+		       w.weekdays, w.created_at
+		FROM consult_waitlist w
+		LEFT JOIN users t ON t.id = w.teacher_id
+		LEFT JOIN users ch ON ch.id = w.child_id
+		WHERE w.parent_id = $1
+		ORDER BY w.created_at, w.id
+	`, parentID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []WaitlistEntry
+	for rows.Next() {
+		var e WaitlistEntry
+		if err := rows.Scan(&e.ID, &e.TeacherID, &e.TeacherName, &e.ClassID, &e.ChildID, &e.ChildName,
+			pq.Array(&e.Weekdays), &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// ListWaitlistTeachers — учителя, к которым кто-то стоит в очереди.
+func ListWaitlistTeachers(ctx context.Context, database *sql.DB) ([]int64, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	rows, err := database.QueryContext(ctx, `SELECT DISTINCT teacher_id FROM consult_waitlist ORDER BY teacher_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, rows.Err()
+}
+
+// ListFullyBookedTeachersForClass — учителя, у которых есть слоты для classID в [from, to),
+// но ни одного свободного в будущем: к ним можно встать в лист ожидания.
+func ListFullyBookedTeachersForClass(ctx context.Context, database *sql.DB, classID int64, from, to time.Time, limit int) ([]TeacherLite, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	rows, err := database.QueryContext(ctx, `
+		SELECT u.id, u.name
+		FROM users u
+		JOIN consult_slots s ON s.teacher_id = u.id
+		WHERE u.role = 'teacher'
+		  AND s.start_at >= $2::timestamp without time zone AND s.start_at < $3::timestamp without time zone
+		  AND (
+		        s.class_id = $1
+		     OR EXISTS (SELECT 1 FROM consult_slot_classes csc WHERE csc.slot_id = s.id AND csc.class_id = $1)
+		  )
+		GROUP BY u.id, u.name
+		HAVING NOT COALESCE(bool_or(
+		           s.booked_by_id IS NULL AND s.start_at > NOW()
+		       AND `+slotOpenSQL("s.")+`
+		       AND `+notNonWorkingDaySQL("s.start_at::date")+`
+		       ), FALSE)
+		ORDER BY u.name
+		LIMIT $4
+	`, classID, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []TeacherLite
+	for rows.Next() {
+		var t TeacherLite
+		if err := rows.Scan(&t.ID, &t.Name); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// AssignWaitlistOffers закрепляет свободные слоты учителя за родителями из очереди:
+// по порядку очереди каждому, у кого нет действующего предложения, — ближайший подходящий
+// по классу и дням слот, который ему ещё не предлагали. Слот закрепляется на ttl,
+// предложения слишком близко к началу консультации не делаются.
+func AssignWaitlistOffers(ctx context.Context, database *sql.DB, teacherID int64, ttl time.Duration) ([]WaitlistOffer, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	tx, err := database.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// отмена, новые слоты и фоновая задача могут прийти одновременно — очередь учителя разбираем по одному;
+	// двухключевая блокировка с пространством «consult_waitlist» не пересекается с другими
+	if _, err := tx.ExecContext(ctx,
+		`SELECT pg_advisory_xact_lock(hashtext('consult_waitlist'), ($1::bigint % 2147483647)::int)`, teacherID); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT w.id, w.parent_id, w.child_id, w.class_id, w.weekdays
+		FROM consult_waitlist w
+		WHERE w.teacher_id = $1
+		  AND NOT EXISTS (
+		      SELECT 1 FROM consult_slots s
+		      WHERE s.offer_waitlist_id = w.id AND s.booked_by_id IS NULL AND s.offer_expires_at > NOW()
+		  )
+		ORDER BY w.created_at, w.id
+	`, teacherID)
+	if err != nil {
+		return nil, err
+	}
+	type entry struct {
+		WaitlistOffer
+		weekdays []int64
+	}
+	var queue []entry
+	for rows.Next() {
+		var e entry
+		if err := rows.Scan(&e.EntryID, &e.ParentID, &e.ChildID, &e.ClassID, pq.Array(&e.weekdays)); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		queue = append(queue, e)
+	}
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return nil, err
+	}
+	_ = rows.Close()
+
+	secs := int64(ttl / time.Second)
+	var out []WaitlistOffer
+	for _, e := range queue {
+		if e.weekdays == nil {
+			e.weekdays = []int64{}
+		}
+		err := tx.QueryRowContext(ctx, `
+			UPDATE consult_slots
+			SET offer_waitlist_id = $2,
+			    offer_parent_id   = $3,
+			    offer_expires_at  = NOW() + make_interval(secs => $4)
+			WHERE booked_by_id IS NULL
+			  AND id = (
+			      SELECT s.id FROM consult_slots s
+			      WHERE s.teacher_id = $1
+			        AND s.booked_by_id IS NULL
+			        AND `+slotOpenSQL("s.")+`
+			        AND s.start_at > NOW() + make_interval(secs => $4)
+			        AND (
+			              s.class_id = $5
+			           OR EXISTS (SELECT 1 FROM consult_slot_classes csc WHERE csc.slot_id = s.id AND csc.class_id = $5)
+			        )
+			        AND (cardinality($6::smallint[]) = 0 OR EXTRACT(DOW FROM s.start_at)::smallint = ANY($6::smallint[]))
+			        AND `+notNonWorkingDaySQL("s.start_at::date")+`
+			        AND NOT EXISTS (SELECT 1 FROM consult_waitlist_offers o WHERE o.waitlist_id = $2 AND o.slot_id = s.id)
+			        -- у родителя не должно быть другой записи на это время
+			        AND NOT EXISTS (
+			            SELECT 1 FROM consult_slots b
+			            WHERE b.booked_by_id = $3 AND b.start_at < s.end_at AND b.end_at > s.start_at
+			        )
+			      ORDER BY s.start_at
+			      LIMIT 1
+			      FOR UPDATE SKIP LOCKED
+			  )
+			RETURNING id, offer_expires_at
+		`, teacherID, e.EntryID, e.ParentID, secs, e.ClassID, pq.Array(e.weekdays)).Scan(&e.SlotID, &e.ExpiresAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO consult_waitlist_offers (waitlist_id, slot_id) VALUES ($1, $2) ON CONFLICT DO NOTHING
+		`, e.EntryID, e.SlotID); err != nil {
+			return nil, err
+		}
+		out = append(out, e.WaitlistOffer)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DeclineWaitlistOffer — родитель отказался от предложенного слота: закрепление снимается,
+// место в очереди остаётся. Возвращает учителя, чтобы предложить слот следующему.
+func DeclineWaitlistOffer(ctx context.Context, database *sql.DB, parentID, slotID int64) (teacherID int64, ok bool, err error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	err = database.QueryRowContext(ctx, `
+		UPDATE consult_slots
+		SET offer_waitlist_id = NULL, offer_parent_id = NULL, offer_expires_at = NULL
+		WHERE id = $1 AND offer_parent_id = $2 AND booked_by_id IS NULL
+		RETURNING teacher_id
+	`, slotID, parentID).Scan(&teacherID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return teacherID, true, nil
+}
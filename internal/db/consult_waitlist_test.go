@@ -0,0 +1,130 @@
+//go:build testutil
+// +build testutil
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/models"
+	"github.com/Spok95/telegram-school-bot/internal/testutil/testdb"
+)
+
+func TestWaitlist_ExclusiveOffer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+	h, err := testdb.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	teacher := mustSeedUser(ctx, t, h.DB, "Учитель", models.Teacher, nil, nil)
+	waiting := mustSeedUser(ctx, t, h.DB, "Родитель в очереди", models.Parent, nil, nil)
+	other := mustSeedUser(ctx, t, h.DB, "Другой родитель", models.Parent, nil, nil)
+	child1 := mustSeedUser(ctx, t, h.DB, "Ученик 1", models.Student, ptrInt64(6), ptrString("Б"))
+	child2 := mustSeedUser(ctx, t, h.DB, "Ученик 2", models.Student, ptrInt64(6), ptrString("Б"))
+	var classID int64
+	if err := h.DB.QueryRowContext(ctx, `SELECT id FROM classes WHERE number = 6 AND letter = 'Б'`).Scan(&classID); err != nil {
+		t.Fatal(err)
+	}
+
+	day := time.Now().AddDate(0, 0, 3)
+	start := time.Date(day.Year(), day.Month(), day.Day(), 16, 0, 0, 0, time.Local)
+	if _, err := db.CreateSlotsMultiClasses(ctx, h.DB, teacher, []int64{classID}, []time.Time{start, start.Add(20 * time.Minute)}, 20, "offline"); err != nil {
+		t.Fatal(err)
+	}
+	var slotA, slotB int64
+	if err := h.DB.QueryRowContext(ctx, `
+		SELECT MIN(id), MAX(id) FROM consult_slots WHERE teacher_id = $1
+	`, teacher).Scan(&slotA, &slotB); err != nil {
+		t.Fatal(err)
+	}
+	book := func(slotID, parentID, childID int64) bool {
+		t.Helper()
+		ok, err := db.TryBookSlotWithChild(ctx, h.DB, slotID, parentID, childID, classID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+	assign := func() []db.WaitlistOffer {
+		t.Helper()
+		offers, err := db.AssignWaitlistOffers(ctx, h.DB, teacher, 30*time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return offers
+	}
+	cancelBooking := func(slotID int64) {
+		t.Helper()
+		if ok, err := db.ParentCancelBookedSlot(ctx, h.DB, other, slotID, "test"); err != nil || !ok {
+			t.Fatalf("отмена: ok=%v err=%v", ok, err)
+		}
+	}
+
+	if !book(slotA, other, child2) || !book(slotB, other, child2) {
+		t.Fatal("слоты должны быть свободны")
+	}
+	full, err := db.ListFullyBookedTeachersForClass(ctx, h.DB, classID, time.Now().AddDate(0, 0, -28), time.Now().AddDate(0, 0, 14), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(full) != 1 || full[0].ID != teacher {
+		t.Fatalf("учитель без свободного времени не найден: %+v", full)
+	}
+	if _, err := db.JoinWaitlist(ctx, h.DB, teacher, classID, waiting, child1, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// освободившийся слот закрепляется за очередью и скрыт от остальных
+	cancelBooking(slotA)
+	offers := assign()
+	if len(offers) != 1 || offers[0].SlotID != slotA || offers[0].ParentID != waiting || offers[0].ChildID != child1 {
+		t.Fatalf("неверные предложения: %+v", offers)
+	}
+	free, err := db.ListFreeSlotsByTeacherOnDateForClass(ctx, h.DB, teacher, classID, start, time.Local, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(free) != 0 {
+		t.Fatalf("предложенный слот не должен быть виден всем: %+v", free)
+	}
+	if book(slotA, other, child2) {
+		t.Fatal("чужой родитель не должен занять закреплённый слот")
+	}
+	if len(assign()) != 0 {
+		t.Fatal("у записи очереди уже есть действующее предложение")
+	}
+
+	// отказ: слот переходит ко всем и повторно этому родителю не предлагается
+	if _, ok, err := db.DeclineWaitlistOffer(ctx, h.DB, waiting, slotA); err != nil || !ok {
+		t.Fatalf("отказ: ok=%v err=%v", ok, err)
+	}
+	if len(assign()) != 0 {
+		t.Fatal("отклонённый слот не должен предлагаться снова")
+	}
+	if !book(slotA, other, child2) {
+		t.Fatal("после отказа слот должен быть доступен всем")
+	}
+
+	// запись по предложению выводит из очереди
+	cancelBooking(slotB)
+	offers = assign()
+	if len(offers) != 1 || offers[0].SlotID != slotB {
+		t.Fatalf("неверные предложения: %+v", offers)
+	}
+	if !book(slotB, waiting, child1) {
+		t.Fatal("родитель из очереди должен записаться на предложенный слот")
+	}
+	left, err := db.ListParentWaitlist(ctx, h.DB, waiting)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 0 {
+		t.Fatalf("после записи родитель должен выйти из очереди: %+v", left)
+	}
+}
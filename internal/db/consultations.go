@@ -56,17 +56,22 @@ func CreateSlots(ctx context.Context, database *sql.DB, teacherID, classID int64
 	return inserted, nil
 }
 
-// TryBookSlot — атомарное бронирование: ставит booked_by_id, если слота ещё никто не занял.
+// TryBookSlot — атомарное бронирование: ставит booked_by_id, если слота ещё никто не занял
+// и он не закреплён за другим родителем из листа ожидания.
 func TryBookSlot(ctx context.Context, database *sql.DB, slotID, parentUserID int64) (bool, error) {
 	res, err := database.ExecContext(ctx, `
 		UPDATE consult_slots
-		SET booked_by_id  = $1,
-		    booked_at     = NOW(),
-		    cancel_reason = NULL,
-		    updated_at    = NOW()
+		SET booked_by_id      = $1,
+		    booked_at         = NOW(),
+		    cancel_reason     = NULL,
+		    offer_waitlist_id = NULL,
+		    offer_parent_id   = NULL,
+		    offer_expires_at  = NULL,
+		    updated_at        = NOW()
 		WHERE id = $2
 		  AND booked_by_id IS NULL
 		  AND start_at > NOW()
+		  AND (offer_parent_id = $1 OR `+slotOpenSQL("")+`)
 	`, parentUserID, slotID)
 	if err != nil {
 		if isExclusionConstraint(err, "consult_slots_no_overlap_parent") {
@@ -151,6 +156,8 @@ func ListFreeSlotsByTeacherOnDate(ctx context.Context, database *sql.DB, teacher
 		WHERE booked_by_id IS NULL
 		  AND teacher_id = $1
 		  AND start_at >= $2 AND start_at < $3
+		  AND `+notNonWorkingDaySQL("start_at::date")+`
+		  AND `+slotOpenSQL("")+`
 		ORDER BY start_at
 		LIMIT $4
 	`, teacherID, startLocal, endLocal, limit)
@@ -341,6 +348,8 @@ func ListDaysWithFreeSlotsByTeacherForClass(ctx context.Context, database *sql.D
 	              WHERE csc.slot_id = s.id AND csc.class_id = $4
 	         )
 	      )
+	      AND `+notNonWorkingDaySQL("s.start_at::date")+`
+	      AND `+slotOpenSQL("s.")+`
 	    ORDER BY day_local
 	    LIMIT $5
 	`, teacherID, from, to, classID, limit)
@@ -378,6 +387,8 @@ func ListFreeSlotsByTeacherOnDateForClass(ctx context.Context, database *sql.DB,
 	           WHERE csc.slot_id = s.id AND csc.class_id = $4
 	       )
 	  )
+	  AND `+notNonWorkingDaySQL("s.start_at::date")+`
+	  AND `+slotOpenSQL("s.")+`
 	ORDER BY s.start_at
 	LIMIT $5
 `, teacherID, startLocal, endLocal, classID, limit)
@@ -498,29 +509,41 @@ func SlotHasClass(ctx context.Context, database *sql.DB, slotID, classID int64)
 }
 
 // TryBookSlotWithChild — атомарно бронирует слот и фиксирует, какого ребёнка и класс выбрали.
-// Возвращает true, если удалось (слот был свободен).
+// Возвращает true, если удалось (слот был свободен и не закреплён за другим родителем
+// из листа ожидания). Записавшийся выходит из очереди к этому учителю.
 func TryBookSlotWithChild(ctx context.Context, dbx *sql.DB, slotID, parentID, childID, classID int64) (bool, error) {
-	res, err := dbx.ExecContext(ctx, `
-		UPDATE consult_slots
-		SET booked_by_id    = $2,
-	    	booked_at       = NOW(),
-	    	booked_child_id = $3,
-	    	booked_class_id = $4,
-	    	cancel_reason   = NULL,
-	    	updated_at      = NOW()
-		WHERE id = $1
-	  		AND booked_by_id IS NULL
-	  		AND start_at > NOW()
-	`, slotID, parentID, childID, classID)
+	var booked int
+	err := dbx.QueryRowContext(ctx, `
+		WITH b AS (
+			UPDATE consult_slots
+			SET booked_by_id      = $2,
+	    		booked_at         = NOW(),
+	    		booked_child_id   = $3,
+	    		booked_class_id   = $4,
+	    		cancel_reason     = NULL,
+	    		offer_waitlist_id = NULL,
+	    		offer_parent_id   = NULL,
+	    		offer_expires_at  = NULL,
+	    		updated_at        = NOW()
+			WHERE id = $1
+	  			AND booked_by_id IS NULL
+	  			AND start_at > NOW()
+	  			AND (offer_parent_id = $2 OR `+slotOpenSQL("")+`)
+			RETURNING teacher_id
+		), w AS (
+			DELETE FROM consult_waitlist cw
+			USING b
+			WHERE cw.teacher_id = b.teacher_id AND cw.parent_id = $2 AND cw.child_id = $3
+		)
+		SELECT COUNT(*) FROM b
+	`, slotID, parentID, childID, classID).Scan(&booked)
 	if err != nil {
 		if isExclusionConstraint(err, "consult_slots_no_overlap_parent") {
 			return false, ErrParentBookingOverlap
 		}
 		return false, err
 	}
-
-	aff, _ := res.RowsAffected()
-	return aff > 0, nil
+	return booked > 0, nil
 }
 
 func SetSlotOnlineURL(ctx context.Context, dbx *sql.DB, teacherID, slotID int64, url string) (bool, error) {
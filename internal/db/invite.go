@@ -0,0 +1,435 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/ctxutil"
+	"github.com/Spok95/telegram-school-bot/internal/models"
+)
+
+var (
+	ErrInviteNotFound   = errors.New("код приглашения не найден")
+	ErrInviteExpired    = errors.New("срок действия кода истёк")
+	ErrInviteUsedUp     = errors.New("код уже использован")
+	ErrInviteRevoked    = errors.New("код отозван администратором")
+	ErrInviteTaken      = errors.New("этот ученик уже зарегистрирован в боте")
+	ErrInviteRegistered = errors.New("вы уже зарегистрированы")
+)
+
+// InviteCodeLen — длина кода; алфавит без похожих символов (0/O, 1/I/L), чтобы код можно было набрать с листа.
+const InviteCodeLen = 8
+
+const inviteAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+// InviteCode — одноразовый или многоразовый код регистрации.
+// Код привязан к роли и, в зависимости от роли, к классу или к конкретному ученику:
+//   - teacher/administration — только роль;
+//   - student + ClassID — ученик сам вводит ФИО, класс берётся из кода;
+//   - student + StudentID — код «забирает» учётку ученика (например, заготовку из импорта);
+//   - parent + StudentID — родитель привязывается к этому ученику.
+type InviteCode struct {
+	ID          int64
+	Code        string
+	Role        models.Role
+	ClassID     *int64
+	StudentID   *int64
+	MaxUses     int
+	UsedCount   int
+	ExpiresAt   time.Time
+	CreatedBy   *int64
+	CreatedAt   time.Time
+	RevokedAt   *time.Time
+	ClassLabel  string // «5А» для кода класса или класса ученика
+	StudentName string
+}
+
+// Usable — код ещё можно использовать (без обращения к БД).
+func (c *InviteCode) Usable(now time.Time) error {
+	switch {
+	case c.RevokedAt != nil:
+		return ErrInviteRevoked
+	case !now.Before(c.ExpiresAt):
+		return ErrInviteExpired
+	case c.UsedCount >= c.MaxUses:
+		return ErrInviteUsedUp
+	}
+	return nil
+}
+
+// NeedsName — при регистрации нужно спросить ФИО (для кода ученика оно уже известно).
+func (c *InviteCode) NeedsName() bool {
+	return !(c.Role == models.Student && c.StudentID != nil)
+}
+
+// NewInviteCodeValue — случайный код из InviteCodeLen символов.
+func NewInviteCodeValue() (string, error) {
+	// отбрасываем байты из «хвоста», чтобы символы выпадали равновероятно
+	limit := byte(256 - 256%len(inviteAlphabet))
+	out := make([]byte, 0, InviteCodeLen)
+	buf := make([]byte, 2*InviteCodeLen)
+	for len(out) < InviteCodeLen {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if b < limit && len(out) < InviteCodeLen {
+				out = append(out, inviteAlphabet[int(b)%len(inviteAlphabet)])
+			}
+		}
+	}
+	return string(out), nil
+}
+
+// NormalizeInviteCode — код с листа набирают как угодно: «abcd-2345» → «ABCD2345».
+func NormalizeInviteCode(s string) string {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	return strings.NewReplacer("-", "", " ", "").Replace(s)
+}
+
+// NewInvite — параметры нового кода.
+type NewInvite struct {
+	Role      models.Role
+	ClassID   *int64
+	StudentID *int64
+	MaxUses   int
+	ExpiresAt time.Time
+	CreatedBy *int64
+}
+
+func validateInvite(n NewInvite) error {
+	if n.MaxUses < 1 {
+		return fmt.Errorf("число использований должно быть больше нуля")
+	}
+	switch n.Role {
+	case models.Teacher, models.Administration:
+		if n.ClassID != nil || n.StudentID != nil {
+			return fmt.Errorf("код сотрудника не привязывается к классу или ученику")
+		}
+	case models.Student:
+		if (n.ClassID == nil) == (n.StudentID == nil) {
+			return fmt.Errorf("код ученика привязывается либо к классу, либо к ученику")
+		}
+	case models.Parent:
+		if n.StudentID == nil || n.ClassID != nil {
+			return fmt.Errorf("код родителя привязывается к ученику")
+		}
+	default:
+		return fmt.Errorf("роль %q не поддерживается кодами приглашения", n.Role)
+	}
+	return nil
+}
+
+// CreateInviteCodes заводит коды одной транзакцией и возвращает их в том же порядке.
+func CreateInviteCodes(ctx context.Context, database *sql.DB, invites []NewInvite) ([]InviteCode, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+
+	tx, err := database.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	out := make([]InviteCode, 0, len(invites))
+	for _, n := range invites {
+		if err := validateInvite(n); err != nil {
+			return nil, err
+		}
+		code, err := NewInviteCodeValue()
+		if err != nil {
+			return nil, err
+		}
+		c := InviteCode{Code: code, Role: n.Role, ClassID: n.ClassID, StudentID: n.StudentID,
+			MaxUses: n.MaxUses, ExpiresAt: n.ExpiresAt, CreatedBy: n.CreatedBy}
+		if err := tx.QueryRowContext(ctx, `
+			INSERT INTO invite_codes (code, role, class_id, student_id, max_uses, expires_at, created_by)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING id, created_at
+		`, c.Code, string(c.Role), c.ClassID, c.StudentID, c.MaxUses, c.ExpiresAt, c.CreatedBy).Scan(&c.ID, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+const inviteSelect = `
+	SELECT ic.id, ic.code, ic.role, ic.class_id, ic.student_id, ic.max_uses, ic.used_count,
+	       ic.expires_at, ic.created_by, ic.created_at, ic.revoked_at,
+	       COALESCE(c.number::text || c.letter, s.class_number::text || UPPER(s.class_letter), ''),
+	       COALESCE(s.name, '')
+	FROM invite_codes ic
+	LEFT JOIN classes c ON c.id = ic.class_id
+	LEFT JOIN users s ON s.id = ic.student_id
+`
+
+type rowScanner interface{ Scan(dest ...any) error }
+
+func scanInvite(row rowScanner) (*InviteCode, error) {
+	var (
+		c    InviteCode
+		role string
+	)
+	if err := row.Scan(&c.ID, &c.Code, &role, &c.ClassID, &c.StudentID, &c.MaxUses, &c.UsedCount,
+		&c.ExpiresAt, &c.CreatedBy, &c.CreatedAt, &c.RevokedAt, &c.ClassLabel, &c.StudentName); err != nil {
+		return nil, err
+	}
+	c.Role = models.Role(role)
+	return &c, nil
+}
+
+// GetInviteCode — код по значению (регистр и дефисы не важны).
+func GetInviteCode(ctx context.Context, database *sql.DB, code string) (*InviteCode, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	c, err := scanInvite(database.QueryRowContext(ctx, inviteSelect+` WHERE ic.code = $1`, NormalizeInviteCode(code)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInviteNotFound
+	}
+	return c, err
+}
+
+// ListActiveInviteCodes — действующие коды сотрудников и классов (коды учеников из QR-листов не показываем).
+func ListActiveInviteCodes(ctx context.Context, database *sql.DB, now time.Time, limit int) ([]InviteCode, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	rows, err := database.QueryContext(ctx, inviteSelect+`
+		WHERE ic.student_id IS NULL
+		  AND ic.revoked_at IS NULL
+		  AND ic.expires_at > $1
+		  AND ic.used_count < ic.max_uses
+		ORDER BY ic.created_at DESC
+		LIMIT $2
+	`, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var out []InviteCode
+	for rows.Next() {
+		c, err := scanInvite(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *c)
+	}
+	return out, rows.Err()
+}
+
+// RevokeInviteCode — отозвать код; уже зарегистрированные по нему пользователи остаются.
+func RevokeInviteCode(ctx context.Context, database *sql.DB, id int64) error {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	_, err := database.ExecContext(ctx, `UPDATE invite_codes SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`, id)
+	return err
+}
+
+// RedeemInvite регистрирует пользователя по коду одной транзакцией: проверка кода,
+// создание (или привязка) пользователя сразу подтверждённым, учёт использования.
+// Для уже зарегистрированного родителя код родителя просто добавляет ребёнка.
+// name игнорируется, если код привязан к ученику с ролью student.
+func RedeemInvite(ctx context.Context, database *sql.DB, code string, telegramID int64, name string, now time.Time) (*InviteCode, int64, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+
+	tx, err := database.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	c, err := scanInvite(tx.QueryRowContext(ctx, inviteSelect+` WHERE ic.code = $1 FOR UPDATE OF ic`, NormalizeInviteCode(code)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, 0, ErrInviteNotFound
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := c.Usable(now); err != nil {
+		return c, 0, err
+	}
+
+	var (
+		existingID   int64
+		existingRole string
+	)
+	err = tx.QueryRowContext(ctx, `SELECT id, role FROM users WHERE telegram_id = $1`, telegramID).Scan(&existingID, &existingRole)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return c, 0, err
+	}
+	registered := err == nil
+	name = strings.Join(strings.Fields(name), " ")
+
+	var userID int64
+	switch {
+	case registered && c.Role == models.Parent && existingRole == string(models.Parent):
+		userID = existingID
+	case registered:
+		return c, 0, ErrInviteRegistered
+
+	case c.Role == models.Student && c.StudentID != nil:
+		// учётка ученика уже есть (обычно заготовка из импорта) — привязываем к чату
+		res, err := tx.ExecContext(ctx, `
+			UPDATE users SET telegram_id = $1, is_placeholder = FALSE, confirmed = TRUE
+			WHERE id = $2 AND is_placeholder
+		`, telegramID, *c.StudentID)
+		if err != nil {
+			return c, 0, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return c, 0, ErrInviteTaken
+		}
+		userID = *c.StudentID
+
+	case c.Role == models.Student:
+		var (
+			number int
+			letter string
+		)
+		if err := tx.QueryRowContext(ctx, `SELECT number, letter FROM classes WHERE id = $1`, *c.ClassID).Scan(&number, &letter); err != nil {
+			return c, 0, err
+		}
+		// в классе может уже быть заготовка с тем же ФИО — забираем её, а не плодим дубль
+		err := tx.QueryRowContext(ctx, `
+			UPDATE users SET telegram_id = $1, is_placeholder = FALSE
+			WHERE id = (
+				SELECT id FROM users
+				WHERE is_placeholder AND role = 'student' AND is_active = TRUE
+				  AND UPPER(name) = UPPER($2) AND class_id = $3
+				ORDER BY id LIMIT 1
+			)
+			RETURNING id
+		`, telegramID, name, *c.ClassID).Scan(&userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = tx.QueryRowContext(ctx, `
+				INSERT INTO users (telegram_id, name, role, class_id, class_number, class_letter, confirmed)
+				VALUES ($1, $2, 'student', $3, $4, $5, TRUE)
+				RETURNING id
+			`, telegramID, name, *c.ClassID, number, letter).Scan(&userID)
+		}
+		if err != nil {
+			return c, 0, err
+		}
+
+	case c.Role == models.Parent:
+		// родитель мог прийти из импорта списка — забираем заготовку с тем же ФИО
+		err := tx.QueryRowContext(ctx, `
+			UPDATE users SET telegram_id = $1, is_placeholder = FALSE
+			WHERE id = (
+				SELECT u.id FROM users u
+				JOIN parents_students ps ON ps.parent_id = u.id
+				WHERE u.is_placeholder AND u.role = 'parent'
+				  AND ps.student_id = $2 AND UPPER(u.name) = UPPER($3)
+				ORDER BY u.id LIMIT 1
+			)
+			RETURNING id
+		`, telegramID, *c.StudentID, name).Scan(&userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = tx.QueryRowContext(ctx, `
+				INSERT INTO users (telegram_id, name, role, confirmed)
+				VALUES ($1, $2, 'parent', TRUE)
+				RETURNING id
+			`, telegramID, name).Scan(&userID)
+		}
+		if err != nil {
+			return c, 0, err
+		}
+
+	default:
+		if err := tx.QueryRowContext(ctx, `
+			INSERT INTO users (telegram_id, name, role, confirmed)
+			VALUES ($1, $2, $3, TRUE)
+			RETURNING id
+		`, telegramID, name, string(c.Role)).Scan(&userID); err != nil {
+			return c, 0, err
+		}
+	}
+
+	if c.Role == models.Parent {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO parents_students (parent_id, student_id) VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`, userID, *c.StudentID); err != nil {
+			return c, 0, err
+		}
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO invite_code_uses (code_id, user_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, c.ID, userID)
+	if err != nil {
+		return c, 0, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// тот же родитель повторно открыл ссылку — ребёнок уже привязан, использование не считаем
+		return c, userID, tx.Commit()
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE invite_codes SET used_count = used_count + 1 WHERE id = $1`, c.ID); err != nil {
+		return c, 0, err
+	}
+	c.UsedCount++
+
+	// в журнале ролей фиксируем, кто выдал код (подтверждение без админа)
+	if !registered && c.CreatedBy != nil {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO role_changes (user_id, old_role, new_role, changed_by, changed_at)
+			VALUES ($1, 'invite', $2, $3, CURRENT_TIMESTAMP)
+		`, userID, string(c.Role), *c.CreatedBy); err != nil {
+			return c, 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return c, 0, err
+	}
+
+	if c.Role == models.Parent {
+		// родитель мог быть неактивным — теперь у него есть активный ребёнок;
+		// регистрация уже зафиксирована, поэтому ошибку пересчёта не возвращаем
+		_ = RefreshParentActiveFlag(ctx, database, userID)
+	}
+	return c, userID, nil
+}
+
+// ClassInviteTarget — ученик класса для QR-листа.
+type ClassInviteTarget struct {
+	StudentID  int64
+	Name       string
+	Registered bool // уже привязан к Telegram — код ученика не нужен
+}
+
+// ListClassInviteTargets — подтверждённые активные ученики класса по алфавиту.
+func ListClassInviteTargets(ctx context.Context, database *sql.DB, classID int64) ([]ClassInviteTarget, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	rows, err := database.QueryContext(ctx, `
+		SELECT u.id, u.name, NOT u.is_placeholder
+		FROM users u
+		JOIN classes c ON c.id = $1
+		WHERE u.role = 'student' AND u.is_active = TRUE AND u.confirmed = TRUE
+		  AND u.class_number = c.number AND UPPER(u.class_letter) = UPPER(c.letter)
+		ORDER BY u.name
+	`, classID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var out []ClassInviteTarget
+	for rows.Next() {
+		var t ClassInviteTarget
+		if err := rows.Scan(&t.StudentID, &t.Name, &t.Registered); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
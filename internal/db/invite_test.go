@@ -0,0 +1,97 @@
+//go:build testutil
+// +build testutil
+
+package db_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/models"
+	"github.com/Spok95/telegram-school-bot/internal/testutil/testdb"
+)
+
+func TestInvite_CodeValue(t *testing.T) {
+	c, err := db.NewInviteCodeValue()
+	if err != nil || len(c) != db.InviteCodeLen || strings.ContainsAny(c, "0O1IL") {
+		t.Fatalf("неподходящий код %q (%v)", c, err)
+	}
+	if got := db.NormalizeInviteCode(" abcd-2345 "); got != "ABCD2345" {
+		t.Fatalf("нормализация: %q", got)
+	}
+}
+
+func TestInvite_Redeem(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+	h, err := testdb.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	now := time.Now()
+	adminID := mustSeedUser(ctx, t, h.DB, "Админ", models.Admin, nil, nil)
+	res, err := db.ImportRoster(ctx, h.DB, []db.RosterRow{{Line: 1, Name: "Сидоров Сидор", ClassNumber: 3, ClassLetter: "В"}},
+		db.RosterSourceBot, "list.csv", &adminID)
+	if err != nil || res.Created != 1 {
+		t.Fatalf("импорт: %+v (%v)", res, err)
+	}
+	studentID := res.Outcomes[0].StudentID
+
+	codes, err := db.CreateInviteCodes(ctx, h.DB, []db.NewInvite{
+		{Role: models.Teacher, MaxUses: 1, ExpiresAt: now.Add(time.Hour), CreatedBy: &adminID},
+		{Role: models.Student, StudentID: &studentID, MaxUses: 1, ExpiresAt: now.Add(time.Hour), CreatedBy: &adminID},
+		{Role: models.Parent, StudentID: &studentID, MaxUses: 2, ExpiresAt: now.Add(time.Hour), CreatedBy: &adminID},
+		{Role: models.Administration, MaxUses: 1, ExpiresAt: now.Add(-time.Minute)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	teacher, student, parent, expired := codes[0].Code, codes[1].Code, codes[2].Code, codes[3].Code
+
+	// учитель — сразу подтверждён, второй раз код не сработает
+	if _, _, err := db.RedeemInvite(ctx, h.DB, strings.ToLower(teacher), 700001, "Учитель Тест", now); err != nil {
+		t.Fatal(err)
+	}
+	u, _ := db.GetUserByTelegramID(ctx, h.DB, 700001)
+	if u == nil || !u.Confirmed || u.Role == nil || *u.Role != models.Teacher {
+		t.Fatalf("учитель должен быть подтверждён: %+v", u)
+	}
+	if _, _, err := db.RedeemInvite(ctx, h.DB, teacher, 700002, "Ещё Учитель", now); !errors.Is(err, db.ErrInviteUsedUp) {
+		t.Fatalf("ожидали ErrInviteUsedUp, получили %v", err)
+	}
+	if _, _, err := db.RedeemInvite(ctx, h.DB, expired, 700003, "Поздний", now); !errors.Is(err, db.ErrInviteExpired) {
+		t.Fatalf("ожидали ErrInviteExpired, получили %v", err)
+	}
+
+	// код ученика забирает заготовку из импорта
+	if _, id, err := db.RedeemInvite(ctx, h.DB, student, 700010, "", now); err != nil || id != studentID {
+		t.Fatalf("ожидали привязку ученика %d, получили %d (%v)", studentID, id, err)
+	}
+
+	// код родителя: привязка к ученику, повторное открытие ссылки не тратит использование
+	if _, _, err := db.RedeemInvite(ctx, h.DB, parent, 700020, "Сидорова Анна", now); err != nil {
+		t.Fatal(err)
+	}
+	c, _, err := db.RedeemInvite(ctx, h.DB, parent, 700020, "Сидорова Анна", now)
+	if err != nil || c.UsedCount != 1 {
+		t.Fatalf("повторный вход того же родителя: %+v (%v)", c, err)
+	}
+	var linked int
+	if err := h.DB.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM parents_students ps JOIN users u ON u.id = ps.parent_id
+		WHERE ps.student_id = $1 AND u.telegram_id = 700020 AND u.confirmed`, studentID).Scan(&linked); err != nil {
+		t.Fatal(err)
+	}
+	if linked != 1 {
+		t.Fatalf("родитель должен быть привязан к ребёнку, получили %d", linked)
+	}
+	if _, _, err := db.RedeemInvite(ctx, h.DB, parent, 700001, "Учитель Тест", now); !errors.Is(err, db.ErrInviteRegistered) {
+		t.Fatalf("учитель не может стать родителем по коду, получили %v", err)
+	}
+}
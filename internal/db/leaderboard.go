@@ -0,0 +1,102 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/ctxutil"
+	"github.com/Spok95/telegram-school-bot/internal/rating"
+)
+
+// GetStudentStandings — суммы баллов активных учеников за [from, to).
+// classNumber = 0 — вся школа; classLetter = "" — вся параллель.
+func GetStudentStandings(ctx context.Context, database *sql.DB, classNumber int64, classLetter string, from, to time.Time) ([]rating.Standing, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	rows, err := database.QueryContext(ctx, `
+		SELECT u.id, u.name, u.class_number, u.class_letter, u.rating_display, COALESCE(SUM(s.points), 0)
+		FROM users u
+		LEFT JOIN score_entries s ON s.student_id = u.id AND s.created_at >= $1 AND s.created_at < $2
+		WHERE u.role = 'student' AND u.is_active = TRUE
+		  AND u.class_number IS NOT NULL AND u.class_letter IS NOT NULL
+		  AND ($3::BIGINT = 0 OR u.class_number = $3)
+		  AND ($4::TEXT = '' OR u.class_letter = $4)
+		GROUP BY u.id
+	`, from, to, classNumber, classLetter)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []rating.Standing
+	for rows.Next() {
+		var s rating.Standing
+		if err := rows.Scan(&s.StudentID, &s.Name, &s.ClassNumber, &s.ClassLetter, &s.Display, &s.Points); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// GetClassStandings — коллективный рейтинг видимых классов с учениками за [from, to) по журналу.
+func GetClassStandings(ctx context.Context, database *sql.DB, from, to time.Time) ([]rating.ClassStanding, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	rows, err := database.QueryContext(ctx, `
+		SELECT c.number, c.letter, COALESCE(SUM(l.collective), 0)
+		FROM classes c
+		LEFT JOIN score_ledger l ON l.class_id = c.id AND l.effective_at >= $1 AND l.effective_at < $2
+		WHERE c.hidden = FALSE
+		  AND EXISTS (
+		      SELECT 1 FROM users u
+		      WHERE u.role = 'student' AND u.is_active = TRUE
+		        AND u.class_number = c.number AND u.class_letter = c.letter
+		  )
+		GROUP BY c.id
+	`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []rating.ClassStanding
+	for rows.Next() {
+		var c rating.ClassStanding
+		if err := rows.Scan(&c.ClassNumber, &c.ClassLetter, &c.Points); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// GetRatingDisplay — как ученик показан в рейтинге (rating.Display*).
+func GetRatingDisplay(ctx context.Context, database *sql.DB, studentID int64) (string, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	var mode string
+	err := database.QueryRowContext(ctx, `SELECT rating_display FROM users WHERE id = $1`, studentID).Scan(&mode)
+	return mode, err
+}
+
+// SetRatingDisplay — выбор ученика (или его родителя), как показывать его в рейтинге.
+func SetRatingDisplay(ctx context.Context, database *sql.DB, studentID int64, mode string) error {
+	if !rating.ValidDisplay(mode) {
+		return errors.New("неизвестный режим показа в рейтинге")
+	}
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	res, err := database.ExecContext(ctx,
+		`UPDATE users SET rating_display = $1 WHERE id = $2 AND role = 'student'`, mode, studentID)
+	if err != nil {
+		return err
+	}
+	aff, _ := res.RowsAffected()
+	if aff == 0 {
+		return errors.New("ученик не найден")
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+//go:build testutil
+// +build testutil
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/models"
+	"github.com/Spok95/telegram-school-bot/internal/rating"
+	"github.com/Spok95/telegram-school-bot/internal/testutil/testdb"
+)
+
+func TestLeaderboard_Standings(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+	h, err := testdb.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	adminID := mustSeedUser(ctx, t, h.DB, "Админ", models.Admin, nil, nil)
+	a := mustSeedUser(ctx, t, h.DB, "Андреев Андрей", models.Student, ptrInt64(6), ptrString("А"))
+	b := mustSeedUser(ctx, t, h.DB, "Борисов Борис", models.Student, ptrInt64(6), ptrString("Б"))
+	c := mustSeedUser(ctx, t, h.DB, "Васильев Василий", models.Student, ptrInt64(9), ptrString("А"))
+
+	now := time.Now().UTC()
+	catID := int64(db.GetCategoryIDByName(ctx, h.DB, "Работа на уроке"))
+	for id, pts := range map[int64]int{a: 100, b: 200, c: 300} {
+		if err := db.AddScoreInstant(ctx, h.DB, models.Score{StudentID: id, CategoryID: catID, Points: pts, Type: "add", CreatedBy: adminID}, adminID, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	from, to := now.Add(-time.Hour), now.Add(time.Hour)
+
+	parallel, err := db.GetStudentStandings(ctx, h.DB, 6, "", from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parallel) != 2 {
+		t.Fatalf("в параллели 6-х ожидали 2 учеников, получили %d", len(parallel))
+	}
+
+	if err := db.SetRatingDisplay(ctx, h.DB, c, rating.DisplayHidden); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetRatingDisplay(ctx, h.DB, adminID, rating.DisplayHidden); err == nil {
+		t.Fatal("режим показа задаётся только ученикам")
+	}
+	school, err := db.GetStudentStandings(ctx, h.DB, 0, "", from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	board := rating.Rank(school, c, 10)
+	if board.Count != 2 || board.Top[0].StudentID != b {
+		t.Fatalf("скрытый ученик не должен попадать в таблицу: %+v", board.Top)
+	}
+	if board.Me == nil || board.Me.Place != 1 || board.Me.Points != 300 {
+		t.Fatalf("скрытый ученик видит своё место: %+v", board.Me)
+	}
+
+	classes, err := db.GetClassStandings(ctx, h.DB, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ranked := rating.RankClasses(classes)
+	if len(ranked) != 3 || ranked[0].ClassNumber != 9 || ranked[0].Points != 90 {
+		t.Fatalf("рейтинг классов: %+v", ranked)
+	}
+}
@@ -0,0 +1,490 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/ctxutil"
+	"github.com/Spok95/telegram-school-bot/internal/rating"
+)
+
+// Виды записей журнала начислений.
+const (
+	LedgerApprove    = "approve"    // заявка подтверждена
+	LedgerCorrection = "correction" // новые значения после исправления
+	LedgerReversal   = "reversal"   // отмена записи (reverses_id)
+)
+
+// AuctionCategory — категория трат на аукционе: это не начисление за что-то,
+// поэтому исправлять в неё начисления не предлагаем.
+const AuctionCategory = "Аукцион"
+
+// ErrScoreNotApproved — у заявки нет действующих записей в журнале: она не подтверждена или уже отменена.
+var ErrScoreNotApproved = errors.New("начисление не подтверждено или уже отменено")
+
+// LedgerEntry — запись журнала начислений.
+type LedgerEntry struct {
+	ID          int64
+	ScoreID     int64
+	Kind        string
+	ReversesID  *int64
+	StudentID   int64
+	ClassID     *int64
+	CategoryID  int64
+	Points      int
+	Collective  int
+	Reason      *string
+	EffectiveAt time.Time // дата исходной заявки: по ней запись попадает в период
+	CreatedBy   *int64
+	CreatedAt   time.Time
+}
+
+// ScoreCorrection — новые значения начисления. Ученик тоже может смениться.
+type ScoreCorrection struct {
+	StudentID  int64
+	CategoryID int64
+	Points     int
+}
+
+// collectiveRule — правило коллективного рейтинга для начисления: настройки категории,
+// уточнённые процентом уровня с тем же значением баллов (если он задан).
+func collectiveRule(ctx context.Context, tx *sql.Tx, categoryID int64, points int) (rating.Rule, error) {
+	var (
+		r        rating.Rule
+		levelPct sql.NullInt64
+	)
+	err := tx.QueryRowContext(ctx, `
+		SELECT c.affects_collective, c.collective_percent, l.collective_percent
+		FROM categories c
+		LEFT JOIN score_levels l ON l.category_id = c.id AND l.value = ABS($2::INT)
+		WHERE c.id = $1
+	`, categoryID, points).Scan(&r.Affects, &r.Percent, &levelPct)
+	if err != nil {
+		return r, fmt.Errorf("категория %d: %w", categoryID, err)
+	}
+	if levelPct.Valid {
+		p := int(levelPct.Int64)
+		r = r.WithLevel(&p)
+	}
+	return r, nil
+}
+
+// postLedgerEntry дописывает запись и сдвигает кэш classes.collective_score
+// на её вклад. Класс берётся текущий — тот, в котором ученик сейчас учится.
+// Вклад считается по правилу категории на момент записи; отмена вычитает
+// ровно записанное, даже если правило с тех пор поменяли.
+func postLedgerEntry(ctx context.Context, tx *sql.Tx, e *LedgerEntry) error {
+	if e.Kind != LedgerReversal {
+		rule, err := collectiveRule(ctx, tx, e.CategoryID, e.Points)
+		if err != nil {
+			return err
+		}
+		e.Collective = rule.Share(e.Points)
+		if err := tx.QueryRowContext(ctx, `
+			SELECT COALESCE(u.class_id, c.id)
+			FROM users u
+			LEFT JOIN classes c ON c.number = u.class_number AND c.letter = u.class_letter
+			WHERE u.id = $1
+		`, e.StudentID).Scan(&e.ClassID); err != nil {
+			return fmt.Errorf("ученик %d: %w", e.StudentID, err)
+		}
+	}
+
+	// CreatedAt задают только при переносе старых заявок, обычно — время записи
+	var createdAt *time.Time
+	if !e.CreatedAt.IsZero() {
+		createdAt = &e.CreatedAt
+	}
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO score_ledger (score_id, kind, reverses_id, student_id, class_id, category_id,
+		                          points, collective, reason, effective_at, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, COALESCE($12::TIMESTAMP, NOW()))
+		RETURNING id, created_at
+	`, e.ScoreID, e.Kind, e.ReversesID, e.StudentID, e.ClassID, e.CategoryID,
+		e.Points, e.Collective, e.Reason, e.EffectiveAt, e.CreatedBy, createdAt).Scan(&e.ID, &e.CreatedAt); err != nil {
+		return err
+	}
+
+	if e.ClassID != nil && e.Collective != 0 {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE classes SET collective_score = collective_score + $1 WHERE id = $2
+		`, e.Collective, *e.ClassID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// approveLedgerEntry — запись о подтверждении заявки scoreID (заявка уже в scores)
+// и уведомления ученику и родителям в очередь.
+func approveLedgerEntry(ctx context.Context, tx *sql.Tx, scoreID int64, approvedBy *int64) error {
+	e := LedgerEntry{ScoreID: scoreID, Kind: LedgerApprove, CreatedBy: approvedBy}
+	if err := tx.QueryRowContext(ctx, `
+		SELECT student_id, category_id, points, created_at FROM scores WHERE id = $1
+	`, scoreID).Scan(&e.StudentID, &e.CategoryID, &e.Points, &e.EffectiveAt); err != nil {
+		return err
+	}
+	if err := postLedgerEntry(ctx, tx, &e); err != nil {
+		return err
+	}
+	return enqueueScoreNotifications(ctx, tx, scoreID)
+}
+
+// openLedgerEntries — действующие записи по заявке: не отмены и ещё не отменённые.
+// Строка заявки блокируется, чтобы две отмены одной заявки не прошли одновременно.
+func openLedgerEntries(ctx context.Context, tx *sql.Tx, scoreID int64) ([]LedgerEntry, error) {
+	if _, err := tx.ExecContext(ctx, `SELECT 1 FROM scores WHERE id = $1 FOR UPDATE`, scoreID); err != nil {
+		return nil, err
+	}
+	rows, err := tx.QueryContext(ctx, `
+		SELECT l.id, l.kind, l.student_id, l.class_id, l.category_id, l.points, l.collective, l.effective_at
+		FROM score_ledger l
+		WHERE l.score_id = $1 AND l.kind <> 'reversal'
+		  AND NOT EXISTS (SELECT 1 FROM score_ledger r WHERE r.reverses_id = l.id)
+		ORDER BY l.id
+	`, scoreID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []LedgerEntry
+	for rows.Next() {
+		e := LedgerEntry{ScoreID: scoreID}
+		if err := rows.Scan(&e.ID, &e.Kind, &e.StudentID, &e.ClassID, &e.CategoryID, &e.Points, &e.Collective, &e.EffectiveAt); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// reverseOpenEntries отменяет все действующие записи по заявке и возвращает их.
+// Отмена вычитает ровно то, что внесла запись, — и из класса, куда она была внесена.
+func reverseOpenEntries(ctx context.Context, tx *sql.Tx, scoreID int64, reason string, by *int64) ([]LedgerEntry, error) {
+	open, err := openLedgerEntries(ctx, tx, scoreID)
+	if err != nil {
+		return nil, err
+	}
+	if len(open) == 0 {
+		return nil, ErrScoreNotApproved
+	}
+	for _, o := range open {
+		id := o.ID
+		r := LedgerEntry{
+			ScoreID:     scoreID,
+			Kind:        LedgerReversal,
+			ReversesID:  &id,
+			StudentID:   o.StudentID,
+			ClassID:     o.ClassID,
+			CategoryID:  o.CategoryID,
+			Points:      -o.Points,
+			Collective:  -o.Collective,
+			Reason:      &reason,
+			EffectiveAt: o.EffectiveAt,
+			CreatedBy:   by,
+		}
+		if err := postLedgerEntry(ctx, tx, &r); err != nil {
+			return nil, err
+		}
+	}
+	return open, nil
+}
+
+// ReverseScore отменяет подтверждённое начисление: баллы ученика и вклад в класс
+// возвращаются обратными записями, сама заявка и история остаются.
+func ReverseScore(ctx context.Context, database *sql.DB, scoreID int64, reason string, by *int64) error {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	tx, err := database.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := reverseOpenEntries(ctx, tx, scoreID, reason, by); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CorrectScore заменяет действующие значения начисления новыми: отмена + запись correction.
+// Дата исходной заявки сохраняется, поэтому исправление попадает в тот же период.
+func CorrectScore(ctx context.Context, database *sql.DB, scoreID int64, c ScoreCorrection, reason string, by *int64) error {
+	if c.Points == 0 {
+		return fmt.Errorf("CorrectScore: points не может быть 0 — для этого есть отмена")
+	}
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	tx, err := database.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	open, err := reverseOpenEntries(ctx, tx, scoreID, reason, by)
+	if err != nil {
+		return err
+	}
+	e := LedgerEntry{
+		ScoreID:     scoreID,
+		Kind:        LedgerCorrection,
+		StudentID:   c.StudentID,
+		CategoryID:  c.CategoryID,
+		Points:      c.Points,
+		Reason:      &reason,
+		EffectiveAt: open[0].EffectiveAt,
+		CreatedBy:   by,
+	}
+	if err := postLedgerEntry(ctx, tx, &e); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// BackfillScoreLedger заводит записи approve для подтверждённых заявок, которых нет в журнале,
+// и пересчитывает кэш collective_score. Нужен после восстановления из архива без score_ledger.
+func BackfillScoreLedger(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT s.id, s.student_id, s.category_id, s.points, s.created_at, s.approved_by,
+		       COALESCE(s.approved_at, s.created_at)
+		FROM scores s
+		JOIN users u ON u.id = s.student_id
+		WHERE s.status = 'approved'
+		  AND NOT EXISTS (SELECT 1 FROM score_ledger l WHERE l.score_id = s.id)
+		ORDER BY s.id
+	`)
+	if err != nil {
+		return err
+	}
+	var missing []LedgerEntry
+	for rows.Next() {
+		e := LedgerEntry{Kind: LedgerApprove}
+		if err := rows.Scan(&e.ScoreID, &e.StudentID, &e.CategoryID, &e.Points, &e.EffectiveAt, &e.CreatedBy, &e.CreatedAt); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		missing = append(missing, e)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range missing {
+		if err := postLedgerEntry(ctx, tx, &missing[i]); err != nil {
+			return err
+		}
+	}
+	// кэш из архива мог не совпадать с журналом — берём значения из журнала
+	_, err = tx.ExecContext(ctx, `
+		UPDATE classes c
+		SET collective_score = COALESCE((SELECT SUM(l.collective) FROM score_ledger l WHERE l.class_id = c.id), 0)
+	`)
+	return err
+}
+
+// CorrectableScore — действующее начисление, которое можно отменить или исправить:
+// значения берутся из последней неотменённой записи журнала.
+type CorrectableScore struct {
+	ScoreID      int64
+	StudentID    int64
+	StudentName  string
+	ClassNumber  *int64
+	ClassLetter  *string
+	CategoryID   int64
+	CategoryName string
+	Points       int
+	Type         string
+	Comment      *string
+	AuthorID     int64
+	AuthorName   string
+	CreatedAt    time.Time
+}
+
+// ScoreFilter — по какому ученику или автору искать начисления (0 — не важно).
+type ScoreFilter struct {
+	StudentID int64
+	AuthorID  int64
+}
+
+const correctableSelect = `
+	SELECT l.score_id, l.student_id, st.name, st.class_number, st.class_letter,
+	       l.category_id, cat.name, l.points, s.type, s.comment, s.created_by, au.name, l.effective_at
+	FROM score_ledger l
+	JOIN scores s ON s.id = l.score_id
+	JOIN users st ON st.id = l.student_id
+	JOIN users au ON au.id = s.created_by
+	JOIN categories cat ON cat.id = l.category_id
+	WHERE l.kind <> 'reversal'
+	  AND NOT EXISTS (SELECT 1 FROM score_ledger r WHERE r.reverses_id = l.id)`
+
+func scanCorrectable(r rowScanner) (CorrectableScore, error) {
+	var c CorrectableScore
+	err := r.Scan(&c.ScoreID, &c.StudentID, &c.StudentName, &c.ClassNumber, &c.ClassLetter,
+		&c.CategoryID, &c.CategoryName, &c.Points, &c.Type, &c.Comment, &c.AuthorID, &c.AuthorName, &c.CreatedAt)
+	return c, err
+}
+
+// ListCorrectableScores — последние действующие начисления ученика и/или автора.
+func ListCorrectableScores(ctx context.Context, database *sql.DB, f ScoreFilter, limit int) ([]CorrectableScore, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	if limit <= 0 {
+		limit = 20
+	}
+	rows, err := database.QueryContext(ctx, correctableSelect+`
+	  AND ($1::BIGINT = 0 OR l.student_id = $1)
+	  AND ($2::BIGINT = 0 OR s.created_by = $2)
+	ORDER BY l.effective_at DESC, l.id DESC
+	LIMIT $3`, f.StudentID, f.AuthorID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []CorrectableScore
+	for rows.Next() {
+		c, err := scanCorrectable(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// GetCorrectableScore — действующие значения начисления; ErrScoreNotApproved, если их нет.
+func GetCorrectableScore(ctx context.Context, database *sql.DB, scoreID int64) (*CorrectableScore, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	c, err := scanCorrectable(database.QueryRowContext(ctx, correctableSelect+`
+	  AND l.score_id = $1
+	ORDER BY l.id DESC
+	LIMIT 1`, scoreID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrScoreNotApproved
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetScoreLedger — все записи журнала по заявке в порядке появления.
+func GetScoreLedger(ctx context.Context, database *sql.DB, scoreID int64) ([]LedgerEntry, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	rows, err := database.QueryContext(ctx, `
+		SELECT id, score_id, kind, reverses_id, student_id, class_id, category_id,
+		       points, collective, reason, effective_at, created_by, created_at
+		FROM score_ledger
+		WHERE score_id = $1
+		ORDER BY id
+	`, scoreID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []LedgerEntry
+	for rows.Next() {
+		var e LedgerEntry
+		if err := rows.Scan(&e.ID, &e.ScoreID, &e.Kind, &e.ReversesID, &e.StudentID, &e.ClassID, &e.CategoryID,
+			&e.Points, &e.Collective, &e.Reason, &e.EffectiveAt, &e.CreatedBy, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// GetClassCollective — коллективный рейтинг класса по журналу за [from, to].
+func GetClassCollective(ctx context.Context, database *sql.DB, classNumber int64, classLetter string, from, to time.Time) (int64, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	var total int64
+	err := database.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(l.collective), 0)
+		FROM score_ledger l
+		JOIN classes c ON c.id = l.class_id
+		WHERE c.number = $1 AND c.letter = $2
+		  AND l.effective_at BETWEEN $3 AND $4
+	`, classNumber, classLetter, from, to).Scan(&total)
+	return total, err
+}
+
+// GetClassCollectiveByPeriod — то же за учебный период (последний день включительно).
+func GetClassCollectiveByPeriod(ctx context.Context, database *sql.DB, classNumber int64, classLetter string, periodID int64) (int64, error) {
+	var startDate, endDate time.Time
+	if err := database.QueryRowContext(ctx, `SELECT start_date, end_date FROM periods WHERE id = $1`, periodID).Scan(&startDate, &endDate); err != nil {
+		return 0, err
+	}
+	return GetClassCollective(ctx, database, classNumber, classLetter, startDate, endDate.Add(24*time.Hour-time.Nanosecond))
+}
+
+// CollectiveDrift — расхождение кэша classes.collective_score с журналом.
+type CollectiveDrift struct {
+	ClassID     int64
+	ClassNumber int
+	ClassLetter string
+	Stored      int64
+	Computed    int64
+}
+
+// ReconcileCollective находит классы, у которых collective_score не совпадает
+// с суммой по журналу; при fix=true записывает в них значение из журнала.
+func ReconcileCollective(ctx context.Context, database *sql.DB, fix bool) ([]CollectiveDrift, error) {
+	ctx, cancel := ctxutil.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	tx, err := database.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if fix {
+		// блокируем классы до подсчёта: начисление, которое ещё не закоммичено,
+		// добавит свой вклад уже поверх исправленного значения
+		if _, err := tx.ExecContext(ctx, `SELECT 1 FROM classes FOR UPDATE`); err != nil {
+			return nil, err
+		}
+	}
+	rows, err := tx.QueryContext(ctx, `
+		SELECT c.id, c.number, c.letter, c.collective_score, COALESCE(SUM(l.collective), 0)
+		FROM classes c
+		LEFT JOIN score_ledger l ON l.class_id = c.id
+		GROUP BY c.id
+		HAVING c.collective_score <> COALESCE(SUM(l.collective), 0)
+		ORDER BY c.number, c.letter
+	`)
+	if err != nil {
+		return nil, err
+	}
+	var out []CollectiveDrift
+	for rows.Next() {
+		var d CollectiveDrift
+		if err := rows.Scan(&d.ClassID, &d.ClassNumber, &d.ClassLetter, &d.Stored, &d.Computed); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if !fix || len(out) == 0 {
+		return out, nil
+	}
+	for _, d := range out {
+		if _, err := tx.ExecContext(ctx, `UPDATE classes SET collective_score = $1 WHERE id = $2`, d.Computed, d.ClassID); err != nil {
+			return nil, err
+		}
+	}
+	return out, tx.Commit()
+}
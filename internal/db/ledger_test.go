@@ -0,0 +1,205 @@
+//go:build testutil
+// +build testutil
+
+package db_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/models"
+	"github.com/Spok95/telegram-school-bot/internal/testutil/testdb"
+)
+
+func TestLedger_ReverseCorrectReconcile(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+	h, err := testdb.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	var classID int64
+	if err := h.DB.QueryRowContext(ctx, `SELECT id FROM classes WHERE number = 7 AND letter = 'Б'`).Scan(&classID); err != nil {
+		t.Fatal(err)
+	}
+	adminID := mustSeedUser(ctx, t, h.DB, "Админ", models.Admin, nil, nil)
+	stID := mustSeedUser(ctx, t, h.DB, "Ученик", models.Student, ptrInt64(7), ptrString("Б"))
+	otherID := mustSeedUser(ctx, t, h.DB, "Другой ученик", models.Student, ptrInt64(7), ptrString("Б"))
+
+	now := time.Now().UTC()
+	if _, err := db.CreatePeriod(ctx, h.DB, models.Period{Name: "Тестовый", StartDate: now.Add(-24 * time.Hour), EndDate: now.Add(24 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetActivePeriod(ctx, h.DB); err != nil {
+		t.Fatal(err)
+	}
+	catID := int64(db.GetCategoryIDByName(ctx, h.DB, "Социальные поступки"))
+
+	for _, pts := range []int{10, 20} {
+		if err := db.AddScoreInstant(ctx, h.DB, models.Score{StudentID: stID, CategoryID: catID, Points: pts, Type: "add", CreatedBy: adminID}, adminID, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	collective := func() int64 {
+		t.Helper()
+		v, err := db.GetClassCollective(ctx, h.DB, 7, "Б", now.Add(-time.Hour), now.Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	balance := func(id int64) int {
+		t.Helper()
+		v, err := db.GetApprovedScoreSum(ctx, h.DB, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	if balance(stID) != 30 || collective() != 9 {
+		t.Fatalf("после начислений: баланс %d, коллективный %d", balance(stID), collective())
+	}
+
+	var first, second int64
+	if err := h.DB.QueryRowContext(ctx, `SELECT MIN(id), MAX(id) FROM scores WHERE student_id = $1`, stID).Scan(&first, &second); err != nil {
+		t.Fatal(err)
+	}
+
+	// отмена: баллы и вклад возвращаются, повторная отмена не проходит
+	if err := db.ReverseScore(ctx, h.DB, first, "ошибочное начисление", &adminID); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.ReverseScore(ctx, h.DB, first, "ещё раз", &adminID); !errors.Is(err, db.ErrScoreNotApproved) {
+		t.Fatalf("ожидали ErrScoreNotApproved, получили %v", err)
+	}
+	if balance(stID) != 20 || collective() != 6 {
+		t.Fatalf("после отмены: баланс %d, коллективный %d", balance(stID), collective())
+	}
+
+	// исправление: баллы переходят другому ученику в другом размере
+	if err := db.CorrectScore(ctx, h.DB, second, db.ScoreCorrection{StudentID: otherID, CategoryID: catID, Points: 50}, "не тот ученик", &adminID); err != nil {
+		t.Fatal(err)
+	}
+	if balance(stID) != 0 || balance(otherID) != 50 || collective() != 15 {
+		t.Fatalf("после исправления: %d / %d, коллективный %d", balance(stID), balance(otherID), collective())
+	}
+	entries, err := db.GetScoreLedger(ctx, h.DB, second)
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("ожидали 3 записи журнала (approve, reversal, correction), получили %d (%v)", len(entries), err)
+	}
+
+	cur, err := db.GetCorrectableScore(ctx, h.DB, second)
+	if err != nil || cur.StudentID != otherID || cur.Points != 50 {
+		t.Fatalf("действующие значения после исправления: %+v (%v)", cur, err)
+	}
+	if _, err := db.GetCorrectableScore(ctx, h.DB, first); !errors.Is(err, db.ErrScoreNotApproved) {
+		t.Fatalf("отменённое начисление не должно предлагаться к исправлению, получили %v", err)
+	}
+	if list, err := db.ListCorrectableScores(ctx, h.DB, db.ScoreFilter{AuthorID: adminID}, 10); err != nil || len(list) != 1 {
+		t.Fatalf("ожидали одно действующее начисление автора, получили %d (%v)", len(list), err)
+	}
+
+	// кэш совпадает с журналом; испорченный кэш находится и чинится
+	if drift, err := db.ReconcileCollective(ctx, h.DB, false); err != nil || len(drift) != 0 {
+		t.Fatalf("расхождений быть не должно: %+v (%v)", drift, err)
+	}
+	if _, err := h.DB.ExecContext(ctx, `UPDATE classes SET collective_score = 999 WHERE id = $1`, classID); err != nil {
+		t.Fatal(err)
+	}
+	drift, err := db.ReconcileCollective(ctx, h.DB, true)
+	if err != nil || len(drift) != 1 || drift[0].Stored != 999 || drift[0].Computed != 15 {
+		t.Fatalf("ожидали одно расхождение 999 -> 15, получили %+v (%v)", drift, err)
+	}
+	if drift, _ := db.ReconcileCollective(ctx, h.DB, false); len(drift) != 0 {
+		t.Fatalf("после исправления расхождений быть не должно: %+v", drift)
+	}
+}
+
+func TestLedger_CollectiveRules(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+	h, err := testdb.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	adminID := mustSeedUser(ctx, t, h.DB, "Админ", models.Admin, nil, nil)
+	stID := mustSeedUser(ctx, t, h.DB, "Ученик", models.Student, ptrInt64(8), ptrString("В"))
+	now := time.Now().UTC()
+
+	catID := int64(db.GetCategoryIDByName(ctx, h.DB, "Внеурочная активность"))
+	auctionID := int64(db.GetCategoryIDByName(ctx, h.DB, "Аукцион"))
+	auction, err := db.GetCategoryByID(ctx, h.DB, auctionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auction.AffectsCollective {
+		t.Fatal("«Аукцион» не должен влиять на коллективный рейтинг после миграции")
+	}
+
+	// 50% для категории, 10% для уровня 100
+	if err := db.SetCategoryCollective(ctx, h.DB, catID, true, 50); err != nil {
+		t.Fatal(err)
+	}
+	levels, err := db.GetLevelsByCategoryIDFull(ctx, h.DB, catID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ten := 10
+	for _, l := range levels {
+		if l.Value == 100 {
+			if err := db.SetLevelCollectivePercent(ctx, h.DB, int64(l.ID), &ten); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := db.SetCategoryCollective(ctx, h.DB, catID, true, 101); err == nil {
+		t.Fatal("процент больше 100 должен отклоняться")
+	}
+
+	add := func(cat int64, pts int, typ string) {
+		t.Helper()
+		if err := db.AddScoreInstant(ctx, h.DB, models.Score{StudentID: stID, CategoryID: cat, Points: pts, Type: typ, CreatedBy: adminID}, adminID, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add(catID, 100, "add")     // 10% уровня → 10
+	add(catID, 200, "add")     // 50% категории → 100
+	add(auctionID, 100, "add") // не влияет → 0
+
+	got, err := db.GetClassCollective(ctx, h.DB, 8, "В", now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 110 {
+		t.Fatalf("коллективный рейтинг: ожидали 110, получили %d", got)
+	}
+
+	// смена правила не трогает уже записанное, а отмена вычитает ровно записанный вклад
+	if err := db.SetCategoryCollective(ctx, h.DB, catID, false, 50); err != nil {
+		t.Fatal(err)
+	}
+	var scoreID int64
+	if err := h.DB.QueryRowContext(ctx, `SELECT id FROM scores WHERE student_id = $1 AND points = 200`, stID).Scan(&scoreID); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.ReverseScore(ctx, h.DB, scoreID, "ошибка", &adminID); err != nil {
+		t.Fatal(err)
+	}
+	got, err = db.GetClassCollective(ctx, h.DB, 8, "В", now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 10 {
+		t.Fatalf("после отмены: ожидали 10, получили %d", got)
+	}
+	if drift, err := db.ReconcileCollective(ctx, h.DB, false); err != nil || len(drift) != 0 {
+		t.Fatalf("кэш разошёлся с журналом: %v %v", drift, err)
+	}
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Spok95/telegram-school-bot/internal/ctxutil"
+)
+
+// NotifySettings — настройки уведомлений пользователя из «⚙️ Настройки».
+type NotifySettings struct {
+	UserID int64
+	// Prefs — только явно заданные переключатели; для остальных типов действует
+	// значение по умолчанию (см. notify.Enabled).
+	Prefs map[string]bool
+	// тихие часы в минутах от полуночи; QuietFrom == QuietTo — не заданы
+	QuietFrom, QuietTo int
+}
+
+// GetNotifySettings — настройки уведомлений пользователя.
+func GetNotifySettings(ctx context.Context, database *sql.DB, userID int64) (NotifySettings, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+
+	s := NotifySettings{UserID: userID, Prefs: map[string]bool{}}
+	var from, to sql.NullInt64
+	if err := database.QueryRowContext(ctx, `SELECT quiet_from, quiet_to FROM users WHERE id = $1`, userID).Scan(&from, &to); err != nil {
+		return s, err
+	}
+	if from.Valid && to.Valid {
+		s.QuietFrom, s.QuietTo = int(from.Int64), int(to.Int64)
+	}
+
+	rows, err := database.QueryContext(ctx, `SELECT kind, enabled FROM notify_prefs WHERE user_id = $1`, userID)
+	if err != nil {
+		return s, err
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var kind string
+		var on bool
+		if err := rows.Scan(&kind, &on); err != nil {
+			return s, err
+		}
+		s.Prefs[kind] = on
+	}
+	return s, rows.Err()
+}
+
+// SetNotifyPref включает или выключает тип уведомлений. При выключении отложенные
+// сообщения этого типа удаляются: накопленное уже не придёт.
+func SetNotifyPref(ctx context.Context, database *sql.DB, userID int64, kind string, enabled bool) error {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	tx, err := database.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO notify_prefs (user_id, kind, enabled) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, kind) DO UPDATE SET enabled = EXCLUDED.enabled
+	`, userID, kind, enabled); err != nil {
+		return err
+	}
+	if !enabled {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM outbox WHERE user_id = $1 AND kind = $2 AND sent_at IS NULL`, userID, kind); err != nil {
+			return err
+		}
+		if kind == "scores" {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM score_notifications WHERE user_id = $1 AND sent_at IS NULL`, userID); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// SetQuietHours задаёт тихие часы; from == to — выключить.
+func SetQuietHours(ctx context.Context, database *sql.DB, userID int64, from, to int) error {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	var f, t sql.NullInt64
+	if from != to {
+		f = sql.NullInt64{Int64: int64(from), Valid: true}
+		t = sql.NullInt64{Int64: int64(to), Valid: true}
+	}
+	_, err := database.ExecContext(ctx, `UPDATE users SET quiet_from = $1, quiet_to = $2 WHERE id = $3`, f, t, userID)
+	return err
+}
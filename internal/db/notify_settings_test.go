@@ -0,0 +1,71 @@
+//go:build testutil
+// +build testutil
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/models"
+	"github.com/Spok95/telegram-school-bot/internal/testutil/testdb"
+)
+
+func TestNotifySettings_PrefsAndQuietHours(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+	h, err := testdb.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	uid := mustSeedUser(ctx, t, h.DB, "Родитель", models.Parent, nil, nil)
+
+	s, err := db.GetNotifySettings(ctx, h.DB, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Prefs) != 0 || s.QuietFrom != s.QuietTo {
+		t.Fatalf("у нового пользователя настроек нет: %+v", s)
+	}
+
+	if err := db.SetNotifyPref(ctx, h.DB, uid, "consult_reminders", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetQuietHours(ctx, h.DB, uid, 22*60, 7*60); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = db.GetNotifySettings(ctx, h.DB, uid); err != nil {
+		t.Fatal(err)
+	}
+	if on, ok := s.Prefs["consult_reminders"]; !ok || on || s.QuietFrom != 22*60 || s.QuietTo != 7*60 {
+		t.Fatalf("настройки не сохранились: %+v", s)
+	}
+
+	// отложенное на тихие часы сообщение
+	if _, err := db.EnqueueOutbox(ctx, h.DB, db.OutboxMessage{ChatID: 777, UserID: uid, Kind: "scores", Text: "утром", NotBefore: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// выключение типа удаляет его отложенные сообщения
+	if err := db.SetNotifyPref(ctx, h.DB, uid, "scores", false); err != nil {
+		t.Fatal(err)
+	}
+	var pending int
+	if err := h.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM outbox WHERE user_id = $1 AND sent_at IS NULL`, uid).Scan(&pending); err != nil {
+		t.Fatal(err)
+	}
+	if pending != 0 {
+		t.Fatalf("после выключения отложенных сообщений быть не должно, осталось %d", pending)
+	}
+
+	if err := db.SetQuietHours(ctx, h.DB, uid, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = db.GetNotifySettings(ctx, h.DB, uid); err != nil || s.QuietFrom != s.QuietTo {
+		t.Fatalf("тихие часы должны выключиться: %+v %v", s, err)
+	}
+}
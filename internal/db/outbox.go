@@ -0,0 +1,182 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/ctxutil"
+	"github.com/lib/pq"
+)
+
+// OutboxMessage — исходящее сообщение в очереди (см. internal/outbox).
+type OutboxMessage struct {
+	ID          int64
+	ChatID      int64
+	UserID      int64 // 0 — чат без пользователя в БД
+	Kind        string
+	Text        string
+	ReplyMarkup string // JSON inline-клавиатуры; пусто — без кнопок
+	NotBefore   time.Time
+	Attempts    int
+
+	BroadcastID      int64  // 0 — не рассылка
+	AttachmentType   string // "", "photo" или "document"; Text тогда — подпись
+	AttachmentFileID string
+}
+
+// EnqueueOutbox ставит сообщение в очередь. Нулевой NotBefore — отправить как можно скорее.
+// Чатам, заблокировавшим бота, ничего не ставится: ok=false.
+func EnqueueOutbox(ctx context.Context, database *sql.DB, m OutboxMessage) (ok bool, err error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	var notBefore any
+	if !m.NotBefore.IsZero() {
+		notBefore = m.NotBefore
+	}
+	res, err := database.ExecContext(ctx, `
+		INSERT INTO outbox (chat_id, user_id, kind, text, reply_markup, not_before)
+		SELECT $1, NULLIF($2, 0), $3, $4, NULLIF($5, ''), COALESCE($6::TIMESTAMPTZ, NOW())
+		WHERE NOT EXISTS (SELECT 1 FROM users WHERE telegram_id = $1 AND blocked_at IS NOT NULL)
+	`, m.ChatID, m.UserID, m.Kind, m.Text, m.ReplyMarkup, notBefore)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ClaimOutbox забирает до limit наступивших сообщений (NotBefore — запланированное время)
+// и сдвигает им not_before на lease: если процесс упадёт посреди отправки, сообщения
+// вернутся в очередь сами. SKIP LOCKED позволяет нескольким отправителям не мешать друг другу.
+func ClaimOutbox(ctx context.Context, database *sql.DB, limit int, lease time.Duration) ([]OutboxMessage, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	rows, err := database.QueryContext(ctx, `
+		UPDATE outbox o
+		SET not_before = NOW() + make_interval(secs => $2)
+		FROM (
+		    SELECT id, not_before FROM outbox
+		    WHERE sent_at IS NULL AND failed_at IS NULL AND not_before <= NOW()
+		    ORDER BY not_before, id
+		    LIMIT $1
+		    FOR UPDATE SKIP LOCKED
+		) due
+		WHERE o.id = due.id
+		RETURNING o.id, o.chat_id, COALESCE(o.user_id, 0), o.kind, o.text, COALESCE(o.reply_markup, ''), due.not_before, o.attempts,
+		          COALESCE(o.broadcast_id, 0), COALESCE(o.attachment_type, ''), COALESCE(o.attachment_file_id, '')
+	`, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []OutboxMessage
+	for rows.Next() {
+		var m OutboxMessage
+		if err := rows.Scan(&m.ID, &m.ChatID, &m.UserID, &m.Kind, &m.Text, &m.ReplyMarkup, &m.NotBefore, &m.Attempts,
+			&m.BroadcastID, &m.AttachmentType, &m.AttachmentFileID); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// MarkOutboxSent отмечает сообщения отправленными.
+func MarkOutboxSent(ctx context.Context, database *sql.DB, ids []int64) error {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	_, err := database.ExecContext(ctx, `UPDATE outbox SET sent_at = NOW() WHERE id = ANY($1)`, pq.Array(ids))
+	return err
+}
+
+// RetryOutbox откладывает сообщение до at. countAttempt=false — попытка не засчитывается
+// (Telegram попросил подождать или очередь в этот чат занята); пустой lastErr не затирает прежний.
+func RetryOutbox(ctx context.Context, database *sql.DB, id int64, at time.Time, countAttempt bool, lastErr string) error {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	_, err := database.ExecContext(ctx, `
+		UPDATE outbox
+		SET not_before = $2,
+		    attempts = attempts + CASE WHEN $3 THEN 1 ELSE 0 END,
+		    last_error = COALESCE(NULLIF($4, ''), last_error)
+		WHERE id = $1
+	`, id, at, countAttempt, lastErr)
+	return err
+}
+
+// FailOutbox — сообщение доставить не удастся, больше не пытаемся.
+func FailOutbox(ctx context.Context, database *sql.DB, id int64, lastErr string) error {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	_, err := database.ExecContext(ctx, `
+		UPDATE outbox SET failed_at = NOW(), attempts = attempts + 1, last_error = $2 WHERE id = $1
+	`, id, lastErr)
+	return err
+}
+
+// MarkChatBlocked — пользователь заблокировал бота: помечаем его, а всё, что ему
+// ещё стоит в очереди, считаем недоставленным.
+func MarkChatBlocked(ctx context.Context, database *sql.DB, chatID int64, lastErr string) error {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	tx, err := database.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE users SET blocked_at = NOW() WHERE telegram_id = $1 AND blocked_at IS NULL
+	`, chatID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE outbox SET failed_at = NOW(), blocked = TRUE, last_error = $2
+		WHERE chat_id = $1 AND sent_at IS NULL AND failed_at IS NULL
+	`, chatID, lastErr); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetChatBlocked отмечает, что пользователь заблокировал бота или снова открыл чат
+// (обновление my_chat_member от Telegram).
+func SetChatBlocked(ctx context.Context, database *sql.DB, chatID int64, blocked bool) error {
+	if blocked {
+		return MarkChatBlocked(ctx, database, chatID, "bot blocked by user")
+	}
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	_, err := database.ExecContext(ctx, `UPDATE users SET blocked_at = NULL WHERE telegram_id = $1`, chatID)
+	return err
+}
+
+// OutboxStats — глубина очереди: готовые к отправке, отложенные (тихие часы, повтор)
+// и недоставленные за последние сутки.
+func OutboxStats(ctx context.Context, database *sql.DB) (due, delayed, failed int, err error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	err = database.QueryRowContext(ctx, `
+		SELECT
+		    COUNT(*) FILTER (WHERE sent_at IS NULL AND failed_at IS NULL AND not_before <= NOW()),
+		    COUNT(*) FILTER (WHERE sent_at IS NULL AND failed_at IS NULL AND not_before > NOW()),
+		    COUNT(*) FILTER (WHERE failed_at > NOW() - INTERVAL '1 day')
+		FROM outbox
+	`).Scan(&due, &delayed, &failed)
+	return due, delayed, failed, err
+}
+
+// PurgeOutbox удаляет отправленные и недоставленные сообщения старше olderThan.
+// Сообщения рассылок остаются для отчёта и удаляются вместе с рассылкой.
+func PurgeOutbox(ctx context.Context, database *sql.DB, olderThan time.Duration) error {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	_, err := database.ExecContext(ctx, `
+		DELETE FROM outbox
+		WHERE COALESCE(sent_at, failed_at) < NOW() - make_interval(secs => $1)
+		  AND broadcast_id IS NULL
+	`, olderThan.Seconds())
+	return err
+}
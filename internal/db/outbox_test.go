@@ -0,0 +1,87 @@
+//go:build testutil
+// +build testutil
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/models"
+	"github.com/Spok95/telegram-school-bot/internal/testutil/testdb"
+)
+
+func TestOutbox_ClaimRetryBlocked(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+	h, err := testdb.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	uid := mustSeedUser(ctx, t, h.DB, "Родитель", models.Parent, nil, nil)
+	var chatID int64
+	if err := h.DB.QueryRowContext(ctx, `SELECT telegram_id FROM users WHERE id = $1`, uid).Scan(&chatID); err != nil {
+		t.Fatal(err)
+	}
+
+	enqueue := func(text string, notBefore time.Time) {
+		t.Helper()
+		ok, err := db.EnqueueOutbox(ctx, h.DB, db.OutboxMessage{ChatID: chatID, UserID: uid, Kind: "test", Text: text, NotBefore: notBefore})
+		if err != nil || !ok {
+			t.Fatalf("не удалось поставить в очередь: %v", err)
+		}
+	}
+	enqueue("сейчас", time.Time{})
+	enqueue("позже", time.Now().Add(time.Hour))
+
+	// забираем только наступившее; повторная выборка его не видит, пока идёт lease
+	got, err := db.ClaimOutbox(ctx, h.DB, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Text != "сейчас" || got[0].Attempts != 0 {
+		t.Fatalf("ожидали одно наступившее сообщение, получили %+v", got)
+	}
+	if again, err := db.ClaimOutbox(ctx, h.DB, 10, time.Minute); err != nil || len(again) != 0 {
+		t.Fatalf("сообщение в работе не должно выдаваться повторно: %+v %v", again, err)
+	}
+
+	// повтор с засчитанной попыткой
+	if err := db.RetryOutbox(ctx, h.DB, got[0].ID, time.Now().Add(-time.Second), true, "502"); err != nil {
+		t.Fatal(err)
+	}
+	got, err = db.ClaimOutbox(ctx, h.DB, 10, time.Minute)
+	if err != nil || len(got) != 1 || got[0].Attempts != 1 {
+		t.Fatalf("после повтора ожидали попытку 1: %+v %v", got, err)
+	}
+	if err := db.MarkOutboxSent(ctx, h.DB, []int64{got[0].ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 403: пользователь помечен, его очередь закрыта, новые сообщения не ставятся
+	if err := db.MarkChatBlocked(ctx, h.DB, chatID, "Forbidden"); err != nil {
+		t.Fatal(err)
+	}
+	due, delayed, failed, err := db.OutboxStats(ctx, h.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if due != 0 || delayed != 0 || failed != 1 {
+		t.Fatalf("после блокировки: готовых %d, отложенных %d, недоставленных %d", due, delayed, failed)
+	}
+	if ok, err := db.EnqueueOutbox(ctx, h.DB, db.OutboxMessage{ChatID: chatID, Kind: "test", Text: "x"}); err != nil || ok {
+		t.Fatalf("заблокировавшему бота ничего не ставим: ok=%v err=%v", ok, err)
+	}
+
+	// пользователь снова открыл чат
+	if err := db.SetChatBlocked(ctx, h.DB, chatID, false); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := db.EnqueueOutbox(ctx, h.DB, db.OutboxMessage{ChatID: chatID, Kind: "test", Text: "x"}); err != nil || !ok {
+		t.Fatalf("после разблокировки сообщения снова ставятся: ok=%v err=%v", ok, err)
+	}
+}
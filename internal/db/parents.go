@@ -59,6 +59,8 @@ WHERE u.role = 'teacher'
         s.class_id = $1
      OR csc.class_id = $1
   )
+  AND ` + notNonWorkingDaySQL("s.start_at::date") + `
+  AND ` + slotOpenSQL("s.") + `
 ORDER BY u.name
 LIMIT $4`
 	rows, err := dbx.QueryContext(ctx, q, classID, from.UTC(), to.UTC(), limit)
@@ -95,6 +97,8 @@ WHERE u.role = 'teacher'
        s.class_id = (SELECT id FROM cls)
     OR csc.class_id = (SELECT id FROM cls)
   )
+  AND ` + notNonWorkingDaySQL("s.start_at::date") + `
+  AND ` + slotOpenSQL("s.") + `
 ORDER BY u.name
 LIMIT $5`
 	rows, err := dbx.QueryContext(ctx, q, classNumber, classLetter, from.UTC(), to.UTC(), limit)
@@ -113,3 +117,30 @@ LIMIT $5`
 	}
 	return out, rows.Err()
 }
+
+// GetParentTelegramIDs — чаты активных родителей ученика (без заготовок из импорта).
+func GetParentTelegramIDs(ctx context.Context, database *sql.DB, studentID int64) ([]int64, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	rows, err := database.QueryContext(ctx, `
+		SELECT u.telegram_id
+		FROM users u
+		JOIN parents_students ps ON ps.parent_id = u.id
+		WHERE ps.student_id = $1 AND u.role = 'parent'
+		  AND u.confirmed = TRUE AND u.is_active = TRUE AND u.telegram_id > 0
+	`, studentID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -51,6 +51,32 @@ func SetActivePeriod(ctx context.Context, database *sql.DB) error {
 	return tx.Commit()
 }
 
+// ActivatePeriod делает период активным вручную. Бот при запуске и после правки периодов
+// снова выбирает активный по датам.
+func ActivatePeriod(ctx context.Context, database *sql.DB, id int64) error {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	tx, err := database.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE periods SET is_active = FALSE WHERE id <> $1`, id); err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, `UPDATE periods SET is_active = TRUE WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
 func CreatePeriod(ctx context.Context, database *sql.DB, p models.Period) (int64, error) {
 	ctx, cancel := ctxutil.WithDBTimeout(ctx)
 	defer cancel()
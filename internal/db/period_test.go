@@ -5,6 +5,8 @@ package db_test
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"testing"
 	"time"
 
@@ -53,3 +55,44 @@ func TestPeriods_ActiveSelection(t *testing.T) {
 		t.Fatalf("ожидали активный 'текущий', получили %#v", ap)
 	}
 }
+
+func TestActivatePeriod(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h, err := testdb.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	now := time.Now().UTC()
+	cur, err := db.CreatePeriod(ctx, h.DB, models.Period{Name: "текущий", StartDate: now.AddDate(0, 0, -1), EndDate: now.AddDate(0, 1, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := db.CreatePeriod(ctx, h.DB, models.Period{Name: "следующий", StartDate: now.AddDate(0, 2, 0), EndDate: now.AddDate(0, 3, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetActivePeriod(ctx, h.DB); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.ActivatePeriod(ctx, h.DB, next); err != nil {
+		t.Fatal(err)
+	}
+	ap, err := db.GetActivePeriod(ctx, h.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ap.ID != next {
+		t.Fatalf("активен %d, ожидали %d (текущий %d)", ap.ID, next, cur)
+	}
+	if err := db.ActivatePeriod(ctx, h.DB, next+100); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("несуществующий период: %v", err)
+	}
+	// неудачная активация не сбрасывает активный период
+	if ap, err := db.GetActivePeriod(ctx, h.DB); err != nil || ap.ID != next {
+		t.Fatalf("после ошибки активен %#v, %v", ap, err)
+	}
+}
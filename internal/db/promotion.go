@@ -0,0 +1,424 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/ctxutil"
+)
+
+// MaxClassNumber — выпускной класс: его ученики при переводе выпускаются и деактивируются.
+const MaxClassNumber = 11
+
+const (
+	PromotionScheduled  = "scheduled"
+	PromotionDone       = "done"
+	PromotionRolledBack = "rolled_back"
+	PromotionCancelled  = "cancelled"
+)
+
+var (
+	ErrNoPromotion         = errors.New("нет перевода для отката")
+	ErrPromotionThisYear   = errors.New("перевод в этом учебном году уже выполнен")
+	ErrPromotionNotLatest  = errors.New("откатить можно только последний перевод")
+	ErrPromotionDateInPast = errors.New("дата перевода уже прошла")
+)
+
+// Promotion — один перевод учеников в следующий класс (запланированный или выполненный).
+type Promotion struct {
+	ID            int64
+	Status        string
+	EffectiveDate time.Time
+	CreatedBy     *int64
+	AppliedAt     *time.Time
+	Promoted      int
+	Graduated     int
+	RolledBackAt  *time.Time
+}
+
+// PromotionMove — сколько учеников переходит из класса в класс; ToNumber == 0 — выпуск.
+type PromotionMove struct {
+	FromNumber int
+	Letter     string
+	ToNumber   int
+	Students   int
+}
+
+// PromotionPlan — предпросмотр перевода (dry-run): ничего не меняет в БД.
+type PromotionPlan struct {
+	Moves       []PromotionMove
+	Promoted    int
+	Graduated   int
+	ParentLinks int // связи родитель–ребёнок идут за учеником (по user_id)
+	NewClasses  int // сколько классов придётся создать (например, 6Г, если был только 5Г)
+}
+
+// переводим только активных учеников с указанным номером класса
+const promotableStudents = `u.role = 'student' AND u.is_active = TRUE AND u.class_number IS NOT NULL`
+
+// PlanPromotion считает, что сделает перевод, не меняя данных.
+func PlanPromotion(ctx context.Context, database *sql.DB) (*PromotionPlan, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+
+	rows, err := database.QueryContext(ctx, `
+		SELECT u.class_number, COALESCE(UPPER(u.class_letter), ''), COUNT(*)
+		FROM users u
+		WHERE `+promotableStudents+`
+		GROUP BY 1, 2
+		ORDER BY 1, 2
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	plan := &PromotionPlan{}
+	for rows.Next() {
+		var m PromotionMove
+		if err := rows.Scan(&m.FromNumber, &m.Letter, &m.Students); err != nil {
+			return nil, err
+		}
+		if m.FromNumber >= MaxClassNumber {
+			plan.Graduated += m.Students
+		} else {
+			m.ToNumber = m.FromNumber + 1
+			plan.Promoted += m.Students
+		}
+		plan.Moves = append(plan.Moves, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := database.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM parents_students ps
+		JOIN users u ON u.id = ps.student_id
+		WHERE `+promotableStudents,
+	).Scan(&plan.ParentLinks); err != nil {
+		return nil, err
+	}
+
+	if err := database.QueryRowContext(ctx, `
+		SELECT COUNT(DISTINCT (u.class_number, UPPER(u.class_letter)))
+		FROM users u
+		WHERE `+promotableStudents+`
+		  AND u.class_number < $1
+		  AND u.class_letter IS NOT NULL
+		  AND NOT EXISTS (
+		      SELECT 1 FROM classes c
+		      WHERE c.number = u.class_number + 1 AND lower(c.letter) = lower(u.class_letter)
+		  )
+	`, MaxClassNumber).Scan(&plan.NewClasses); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// ApplyPromotion переводит учеников прямо сейчас (effective_date — сегодня).
+func ApplyPromotion(ctx context.Context, database *sql.DB, createdBy *int64, today time.Time) (*Promotion, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	tx, err := database.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var id int64
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO class_promotions (status, effective_date, created_by)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`, PromotionDone, sqlDate(today), createdBy).Scan(&id); err != nil {
+		return nil, err
+	}
+	p, err := applyPromotionTx(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	return p, tx.Commit()
+}
+
+// ApplyDuePromotion выполняет запланированный перевод, если его дата наступила.
+// Возвращает nil, если выполнять нечего.
+func ApplyDuePromotion(ctx context.Context, database *sql.DB, today time.Time) (*Promotion, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	tx, err := database.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var id int64
+	err = tx.QueryRowContext(ctx, `
+		SELECT id FROM class_promotions
+		WHERE status = $1 AND effective_date <= $2
+		FOR UPDATE SKIP LOCKED
+	`, PromotionScheduled, sqlDate(today)).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	p, err := applyPromotionTx(ctx, tx, id)
+	if errors.Is(err, ErrPromotionThisYear) {
+		// повторно в том же году не переводим; расписание снимаем, чтобы не пытаться каждый час
+		if _, err := tx.ExecContext(ctx, `UPDATE class_promotions SET status = $1 WHERE id = $2`, PromotionCancelled, id); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return nil, ErrPromotionThisYear
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, tx.Commit()
+}
+
+// applyPromotionTx — сам перевод внутри транзакции; строка class_promotions уже есть.
+func applyPromotionTx(ctx context.Context, tx *sql.Tx, id int64) (*Promotion, error) {
+	var effective time.Time
+	if err := tx.QueryRowContext(ctx, `SELECT effective_date FROM class_promotions WHERE id = $1`, id).Scan(&effective); err != nil {
+		return nil, err
+	}
+
+	// один перевод на учебный год: защищает от двойного нажатия и повторного запуска джоба
+	from, to := SchoolYearBounds(effective)
+	var exists bool
+	if err := tx.QueryRowContext(ctx, `
+		SELECT EXISTS (
+		    SELECT 1 FROM class_promotions
+		    WHERE status = $1 AND id <> $2 AND effective_date >= $3 AND effective_date < $4
+		)
+	`, PromotionDone, id, sqlDate(from), sqlDate(to)).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrPromotionThisYear
+	}
+
+	// недостающие классы (например, 6Г, если раньше был только 5Г)
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO classes (number, letter)
+		SELECT DISTINCT u.class_number + 1, UPPER(u.class_letter)
+		FROM users u
+		WHERE `+promotableStudents+`
+		  AND u.class_number < $1
+		  AND u.class_letter IS NOT NULL
+		  AND NOT EXISTS (
+		      SELECT 1 FROM classes c
+		      WHERE c.number = u.class_number + 1 AND lower(c.letter) = lower(u.class_letter)
+		  )
+		ON CONFLICT (number, letter) DO NOTHING
+	`, MaxClassNumber); err != nil {
+		return nil, err
+	}
+
+	// журнал по каждому ученику: откуда и куда переведён
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO class_promotion_items
+		    (promotion_id, user_id, old_class_id, old_class_number, old_class_letter,
+		     new_class_id, new_class_number, graduated)
+		SELECT $1, u.id, u.class_id, u.class_number, u.class_letter,
+		       CASE WHEN u.class_number >= $2 THEN NULL ELSE (
+		           SELECT c.id FROM classes c
+		           WHERE c.number = u.class_number + 1 AND lower(c.letter) = lower(u.class_letter)
+		           ORDER BY c.id LIMIT 1
+		       ) END,
+		       CASE WHEN u.class_number >= $2 THEN NULL ELSE u.class_number + 1 END,
+		       u.class_number >= $2
+		FROM users u
+		WHERE `+promotableStudents+`
+	`, id, MaxClassNumber); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE users u
+		SET class_number = i.new_class_number, class_id = i.new_class_id
+		FROM class_promotion_items i
+		WHERE i.promotion_id = $1 AND i.user_id = u.id AND NOT i.graduated
+	`, id); err != nil {
+		return nil, err
+	}
+	// выпускники: класс оставляем для истории, учётку деактивируем
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE users u
+		SET is_active = FALSE, deactivated_at = NOW()
+		FROM class_promotion_items i
+		WHERE i.promotion_id = $1 AND i.user_id = u.id AND i.graduated
+	`, id); err != nil {
+		return nil, err
+	}
+
+	p := &Promotion{ID: id}
+	err := tx.QueryRowContext(ctx, `
+		UPDATE class_promotions p
+		SET status = $2, applied_at = NOW(),
+		    promoted  = (SELECT COUNT(*) FROM class_promotion_items WHERE promotion_id = p.id AND NOT graduated),
+		    graduated = (SELECT COUNT(*) FROM class_promotion_items WHERE promotion_id = p.id AND graduated)
+		WHERE p.id = $1
+		RETURNING status, effective_date, created_by, applied_at, promoted, graduated
+	`, id, PromotionDone).Scan(&p.Status, &p.EffectiveDate, &p.CreatedBy, &p.AppliedAt, &p.Promoted, &p.Graduated)
+	return p, err
+}
+
+// RollbackLastPromotion откатывает последний выполненный перевод.
+// Ученики, которых после перевода уже переместили вручную, не трогаются;
+// возвращается число фактически восстановленных учеников.
+func RollbackLastPromotion(ctx context.Context, database *sql.DB, by *int64) (*Promotion, int, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	tx, err := database.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	p, err := scanPromotion(tx.QueryRowContext(ctx, `
+		SELECT `+promotionCols+` FROM class_promotions
+		WHERE status IN ($1, $2)
+		ORDER BY applied_at DESC NULLS LAST, id DESC
+		LIMIT 1
+		FOR UPDATE
+	`, PromotionDone, PromotionRolledBack))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, 0, ErrNoPromotion
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if p.Status != PromotionDone {
+		return nil, 0, ErrPromotionNotLatest
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE users u
+		SET class_number = i.old_class_number, class_id = i.old_class_id
+		FROM class_promotion_items i
+		WHERE i.promotion_id = $1 AND i.user_id = u.id AND NOT i.graduated
+		  AND u.class_number IS NOT DISTINCT FROM i.new_class_number
+	`, p.ID)
+	if err != nil {
+		return nil, 0, err
+	}
+	restored, _ := res.RowsAffected()
+
+	res, err = tx.ExecContext(ctx, `
+		UPDATE users u
+		SET is_active = TRUE, deactivated_at = NULL
+		FROM class_promotion_items i
+		WHERE i.promotion_id = $1 AND i.user_id = u.id AND i.graduated
+		  AND u.is_active = FALSE
+	`, p.ID)
+	if err != nil {
+		return nil, 0, err
+	}
+	reactivated, _ := res.RowsAffected()
+
+	if err := tx.QueryRowContext(ctx, `
+		UPDATE class_promotions
+		SET status = $2, rolled_back_at = NOW(), rolled_back_by = $3
+		WHERE id = $1
+		RETURNING status, rolled_back_at
+	`, p.ID, PromotionRolledBack, by).Scan(&p.Status, &p.RolledBackAt); err != nil {
+		return nil, 0, err
+	}
+	return p, int(restored + reactivated), tx.Commit()
+}
+
+// SchedulePromotion планирует перевод на дату (заменяет прежнее расписание).
+func SchedulePromotion(ctx context.Context, database *sql.DB, date time.Time, createdBy *int64, today time.Time) (*Promotion, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	if dateOnly(date).Before(dateOnly(today)) {
+		return nil, ErrPromotionDateInPast
+	}
+	tx, err := database.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE class_promotions SET status = $1 WHERE status = $2`, PromotionCancelled, PromotionScheduled); err != nil {
+		return nil, err
+	}
+	p, err := scanPromotion(tx.QueryRowContext(ctx, `
+		INSERT INTO class_promotions (status, effective_date, created_by)
+		VALUES ($1, $2, $3)
+		RETURNING `+promotionCols,
+		PromotionScheduled, sqlDate(date), createdBy))
+	if err != nil {
+		return nil, err
+	}
+	return p, tx.Commit()
+}
+
+// CancelScheduledPromotion снимает расписание; false — планировать было нечего.
+func CancelScheduledPromotion(ctx context.Context, database *sql.DB) (bool, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	res, err := database.ExecContext(ctx, `UPDATE class_promotions SET status = $1 WHERE status = $2`, PromotionCancelled, PromotionScheduled)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// GetScheduledPromotion — запланированный перевод или nil.
+func GetScheduledPromotion(ctx context.Context, database *sql.DB) (*Promotion, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	p, err := scanPromotion(database.QueryRowContext(ctx, `
+		SELECT `+promotionCols+` FROM class_promotions WHERE status = $1
+	`, PromotionScheduled))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return p, err
+}
+
+// GetLastPromotion — последний выполненный (или откаченный) перевод или nil.
+func GetLastPromotion(ctx context.Context, database *sql.DB) (*Promotion, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	p, err := scanPromotion(database.QueryRowContext(ctx, `
+		SELECT `+promotionCols+` FROM class_promotions
+		WHERE status IN ($1, $2)
+		ORDER BY applied_at DESC NULLS LAST, id DESC
+		LIMIT 1
+	`, PromotionDone, PromotionRolledBack))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return p, err
+}
+
+const promotionCols = `id, status, effective_date, created_by, applied_at, promoted, graduated, rolled_back_at`
+
+func scanPromotion(row *sql.Row) (*Promotion, error) {
+	var p Promotion
+	if err := row.Scan(&p.ID, &p.Status, &p.EffectiveDate, &p.CreatedBy, &p.AppliedAt, &p.Promoted, &p.Graduated, &p.RolledBackAt); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// sqlDate — дата для параметра DATE без сдвига часового пояса сессии.
+func sqlDate(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+func dateOnly(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,117 @@
+//go:build testutil
+// +build testutil
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/models"
+	"github.com/Spok95/telegram-school-bot/internal/testutil/testdb"
+)
+
+func TestPromotion_ApplyAndRollback(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+	h, err := testdb.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	adminID := mustSeedUser(ctx, t, h.DB, "Админ", models.Admin, nil, nil)
+	fifth := mustSeedUser(ctx, t, h.DB, "Пятиклассник", models.Student, ptrInt64(5), ptrString("Я"))
+	grad := mustSeedUser(ctx, t, h.DB, "Выпускник", models.Student, ptrInt64(11), ptrString("А"))
+	parentID := mustSeedUser(ctx, t, h.DB, "Родитель", models.Parent, nil, nil)
+	if _, err := h.DB.ExecContext(ctx, `INSERT INTO parents_students (parent_id, student_id) VALUES ($1, $2)`, parentID, fifth); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := db.PlanPromotion(ctx, h.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Promoted != 1 || plan.Graduated != 1 || plan.ParentLinks != 1 || plan.NewClasses != 1 {
+		t.Fatalf("неожиданный план: %+v", plan)
+	}
+
+	today := time.Date(2026, 6, 30, 0, 0, 0, 0, time.UTC)
+	p, err := db.ApplyPromotion(ctx, h.DB, &adminID, today)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Promoted != 1 || p.Graduated != 1 {
+		t.Fatalf("неожиданный итог: %+v", p)
+	}
+	if _, err := db.ApplyPromotion(ctx, h.DB, &adminID, today); err != db.ErrPromotionThisYear {
+		t.Fatalf("второй перевод в том же году должен отклоняться, получили %v", err)
+	}
+
+	u, err := db.GetUserByID(ctx, h.DB, fifth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ClassNumber == nil || *u.ClassNumber != 6 || u.ClassID == nil {
+		t.Fatalf("ученик должен перейти в 6Я с class_id, получили %+v", u)
+	}
+	g, err := db.GetUserByID(ctx, h.DB, grad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.IsActive {
+		t.Fatal("выпускник должен быть деактивирован")
+	}
+	var links int
+	if err := h.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM parents_students WHERE student_id = $1`, fifth).Scan(&links); err != nil || links != 1 {
+		t.Fatalf("связь с родителем должна сохраниться: %d, %v", links, err)
+	}
+
+	if _, restored, err := db.RollbackLastPromotion(ctx, h.DB, &adminID); err != nil || restored != 2 {
+		t.Fatalf("откат: восстановлено %d, %v", restored, err)
+	}
+	u, _ = db.GetUserByID(ctx, h.DB, fifth)
+	g, _ = db.GetUserByID(ctx, h.DB, grad)
+	if *u.ClassNumber != 5 || !g.IsActive {
+		t.Fatalf("после отката ожидали 5 класс и активного выпускника: %+v / %+v", u, g)
+	}
+	if _, _, err := db.RollbackLastPromotion(ctx, h.DB, &adminID); err != db.ErrPromotionNotLatest {
+		t.Fatalf("повторный откат должен отклоняться, получили %v", err)
+	}
+}
+
+func TestPromotion_Scheduled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+	h, err := testdb.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	st := mustSeedUser(ctx, t, h.DB, "Ученик", models.Student, ptrInt64(7), ptrString("Б"))
+	day := time.Date(2026, 8, 31, 0, 0, 0, 0, time.UTC)
+
+	if _, err := db.SchedulePromotion(ctx, h.DB, day.AddDate(0, 0, -1), nil, day); err != db.ErrPromotionDateInPast {
+		t.Fatalf("дата в прошлом должна отклоняться, получили %v", err)
+	}
+	if _, err := db.SchedulePromotion(ctx, h.DB, day, nil, day.AddDate(0, 0, -10)); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := db.ApplyDuePromotion(ctx, h.DB, day.AddDate(0, 0, -1)); err != nil || p != nil {
+		t.Fatalf("до даты перевод не выполняется: %+v, %v", p, err)
+	}
+	p, err := db.ApplyDuePromotion(ctx, h.DB, day)
+	if err != nil || p == nil || p.Promoted != 1 {
+		t.Fatalf("в дату перевод должен выполниться: %+v, %v", p, err)
+	}
+	if sch, _ := db.GetScheduledPromotion(ctx, h.DB); sch != nil {
+		t.Fatalf("после выполнения расписание должно сняться: %+v", sch)
+	}
+	u, _ := db.GetUserByID(ctx, h.DB, st)
+	if *u.ClassNumber != 8 {
+		t.Fatalf("ожидали 8 класс, получили %d", *u.ClassNumber)
+	}
+}
@@ -0,0 +1,324 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/ctxutil"
+)
+
+// Источник импорта списка — для журнала roster_imports.
+const (
+	RosterSourceBot  = "bot"
+	RosterSourceHTTP = "http"
+)
+
+// Итог по строке списка.
+const (
+	RosterCreated  = "created"  // заведён новый ученик-заготовка
+	RosterMatched  = "matched"  // ученик уже есть в базе
+	RosterRejected = "rejected" // строка не принята
+)
+
+// RosterRow — строка списка класса из файла импорта.
+// ClassNumber == 0 — класс в файле не удалось разобрать.
+type RosterRow struct {
+	Line        int // номер строки в файле (для отчёта)
+	Name        string
+	Class       string // как записано в файле: «5А», «5 а», «5-А»
+	ClassNumber int
+	ClassLetter string
+	ParentName  string
+	ParentPhone string
+}
+
+// RosterOutcome — что импорт сделал со строкой.
+type RosterOutcome struct {
+	Row       RosterRow
+	Status    string
+	StudentID int64
+	Reason    string // причина отказа или замечание (например, про родителя)
+}
+
+// RosterResult — итог импорта: по строке на каждую строку файла.
+type RosterResult struct {
+	ImportID int64
+	Outcomes []RosterOutcome
+	Created  int
+	Matched  int
+	Rejected int
+	Parents  int // заведено родителей-заготовок
+}
+
+// IsPlaceholderTelegramID — у заготовок из импорта вместо чата отрицательный номер:
+// писать им в Telegram нельзя.
+func IsPlaceholderTelegramID(id int64) bool { return id < 0 }
+
+type rosterClass struct {
+	id     int64
+	letter string
+	hidden bool
+}
+
+// ImportRoster сверяет строки со справочником классов и с учениками в базе
+// (UPPER(name) + номер и буква класса — как при поиске ребёнка родителем)
+// и заводит недостающих учеников подтверждёнными заготовками.
+// Всё выполняется одной транзакцией: при ошибке БД в базе ничего не меняется.
+func ImportRoster(ctx context.Context, database *sql.DB, rows []RosterRow, source, fileName string, createdBy *int64) (*RosterResult, error) {
+	ctx, cancel := ctxutil.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	tx, err := database.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	classes, err := loadRosterClasses(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &RosterResult{}
+	seen := make(map[string]int)      // ключ ученика -> строка, где он уже встречался
+	parents := make(map[string]int64) // ключ родителя -> id заготовки из этого импорта
+	for _, row := range rows {
+		out := RosterOutcome{Row: row, Status: RosterRejected}
+		row.Name = strings.Join(strings.Fields(row.Name), " ")
+		out.Row.Name = row.Name
+
+		switch {
+		case row.Name == "":
+			out.Reason = "не указано ФИО"
+		case row.ClassNumber == 0:
+			out.Reason = "не удалось разобрать класс"
+		}
+		if out.Reason != "" {
+			res.add(out)
+			continue
+		}
+
+		cls, ok := classes[classKey(row.ClassNumber, row.ClassLetter)]
+		if !ok {
+			out.Reason = fmt.Sprintf("класса %d%s нет в справочнике", row.ClassNumber, strings.ToUpper(row.ClassLetter))
+			res.add(out)
+			continue
+		}
+		if cls.hidden {
+			out.Reason = fmt.Sprintf("класс %d%s скрыт в справочнике", row.ClassNumber, cls.letter)
+			res.add(out)
+			continue
+		}
+
+		key := strings.ToUpper(row.Name) + "|" + classKey(row.ClassNumber, cls.letter)
+		if line, dup := seen[key]; dup {
+			out.Reason = fmt.Sprintf("повтор строки %d", line)
+			res.add(out)
+			continue
+		}
+		seen[key] = row.Line
+
+		studentID, err := findRosterStudent(ctx, tx, row.Name, row.ClassNumber, cls.letter)
+		switch {
+		case err == nil:
+			out.Status = RosterMatched
+		case errors.Is(err, sql.ErrNoRows):
+			if err := tx.QueryRowContext(ctx, `
+				INSERT INTO users (telegram_id, name, role, class_id, class_number, class_letter, confirmed, is_active, is_placeholder)
+				VALUES (-nextval('roster_placeholder_seq'), $1, 'student', $2, $3, $4, TRUE, TRUE, TRUE)
+				RETURNING id
+			`, row.Name, cls.id, row.ClassNumber, cls.letter).Scan(&studentID); err != nil {
+				return nil, fmt.Errorf("строка %d: %w", row.Line, err)
+			}
+			out.Status = RosterCreated
+		default:
+			return nil, fmt.Errorf("строка %d: %w", row.Line, err)
+		}
+		out.StudentID = studentID
+
+		created, note, err := attachRosterParent(ctx, tx, studentID, row, parents)
+		if err != nil {
+			return nil, fmt.Errorf("строка %d: %w", row.Line, err)
+		}
+		if created {
+			res.Parents++
+		}
+		out.Reason = note
+		res.add(out)
+	}
+
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO roster_imports (source, file_name, created_by, created, matched, rejected)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, source, fileName, createdBy, res.Created, res.Matched, res.Rejected).Scan(&res.ImportID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (r *RosterResult) add(o RosterOutcome) {
+	switch o.Status {
+	case RosterCreated:
+		r.Created++
+	case RosterMatched:
+		r.Matched++
+	default:
+		r.Rejected++
+	}
+	r.Outcomes = append(r.Outcomes, o)
+}
+
+func classKey(number int, letter string) string {
+	return fmt.Sprintf("%d%s", number, strings.ToUpper(letter))
+}
+
+func loadRosterClasses(ctx context.Context, tx *sql.Tx) (map[string]rosterClass, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT id, number, letter, hidden FROM classes`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	out := make(map[string]rosterClass)
+	for rows.Next() {
+		var (
+			c      rosterClass
+			number int
+		)
+		if err := rows.Scan(&c.id, &number, &c.letter, &c.hidden); err != nil {
+			return nil, err
+		}
+		out[classKey(number, c.letter)] = c
+	}
+	return out, rows.Err()
+}
+
+// findRosterStudent — то же сравнение, что и в поиске ребёнка родителем,
+// но учитываются и неподтверждённые заявки: иначе после подтверждения появился бы дубль.
+func findRosterStudent(ctx context.Context, tx *sql.Tx, name string, number int, letter string) (int64, error) {
+	var id int64
+	err := tx.QueryRowContext(ctx, `
+		SELECT id FROM users
+		WHERE UPPER(name) = UPPER($1)
+		  AND class_number = $2
+		  AND UPPER(class_letter) = UPPER($3)
+		  AND role = 'student' AND is_active = TRUE
+		ORDER BY confirmed DESC, id
+		LIMIT 1
+	`, name, number, letter).Scan(&id)
+	return id, err
+}
+
+// attachRosterParent привязывает к ученику родителя из строки списка.
+// Уже привязанный родитель с тем же ФИО не дублируется; братья и сёстры
+// из одного файла получают одну заготовку родителя (ФИО + телефон).
+func attachRosterParent(ctx context.Context, tx *sql.Tx, studentID int64, row RosterRow, parents map[string]int64) (bool, string, error) {
+	name := strings.Join(strings.Fields(row.ParentName), " ")
+	if name == "" {
+		if row.ParentPhone != "" {
+			return false, "телефон родителя без ФИО — родитель не заведён", nil
+		}
+		return false, "", nil
+	}
+
+	var linked int64
+	err := tx.QueryRowContext(ctx, `
+		SELECT u.id FROM users u
+		JOIN parents_students ps ON ps.parent_id = u.id
+		WHERE ps.student_id = $1 AND UPPER(u.name) = UPPER($2)
+		LIMIT 1
+	`, studentID, name).Scan(&linked)
+	if err == nil {
+		return false, "родитель уже привязан", nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, "", err
+	}
+
+	key := strings.ToUpper(name) + "|" + row.ParentPhone
+	parentID, ok := parents[key]
+	created := false
+	if !ok {
+		var phone any
+		if row.ParentPhone != "" {
+			phone = row.ParentPhone
+		}
+		if err := tx.QueryRowContext(ctx, `
+			INSERT INTO users (telegram_id, name, role, confirmed, is_active, is_placeholder, phone)
+			VALUES (-nextval('roster_placeholder_seq'), $1, 'parent', TRUE, TRUE, TRUE, $2)
+			RETURNING id
+		`, name, phone).Scan(&parentID); err != nil {
+			return false, "", err
+		}
+		parents[key] = parentID
+		created = true
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO parents_students (parent_id, student_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, parentID, studentID); err != nil {
+		return false, "", err
+	}
+	return created, "", nil
+}
+
+// ClaimStudentPlaceholder привязывает ученика-заготовку из импорта к чату,
+// если при регистрации совпали ФИО и класс. Возвращает 0, если заготовки нет.
+func ClaimStudentPlaceholder(ctx context.Context, database *sql.DB, telegramID int64, name string, classNumber int64, classLetter string) (int64, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	var id int64
+	err := database.QueryRowContext(ctx, `
+		UPDATE users SET telegram_id = $1, is_placeholder = FALSE
+		WHERE id = (
+			SELECT id FROM users
+			WHERE is_placeholder AND role = 'student' AND is_active = TRUE
+			  AND UPPER(name) = UPPER($2)
+			  AND class_number = $3
+			  AND UPPER(class_letter) = UPPER($4)
+			ORDER BY id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		  AND NOT EXISTS (SELECT 1 FROM users WHERE telegram_id = $1)
+		RETURNING id
+	`, telegramID, strings.TrimSpace(name), classNumber, classLetter).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return id, err
+}
+
+// ClaimParentPlaceholder — то же для родителя: заготовка ищется среди родителей,
+// уже привязанных к выбранному ребёнку. Возвращает 0, если заготовки нет.
+func ClaimParentPlaceholder(ctx context.Context, database *sql.DB, telegramID, studentID int64, name string) (int64, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	var id int64
+	err := database.QueryRowContext(ctx, `
+		UPDATE users SET telegram_id = $1, is_placeholder = FALSE
+		WHERE id = (
+			SELECT u.id FROM users u
+			JOIN parents_students ps ON ps.parent_id = u.id
+			WHERE u.is_placeholder AND u.role = 'parent'
+			  AND ps.student_id = $2
+			  AND UPPER(u.name) = UPPER($3)
+			ORDER BY u.id
+			LIMIT 1
+			FOR UPDATE OF u SKIP LOCKED
+		)
+		  AND NOT EXISTS (SELECT 1 FROM users WHERE telegram_id = $1)
+		RETURNING id
+	`, telegramID, studentID, strings.TrimSpace(name)).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return id, err
+}
@@ -0,0 +1,82 @@
+//go:build testutil
+// +build testutil
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/models"
+	"github.com/Spok95/telegram-school-bot/internal/testutil/testdb"
+)
+
+func TestRoster_ImportAndClaim(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+	h, err := testdb.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	existing := mustSeedUser(ctx, t, h.DB, "Петров Пётр", models.Student, ptrInt64(5), ptrString("А"))
+
+	rows := []db.RosterRow{
+		{Line: 2, Name: "Иванов  Иван", ClassNumber: 5, ClassLetter: "А", ParentName: "Иванова Мария", ParentPhone: "+79161234567"},
+		{Line: 3, Name: "ПЕТРОВ ПЁТР", ClassNumber: 5, ClassLetter: "а"},
+		{Line: 4, Name: "Иванова Ольга", ClassNumber: 7, ClassLetter: "Б", ParentName: "Иванова Мария", ParentPhone: "+79161234567"},
+		{Line: 5, Name: "Иванов Иван", ClassNumber: 5, ClassLetter: "А"},
+		{Line: 6, Name: "Никто", ClassNumber: 5, ClassLetter: "Я"},
+		{Line: 7, Name: "", ClassNumber: 5, ClassLetter: "А"},
+	}
+	res, err := db.ImportRoster(ctx, h.DB, rows, db.RosterSourceHTTP, "list.csv", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Created != 2 || res.Matched != 1 || res.Rejected != 3 || res.Parents != 1 {
+		t.Fatalf("неожиданный итог: created=%d matched=%d rejected=%d parents=%d",
+			res.Created, res.Matched, res.Rejected, res.Parents)
+	}
+	if res.Outcomes[1].StudentID != existing {
+		t.Fatalf("ученик должен найтись без учёта регистра, получили %+v", res.Outcomes[1])
+	}
+	ivanID := res.Outcomes[0].StudentID
+
+	// ребёнок регистрируется с теми же ФИО и классом — заготовка получает его чат
+	claimed, err := db.ClaimStudentPlaceholder(ctx, h.DB, 555001, "иванов иван", 5, "А")
+	if err != nil || claimed != ivanID {
+		t.Fatalf("ожидали привязку заготовки %d, получили %d (%v)", ivanID, claimed, err)
+	}
+	u, err := db.GetUserByTelegramID(ctx, h.DB, 555001)
+	if err != nil || u == nil || !u.Confirmed || u.ID != ivanID {
+		t.Fatalf("ученик должен быть подтверждён сразу: %+v (%v)", u, err)
+	}
+	if again, err := db.ClaimStudentPlaceholder(ctx, h.DB, 555002, "Иванов Иван", 5, "А"); err != nil || again != 0 {
+		t.Fatalf("заготовку нельзя привязать дважды: %d (%v)", again, err)
+	}
+
+	// родитель — общая заготовка для обоих детей
+	parentID, err := db.ClaimParentPlaceholder(ctx, h.DB, 555003, ivanID, "ИВАНОВА МАРИЯ")
+	if err != nil || parentID == 0 {
+		t.Fatalf("ожидали привязку родителя, получили %d (%v)", parentID, err)
+	}
+	var children int
+	if err := h.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM parents_students WHERE parent_id = $1`, parentID).Scan(&children); err != nil {
+		t.Fatal(err)
+	}
+	if children != 2 {
+		t.Fatalf("родитель должен быть привязан к двум детям, получили %d", children)
+	}
+
+	// повторный импорт того же файла ничего не создаёт
+	res, err = db.ImportRoster(ctx, h.DB, rows[:3], db.RosterSourceBot, "list.csv", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Created != 0 || res.Matched != 3 || res.Parents != 0 {
+		t.Fatalf("повторный импорт: created=%d matched=%d parents=%d", res.Created, res.Matched, res.Parents)
+	}
+}
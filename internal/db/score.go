@@ -32,7 +32,7 @@ func scanScoreWithUserFull(rows *sql.Rows) (models.ScoreWithUser, error) {
 	err := rows.Scan(
 		&s.ID, &s.StudentID, &s.CategoryID, &s.Points, &s.Type, &s.Comment,
 		&s.Status, &s.ApprovedBy, &s.ApprovedAt, &s.CreatedBy, &s.CreatedAt, &s.PeriodID,
-		&s.StudentName, &s.ClassNumber, &s.ClassLetter, &s.CategoryLabel, &s.AddedByName,
+		&s.StudentName, &s.ClassNumber, &s.ClassLetter, &s.CategoryLabel, &s.AddedByName, &s.Collective,
 	)
 	return s, err
 }
@@ -43,13 +43,21 @@ func AddScore(ctx context.Context, database *sql.DB, score models.Score) error {
 	query := `
 INSERT INTO scores (
                     student_id, category_id, points, type, comment, status, approved_by, approved_at, created_by, created_at, period_id
-) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11);`
+) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+RETURNING id;`
 
 	if score.Type == "remove" {
 		score.Points = -score.Points
 	}
 
-	_, err := database.ExecContext(ctx, query,
+	tx, err := database.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var id int64
+	err = tx.QueryRowContext(ctx, query,
 		score.StudentID,
 		score.CategoryID,
 		score.Points,
@@ -61,11 +69,19 @@ INSERT INTO scores (
 		score.CreatedBy,
 		score.CreatedAt,
 		score.PeriodID,
-	)
+	).Scan(&id)
 	if err != nil {
 		log.Println("Ошибка при добавлении записи о баллах:", err)
+		return err
 	}
-	return err
+	// сразу подтверждённое начисление — тоже запись в журнале
+	if score.Status == "approved" {
+		if err := approveLedgerEntry(ctx, tx, id, score.ApprovedBy); err != nil {
+			log.Println("Ошибка при записи в журнал начислений:", err)
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
 // GetPendingScores возвращает все заявки, ожидающие подтверждения
@@ -96,7 +112,7 @@ func GetPendingScores(ctx context.Context, database *sql.DB) ([]models.Score, er
 	return results, nil
 }
 
-// AddScoreInstant создать начисление сразу approved и обновить коллективный рейтинг
+// AddScoreInstant создать начисление сразу approved и записать его в журнал
 func AddScoreInstant(ctx context.Context, database *sql.DB, score models.Score, approvedBy int64, approvedAt time.Time) error {
 	ctx, cancel := ctxutil.WithDBTimeout(ctx)
 	defer cancel()
@@ -124,36 +140,30 @@ func AddScoreInstant(ctx context.Context, database *sql.DB, score models.Score,
 	defer func() { _ = tx.Rollback() }()
 
 	// 2) Вставка сразу approved с обязательным period_id
-	_, err = tx.ExecContext(ctx, `
+	var scoreID int64
+	err = tx.QueryRowContext(ctx, `
 		INSERT INTO scores (
 			student_id, category_id, points, type, comment,
 			status, approved_by, approved_at, created_by, created_at, period_id
 		) VALUES ($1,$2,$3,'add',$4,'approved',$5,$6,$7,NOW(),$8)
+		RETURNING id
 	`,
 		score.StudentID, score.CategoryID, score.Points, score.Comment,
 		approvedBy, approvedAt, score.CreatedBy, period.ID,
-	)
+	).Scan(&scoreID)
 	if err != nil {
 		return err
 	}
 
-	// 3) Обновляем коллективный рейтинг класса (+30% от |points|)
-	adj := score.Points
-	if adj < 0 {
-		adj = -adj
-	}
-	if _, err := tx.ExecContext(ctx, `
-		UPDATE classes
-		SET collective_score = collective_score + $1
-		WHERE id = (SELECT class_id FROM users WHERE id = $2)
-	`, (adj*30)/100, score.StudentID); err != nil {
+	// 3) Запись в журнале; она же обновляет коллективный рейтинг класса
+	if err := approveLedgerEntry(ctx, tx, scoreID, &approvedBy); err != nil {
 		return err
 	}
 
 	return tx.Commit()
 }
 
-// ApproveScore подтверждает заявку и обновляет рейтинг ученика и класса
+// ApproveScore подтверждает заявку и записывает её в журнал начислений
 func ApproveScore(ctx context.Context, database *sql.DB, scoreID int64, adminID int64, approvedAt time.Time) error {
 	ctx, cancel := ctxutil.WithDBTimeout(ctx)
 	defer cancel()
@@ -163,11 +173,11 @@ func ApproveScore(ctx context.Context, database *sql.DB, scoreID int64, adminID
 	}
 	defer func() { _ = tx.Rollback() }()
 
-	var studentID int64
-	var points int
-	var scoreType string
-	var categoryID int64
-	err = tx.QueryRowContext(ctx, `SELECT student_id, points, type, category_id FROM scores WHERE id = $1 AND status = 'pending'`, scoreID).Scan(&studentID, &points, &scoreType, &categoryID)
+	var status string
+	err = tx.QueryRowContext(ctx, `SELECT status FROM scores WHERE id = $1 FOR UPDATE`, scoreID).Scan(&status)
+	if err == nil && status != "pending" {
+		err = sql.ErrNoRows
+	}
 	if err != nil {
 		return fmt.Errorf("заявка не найдена: %v", err)
 	}
@@ -190,24 +200,9 @@ func ApproveScore(ctx context.Context, database *sql.DB, scoreID int64, adminID
 		return err
 	}
 
-	// Приводим к положительному числу (points уже может быть отрицательным)
-	adjust := points
-	if adjust < 0 {
-		adjust = -adjust
-	}
-	catName := GetCategoryNameByID(ctx, database, int(categoryID))
-
-	// Обновляем коллективный рейтинг
-	if scoreType == "add" {
-		_, err = tx.ExecContext(ctx, `UPDATE classes SET collective_score = collective_score + $1 WHERE id = (SELECT class_id FROM users WHERE id = $2)`, adjust*30/100, studentID)
-		if err != nil {
-			return err
-		}
-	} else if scoreType == "remove" && catName != "Аукцион" {
-		_, err = tx.ExecContext(ctx, `UPDATE classes SET collective_score = collective_score - $1 WHERE id = (SELECT class_id FROM users WHERE id = $2)`, adjust*30/100, studentID)
-		if err != nil {
-			return err
-		}
+	// Баллы ученика и вклад в коллективный рейтинг — записью в журнале
+	if err := approveLedgerEntry(ctx, tx, scoreID, &adminID); err != nil {
+		return err
 	}
 	return tx.Commit()
 }
@@ -215,7 +210,7 @@ func ApproveScore(ctx context.Context, database *sql.DB, scoreID int64, adminID
 func RejectScore(ctx context.Context, database *sql.DB, scoreID int64, adminID int64, rejectedAt time.Time) error {
 	ctx, cancel := ctxutil.WithDBTimeout(ctx)
 	defer cancel()
-	_, err := database.ExecContext(ctx, `UPDATE scores SET status = 'rejected', approved_by = $1, approved_at = $2 WHERE id = $3`, adminID, rejectedAt, scoreID)
+	_, err := database.ExecContext(ctx, `UPDATE scores SET status = 'rejected', approved_by = $1, approved_at = $2 WHERE id = $3 AND status = 'pending'`, adminID, rejectedAt, scoreID)
 	return err
 }
 
@@ -235,8 +230,8 @@ func GetApprovedScoreSum(ctx context.Context, database *sql.DB, studentID int64)
 	var total int
 	err := database.QueryRowContext(ctx, `
 		SELECT COALESCE(SUM(points), 0)
-		FROM scores
-		WHERE student_id = $1 AND status = 'approved'`, studentID).Scan(&total)
+		FROM score_ledger
+		WHERE student_id = $1`, studentID).Scan(&total)
 	if err != nil {
 		return 0, fmt.Errorf("ошибка при получении баланса ученика %d: %v", studentID, err)
 	}
@@ -265,7 +260,7 @@ func GetScoresByPeriod(ctx context.Context, database *sql.DB, periodID int) ([]m
 		scores.comment,
 		a.name AS added_by_name,
 		scores.created_at
-	FROM scores
+	FROM score_entries scores
 	JOIN users s ON scores.student_id = s.id
 	JOIN users a ON scores.created_by = a.id
 	JOIN categories c ON scores.category_id = c.id
@@ -304,9 +299,9 @@ func GetScoresByStudentAndDateRange(ctx context.Context, database *sql.DB, stude
 	s.id, s.student_id, s.category_id, s.points, s.type, s.comment,
 	s.status, s.approved_by, s.approved_at, s.created_by, s.created_at, s.period_id,
 	u.name AS student_name, u.class_number, u.class_letter,
-	c.name AS category_label, ua.name AS added_by_name
+	c.name AS category_label, ua.name AS added_by_name, s.collective
 
-	FROM scores s
+	FROM score_entries s
 	JOIN users u ON u.id = s.student_id
 	JOIN users ua ON ua.id = s.created_by
 	JOIN categories c ON c.id = s.category_id
@@ -344,9 +339,9 @@ func GetScoresByClassAndDateRange(ctx context.Context, database *sql.DB, classNu
 	s.id, s.student_id, s.category_id, s.points, s.type, s.comment,
 	s.status, s.approved_by, s.approved_at, s.created_by, s.created_at, s.period_id,
 	u.name AS student_name, u.class_number, u.class_letter,
-	c.name AS category_label, ua.name AS added_by_name
+	c.name AS category_label, ua.name AS added_by_name, s.collective
 
-	FROM scores s
+	FROM score_entries s
 	JOIN users u ON u.id = s.student_id
 	JOIN users ua ON ua.id = s.created_by
 	JOIN categories c ON c.id = s.category_id
@@ -385,9 +380,9 @@ func GetScoresByDateRange(ctx context.Context, database *sql.DB, from, to time.T
 	s.id, s.student_id, s.category_id, s.points, s.type, s.comment,
 	s.status, s.approved_by, s.approved_at, s.created_by, s.created_at, s.period_id,
 	u.name AS student_name, u.class_number, u.class_letter,
-	c.name AS category_label, ua.name AS added_by_name
+	c.name AS category_label, ua.name AS added_by_name, s.collective
 
-	FROM scores s
+	FROM score_entries s
 	JOIN users u ON u.id = s.student_id
 	JOIN users ua ON ua.id = s.created_by
 	JOIN categories c ON c.id = s.category_id
@@ -435,9 +430,9 @@ func GetScoresByStudentAndPeriod(ctx context.Context, database *sql.DB, selected
 	s.id, s.student_id, s.category_id, s.points, s.type, s.comment,
 	s.status, s.approved_by, s.approved_at, s.created_by, s.created_at, s.period_id,
 	u.name AS student_name, u.class_number, u.class_letter,
-	c.name AS category_label, ua.name AS added_by_name
+	c.name AS category_label, ua.name AS added_by_name, s.collective
 
-	FROM scores s
+	FROM score_entries s
 	JOIN users u ON u.id = s.student_id
 	JOIN users ua ON ua.id = s.created_by
 	JOIN categories c ON c.id = s.category_id
@@ -485,9 +480,9 @@ func GetScoresByClassAndPeriod(ctx context.Context, database *sql.DB, classNumbe
 	s.id, s.student_id, s.category_id, s.points, s.type, s.comment,
 	s.status, s.approved_by, s.approved_at, s.created_by, s.created_at, s.period_id,
 	u.name AS student_name, u.class_number, u.class_letter,
-	c.name AS category_label, ua.name AS added_by_name
+	c.name AS category_label, ua.name AS added_by_name, s.collective
 
-	FROM scores s
+	FROM score_entries s
 	JOIN users u ON u.id = s.student_id
 	JOIN users ua ON ua.id = s.created_by
 	JOIN categories c ON c.id = s.category_id
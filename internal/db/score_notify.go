@@ -0,0 +1,99 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/ctxutil"
+	"github.com/lib/pq"
+)
+
+// ScoreNotice — уведомление о подтверждённом начислении, ожидающее отправки.
+type ScoreNotice struct {
+	ID          int64
+	UserID      int64
+	ChatID      int64
+	StudentID   int64
+	StudentName string
+	Category    string
+	Points      int
+	Comment     *string
+}
+
+// enqueueScoreNotifications ставит в очередь уведомления о заявке scoreID ученику
+// и его родителям — тем, кто включил их в «⚙️ Настройки» и может получить сообщение.
+func enqueueScoreNotifications(ctx context.Context, tx *sql.Tx, scoreID int64) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO score_notifications (user_id, score_id)
+		SELECT u.id, s.id
+		FROM scores s
+		JOIN users u ON u.id = s.student_id
+		             OR u.id IN (SELECT ps.parent_id FROM parents_students ps WHERE ps.student_id = s.student_id)
+		WHERE s.id = $1
+		  AND u.is_active = TRUE AND u.telegram_id > 0
+		  AND EXISTS (SELECT 1 FROM notify_prefs p WHERE p.user_id = u.id AND p.kind = 'scores' AND p.enabled)
+		ON CONFLICT (user_id, score_id) DO NOTHING
+	`, scoreID)
+	return err
+}
+
+// DueScoreNotices — неотправленные уведомления тех получателей, кому за последние
+// window ничего не отправляли: так массовое начисление приходит одним сообщением.
+func DueScoreNotices(ctx context.Context, database *sql.DB, window time.Duration, limit int) ([]ScoreNotice, error) {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	rows, err := database.QueryContext(ctx, `
+		WITH due AS (
+		    SELECT DISTINCT n.user_id
+		    FROM score_notifications n
+		    WHERE n.sent_at IS NULL
+		      AND NOT EXISTS (
+		          SELECT 1 FROM score_notifications p
+		          WHERE p.user_id = n.user_id AND p.sent_at > NOW() - make_interval(secs => $1)
+		      )
+		    LIMIT $2
+		)
+		SELECT n.id, n.user_id, u.telegram_id, st.id, st.name, cat.name, sc.points, sc.comment
+		FROM score_notifications n
+		JOIN due d ON d.user_id = n.user_id
+		JOIN users u ON u.id = n.user_id
+		JOIN scores sc ON sc.id = n.score_id
+		JOIN users st ON st.id = sc.student_id
+		JOIN categories cat ON cat.id = sc.category_id
+		WHERE n.sent_at IS NULL
+		ORDER BY n.user_id, st.name, n.id
+	`, window.Seconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []ScoreNotice
+	for rows.Next() {
+		var n ScoreNotice
+		if err := rows.Scan(&n.ID, &n.UserID, &n.ChatID, &n.StudentID, &n.StudentName, &n.Category, &n.Points, &n.Comment); err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	return out, rows.Err()
+}
+
+// MarkScoreNoticesSent отмечает уведомления отправленными.
+func MarkScoreNoticesSent(ctx context.Context, database *sql.DB, ids []int64) error {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	_, err := database.ExecContext(ctx, `UPDATE score_notifications SET sent_at = NOW() WHERE id = ANY($1)`, pq.Array(ids))
+	return err
+}
+
+// PurgeScoreNotices удаляет отправленные уведомления старше olderThan.
+func PurgeScoreNotices(ctx context.Context, database *sql.DB, olderThan time.Duration) error {
+	ctx, cancel := ctxutil.WithDBTimeout(ctx)
+	defer cancel()
+	_, err := database.ExecContext(ctx, `
+		DELETE FROM score_notifications WHERE sent_at < NOW() - make_interval(secs => $1)
+	`, olderThan.Seconds())
+	return err
+}
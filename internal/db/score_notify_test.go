@@ -0,0 +1,81 @@
+//go:build testutil
+// +build testutil
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/models"
+	"github.com/Spok95/telegram-school-bot/internal/testutil/testdb"
+)
+
+func TestScoreNotices_QueueAndBatch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+	h, err := testdb.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	adminID := mustSeedUser(ctx, t, h.DB, "Учитель", models.Teacher, nil, nil)
+	stID := mustSeedUser(ctx, t, h.DB, "Ученик", models.Student, ptrInt64(5), ptrString("А"))
+	parentID := mustSeedUser(ctx, t, h.DB, "Родитель", models.Parent, nil, nil)
+	if _, err := h.DB.ExecContext(ctx, `INSERT INTO parents_students (parent_id, student_id) VALUES ($1, $2)`, parentID, stID); err != nil {
+		t.Fatal(err)
+	}
+	catID := int64(db.GetCategoryIDByName(ctx, h.DB, "Дежурство"))
+	add := func() {
+		t.Helper()
+		if err := db.AddScoreInstant(ctx, h.DB, models.Score{StudentID: stID, CategoryID: catID, Points: 100, Type: "add", CreatedBy: adminID}, adminID, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// пока никто не включил уведомления — очередь пуста
+	add()
+	due, err := db.DueScoreNotices(ctx, h.DB, time.Minute, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 0 {
+		t.Fatalf("уведомления без согласия: %+v", due)
+	}
+
+	if err := db.SetNotifyPref(ctx, h.DB, parentID, "scores", true); err != nil {
+		t.Fatal(err)
+	}
+	add()
+	add()
+	due, err = db.DueScoreNotices(ctx, h.DB, time.Minute, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 2 || due[0].UserID != parentID || due[0].Points != 100 {
+		t.Fatalf("ожидали два уведомления родителю, получили %+v", due)
+	}
+	if err := db.MarkScoreNoticesSent(ctx, h.DB, []int64{due[0].ID, due[1].ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	// в пределах окна новое начисление ждёт следующей пачки
+	add()
+	if due, err = db.DueScoreNotices(ctx, h.DB, time.Minute, 100); err != nil || len(due) != 0 {
+		t.Fatalf("внутри окна уведомлений быть не должно: %+v %v", due, err)
+	}
+	if due, err = db.DueScoreNotices(ctx, h.DB, 0, 100); err != nil || len(due) != 1 {
+		t.Fatalf("после окна ожидали одно уведомление: %+v %v", due, err)
+	}
+
+	// выключение очищает очередь
+	if err := db.SetNotifyPref(ctx, h.DB, parentID, "scores", false); err != nil {
+		t.Fatal(err)
+	}
+	if due, err = db.DueScoreNotices(ctx, h.DB, 0, 100); err != nil || len(due) != 0 {
+		t.Fatalf("после выключения очередь должна быть пуста: %+v %v", due, err)
+	}
+}
@@ -402,6 +402,38 @@ func DeactivateUser(ctx context.Context, database *sql.DB, userID int64, at time
 	return err
 }
 
+// DeactivateUserCascade деактивирует пользователя и пересчитывает активность его родителей
+// (связи есть только у учеников). Возвращает id родителей.
+func DeactivateUserCascade(ctx context.Context, database *sql.DB, userID int64, at time.Time) ([]int64, error) {
+	if err := DeactivateUser(ctx, database, userID, at); err != nil {
+		return nil, err
+	}
+	qctx, cancel := ctxutil.WithDBTimeout(ctx)
+	rows, err := database.QueryContext(qctx, `SELECT parent_id FROM parents_students WHERE student_id = $1`, userID)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	var parents []int64
+	for rows.Next() {
+		var pid int64
+		if err := rows.Scan(&pid); err != nil {
+			_ = rows.Close()
+			cancel()
+			return nil, err
+		}
+		parents = append(parents, pid)
+	}
+	_ = rows.Close()
+	cancel()
+	for _, pid := range parents {
+		if err := RefreshParentActiveFlag(ctx, database, pid); err != nil {
+			return parents, err
+		}
+	}
+	return parents, nil
+}
+
 // ActivateUser возвращает доступ (is_active=true), но deactivated_at не трогаем
 func ActivateUser(ctx context.Context, database *sql.DB, userID int64) error {
 	ctx, cancel := ctxutil.WithDBTimeout(ctx)
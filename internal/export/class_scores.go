@@ -0,0 +1,96 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Spok95/telegram-school-bot/internal/models"
+	"github.com/xuri/excelize/v2"
+)
+
+// ClassScoreRow — строка отчёта по классу: сумма баллов ученика и его вклад в коллективный рейтинг.
+type ClassScoreRow struct {
+	Student      string `json:"student"`
+	Class        string `json:"class"`
+	Total        int    `json:"total"`
+	Contribution int    `json:"contribution"`
+	Collective   int64  `json:"collective"`
+}
+
+// ClassScoreRows группирует подтверждённые баллы по ученикам, по алфавиту.
+func ClassScoreRows(scores []models.ScoreWithUser, collective int64) []ClassScoreRow {
+	byStudent := make(map[string]*ClassScoreRow)
+	for _, s := range scores {
+		r, ok := byStudent[s.StudentName]
+		if !ok {
+			r = &ClassScoreRow{
+				Student:    s.StudentName,
+				Class:      fmt.Sprintf("%d%s", s.ClassNumber, s.ClassLetter),
+				Collective: collective,
+			}
+			byStudent[s.StudentName] = r
+		}
+		r.Total += s.Points
+		// вклад посчитан по правилу категории при записи в журнал
+		r.Contribution += s.Collective
+	}
+	rows := make([]ClassScoreRow, 0, len(byStudent))
+	for _, r := range byStudent {
+		rows = append(rows, *r)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return strings.ToLower(rows[i].Student) < strings.ToLower(rows[j].Student)
+	})
+	return rows
+}
+
+// ClassScoresWorkbook — отчёт по классу в Excel, как в «📤 Экспорт».
+func ClassScoresWorkbook(rows []ClassScoreRow) (*excelize.File, error) {
+	f := excelize.NewFile()
+	sheet := "ClassReport"
+	if err := f.SetSheetName("Sheet1", sheet); err != nil {
+		return nil, err
+	}
+
+	headers := []string{"ФИО ученика", "Класс", "Суммарный балл", "Вклад в коллективный рейтинг", "Коллективный рейтинг класса"}
+	for i, h := range headers {
+		cell := fmt.Sprintf("%s1", string(rune('A'+i)))
+		if err := f.SetCellValue(sheet, cell, h); err != nil {
+			return nil, err
+		}
+	}
+	for i, r := range rows {
+		row := i + 2
+		_ = f.SetCellValue(sheet, fmt.Sprintf("A%d", row), r.Student)
+		_ = f.SetCellValue(sheet, fmt.Sprintf("B%d", row), r.Class)
+		_ = f.SetCellValue(sheet, fmt.Sprintf("C%d", row), r.Total)
+		_ = f.SetCellValue(sheet, fmt.Sprintf("D%d", row), r.Contribution)
+		_ = f.SetCellValue(sheet, fmt.Sprintf("E%d", row), r.Collective)
+	}
+
+	if err := ApplyDefaultExcelFormatting(f, sheet); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// WriteClassScoresCSV — тот же отчёт в CSV; заголовки — имена полей JSON, чтобы разбирать скриптами.
+func WriteClassScoresCSV(w io.Writer, rows []ClassScoreRow) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"student", "class", "total", "contribution", "collective"}); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		if err := cw.Write([]string{
+			r.Student, r.Class, strconv.Itoa(r.Total), strconv.Itoa(r.Contribution), strconv.FormatInt(r.Collective, 10),
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
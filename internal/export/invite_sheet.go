@@ -0,0 +1,91 @@
+package export
+
+import (
+	"fmt"
+
+	"github.com/skip2/go-qrcode"
+	"github.com/xuri/excelize/v2"
+)
+
+// InviteSheetRow — строка листа приглашений: кому код, сам код и ссылка для QR.
+type InviteSheetRow struct {
+	Name     string // ФИО ученика
+	Audience string // «Ученик» / «Родитель»
+	Code     string
+	Link     string // https://t.me/<бот>?start=<код>
+	Expires  string // «до 30.09.2026»
+}
+
+// qrPixels — сторона QR в пикселях; высота строки подогнана под неё.
+const qrPixels = 128
+
+// InviteQRSheet — печатный лист .xlsx для класса: по строке на код, QR-картинка в последней колонке.
+func InviteQRSheet(title string, rows []InviteSheetRow) ([]byte, error) {
+	f := excelize.NewFile()
+	defer func() { _ = f.Close() }()
+	const sheet = "Sheet1"
+	if r := []rune(title); len(r) > 31 { // лимит Excel на имя листа
+		title = string(r[:31])
+	}
+	if err := f.SetSheetName(sheet, title); err != nil {
+		return nil, fmt.Errorf("rename sheet: %w", err)
+	}
+
+	header := []string{"ФИО ученика", "Для кого", "Код", "Действует", "QR-код"}
+	if err := f.SetSheetRow(title, "A1", &header); err != nil {
+		return nil, err
+	}
+	bold, _ := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	_ = f.SetCellStyle(title, "A1", "E1", bold)
+	wrap, _ := f.NewStyle(&excelize.Style{
+		Alignment: &excelize.Alignment{Vertical: "center", WrapText: true},
+	})
+	codeStyle, _ := f.NewStyle(&excelize.Style{
+		Font:      &excelize.Font{Bold: true, Size: 14, Family: "Consolas"},
+		Alignment: &excelize.Alignment{Vertical: "center"},
+	})
+
+	for i, r := range rows {
+		n := i + 2
+		cells := []string{r.Name, r.Audience, r.Code, r.Expires}
+		if err := f.SetSheetRow(title, fmt.Sprintf("A%d", n), &cells); err != nil {
+			return nil, err
+		}
+		_ = f.SetCellStyle(title, fmt.Sprintf("A%d", n), fmt.Sprintf("D%d", n), wrap)
+		_ = f.SetCellStyle(title, fmt.Sprintf("C%d", n), fmt.Sprintf("C%d", n), codeStyle)
+		// 1 pt = 4/3 px
+		_ = f.SetRowHeight(title, n, float64(qrPixels)*0.75+6)
+
+		png, err := qrcode.Encode(r.Link, qrcode.Medium, qrPixels)
+		if err != nil {
+			return nil, fmt.Errorf("qr %s: %w", r.Code, err)
+		}
+		if err := f.AddPictureFromBytes(title, fmt.Sprintf("E%d", n), &excelize.Picture{
+			Extension:  ".png",
+			File:       png,
+			InsertType: excelize.PictureInsertTypePlaceOverCells,
+			Format:     &excelize.GraphicOptions{AltText: r.Link, OffsetX: 4, OffsetY: 4},
+		}); err != nil {
+			return nil, fmt.Errorf("qr picture: %w", err)
+		}
+	}
+
+	_ = f.SetColWidth(title, "A", "A", 34)
+	_ = f.SetColWidth(title, "B", "B", 12)
+	_ = f.SetColWidth(title, "C", "C", 16)
+	_ = f.SetColWidth(title, "D", "D", 16)
+	_ = f.SetColWidth(title, "E", "E", 20)
+	// печать: вся ширина на одной странице, заголовок повторяется на каждом листе
+	fitWidth, fitHeight, fitToPage := 1, 0, true
+	_ = f.SetSheetProps(title, &excelize.SheetPropsOptions{FitToPage: &fitToPage})
+	_ = f.SetPageLayout(title, &excelize.PageLayoutOptions{FitToWidth: &fitWidth, FitToHeight: &fitHeight})
+	_ = f.SetDefinedName(&excelize.DefinedName{
+		Name: "_xlnm.Print_Titles", RefersTo: fmt.Sprintf("'%s'!$1:$1", title), Scope: title,
+	})
+
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
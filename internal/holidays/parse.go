@@ -0,0 +1,280 @@
+// Package holidays — разбор календаря нерабочих дней школы из текста, CSV и iCal.
+package holidays
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+)
+
+// MaxFileSize — календарь на год занимает килобайты.
+const MaxFileSize = 1 << 20
+
+// MaxDays — больше дней за один раз не добавляем (защита от опечатки в годе).
+const MaxDays = 400
+
+var (
+	ErrUnsupported = errors.New("поддерживаются только файлы .ics и .csv")
+	ErrEmpty       = errors.New("в файле нет дат")
+	ErrTooManyDays = fmt.Errorf("больше %d дней за раз", MaxDays)
+	ErrBadRange    = errors.New("дата окончания раньше даты начала")
+)
+
+// Parse читает календарь из .ics (события VEVENT, обычно на весь день) или .csv
+// (строки «дата;название» или «с;по;название», разделитель «;» или «,»).
+func Parse(fileName string, r io.Reader) ([]db.Holiday, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxFileSize {
+		return nil, fmt.Errorf("файл больше %d МБ", MaxFileSize>>20)
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	var out []db.Holiday
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".ics":
+		out, err = parseICS(data)
+	case ".csv":
+		out, err = parseCSV(data)
+	default:
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, ErrEmpty
+	}
+	if len(out) > MaxDays {
+		return nil, ErrTooManyDays
+	}
+	return out, nil
+}
+
+// ParseLine разбирает ввод администратора: «04.11.2025 День народного единства»
+// или «30.12.2025-08.01.2026 Зимние каникулы». Название необязательно.
+func ParseLine(s string) ([]db.Holiday, error) {
+	s = strings.TrimSpace(s)
+	head, title, _ := strings.Cut(s, " ")
+	from, to, err := ParseRange(head)
+	if err != nil {
+		return nil, err
+	}
+	return expand(from, to, strings.TrimSpace(title))
+}
+
+// ParseRange разбирает «ДД.ММ.ГГГГ» или «ДД.ММ.ГГГГ-ДД.ММ.ГГГГ» (включительно).
+func ParseRange(s string) (time.Time, time.Time, error) {
+	s = strings.TrimSpace(s)
+	from, err := parseDate(s)
+	if err == nil {
+		return from, from, nil
+	}
+	// в «2006-01-02» тоже есть дефисы: ищем разрез, при котором обе части — даты
+	var to time.Time
+	found := false
+	for i := 0; i < len(s) && !found; i++ {
+		if s[i] != '-' {
+			continue
+		}
+		a, errA := parseDate(s[:i])
+		b, errB := parseDate(s[i+1:])
+		if errA == nil && errB == nil {
+			from, to, found = a, b, true
+		}
+	}
+	if !found {
+		return time.Time{}, time.Time{}, err
+	}
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, ErrBadRange
+	}
+	return from, to, nil
+}
+
+// parseDate принимает «02.01.2006» и «2006-01-02».
+func parseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{"02.01.2006", "2006-01-02"} {
+		if d, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return d, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("не удалось разобрать дату %q, ожидается ДД.ММ.ГГГГ", s)
+}
+
+// expand — по одному дню на каждую дату [from, to].
+func expand(from, to time.Time, title string) ([]db.Holiday, error) {
+	var out []db.Holiday
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		if len(out) == MaxDays {
+			return nil, ErrTooManyDays
+		}
+		out = append(out, db.Holiday{Day: d, Title: title})
+	}
+	return out, nil
+}
+
+func parseCSV(data []byte) ([]db.Holiday, error) {
+	first, _, _ := bytes.Cut(data, []byte("\n"))
+	cr := csv.NewReader(bytes.NewReader(data))
+	if bytes.Count(first, []byte(";")) >= bytes.Count(first, []byte(",")) {
+		cr.Comma = ';'
+	}
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать csv: %w", err)
+	}
+
+	var out []db.Holiday
+	for i, rec := range records {
+		cells := make([]string, 0, len(rec))
+		for _, c := range rec {
+			cells = append(cells, strings.TrimSpace(c))
+		}
+		if len(cells) == 0 || strings.Join(cells, "") == "" {
+			continue
+		}
+		from, to, err := ParseRange(cells[0])
+		if err != nil {
+			if len(out) == 0 && i == 0 {
+				continue // заголовок
+			}
+			return nil, fmt.Errorf("строка %d: %w", i+1, err)
+		}
+		title := ""
+		if len(cells) > 1 {
+			title = cells[1]
+		}
+		// «с;по;название»
+		if len(cells) > 2 {
+			if end, err := parseDate(cells[1]); err == nil {
+				if end.Before(from) {
+					return nil, fmt.Errorf("строка %d: %w", i+1, ErrBadRange)
+				}
+				to, title = end, cells[2]
+			}
+		}
+		days, err := expand(from, to, title)
+		if err != nil {
+			return nil, fmt.Errorf("строка %d: %w", i+1, err)
+		}
+		out = append(out, days...)
+	}
+	return out, nil
+}
+
+// parseICS берёт из VEVENT даты DTSTART/DTEND и SUMMARY. У событий на весь день
+// (VALUE=DATE) DTEND не входит в событие, как и требует RFC 5545.
+func parseICS(data []byte) ([]db.Holiday, error) {
+	var (
+		out     []db.Holiday
+		inEvent bool
+		start   icsDate
+		end     icsDate
+		summary string
+	)
+	for _, line := range unfold(data) {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		prop, _, _ := strings.Cut(name, ";")
+		switch strings.ToUpper(prop) {
+		case "BEGIN":
+			if strings.EqualFold(value, "VEVENT") {
+				inEvent, start, end, summary = true, icsDate{}, icsDate{}, ""
+			}
+		case "DTSTART":
+			if inEvent {
+				start = parseICSDate(value)
+			}
+		case "DTEND":
+			if inEvent {
+				end = parseICSDate(value)
+			}
+		case "SUMMARY":
+			if inEvent {
+				summary = unescapeICS(value)
+			}
+		case "END":
+			if !strings.EqualFold(value, "VEVENT") || !inEvent {
+				continue
+			}
+			inEvent = false
+			if start.day.IsZero() {
+				return nil, fmt.Errorf("событие %q без корректной даты начала", summary)
+			}
+			to := start.day
+			if !end.day.IsZero() {
+				to = end.day
+				// конец в полночь (или дата без времени) — этот день уже не входит
+				if end.midnight && to.After(start.day) {
+					to = to.AddDate(0, 0, -1)
+				}
+			}
+			if to.Before(start.day) {
+				return nil, fmt.Errorf("событие %q: %w", summary, ErrBadRange)
+			}
+			days, err := expand(start.day, to, summary)
+			if err != nil {
+				return nil, fmt.Errorf("событие %q: %w", summary, err)
+			}
+			out = append(out, days...)
+		}
+	}
+	return out, nil
+}
+
+type icsDate struct {
+	day      time.Time
+	midnight bool
+}
+
+// parseICSDate принимает «20251104» и «20251104T090000[Z]»; время дня отбрасывается.
+func parseICSDate(v string) icsDate {
+	v = strings.TrimSpace(v)
+	if len(v) < 8 {
+		return icsDate{}
+	}
+	d, err := time.ParseInLocation("20060102", v[:8], time.Local)
+	if err != nil {
+		return icsDate{}
+	}
+	clock := strings.TrimSuffix(strings.TrimPrefix(v[8:], "T"), "Z")
+	return icsDate{day: d, midnight: clock == "" || strings.Trim(clock, "0") == ""}
+}
+
+// unfold склеивает перенесённые строки iCal (продолжение начинается с пробела или табуляции).
+func unfold(data []byte) []string {
+	var lines []string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 0, 64*1024), MaxFileSize)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+var icsUnescaper = strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`)
+
+func unescapeICS(s string) string {
+	return strings.TrimSpace(icsUnescaper.Replace(s))
+}
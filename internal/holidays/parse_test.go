@@ -0,0 +1,90 @@
+package holidays
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+)
+
+func days(hs []db.Holiday) []string {
+	out := make([]string, 0, len(hs))
+	for _, h := range hs {
+		out = append(out, h.Day.Format("02.01")+" "+h.Title)
+	}
+	return out
+}
+
+func TestParseLine(t *testing.T) {
+	hs, err := ParseLine("30.12.2025-02.01.2026 Зимние каникулы")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(days(hs), "|")
+	want := "30.12 Зимние каникулы|31.12 Зимние каникулы|01.01 Зимние каникулы|02.01 Зимние каникулы"
+	if got != want {
+		t.Fatalf("получили %q, ожидали %q", got, want)
+	}
+
+	if _, err := ParseLine("05.11.2025-04.11.2025"); !errors.Is(err, ErrBadRange) {
+		t.Fatalf("ожидали ErrBadRange, получили %v", err)
+	}
+	if _, err := ParseLine("01.01.2025-01.01.2027"); !errors.Is(err, ErrTooManyDays) {
+		t.Fatalf("ожидали ErrTooManyDays, получили %v", err)
+	}
+}
+
+func TestParse_CSV(t *testing.T) {
+	data := "Дата;Название\n" +
+		"04.11.2025;День народного единства\n" +
+		";\n" +
+		"2026-03-23;2026-03-24;Весенние каникулы\n"
+	hs, err := Parse("holidays.csv", strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(days(hs), "|")
+	want := "04.11 День народного единства|23.03 Весенние каникулы|24.03 Весенние каникулы"
+	if got != want {
+		t.Fatalf("получили %q, ожидали %q", got, want)
+	}
+
+	if _, err := Parse("holidays.csv", strings.NewReader("04.11.2025;ok\nзавтра;нет\n")); err == nil ||
+		!strings.Contains(err.Error(), "строка 2") {
+		t.Fatalf("ожидали ошибку с номером строки, получили %v", err)
+	}
+}
+
+func TestParse_ICS(t *testing.T) {
+	data := "BEGIN:VCALENDAR\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"DTSTART;VALUE=DATE:20251104\r\n" +
+		"DTEND;VALUE=DATE:20251105\r\n" +
+		"SUMMARY:День народного\r\n" +
+		"  единства\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"DTSTART:20251229T000000\r\n" +
+		"DTEND:20251231T000000\r\n" +
+		"SUMMARY:Каникулы\\, зима\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"DTSTART;VALUE=DATE:20260308\r\n" +
+		"SUMMARY:8 Марта\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+	hs, err := Parse("calendar.ICS", strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(days(hs), "|")
+	want := "04.11 День народного единства|29.12 Каникулы, зима|30.12 Каникулы, зима|08.03 8 Марта"
+	if got != want {
+		t.Fatalf("получили %q, ожидали %q", got, want)
+	}
+
+	if _, err := Parse("calendar.txt", strings.NewReader(data)); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("ожидали ErrUnsupported, получили %v", err)
+	}
+}
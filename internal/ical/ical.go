@@ -0,0 +1,124 @@
+// Package ical — формирование календарей iCalendar (RFC 5545): вложения .ics
+// к записям на консультации и подписка на расписание.
+package ical
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Методы календаря (RFC 5546): приглашение, отмена и публикация ленты подписки.
+const (
+	MethodRequest = "REQUEST"
+	MethodCancel  = "CANCEL"
+	MethodPublish = "PUBLISH"
+)
+
+const prodID = "-//telegram-school-bot//consultations//RU"
+
+// Event — одно событие календаря. Start и End — моменты времени, в файл они
+// пишутся в UTC, поэтому часовой пояс телефона не важен.
+type Event struct {
+	UID         string
+	Sequence    int64
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Description string
+	Location    string
+	URL         string
+	Cancelled   bool
+}
+
+// Calendar — набор событий с методом и названием (для ленты подписки).
+type Calendar struct {
+	Method string
+	Name   string
+	Events []Event
+}
+
+// Bytes — календарь в формате .ics (строки через CRLF, длинные строки перенесены).
+func (c Calendar) Bytes(now time.Time) []byte {
+	var b bytes.Buffer
+	w := func(line string) { writeFolded(&b, line) }
+
+	w("BEGIN:VCALENDAR")
+	w("VERSION:2.0")
+	w("PRODID:" + prodID)
+	w("CALSCALE:GREGORIAN")
+	if c.Method != "" {
+		w("METHOD:" + c.Method)
+	}
+	if c.Name != "" {
+		w("X-WR-CALNAME:" + escape(c.Name))
+	}
+	stamp := formatUTC(now)
+	for _, e := range c.Events {
+		w("BEGIN:VEVENT")
+		w("UID:" + e.UID)
+		w("DTSTAMP:" + stamp)
+		w(fmt.Sprintf("SEQUENCE:%d", e.Sequence))
+		w("DTSTART:" + formatUTC(e.Start))
+		w("DTEND:" + formatUTC(e.End))
+		w("SUMMARY:" + escape(e.Summary))
+		if e.Description != "" {
+			w("DESCRIPTION:" + escape(e.Description))
+		}
+		if e.Location != "" {
+			w("LOCATION:" + escape(e.Location))
+		}
+		// URL пишется без экранирования: перевод строки в нём добавил бы в календарь свои строки
+		if ValidURL(e.URL) {
+			w("URL:" + e.URL)
+		}
+		if e.Cancelled {
+			w("STATUS:CANCELLED")
+		} else {
+			w("STATUS:CONFIRMED")
+		}
+		w("END:VEVENT")
+	}
+	w("END:VCALENDAR")
+	return b.Bytes()
+}
+
+// ValidURL — абсолютная ссылка http(s) без управляющих символов: такую можно
+// записать в свойство URL как есть.
+func ValidURL(s string) bool {
+	if s == "" || strings.IndexFunc(s, unicode.IsControl) >= 0 {
+		return false
+	}
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func formatUTC(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func escape(s string) string { return escaper.Replace(s) }
+
+// writeFolded пишет строку, перенося её каждые 75 октетов (не разрывая символы UTF-8).
+func writeFolded(b *bytes.Buffer, line string) {
+	const limit = 75
+	width := limit
+	for len(line) > width {
+		cut := width
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		width = limit - 1 // пробел в начале продолжения тоже считается
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
@@ -0,0 +1,63 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCalendarBytes(t *testing.T) {
+	msk := time.FixedZone("MSK", 3*3600)
+	start := time.Date(2025, 11, 5, 16, 0, 0, 0, msk)
+	cal := Calendar{Method: MethodCancel, Events: []Event{{
+		UID:       "consult-slot-42@telegram-school-bot",
+		Sequence:  7,
+		Start:     start,
+		End:       start.Add(20 * time.Minute),
+		Summary:   "Консультация: Иванова; 5А, математика",
+		Cancelled: true,
+	}}}
+	out := string(cal.Bytes(start))
+
+	for _, want := range []string{
+		"METHOD:CANCEL\r\n",
+		"UID:consult-slot-42@telegram-school-bot\r\n",
+		"SEQUENCE:7\r\n",
+		"DTSTART:20251105T130000Z\r\n",
+		"DTEND:20251105T132000Z\r\n",
+		"STATUS:CANCELLED\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("нет строки %q в\n%s", want, out)
+		}
+	}
+	// длинные строки переносятся, текст экранируется
+	unfolded := strings.ReplaceAll(out, "\r\n ", "")
+	if !strings.Contains(unfolded, `SUMMARY:Консультация: Иванова\; 5А\, математика`) {
+		t.Errorf("неверный SUMMARY:\n%s", unfolded)
+	}
+	for _, line := range strings.Split(out, "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("строка длиннее 75 октетов: %q", line)
+		}
+	}
+}
+
+func TestValidURL(t *testing.T) {
+	for _, ok := range []string{"https://meet.example/abc", "http://zoom.us/j/1?pwd=x"} {
+		if !ValidURL(ok) {
+			t.Errorf("%q должна приниматься", ok)
+		}
+	}
+	for _, bad := range []string{"", "meet.example/abc", "javascript:alert(1)", "https://a.example/x\r\nATTENDEE:x", "https://a.example/\tx", "https://"} {
+		if ValidURL(bad) {
+			t.Errorf("%q должна отклоняться", bad)
+		}
+	}
+
+	start := time.Date(2025, 11, 5, 13, 0, 0, 0, time.UTC)
+	cal := Calendar{Events: []Event{{UID: "x", Start: start, End: start, Summary: "s", URL: "https://a.example/\r\nATTENDEE:x"}}}
+	if out := string(cal.Bytes(start)); strings.Contains(out, "ATTENDEE") {
+		t.Fatalf("управляющие символы из URL попали в календарь:\n%s", out)
+	}
+}
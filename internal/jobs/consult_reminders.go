@@ -9,6 +9,7 @@ import (
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 
 	"github.com/Spok95/telegram-school-bot/internal/app"
+	"github.com/Spok95/telegram-school-bot/internal/bot/handlers"
 	"github.com/Spok95/telegram-school-bot/internal/db"
 	"github.com/Spok95/telegram-school-bot/internal/observability"
 )
@@ -26,6 +27,10 @@ func runEvery(ctx context.Context, d time.Duration, fn func(context.Context)) {
 		case <-ctx.Done():
 			return
 		case <-t.C:
+			// напоминания пишут в outbox — во время восстановления БД ждём
+			if handlers.RestoreInProgress() {
+				continue
+			}
 			func() {
 				defer func() {
 					if r := recover(); r != nil {
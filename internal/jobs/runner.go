@@ -8,11 +8,16 @@ import (
 type Job func(ctx context.Context) error
 
 type Runner struct {
-	ctx context.Context
+	ctx  context.Context
+	skip func() bool
 }
 
 func New(ctx context.Context) *Runner { return &Runner{ctx: ctx} }
 
+// SkipWhile — пока fn возвращает true, задачи пропускают запуски (например, во время восстановления БД).
+// Вызывается до первого Every.
+func (r *Runner) SkipWhile(fn func() bool) { r.skip = fn }
+
 func (r *Runner) Every(interval time.Duration, name string, fn Job) {
 	go func() {
 		t := time.NewTicker(interval)
@@ -22,6 +27,9 @@ func (r *Runner) Every(interval time.Duration, name string, fn Job) {
 			case <-r.ctx.Done():
 				return
 			case <-t.C:
+				if r.skip != nil && r.skip() {
+					continue
+				}
 				start := time.Now()
 				if err := fn(r.ctx); err != nil {
 					jobErrors.WithLabelValues(name).Inc()
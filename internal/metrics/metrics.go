@@ -31,6 +31,55 @@ var (
 		Name: "tg_updates_dropped_ratelimit_total",
 		Help: "Updates dropped by per-chat rate limiter",
 	})
+	FSMStoreErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "schoolbot", Name: "fsm_store_errors_total",
+		Help: "Errors while persisting conversation FSM state",
+	})
+	WebhookRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "schoolbot", Name: "webhook_requests_total",
+		Help: "Telegram webhook requests by result",
+	}, []string{"result"})
+
+	CallbackRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "schoolbot", Name: "callback_rejected_total",
+		Help: "Inline callbacks rejected by signature check (unsigned|forged|expired|too_long)",
+	}, []string{"reason"})
+
+	UpdatePoolQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "schoolbot", Name: "update_pool_queue_depth",
+		Help: "Updates accepted by the worker pool and not yet processed",
+	})
+	UpdatePoolBusy = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "schoolbot", Name: "update_pool_busy_workers",
+		Help: "Workers currently processing an update",
+	})
+	UpdatePoolWait = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "schoolbot", Name: "update_pool_wait_seconds",
+		Help:    "Time an update spent in the queue before processing",
+		Buckets: prometheus.DefBuckets,
+	})
+	UpdatePoolBackpressure = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "schoolbot", Name: "update_pool_backpressure_total",
+		Help: "Submits that had to wait because the queue was full",
+	})
+	UpdatePoolDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "schoolbot", Name: "update_pool_dropped_total",
+		Help: "Updates not accepted by the worker pool (shutdown)",
+	})
+
+	OutboxDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "schoolbot", Name: "outbox_depth",
+		Help: "Outgoing messages in the outbox by state (due|delayed|failed_24h)",
+	}, []string{"state"})
+	OutboxSends = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "schoolbot", Name: "outbox_sends_total",
+		Help: "Outbox delivery attempts by result (sent|retry|rate_limited|blocked|failed)",
+	}, []string{"result"})
+	OutboxLag = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "schoolbot", Name: "outbox_send_lag_seconds",
+		Help:    "Delay between the planned send time and the actual delivery",
+		Buckets: []float64{0.1, 0.5, 1, 2, 5, 10, 30, 60, 300},
+	})
 )
 
 func init() {
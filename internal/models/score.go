@@ -19,18 +19,21 @@ type Score struct {
 }
 
 type Category struct {
-	ID       int    `db:"id"`
-	Name     string `db:"name"`
-	Label    string `db:"label"`
-	IsActive bool   `db:"is_active"`
+	ID                int    `db:"id"`
+	Name              string `db:"name"`
+	Label             string `db:"label"`
+	IsActive          bool   `db:"is_active"`
+	AffectsCollective bool   `db:"affects_collective"`
+	CollectivePercent int    `db:"collective_percent"`
 }
 
 type ScoreLevel struct {
-	ID         int    `db:"id"`
-	Value      int    `db:"value"`
-	Label      string `db:"label"`
-	CategoryID int    `db:"category_id"`
-	IsActive   bool   `db:"is_active"`
+	ID                int    `db:"id"`
+	Value             int    `db:"value"`
+	Label             string `db:"label"`
+	CategoryID        int    `db:"category_id"`
+	IsActive          bool   `db:"is_active"`
+	CollectivePercent *int   `db:"collective_percent"` // nil — как у категории
 }
 
 type ScoreWithUser struct {
@@ -51,4 +54,5 @@ type ScoreWithUser struct {
 	ClassNumber   int        `db:"class_number"`
 	ClassLetter   string     `db:"class_letter"`
 	AddedByName   string     `db:"added_by_name"`
+	Collective    int        `db:"collective"` // вклад в коллективный рейтинг класса
 }
@@ -0,0 +1,72 @@
+// Package notify — уведомления, которые бот шлёт сам, без действия пользователя:
+// напоминания о консультациях, заявки на баллы, регистрацию и привязку детей для администрации,
+// изменения и исправления баллов, начало учебного года. Каждый тип можно выключить в «⚙️ Настройки», а сообщения,
+// пришедшие на тихие часы, откладываются и уходят после их окончания.
+// Сами сообщения отправляет очередь internal/outbox — с повторами и лимитами Telegram.
+package notify
+
+import "github.com/Spok95/telegram-school-bot/internal/models"
+
+// Kind — тип уведомления; значение хранится в notify_prefs.kind.
+type Kind string
+
+const (
+	Scores           Kind = "scores"            // изменения баллов ученика
+	ScoreRequests    Kind = "score_requests"    // новые заявки на начисление/списание
+	ScoreFixes       Kind = "score_fixes"       // исправление или отмена начисления автора
+	AuthRequests     Kind = "auth_requests"     // новые заявки на регистрацию
+	ParentLinks      Kind = "parent_links"      // новые заявки на привязку ребёнка
+	ConsultReminders Kind = "consult_reminders" // напоминания о консультациях
+	SchoolYear       Kind = "school_year"       // начало учебного года
+)
+
+// KindInfo — как тип показан в настройках и кому он приходит.
+type KindInfo struct {
+	Kind    Kind
+	Title   string
+	Roles   []models.Role
+	Default bool // включён, пока пользователь не менял настройку
+}
+
+var kinds = []KindInfo{
+	{Scores, "Изменения баллов", []models.Role{models.Student, models.Parent}, false},
+	{ScoreRequests, "Новые заявки на баллы", []models.Role{models.Admin, models.Administration}, true},
+	{ScoreFixes, "Исправления моих начислений", []models.Role{models.Teacher, models.Admin, models.Administration}, true},
+	{AuthRequests, "Заявки на регистрацию", []models.Role{models.Admin}, true},
+	{ParentLinks, "Заявки на привязку детей", []models.Role{models.Admin}, true},
+	{ConsultReminders, "Напоминания о консультациях", []models.Role{models.Parent, models.Teacher}, true},
+	{SchoolYear, "Начало учебного года", []models.Role{models.Admin, models.Administration}, true},
+}
+
+// KindsFor — типы уведомлений, которые получает роль, в порядке показа.
+func KindsFor(role models.Role) []KindInfo {
+	var out []KindInfo
+	for _, k := range kinds {
+		for _, r := range k.Roles {
+			if r == role {
+				out = append(out, k)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// Lookup — описание типа; ok=false для неизвестного.
+func Lookup(kind Kind) (KindInfo, bool) {
+	for _, k := range kinds {
+		if k.Kind == kind {
+			return k, true
+		}
+	}
+	return KindInfo{}, false
+}
+
+// Enabled — включён ли тип с учётом явных настроек пользователя.
+func Enabled(prefs map[string]bool, kind Kind) bool {
+	if on, ok := prefs[string(kind)]; ok {
+		return on
+	}
+	info, _ := Lookup(kind)
+	return info.Default
+}
@@ -0,0 +1,85 @@
+package notify
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QuietHours — интервал [From, To) в минутах от полуночи по времени школы.
+// From > To — интервал через полночь (22:00–07:00); From == To — тихих часов нет.
+type QuietHours struct {
+	From, To int
+}
+
+// Enabled — заданы ли тихие часы.
+func (q QuietHours) Enabled() bool { return q.From != q.To }
+
+// Contains — попадает ли момент t (уже в часовом поясе школы) в тихие часы.
+func (q QuietHours) Contains(t time.Time) bool {
+	if !q.Enabled() {
+		return false
+	}
+	m := t.Hour()*60 + t.Minute()
+	if q.From < q.To {
+		return m >= q.From && m < q.To
+	}
+	return m >= q.From || m < q.To
+}
+
+// End — когда закончатся тихие часы, начавшиеся не позже t. Вызывается, только если Contains(t).
+func (q QuietHours) End(t time.Time) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	end := day.Add(time.Duration(q.To) * time.Minute)
+	if !end.After(t) {
+		end = day.AddDate(0, 0, 1).Add(time.Duration(q.To) * time.Minute)
+	}
+	return end
+}
+
+// String — «22:00–07:00» или «выключены».
+func (q QuietHours) String() string {
+	if !q.Enabled() {
+		return "выключены"
+	}
+	return fmtMinute(q.From) + "–" + fmtMinute(q.To)
+}
+
+// ParseQuietHours разбирает «22:00-07:00» (допускаются «–» и пробелы).
+func ParseQuietHours(s string) (QuietHours, error) {
+	s = strings.ReplaceAll(strings.ReplaceAll(s, "–", "-"), "—", "-")
+	parts := strings.Split(strings.ReplaceAll(s, " ", ""), "-")
+	if len(parts) != 2 {
+		return QuietHours{}, fmt.Errorf("ожидали ЧЧ:ММ-ЧЧ:ММ")
+	}
+	from, err := parseMinute(parts[0])
+	if err != nil {
+		return QuietHours{}, err
+	}
+	to, err := parseMinute(parts[1])
+	if err != nil {
+		return QuietHours{}, err
+	}
+	if from == to {
+		return QuietHours{}, fmt.Errorf("начало и конец совпадают")
+	}
+	return QuietHours{From: from, To: to}, nil
+}
+
+func parseMinute(s string) (int, error) {
+	hh, mm, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, fmt.Errorf("время %q: ожидали ЧЧ:ММ", s)
+	}
+	h, err1 := strconv.Atoi(hh)
+	m, err2 := strconv.Atoi(mm)
+	if err1 != nil || err2 != nil || h < 0 || h > 23 || m < 0 || m > 59 {
+		return 0, fmt.Errorf("время %q: ожидали ЧЧ:ММ", s)
+	}
+	return h*60 + m, nil
+}
+
+func fmtMinute(m int) string {
+	return fmt.Sprintf("%02d:%02d", m/60, m%60)
+}
@@ -0,0 +1,71 @@
+package notify
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/models"
+)
+
+func at(h, m int) time.Time {
+	return time.Date(2025, 3, 10, h, m, 0, 0, time.UTC)
+}
+
+func TestQuietHours_OverMidnight(t *testing.T) {
+	q := QuietHours{From: 22 * 60, To: 7 * 60}
+	for _, c := range []struct {
+		t     time.Time
+		quiet bool
+	}{
+		{at(21, 59), false}, {at(22, 0), true}, {at(23, 30), true},
+		{at(3, 0), true}, {at(6, 59), true}, {at(7, 0), false}, {at(12, 0), false},
+	} {
+		if got := q.Contains(c.t); got != c.quiet {
+			t.Errorf("%s: ожидали тихо=%v", c.t.Format("15:04"), c.quiet)
+		}
+	}
+	if got := q.End(at(23, 0)); !got.Equal(time.Date(2025, 3, 11, 7, 0, 0, 0, time.UTC)) {
+		t.Errorf("вечером тихие часы кончаются завтра в 07:00, получили %s", got)
+	}
+	if got := q.End(at(3, 0)); !got.Equal(at(7, 0)) {
+		t.Errorf("ночью тихие часы кончаются сегодня в 07:00, получили %s", got)
+	}
+}
+
+func TestQuietHours_SameDayAndDisabled(t *testing.T) {
+	q := QuietHours{From: 13 * 60, To: 15 * 60}
+	if !q.Contains(at(14, 0)) || q.Contains(at(15, 0)) || q.Contains(at(9, 0)) {
+		t.Fatal("дневной интервал считается неверно")
+	}
+	if (QuietHours{}).Contains(at(3, 0)) {
+		t.Fatal("выключенные тихие часы ничего не задерживают")
+	}
+}
+
+func TestParseQuietHours(t *testing.T) {
+	q, err := ParseQuietHours(" 22:30 – 7:05 ")
+	if err != nil || q.From != 22*60+30 || q.To != 7*60+5 {
+		t.Fatalf("получили %+v, %v", q, err)
+	}
+	if q.String() != "22:30–07:05" {
+		t.Errorf("формат: %q", q.String())
+	}
+	for _, bad := range []string{"", "22:00", "25:00-07:00", "22:00-22:00", "aa:bb-07:00"} {
+		if _, err := ParseQuietHours(bad); err == nil {
+			t.Errorf("%q должно быть ошибкой", bad)
+		}
+	}
+}
+
+func TestKindsFor(t *testing.T) {
+	got := KindsFor(models.Parent)
+	if len(got) != 2 || got[0].Kind != Scores || got[1].Kind != ConsultReminders {
+		t.Fatalf("типы родителя: %+v", got)
+	}
+	if Enabled(nil, Scores) || !Enabled(nil, ScoreRequests) {
+		t.Fatal("значения по умолчанию: баллы — выкл, заявки — вкл")
+	}
+	if !Enabled(map[string]bool{"scores": true}, Scores) {
+		t.Fatal("явная настройка важнее значения по умолчанию")
+	}
+}
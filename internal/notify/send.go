@@ -0,0 +1,71 @@
+package notify
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/outbox"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+var (
+	locMu sync.RWMutex
+	loc   = time.Local
+)
+
+// Init задаёт часовой пояс школы, в котором считаются тихие часы.
+func Init(location *time.Location) {
+	if location == nil {
+		return
+	}
+	locMu.Lock()
+	loc = location
+	locMu.Unlock()
+}
+
+func schoolNow() time.Time {
+	locMu.RLock()
+	defer locMu.RUnlock()
+	return time.Now().In(loc)
+}
+
+// NotBefore — когда можно отправить сообщение с учётом тихих часов q:
+// нулевое время, если сейчас не тихие часы, иначе их окончание.
+func NotBefore(q QuietHours) time.Time {
+	if now := schoolNow(); q.Contains(now) {
+		return q.End(now)
+	}
+	return time.Time{}
+}
+
+// Send ставит уведомление типа kind в очередь отправки (internal/outbox) с учётом
+// настроек получателя: выключенный тип не отправляется, в тихие часы сообщение
+// уходит после их окончания. Чаты без пользователя в БД (например, админы из ADMIN_IDS)
+// получают сообщение без этих проверок.
+func Send(ctx context.Context, database *sql.DB, chatID int64, kind Kind, text string) error {
+	return SendMarkup(ctx, database, chatID, kind, text, nil)
+}
+
+// SendMarkup — как Send, с inline-кнопками под сообщением.
+func SendMarkup(ctx context.Context, database *sql.DB, chatID int64, kind Kind, text string, markup *tgbotapi.InlineKeyboardMarkup) error {
+	m := outbox.Message{ChatID: chatID, Kind: string(kind), Text: text, Markup: markup}
+	u, err := db.GetUserByTelegramID(ctx, database, chatID)
+	if err != nil {
+		return err
+	}
+	if u != nil {
+		s, err := db.GetNotifySettings(ctx, database, u.ID)
+		if err != nil {
+			return err
+		}
+		if !Enabled(s.Prefs, kind) {
+			return nil
+		}
+		m.UserID = u.ID
+		m.NotBefore = NotBefore(QuietHours{From: s.QuietFrom, To: s.QuietTo})
+	}
+	return outbox.Enqueue(ctx, database, m)
+}
@@ -0,0 +1,56 @@
+package outbox
+
+import (
+	"sync"
+	"time"
+)
+
+// limiter раздаёт время отправки так, чтобы не выйти за лимиты Telegram:
+// не больше одного сообщения за global на весь бот (≈30 в секунду)
+// и одного за perChat в один чат (≈1 в секунду).
+type limiter struct {
+	mu      sync.Mutex
+	global  time.Duration
+	perChat time.Duration
+	next    time.Time
+	chats   map[int64]time.Time
+}
+
+func newLimiter(global, perChat time.Duration) *limiter {
+	return &limiter{global: global, perChat: perChat, chats: map[int64]time.Time{}}
+}
+
+// reserve занимает ближайшее свободное время отправки в чат и возвращает его.
+func (l *limiter) reserve(chatID int64, now time.Time) time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	at := now
+	if l.next.After(at) {
+		at = l.next
+	}
+	if c := l.chats[chatID]; c.After(at) {
+		at = c
+	}
+	l.next = at.Add(l.global)
+	l.chats[chatID] = at.Add(l.perChat)
+
+	// старые записи о чатах не нужны: их время уже прошло
+	if len(l.chats) > 1024 {
+		for id, t := range l.chats {
+			if t.Before(now) {
+				delete(l.chats, id)
+			}
+		}
+	}
+	return at
+}
+
+// pause — Telegram вернул retry_after: до until не отправляем ничего.
+func (l *limiter) pause(until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until.After(l.next) {
+		l.next = until
+	}
+}
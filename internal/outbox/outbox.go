@@ -0,0 +1,73 @@
+// Package outbox — очередь исходящих сообщений в таблице outbox и отправитель,
+// который разбирает её с учётом лимитов Telegram. Уведомления и рассылки не
+// отправляются напрямую: при 429, сбое сети или рестарте они не теряются,
+// а повторяются с нарастающей паузой. Ответы на действия пользователя
+// (перерисовка меню, подсказки FSM) по-прежнему идут напрямую через tg.Send.
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Message — сообщение для постановки в очередь.
+type Message struct {
+	ChatID    int64
+	UserID    int64  // получатель в БД, если известен (для настроек и блокировки)
+	Kind      string // тип для отчётов и настроек (см. notify.Kind)
+	Text      string
+	Markup    *tgbotapi.InlineKeyboardMarkup
+	NotBefore time.Time // нулевое — как можно скорее
+}
+
+// Enqueue ставит сообщение в очередь. Чатам, заблокировавшим бота, сообщение не ставится.
+func Enqueue(ctx context.Context, database *sql.DB, m Message) error {
+	row := db.OutboxMessage{
+		ChatID:    m.ChatID,
+		UserID:    m.UserID,
+		Kind:      m.Kind,
+		Text:      m.Text,
+		NotBefore: m.NotBefore,
+	}
+	if m.Markup != nil {
+		b, err := json.Marshal(m.Markup)
+		if err != nil {
+			return err
+		}
+		row.ReplyMarkup = string(b)
+	}
+	_, err := db.EnqueueOutbox(ctx, database, row)
+	return err
+}
+
+// chattable — сообщение из очереди в виде запроса к Bot API.
+func chattable(m db.OutboxMessage) (tgbotapi.Chattable, error) {
+	var markup any
+	if m.ReplyMarkup != "" {
+		var mk tgbotapi.InlineKeyboardMarkup
+		if err := json.Unmarshal([]byte(m.ReplyMarkup), &mk); err != nil {
+			return nil, err
+		}
+		markup = mk
+	}
+	switch m.AttachmentType {
+	case "photo":
+		p := tgbotapi.NewPhoto(m.ChatID, tgbotapi.FileID(m.AttachmentFileID))
+		p.Caption = m.Text
+		p.ReplyMarkup = markup
+		return p, nil
+	case "document":
+		d := tgbotapi.NewDocument(m.ChatID, tgbotapi.FileID(m.AttachmentFileID))
+		d.Caption = m.Text
+		d.ReplyMarkup = markup
+		return d, nil
+	}
+	msg := tgbotapi.NewMessage(m.ChatID, m.Text)
+	msg.ReplyMarkup = markup
+	return msg, nil
+}
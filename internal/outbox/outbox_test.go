@@ -0,0 +1,67 @@
+package outbox
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestLimiter_GlobalAndPerChat(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := newLimiter(40*time.Millisecond, time.Second)
+
+	// разные чаты — с шагом глобального лимита
+	if got := l.reserve(1, now); !got.Equal(now) {
+		t.Fatalf("первое сообщение сразу, получили %s", got.Sub(now))
+	}
+	if got := l.reserve(2, now); got.Sub(now) != 40*time.Millisecond {
+		t.Fatalf("второй чат ждёт глобальный шаг, получили %s", got.Sub(now))
+	}
+	// тот же чат — не раньше чем через секунду
+	if got := l.reserve(1, now); got.Sub(now) != time.Second {
+		t.Fatalf("повтор в чат ждёт секунду, получили %s", got.Sub(now))
+	}
+
+	// retry_after останавливает все отправки
+	l.pause(now.Add(5 * time.Second))
+	if got := l.reserve(3, now); got.Sub(now) != 5*time.Second {
+		t.Fatalf("после паузы ждём retry_after, получили %s", got.Sub(now))
+	}
+}
+
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		err  error
+		want outcome
+		wait time.Duration
+	}{
+		{&tgbotapi.Error{Code: 429, Message: "Too Many Requests", ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 7}}, rateLimited, 7 * time.Second},
+		{&tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"}, blocked, 0},
+		{&tgbotapi.Error{Code: 400, Message: "Bad Request: chat not found"}, permanent, 0},
+		{&tgbotapi.Error{Code: 502, Message: "Bad Gateway"}, retryLater, 0},
+		{errors.New("dial tcp: i/o timeout"), retryLater, 0},
+		{fmt.Errorf("%w: слишком длинно", callback.ErrTooLong), permanent, 0},
+	}
+	for _, c := range cases {
+		got, wait := classify(c.err)
+		if got != c.want || wait != c.wait {
+			t.Errorf("%v: получили %d/%s, ожидали %d/%s", c.err, got, wait, c.want, c.wait)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	want := []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second}
+	for i, w := range want {
+		if got := backoff(i + 1); got != w {
+			t.Errorf("попытка %d: %s, ожидали %s", i+1, got, w)
+		}
+	}
+	if got := backoff(30); got != 30*time.Minute {
+		t.Errorf("пауза ограничена 30 минутами, получили %s", got)
+	}
+}
@@ -0,0 +1,60 @@
+package outbox
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// outcome — что делать с сообщением после неудачной отправки.
+type outcome int
+
+const (
+	retryLater  outcome = iota // сеть, 5xx — повторить с backoff
+	rateLimited                // 429 — подождать retry_after, попытка не засчитывается
+	blocked                    // 403 — пользователь заблокировал бота
+	permanent                  // 400 и прочее, что повтором не исправить
+)
+
+// classify разбирает ошибку отправки. Для 429 возвращает, сколько ждать.
+func classify(err error) (outcome, time.Duration) {
+	if errors.Is(err, callback.ErrTooLong) {
+		return permanent, 0
+	}
+	var tgErr *tgbotapi.Error
+	if !errors.As(err, &tgErr) {
+		return retryLater, 0
+	}
+	switch {
+	case tgErr.Code == 429 || tgErr.RetryAfter > 0:
+		wait := time.Duration(tgErr.RetryAfter) * time.Second
+		if wait <= 0 {
+			wait = time.Second
+		}
+		return rateLimited, wait
+	case tgErr.Code == 403:
+		return blocked, 0
+	case tgErr.Code >= 400 && tgErr.Code < 500:
+		return permanent, 0
+	default:
+		return retryLater, 0
+	}
+}
+
+// backoff — пауза перед попыткой номер attempt+1: 5с, 10с, 20с… но не больше maxBackoff.
+func backoff(attempt int) time.Duration {
+	const (
+		base       = 5 * time.Second
+		maxBackoff = 30 * time.Minute
+	)
+	d := base
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if d >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return d
+}
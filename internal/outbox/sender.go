@@ -0,0 +1,147 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/metrics"
+	"github.com/Spok95/telegram-school-bot/internal/tg"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	batchSize    = 50
+	lease        = 2 * time.Minute  // сколько сообщение считается «в работе» после выборки
+	maxWait      = 2 * time.Second  // дольше не ждём очереди в чат — откладываем в БД
+	idlePoll     = time.Second      // как часто смотрим в пустую очередь
+	statsRefresh = 15 * time.Second // как часто обновляем метрики глубины очереди
+)
+
+// Config — лимиты отправителя.
+type Config struct {
+	RatePerSec  int           // сообщений в секунду на весь бот (лимит Telegram — 30)
+	ChatGap     time.Duration // пауза между сообщениями в один чат (лимит Telegram — около секунды)
+	MaxAttempts int           // после стольких неудачных попыток сообщение считается недоставленным
+}
+
+// Sender разбирает очередь outbox.
+type Sender struct {
+	bot      *tgbotapi.BotAPI
+	database *sql.DB
+	cfg      Config
+	lim      *limiter
+}
+
+func NewSender(bot *tgbotapi.BotAPI, database *sql.DB, cfg Config) *Sender {
+	if cfg.RatePerSec <= 0 {
+		cfg.RatePerSec = 25
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 8
+	}
+	return &Sender{
+		bot:      bot,
+		database: database,
+		cfg:      cfg,
+		lim:      newLimiter(time.Second/time.Duration(cfg.RatePerSec), cfg.ChatGap),
+	}
+}
+
+// Run отправляет сообщения, пока не отменён ctx.
+func (s *Sender) Run(ctx context.Context) {
+	var statsAt time.Time
+	for {
+		if time.Since(statsAt) >= statsRefresh {
+			s.refreshStats(ctx)
+			statsAt = time.Now()
+		}
+		msgs, err := db.ClaimOutbox(ctx, s.database, batchSize, lease)
+		if err != nil {
+			log.Printf("outbox: claim: %v", err)
+		}
+		for _, m := range msgs {
+			if !s.deliver(ctx, m) {
+				return
+			}
+		}
+		if len(msgs) == batchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(idlePoll):
+		}
+	}
+}
+
+// deliver отправляет одно сообщение с учётом лимитов; false — ctx отменён.
+func (s *Sender) deliver(ctx context.Context, m db.OutboxMessage) bool {
+	now := time.Now()
+	at := s.lim.reserve(m.ChatID, now)
+	if wait := at.Sub(now); wait > maxWait {
+		// в этот чат уже много отправлено — не держим остальную очередь
+		s.check(db.RetryOutbox(ctx, s.database, m.ID, at, false, ""))
+		return true
+	} else if wait > 0 {
+		select {
+		case <-ctx.Done():
+			return false // сообщение вернётся в очередь по истечении lease
+		case <-time.After(wait):
+		}
+	}
+
+	msg, err := chattable(m)
+	if err == nil {
+		_, err = tg.Send(s.bot, msg)
+	}
+	if err == nil {
+		metrics.OutboxSends.WithLabelValues("sent").Inc()
+		metrics.OutboxLag.Observe(time.Since(m.NotBefore).Seconds())
+		s.check(db.MarkOutboxSent(ctx, s.database, []int64{m.ID}))
+		return true
+	}
+
+	switch outcome, retryAfter := classify(err); outcome {
+	case rateLimited:
+		metrics.OutboxSends.WithLabelValues("rate_limited").Inc()
+		until := time.Now().Add(retryAfter)
+		s.lim.pause(until)
+		s.check(db.RetryOutbox(ctx, s.database, m.ID, until, false, err.Error()))
+	case blocked:
+		metrics.OutboxSends.WithLabelValues("blocked").Inc()
+		s.check(db.MarkChatBlocked(ctx, s.database, m.ChatID, err.Error()))
+	case permanent:
+		metrics.OutboxSends.WithLabelValues("failed").Inc()
+		s.check(db.FailOutbox(ctx, s.database, m.ID, err.Error()))
+	default:
+		if m.Attempts+1 >= s.cfg.MaxAttempts {
+			metrics.OutboxSends.WithLabelValues("failed").Inc()
+			s.check(db.FailOutbox(ctx, s.database, m.ID, err.Error()))
+			break
+		}
+		metrics.OutboxSends.WithLabelValues("retry").Inc()
+		s.check(db.RetryOutbox(ctx, s.database, m.ID, time.Now().Add(backoff(m.Attempts+1)), true, err.Error()))
+	}
+	return true
+}
+
+func (s *Sender) refreshStats(ctx context.Context) {
+	due, delayed, failed, err := db.OutboxStats(ctx, s.database)
+	if err != nil {
+		log.Printf("outbox: stats: %v", err)
+		return
+	}
+	metrics.OutboxDepth.WithLabelValues("due").Set(float64(due))
+	metrics.OutboxDepth.WithLabelValues("delayed").Set(float64(delayed))
+	metrics.OutboxDepth.WithLabelValues("failed_24h").Set(float64(failed))
+}
+
+func (s *Sender) check(err error) {
+	if err != nil {
+		log.Printf("outbox: %v", err)
+	}
+}
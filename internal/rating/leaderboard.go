@@ -0,0 +1,142 @@
+package rating
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Как ученик показан в рейтинге другим ученикам и родителям.
+const (
+	DisplayFull     = "full"     // ФИО полностью
+	DisplayInitials = "initials" // только инициалы
+	DisplayHidden   = "hidden"   // не участвует в рейтинге
+)
+
+// ValidDisplay — допустимое значение режима показа.
+func ValidDisplay(mode string) bool {
+	return mode == DisplayFull || mode == DisplayInitials || mode == DisplayHidden
+}
+
+// Standing — ученик и сумма его баллов за выбранный срок.
+type Standing struct {
+	StudentID   int64
+	Name        string
+	ClassNumber int64
+	ClassLetter string
+	Points      int64
+	Display     string
+}
+
+// Place — строка рейтинга учеников.
+type Place struct {
+	Standing
+	Place int
+}
+
+// Board — первые места и место смотрящего.
+type Board struct {
+	Top   []Place
+	Me    *Place // nil — смотрящего нет в выборке
+	Count int    // сколько учеников занимают места
+}
+
+// Rank строит рейтинг учеников: больше баллов — выше, равные суммы делят место (1, 2, 2, 4).
+// Скрывшиеся ученики мест не занимают; себе такой ученик видит место, которое занял бы.
+func Rank(list []Standing, viewerID int64, top int) Board {
+	var visible []Standing
+	var viewer *Standing
+	for i := range list {
+		if list[i].StudentID == viewerID {
+			viewer = &list[i]
+		}
+		if list[i].Display != DisplayHidden {
+			visible = append(visible, list[i])
+		}
+	}
+	sort.SliceStable(visible, func(i, j int) bool {
+		if visible[i].Points != visible[j].Points {
+			return visible[i].Points > visible[j].Points
+		}
+		return strings.ToLower(visible[i].Name) < strings.ToLower(visible[j].Name)
+	})
+
+	b := Board{Count: len(visible)}
+	place := 0
+	for i, s := range visible {
+		if i == 0 || s.Points != visible[i-1].Points {
+			place = i + 1
+		}
+		p := Place{Standing: s, Place: place}
+		if i < top {
+			b.Top = append(b.Top, p)
+		}
+		if s.StudentID == viewerID {
+			me := p
+			b.Me = &me
+		}
+	}
+	if b.Me == nil && viewer != nil {
+		// скрытый ученик: место среди остальных, как если бы он участвовал
+		above := 0
+		for _, s := range visible {
+			if s.Points > viewer.Points {
+				above++
+			}
+		}
+		b.Me = &Place{Standing: *viewer, Place: above + 1}
+	}
+	return b
+}
+
+// ClassStanding — класс и его коллективный рейтинг за выбранный срок.
+type ClassStanding struct {
+	ClassNumber int64
+	ClassLetter string
+	Points      int64
+	Place       int
+}
+
+// RankClasses упорядочивает классы по коллективному рейтингу, равные делят место.
+func RankClasses(list []ClassStanding) []ClassStanding {
+	out := append([]ClassStanding(nil), list...)
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Points != out[j].Points {
+			return out[i].Points > out[j].Points
+		}
+		if out[i].ClassNumber != out[j].ClassNumber {
+			return out[i].ClassNumber < out[j].ClassNumber
+		}
+		return out[i].ClassLetter < out[j].ClassLetter
+	})
+	for i := range out {
+		if i == 0 || out[i].Points != out[i-1].Points {
+			out[i].Place = i + 1
+		} else {
+			out[i].Place = out[i-1].Place
+		}
+	}
+	return out
+}
+
+// DisplayName — имя ученика в рейтинге с учётом его выбора. reveal — показать полностью
+// (сотрудникам школы и самому ученику).
+func DisplayName(name, mode string, reveal bool) string {
+	if reveal || mode == DisplayFull {
+		return name
+	}
+	return Initials(name)
+}
+
+// Initials — «Иванов Иван Иванович» → «И. И. И.».
+func Initials(name string) string {
+	var parts []string
+	for _, w := range strings.Fields(name) {
+		r, _ := utf8.DecodeRuneInString(w)
+		parts = append(parts, strings.ToUpper(string(r))+".")
+	}
+	if len(parts) == 0 {
+		return "—"
+	}
+	return strings.Join(parts, " ")
+}
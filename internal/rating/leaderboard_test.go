@@ -0,0 +1,71 @@
+package rating
+
+import "testing"
+
+func TestRank_TiesAndTop(t *testing.T) {
+	list := []Standing{
+		{StudentID: 1, Name: "Борисов", Points: 50, Display: DisplayFull},
+		{StudentID: 2, Name: "Алексеев", Points: 80, Display: DisplayFull},
+		{StudentID: 3, Name: "Васильев", Points: 50, Display: DisplayInitials},
+		{StudentID: 4, Name: "Григорьев", Points: 10, Display: DisplayFull},
+	}
+	b := Rank(list, 4, 3)
+	if b.Count != 4 || len(b.Top) != 3 {
+		t.Fatalf("ожидали 4 участника и 3 в топе, получили %d и %d", b.Count, len(b.Top))
+	}
+	want := []struct {
+		id    int64
+		place int
+	}{{2, 1}, {1, 2}, {3, 2}}
+	for i, w := range want {
+		if b.Top[i].StudentID != w.id || b.Top[i].Place != w.place {
+			t.Errorf("место %d: получили ученика %d на %d месте", i, b.Top[i].StudentID, b.Top[i].Place)
+		}
+	}
+	if b.Me == nil || b.Me.Place != 4 {
+		t.Fatalf("смотрящий вне топа должен видеть своё место 4, получили %+v", b.Me)
+	}
+}
+
+func TestRank_HiddenStudent(t *testing.T) {
+	list := []Standing{
+		{StudentID: 1, Name: "Скрытый", Points: 100, Display: DisplayHidden},
+		{StudentID: 2, Name: "Открытый", Points: 60, Display: DisplayFull},
+	}
+	b := Rank(list, 1, 10)
+	if b.Count != 1 || len(b.Top) != 1 || b.Top[0].StudentID != 2 || b.Top[0].Place != 1 {
+		t.Fatalf("скрытый ученик не должен занимать место: %+v", b.Top)
+	}
+	if b.Me == nil || b.Me.Place != 1 {
+		t.Fatalf("скрытый ученик видит место, которое занял бы: %+v", b.Me)
+	}
+	if other := Rank(list, 99, 10); other.Me != nil {
+		t.Fatal("посторонний смотрящий не должен получать место")
+	}
+}
+
+func TestRankClasses(t *testing.T) {
+	got := RankClasses([]ClassStanding{
+		{ClassNumber: 7, ClassLetter: "Б", Points: 30},
+		{ClassNumber: 5, ClassLetter: "А", Points: 90},
+		{ClassNumber: 7, ClassLetter: "А", Points: 30},
+	})
+	if got[0].ClassNumber != 5 || got[0].Place != 1 {
+		t.Fatalf("первым должен быть 5А, получили %+v", got[0])
+	}
+	if got[1].ClassLetter != "А" || got[1].Place != 2 || got[2].Place != 2 {
+		t.Fatalf("равные классы делят место: %+v", got[1:])
+	}
+}
+
+func TestDisplayName(t *testing.T) {
+	if got := DisplayName("Иванов Иван Иванович", DisplayInitials, false); got != "И. И. И." {
+		t.Errorf("инициалы: %q", got)
+	}
+	if got := DisplayName("Иванов Иван", DisplayInitials, true); got != "Иванов Иван" {
+		t.Errorf("reveal должен показывать имя полностью: %q", got)
+	}
+	if got := DisplayName("Иванов Иван", DisplayFull, false); got != "Иванов Иван" {
+		t.Errorf("полное имя: %q", got)
+	}
+}
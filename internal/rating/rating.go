@@ -0,0 +1,42 @@
+// Package rating — правила рейтинга: вклад баллов ученика в коллективный рейтинг
+// класса и места учеников и классов в таблицах «🏆 Рейтинг».
+// Правило вклада хранится в справочнике категорий (и при желании уточняется на уровне),
+// а считается только здесь: им пользуются и запись в журнал начислений, и отчёты.
+package rating
+
+// DefaultPercent — доля баллов, которая идёт классу, если для категории не задано иное.
+const DefaultPercent = 30
+
+// Rule — правило категории для коллективного рейтинга.
+type Rule struct {
+	Affects bool // влияет ли категория на рейтинг класса (у «Аукциона» — нет)
+	Percent int  // какой процент баллов ученика идёт классу, 0..100
+}
+
+// Default — правило, с которым заводятся новые категории.
+func Default() Rule {
+	return Rule{Affects: true, Percent: DefaultPercent}
+}
+
+// WithLevel уточняет правило процентом уровня; nil — процент категории.
+// Флаг «влияет на рейтинг» задаётся только для категории целиком.
+func (r Rule) WithLevel(levelPercent *int) Rule {
+	if levelPercent != nil {
+		r.Percent = *levelPercent
+	}
+	return r
+}
+
+// Share — вклад баллов в рейтинг класса. Знак сохраняется (списание уменьшает рейтинг),
+// дробная часть отбрасывается — как и раньше при «30% от баллов».
+func (r Rule) Share(points int) int {
+	if !r.Affects {
+		return 0
+	}
+	return points * r.Percent / 100
+}
+
+// ValidPercent — допустимое значение процента.
+func ValidPercent(p int) bool {
+	return p >= 0 && p <= 100
+}
@@ -0,0 +1,42 @@
+package rating
+
+import "testing"
+
+func TestRule_Share(t *testing.T) {
+	ten := 10
+	cases := []struct {
+		name   string
+		rule   Rule
+		points int
+		want   int
+	}{
+		{"по умолчанию", Default(), 100, 30},
+		{"списание", Default(), -200, -60},
+		{"отбрасываем дробь", Default(), 55, 16},
+		{"не влияет", Rule{Affects: false, Percent: 30}, 300, 0},
+		{"процент уровня", Default().WithLevel(&ten), 300, 30},
+		{"уровень без процента", Default().WithLevel(nil), 300, 90},
+		{"ноль процентов", Rule{Affects: true}, 300, 0},
+	}
+	for _, c := range cases {
+		if got := c.rule.Share(c.points); got != c.want {
+			t.Errorf("%s: Share(%d) = %d, ожидали %d", c.name, c.points, got, c.want)
+		}
+	}
+}
+
+func TestRule_WithLevelKeepsAffects(t *testing.T) {
+	fifty := 50
+	r := Rule{Affects: false, Percent: 30}.WithLevel(&fifty)
+	if r.Share(100) != 0 {
+		t.Fatalf("процент уровня не должен включать категорию, которая не влияет на рейтинг")
+	}
+}
+
+func TestValidPercent(t *testing.T) {
+	for p, want := range map[int]bool{-1: false, 0: true, 30: true, 100: true, 101: false} {
+		if ValidPercent(p) != want {
+			t.Errorf("ValidPercent(%d) = %v, ожидали %v", p, !want, want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package roster
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/Spok95/telegram-school-bot/internal/export"
+)
+
+// Import разбирает файл, заводит учеников и возвращает итог вместе с Excel-отчётом.
+// Ошибка разбора файла возвращается до обращения к БД.
+func Import(ctx context.Context, database *sql.DB, fileName string, r io.Reader, source string, createdBy *int64) (*db.RosterResult, []byte, error) {
+	rows, err := Parse(fileName, r)
+	if err != nil {
+		return nil, nil, err
+	}
+	res, err := db.ImportRoster(ctx, database, rows, source, fileName, createdBy)
+	if err != nil {
+		return nil, nil, err
+	}
+	report, err := Report(res)
+	if err != nil {
+		return nil, nil, err
+	}
+	return res, report, nil
+}
+
+// Report — отчёт .xlsx: листы «Создано», «Найдено», «Отклонено».
+func Report(res *db.RosterResult) ([]byte, error) {
+	header := []string{"Строка", "ФИО", "Класс", "ФИО родителя", "Телефон", "ID ученика", "Примечание"}
+	sheets := []export.SheetSpec{
+		{Title: "Создано", Header: header},
+		{Title: "Найдено", Header: header},
+		{Title: "Отклонено", Header: header},
+	}
+	for _, o := range res.Outcomes {
+		i := 2
+		switch o.Status {
+		case db.RosterCreated:
+			i = 0
+		case db.RosterMatched:
+			i = 1
+		}
+		id := ""
+		if o.StudentID != 0 {
+			id = strconv.FormatInt(o.StudentID, 10)
+		}
+		sheets[i].Rows = append(sheets[i].Rows, []string{
+			strconv.Itoa(o.Row.Line), o.Row.Name, o.Row.Class, o.Row.ParentName, o.Row.ParentPhone, id, o.Reason,
+		})
+	}
+	wb, err := export.NewUsersWorkbook(sheets)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = wb.File.Close() }()
+	buf, err := wb.File.WriteToBuffer()
+	if err != nil {
+		return nil, fmt.Errorf("roster report: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Summary — короткий итог для сообщения в чат.
+func Summary(res *db.RosterResult) string {
+	s := fmt.Sprintf("✅ Создано: %d\n🔎 Уже были в базе: %d\n❌ Отклонено: %d", res.Created, res.Matched, res.Rejected)
+	if res.Parents > 0 {
+		s += fmt.Sprintf("\n👪 Заведено родителей: %d", res.Parents)
+	}
+	return s
+}
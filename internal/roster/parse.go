@@ -0,0 +1,219 @@
+// Package roster — импорт списков классов из Excel/CSV: разбор файла и отчёт по итогам.
+package roster
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/Spok95/telegram-school-bot/internal/db"
+	"github.com/xuri/excelize/v2"
+)
+
+// MaxFileSize — списки классов небольшие, лимит защищает от случайных архивов.
+const MaxFileSize = 5 << 20
+
+// MaxRows — больше строк в одном файле не принимаем.
+const MaxRows = 5000
+
+var (
+	ErrUnsupported = errors.New("поддерживаются только файлы .xlsx и .csv")
+	ErrEmpty       = errors.New("в файле нет строк с учениками")
+	ErrTooManyRows = fmt.Errorf("в файле больше %d строк", MaxRows)
+	ErrNoColumns   = errors.New("не найдены колонки «ФИО» и «Класс»")
+)
+
+// колонки файла
+const (
+	colName = iota
+	colClass
+	colParentName
+	colParentPhone
+	colCount
+)
+
+// Parse читает список из .xlsx (первый лист) или .csv (разделитель «;» или «,»).
+// Первая строка — заголовок: «ФИО», «Класс», «ФИО родителя», «Телефон».
+// Без узнаваемого заголовка колонки берутся по порядку, а первая строка считается данными.
+func Parse(fileName string, r io.Reader) ([]db.RosterRow, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxFileSize {
+		return nil, fmt.Errorf("файл больше %d МБ", MaxFileSize>>20)
+	}
+
+	var records [][]string
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".xlsx":
+		records, err = readXLSX(data)
+	case ".csv":
+		records, err = readCSV(data)
+	default:
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseRecords(records)
+}
+
+func readXLSX(data []byte) ([][]string, error) {
+	f, err := excelize.OpenReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("не удалось открыть xlsx: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	sheets := f.GetSheetList()
+	if len(sheets) == 0 {
+		return nil, ErrEmpty
+	}
+	return f.GetRows(sheets[0])
+}
+
+func readCSV(data []byte) ([][]string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // BOM из Excel
+	first, _, _ := bytes.Cut(data, []byte("\n"))
+	cr := csv.NewReader(bytes.NewReader(data))
+	// Excel в русской локали сохраняет CSV через «;»
+	if bytes.Count(first, []byte(";")) >= bytes.Count(first, []byte(",")) {
+		cr.Comma = ';'
+	}
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать csv: %w", err)
+	}
+	return records, nil
+}
+
+func parseRecords(records [][]string) ([]db.RosterRow, error) {
+	start := 0
+	for start < len(records) && blank(records[start]) {
+		start++
+	}
+	if start == len(records) {
+		return nil, ErrEmpty
+	}
+
+	cols, ok := headerColumns(records[start])
+	if ok {
+		start++
+	} else {
+		cols = [colCount]int{0, 1, 2, 3}
+	}
+	if cols[colName] < 0 || cols[colClass] < 0 {
+		return nil, ErrNoColumns
+	}
+
+	var out []db.RosterRow
+	for i := start; i < len(records); i++ {
+		rec := records[i]
+		if blank(rec) {
+			continue
+		}
+		if len(out) == MaxRows {
+			return nil, ErrTooManyRows
+		}
+		row := db.RosterRow{
+			Line:        i + 1,
+			Name:        cell(rec, cols[colName]),
+			Class:       cell(rec, cols[colClass]),
+			ParentName:  cell(rec, cols[colParentName]),
+			ParentPhone: NormalizePhone(cell(rec, cols[colParentPhone])),
+		}
+		if n, l, ok := ParseClass(row.Class); ok {
+			row.ClassNumber, row.ClassLetter = n, l
+		}
+		out = append(out, row)
+	}
+	if len(out) == 0 {
+		return nil, ErrEmpty
+	}
+	return out, nil
+}
+
+// headerColumns ищет колонки по заголовку; ok == false — строка не похожа на заголовок.
+func headerColumns(rec []string) ([colCount]int, bool) {
+	cols := [colCount]int{-1, -1, -1, -1}
+	found := false
+	for i, h := range rec {
+		h = strings.ToLower(strings.TrimSpace(h))
+		switch {
+		case strings.Contains(h, "телефон"):
+			cols[colParentPhone] = i
+		case strings.Contains(h, "родител"):
+			cols[colParentName] = i
+		case strings.Contains(h, "класс"):
+			cols[colClass] = i
+		case strings.Contains(h, "фио") || strings.Contains(h, "ученик"):
+			cols[colName] = i
+		default:
+			continue
+		}
+		found = true
+	}
+	return cols, found
+}
+
+// латинские буквы, похожие на кириллицу (как в поиске пользователей)
+var latinToCyrillic = map[rune]rune{
+	'A': 'А', 'B': 'В', 'E': 'Е', 'K': 'К', 'M': 'М', 'H': 'Н',
+	'O': 'О', 'P': 'Р', 'C': 'С', 'T': 'Т', 'X': 'Х',
+}
+
+// ParseClass разбирает «5А», «5 а», «5-А», «11Б» в номер и заглавную букву.
+func ParseClass(s string) (int, string, bool) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return !unicode.IsDigit(r) })
+	if i <= 0 {
+		return 0, "", false
+	}
+	n, err := strconv.Atoi(s[:i])
+	if err != nil || n < 1 || n > db.MaxClassNumber {
+		return 0, "", false
+	}
+	rest := []rune(strings.ToUpper(strings.Trim(s[i:], " -–.")))
+	if len(rest) != 1 || !unicode.IsLetter(rest[0]) {
+		return 0, "", false
+	}
+	if c, ok := latinToCyrillic[rest[0]]; ok {
+		rest[0] = c
+	}
+	return n, string(rest), true
+}
+
+// NormalizePhone убирает пробелы, скобки и дефисы: «+7 (916) 123-45-67» → «+79161234567».
+func NormalizePhone(s string) string {
+	var b strings.Builder
+	for i, r := range strings.TrimSpace(s) {
+		if unicode.IsDigit(r) || (r == '+' && i == 0) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func cell(rec []string, i int) string {
+	if i < 0 || i >= len(rec) {
+		return ""
+	}
+	return strings.TrimSpace(rec[i])
+}
+
+func blank(rec []string) bool {
+	for _, v := range rec {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,87 @@
+package roster
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestParseClass(t *testing.T) {
+	cases := map[string]struct {
+		n  int
+		l  string
+		ok bool
+	}{
+		"5А":   {5, "А", true},
+		"5 а":  {5, "А", true},
+		"11-Б": {11, "Б", true},
+		"7a":   {7, "А", true}, // латинская «a»
+		"12А":  {0, "", false},
+		"5":    {0, "", false},
+		"А5":   {0, "", false},
+		"5АБ":  {0, "", false},
+	}
+	for in, want := range cases {
+		n, l, ok := ParseClass(in)
+		if n != want.n || l != want.l || ok != want.ok {
+			t.Errorf("ParseClass(%q) = %d %q %v, ожидали %d %q %v", in, n, l, ok, want.n, want.l, want.ok)
+		}
+	}
+}
+
+func TestParse_CSV(t *testing.T) {
+	data := "\xef\xbb\xbfКласс;ФИО ученика;ФИО родителя;Телефон\n" +
+		"5А;Иванов Иван;Иванова Мария;+7 (916) 123-45-67\n" +
+		";;;\n" +
+		"5 б;Петров Пётр;;\n"
+	rows, err := Parse("list.csv", strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("ожидали 2 строки, получили %d", len(rows))
+	}
+	r := rows[0]
+	if r.Line != 2 || r.Name != "Иванов Иван" || r.ClassNumber != 5 || r.ClassLetter != "А" ||
+		r.ParentName != "Иванова Мария" || r.ParentPhone != "+79161234567" {
+		t.Fatalf("неверно разобрана строка: %+v", r)
+	}
+	if rows[1].Line != 4 || rows[1].ClassLetter != "Б" {
+		t.Fatalf("пустая строка должна пропускаться, номер строки сохраняться: %+v", rows[1])
+	}
+}
+
+func TestParse_XLSXWithoutHeader(t *testing.T) {
+	f := excelize.NewFile()
+	_ = f.SetSheetRow("Sheet1", "A1", &[]string{"Сидорова Анна", "3В"})
+	_ = f.SetSheetRow("Sheet1", "A2", &[]string{"Кузнецов Олег", "не класс"})
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := Parse("roster.XLSX", bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].Name != "Сидорова Анна" || rows[0].ClassNumber != 3 {
+		t.Fatalf("без заголовка колонки берутся по порядку: %+v", rows)
+	}
+	if rows[1].ClassNumber != 0 || rows[1].Class != "не класс" {
+		t.Fatalf("неразобранный класс должен остаться для отчёта: %+v", rows[1])
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	if _, err := Parse("list.txt", strings.NewReader("x")); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("ожидали ErrUnsupported, получили %v", err)
+	}
+	if _, err := Parse("list.csv", strings.NewReader("ФИО;Класс\n")); !errors.Is(err, ErrEmpty) {
+		t.Fatalf("ожидали ErrEmpty, получили %v", err)
+	}
+	if _, err := Parse("list.csv", strings.NewReader("Класс;Телефон\n5А;1\n")); !errors.Is(err, ErrNoColumns) {
+		t.Fatalf("ожидали ErrNoColumns, получили %v", err)
+	}
+}
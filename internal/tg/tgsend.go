@@ -4,6 +4,8 @@ import (
 	"log"
 	"strings"
 
+	"github.com/Spok95/telegram-school-bot/internal/bot/callback"
+	"github.com/Spok95/telegram-school-bot/internal/metrics"
 	"github.com/Spok95/telegram-school-bot/internal/observability"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -26,7 +28,21 @@ func isSystemErr(err error) bool {
 	return false
 }
 
+// signCallbacks подписывает callback-кнопки исходящего сообщения (см. пакет callback).
+func signCallbacks(msg tgbotapi.Chattable) (tgbotapi.Chattable, error) {
+	signed, err := callback.Default().SignChattable(msg)
+	if err != nil {
+		metrics.CallbackRejected.WithLabelValues("too_long").Inc()
+		log.Printf("[telegram_send_error] kind=%T callback: %v", msg, err)
+	}
+	return signed, err
+}
+
 func Send(bot *tgbotapi.BotAPI, msg tgbotapi.Chattable) (tgbotapi.Message, error) {
+	msg, err := signCallbacks(msg)
+	if err != nil {
+		return tgbotapi.Message{}, err
+	}
 	m, err := bot.Send(msg)
 	if err != nil {
 		log.Printf("[telegram_send_error] kind=%T err=%v", msg, err)
@@ -38,6 +54,10 @@ func Send(bot *tgbotapi.BotAPI, msg tgbotapi.Chattable) (tgbotapi.Message, error
 }
 
 func Request(bot *tgbotapi.BotAPI, req tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	req, err := signCallbacks(req)
+	if err != nil {
+		return nil, err
+	}
 	r, err := bot.Request(req)
 	if isSystemErr(err) {
 		observability.CaptureErr(err)
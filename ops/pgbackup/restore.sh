@@ -0,0 +1,34 @@
+#!/bin/sh
+set -e
+
+# Восстановление из конкретного файла каталога: restore.sh school-20261017T020000Z.sql.gz
+BACKUP_DIR=/backups
+NAME="${1:-}"
+
+PGHOST="${PGHOST:-postgres}"
+PGPORT="${PGPORT:-5432}"
+PGUSER="${PGUSER:-school}"
+PGDATABASE="${PGDATABASE:-school}"
+
+# только имя файла из каталога, без путей
+case "$NAME" in
+  ""|*/*|.*) echo "bad file name"; exit 1 ;;
+  *.sql.gz|*.sql) ;;
+  *) echo "unsupported file: $NAME"; exit 1 ;;
+esac
+
+FILE="$BACKUP_DIR/$NAME"
+if [ ! -f "$FILE" ]; then
+  echo "no $NAME in $BACKUP_DIR"
+  exit 1
+fi
+
+psql -h "$PGHOST" -U "$PGUSER" -d "$PGDATABASE" \
+  -c "DROP SCHEMA public CASCADE; CREATE SCHEMA public;" >/dev/null 2>&1
+
+case "$NAME" in
+  *.gz) gzip -dc "$FILE" | psql -h "$PGHOST" -U "$PGUSER" -d "$PGDATABASE" >/dev/null 2>&1 ;;
+  *)    psql -h "$PGHOST" -U "$PGUSER" -d "$PGDATABASE" -f "$FILE" >/dev/null 2>&1 ;;
+esac
+
+echo "$FILE"